@@ -0,0 +1,246 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+	"github.com/pkg/errors"
+)
+
+var csvHeader = []string{
+	"hour", "tenant", "topic",
+	"produced_messages", "produced_bytes",
+	"consumed_messages", "consumed_bytes",
+}
+
+// Producer defines a subset of the producer API that is used to export usage
+// records to a Kafka topic.
+type Producer interface {
+	AsyncProduce(topic string, key, message sarama.Encoder)
+}
+
+// Usage represents the amount of data that was produced to and consumed from
+// a topic on behalf of a tenant during an hour.
+type Usage struct {
+	Hour             time.Time `json:"hour"`
+	Tenant           string    `json:"tenant"`
+	Topic            string    `json:"topic"`
+	ProducedMessages int64     `json:"produced_messages"`
+	ProducedBytes    int64     `json:"produced_bytes"`
+	ConsumedMessages int64     `json:"consumed_messages"`
+	ConsumedBytes    int64     `json:"consumed_bytes"`
+}
+
+// T aggregates usage counters per tenant per topic per hour, and periodically
+// exports counters of completed hours to a Kafka topic and/or a CSV file.
+type T struct {
+	actorID *actor.ID
+	cfg     *config.Proxy
+	prod    Producer
+	stopCh  chan none.T
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	usage    map[usageKey]*Usage
+	exported map[usageKey]bool
+
+	// To be used in tests only
+	now func() time.Time
+}
+
+type usageKey struct {
+	hour   time.Time
+	tenant string
+	topic  string
+}
+
+// Spawn creates an accounting instance and starts its internal goroutines.
+// If export to a Kafka topic is configured then `prod` is used to produce
+// usage records.
+func Spawn(namespace *actor.ID, cfg *config.Proxy, prod Producer) *T {
+	a := &T{
+		actorID:  namespace.NewChild("accounting"),
+		cfg:      cfg,
+		prod:     prod,
+		stopCh:   make(chan none.T),
+		usage:    make(map[usageKey]*Usage),
+		exported: make(map[usageKey]bool),
+		now:      time.Now,
+	}
+	actor.Spawn(a.actorID, &a.wg, a.run)
+	return a
+}
+
+// Stop terminates the accounting goroutines. Usage of completed hours that
+// has not been exported yet is exported before it returns.
+func (a *T) Stop() {
+	close(a.stopCh)
+	a.wg.Wait()
+}
+
+// CountProduced registers a message of the specified size produced to a
+// topic on behalf of a tenant.
+func (a *T) CountProduced(tenant, topic string, size int) {
+	a.mu.Lock()
+	u := a.getUsage(tenant, topic)
+	u.ProducedMessages++
+	u.ProducedBytes += int64(size)
+	a.mu.Unlock()
+}
+
+// CountConsumed registers a message of the specified size consumed from a
+// topic on behalf of a tenant.
+func (a *T) CountConsumed(tenant, topic string, size int) {
+	a.mu.Lock()
+	u := a.getUsage(tenant, topic)
+	u.ConsumedMessages++
+	u.ConsumedBytes += int64(size)
+	a.mu.Unlock()
+}
+
+// Usage returns all usage records that are currently kept in memory, ordered
+// by hour, tenant, and topic.
+func (a *T) Usage() []Usage {
+	a.mu.Lock()
+	usage := make([]Usage, 0, len(a.usage))
+	for _, u := range a.usage {
+		usage = append(usage, *u)
+	}
+	a.mu.Unlock()
+	sortUsage(usage)
+	return usage
+}
+
+// getUsage returns a usage record of the current hour for the specified
+// tenant and topic. It must be called with `mu` locked.
+func (a *T) getUsage(tenant, topic string) *Usage {
+	key := usageKey{a.now().UTC().Truncate(time.Hour), tenant, topic}
+	u := a.usage[key]
+	if u == nil {
+		u = &Usage{Hour: key.hour, Tenant: tenant, Topic: topic}
+		a.usage[key] = u
+	}
+	return u
+}
+
+func (a *T) run() {
+	ticker := time.NewTicker(a.cfg.Accounting.ExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.exportCompleted()
+		case <-a.stopCh:
+			a.exportCompleted()
+			return
+		}
+	}
+}
+
+// exportCompleted exports usage records of all completed hours that have not
+// been exported yet, and discards records that are older than retention.
+func (a *T) exportCompleted() {
+	now := a.now().UTC()
+	currentHour := now.Truncate(time.Hour)
+	var pending []Usage
+	a.mu.Lock()
+	for key, u := range a.usage {
+		if now.Sub(key.hour) > a.cfg.Accounting.Retention+time.Hour {
+			delete(a.usage, key)
+			delete(a.exported, key)
+			continue
+		}
+		if key.hour.Before(currentHour) && !a.exported[key] {
+			pending = append(pending, *u)
+		}
+	}
+	a.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	sortUsage(pending)
+
+	if a.cfg.Accounting.ExportTopic != "" {
+		a.exportToKafka(pending)
+	}
+	if a.cfg.Accounting.ExportCSVFile != "" {
+		if err := a.exportToCSV(pending); err != nil {
+			// Records will be exported on the next attempt, so if export to
+			// Kafka is also configured they are produced to Kafka again.
+			log.Errorf("<%s> failed to export usage: %s", a.actorID, err)
+			return
+		}
+	}
+	a.mu.Lock()
+	for _, u := range pending {
+		a.exported[usageKey{u.Hour, u.Tenant, u.Topic}] = true
+	}
+	a.mu.Unlock()
+}
+
+func (a *T) exportToKafka(usage []Usage) {
+	for _, u := range usage {
+		encoded, err := json.Marshal(u)
+		if err != nil {
+			panic(err)
+		}
+		a.prod.AsyncProduce(a.cfg.Accounting.ExportTopic,
+			sarama.StringEncoder(u.Tenant), sarama.ByteEncoder(encoded))
+	}
+}
+
+func (a *T) exportToCSV(usage []Usage) error {
+	filename := a.cfg.Accounting.ExportCSVFile
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open CSV file")
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat CSV file")
+	}
+	w := csv.NewWriter(f)
+	if fi.Size() == 0 {
+		w.Write(csvHeader)
+	}
+	for _, u := range usage {
+		w.Write([]string{
+			u.Hour.Format(time.RFC3339), u.Tenant, u.Topic,
+			strconv.FormatInt(u.ProducedMessages, 10),
+			strconv.FormatInt(u.ProducedBytes, 10),
+			strconv.FormatInt(u.ConsumedMessages, 10),
+			strconv.FormatInt(u.ConsumedBytes, 10),
+		})
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "failed to write CSV file")
+}
+
+func sortUsage(usage []Usage) {
+	sort.Sort(usageSlice(usage))
+}
+
+type usageSlice []Usage
+
+func (p usageSlice) Len() int      { return len(p) }
+func (p usageSlice) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p usageSlice) Less(i, j int) bool {
+	if !p[i].Hour.Equal(p[j].Hour) {
+		return p[i].Hour.Before(p[j].Hour)
+	}
+	if p[i].Tenant != p[j].Tenant {
+		return p[i].Tenant < p[j].Tenant
+	}
+	return p[i].Topic < p[j].Topic
+}
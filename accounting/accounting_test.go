@@ -0,0 +1,162 @@
+package accounting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AccountingSuite{})
+
+type AccountingSuite struct {
+	ns     *actor.ID
+	cfg    *config.Proxy
+	tmpDir string
+	now    time.Time
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *AccountingSuite) SetUpTest(c *C) {
+	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
+	s.cfg.Accounting.Enabled = true
+	s.cfg.Accounting.ExportInterval = time.Hour
+	s.tmpDir = c.MkDir()
+	s.now = time.Date(2016, 11, 3, 10, 15, 0, 0, time.UTC)
+}
+
+func (s *AccountingSuite) spawn(prod Producer) *T {
+	a := Spawn(s.ns, s.cfg, prod)
+	a.now = func() time.Time { return s.now }
+	return a
+}
+
+// Usage is aggregated per hour, tenant, and topic.
+func (s *AccountingSuite) TestUsage(c *C) {
+	a := s.spawn(nil)
+	defer a.Stop()
+
+	// When
+	a.CountProduced("t1", "foo", 10)
+	a.CountProduced("t1", "foo", 20)
+	a.CountConsumed("t1", "foo", 5)
+	a.CountProduced("t2", "foo", 7)
+	a.CountConsumed("t1", "bar", 3)
+	s.now = s.now.Add(time.Hour)
+	a.CountProduced("t1", "foo", 1)
+
+	// Then
+	hour := time.Date(2016, 11, 3, 10, 0, 0, 0, time.UTC)
+	c.Assert(a.Usage(), DeepEquals, []Usage{
+		{Hour: hour, Tenant: "t1", Topic: "bar", ConsumedMessages: 1, ConsumedBytes: 3},
+		{Hour: hour, Tenant: "t1", Topic: "foo", ProducedMessages: 2, ProducedBytes: 30, ConsumedMessages: 1, ConsumedBytes: 5},
+		{Hour: hour, Tenant: "t2", Topic: "foo", ProducedMessages: 1, ProducedBytes: 7},
+		{Hour: hour.Add(time.Hour), Tenant: "t1", Topic: "foo", ProducedMessages: 1, ProducedBytes: 1},
+	})
+}
+
+// Only completed hours are exported to CSV, and every record is exported only
+// once.
+func (s *AccountingSuite) TestExportCSV(c *C) {
+	s.cfg.Accounting.ExportCSVFile = path.Join(s.tmpDir, "usage.csv")
+	a := s.spawn(nil)
+	defer a.Stop()
+	a.CountProduced("t1", "foo", 10)
+	a.CountConsumed("t1", "bar", 3)
+	s.now = s.now.Add(time.Hour)
+	a.CountProduced("t1", "foo", 1)
+
+	// When
+	a.exportCompleted()
+	a.exportCompleted()
+
+	// Then
+	data, err := ioutil.ReadFile(s.cfg.Accounting.ExportCSVFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals,
+		"hour,tenant,topic,produced_messages,produced_bytes,consumed_messages,consumed_bytes\n"+
+			"2016-11-03T10:00:00Z,t1,bar,0,0,1,3\n"+
+			"2016-11-03T10:00:00Z,t1,foo,1,10,0,0\n")
+}
+
+// If export to CSV fails, then it is retried on the next attempt.
+func (s *AccountingSuite) TestExportCSVError(c *C) {
+	s.cfg.Accounting.ExportCSVFile = path.Join(s.tmpDir, "missing", "usage.csv")
+	a := s.spawn(nil)
+	defer a.Stop()
+	a.CountProduced("t1", "foo", 10)
+	s.now = s.now.Add(time.Hour)
+	a.exportCompleted()
+
+	// When
+	c.Assert(os.Mkdir(path.Join(s.tmpDir, "missing"), 0755), IsNil)
+	a.exportCompleted()
+
+	// Then
+	data, err := ioutil.ReadFile(s.cfg.Accounting.ExportCSVFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals,
+		"hour,tenant,topic,produced_messages,produced_bytes,consumed_messages,consumed_bytes\n"+
+			"2016-11-03T10:00:00Z,t1,foo,1,10,0,0\n")
+}
+
+// Completed hours are produced to the export topic as JSON keyed by tenant.
+func (s *AccountingSuite) TestExportKafka(c *C) {
+	s.cfg.Accounting.ExportTopic = "usage"
+	prod := &mockProducer{}
+	a := s.spawn(prod)
+	a.CountProduced("t1", "foo", 10)
+	s.now = s.now.Add(time.Hour)
+
+	// When
+	a.Stop()
+
+	// Then
+	c.Assert(len(prod.msgs), Equals, 1)
+	c.Assert(prod.msgs[0].Topic, Equals, "usage")
+	c.Assert(prod.msgs[0].Key, Equals, sarama.StringEncoder("t1"))
+	var u Usage
+	encoded, _ := prod.msgs[0].Value.Encode()
+	c.Assert(json.Unmarshal(encoded, &u), IsNil)
+	c.Assert(u, DeepEquals, Usage{
+		Hour: time.Date(2016, 11, 3, 10, 0, 0, 0, time.UTC), Tenant: "t1",
+		Topic: "foo", ProducedMessages: 1, ProducedBytes: 10})
+}
+
+// Records older than retention are discarded.
+func (s *AccountingSuite) TestRetention(c *C) {
+	s.cfg.Accounting.Retention = 2 * time.Hour
+	a := s.spawn(nil)
+	defer a.Stop()
+	a.CountProduced("t1", "foo", 10)
+	s.now = s.now.Add(time.Hour)
+	a.CountProduced("t1", "foo", 20)
+
+	// When
+	s.now = s.now.Add(2 * time.Hour)
+	a.exportCompleted()
+
+	// Then
+	c.Assert(a.Usage(), DeepEquals, []Usage{{
+		Hour: time.Date(2016, 11, 3, 11, 0, 0, 0, time.UTC), Tenant: "t1",
+		Topic: "foo", ProducedMessages: 1, ProducedBytes: 20}})
+}
+
+type mockProducer struct {
+	msgs []*sarama.ProducerMessage
+}
+
+func (p *mockProducer) AsyncProduce(topic string, key, message sarama.Encoder) {
+	p.msgs = append(p.msgs, &sarama.ProducerMessage{Topic: topic, Key: key, Value: message})
+}
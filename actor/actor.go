@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"runtime/debug"
+	"sort"
 	"sync"
 
 	"github.com/mailgun/log"
@@ -18,6 +19,11 @@ type ID struct {
 // RootID is the root of the context id hierarchy.
 var RootID = &ID{}
 
+var (
+	runningMu sync.Mutex
+	running   = make(map[*ID]int)
+)
+
 // NewChild creates a child id.
 func (id *ID) NewChild(nameParts ...interface{}) *ID {
 	if len(nameParts) == 0 {
@@ -58,7 +64,9 @@ func Spawn(actorID *ID, wg *sync.WaitGroup, f func()) {
 			defer wg.Done()
 		}
 		log.Infof("<%s> started", actorID)
+		register(actorID)
 		defer func() {
+			unregister(actorID)
 			if p := recover(); p != nil {
 				log.Errorf("<%s> paniced: %v, stack=%s", actorID, p, debug.Stack())
 				panic(p)
@@ -68,3 +76,33 @@ func Spawn(actorID *ID, wg *sync.WaitGroup, f func()) {
 		f()
 	}()
 }
+
+// Running returns IDs of all actors spawned with `Spawn` that have not
+// stopped yet, ordered by name, so that children follow their parents. An
+// actor ID is listed as many times as many goroutines are running with it.
+func Running() []string {
+	runningMu.Lock()
+	names := make([]string, 0, len(running))
+	for actorID, count := range running {
+		for i := 0; i < count; i++ {
+			names = append(names, actorID.String())
+		}
+	}
+	runningMu.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+func register(actorID *ID) {
+	runningMu.Lock()
+	running[actorID]++
+	runningMu.Unlock()
+}
+
+func unregister(actorID *ID) {
+	runningMu.Lock()
+	if running[actorID]--; running[actorID] <= 0 {
+		delete(running, actorID)
+	}
+	runningMu.Unlock()
+}
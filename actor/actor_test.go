@@ -2,6 +2,8 @@ package actor
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -49,3 +51,41 @@ func (s *IDSuite) TestNewChildEmpty(c *C) {
 func (s *IDSuite) TestNewChildComplex(c *C) {
 	c.Assert(RootID.NewChild("foo", 0, []string{"d"}, nil, "bar").String(), Equals, "/foo_0_[d]_<nil>_bar[0]")
 }
+
+// Actors are listed while they are running.
+func (s *IDSuite) TestRunning(c *C) {
+	parentID := RootID.NewChild("running")
+	childID := parentID.NewChild("child")
+	stopCh := make(chan struct{})
+	startedCh := make(chan struct{}, 3)
+	var wg sync.WaitGroup
+	for _, actorID := range []*ID{childID, parentID, childID} {
+		Spawn(actorID, &wg, func() {
+			startedCh <- struct{}{}
+			<-stopCh
+		})
+	}
+	for i := 0; i < 3; i++ {
+		<-startedCh
+	}
+
+	// When
+	running := Running()
+
+	// Then
+	c.Assert(filterPrefix(running, "/running"), DeepEquals,
+		[]string{"/running[0]", "/running[0]/child[0]", "/running[0]/child[0]"})
+	close(stopCh)
+	wg.Wait()
+	c.Assert(filterPrefix(Running(), "/running"), IsNil)
+}
+
+func filterPrefix(names []string, prefix string) []string {
+	var filtered []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
@@ -1,7 +1,7 @@
 package admin
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
@@ -11,32 +11,23 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer/groupcsm"
+	"github.com/mailgun/kafka-pixy/consumer/groupmember"
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
-type (
-	ErrSetup        error
-	ErrInvalidParam error
-	ErrQuery        struct {
-		err  error
-		desc string
-	}
-)
-
-func NewErrQuery(err error, format string, v ...interface{}) ErrQuery {
-	return ErrQuery{err, fmt.Sprintf(format, v...)}
-}
-
-func (e ErrQuery) Error() string {
-	return fmt.Sprintf("%s, err=(%s)", e.desc, e.err)
-}
-
-func (e ErrQuery) Cause() error {
-	return e.err
-}
-
 const (
 	ProtocolVer1 = 1 // Supported by Kafka v0.8.2 and later
+
+	// The initial and the largest fetch size used by `ReadMessages`. The
+	// fetch size is doubled if a message does not fit.
+	readFetchSize    = 1024 * 1024
+	readMaxFetchSize = 64 * 1024 * 1024
+
+	// Session timeout of the ZooKeeper connection, it also bounds the time
+	// `CheckZooKeeper` waits for a session to be established.
+	zkSessionTimeout = 1 * time.Second
 )
 
 // T provides methods to perform administrative operations on a Kafka cluster.
@@ -78,7 +69,21 @@ type PartitionOffset struct {
 	Metadata  string
 }
 
+// Lag returns the number of messages in the partition that are past the
+// committed offset.
+func (po PartitionOffset) Lag() int64 {
+	switch po.Offset {
+	case sarama.OffsetNewest:
+		return 0
+	case sarama.OffsetOldest:
+		return po.End - po.Begin
+	default:
+		return po.End - po.Offset
+	}
+}
+
 type indexedPartition struct {
+	topic     string
 	index     int
 	partition int32
 }
@@ -93,58 +98,133 @@ func (a *T) GetGroupOffsets(group, topic string) ([]PartitionOffset, error) {
 	}
 	partitions, err := kafkaClt.Partitions(topic)
 	if err != nil {
-		return nil, NewErrQuery(err, "failed to get topic partitions")
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topic partitions")
 	}
+	topicPartitions := map[string][]int32{topic: partitions}
+	offsets, err := getOffsetRanges(kafkaClt, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+	if err := getCommittedOffsets(kafkaClt, group, topicPartitions, offsets); err != nil {
+		return nil, err
+	}
+	return offsets[topic], nil
+}
 
+// GetAllGroupOffsets returns offsets of the specified consumer group for every
+// topic that the group has committed offsets for, in the same form as
+// `GetGroupOffsets` does. All topics are queried at once, so it is much
+// cheaper than calling `GetGroupOffsets` for every topic.
+func (a *T) GetAllGroupOffsets(group string) (map[string][]PartitionOffset, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	topics, err := kafkaClt.Topics()
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topics")
+	}
+	topicPartitions := make(map[string][]int32, len(topics))
+	offsets := make(map[string][]PartitionOffset, len(topics))
+	for _, topic := range topics {
+		partitions, err := kafkaClt.Partitions(topic)
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topic partitions: topic=%s", topic)
+		}
+		topicPartitions[topic] = partitions
+		offsets[topic] = make([]PartitionOffset, len(partitions))
+	}
+	if err := getCommittedOffsets(kafkaClt, group, topicPartitions, offsets); err != nil {
+		return nil, err
+	}
+	// The offset protocol version supported by Kafka v0.8.2 does not allow
+	// to ask for topics that a group has committed offsets for, so all topics
+	// are queried, and those without committed offsets are dropped.
+	for topic, topicOffsets := range offsets {
+		committed := false
+		for _, po := range topicOffsets {
+			if po.Offset != sarama.OffsetNewest {
+				committed = true
+				break
+			}
+		}
+		if !committed {
+			delete(topicPartitions, topic)
+			delete(offsets, topic)
+		}
+	}
+	ranges, err := getOffsetRanges(kafkaClt, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+	for topic, topicRanges := range ranges {
+		for i := range topicRanges {
+			topicRanges[i].Offset = offsets[topic][i].Offset
+			topicRanges[i].Metadata = offsets[topic][i].Metadata
+		}
+		offsets[topic] = topicRanges
+	}
+	return offsets, nil
+}
+
+// getOffsetRanges returns the current offset range of every partition of the
+// specified topics. Offsets of a topic are listed in the same order as its
+// partitions in `topicPartitions`.
+func getOffsetRanges(kafkaClt sarama.Client, topicPartitions map[string][]int32) (map[string][]PartitionOffset, error) {
 	// Figure out distribution of partitions among brokers.
 	brokerToPartitions := make(map[*sarama.Broker][]indexedPartition)
-	for i, p := range partitions {
-		broker, err := kafkaClt.Leader(topic, p)
-		if err != nil {
-			return nil, NewErrQuery(err, "failed to get partition leader: partition=%d", p)
+	offsets := make(map[string][]PartitionOffset, len(topicPartitions))
+	for topic, partitions := range topicPartitions {
+		for i, p := range partitions {
+			broker, err := kafkaClt.Leader(topic, p)
+			if err != nil {
+				return nil, errs.Wrap(errs.ErrQuery, err, "failed to get partition leader: topic=%s, partition=%d", topic, p)
+			}
+			brokerToPartitions[broker] = append(brokerToPartitions[broker], indexedPartition{topic, i, p})
 		}
-		brokerToPartitions[broker] = append(brokerToPartitions[broker], indexedPartition{i, p})
+		offsets[topic] = make([]PartitionOffset, len(partitions))
 	}
 
 	// Query brokers for the oldest and newest offsets of the partitions that
 	// they are leaders for.
-	offsets := make([]PartitionOffset, len(partitions))
 	var wg sync.WaitGroup
-	errorsCh := make(chan ErrQuery, len(brokerToPartitions))
+	errorsCh := make(chan error, len(brokerToPartitions))
 	for broker, brokerPartitions := range brokerToPartitions {
 		broker, brokerPartitions := broker, brokerPartitions
 		var reqNewest sarama.OffsetRequest
 		var reqOldest sarama.OffsetRequest
 		for _, p := range brokerPartitions {
-			reqNewest.AddBlock(topic, p.partition, sarama.OffsetNewest, 1)
-			reqOldest.AddBlock(topic, p.partition, sarama.OffsetOldest, 1)
+			reqNewest.AddBlock(p.topic, p.partition, sarama.OffsetNewest, 1)
+			reqOldest.AddBlock(p.topic, p.partition, sarama.OffsetOldest, 1)
 		}
 		actorID := actor.RootID.NewChild("adminOffsetFetcher")
 		actor.Spawn(actorID, &wg, func() {
 			resOldest, err := broker.GetAvailableOffsets(&reqOldest)
 			if err != nil {
-				errorsCh <- NewErrQuery(err, "failed to fetch oldest offset: broker=%v", broker.ID())
+				errorsCh <- errs.Wrap(errs.ErrQuery, err, "failed to fetch oldest offset: broker=%v", broker.ID())
 				return
 			}
 			resNewest, err := broker.GetAvailableOffsets(&reqNewest)
 			if err != nil {
-				errorsCh <- NewErrQuery(err, "failed to fetch newest offset: broker=%v", broker.ID())
+				errorsCh <- errs.Wrap(errs.ErrQuery, err, "failed to fetch newest offset: broker=%v", broker.ID())
 				return
 			}
 			for _, xp := range brokerPartitions {
-				begin, err := getOffsetResult(resOldest, topic, xp.partition)
+				begin, err := getOffsetResult(resOldest, xp.topic, xp.partition)
 				if err != nil {
-					errorsCh <- NewErrQuery(err, "failed to fetch oldest offset: broker=%v", broker.ID())
+					errorsCh <- errs.Wrap(errs.ErrQuery, err, "failed to fetch oldest offset: broker=%v", broker.ID())
 					return
 				}
-				end, err := getOffsetResult(resNewest, topic, xp.partition)
+				end, err := getOffsetResult(resNewest, xp.topic, xp.partition)
 				if err != nil {
-					errorsCh <- NewErrQuery(err, "failed to fetch newest offset: broker=%v", broker.ID())
+					errorsCh <- errs.Wrap(errs.ErrQuery, err, "failed to fetch newest offset: broker=%v", broker.ID())
 					return
 				}
-				offsets[xp.index].Partition = xp.partition
-				offsets[xp.index].Begin = begin
-				offsets[xp.index].End = end
+				// Every goroutine writes to its own elements only.
+				po := &offsets[xp.topic][xp.index]
+				po.Partition = xp.partition
+				po.Begin = begin
+				po.End = end
 			}
 		})
 	}
@@ -155,30 +235,39 @@ func (a *T) GetGroupOffsets(group, topic string) ([]PartitionOffset, error) {
 	if err, ok := <-errorsCh; ok {
 		return nil, err
 	}
+	return offsets, nil
+}
 
-	// Fetch the last committed offsets for all partitions of the group/topic.
+// getCommittedOffsets fetches the last committed offsets for all partitions of
+// the specified topics on behalf of the group, and stores them in `offsets`,
+// that must have an element for every partition listed in `topicPartitions`.
+func getCommittedOffsets(kafkaClt sarama.Client, group string, topicPartitions map[string][]int32, offsets map[string][]PartitionOffset) error {
 	coordinator, err := kafkaClt.Coordinator(group)
 	if err != nil {
-		return nil, NewErrQuery(err, "failed to get coordinator")
+		return errs.Wrap(errs.ErrQuery, err, "failed to get coordinator")
 	}
 	req := sarama.OffsetFetchRequest{ConsumerGroup: group, Version: ProtocolVer1}
-	for _, p := range partitions {
-		req.AddPartition(topic, p)
+	for topic, partitions := range topicPartitions {
+		for _, p := range partitions {
+			req.AddPartition(topic, p)
+		}
 	}
 	res, err := coordinator.FetchOffset(&req)
 	if err != nil {
-		return nil, NewErrQuery(err, "failed to fetch offsets")
+		return errs.Wrap(errs.ErrQuery, err, "failed to fetch offsets")
 	}
-	for i, p := range partitions {
-		block := res.GetBlock(topic, p)
-		if block == nil {
-			return nil, NewErrQuery(nil, "offset block is missing: partition=%d", p)
+	for topic, partitions := range topicPartitions {
+		for i, p := range partitions {
+			block := res.GetBlock(topic, p)
+			if block == nil {
+				return errs.New(errs.ErrQuery, "offset block is missing: topic=%s, partition=%d", topic, p)
+			}
+			offsets[topic][i].Partition = p
+			offsets[topic][i].Offset = block.Offset
+			offsets[topic][i].Metadata = block.Metadata
 		}
-		offsets[i].Offset = block.Offset
-		offsets[i].Metadata = block.Metadata
 	}
-
-	return offsets, nil
+	return nil
 }
 
 // SetGroupOffsets commits specific offset values along with metadata for a list
@@ -190,7 +279,7 @@ func (a *T) SetGroupOffsets(group, topic string, offsets []PartitionOffset) erro
 	}
 	coordinator, err := kafkaClt.Coordinator(group)
 	if err != nil {
-		return NewErrQuery(err, "failed to get coordinator")
+		return errs.Wrap(errs.ErrQuery, err, "failed to get coordinator")
 	}
 
 	req := sarama.OffsetCommitRequest{
@@ -203,19 +292,283 @@ func (a *T) SetGroupOffsets(group, topic string, offsets []PartitionOffset) erro
 	}
 	res, err := coordinator.CommitOffset(&req)
 	if err != nil {
-		return NewErrQuery(err, "failed to commit offsets")
+		return errs.Wrap(errs.ErrQuery, err, "failed to commit offsets")
 	}
 	for p, err := range res.Errors[topic] {
 		if err != sarama.ErrNoError {
-			return NewErrQuery(err, "failed to commit offset: partition=%d", p)
+			return errs.Wrap(errs.ErrQuery, err, "failed to commit offset: partition=%d", p)
 		}
 	}
 	return nil
 }
 
+// GetOffsetsByTime for every partition of the specified topic returns the
+// current offset range along with the offset of messages produced around the
+// specified time. Kafka v0.8.2 resolves time to offsets with log segment
+// granularity, so the returned offset is that of the first message of the
+// latest segment that had been last written to before the time. That is it
+// can be well before the time, but never after. If all segments have been
+// written to after the time, then the oldest offset is returned.
+func (a *T) GetOffsetsByTime(topic string, t time.Time) ([]PartitionOffset, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := kafkaClt.Partitions(topic)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topic partitions")
+	}
+	ranges, err := getOffsetRanges(kafkaClt, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+	offsets := ranges[topic]
+	timeMs := t.UnixNano() / int64(time.Millisecond)
+	for i := range offsets {
+		po := &offsets[i]
+		offset, err := kafkaClt.GetOffset(topic, po.Partition, timeMs)
+		if err != nil {
+			if err != sarama.ErrOffsetOutOfRange {
+				return nil, errs.Wrap(errs.ErrQuery, err, "failed to get offset by time: partition=%d", po.Partition)
+			}
+			offset = po.Begin
+		}
+		// Segments can be deleted by retention in the meantime.
+		if offset < po.Begin {
+			offset = po.Begin
+		}
+		if offset > po.End {
+			offset = po.End
+		}
+		po.Offset = offset
+	}
+	return offsets, nil
+}
+
+// Message is a message read directly from a partition by `ReadMessages`.
+type Message struct {
+	Key, Value []byte
+	Offset     int64
+}
+
+// ReadMessages reads up to `count` messages from a partition starting from
+// `offset`. It does not involve a consumer group, so no offsets are committed,
+// and it does not wait for new messages, that is if there are fewer than
+// `count` messages available after `offset`, then only available ones are
+// returned. If `offset` is not in the range of available offsets, then
+// `errs.ErrInvalidParam` is returned.
+func (a *T) ReadMessages(topic string, partition int32, offset int64, count int) ([]Message, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	broker, err := kafkaClt.Leader(topic, partition)
+	if err != nil {
+		if err == sarama.ErrUnknownTopicOrPartition {
+			return nil, errs.Wrap(errs.ErrInvalidParam, err, "unknown partition: partition=%d", partition)
+		}
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get partition leader: partition=%d", partition)
+	}
+	var messages []Message
+	fetchSize := int32(readFetchSize)
+	for len(messages) < count {
+		req := sarama.FetchRequest{MinBytes: 1}
+		req.AddBlock(topic, partition, offset, fetchSize)
+		res, err := broker.Fetch(&req)
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch messages: broker=%v", broker.ID())
+		}
+		block := res.GetBlock(topic, partition)
+		if block == nil {
+			return nil, errs.New(errs.ErrQuery, "fetch block is missing: partition=%d", partition)
+		}
+		switch block.Err {
+		case sarama.ErrNoError:
+		case sarama.ErrOffsetOutOfRange:
+			return nil, errs.Wrap(errs.ErrInvalidParam, block.Err, "offset out of range: offset=%d", offset)
+		default:
+			return nil, errs.Wrap(errs.ErrQuery, block.Err, "failed to fetch messages: partition=%d", partition)
+		}
+		fetched := 0
+		for _, msgBlock := range block.MsgSet.Messages {
+			// Messages of a compressed message set are all returned, even if
+			// the requested offset is in the middle of it.
+			for _, msg := range msgBlock.Messages() {
+				if msg.Offset < offset || len(messages) >= count {
+					continue
+				}
+				messages = append(messages, Message{Key: msg.Msg.Key, Value: msg.Msg.Value, Offset: msg.Offset})
+				offset = msg.Offset + 1
+				fetched++
+			}
+		}
+		if fetched > 0 {
+			continue
+		}
+		if !block.MsgSet.PartialTrailingMessage {
+			break
+		}
+		// The next message is larger than the fetch size.
+		if fetchSize >= readMaxFetchSize {
+			return nil, errs.New(errs.ErrQuery, "message too large: offset=%d", offset)
+		}
+		fetchSize *= 2
+	}
+	return messages, nil
+}
+
+// PartitionMetadata describes placement of a partition in the cluster. Brokers
+// are identified by IDs.
+type PartitionMetadata struct {
+	Partition int32
+	Leader    int32
+	Replicas  []int32
+	ISR       []int32
+}
+
+// GetTopicMetadata refreshes metadata of the specified topic from the cluster
+// and returns metadata of all its partitions ordered by partition ID.
+func (a *T) GetTopicMetadata(topic string) ([]PartitionMetadata, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	if err := kafkaClt.RefreshMetadata(topic); err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to refresh metadata")
+	}
+	partitions, err := kafkaClt.Partitions(topic)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topic partitions")
+	}
+	if len(partitions) == 0 {
+		return nil, errs.Wrap(errs.ErrQuery, sarama.ErrUnknownTopicOrPartition, "no partitions")
+	}
+	// The client does not expose ISRs, so the metadata is requested directly
+	// from a broker that is known to be alive.
+	broker, err := kafkaClt.Leader(topic, partitions[0])
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get partition leader: partition=%d", partitions[0])
+	}
+	res, err := broker.GetMetadata(&sarama.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch metadata: broker=%v", broker.ID())
+	}
+	for _, tm := range res.Topics {
+		if tm.Name != topic {
+			continue
+		}
+		if tm.Err != sarama.ErrNoError {
+			return nil, errs.Wrap(errs.ErrQuery, tm.Err, "failed to fetch metadata: broker=%v", broker.ID())
+		}
+		metadata := make([]PartitionMetadata, len(tm.Partitions))
+		for i, pm := range tm.Partitions {
+			metadata[i] = PartitionMetadata{
+				Partition: pm.ID,
+				Leader:    pm.Leader,
+				Replicas:  pm.Replicas,
+				ISR:       pm.Isr,
+			}
+		}
+		sort.Slice(metadata, func(i, j int) bool { return metadata[i].Partition < metadata[j].Partition })
+		return metadata, nil
+	}
+	return nil, errs.New(errs.ErrQuery, "topic metadata is missing")
+}
+
+// TopicInfo describes a topic listed by `GetTopics`. Fields other than the
+// topic name are only set if requested.
+type TopicInfo struct {
+	Topic      string
+	Partitions int
+	Config     map[string]string
+}
+
+// GetTopics returns all topics of the cluster ordered by name, optionally
+// with partition counts and topic config overrides. Config is read from
+// ZooKeeper, for the Kafka protocol version supported by the proxy does not
+// allow to query it from brokers.
+func (a *T) GetTopics(withPartitions, withConfig bool) ([]TopicInfo, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	if err := kafkaClt.RefreshMetadata(); err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to refresh metadata")
+	}
+	topics, err := kafkaClt.Topics()
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topics")
+	}
+	sort.Strings(topics)
+	topicInfos := make([]TopicInfo, len(topics))
+	for i, topic := range topics {
+		topicInfos[i].Topic = topic
+		if withPartitions {
+			partitions, err := kafkaClt.Partitions(topic)
+			if err != nil {
+				return nil, errs.Wrap(errs.ErrQuery, err, "failed to get topic partitions: topic=%s", topic)
+			}
+			topicInfos[i].Partitions = len(partitions)
+		}
+		if withConfig {
+			if topicInfos[i].Config, err = a.getTopicConfig(topic); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return topicInfos, nil
+}
+
+// getTopicConfig reads config overrides of a topic from ZooKeeper. An empty
+// map is returned if the topic has no overrides.
+func (a *T) getTopicConfig(topic string) (map[string]string, error) {
+	zkConn, err := a.lazyZKConn()
+	if err != nil {
+		return nil, err
+	}
+	configPath := fmt.Sprintf("%s/config/topics/%s", a.cfg.ZooKeeper.Chroot, topic)
+	data, _, err := zkConn.Get(configPath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return map[string]string{}, nil
+		}
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch topic config: topic=%s", topic)
+	}
+	var topicConfig struct {
+		Config map[string]string `json:"config"`
+	}
+	if err := json.Unmarshal(data, &topicConfig); err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "invalid topic config: topic=%s", topic)
+	}
+	if topicConfig.Config == nil {
+		topicConfig.Config = map[string]string{}
+	}
+	return topicConfig.Config, nil
+}
+
 // GetTopicConsumers returns client-id -> consumed-partitions-list mapping
 // for a clients from a particular consumer group and a particular topic.
+//
+// If groups are coordinated by Kafka, then partition ownership is not recorded
+// anywhere, so it is resolved from subscriptions of group members reported by
+// the group coordinator the same way group members resolve it themselves.
 func (a *T) GetTopicConsumers(group, topic string) (map[string][]int32, error) {
+	if a.cfg.Consumer.GroupProtocol == config.GroupProtocolKafka {
+		assigned, _, err := a.getKafkaGroupAssignments(group)
+		if err != nil {
+			return nil, err
+		}
+		consumers := make(map[string][]int32)
+		for member, memberAssigned := range assigned {
+			if partitions := memberAssigned[topic]; len(partitions) > 0 {
+				consumers[member] = partitions
+			}
+		}
+		if len(consumers) == 0 {
+			return nil, errs.New(errs.ErrInvalidParam, "either group or topic is incorrect")
+		}
+		return consumers, nil
+	}
 	zkConn, err := a.lazyZKConn()
 	if err != nil {
 		return nil, err
@@ -225,21 +578,21 @@ func (a *T) GetTopicConsumers(group, topic string) (map[string][]int32, error) {
 	partitionNodes, _, err := zkConn.Children(consumedPartitionsPath)
 	if err != nil {
 		if err == zk.ErrNoNode {
-			return nil, ErrInvalidParam(errors.New("either group or topic is incorrect"))
+			return nil, errs.New(errs.ErrInvalidParam, "either group or topic is incorrect")
 		}
-		return nil, NewErrQuery(err, "failed to fetch partition owners data")
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch partition owners data")
 	}
 
 	consumers := make(map[string][]int32)
 	for _, partitionNode := range partitionNodes {
 		partition, err := strconv.Atoi(partitionNode)
 		if err != nil {
-			return nil, NewErrQuery(err, "invalid partition id: %s", partitionNode)
+			return nil, errs.Wrap(errs.ErrQuery, err, "invalid partition id: %s", partitionNode)
 		}
 		partitionPath := fmt.Sprintf("%s/%s", consumedPartitionsPath, partitionNode)
 		partitionNodeData, _, err := zkConn.Get(partitionPath)
 		if err != nil {
-			return nil, NewErrQuery(err, "failed to fetch partition owner")
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch partition owner")
 		}
 		clientID := string(partitionNodeData)
 		consumers[clientID] = append(consumers[clientID], int32(partition))
@@ -254,26 +607,22 @@ func (a *T) GetTopicConsumers(group, topic string) (map[string][]int32, error) {
 
 // GetAllTopicConsumers returns group -> client-id -> consumed-partitions-list
 // mapping for a particular topic. Warning, the function performs scan of all
-// consumer groups registered in ZooKeeper and therefore can take a lot of time.
+// consumer groups registered in ZooKeeper, or known to the Kafka cluster if
+// groups are coordinated by Kafka, and therefore can take a lot of time.
 func (a *T) GetAllTopicConsumers(topic string) (map[string]map[string][]int32, error) {
-	kzConn, err := a.lazyZKConn()
+	groups, err := a.listGroups()
 	if err != nil {
 		return nil, err
 	}
-	groupsPath := fmt.Sprintf("%s/consumers", a.cfg.ZooKeeper.Chroot)
-	groups, _, err := kzConn.Children(groupsPath)
-	if err != nil {
-		return nil, NewErrQuery(err, "failed to fetch consumer groups")
-	}
 
 	consumers := make(map[string]map[string][]int32)
 	for _, group := range groups {
 		groupConsumers, err := a.GetTopicConsumers(group, topic)
 		if err != nil {
-			if _, ok := err.(ErrInvalidParam); ok {
+			if errs.Is(err, errs.ErrInvalidParam) {
 				continue
 			}
-			return nil, NewErrQuery(err, "failed to fetch group `%s` data", group)
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch group `%s` data", group)
 		}
 		if len(groupConsumers) > 0 {
 			consumers[group] = groupConsumers
@@ -282,10 +631,204 @@ func (a *T) GetAllTopicConsumers(topic string) (map[string]map[string][]int32, e
 	return consumers, nil
 }
 
+// EvictGroupMember deletes the registration of a consumer group member from
+// ZooKeeper along with all partition claims that it holds, and returns the
+// released partitions by topic. That makes other members of the group
+// rebalance and take over the partitions. It is meant to get rid of stale
+// registrations, a live member registers again as soon as it notices. If
+// groups are coordinated by Kafka, then the group coordinator is asked to
+// remove the member from the group instead.
+func (a *T) EvictGroupMember(group, member string) (map[string][]int32, error) {
+	if a.cfg.Consumer.GroupProtocol == config.GroupProtocolKafka {
+		return a.evictKafkaGroupMember(group, member)
+	}
+	zkConn, err := a.lazyZKConn()
+	if err != nil {
+		return nil, err
+	}
+	groupPath := fmt.Sprintf("%s/consumers/%s", a.cfg.ZooKeeper.Chroot, group)
+	registered := true
+	if err := zkConn.Delete(fmt.Sprintf("%s/ids/%s", groupPath, member), -1); err != nil {
+		if err != zk.ErrNoNode {
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to delete member registration")
+		}
+		registered = false
+	}
+	released := make(map[string][]int32)
+	ownersPath := fmt.Sprintf("%s/owners", groupPath)
+	topics, _, err := zkConn.Children(ownersPath)
+	if err != nil && err != zk.ErrNoNode {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch consumed topics")
+	}
+	for _, topic := range topics {
+		topicPath := fmt.Sprintf("%s/%s", ownersPath, topic)
+		partitionNodes, _, err := zkConn.Children(topicPath)
+		if err != nil {
+			if err == zk.ErrNoNode {
+				continue
+			}
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch partition owners data")
+		}
+		for _, partitionNode := range partitionNodes {
+			partition, err := strconv.Atoi(partitionNode)
+			if err != nil {
+				return nil, errs.Wrap(errs.ErrQuery, err, "invalid partition id: %s", partitionNode)
+			}
+			partitionPath := fmt.Sprintf("%s/%s", topicPath, partitionNode)
+			owner, stat, err := zkConn.Get(partitionPath)
+			if err != nil {
+				if err == zk.ErrNoNode {
+					continue
+				}
+				return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch partition owner")
+			}
+			if string(owner) != member {
+				continue
+			}
+			// The version check ensures that a claim that has just changed
+			// hands is not deleted.
+			if err := zkConn.Delete(partitionPath, stat.Version); err != nil {
+				if err == zk.ErrNoNode || err == zk.ErrBadVersion {
+					continue
+				}
+				return nil, errs.Wrap(errs.ErrQuery, err, "failed to delete partition claim")
+			}
+			released[topic] = append(released[topic], int32(partition))
+		}
+	}
+	if !registered && len(released) == 0 {
+		return nil, errs.New(errs.ErrInvalidParam, "either group or member is incorrect")
+	}
+	for _, partitions := range released {
+		sort.Sort(int32Slice(partitions))
+	}
+	return released, nil
+}
+
+// listGroups returns consumer groups registered in ZooKeeper, or known to the
+// Kafka cluster if groups are coordinated by Kafka.
+func (a *T) listGroups() ([]string, error) {
+	if a.cfg.Consumer.GroupProtocol == config.GroupProtocolKafka {
+		groups, err := groupmember.ListKafkaGroups(a.cfg.Kafka.SeedPeers, a.saramaConfig())
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch consumer groups")
+		}
+		return groups, nil
+	}
+	zkConn, err := a.lazyZKConn()
+	if err != nil {
+		return nil, err
+	}
+	groupsPath := fmt.Sprintf("%s/consumers", a.cfg.ZooKeeper.Chroot)
+	groups, _, err := zkConn.Children(groupsPath)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrQuery, err, "failed to fetch consumer groups")
+	}
+	return groups, nil
+}
+
+// getKafkaGroupAssignments returns member -> topic -> partitions assigned to
+// members of a group coordinated by Kafka, along with the members as reported
+// by the group coordinator.
+func (a *T) getKafkaGroupAssignments(group string) (map[string]map[string][]int32, []groupmember.KafkaGroupMember, error) {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := groupmember.DescribeKafkaGroup(kafkaClt, group)
+	if err != nil {
+		return nil, nil, errs.Wrap(errs.ErrQuery, err, "failed to describe group")
+	}
+	subscribers := make(map[string][]string)
+	for _, member := range members {
+		for _, topic := range member.Topics {
+			subscribers[topic] = append(subscribers[topic], member.ID)
+		}
+	}
+	partitions := make(map[string][]int32, len(subscribers))
+	for topic := range subscribers {
+		if partitions[topic], err = kafkaClt.Partitions(topic); err != nil {
+			return nil, nil, errs.Wrap(errs.ErrQuery, err, "failed to get partition list: topic=%s", topic)
+		}
+	}
+	assigned := groupcsm.AssignPartitions(a.cfg, partitions, subscribers)
+	for _, memberAssigned := range assigned {
+		for _, memberPartitions := range memberAssigned {
+			sort.Sort(int32Slice(memberPartitions))
+		}
+	}
+	return assigned, members, nil
+}
+
+// evictKafkaGroupMember makes the group coordinator remove all Kafka members
+// of a group that belong to the Kafka-Pixy member, and returns partitions
+// that were assigned to it.
+func (a *T) evictKafkaGroupMember(group, member string) (map[string][]int32, error) {
+	assigned, members, err := a.getKafkaGroupAssignments(group)
+	if err != nil {
+		return nil, err
+	}
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return nil, err
+	}
+	evicted := false
+	for _, groupMember := range members {
+		if groupMember.ID != member {
+			continue
+		}
+		if err := groupmember.EvictKafkaGroupMember(kafkaClt, group, groupMember.KafkaMemberID); err != nil {
+			return nil, errs.Wrap(errs.ErrQuery, err, "failed to evict member")
+		}
+		evicted = true
+	}
+	if !evicted {
+		return nil, errs.New(errs.ErrInvalidParam, "either group or member is incorrect")
+	}
+	released := make(map[string][]int32)
+	for topic, partitions := range assigned[member] {
+		if len(partitions) > 0 {
+			released[topic] = partitions
+		}
+	}
+	return released, nil
+}
+
+// CheckKafka verifies that cluster metadata can be fetched from Kafka.
+func (a *T) CheckKafka() error {
+	kafkaClt, err := a.lazyKafkaClt()
+	if err != nil {
+		return err
+	}
+	if err := kafkaClt.RefreshMetadata(); err != nil {
+		return errs.Wrap(errs.ErrQuery, err, "failed to refresh metadata")
+	}
+	return nil
+}
+
+// CheckZooKeeper returns the state of the ZooKeeper session, and an error if
+// there is no session. The connection is established lazily, so on the first
+// call it waits up to `zkSessionTimeout` for a session to be established.
+func (a *T) CheckZooKeeper() (string, error) {
+	zkConn, err := a.lazyZKConn()
+	if err != nil {
+		return "", err
+	}
+	state := zkConn.State()
+	for deadline := time.Now().Add(zkSessionTimeout); state != zk.StateHasSession && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		state = zkConn.State()
+	}
+	if state != zk.StateHasSession {
+		return state.String(), errs.New(errs.ErrQuery, "no ZooKeeper session: state=%s", state)
+	}
+	return state.String(), nil
+}
+
 // saramaConfig generates a `Shopify/sarama` library config.
 func (a *T) saramaConfig() *sarama.Config {
 	saramaConfig := sarama.NewConfig()
-	saramaConfig.ClientID = a.cfg.ClientID
+	saramaConfig.ClientID = a.cfg.KafkaClientID("")
 	return saramaConfig
 }
 
@@ -295,7 +838,7 @@ func (a *T) lazyKafkaClt() (sarama.Client, error) {
 	if a.kafkaClt == nil {
 		var err error
 		if a.kafkaClt, err = sarama.NewClient(a.cfg.Kafka.SeedPeers, a.saramaConfig()); err != nil {
-			return nil, ErrSetup(fmt.Errorf("failed to create sarama.Client: err=(%v)", err))
+			return nil, errs.Wrap(errs.ErrSetup, err, "failed to create sarama.Client")
 		}
 	}
 	return a.kafkaClt, nil
@@ -306,8 +849,8 @@ func (a *T) lazyZKConn() (*zk.Conn, error) {
 	defer a.mtx.Unlock()
 	if a.zkConn == nil {
 		var err error
-		if a.zkConn, _, err = zk.Connect(a.cfg.ZooKeeper.SeedPeers, 1*time.Second); err != nil {
-			return nil, ErrSetup(fmt.Errorf("failed to create zk.Conn: err=(%v)", err))
+		if a.zkConn, _, err = zk.Connect(a.cfg.ZooKeeper.SeedPeers, zkSessionTimeout); err != nil {
+			return nil, errs.Wrap(errs.ErrSetup, err, "failed to create zk.Conn")
 		}
 	}
 	return a.zkConn, nil
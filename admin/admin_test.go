@@ -3,11 +3,15 @@ package admin
 import (
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
+	"github.com/wvanbergen/kazoo-go"
 	. "gopkg.in/check.v1"
 )
 
@@ -110,3 +114,183 @@ func (s *AdminSuite) TestSetOffsetsPartialUpdate(c *C) {
 
 	a.Stop()
 }
+
+// Offsets of all topics that a group has committed offsets for are returned,
+// and topics without committed offsets are omitted.
+func (s *AdminSuite) TestGetAllGroupOffsets(c *C) {
+	// Given
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+	a.SetGroupOffsets("all_offsets", "test.4", []PartitionOffset{
+		{Partition: 1, Offset: 1002, Metadata: "A2"},
+	})
+
+	// When
+	offsets, err := a.GetAllGroupOffsets("all_offsets")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(offsets), Equals, 1)
+	c.Assert(len(offsets["test.4"]), Equals, 4)
+	c.Assert(offsets["test.4"][0].Offset, Equals, sarama.OffsetNewest)
+	c.Assert(offsets["test.4"][1].Partition, Equals, int32(1))
+	c.Assert(offsets["test.4"][1].Offset, Equals, int64(1002))
+	c.Assert(offsets["test.4"][1].Metadata, Equals, "A2")
+	c.Assert(offsets["test.4"][1].End >= offsets["test.4"][1].Begin, Equals, true)
+}
+
+// Evicting a group member deletes its registration and its partition claims,
+// but leaves claims of other members intact.
+func (s *AdminSuite) TestEvictGroupMember(c *C) {
+	// Given
+	kazooClt, err := kazoo.NewKazoo(testhelpers.ZookeeperPeers, kazoo.NewConfig())
+	c.Assert(err, IsNil)
+	defer kazooClt.Close()
+	cg := kazooClt.Consumergroup("evict")
+	c.Assert(cg.Create(), IsNil)
+	m1, m2 := cg.Instance("m1"), cg.Instance("m2")
+	c.Assert(m1.Register([]string{"test.4"}), IsNil)
+	defer m1.Deregister()
+	c.Assert(m2.Register([]string{"test.4"}), IsNil)
+	defer m2.Deregister()
+	c.Assert(m1.ClaimPartition("test.4", 0), IsNil)
+	c.Assert(m1.ClaimPartition("test.4", 2), IsNil)
+	c.Assert(m2.ClaimPartition("test.4", 1), IsNil)
+	defer m2.ReleasePartition("test.4", 1)
+
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+
+	// When
+	released, err := a.EvictGroupMember("evict", "m1")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(released, DeepEquals, map[string][]int32{"test.4": {0, 2}})
+	registered, err := m1.Registered()
+	c.Assert(err, IsNil)
+	c.Assert(registered, Equals, false)
+	consumers, err := a.GetTopicConsumers("evict", "test.4")
+	c.Assert(err, IsNil)
+	c.Assert(consumers, DeepEquals, map[string][]int32{"m2": {1}})
+
+	// When: there is nothing left to evict.
+	_, err = a.EvictGroupMember("evict", "m1")
+
+	// Then
+	c.Assert(errs.Is(err, errs.ErrInvalidParam), Equals, true, Commentf("%v", err))
+}
+
+// Metadata of all topic partitions is returned ordered by partition.
+func (s *AdminSuite) TestGetTopicMetadata(c *C) {
+	// Given
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+
+	// When
+	metadata, err := a.GetTopicMetadata("test.4")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(metadata), Equals, 4)
+	for i, pm := range metadata {
+		c.Assert(pm.Partition, Equals, int32(i))
+		c.Assert(len(pm.Replicas) > 0, Equals, true)
+		c.Assert(len(pm.ISR) > 0, Equals, true)
+		c.Assert(pm.ISR, DeepEquals, intersect(pm.ISR, pm.Replicas))
+	}
+}
+
+// Messages are read from an arbitrary offset without a consumer group.
+func (s *AdminSuite) TestReadMessages(c *C) {
+	// Given
+	produced := s.kh.PutMessages("read_messages", "test.4", map[string]int{"A": 5})
+	first := produced["A"][0]
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+
+	// When
+	messages, err := a.ReadMessages("test.4", first.Partition, first.Offset+1, 3)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(messages), Equals, 3)
+	for i, msg := range messages {
+		prodMsg := produced["A"][i+1]
+		c.Assert(msg.Offset, Equals, prodMsg.Offset)
+		c.Assert(string(msg.Value), Equals, string(prodMsg.Value.(sarama.StringEncoder)))
+	}
+}
+
+// If there are fewer messages available than requested, then only available
+// ones are returned.
+func (s *AdminSuite) TestReadMessagesTail(c *C) {
+	// Given
+	produced := s.kh.PutMessages("read_messages", "test.4", map[string]int{"A": 2})
+	first := produced["A"][0]
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+
+	// When
+	messages, err := a.ReadMessages("test.4", first.Partition, first.Offset, 10)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(messages), Equals, 2)
+	c.Assert(messages[1].Offset, Equals, produced["A"][1].Offset)
+}
+
+func (s *AdminSuite) TestReadMessagesOutOfRange(c *C) {
+	// Given
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+	newest := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	_, err = a.ReadMessages("test.4", 0, newest[0]+100, 1)
+
+	// Then
+	c.Assert(errs.Is(err, errs.ErrInvalidParam), Equals, true)
+}
+
+// Time before all messages in a topic resolves to the oldest offsets, and
+// time in the future resolves to the newest offsets.
+func (s *AdminSuite) TestGetOffsetsByTime(c *C) {
+	// Given
+	a, err := Spawn(s.ns, s.cfg)
+	c.Assert(err, IsNil)
+	defer a.Stop()
+
+	// When
+	oldest, err := a.GetOffsetsByTime("test.4", time.Unix(1, 0))
+	c.Assert(err, IsNil)
+	newest, err := a.GetOffsetsByTime("test.4", time.Now().Add(time.Hour))
+	c.Assert(err, IsNil)
+
+	// Then
+	c.Assert(len(oldest), Equals, 4)
+	c.Assert(len(newest), Equals, 4)
+	for i := range oldest {
+		c.Assert(oldest[i].Offset, Equals, oldest[i].Begin)
+		c.Assert(newest[i].Offset, Equals, newest[i].End)
+	}
+}
+
+func intersect(a, b []int32) []int32 {
+	var res []int32
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				res = append(res, x)
+				break
+			}
+		}
+	}
+	return res
+}
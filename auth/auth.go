@@ -0,0 +1,110 @@
+// Package auth implements authentication of gRPC API requests. Requests are
+// authenticated by a chain of authenticators, and all of them must accept a
+// request for it to be served. Built-in authenticators check static API
+// tokens and TLS client certificates, and applications that embed Kafka-Pixy
+// can add their own by implementing `Authenticator`.
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Metadata key that API tokens are passed in, as `Bearer <token>`.
+const hdrAuthorization = "authorization"
+
+// Authenticator defines an interface to authenticate gRPC API requests.
+// Implementations must be safe for concurrent use.
+type Authenticator interface {
+	// Authenticate returns an error if a request to the gRPC method should be
+	// rejected. Client credentials can be obtained from the request context,
+	// e.g. metadata with `metadata.FromContext` and the TLS connection state
+	// with `peer.FromContext`. Requests are rejected with `Unauthenticated`
+	// unless a gRPC error with another code is returned.
+	Authenticate(ctx context.Context, fullMethod string) error
+}
+
+// AuthenticatorFunc is an adapter to use ordinary functions as
+// authenticators.
+type AuthenticatorFunc func(ctx context.Context, fullMethod string) error
+
+// Authenticate implements `Authenticator`.
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, fullMethod string) error {
+	return f(ctx, fullMethod)
+}
+
+// Tokens returns an authenticator that accepts requests passing one of the
+// tokens in the `authorization` metadata as `Bearer <token>`.
+func Tokens(tokens []string) Authenticator {
+	tokenBytes := make([][]byte, len(tokens))
+	for i, token := range tokens {
+		tokenBytes[i] = []byte(token)
+	}
+	return AuthenticatorFunc(func(ctx context.Context, fullMethod string) error {
+		md, _ := metadata.FromContext(ctx)
+		for _, value := range md[hdrAuthorization] {
+			if !strings.HasPrefix(value, "Bearer ") {
+				continue
+			}
+			presented := []byte(strings.TrimPrefix(value, "Bearer "))
+			for _, token := range tokenBytes {
+				if subtle.ConstantTimeCompare(presented, token) == 1 {
+					return nil
+				}
+			}
+			return errors.New("invalid token")
+		}
+		return errors.New("token missing")
+	})
+}
+
+// ClientCert returns an authenticator that accepts requests made over TLS
+// connections where the client presented a certificate that has been
+// verified. If common names are given, then the certificate subject must
+// have one of them.
+func ClientCert(commonNames []string) Authenticator {
+	allowed := make(map[string]bool, len(commonNames))
+	for _, commonName := range commonNames {
+		allowed[commonName] = true
+	}
+	return AuthenticatorFunc(func(ctx context.Context, fullMethod string) error {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return errors.New("client certificate missing")
+		}
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+			return errors.New("client certificate missing")
+		}
+		commonName := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+		if len(allowed) != 0 && !allowed[commonName] {
+			return errors.Errorf("client certificate not allowed: %s", commonName)
+		}
+		return nil
+	})
+}
+
+// Any returns an authenticator that accepts requests accepted by at least
+// one of the given authenticators. If all of them reject a request, then the
+// error of the first one is returned.
+func Any(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, fullMethod string) error {
+		var firstErr error
+		for _, authenticator := range authenticators {
+			err := authenticator.Authenticate(ctx, fullMethod)
+			if err == nil {
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type AuthSuite struct{}
+
+var _ = Suite(&AuthSuite{})
+
+func (s *AuthSuite) TestTokens(c *C) {
+	a := Tokens([]string{"foo", "bar"})
+	for i, tc := range []struct {
+		md  metadata.MD
+		err string
+	}{{
+		md: metadata.Pairs("authorization", "Bearer bar"),
+	}, {
+		md:  metadata.Pairs("authorization", "Bearer bazz"),
+		err: "invalid token",
+	}, {
+		md:  metadata.Pairs("authorization", "Basic foo"),
+		err: "token missing",
+	}, {
+		md:  metadata.Pairs("foo", "bar"),
+		err: "token missing",
+	}} {
+		ctx := metadata.NewContext(context.Background(), tc.md)
+
+		// When
+		err := a.Authenticate(ctx, "/KafkaPixy/Produce")
+
+		// Then
+		if tc.err == "" {
+			c.Assert(err, IsNil, Commentf("case #%d", i))
+			continue
+		}
+		c.Assert(err, ErrorMatches, tc.err, Commentf("case #%d", i))
+	}
+}
+
+func (s *AuthSuite) TestClientCert(c *C) {
+	a := ClientCert([]string{"foo"})
+	for i, tc := range []struct {
+		ctx context.Context
+		err string
+	}{{
+		ctx: clientCertContext("foo"),
+	}, {
+		ctx: clientCertContext("bar"),
+		err: "client certificate not allowed: bar",
+	}, {
+		ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}}),
+		err: "client certificate missing",
+	}, {
+		ctx: context.Background(),
+		err: "client certificate missing",
+	}} {
+		// When
+		err := a.Authenticate(tc.ctx, "/KafkaPixy/Produce")
+
+		// Then
+		if tc.err == "" {
+			c.Assert(err, IsNil, Commentf("case #%d", i))
+			continue
+		}
+		c.Assert(err, ErrorMatches, tc.err, Commentf("case #%d", i))
+	}
+}
+
+// If no common names are given, then any verified client certificate is
+// accepted.
+func (s *AuthSuite) TestClientCertAnyName(c *C) {
+	err := ClientCert(nil).Authenticate(clientCertContext("bar"), "/KafkaPixy/Produce")
+	c.Assert(err, IsNil)
+}
+
+// A request is accepted if any authenticator accepts it, otherwise the error
+// of the first one is returned.
+func (s *AuthSuite) TestAny(c *C) {
+	reject := func(msg string) Authenticator {
+		return AuthenticatorFunc(func(ctx context.Context, fullMethod string) error {
+			return errors.New(msg)
+		})
+	}
+	accept := AuthenticatorFunc(func(ctx context.Context, fullMethod string) error {
+		return nil
+	})
+
+	c.Assert(Any(reject("foo"), accept).Authenticate(context.Background(), "/KafkaPixy/Produce"), IsNil)
+	c.Assert(Any(reject("foo"), reject("bar")).Authenticate(context.Background(), "/KafkaPixy/Produce"), ErrorMatches, "foo")
+}
+
+func clientCertContext(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	tlsInfo := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: tlsInfo})
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// PeerCred holds credentials of the process on the other end of a unix domain
+// socket connection, as reported by the kernel when the connection was made.
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// String returns a string representation of the credentials to be used in
+// logs and as a client identity.
+func (pc PeerCred) String() string {
+	return fmt.Sprintf("pid=%d,uid=%d,gid=%d", pc.PID, pc.UID, pc.GID)
+}
+
+type peerCredKey struct{}
+
+// NewPeerCredContext returns a copy of the context that carries the peer
+// credentials.
+func NewPeerCredContext(ctx context.Context, pc PeerCred) context.Context {
+	return context.WithValue(ctx, peerCredKey{}, pc)
+}
+
+// PeerCredFromContext returns peer credentials carried by the context. They
+// are only available for requests received over unix domain sockets on
+// platforms that support that.
+func PeerCredFromContext(ctx context.Context) (PeerCred, bool) {
+	pc, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return pc, ok
+}
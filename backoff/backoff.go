@@ -0,0 +1,26 @@
+// Package backoff computes randomized back off intervals. When a Kafka broker
+// fails, all actors that talk to it fail at the same time, and if they retried
+// after the same fixed interval they would hit the cluster all at once again.
+// Randomizing the interval spreads their retries over time.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Jittered returns `d` randomly increased or decreased by at most `jitter`
+// fraction of it, e.g. with jitter 0.2 a 500ms interval becomes anything
+// between 400ms and 600ms. If jitter is not in (0, 1) then `d` is returned
+// unchanged.
+func Jittered(d time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 || jitter >= 1 {
+		return d
+	}
+	return d + time.Duration((2*rand.Float64()-1)*jitter*float64(d))
+}
+
+// After is the same as `time.After` except the interval is jittered.
+func After(d time.Duration, jitter float64) <-chan time.Time {
+	return time.After(Jittered(d, jitter))
+}
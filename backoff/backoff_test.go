@@ -0,0 +1,44 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type BackOffSuite struct{}
+
+var _ = Suite(&BackOffSuite{})
+
+func (s *BackOffSuite) TestJittered(c *C) {
+	min, max := time.Hour, time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		// When
+		d := Jittered(500*time.Millisecond, 0.2)
+
+		// Then
+		c.Assert(d >= 400*time.Millisecond, Equals, true)
+		c.Assert(d <= 600*time.Millisecond, Equals, true)
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	// The intervals are actually spread over the range.
+	c.Assert(min < 450*time.Millisecond, Equals, true)
+	c.Assert(max > 550*time.Millisecond, Equals, true)
+}
+
+// Jitter out of the (0, 1) range is ignored.
+func (s *BackOffSuite) TestJitteredOutOfRange(c *C) {
+	for i, jitter := range []float64{-0.5, 0, 1, 1.5} {
+		c.Assert(Jittered(500*time.Millisecond, jitter), Equals, 500*time.Millisecond, Commentf("case #%d", i))
+	}
+}
@@ -0,0 +1,274 @@
+package bench
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/prettyfmt"
+	"github.com/pkg/errors"
+)
+
+const (
+	OpProduce = "produce"
+	OpConsume = "consume"
+)
+
+// Config defines a load to drive against a Kafka-Pixy HTTP API.
+type Config struct {
+	// Either a TCP address or a unix domain socket path of the HTTP API.
+	Addr string
+
+	// Operations to run one after another, either `OpProduce` or
+	// `OpConsume`.
+	Ops []string
+
+	Topic string
+	Group string
+
+	// Produce requests are synchronous.
+	Sync bool
+
+	// The number of concurrent clients.
+	Threads int
+
+	// The number of requests of every operation.
+	Count int
+
+	// Size of produced messages in bytes.
+	Size int
+}
+
+// Report summarizes results of an operation run.
+type Report struct {
+	Op       string
+	Requests int
+	// Requests that failed with a transport error or non 2xx status,
+	// excluding timeouts.
+	Errors int
+	// Requests that failed with 408 Request Timeout, e.g. consume requests
+	// when there are no messages left.
+	Timeouts int
+	Bytes    int64
+	Took     time.Duration
+	Latency  Latency
+	// Heap allocations per request made by this process during the run. If
+	// the proxy runs in-process, then its allocations are counted too.
+	AllocsPerOp uint64
+	BytesPerOp  uint64
+}
+
+// Latency holds latency percentiles of requests.
+type Latency struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// Drive drives the configured load and returns a report per operation.
+func Drive(cfg Config) ([]Report, error) {
+	if cfg.Threads <= 0 {
+		return nil, errors.New("threads must be > 0")
+	}
+	if cfg.Count <= 0 {
+		return nil, errors.New("count must be > 0")
+	}
+	for _, op := range cfg.Ops {
+		if op != OpProduce && op != OpConsume {
+			return nil, errors.Errorf("invalid operation: %s", op)
+		}
+	}
+	b := newBench(cfg)
+	reports := make([]Report, 0, len(cfg.Ops))
+	for _, op := range cfg.Ops {
+		reports = append(reports, b.run(op))
+	}
+	return reports, nil
+}
+
+type bench struct {
+	cfg     Config
+	baseURL string
+	clt     *http.Client
+	msg     []byte
+}
+
+type result struct {
+	latency time.Duration
+	bytes   int
+	status  int
+	err     error
+}
+
+func newBench(cfg Config) *bench {
+	b := &bench{cfg: cfg, clt: &http.Client{}}
+	if strings.HasPrefix(cfg.Addr, "/") {
+		b.baseURL = "http://_"
+		dial := func(proto, addr string) (net.Conn, error) {
+			return net.Dial("unix", cfg.Addr)
+		}
+		b.clt.Transport = &http.Transport{Dial: dial, MaxIdleConnsPerHost: cfg.Threads}
+	} else {
+		b.baseURL = fmt.Sprintf("http://%s", cfg.Addr)
+		b.clt.Transport = &http.Transport{MaxIdleConnsPerHost: cfg.Threads}
+	}
+	if containsOp(cfg.Ops, OpProduce) {
+		b.msg = genMessage(cfg.Size)
+	}
+	return b
+}
+
+func (b *bench) run(op string) Report {
+	resultsCh := make(chan []result, b.cfg.Threads)
+	var memBefore, memAfter runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&memBefore)
+	begin := time.Now()
+
+	var wg sync.WaitGroup
+	chunkSize := b.cfg.Count / b.cfg.Threads
+	for i := 0; i < b.cfg.Threads; i++ {
+		count := chunkSize
+		if i < b.cfg.Count%b.cfg.Threads {
+			count++
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results := make([]result, 0, count)
+			for j := 0; j < count; j++ {
+				results = append(results, b.request(op))
+			}
+			resultsCh <- results
+		}()
+	}
+	wg.Wait()
+	took := time.Since(begin)
+	runtime.ReadMemStats(&memAfter)
+	close(resultsCh)
+
+	report := Report{Op: op, Took: took}
+	latencies := make([]time.Duration, 0, b.cfg.Count)
+	for results := range resultsCh {
+		for _, res := range results {
+			report.Requests++
+			latencies = append(latencies, res.latency)
+			switch {
+			case res.err == nil && res.status/100 == 2:
+				report.Bytes += int64(res.bytes)
+			case res.status == http.StatusRequestTimeout:
+				report.Timeouts++
+			default:
+				report.Errors++
+			}
+		}
+	}
+	report.Latency = latencyOf(latencies)
+	if report.Requests > 0 {
+		report.AllocsPerOp = (memAfter.Mallocs - memBefore.Mallocs) / uint64(report.Requests)
+		report.BytesPerOp = (memAfter.TotalAlloc - memBefore.TotalAlloc) / uint64(report.Requests)
+	}
+	return report
+}
+
+func (b *bench) request(op string) result {
+	var req *http.Request
+	var err error
+	switch op {
+	case OpProduce:
+		url := fmt.Sprintf("%s/topics/%s/messages", b.baseURL, b.cfg.Topic)
+		if b.cfg.Sync {
+			url += "?sync"
+		}
+		req, err = http.NewRequest("POST", url, bytes.NewReader(b.msg))
+		if err == nil {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+	case OpConsume:
+		url := fmt.Sprintf("%s/topics/%s/messages?group=%s", b.baseURL, b.cfg.Topic, b.cfg.Group)
+		req, err = http.NewRequest("GET", url, nil)
+	}
+	if err != nil {
+		return result{err: err}
+	}
+	begin := time.Now()
+	res, err := b.clt.Do(req)
+	if err != nil {
+		return result{latency: time.Since(begin), err: err}
+	}
+	n, err := io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	r := result{latency: time.Since(begin), status: res.StatusCode, err: err}
+	if op == OpProduce {
+		r.bytes = len(b.msg)
+	} else {
+		r.bytes = int(n)
+	}
+	return r
+}
+
+// String returns a human readable representation of the report.
+func (r Report) String() string {
+	tookSec := r.Took.Seconds()
+	if tookSec == 0 {
+		tookSec = 1
+	}
+	return fmt.Sprintf("%s: requests=%d, errors=%d, timeouts=%d, took=%s, "+
+		"throughput=%dreq(%s)/sec, latency=[p50=%s, p90=%s, p99=%s, max=%s], "+
+		"allocs/op=%d, bytes/op=%s",
+		r.Op, r.Requests, r.Errors, r.Timeouts, r.Took,
+		int64(float64(r.Requests)/tookSec), prettyfmt.Bytes(int64(float64(r.Bytes)/tookSec)),
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max,
+		r.AllocsPerOp, prettyfmt.Bytes(int64(r.BytesPerOp)))
+}
+
+func latencyOf(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return Latency{
+		P50: percentile(latencies, 50),
+		P90: percentile(latencies, 90),
+		P99: percentile(latencies, 99),
+		Max: latencies[len(latencies)-1],
+	}
+}
+
+// percentile returns the nearest rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func containsOp(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func genMessage(size int) []byte {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		panic(fmt.Sprintf("failed to generate message: err=(%s)", err))
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(raw))
+	return encoded[:size]
+}
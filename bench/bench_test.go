@@ -0,0 +1,113 @@
+package bench
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&BenchSuite{})
+
+type BenchSuite struct {
+	srv      *httptest.Server
+	produced int32
+	consumed int32
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *BenchSuite) SetUpTest(c *C) {
+	s.produced, s.consumed = 0, 0
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/topics/foo/messages")
+		switch r.Method {
+		case "POST":
+			body, _ := ioutil.ReadAll(r.Body)
+			c.Check(len(body), Equals, 100)
+			atomic.AddInt32(&s.produced, 1)
+			w.Write([]byte(`{}`))
+		case "GET":
+			c.Check(r.URL.Query().Get("group"), Equals, "bar")
+			// Every third consume request times out.
+			if atomic.AddInt32(&s.consumed, 1)%3 == 0 {
+				w.WriteHeader(http.StatusRequestTimeout)
+				return
+			}
+			w.Write([]byte(`{"value": "Zm9v", "partition": 0, "offset": 1}`))
+		}
+	}))
+}
+
+func (s *BenchSuite) TearDownTest(c *C) {
+	s.srv.Close()
+}
+
+func (s *BenchSuite) TestDrive(c *C) {
+	cfg := Config{
+		Addr:    strings.TrimPrefix(s.srv.URL, "http://"),
+		Ops:     []string{OpProduce, OpConsume},
+		Topic:   "foo",
+		Group:   "bar",
+		Threads: 4,
+		Count:   30,
+		Size:    100,
+	}
+
+	// When
+	reports, err := Drive(cfg)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(s.produced, Equals, int32(30))
+	c.Assert(s.consumed, Equals, int32(30))
+	c.Assert(len(reports), Equals, 2)
+
+	c.Assert(reports[0].Op, Equals, OpProduce)
+	c.Assert(reports[0].Requests, Equals, 30)
+	c.Assert(reports[0].Errors, Equals, 0)
+	c.Assert(reports[0].Timeouts, Equals, 0)
+	c.Assert(reports[0].Bytes, Equals, int64(3000))
+
+	c.Assert(reports[1].Op, Equals, OpConsume)
+	c.Assert(reports[1].Requests, Equals, 30)
+	c.Assert(reports[1].Errors, Equals, 0)
+	c.Assert(reports[1].Timeouts, Equals, 10)
+
+	for _, report := range reports {
+		c.Assert(report.Latency.P50 <= report.Latency.P90, Equals, true)
+		c.Assert(report.Latency.P90 <= report.Latency.P99, Equals, true)
+		c.Assert(report.Latency.P99 <= report.Latency.Max, Equals, true)
+		c.Assert(report.Latency.Max > 0, Equals, true)
+	}
+}
+
+func (s *BenchSuite) TestDriveInvalidOp(c *C) {
+	_, err := Drive(Config{Ops: []string{"foo"}, Threads: 1, Count: 1})
+	c.Assert(err, ErrorMatches, "invalid operation: foo")
+}
+
+func (s *BenchSuite) TestPercentile(c *C) {
+	latencies := make([]time.Duration, 200)
+	for i := range latencies {
+		latencies[i] = time.Duration(200-i) * time.Millisecond
+	}
+
+	// When
+	latency := latencyOf(latencies)
+
+	// Then
+	c.Assert(latency, Equals, Latency{
+		P50: 100 * time.Millisecond,
+		P90: 180 * time.Millisecond,
+		P99: 198 * time.Millisecond,
+		Max: 200 * time.Millisecond,
+	})
+}
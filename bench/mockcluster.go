@@ -0,0 +1,61 @@
+package bench
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/log"
+)
+
+// MockCluster is a single broker Kafka cluster simulated in-process, that
+// accepts all produced messages. It allows to measure performance of the
+// produce path of a proxy isolated from a real Kafka cluster. Consumption
+// is not supported, because it requires ZooKeeper.
+type MockCluster struct {
+	broker *sarama.MockBroker
+}
+
+// SpawnMockCluster starts a mock cluster that hosts a topic with the
+// specified number of partitions.
+func SpawnMockCluster(topic string, partitions int32) *MockCluster {
+	broker := sarama.NewMockBroker(logReporter{}, 1)
+	metadataRes := sarama.NewMockMetadataResponse(logReporter{}).
+		SetBroker(broker.Addr(), broker.BrokerID())
+	for p := int32(0); p < partitions; p++ {
+		metadataRes.SetLeader(topic, p, broker.BrokerID())
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadataRes,
+		"ProduceRequest":  sarama.NewMockProduceResponse(logReporter{}),
+	})
+	return &MockCluster{broker: broker}
+}
+
+// Addr returns the address of the mock cluster broker.
+func (mc *MockCluster) Addr() string {
+	return mc.broker.Addr()
+}
+
+// Close stops the mock cluster.
+func (mc *MockCluster) Close() {
+	mc.broker.Close()
+}
+
+// logReporter implements `sarama.TestReporter` to log mock broker failures.
+type logReporter struct{}
+
+func (logReporter) Error(v ...interface{}) {
+	log.Errorf("[mock cluster] %s", fmt.Sprint(v...))
+}
+
+func (logReporter) Errorf(format string, v ...interface{}) {
+	log.Errorf("[mock cluster] %s", fmt.Sprintf(format, v...))
+}
+
+func (logReporter) Fatal(v ...interface{}) {
+	panic(fmt.Sprint(v...))
+}
+
+func (logReporter) Fatalf(format string, v ...interface{}) {
+	panic(fmt.Sprintf(format, v...))
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/mailgun/kafka-pixy/auth"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -26,6 +28,17 @@ type App struct {
 	// Listening on a unix domain socket is disabled by default.
 	UnixAddr string `yaml:"unix_addr"`
 
+	// Address that admin HTTP server should listen on. The admin server
+	// serves `/admin/*` endpoints only, that are also available via the HTTP
+	// API servers. But unlike them it keeps running until the service is
+	// stopped completely, so it can report progress of a shutdown. It is
+	// disabled by default.
+	AdminAddr string `yaml:"admin_addr"`
+
+	// Directory that files replayed via the `POST /admin/replay-file` API
+	// endpoint must be in. If empty, then the endpoint is disabled.
+	ReplayDir string `yaml:"replay_dir"`
+
 	// An arbitrary number of proxies to different Kafka/ZooKeeper clusters can
 	// be configured.
 	Proxies map[string]*Proxy `yaml:"proxies"`
@@ -34,6 +47,81 @@ type App struct {
 	// prefix `/proxy/<alias>`. If it is not explicitly provided, then the one
 	// mentioned in the `Proxies` section first is assumed.
 	DefaultProxy string `yaml:"default_proxy"`
+
+	// HMAC request signing of the HTTP API. If at least one key is
+	// configured, then all HTTP API requests except `/_ping` must be signed.
+	HMAC struct {
+
+		// Secrets that requests can be signed with, indexed by key IDs.
+		Keys map[string]string `yaml:"keys"`
+
+		// Requests with a timestamp that differs from the server time by more
+		// than this are rejected. It also defines the period of time that
+		// request nonces are remembered for to detect replays.
+		MaxClockSkew time.Duration `yaml:"max_clock_skew"`
+	} `yaml:"hmac"`
+
+	// TLS of the gRPC API. If a certificate and a key are configured, then
+	// the gRPC API is served over TLS only.
+	GRPCTLS struct {
+
+		// Paths to PEM encoded server certificate and private key files.
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+
+		// Path to a PEM encoded file with CA certificates that client
+		// certificates are verified with. If configured, then clients
+		// presenting a certificate signed by one of them are authenticated.
+		ClientCAFile string `yaml:"client_ca_file"`
+	} `yaml:"grpc_tls"`
+
+	// Authentication of gRPC API requests. If either tokens or a client CA
+	// are configured, then all requests except health checks must pass
+	// either a valid token or a valid client certificate.
+	GRPCAuth struct {
+
+		// Static API tokens that clients can pass in the `authorization`
+		// metadata as `Bearer <token>`.
+		Tokens []string `yaml:"tokens"`
+
+		// If not empty, then only client certificates with one of these
+		// subject common names are authenticated.
+		ClientCertCNs []string `yaml:"client_cert_cns"`
+
+		// Optional authenticators that all requests must also pass, e.g. to
+		// restrict access to particular topics. They can only be set
+		// programmatically by applications that embed Kafka-Pixy.
+		Authenticators []auth.Authenticator `yaml:"-"`
+	} `yaml:"grpc_auth"`
+
+	// Debugging aids of the HTTP API. They are all disabled by default.
+	Debug struct {
+
+		// If true, then HTTP API responses carry the `X-Timing` header that
+		// tells how long the request has been waiting for Kafka operations,
+		// and how long it has been processed otherwise, up to the moment the
+		// response is sent.
+		TimingHeader bool `yaml:"timing_header"`
+	} `yaml:"debug"`
+
+	// Fractions of log records of a particular kind that are actually
+	// logged, from 0 (none) to 1 (all). It keeps log volume sane at high
+	// request rates.
+	LogSampling struct {
+
+		// API requests that did not fail. That includes requests that
+		// were rejected as invalid, and requests that timed out, e.g.
+		// consume requests when there are no new messages.
+		Requests float64 `yaml:"requests"`
+
+		// API requests that failed with an internal error or because of
+		// too many requests.
+		FailedRequests float64 `yaml:"failed_requests"`
+
+		// Warnings that consumers log per message, e.g. when a message is
+		// retried. Consumer errors are always logged.
+		ConsumerWarnings float64 `yaml:"consumer_warnings"`
+	} `yaml:"log_sampling"`
 }
 
 // Proxy defines configuration of a proxy to a particular Kafka/ZooKeeper
@@ -49,8 +137,49 @@ type Proxy struct {
 		// List of seed Kafka peers that Kafka-Pixy should access to resolve
 		// the Kafka cluster topology.
 		SeedPeers []string `yaml:"seed_peers"`
+
+		// Client ID that all requests to Kafka brokers are made with. Unlike
+		// the top level `ClientID` it does not have to be unique, so it can
+		// be shared by a fleet of Kafka-Pixy instances, to make brokers tell
+		// their requests apart in logs and apply quotas to them. By default
+		// requests are made with IDs derived from the top level `ClientID`.
+		ClientID string `yaml:"client_id"`
 	} `yaml:"kafka"`
 
+	Startup struct {
+
+		// If true, then the service starts even if the proxy fails to connect
+		// to Kafka or ZooKeeper, and keeps trying to start the proxy in the
+		// background. Until it succeeds, requests to the proxy are rejected
+		// and the proxy is reported as not ready. Otherwise the proxy is
+		// reported as failed, and the service fails to start only if all
+		// proxies do.
+		Retry bool `yaml:"retry"`
+
+		// How long to wait before the next attempt to start the proxy.
+		RetryBackOff time.Duration `yaml:"retry_back_off"`
+	} `yaml:"startup"`
+
+	Failover struct {
+
+		// List of seed peers of a standby Kafka cluster. If specified, then
+		// produce traffic is switched to the standby cluster when the primary
+		// cluster is failing. Consumers always use the primary cluster.
+		StandbySeedPeers []string `yaml:"standby_seed_peers"`
+
+		// How frequently to check health of the primary Kafka cluster.
+		HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+
+		// Produce traffic is switched to the standby cluster if the primary
+		// cluster has been failing health checks for this long.
+		FailoverAfter time.Duration `yaml:"failover_after"`
+
+		// Produce traffic is switched back to the primary cluster after it
+		// has been passing health checks for this long. If zero, then the
+		// traffic sticks to the standby cluster until Kafka-Pixy is restarted.
+		FailbackAfter time.Duration `yaml:"failback_after"`
+	} `yaml:"failover"`
+
 	ZooKeeper struct {
 
 		// List of seed ZooKeeper peers that Kafka-Pixy should access to
@@ -70,6 +199,75 @@ type Proxy struct {
 		// messages to Kafka. It is recommended to make it large enough to survive
 		// a ZooKeeper leader election in your setup.
 		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+		// Path to a file that messages still not committed when the shutdown
+		// timeout expires are appended to as JSON lines, so that they can be
+		// produced again later. If empty, then such messages are dropped.
+		ShutdownSpool string `yaml:"shutdown_spool"`
+
+		// Period of time that Kafka-Pixy should wait for a validation webhook
+		// to respond before failing a produce request.
+		ValidationTimeout time.Duration `yaml:"validation_timeout"`
+
+		// The maximum period of time that a synchronous produce request can
+		// ask Kafka-Pixy to wait for the message to be committed, via the
+		// `timeout` request parameter. Requests that do not specify a timeout
+		// wait for as long as it takes.
+		MaxSyncTimeout time.Duration `yaml:"max_sync_timeout"`
+
+		// The maximum number of messages that a batch produce request can
+		// submit. Larger batches are rejected.
+		MaxBatchSize int `yaml:"max_batch_size"`
+
+		// The maximum size of a message body in bytes that a produce
+		// request can submit. Larger requests are rejected with 413.
+		MaxMessageSize int `yaml:"max_message_size"`
+
+		// The maximum size of a request body in bytes that a batch produce
+		// request can submit. Larger requests are rejected with 413.
+		MaxBatchBytes int `yaml:"max_batch_bytes"`
+
+		// If true, then messages without a key are produced to one partition
+		// until a batch worth of them is accumulated, and only then another
+		// partition is picked at random, as the sticky partitioner of KIP-480
+		// does. Otherwise every message without a key is produced to a random
+		// partition.
+		StickyPartitioning bool `yaml:"sticky_partitioning"`
+
+		Retry struct {
+			// The maximum number of times the Kafka client retries a
+			// message that failed with a retriable error, e.g. when the
+			// partition leader moved.
+			Max int `yaml:"max"`
+
+			// Period of time the Kafka client waits before retrying, and
+			// Kafka-Pixy waits before resubmitting a message.
+			Backoff time.Duration `yaml:"backoff"`
+
+			// Resubmission back off intervals are randomly increased or
+			// decreased by at most this fraction of them, so that messages
+			// that failed at the same time are not resubmitted all at once.
+			// It must be in [0, 1).
+			BackoffJitter float64 `yaml:"backoff_jitter"`
+
+			// The maximum number of times a message is resubmitted by
+			// Kafka-Pixy after the Kafka client gave up on it.
+			MaxResubmits int `yaml:"max_resubmits"`
+
+			// What to do with a message that the Kafka client gave up on,
+			// by error name, e.g. `NotLeaderForPartition`. Valid policies
+			// are `fail` and `resubmit`. Errors not listed fail.
+			Policies map[string]string `yaml:"policies"`
+		} `yaml:"retry"`
+
+		// Topic specific producer parameters.
+		Topics map[string]*ProducerTopic `yaml:"topics"`
+
+		// Optional hook that is notified about every message committed to
+		// Kafka by the producer. The proxy sets it when hot partition
+		// tracking is enabled, but it can also be set programmatically by
+		// applications that embed Kafka-Pixy.
+		PartitionMeter PartitionMeter `yaml:"-"`
 	} `yaml:"producer"`
 
 	Consumer struct {
@@ -81,6 +279,21 @@ type Proxy struct {
 		// specified group/topic becomes available.
 		LongPollingTimeout time.Duration `yaml:"long_polling_timeout"`
 
+		// The maximum long polling timeout that a consume request can ask for
+		// via the `timeout` request parameter. If zero, then it is equal to
+		// `LongPollingTimeout`, that is clients can only make it shorter.
+		MaxLongPollingTimeout time.Duration `yaml:"max_long_polling_timeout"`
+
+		// The maximum number of messages that a batch consume request can
+		// get. Larger batches requested via the `batch` request parameter are
+		// capped to this value.
+		MaxBatchSize int `yaml:"max_batch_size"`
+
+		// Consume requests with a topic pattern consume from topics matching
+		// it, as of the list of topics of the cluster that is refreshed at
+		// most this often. It tells how soon new topics are picked up.
+		TopicPatternRefresh time.Duration `yaml:"topic_pattern_refresh"`
+
 		// Period of time that Kafka-Pixy should keep registration with a
 		// consumer group or subscription for a topic in the absence of
 		// requests to the consumer group or topic.
@@ -94,13 +307,493 @@ type Proxy struct {
 		// wait this long before retrying.
 		BackOffTimeout time.Duration `yaml:"backoff_timeout"`
 
+		// If fetching messages from a partition fails with an error that is
+		// not expected to go away by itself, e.g. the topic is invalid or not
+		// authorized, then Kafka-Pixy should wait this long before retrying.
+		FatalBackOffTimeout time.Duration `yaml:"fatal_backoff_timeout"`
+
+		// Back off intervals are randomly increased or decreased by at most
+		// this fraction of them, so that retries of consumers that failed at
+		// the same time are spread over time. It must be in [0, 1).
+		BackOffJitter float64 `yaml:"backoff_jitter"`
+
 		// Consumer should wait this long after it gets notification that a
 		// consumer joined/left its consumer group before starting rebalancing.
 		RebalanceDelay time.Duration `yaml:"rebalance_delay"`
 
+		// How consumer group membership is coordinated, either `zookeeper`,
+		// or `kafka` to use the group coordinator of the Kafka cluster.
+		GroupProtocol string `yaml:"group_protocol"`
+
+		// If the Kafka group coordinator does not receive heartbeats from a
+		// group member for this long, then it removes the member from the
+		// group. Applies only if `GroupProtocol` is `kafka`, unless
+		// `InstanceID` is set.
+		GroupSessionTimeout time.Duration `yaml:"group_session_timeout"`
+
+		// If set, then the Kafka-Pixy instance is a static member of consumer
+		// groups, that is it joins them with this ID rather than with the
+		// `ClientID`. When a static member leaves a group, other members wait
+		// for `GroupSessionTimeout` before rebalancing, so that if it comes
+		// back with the same ID in the meantime, e.g. after a restart, it
+		// reclaims its previous partitions and nobody else is affected. It
+		// must be unique among all Kafka-Pixy instances of the cluster. With
+		// the `kafka` group protocol static members leave groups on stop like
+		// dynamic ones, for the Kafka client in use cannot join groups with
+		// an instance ID.
+		InstanceID string `yaml:"instance_id"`
+
+		// How partitions of topics are divided among members of a consumer
+		// group, either `range`, `roundrobin`, or `sticky`. All members of a
+		// group must use the same strategy.
+		PartitionAssignment string `yaml:"partition_assignment"`
+
+		// If set, then partitions are assigned by this implementation rather
+		// than by the one selected by `PartitionAssignment`.
+		PartitionAssignor PartitionAssignor `yaml:"-"`
+
+		// How many partition consumers of a topic can be started or stopped
+		// in parallel during rebalancing.
+		RebalanceConcurrency int `yaml:"rebalance_concurrency"`
+
+		// How many most recent rebalancings are kept per consumer group to
+		// be reported via the rebalances API endpoint. Zero disables it.
+		RebalanceHistorySize int `yaml:"rebalance_history_size"`
+
 		// How frequently to commit offsets to Kafka.
 		OffsetsCommitInterval time.Duration `yaml:"offsets_commit_interval"`
+
+		// Where a consumer group starts consuming a partition that it has
+		// no committed offset for, either `newest` or `oldest`. Applies only
+		// if there is no offset initializer, or it fails.
+		InitialOffset string `yaml:"initial_offset"`
+
+		// If a message is not acknowledged within the ack timeout this many
+		// times, then it is produced to the dead letter topic, that is the
+		// consumed topic name followed by `.dlq`, and acknowledged. Zero
+		// disables it.
+		DeadLetterAfter int `yaml:"dead_letter_after"`
+
+		// Delays of retry tiers in ascending order, e.g. `[1m, 10m]`. A
+		// message that a client asks to retry is produced to the retry
+		// topic of the next tier, that is the consumed topic name followed
+		// by `.retry.` and the delay, e.g. `foo.retry.1m`, and a consumer
+		// group gets it from there no sooner than the delay elapses. A
+		// message that has been retried in all tiers is produced to the
+		// dead letter topic. Empty disables retries.
+		RetryTiers []time.Duration `yaml:"retry_tiers"`
+
+		// Names of enrichers applied in order to messages of all topics
+		// returned by consume requests, see `Enricher`. Enrichers are
+		// registered with `RegisterEnricher`, and `dead_letter` is
+		// built-in.
+		Enrichers []string `yaml:"enrichers"`
+
+		// Topic specific consumer parameters. Parameters that are not
+		// explicitly defined for a topic are inherited from this section.
+		Topics map[string]*ConsumerTopic `yaml:"topics"`
+
+		// Message deduplication parameters by consumer group. Groups that are
+		// not listed here get all messages, duplicates included.
+		Dedup map[string]*ConsumerDedup `yaml:"dedup"`
+
+		// Optional hook that is called when a consumer group starts consuming
+		// a partition that it has no committed offset for. It can only be
+		// set programmatically by applications that embed Kafka-Pixy.
+		OffsetInitializer OffsetInitializer `yaml:"-"`
+
+		// Optional hook that is notified about lifecycle events of consumed
+		// messages. The proxy sets it when message tracing is enabled, but
+		// it can also be set programmatically by applications that embed
+		// Kafka-Pixy.
+		MessageTracer MessageTracer `yaml:"-"`
+
+		// Optional hook that is notified about lifecycle events of consumer
+		// groups, like rebalancings and offset resets. The proxy sets it when
+		// `Events.Topic` is configured, but it can also be set
+		// programmatically by applications that embed Kafka-Pixy.
+		EventListener EventListener `yaml:"-"`
+
+		// Hook that produces messages to dead letter topics, see
+		// `DeadLetterAfter`. The proxy sets it to produce with its own
+		// producer, but it can also be set programmatically by applications
+		// that embed Kafka-Pixy.
+		DeadLetterProducer DeadLetterProducer `yaml:"-"`
 	} `yaml:"consumer"`
+
+	Accounting struct {
+
+		// If enabled then the number of messages and bytes produced and
+		// consumed is counted per tenant per topic per hour. The tenant is
+		// the principal that a request is authenticated as, and the proxy
+		// alias if unknown.
+		Enabled bool `yaml:"enabled"`
+
+		// Period of time that usage counters are kept in memory for after
+		// the hour they were collected for has passed.
+		Retention time.Duration `yaml:"retention"`
+
+		// How frequently to check for completed hours that have not been
+		// exported yet.
+		ExportInterval time.Duration `yaml:"export_interval"`
+
+		// If not empty, then usage records of completed hours are produced
+		// to this Kafka topic as JSON documents.
+		ExportTopic string `yaml:"export_topic"`
+
+		// If not empty, then usage records of completed hours are appended
+		// to this file in CSV format.
+		ExportCSVFile string `yaml:"export_csv_file"`
+	} `yaml:"accounting"`
+
+	HotPartitions struct {
+
+		// If enabled then the rate of bytes produced to and consumed from
+		// every partition via the proxy is tracked, to spot partitions that
+		// receive much more traffic than others of the same topic.
+		Enabled bool `yaml:"enabled"`
+
+		// Period of time that byte rates are averaged over.
+		Window time.Duration `yaml:"window"`
+
+		// A partition is hot if its produce or consume byte rate is more
+		// than this many times the median rate of all topic partitions.
+		SkewFactor float64 `yaml:"skew_factor"`
+
+		// Partitions with a byte rate lower than this, in bytes per second,
+		// are never hot, so that skew of a topic with little traffic does
+		// not raise alarms.
+		MinRate int64 `yaml:"min_rate"`
+
+		// How frequently topics are checked for partitions that became hot.
+		// Each partition that became hot is logged and reported to
+		// `Listener`, if one is set.
+		CheckInterval time.Duration `yaml:"check_interval"`
+
+		// Optional hook that is notified when a partition becomes hot. It
+		// can be set programmatically by applications that embed
+		// Kafka-Pixy, e.g. to page on-call engineers.
+		Listener HotPartitionListener `yaml:"-"`
+	} `yaml:"hot_partitions"`
+
+	Tracing struct {
+
+		// If enabled then lifecycle events of messages produced with a trace
+		// ID are recorded and can be retrieved via the traces API endpoint.
+		// It is a debugging aid, consumer events are only recorded for
+		// messages produced via the same proxy.
+		Enabled bool `yaml:"enabled"`
+
+		// The maximum number of most recent traces kept in memory.
+		MaxTraces int `yaml:"max_traces"`
+	} `yaml:"tracing"`
+
+	DisabledTopics struct {
+
+		// Topics that produce requests are rejected for, mapped to reasons
+		// reported to clients. It is a kill switch for incidents when a
+		// topic must not receive more data. Topics can also be disabled and
+		// enabled at runtime via the admin API.
+		Produce map[string]string `yaml:"produce"`
+
+		// Topics that consume and read requests are rejected for, mapped to
+		// reasons reported to clients.
+		Consume map[string]string `yaml:"consume"`
+	} `yaml:"disabled_topics"`
+
+	Compression struct {
+
+		// If enabled then HTTP API responses are compressed with gzip or
+		// deflate, if a client accepts either via `Accept-Encoding`.
+		Enabled bool `yaml:"enabled"`
+
+		// Responses smaller than this many bytes are sent uncompressed, for
+		// compression is not worth it for them.
+		MinSize int `yaml:"min_size"`
+	} `yaml:"compression"`
+
+	CORS struct {
+
+		// Origins that browser-based clients are allowed to make HTTP API
+		// requests from, e.g. `https://app.example.com`, or `*` for any.
+		// CORS is disabled if none is listed.
+		AllowedOrigins []string `yaml:"allowed_origins"`
+
+		// Methods and request headers that are allowed in cross-origin
+		// requests.
+		AllowedMethods []string `yaml:"allowed_methods"`
+		AllowedHeaders []string `yaml:"allowed_headers"`
+
+		// How long browsers may cache responses to preflight requests.
+		MaxAge time.Duration `yaml:"max_age"`
+
+		// HTTP API listeners that CORS is enabled on: `tcp` and/or `unix`.
+		Listeners []string `yaml:"listeners"`
+	} `yaml:"cors"`
+
+	Redaction struct {
+
+		// Message fields of the listed topics that must never appear in logs
+		// and error messages. HMAC-SHA256 hashes of the field values are
+		// shown instead, and so are errors that may quote messages of the
+		// topics, e.g. enrichment errors. Valid fields are `key` and `value`.
+		Topics map[string][]string `yaml:"topics"`
+
+		// Secret key of the HMAC-SHA256 hashes that replace redacted fields,
+		// so that hashes of guessable values cannot be reversed by brute
+		// force. If empty then a random key is generated on start, and hashes
+		// can only be correlated within the lifetime of the process.
+		HashKey string `yaml:"hash_key"`
+	} `yaml:"redaction"`
+
+	QueryCache struct {
+
+		// For how long results of offsets and consumers queries made via
+		// the HTTP API are served from memory, rather than fetched from
+		// Kafka and ZooKeeper again. A request can bypass the cache with the
+		// `refresh` parameter. Zero disables the cache.
+		TTL time.Duration `yaml:"ttl"`
+	} `yaml:"query_cache"`
+
+	Events struct {
+
+		// If not empty, then lifecycle events of the proxy, like consumer
+		// group rebalancings and offset resets, are produced to this Kafka
+		// topic as JSON documents.
+		Topic string `yaml:"topic"`
+
+		// The maximum number of events waiting to be produced. Events that
+		// occur when the buffer is full are dropped.
+		BufferSize int `yaml:"buffer_size"`
+	} `yaml:"events"`
+}
+
+// Policies of handling messages that the Kafka client gave up on.
+const (
+	RetryFail     = "fail"
+	RetryResubmit = "resubmit"
+)
+
+// Message fields that can be redacted.
+const (
+	RedactKey   = "key"
+	RedactValue = "value"
+)
+
+// HTTP API listeners that CORS can be enabled on.
+const (
+	ListenerTCP  = "tcp"
+	ListenerUnix = "unix"
+)
+
+// Redacted is shown instead of secrets by `App.Redacted`.
+const Redacted = "REDACTED"
+
+// Message fields that duplicates can be detected by.
+const (
+	DedupKey   = "key"
+	DedupValue = "value"
+)
+
+const (
+	InitialOffsetNewest = "newest"
+	InitialOffsetOldest = "oldest"
+)
+
+// DeadLetterTopicSuffix is appended to the name of a consumed topic to get
+// the name of the topic that its dead letters are produced to.
+const DeadLetterTopicSuffix = ".dlq"
+
+// RetryTopicInfix separates the name of a consumed topic and the name of a
+// retry tier in names of retry topics, see `RetryTopic`.
+const RetryTopicInfix = ".retry."
+
+const (
+	GroupProtocolZooKeeper = "zookeeper"
+	GroupProtocolKafka     = "kafka"
+)
+
+const (
+	PartitionAssignmentRange      = "range"
+	PartitionAssignmentRoundRobin = "roundrobin"
+	PartitionAssignmentSticky     = "sticky"
+)
+
+// OffsetInitializer defines an interface that applications embedding
+// Kafka-Pixy can implement to compute an offset that a consumer group should
+// start consuming a topic partition from, when there is no offset committed
+// by the group for the partition yet, e.g. to resume from a checkpoint stored
+// in an external system. Either an actual offset or one of the
+// `sarama.OffsetOldest` and `sarama.OffsetNewest` constants can be returned.
+// If an error is returned then consumption starts from the configured initial
+// offset.
+type OffsetInitializer interface {
+	InitialOffset(group, topic string, partition int32) (int64, error)
+}
+
+// MessageTracer defines an interface to be notified about lifecycle events of
+// messages consumed by consumer groups. Implementations must be safe for
+// concurrent use and must not block, for they are called from partition
+// consumers of all groups.
+type MessageTracer interface {
+	// OnConsumerEvent is called when a message is fetched from Kafka, offered
+	// to a client, or acknowledged by a client.
+	OnConsumerEvent(event, group, topic string, partition int32, offset int64)
+
+	// OnCommitted is called when an offset is committed by a group, meaning
+	// that all messages before the offset are consumed.
+	OnCommitted(group, topic string, partition int32, offset int64)
+}
+
+// PartitionAssignor defines an interface that applications embedding
+// Kafka-Pixy can implement to divide partitions among members of consumer
+// groups. Every member of a group assigns partitions to itself on its own, so
+// an implementation must return the same result given the same input, and all
+// Kafka-Pixy instances consuming a group must use the same one.
+type PartitionAssignor interface {
+	// Assign returns partitions by topic assigned to every member, given
+	// partitions of all topics consumed by the group, and IDs of members
+	// subscribed to each topic, both by topic.
+	Assign(partitions map[string][]int32, subscribers map[string][]string) map[string]map[string][]int32
+}
+
+// EventListener defines an interface to be notified about lifecycle events of
+// consumer groups. Implementations must be safe for concurrent use and must
+// not block, for they are called from group and partition consumers.
+type EventListener interface {
+	// OnEvent is called when an event of the specified type occurs to a
+	// group, or to a topic consumed by a group if `topic` is not empty.
+	// Event type specific details are passed in `attrs`.
+	OnEvent(eventType, group, topic string, attrs map[string]interface{})
+}
+
+// DeadLetter is a message that a consumer group failed to process, along with
+// details of the failure.
+type DeadLetter struct {
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	// The number of times the ack timeout of the message expired.
+	AckTimeouts int `json:"ack_timeouts"`
+	// When the message was routed to the dead letter topic.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RetryEnvelope is a message that a consumer group asked to be redelivered
+// later, as it is produced to a retry topic. It is redelivered to the group
+// only, with the original key and value.
+type RetryEnvelope struct {
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	// The number of times the message has been retried, including this one.
+	Retries int `json:"retries"`
+	// When the message was produced to the retry topic. It is redelivered
+	// no sooner than the tier delay after that.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeadLetterProducer defines an interface to produce messages that consumer
+// groups failed to process to dead letter topics. Implementations must be
+// safe for concurrent use and must not block, for they are called from
+// partition consumers of all groups.
+type DeadLetterProducer interface {
+	// ProduceDeadLetter produces the dead letter to `topic`, and calls
+	// `done` with the result when it is known.
+	ProduceDeadLetter(topic string, dl DeadLetter, done func(error))
+}
+
+// PartitionMeter defines an interface to be notified about messages committed
+// to Kafka by the producer. Implementations must be safe for concurrent use
+// and must not block, for they are called from the producer dispatcher.
+type PartitionMeter interface {
+	// CountProduced is called when a message of `size` bytes, the key and
+	// the value combined, is committed to a partition of a topic.
+	CountProduced(topic string, partition int32, size int)
+}
+
+// HotPartition describes a partition that receives much more traffic than
+// other partitions of its topic. Rates are in bytes per second.
+type HotPartition struct {
+	Topic              string
+	Partition          int32
+	ProducedRate       float64
+	ConsumedRate       float64
+	MedianProducedRate float64
+	MedianConsumedRate float64
+}
+
+// HotPartitionListener defines an interface to be notified when partitions
+// become hot, see `HotPartitions.SkewFactor`.
+type HotPartitionListener interface {
+	// OnHotPartition is called once when a partition becomes hot. It is
+	// called again only if the partition cools down and becomes hot again.
+	OnHotPartition(hp HotPartition)
+}
+
+// ProducerTopic defines producer parameters that can be set on per topic
+// basis.
+type ProducerTopic struct {
+	// If not empty, then every message is sent to this URL for validation
+	// before it is produced to the topic. Messages that the webhook responds
+	// to with a non 2xx status code are rejected.
+	ValidationWebhook string `yaml:"validation_webhook"`
+
+	// If true, then sticky partitioning is used for messages without a key
+	// produced to the topic, even if `Producer.StickyPartitioning` is false.
+	StickyPartitioning bool `yaml:"sticky_partitioning"`
+}
+
+// ConsumerTopic defines consumer parameters that can be overridden on per
+// topic basis.
+type ConsumerTopic struct {
+	// Size of the message and error buffers of partition message streams.
+	// If not specified then `Consumer.ChannelBufferSize` is used. Buffers
+	// are sized when streams are spawned, and are never resized.
+	ChannelBufferSize int `yaml:"channel_buffer_size"`
+
+	// Where a consumer group starts consuming a partition of the topic that
+	// it has no committed offset for, either `newest` or `oldest`. If not
+	// specified then `Consumer.InitialOffset` is used.
+	InitialOffset string `yaml:"initial_offset"`
+
+	// The number of ack timeouts after which a message of the topic is
+	// routed to the dead letter topic. If not specified then
+	// `Consumer.DeadLetterAfter` is used.
+	DeadLetterAfter int `yaml:"dead_letter_after"`
+
+	// Delays of retry tiers of the topic. If not specified then
+	// `Consumer.RetryTiers` is used.
+	RetryTiers []time.Duration `yaml:"retry_tiers"`
+
+	// Names of enrichers applied to messages of the topic. If not
+	// specified then `Consumer.Enrichers` is used.
+	Enrichers []string `yaml:"enrichers"`
+}
+
+// ConsumerDedup defines parameters of a filter that drops messages that have
+// already been consumed by a group recently, for topics that are known to
+// have messages published more than once. Dropped messages are acknowledged
+// as if they were consumed by a client.
+type ConsumerDedup struct {
+	// Message field that duplicates are detected by, either `key` or
+	// `value`. Messages are compared by SHA-256 hashes of the field. If not
+	// specified then `value` is used.
+	Field string `yaml:"field"`
+
+	// A message is a duplicate if a message with the same field has been
+	// consumed from the same topic within this period of time.
+	Window time.Duration `yaml:"window"`
+
+	// The maximum number of hashes remembered per topic. When it is reached
+	// the oldest hashes are forgotten before their window expires.
+	MaxSize int `yaml:"max_size"`
 }
 
 // DefaultApp returns default application configuration where default proxy has
@@ -139,8 +832,13 @@ func FromYAMLFile(filename string) (*App, error) {
 }
 
 // FromYAML parses configuration from a YAML string and performs basic
-// validation of parameters.
+// validation of parameters. References to secrets are resolved by registered
+// secrets providers, see `RegisterSecretsProvider`.
 func FromYAML(data []byte) (*App, error) {
+	data, err := resolveSecrets(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: err=(%s)", err)
+	}
 	var prob proxyProb
 	if err := yaml.Unmarshal(data, &prob); err != nil {
 		return nil, fmt.Errorf("failed to parse config: err=(%s)", err)
@@ -149,6 +847,26 @@ func FromYAML(data []byte) (*App, error) {
 	appCfg := newApp()
 	clientID := newClientID()
 
+	// Application level parameters are parsed separately from proxies for
+	// the same reason as described below.
+	var appItems yaml.MapSlice
+	if err := yaml.Unmarshal(data, &appItems); err != nil {
+		return nil, fmt.Errorf("failed to parse config: err=(%s)", err)
+	}
+	var appOnlyItems yaml.MapSlice
+	for _, appItem := range appItems {
+		if appItem.Key != "proxies" {
+			appOnlyItems = append(appOnlyItems, appItem)
+		}
+	}
+	encodedAppCfg, err := yaml.Marshal(appOnlyItems)
+	if err != nil {
+		panic(err)
+	}
+	if err := yaml.Unmarshal(encodedAppCfg, appCfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: err=(%s)", err)
+	}
+
 	for _, proxyItem := range prob.Proxies {
 		proxyAlias, ok := proxyItem.Key.(string)
 		if !ok {
@@ -177,15 +895,98 @@ func FromYAML(data []byte) (*App, error) {
 	return appCfg, nil
 }
 
+// Redacted returns a copy of the configuration that is safe to be shown to
+// operators, where HMAC key secrets, gRPC API tokens, redaction hash keys and
+// passwords of webhook URLs are replaced with `Redacted`. The original configuration is not modified.
+func (a *App) Redacted() *App {
+	redacted := *a
+	if a.HMAC.Keys != nil {
+		redacted.HMAC.Keys = make(map[string]string, len(a.HMAC.Keys))
+		for keyID := range a.HMAC.Keys {
+			redacted.HMAC.Keys[keyID] = Redacted
+		}
+	}
+	if a.GRPCAuth.Tokens != nil {
+		redacted.GRPCAuth.Tokens = make([]string, len(a.GRPCAuth.Tokens))
+		for i := range a.GRPCAuth.Tokens {
+			redacted.GRPCAuth.Tokens[i] = Redacted
+		}
+	}
+	redacted.Proxies = make(map[string]*Proxy, len(a.Proxies))
+	for alias, proxyCfg := range a.Proxies {
+		redactedProxyCfg := *proxyCfg
+		if proxyCfg.Redaction.HashKey != "" {
+			redactedProxyCfg.Redaction.HashKey = Redacted
+		}
+		if proxyCfg.Producer.Topics != nil {
+			redactedProxyCfg.Producer.Topics = make(map[string]*ProducerTopic, len(proxyCfg.Producer.Topics))
+			for topic, topicCfg := range proxyCfg.Producer.Topics {
+				if topicCfg != nil {
+					redactedTopicCfg := *topicCfg
+					redactedTopicCfg.ValidationWebhook = redactURL(topicCfg.ValidationWebhook)
+					topicCfg = &redactedTopicCfg
+				}
+				redactedProxyCfg.Producer.Topics[topic] = topicCfg
+			}
+		}
+		redacted.Proxies[alias] = &redactedProxyCfg
+	}
+	return &redacted
+}
+
+// redactURL replaces the password of a URL, if it has one, with `Redacted`.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	return u.String()
+}
+
 func (a *App) validate() error {
 	if len(a.Proxies) == 0 {
 		return errors.New("at least on proxy must be configured")
 	}
+	if _, ok := a.Proxies[a.DefaultProxy]; !ok {
+		return errors.Errorf("default proxy is not configured: %s", a.DefaultProxy)
+	}
 	for proxyAlias, proxyCfg := range a.Proxies {
 		if err := proxyCfg.validate(); err != nil {
 			return fmt.Errorf("invalid config: proxy=%s, err=(%s)", proxyAlias, err)
 		}
 	}
+	if len(a.HMAC.Keys) > 0 && a.HMAC.MaxClockSkew <= 0 {
+		return errors.New("HMAC.MaxClockSkew must be > 0")
+	}
+	for keyID, secret := range a.HMAC.Keys {
+		if secret == "" {
+			return errors.Errorf("HMAC.Keys[%s] must not be empty", keyID)
+		}
+	}
+	switch {
+	case (a.GRPCTLS.CertFile == "") != (a.GRPCTLS.KeyFile == ""):
+		return errors.New("GRPCTLS.CertFile and GRPCTLS.KeyFile must be configured together")
+	case a.GRPCTLS.ClientCAFile != "" && a.GRPCTLS.CertFile == "":
+		return errors.New("GRPCTLS.ClientCAFile requires GRPCTLS.CertFile")
+	case len(a.GRPCAuth.ClientCertCNs) != 0 && a.GRPCTLS.ClientCAFile == "":
+		return errors.New("GRPCAuth.ClientCertCNs requires GRPCTLS.ClientCAFile")
+	}
+	for i, token := range a.GRPCAuth.Tokens {
+		if token == "" {
+			return errors.Errorf("GRPCAuth.Tokens[%d] must not be empty", i)
+		}
+	}
+	switch {
+	case a.LogSampling.Requests < 0 || a.LogSampling.Requests > 1:
+		return errors.New("LogSampling.Requests must be in [0, 1]")
+	case a.LogSampling.FailedRequests < 0 || a.LogSampling.FailedRequests > 1:
+		return errors.New("LogSampling.FailedRequests must be in [0, 1]")
+	case a.LogSampling.ConsumerWarnings < 0 || a.LogSampling.ConsumerWarnings > 1:
+		return errors.New("LogSampling.ConsumerWarnings must be in [0, 1]")
+	}
 	return nil
 }
 
@@ -196,6 +997,37 @@ func (p *Proxy) validate() error {
 		return errors.New("Producer.ChannelBufferSize must be > 0")
 	case p.Producer.ShutdownTimeout < 0:
 		return errors.New("Producer.ShutdownTimeout must be >= 0")
+	case p.Producer.ValidationTimeout <= 0:
+		return errors.New("Producer.ValidationTimeout must be > 0")
+	case p.Producer.MaxSyncTimeout <= 0:
+		return errors.New("Producer.MaxSyncTimeout must be > 0")
+	case p.Producer.MaxBatchSize <= 0:
+		return errors.New("Producer.MaxBatchSize must be > 0")
+	case p.Producer.MaxMessageSize <= 0:
+		return errors.New("Producer.MaxMessageSize must be > 0")
+	case p.Producer.MaxBatchBytes <= 0:
+		return errors.New("Producer.MaxBatchBytes must be > 0")
+	case p.Producer.Retry.Max < 1:
+		return errors.New("Producer.Retry.Max must be > 0")
+	case p.Producer.Retry.Backoff <= 0:
+		return errors.New("Producer.Retry.Backoff must be > 0")
+	case p.Producer.Retry.BackoffJitter < 0 || p.Producer.Retry.BackoffJitter >= 1:
+		return errors.New("Producer.Retry.BackoffJitter must be in [0, 1)")
+	case p.Producer.Retry.MaxResubmits < 0:
+		return errors.New("Producer.Retry.MaxResubmits must be >= 0")
+	}
+	for errName, policy := range p.Producer.Retry.Policies {
+		if policy != RetryFail && policy != RetryResubmit {
+			return errors.Errorf("Producer.Retry.Policies[%s] has invalid policy: %s", errName, policy)
+		}
+	}
+	for topic, topicCfg := range p.Producer.Topics {
+		if topicCfg == nil || topicCfg.ValidationWebhook == "" {
+			continue
+		}
+		if u, err := url.Parse(topicCfg.ValidationWebhook); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("Producer.Topics[%s].ValidationWebhook must be an absolute URL", topic)
+		}
 	}
 	// Validate the Consumer parameters.
 	switch {
@@ -203,25 +1035,291 @@ func (p *Proxy) validate() error {
 		return errors.New("Consumer.ChannelBufferSize must be > 0")
 	case p.Consumer.LongPollingTimeout <= 0:
 		return errors.New("Consumer.LongPollingTimeout must be > 0")
+	case p.Consumer.MaxLongPollingTimeout < 0:
+		return errors.New("Consumer.MaxLongPollingTimeout must be >= 0")
+	case p.Consumer.MaxLongPollingTimeout >= p.Consumer.RegistrationTimeout:
+		return errors.New("Consumer.MaxLongPollingTimeout must be < Consumer.RegistrationTimeout")
+	case p.Consumer.MaxBatchSize <= 0:
+		return errors.New("Consumer.MaxBatchSize must be > 0")
+	case p.Consumer.TopicPatternRefresh <= 0:
+		return errors.New("Consumer.TopicPatternRefresh must be > 0")
 	case p.Consumer.RegistrationTimeout <= 0:
 		return errors.New("Consumer.RegistrationTimeout must be > 0")
 	case p.Consumer.AckTimeout >= p.Consumer.RegistrationTimeout:
 		return errors.New("Consumer.AckTimeout must be < Consumer.RegistrationTimeout")
 	case p.Consumer.BackOffTimeout <= 0:
 		return errors.New("Consumer.BackOffTimeout must be > 0")
+	case p.Consumer.FatalBackOffTimeout < p.Consumer.BackOffTimeout:
+		return errors.New("Consumer.FatalBackOffTimeout must be >= Consumer.BackOffTimeout")
+	case p.Consumer.BackOffJitter < 0 || p.Consumer.BackOffJitter >= 1:
+		return errors.New("Consumer.BackOffJitter must be in [0, 1)")
 	case p.Consumer.RebalanceDelay <= 0:
 		return errors.New("Consumer.RebalanceDelay must be > 0")
+	case p.Consumer.GroupProtocol != GroupProtocolZooKeeper && p.Consumer.GroupProtocol != GroupProtocolKafka:
+		return errors.Errorf("Consumer.GroupProtocol has invalid value: %s", p.Consumer.GroupProtocol)
+	case p.Consumer.PartitionAssignment != PartitionAssignmentRange &&
+		p.Consumer.PartitionAssignment != PartitionAssignmentRoundRobin &&
+		p.Consumer.PartitionAssignment != PartitionAssignmentSticky:
+		return errors.Errorf("Consumer.PartitionAssignment has invalid value: %s", p.Consumer.PartitionAssignment)
+	case p.Consumer.GroupSessionTimeout <= 0:
+		return errors.New("Consumer.GroupSessionTimeout must be > 0")
+	case strings.Contains(p.Consumer.InstanceID, "/"):
+		return errors.Errorf("Consumer.InstanceID has invalid value: %s", p.Consumer.InstanceID)
+	case p.Consumer.RebalanceConcurrency <= 0:
+		return errors.New("Consumer.RebalanceConcurrency must be > 0")
+	case p.Consumer.RebalanceHistorySize < 0:
+		return errors.New("Consumer.RebalanceHistorySize must be >= 0")
 	case p.Consumer.OffsetsCommitInterval <= 0:
 		return errors.New("Consumer.OffsetsCommitInterval must be > 0")
+	case !isValidInitialOffset(p.Consumer.InitialOffset):
+		return errors.Errorf("Consumer.InitialOffset has invalid value: %s", p.Consumer.InitialOffset)
+	case p.Consumer.DeadLetterAfter < 0:
+		return errors.New("Consumer.DeadLetterAfter must be >= 0")
+	case !isValidRetryTiers(p.Consumer.RetryTiers):
+		return errors.Errorf("Consumer.RetryTiers has invalid value: %v", p.Consumer.RetryTiers)
+	}
+	for topic, topicCfg := range p.Consumer.Topics {
+		if topicCfg == nil {
+			continue
+		}
+		if topicCfg.ChannelBufferSize < 0 {
+			return errors.Errorf("Consumer.Topics[%s].ChannelBufferSize must be >= 0", topic)
+		}
+		if topicCfg.InitialOffset != "" && !isValidInitialOffset(topicCfg.InitialOffset) {
+			return errors.Errorf("Consumer.Topics[%s].InitialOffset has invalid value: %s", topic, topicCfg.InitialOffset)
+		}
+		if topicCfg.DeadLetterAfter < 0 {
+			return errors.Errorf("Consumer.Topics[%s].DeadLetterAfter must be >= 0", topic)
+		}
+		if !isValidRetryTiers(topicCfg.RetryTiers) {
+			return errors.Errorf("Consumer.Topics[%s].RetryTiers has invalid value: %v", topic, topicCfg.RetryTiers)
+		}
+	}
+	for group, dedupCfg := range p.Consumer.Dedup {
+		if dedupCfg == nil {
+			return errors.Errorf("Consumer.Dedup[%s] must not be empty", group)
+		}
+		switch {
+		case dedupCfg.Field != "" && dedupCfg.Field != DedupKey && dedupCfg.Field != DedupValue:
+			return errors.Errorf("Consumer.Dedup[%s].Field has invalid value: %s", group, dedupCfg.Field)
+		case dedupCfg.Window <= 0:
+			return errors.Errorf("Consumer.Dedup[%s].Window must be > 0", group)
+		case dedupCfg.MaxSize <= 0:
+			return errors.Errorf("Consumer.Dedup[%s].MaxSize must be > 0", group)
+		}
+	}
+	// Validate the Startup parameters.
+	if p.Startup.RetryBackOff <= 0 {
+		return errors.New("Startup.RetryBackOff must be > 0")
+	}
+	// Validate the Failover parameters.
+	if len(p.Failover.StandbySeedPeers) > 0 {
+		switch {
+		case p.Failover.HealthCheckInterval <= 0:
+			return errors.New("Failover.HealthCheckInterval must be > 0")
+		case p.Failover.FailoverAfter <= 0:
+			return errors.New("Failover.FailoverAfter must be > 0")
+		case p.Failover.FailbackAfter < 0:
+			return errors.New("Failover.FailbackAfter must be >= 0")
+		}
+	}
+	// Validate the Accounting parameters.
+	if p.Accounting.Enabled {
+		switch {
+		case p.Accounting.Retention < time.Hour:
+			return errors.New("Accounting.Retention must be >= 1h")
+		case p.Accounting.ExportInterval <= 0:
+			return errors.New("Accounting.ExportInterval must be > 0")
+		}
+	}
+	// Validate the HotPartitions parameters.
+	if p.HotPartitions.Enabled {
+		switch {
+		case p.HotPartitions.Window < time.Second:
+			return errors.New("HotPartitions.Window must be >= 1s")
+		case p.HotPartitions.SkewFactor <= 1:
+			return errors.New("HotPartitions.SkewFactor must be > 1")
+		case p.HotPartitions.MinRate < 0:
+			return errors.New("HotPartitions.MinRate must be >= 0")
+		case p.HotPartitions.CheckInterval <= 0:
+			return errors.New("HotPartitions.CheckInterval must be > 0")
+		}
+	}
+	// Validate the Tracing parameters.
+	if p.Tracing.Enabled && p.Tracing.MaxTraces <= 0 {
+		return errors.New("Tracing.MaxTraces must be > 0")
+	}
+	// Validate the Compression parameters.
+	if p.Compression.MinSize < 0 {
+		return errors.New("Compression.MinSize must be >= 0")
+	}
+	// Validate the CORS parameters.
+	if p.CORS.MaxAge < 0 {
+		return errors.New("CORS.MaxAge must be >= 0")
+	}
+	for _, listener := range p.CORS.Listeners {
+		if listener != ListenerTCP && listener != ListenerUnix {
+			return errors.Errorf("CORS.Listeners has invalid listener: %s", listener)
+		}
+	}
+	// Validate the QueryCache parameters.
+	if p.QueryCache.TTL < 0 {
+		return errors.New("QueryCache.TTL must be >= 0")
+	}
+	// Validate the Events parameters.
+	if p.Events.Topic != "" && p.Events.BufferSize <= 0 {
+		return errors.New("Events.BufferSize must be > 0")
+	}
+	// Validate the Redaction parameters.
+	for topic, fields := range p.Redaction.Topics {
+		for _, field := range fields {
+			if field != RedactKey && field != RedactValue {
+				return errors.Errorf("Redaction.Topics[%s] has invalid field: %s", topic, field)
+			}
+		}
 	}
 	return nil
 }
 
+// ProducerStickyPartitioning tells whether messages without a key produced to
+// the topic should be partitioned by the sticky partitioner.
+func (p *Proxy) ProducerStickyPartitioning(topic string) bool {
+	if topicCfg := p.Producer.Topics[topic]; topicCfg != nil && topicCfg.StickyPartitioning {
+		return true
+	}
+	return p.Producer.StickyPartitioning
+}
+
+// KafkaClientID returns the client ID that requests to Kafka brokers should be
+// made with. Unless it is explicitly configured, the proxy client ID followed
+// by the suffix is returned.
+func (p *Proxy) KafkaClientID(suffix string) string {
+	if p.Kafka.ClientID != "" {
+		return p.Kafka.ClientID
+	}
+	return p.ClientID + suffix
+}
+
+// GroupMemberID returns the ID that the proxy joins consumer groups with,
+// that is the instance ID if it is configured, or the client ID otherwise.
+func (p *Proxy) GroupMemberID() string {
+	if p.Consumer.InstanceID != "" {
+		return p.Consumer.InstanceID
+	}
+	return p.ClientID
+}
+
+// ConsumerInitialOffset returns the initial offset configured for the topic,
+// or for the proxy if it is not configured for the topic.
+func (p *Proxy) ConsumerInitialOffset(topic string) string {
+	if topicCfg := p.Consumer.Topics[topic]; topicCfg != nil && topicCfg.InitialOffset != "" {
+		return topicCfg.InitialOffset
+	}
+	return p.Consumer.InitialOffset
+}
+
+// ConsumerDeadLetterAfter returns the number of ack timeouts after which a
+// message of the topic is routed to the dead letter topic, zero if it never
+// is.
+func (p *Proxy) ConsumerDeadLetterAfter(topic string) int {
+	if topicCfg := p.Consumer.Topics[topic]; topicCfg != nil && topicCfg.DeadLetterAfter != 0 {
+		return topicCfg.DeadLetterAfter
+	}
+	return p.Consumer.DeadLetterAfter
+}
+
+// ConsumerDeadLettersEnabled tells whether messages of any topic can be routed
+// to dead letter topics.
+func (p *Proxy) ConsumerDeadLettersEnabled() bool {
+	if p.Consumer.DeadLetterAfter > 0 {
+		return true
+	}
+	for _, topicCfg := range p.Consumer.Topics {
+		if topicCfg != nil && topicCfg.DeadLetterAfter > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsumerRetryTiers returns delays of retry tiers of the specified topic.
+func (p *Proxy) ConsumerRetryTiers(topic string) []time.Duration {
+	if topicCfg := p.Consumer.Topics[topic]; topicCfg != nil && len(topicCfg.RetryTiers) != 0 {
+		return topicCfg.RetryTiers
+	}
+	return p.Consumer.RetryTiers
+}
+
+// ConsumerEnrichers returns names of enrichers of the specified topic.
+func (p *Proxy) ConsumerEnrichers(topic string) []string {
+	if topicCfg := p.Consumer.Topics[topic]; topicCfg != nil && len(topicCfg.Enrichers) != 0 {
+		return topicCfg.Enrichers
+	}
+	return p.Consumer.Enrichers
+}
+
+// ParseRetryTopic tells whether the specified topic is a retry topic of one
+// of the configured retry tiers, and if so returns the name of the topic
+// that it retries messages of, and the tier delay.
+func (p *Proxy) ParseRetryTopic(topic string) (string, time.Duration, bool) {
+	i := strings.LastIndex(topic, RetryTopicInfix)
+	if i < 0 {
+		return "", 0, false
+	}
+	origTopic, tierName := topic[:i], topic[i+len(RetryTopicInfix):]
+	for _, delay := range p.ConsumerRetryTiers(origTopic) {
+		if RetryTierName(delay) == tierName {
+			return origTopic, delay, true
+		}
+	}
+	return "", 0, false
+}
+
+// RetryTopic returns the name of the retry topic of a tier with the
+// specified delay.
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + RetryTopicInfix + RetryTierName(delay)
+}
+
+// RetryTierName returns a short representation of a retry tier delay used in
+// retry topic names, e.g. `30s`, `10m`, or `1h`.
+func RetryTierName(delay time.Duration) string {
+	name := delay.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
+
+// isValidRetryTiers tells whether retry tier delays are positive, whole
+// seconds, and ascending.
+func isValidRetryTiers(tiers []time.Duration) bool {
+	for i, delay := range tiers {
+		if delay < time.Second || delay%time.Second != 0 {
+			return false
+		}
+		if i > 0 && delay <= tiers[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidInitialOffset(initialOffset string) bool {
+	return initialOffset == InitialOffsetNewest || initialOffset == InitialOffsetOldest
+}
+
 func newApp() *App {
 	appCfg := &App{}
 	appCfg.GRPCAddr = "0.0.0.0:19091"
 	appCfg.TCPAddr = "0.0.0.0:19092"
 	appCfg.Proxies = make(map[string]*Proxy)
+	appCfg.HMAC.MaxClockSkew = 5 * time.Minute
+	appCfg.LogSampling.FailedRequests = 1
+	appCfg.LogSampling.ConsumerWarnings = 1
 	return appCfg
 }
 
@@ -231,16 +1329,58 @@ func defaultProxyWithClientID(clientID string) *Proxy {
 	c.ZooKeeper.SeedPeers = []string{"localhost:2181"}
 	c.Kafka.SeedPeers = []string{"localhost:9092"}
 
+	c.Startup.RetryBackOff = 5 * time.Second
+
+	c.Failover.HealthCheckInterval = 5 * time.Second
+	c.Failover.FailoverAfter = 30 * time.Second
+
 	c.Producer.ChannelBufferSize = 4096
 	c.Producer.ShutdownTimeout = 30 * time.Second
+	c.Producer.ValidationTimeout = 5 * time.Second
+	c.Producer.MaxSyncTimeout = time.Minute
+	c.Producer.MaxBatchSize = 1000
+	c.Producer.MaxMessageSize = 1000000
+	c.Producer.MaxBatchBytes = 16 << 20
+	c.Producer.Retry.Max = 6
+	c.Producer.Retry.Backoff = 10 * time.Second
+	c.Producer.Retry.BackoffJitter = 0.2
+	c.Producer.Retry.MaxResubmits = 3
 
 	c.Consumer.ChannelBufferSize = 64
 	c.Consumer.LongPollingTimeout = 3 * time.Second
+	c.Consumer.MaxBatchSize = 100
+	c.Consumer.TopicPatternRefresh = 30 * time.Second
 	c.Consumer.RegistrationTimeout = 20 * time.Second
 	c.Consumer.AckTimeout = 15 * time.Second
 	c.Consumer.BackOffTimeout = 500 * time.Millisecond
+	c.Consumer.FatalBackOffTimeout = 30 * time.Second
 	c.Consumer.RebalanceDelay = 250 * time.Millisecond
+	c.Consumer.GroupProtocol = GroupProtocolZooKeeper
+	c.Consumer.PartitionAssignment = PartitionAssignmentRange
+	c.Consumer.GroupSessionTimeout = 30 * time.Second
+	c.Consumer.RebalanceConcurrency = 32
+	c.Consumer.RebalanceHistorySize = 32
 	c.Consumer.OffsetsCommitInterval = 500 * time.Millisecond
+	c.Consumer.InitialOffset = InitialOffsetNewest
+
+	c.Accounting.Retention = 24 * time.Hour
+	c.Accounting.ExportInterval = time.Minute
+
+	c.HotPartitions.Window = 5 * time.Minute
+	c.HotPartitions.SkewFactor = 5
+	c.HotPartitions.MinRate = 1024
+	c.HotPartitions.CheckInterval = time.Minute
+
+	c.Tracing.MaxTraces = 1000
+
+	c.Events.BufferSize = 1000
+
+	c.Compression.MinSize = 1024
+
+	c.CORS.AllowedMethods = []string{"GET", "POST", "DELETE"}
+	c.CORS.AllowedHeaders = []string{"Content-Type"}
+	c.CORS.MaxAge = 10 * time.Minute
+	c.CORS.Listeners = []string{ListenerTCP}
 	return c
 }
 
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// EnricherDeadLetter is the name of the built-in enricher that decodes dead
+// letters, see `DeadLetter`. It replaces the key and the value of a message
+// with those of the failed message, and adds the failure details as fields.
+const EnricherDeadLetter = "dead_letter"
+
+// EnrichedMessage is a consumed message that is about to be returned to a
+// client, as seen by enrichers.
+type EnrichedMessage struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	// Computed fields returned along with the message. Values must be JSON
+	// serializable.
+	Fields map[string]interface{}
+}
+
+// Enricher defines an interface that applications embedding Kafka-Pixy can
+// implement to present application-level views of consumed messages, e.g. to
+// decode a known envelope, add a schema name, or decrypt values. Enrichers are
+// registered by name with `RegisterEnricher`, and applied to messages of
+// topics they are configured for, see `Consumer.Enrichers`. Implementations
+// must be safe for concurrent use.
+type Enricher interface {
+	// Enrich may replace the key and the value of a message, and add
+	// fields to it. Fields are initialized before the first enricher is
+	// called. If an error is returned, then the message is returned to the
+	// client as enriched by preceding enrichers with the error in the
+	// `enrichment_error` field.
+	Enrich(msg *EnrichedMessage) error
+}
+
+var (
+	enrichersMu sync.Mutex
+	enrichers   = map[string]Enricher{EnricherDeadLetter: deadLetterEnricher{}}
+)
+
+// RegisterEnricher makes an enricher available to be configured for topics
+// under the specified name. Registering an enricher with a name that already
+// has one replaces it, registering nil removes it.
+func RegisterEnricher(name string, e Enricher) {
+	enrichersMu.Lock()
+	defer enrichersMu.Unlock()
+	if e == nil {
+		delete(enrichers, name)
+		return
+	}
+	enrichers[name] = e
+}
+
+// GetEnricher returns an enricher registered with the specified name.
+func GetEnricher(name string) (Enricher, error) {
+	enrichersMu.Lock()
+	defer enrichersMu.Unlock()
+	e := enrichers[name]
+	if e == nil {
+		return nil, errors.Errorf("unknown enricher: %s", name)
+	}
+	return e, nil
+}
+
+// deadLetterEnricher implements `EnricherDeadLetter`.
+type deadLetterEnricher struct{}
+
+// implements `Enricher`.
+func (deadLetterEnricher) Enrich(msg *EnrichedMessage) error {
+	var dl DeadLetter
+	if err := json.Unmarshal(msg.Value, &dl); err != nil {
+		return errors.Wrap(err, "invalid dead letter")
+	}
+	msg.Key, msg.Value = dl.Key, dl.Value
+	msg.Fields["group"] = dl.Group
+	msg.Fields["topic"] = dl.Topic
+	msg.Fields["partition"] = dl.Partition
+	msg.Fields["offset"] = dl.Offset
+	msg.Fields["ack_timeouts"] = dl.AckTimeouts
+	msg.Fields["timestamp"] = dl.Timestamp
+	return nil
+}
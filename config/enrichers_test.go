@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type EnrichersSuite struct{}
+
+var _ = Suite(&EnrichersSuite{})
+
+func (s *EnrichersSuite) TearDownTest(c *C) {
+	RegisterEnricher("fake", nil)
+}
+
+type fakeEnricher struct{}
+
+func (fakeEnricher) Enrich(msg *EnrichedMessage) error {
+	msg.Fields["schema"] = "fake"
+	return nil
+}
+
+// Registered enrichers can be looked up by name, and registering nil removes
+// an enricher.
+func (s *EnrichersSuite) TestRegister(c *C) {
+	RegisterEnricher("fake", fakeEnricher{})
+
+	// When
+	e, err := GetEnricher("fake")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(e, Equals, fakeEnricher{})
+
+	// When
+	RegisterEnricher("fake", nil)
+	_, err = GetEnricher("fake")
+
+	// Then
+	c.Assert(err, ErrorMatches, "unknown enricher: fake")
+}
+
+// The dead letter enricher replaces the key and the value of a dead letter
+// with those of the failed message, and adds the failure details as fields.
+func (s *EnrichersSuite) TestDeadLetter(c *C) {
+	ts := time.Date(2016, 11, 3, 10, 15, 0, 0, time.UTC)
+	encoded, err := json.Marshal(DeadLetter{
+		Group: "g1", Topic: "foo", Partition: 3, Offset: 42,
+		Key: []byte("k"), Value: []byte("v"), AckTimeouts: 5, Timestamp: ts,
+	})
+	c.Assert(err, IsNil)
+	e, err := GetEnricher(EnricherDeadLetter)
+	c.Assert(err, IsNil)
+	msg := EnrichedMessage{Topic: "foo.dlq", Value: encoded, Fields: make(map[string]interface{})}
+
+	// When
+	err = e.Enrich(&msg)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(string(msg.Key), Equals, "k")
+	c.Assert(string(msg.Value), Equals, "v")
+	c.Assert(msg.Fields, DeepEquals, map[string]interface{}{
+		"group": "g1", "topic": "foo", "partition": int32(3), "offset": int64(42),
+		"ack_timeouts": 5, "timestamp": ts,
+	})
+}
+
+// A message that is not a dead letter cannot be enriched.
+func (s *EnrichersSuite) TestDeadLetterInvalid(c *C) {
+	e, err := GetEnricher(EnricherDeadLetter)
+	c.Assert(err, IsNil)
+	msg := EnrichedMessage{Topic: "foo.dlq", Value: []byte("bar"), Fields: make(map[string]interface{})}
+
+	// When
+	err = e.Enrich(&msg)
+
+	// Then
+	c.Assert(err, ErrorMatches, "invalid dead letter: .*")
+	c.Assert(string(msg.Value), Equals, "bar")
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// SecretsProvider resolves references to secrets kept outside of the
+// configuration file. A string value of any configuration parameter can be a
+// reference in form `<scheme>:<ref>`, where the scheme is the one the provider
+// is registered with, see `RegisterSecretsProvider`, and the format of the ref
+// is provider specific.
+type SecretsProvider interface {
+	// Secret returns the value of the secret referenced by the ref.
+	Secret(ref string) (string, error)
+}
+
+var (
+	secretsProvidersMu sync.Mutex
+	secretsProviders   = make(map[string]SecretsProvider)
+)
+
+// RegisterSecretsProvider makes string values that start with `<scheme>:` be
+// resolved by the provider whenever configuration is parsed. Registering a
+// provider for a scheme that already has one replaces it, registering nil
+// removes it. Values with a scheme that no provider is registered for are
+// taken literally.
+func RegisterSecretsProvider(scheme string, sp SecretsProvider) {
+	secretsProvidersMu.Lock()
+	defer secretsProvidersMu.Unlock()
+	if sp == nil {
+		delete(secretsProviders, scheme)
+		return
+	}
+	secretsProviders[scheme] = sp
+}
+
+// resolveSecrets returns YAML data where all secret references are replaced
+// with respective secret values. If there are no references, then the data is
+// returned as is.
+func resolveSecrets(data []byte) ([]byte, error) {
+	secretsProvidersMu.Lock()
+	defer secretsProvidersMu.Unlock()
+	if len(secretsProviders) == 0 {
+		return data, nil
+	}
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal(data, &items); err != nil {
+		return nil, errors.Wrap(err, "failed to parse config")
+	}
+	resolved, changed, err := resolveSecretsIn(items)
+	if err != nil || !changed {
+		return data, err
+	}
+	return yaml.Marshal(resolved)
+}
+
+// resolveSecretsIn recursively walks a parsed YAML value and replaces secret
+// references with secrets.
+func resolveSecretsIn(v interface{}) (interface{}, bool, error) {
+	switch v := v.(type) {
+	case string:
+		colonIdx := strings.Index(v, ":")
+		if colonIdx <= 0 {
+			return v, false, nil
+		}
+		sp := secretsProviders[v[:colonIdx]]
+		if sp == nil {
+			return v, false, nil
+		}
+		secret, err := sp.Secret(v[colonIdx+1:])
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "failed to resolve secret %s", v)
+		}
+		return secret, true, nil
+	case yaml.MapSlice:
+		changed := false
+		for i := range v {
+			resolved, itemChanged, err := resolveSecretsIn(v[i].Value)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i].Value = resolved
+			changed = changed || itemChanged
+		}
+		return v, changed, nil
+	case []interface{}:
+		changed := false
+		for i := range v {
+			resolved, itemChanged, err := resolveSecretsIn(v[i])
+			if err != nil {
+				return nil, false, err
+			}
+			v[i] = resolved
+			changed = changed || itemChanged
+		}
+		return v, changed, nil
+	}
+	return v, false, nil
+}
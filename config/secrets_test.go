@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type SecretsSuite struct{}
+
+var _ = Suite(&SecretsSuite{})
+
+func (s *SecretsSuite) TearDownTest(c *C) {
+	RegisterSecretsProvider("fake", nil)
+}
+
+type fakeSecretsProvider map[string]string
+
+func (fsp fakeSecretsProvider) Secret(ref string) (string, error) {
+	secret, ok := fsp[ref]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return secret, nil
+}
+
+// String values with a scheme of a registered provider are replaced with
+// secrets, and all others are taken literally.
+func (s *SecretsSuite) TestResolve(c *C) {
+	RegisterSecretsProvider("fake", fakeSecretsProvider{"hmac#k1": "s3cr3t: #1"})
+	data := []byte("" +
+		"hmac:\n" +
+		"  keys:\n" +
+		"    k1: fake:hmac#k1\n" +
+		"    k2: other:hmac#k2\n" +
+		"proxies:\n" +
+		"  bar:\n" +
+		"    kafka:\n" +
+		"      seed_peers:\n" +
+		"        - 192.168.19.2:9092\n")
+
+	// When
+	appCfg, err := FromYAML(data)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(appCfg.HMAC.Keys, DeepEquals, map[string]string{"k1": "s3cr3t: #1", "k2": "other:hmac#k2"})
+	c.Assert(appCfg.Proxies["bar"].Kafka.SeedPeers, DeepEquals, []string{"192.168.19.2:9092"})
+}
+
+// If a secret cannot be resolved then configuration fails to parse.
+func (s *SecretsSuite) TestResolveError(c *C) {
+	RegisterSecretsProvider("fake", fakeSecretsProvider{})
+	data := []byte("" +
+		"proxies:\n" +
+		"  bar:\n" +
+		"    kafka:\n" +
+		"      seed_peers:\n" +
+		"        - fake:missing\n")
+
+	// When
+	_, err := FromYAML(data)
+
+	// Then
+	c.Assert(err, ErrorMatches, `failed to resolve secrets: err=\(failed to resolve secret fake:missing: not found\)`)
+}
+
+// Proxies keep the order they are defined in when secrets are resolved, so
+// that the default proxy is still the first one.
+func (s *SecretsSuite) TestResolveProxyOrder(c *C) {
+	RegisterSecretsProvider("fake", fakeSecretsProvider{"peer": "192.168.19.2:9092"})
+	data := []byte("" +
+		"proxies:\n" +
+		"  zoo:\n" +
+		"    kafka:\n" +
+		"      seed_peers:\n" +
+		"        - fake:peer\n" +
+		"  bar:\n" +
+		"    kafka:\n" +
+		"      seed_peers:\n" +
+		"        - fake:peer\n")
+
+	// When
+	appCfg, err := FromYAML(data)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(appCfg.DefaultProxy, Equals, "zoo")
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultScheme is the scheme that HashiCorp Vault secret references are
+// expected to have, e.g. `vault:secret/kafka#password`.
+const VaultScheme = "vault"
+
+const vaultRequestTimeout = 10 * time.Second
+
+// vaultSecretsProvider reads secrets from a HashiCorp Vault server via its
+// HTTP API. A reference is a secret path followed by `#` and the name of a key
+// in the secret. Both versions of the key/value secrets engine are supported,
+// but note that with version 2 the path has to include the `data` segment,
+// e.g. `vault:secret/data/kafka#password`.
+//
+// implements `SecretsProvider`.
+type vaultSecretsProvider struct {
+	addr  string
+	token string
+	clt   *http.Client
+}
+
+// NewVaultSecretsProvider returns a secrets provider that reads secrets from a
+// Vault server at the specified address authenticating with the token. It is
+// to be registered with `VaultScheme`.
+func NewVaultSecretsProvider(addr, token string) SecretsProvider {
+	return &vaultSecretsProvider{
+		addr:  strings.TrimRight(addr, "/"),
+		token: token,
+		clt:   &http.Client{Timeout: vaultRequestTimeout},
+	}
+}
+
+// implements `SecretsProvider`.
+func (vsp *vaultSecretsProvider) Secret(ref string) (string, error) {
+	hashIdx := strings.LastIndex(ref, "#")
+	if hashIdx <= 0 || hashIdx == len(ref)-1 {
+		return "", errors.Errorf("reference must be in form <path>#<key>")
+	}
+	path, key := ref[:hashIdx], ref[hashIdx+1:]
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s", vsp.addr, path), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("X-Vault-Token", vsp.token)
+	res, err := vsp.clt.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read secret")
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil && res.StatusCode == http.StatusOK {
+		return "", errors.Wrap(err, "failed to parse secret")
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("failed to read secret: status=%d, errors=%v", res.StatusCode, body.Errors)
+	}
+	data := body.Data
+	// Key/value secrets engine version 2 wraps secret data in an envelope
+	// along with the version metadata.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", errors.Errorf("secret does not have key %s", key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
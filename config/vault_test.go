@@ -0,0 +1,73 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type VaultSuite struct {
+	srv *httptest.Server
+}
+
+var _ = Suite(&VaultSuite{})
+
+func (s *VaultSuite) SetUpTest(c *C) {
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "t0k3n" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/kafka":
+			w.Write([]byte(`{"data": {"password": "foo"}}`))
+		case "/v1/secret/data/kafka":
+			w.Write([]byte(`{"data": {"data": {"password": "bar"}, "metadata": {"version": 3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+}
+
+func (s *VaultSuite) TearDownTest(c *C) {
+	s.srv.Close()
+}
+
+// Secrets are read from both versions of the key/value secrets engine.
+func (s *VaultSuite) TestSecret(c *C) {
+	vsp := NewVaultSecretsProvider(s.srv.URL+"/", "t0k3n")
+
+	secret, err := vsp.Secret("secret/kafka#password")
+	c.Assert(err, IsNil)
+	c.Assert(secret, Equals, "foo")
+
+	secret, err = vsp.Secret("secret/data/kafka#password")
+	c.Assert(err, IsNil)
+	c.Assert(secret, Equals, "bar")
+}
+
+func (s *VaultSuite) TestSecretErrors(c *C) {
+	vsp := NewVaultSecretsProvider(s.srv.URL, "t0k3n")
+	for i, tc := range []struct {
+		ref string
+		err string
+	}{{
+		ref: "secret/kafka",
+		err: "reference must be in form <path>#<key>",
+	}, {
+		ref: "secret/kafka#user",
+		err: "secret does not have key user",
+	}, {
+		ref: "secret/foo#password",
+		err: `failed to read secret: status=404, errors=\[\]`,
+	}} {
+		_, err := vsp.Secret(tc.ref)
+		c.Assert(err, ErrorMatches, tc.err, Commentf("case #%d", i))
+	}
+
+	_, err := NewVaultSecretsProvider(s.srv.URL, "bad").Secret("secret/kafka#password")
+	c.Assert(err, ErrorMatches, `failed to read secret: status=403, errors=\[permission denied\]`)
+}
@@ -1,5 +1,20 @@
 package consumer
 
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/pkg/errors"
+)
+
+// ErrNotSubscribed is returned by `T.Heartbeat` if the topic is not consumed
+// on behalf of the group at the moment.
+var ErrNotSubscribed = errors.New("topic is not consumed via the proxy on behalf of the group")
+
+// ErrGroupNotConsumed is returned by `T.Rebalance` if no topic is consumed on
+// behalf of the group at the moment.
+var ErrGroupNotConsumed = errors.New("group is not consumed via the proxy")
+
 const (
 	// An event of this type should be sent to the message events channel
 	// when the message is offered to a client.
@@ -8,6 +23,16 @@ const (
 	// An event of this type should be sent to the message events channel
 	// when the message is acknowledged by a client.
 	ETAcked
+
+	// An event of this type should be sent to the message events channel
+	// when a client acknowledges all messages of the partition at or below
+	// the event offset at once.
+	ETAckedUpTo
+
+	// An event of this type should be sent to the message events channel
+	// when a client fails to process the message and wants it redelivered
+	// after the event delay, rather than after the ack timeout.
+	ETNacked
 )
 
 type T interface {
@@ -15,15 +40,77 @@ type T interface {
 	// specified consumer group. If there are no more new messages in the topic
 	// at the time of the request then it will block for
 	// `Config.Consumer.LongPollingTimeout`. If no new message is produced during
-	// that time, then `ErrRequestTimeout` is returned.
+	// that time, then `errs.ErrRequestTimeout` is returned.
 	//
 	// Note that during state transitions topic subscribe<->unsubscribe and
 	// consumer group register<->deregister the method may return either
-	// `ErrBufferOverflow` or `ErrRequestTimeout` even when there are messages
-	// available for consumption. In that case the user should back off a bit
-	// and then repeat the request.
+	// `errs.ErrTooManyRequests` or `errs.ErrRequestTimeout` even when there are
+	// messages available for consumption. In that case the user should back off
+	// a bit and then repeat the request.
 	Consume(group, topic string) (Message, error)
 
+	// ConsumeWithTimeout is the same as `Consume` except it blocks for at most
+	// the specified timeout instead of `Config.Consumer.LongPollingTimeout`,
+	// and the request is made on behalf of the specified client. When there
+	// are requests of several clients waiting for messages of a group/topic,
+	// then messages are distributed between clients in a round robin fashion.
+	// `Consume` requests are made on behalf of a client with an empty name.
+	//
+	// The topic stays subscribed to on behalf of the group for at least
+	// `subscriptionTTL` after the request, zero means
+	// `Config.Consumer.RegistrationTimeout`.
+	ConsumeWithTimeout(client, group, topic string, timeout, subscriptionTTL time.Duration) (Message, error)
+
+	// Heartbeat postpones unsubscribing from the topic and leaving the group,
+	// that happens if the topic has not been consumed on behalf of the group
+	// for `Config.Consumer.RegistrationTimeout`, as if a message has been
+	// consumed. It does not subscribe though, so `ErrNotSubscribed` is
+	// returned if the topic is not being consumed on behalf of the group.
+	Heartbeat(group, topic string) error
+
+	// Coordinators returns the current offset coordinator broker of every
+	// consumer group that has been consumed by this consumer.
+	Coordinators() []offsetmgr.CoordinatorStatus
+
+	// FetchErrors returns the number of errors that occurred while fetching
+	// messages from Kafka by error class, see `msgistream.ClassifyErr`.
+	FetchErrors() map[string]int64
+
+	// Brokers returns fetch request statistics of every broker that messages
+	// have been fetched from, by broker ID.
+	Brokers() map[int32]BrokerStat
+
+	// Clients returns the number of messages delivered to every client by
+	// group and topic, ordered by client, group, and topic.
+	Clients() []ClientStat
+
+	// Rebalances returns the most recent rebalancings of the specified
+	// consumer group as seen by this consumer, oldest first. At most
+	// `Config.Consumer.RebalanceHistorySize` rebalancings are kept per group.
+	Rebalances(group string) []Rebalance
+
+	// SetPaused pauses or resumes consumption of the topic by the group. While
+	// paused, no messages of the topic are offered to the group, and so
+	// fetching from Kafka stops as soon as buffers are full, but the group
+	// membership and the topic subscription are kept as long as consume
+	// requests keep coming, so pausing does not trigger a rebalancing.
+	SetPaused(group, topic string, paused bool)
+
+	// Paused returns paused topics by group.
+	Paused() map[string][]string
+
+	// Rebalance makes the consumer rebalance the group, even if neither group
+	// membership nor subscriptions have changed since the last rebalancing,
+	// e.g. to pick up partitions added to consumed topics. Only partitions
+	// assigned to this consumer are affected. `ErrGroupNotConsumed` is
+	// returned if no topic is being consumed on behalf of the group.
+	Rebalance(group string) error
+
+	// Assignments returns partitions assigned to this consumer by group and
+	// topic as of the last successful rebalancing of every group that is
+	// being consumed at the moment.
+	Assignments() map[string]map[string][]int32
+
 	// Stop sends a shutdown signal to all internal goroutines and blocks until
 	// they are stopped. It is guaranteed that all last consumed offsets of all
 	// consumer groups/topics are committed to Kafka before Consumer stops.
@@ -38,21 +125,107 @@ type Message struct {
 	Offset        int64
 	HighWaterMark int64
 	EventsCh      chan<- Event
+
+	// The number of times the message has been retried, if it is consumed
+	// from a retry topic, see `config.Consumer.RetryTiers`.
+	Retries int
+
+	// Fields computed by enrichers of the topic, see `config.Enricher`.
+	Fields map[string]interface{}
+}
+
+// BrokerStat is a snapshot of fetch statistics of a particular broker.
+type BrokerStat struct {
+	Addr    string `json:"addr"`
+	Fetches int64  `json:"fetches"`
+	Errors  int64  `json:"errors"`
+	// Total size of keys and values of all messages fetched from the broker.
+	Bytes        int64           `json:"bytes"`
+	AvgLatencyMs float64         `json:"avg_latency_ms"`
+	MaxLatencyMs float64         `json:"max_latency_ms"`
+	Partitions   []PartitionStat `json:"partitions"`
+}
+
+// PartitionStat is a number of bytes fetched from a particular partition, and
+// its share in the total number of bytes fetched from the broker.
+type PartitionStat struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Bytes     int64   `json:"bytes"`
+	Share     float64 `json:"share"`
+}
+
+// ClientStat is the number of messages of a topic delivered to a particular
+// client on behalf of a consumer group.
+type ClientStat struct {
+	Client    string `json:"client"`
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Delivered int64  `json:"delivered"`
+}
+
+const (
+	// Rebalancing was triggered because members joined or left the group.
+	RebalanceTriggerMembership = "membership"
+
+	// Rebalancing was triggered because group members subscribed to or
+	// unsubscribed from topics.
+	RebalanceTriggerSubscriptions = "subscriptions"
+
+	// Rebalancing was triggered, but subscriptions of group members are the
+	// same as they were at the previous rebalancing.
+	RebalanceTriggerUnchanged = "unchanged"
+
+	// Rebalancing was explicitly requested, and subscriptions of group
+	// members are the same as they were at the previous rebalancing.
+	RebalanceTriggerRequested = "requested"
+)
+
+// Rebalance describes a rebalancing of a consumer group as seen by a particular
+// group member, that is what partitions the member got and lost.
+type Rebalance struct {
+	StartedAt time.Time `json:"started_at"`
+	// One of the `RebalanceTrigger*` constants.
+	Trigger string `json:"trigger"`
+	// Group members as of the previous rebalancing and this one.
+	MembersBefore []string `json:"members_before"`
+	MembersAfter  []string `json:"members_after"`
+	// Partitions by topic that were assigned to and revoked from the member.
+	Assigned   map[string][]int32 `json:"assigned"`
+	Revoked    map[string][]int32 `json:"revoked"`
+	DurationMs float64            `json:"duration_ms"`
+	// Empty if rebalancing succeeded.
+	Error string `json:"error,omitempty"`
 }
 
 func Ack(offset int64) Event {
-	return Event{ETAcked, offset}
+	return Event{T: ETAcked, Offset: offset}
+}
+
+// AckWithMeta creates an ack event that makes the committed offset carry the
+// specified user metadata.
+func AckWithMeta(offset int64, meta string) Event {
+	return Event{T: ETAcked, Offset: offset, Meta: meta}
+}
+
+// AckUpTo creates an event that acknowledges all offered messages of a
+// partition with offsets at or below the specified one, and makes the
+// committed offset carry the specified user metadata.
+func AckUpTo(offset int64, meta string) Event {
+	return Event{T: ETAckedUpTo, Offset: offset, Meta: meta}
+}
+
+// Nack creates an event that makes an offered message due for redelivery
+// after the specified delay.
+func Nack(offset int64, delay time.Duration) Event {
+	return Event{T: ETNacked, Offset: offset, Delay: delay}
 }
 
 type Event struct {
 	T      eventType
 	Offset int64
+	Meta   string
+	Delay  time.Duration
 }
 
 type eventType int
-
-type (
-	ErrSetup           error
-	ErrTooManyRequests error
-	ErrRequestTimeout  error
-)
@@ -1,7 +1,8 @@
 package consumerimpl
 
 import (
-	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -10,7 +11,9 @@ import (
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/dispatcher"
 	"github.com/mailgun/kafka-pixy/consumer/groupcsm"
+	"github.com/mailgun/kafka-pixy/consumer/msgistream"
 	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/wvanbergen/kazoo-go"
 )
 
@@ -34,13 +37,28 @@ type t struct {
 	kafkaClt4OffsetMgrs  sarama.Client
 	kazooClt             *kazoo.Kazoo
 	offsetMgrF           offsetmgr.Factory
+	fetchErrStats        *msgistream.ErrStats
+	brokerStats          *msgistream.BrokerStats
+	rebalanceLog         *groupcsm.RebalanceLog
+	pauses               *groupcsm.Pauses
+	rebalanceRequests    *groupcsm.RebalanceRequests
+	assignments          *groupcsm.Assignments
+
+	deliveriesMu sync.Mutex
+	deliveries   map[clientStatID]int64
+}
+
+type clientStatID struct {
+	client string
+	group  string
+	topic  string
 }
 
 // Spawn creates a consumer instance with the specified configuration and
 // starts all its goroutines.
 func Spawn(namespace *actor.ID, cfg *config.Proxy) (*t, error) {
 	saramaCfg := sarama.NewConfig()
-	saramaCfg.ClientID = cfg.ClientID
+	saramaCfg.ClientID = cfg.KafkaClientID("")
 	saramaCfg.ChannelBufferSize = cfg.Consumer.ChannelBufferSize
 	saramaCfg.Consumer.Offsets.CommitInterval = 50 * time.Millisecond
 	saramaCfg.Consumer.Retry.Backoff = cfg.Consumer.BackOffTimeout
@@ -50,24 +68,29 @@ func Spawn(namespace *actor.ID, cfg *config.Proxy) (*t, error) {
 
 	kafkaClt4MsgIStreams, err := sarama.NewClient(cfg.Kafka.SeedPeers, saramaCfg)
 	if err != nil {
-		return nil, consumer.ErrSetup(fmt.Errorf("failed to create Kafka client for message streams: err=(%v)", err))
+		return nil, errs.Wrap(errs.ErrSetup, err, "failed to create Kafka client for message streams")
 	}
 	kafkaClt4OffsetMgrs, err := sarama.NewClient(cfg.Kafka.SeedPeers, saramaCfg)
 	if err != nil {
-		return nil, consumer.ErrSetup(fmt.Errorf("failed to create Kafka client for offset managers: err=(%v)", err))
+		return nil, errs.Wrap(errs.ErrSetup, err, "failed to create Kafka client for offset managers")
 	}
 
-	kazooCfg := kazoo.NewConfig()
-	kazooCfg.Chroot = cfg.ZooKeeper.Chroot
-	// ZooKeeper documentation says following about the session timeout: "The
-	// current (ZooKeeper) implementation requires that the timeout be a
-	// minimum of 2 times the tickTime (as set in the server configuration) and
-	// a maximum of 20 times the tickTime". The default tickTime is 2 seconds.
-	// See http://zookeeper.apache.org/doc/trunk/zookeeperProgrammers.html#ch_zkSessions
-	kazooCfg.Timeout = 15 * time.Second
-	kazooClt, err := kazoo.NewKazoo(cfg.ZooKeeper.SeedPeers, kazooCfg)
-	if err != nil {
-		return nil, consumer.ErrSetup(fmt.Errorf("failed to create kazoo.Kazoo: err=(%v)", err))
+	// With the Kafka group protocol groups are coordinated by the Kafka
+	// cluster, so there is no need to connect to ZooKeeper at all.
+	var kazooClt *kazoo.Kazoo
+	if cfg.Consumer.GroupProtocol != config.GroupProtocolKafka {
+		kazooCfg := kazoo.NewConfig()
+		kazooCfg.Chroot = cfg.ZooKeeper.Chroot
+		// ZooKeeper documentation says following about the session timeout:
+		// "The current (ZooKeeper) implementation requires that the timeout
+		// be a minimum of 2 times the tickTime (as set in the server
+		// configuration) and a maximum of 20 times the tickTime". The default
+		// tickTime is 2 seconds.
+		// See http://zookeeper.apache.org/doc/trunk/zookeeperProgrammers.html#ch_zkSessions
+		kazooCfg.Timeout = 15 * time.Second
+		if kazooClt, err = kazoo.NewKazoo(cfg.ZooKeeper.SeedPeers, kazooCfg); err != nil {
+			return nil, errs.Wrap(errs.ErrSetup, err, "failed to create kazoo.Kazoo")
+		}
 	}
 
 	offsetMgrFactory := offsetmgr.SpawnFactory(namespace, cfg, kafkaClt4OffsetMgrs)
@@ -79,6 +102,13 @@ func Spawn(namespace *actor.ID, cfg *config.Proxy) (*t, error) {
 		kafkaClt4OffsetMgrs:  kafkaClt4OffsetMgrs,
 		offsetMgrF:           offsetMgrFactory,
 		kazooClt:             kazooClt,
+		fetchErrStats:        msgistream.NewErrStats(),
+		brokerStats:          msgistream.NewBrokerStats(),
+		rebalanceLog:         groupcsm.NewRebalanceLog(cfg.Consumer.RebalanceHistorySize),
+		pauses:               groupcsm.NewPauses(),
+		rebalanceRequests:    groupcsm.NewRebalanceRequests(),
+		assignments:          groupcsm.NewAssignments(),
+		deliveries:           make(map[clientStatID]int64),
 	}
 	c.dispatcher = dispatcher.New(c.namespace, c, c.cfg)
 	c.dispatcher.Start()
@@ -87,17 +117,116 @@ func Spawn(namespace *actor.ID, cfg *config.Proxy) (*t, error) {
 
 // implements `consumer.T`
 func (c *t) Consume(group, topic string) (consumer.Message, error) {
+	return c.ConsumeWithTimeout("", group, topic, c.cfg.Consumer.LongPollingTimeout, 0)
+}
+
+// implements `consumer.T`
+func (c *t) ConsumeWithTimeout(client, group, topic string, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
 	replyCh := make(chan dispatcher.Response, 1)
-	c.dispatcher.Requests() <- dispatcher.Request{time.Now().UTC(), group, topic, replyCh}
+	c.dispatcher.Requests() <- dispatcher.Request{
+		Timestamp:       time.Now(),
+		Group:           group,
+		Topic:           topic,
+		Timeout:         timeout,
+		ResponseCh:      replyCh,
+		Client:          client,
+		SubscriptionTTL: subscriptionTTL,
+	}
 	result := <-replyCh
+	if result.Err == nil {
+		c.deliveriesMu.Lock()
+		c.deliveries[clientStatID{client, group, topic}]++
+		c.deliveriesMu.Unlock()
+	}
 	return result.Msg, result.Err
 }
 
+// implements `consumer.T`
+func (c *t) Heartbeat(group, topic string) error {
+	replyCh := make(chan dispatcher.Response, 1)
+	c.dispatcher.Requests() <- dispatcher.Request{
+		Timestamp:  time.Now(),
+		Group:      group,
+		Topic:      topic,
+		ResponseCh: replyCh,
+		Heartbeat:  true,
+	}
+	result := <-replyCh
+	return result.Err
+}
+
+// implements `consumer.T`
+func (c *t) Coordinators() []offsetmgr.CoordinatorStatus {
+	return c.offsetMgrF.Coordinators()
+}
+
+// implements `consumer.T`
+func (c *t) FetchErrors() map[string]int64 {
+	return c.fetchErrStats.Counts()
+}
+
+// implements `consumer.T`
+func (c *t) Brokers() map[int32]consumer.BrokerStat {
+	return c.brokerStats.Snapshot()
+}
+
+// implements `consumer.T`
+func (c *t) Clients() []consumer.ClientStat {
+	c.deliveriesMu.Lock()
+	clients := make([]consumer.ClientStat, 0, len(c.deliveries))
+	for id, delivered := range c.deliveries {
+		clients = append(clients, consumer.ClientStat{
+			Client:    id.client,
+			Group:     id.group,
+			Topic:     id.topic,
+			Delivered: delivered,
+		})
+	}
+	c.deliveriesMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Client != clients[j].Client {
+			return clients[i].Client < clients[j].Client
+		}
+		if clients[i].Group != clients[j].Group {
+			return clients[i].Group < clients[j].Group
+		}
+		return clients[i].Topic < clients[j].Topic
+	})
+	return clients
+}
+
+// implements `consumer.T`
+func (c *t) Rebalances(group string) []consumer.Rebalance {
+	return c.rebalanceLog.Get(group)
+}
+
+// implements `consumer.T`
+func (c *t) SetPaused(group, topic string, paused bool) {
+	c.pauses.Set(group, topic, paused)
+}
+
+// implements `consumer.T`
+func (c *t) Paused() map[string][]string {
+	return c.pauses.List()
+}
+
+// implements `consumer.T`
+func (c *t) Rebalance(group string) error {
+	return c.rebalanceRequests.Request(group)
+}
+
+// implements `consumer.T`
+func (c *t) Assignments() map[string]map[string][]int32 {
+	return c.assignments.List()
+}
+
 // implements `consumer.T`
 func (c *t) Stop() {
 	c.dispatcher.Stop()
 	c.offsetMgrF.Stop()
-	c.kazooClt.Close()
+	if c.kazooClt != nil {
+		c.kazooClt.Close()
+	}
 	c.kafkaClt4OffsetMgrs.Close()
 	c.kafkaClt4MsgIStreams.Close()
 }
@@ -109,7 +238,7 @@ func (c *t) KeyOf(req dispatcher.Request) string {
 
 // implements `dispatcher.Factory`.
 func (c *t) NewTier(key string) dispatcher.Tier {
-	return groupcsm.New(c.namespace, key, c.cfg, c.kafkaClt4MsgIStreams, c.kazooClt, c.offsetMgrF)
+	return groupcsm.New(c.namespace, key, c.cfg, c.kafkaClt4MsgIStreams, c.kazooClt, c.offsetMgrF, c.fetchErrStats, c.brokerStats, c.rebalanceLog, c.pauses, c.rebalanceRequests, c.assignments)
 }
 
 // String returns a string ID of this instance to be used in logs.
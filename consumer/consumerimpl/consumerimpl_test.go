@@ -13,6 +13,7 @@ import (
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
 	"github.com/mailgun/kafka-pixy/consumer/partitioncsm"
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
 	"github.com/mailgun/log"
@@ -67,7 +68,7 @@ func (s *ConsumerSuite) TestInitialOffsetTooLarge(c *C) {
 	_, err = sc.Consume("g1", "test.1")
 
 	// Then
-	c.Assert(err, FitsTypeOf, consumer.ErrRequestTimeout(fmt.Errorf("")))
+	c.Assert(errs.Is(err, errs.ErrRequestTimeout), Equals, true, Commentf("err=%v", err))
 
 	produced := s.kh.PutMessages("offset-too-large", "test.1", map[string]int{"key": 1})
 	consumed := s.consume(c, sc, "g1", "test.1", 1)
@@ -222,7 +223,7 @@ func (s *ConsumerSuite) TestTooFewPartitions(c *C) {
 	// Then: `consumer-2` request times out, when `consumer-1` requests keep
 	// return messages.
 	log.Infof("*** THEN")
-	if _, ok := err.(consumer.ErrRequestTimeout); !ok {
+	if !errs.Is(err, errs.ErrRequestTimeout) {
 		c.Errorf("Expected ErrConsumerRequestTimeout, got %s", err)
 	}
 	s.consume(c, sc1, "g1", "test.1", 1, consumed)
@@ -445,7 +446,7 @@ func (s *ConsumerSuite) TestTooManyRequestsError(c *C) {
 			defer wg.Done()
 			for i := 0; i < 10; i++ {
 				_, err := sc.Consume("g1", "test.1")
-				if _, ok := err.(consumer.ErrTooManyRequests); ok {
+				if errs.Is(err, errs.ErrTooManyRequests) {
 					c.Assert(err.Error(), Equals, "Too many requests. Consider increasing `consumer.channel_buffer_size` (https://github.com/mailgun/kafka-pixy/blob/master/default.yaml#L43)")
 					atomic.AddInt32(&tooManyRequestsCount, 1)
 				}
@@ -473,7 +474,7 @@ func (s *ConsumerSuite) TestInvalidTopic(c *C) {
 	_, err = sc.Consume("g1", "no-such-topic")
 
 	// Then
-	if _, ok := err.(consumer.ErrRequestTimeout); !ok {
+	if !errs.Is(err, errs.ErrRequestTimeout) {
 		c.Errorf("ErrConsumerRequestTimeout is expected")
 	}
 }
@@ -490,7 +491,7 @@ func (s *ConsumerSuite) TestLotsOfPartitions(c *C) {
 
 	// Consume should stop by timeout and nothing should be consumed.
 	msg, err := sc.Consume("g1", "test.64")
-	if _, ok := err.(consumer.ErrRequestTimeout); !ok {
+	if !errs.Is(err, errs.ErrRequestTimeout) {
 		c.Fatalf("Unexpected message consumed: %v", msg)
 	}
 	s.kh.PutMessages("lots", "test.64", map[string]int{"A": 7, "B": 13, "C": 169})
@@ -521,7 +522,7 @@ func (s *ConsumerSuite) TestNewGroup(c *C) {
 	// The very first consumption of a group is terminated by timeout because
 	// the default offset is the topic head.
 	msg, err := sc.Consume(group, "test.1")
-	if _, ok := err.(consumer.ErrRequestTimeout); !ok {
+	if !errs.Is(err, errs.ErrRequestTimeout) {
 		c.Fatalf("Unexpected message consumed: %v", msg)
 	}
 
@@ -572,7 +573,7 @@ func (s *ConsumerSuite) TestTopicTimeout(c *C) {
 	consumedTest4ByCons1 := s.consume(c, cons1, "g1", "test.4", 1)
 	c.Assert(len(consumedTest4ByCons1["B"]), Equals, 1)
 	_, err = cons2.Consume("g1", "test.1")
-	c.Assert(err, FitsTypeOf, consumer.ErrRequestTimeout(fmt.Errorf("")))
+	c.Assert(errs.Is(err, errs.ErrRequestTimeout), Equals, true, Commentf("err=%v", err))
 
 	delay := (5000 * time.Millisecond) - time.Now().Sub(start)
 	log.Infof("*** sleeping for %v", delay)
@@ -582,7 +583,7 @@ func (s *ConsumerSuite) TestTopicTimeout(c *C) {
 	consumedTest4ByCons1 = s.consume(c, cons1, "g1", "test.4", 1, consumedTest4ByCons1)
 	c.Assert(len(consumedTest4ByCons1["B"]), Equals, 2)
 	_, err = cons2.Consume("g1", "test.1")
-	c.Assert(err, FitsTypeOf, consumer.ErrRequestTimeout(fmt.Errorf("")))
+	c.Assert(errs.Is(err, errs.ErrRequestTimeout), Equals, true, Commentf("err=%v", err))
 
 	// When: wait for the cons1 subscription to test.1 topic to expire.
 	log.Infof("*** WHEN")
@@ -620,7 +621,7 @@ func (s *ConsumerSuite) consume(c *C, sc *t, group, topic string, count int,
 	}
 	for i := 0; i != count; i++ {
 		msg, err := sc.Consume(group, topic)
-		if _, ok := err.(consumer.ErrRequestTimeout); ok {
+		if errs.Is(err, errs.ErrRequestTimeout) {
 			if count == consumeAll {
 				return consumed
 			}
@@ -1,13 +1,13 @@
 package dispatcher
 
 import (
-	"errors"
 	"sync"
 	"time"
 
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/mailgun/log"
 )
 
@@ -32,7 +32,23 @@ type Request struct {
 	Timestamp  time.Time
 	Group      string
 	Topic      string
+	Timeout    time.Duration
 	ResponseCh chan<- Response
+
+	// Client identifies the application instance that made the request.
+	// Waiting requests of different clients are served in a round robin
+	// fashion, so that one aggressive client cannot monopolize the messages.
+	Client string
+
+	// Heartbeat requests do not consume messages, they only keep tiers that
+	// they are dispatched through from expiring. A heartbeat is replied to
+	// with `consumer.ErrNotSubscribed` if there is no tier to dispatch it to.
+	Heartbeat bool
+
+	// SubscriptionTTL is for how long tiers that the request is dispatched
+	// through are kept alive after it, unless other requests made them live
+	// longer. Zero means `Config.Consumer.RegistrationTimeout`.
+	SubscriptionTTL time.Duration
 }
 
 type Response struct {
@@ -72,12 +88,14 @@ type Tier interface {
 // as soon as the original tier is stopped the successor is started to take its
 // place.
 type expiringTier struct {
-	d         *T
-	factory   Factory
-	instance  Tier
-	successor Tier
-	timer     *time.Timer
-	expired   bool
+	d            *T
+	factory      Factory
+	instance     Tier
+	successor    Tier
+	successorTTL time.Duration
+	timer        *time.Timer
+	expiresAt    time.Time
+	expired      bool
 }
 
 func New(namespace *actor.ID, factory Factory, cfg *config.Proxy) *T {
@@ -115,6 +133,10 @@ func (d *T) run() {
 			if !ok {
 				goto done
 			}
+			if req.Heartbeat {
+				d.handleHeartbeat(req)
+				continue
+			}
 			dt := d.resolveTier(req)
 			// If the requests buffer is full then either the callers are
 			// pulling too aggressively or the Kafka is experiencing issues.
@@ -123,7 +145,7 @@ func (d *T) run() {
 			select {
 			case dt.Requests() <- req:
 			default:
-				overflowErr := consumer.ErrTooManyRequests(errors.New("Too many requests. Consider increasing `consumer.channel_buffer_size` (https://github.com/mailgun/kafka-pixy/blob/master/default.yaml#L43)"))
+				overflowErr := errs.New(errs.ErrTooManyRequests, "Too many requests. Consider increasing `consumer.channel_buffer_size` (https://github.com/mailgun/kafka-pixy/blob/master/default.yaml#L43)")
 				req.ResponseCh <- Response{Err: overflowErr}
 			}
 
@@ -152,15 +174,15 @@ done:
 	}
 }
 
-func (d *T) newExpiringTier(parent Factory, key string) *expiringTier {
+func (d *T) newExpiringTier(parent Factory, key string, ttl time.Duration) *expiringTier {
 	dt := parent.NewTier(key)
 	dt.Start(d.stoppedChildrenCh)
-	timeout := d.cfg.Consumer.RegistrationTimeout
 	et := &expiringTier{
-		d:        d,
-		factory:  parent,
-		instance: dt,
-		timer:    time.AfterFunc(timeout, func() { d.expiredChildrenCh <- dt }),
+		d:         d,
+		factory:   parent,
+		instance:  dt,
+		timer:     time.AfterFunc(ttl, func() { d.expiredChildrenCh <- dt }),
+		expiresAt: time.Now().Add(ttl),
 	}
 	return et
 }
@@ -172,20 +194,68 @@ func (d *T) newExpiringTier(parent Factory, key string) *expiringTier {
 // and returned.
 func (d *T) resolveTier(req Request) Tier {
 	childKey := d.factory.KeyOf(req)
+	ttl := d.subscriptionTTL(req)
 	et := d.children[childKey]
 	if et == nil {
-		et = d.newExpiringTier(d.factory, childKey)
+		et = d.newExpiringTier(d.factory, childKey, ttl)
 		d.children[childKey] = et
 	}
-	if !et.expired && et.timer.Reset(et.d.cfg.Consumer.RegistrationTimeout) {
+	if et.prolong(ttl) {
 		return et.instance
 	}
 	if et.successor == nil {
 		et.successor = et.factory.NewTier(et.instance.Key())
 	}
+	if ttl > et.successorTTL {
+		et.successorTTL = ttl
+	}
 	return et.successor
 }
 
+// subscriptionTTL returns for how long tiers should be kept alive after the
+// specified request.
+func (d *T) subscriptionTTL(req Request) time.Duration {
+	if req.SubscriptionTTL > 0 {
+		return req.SubscriptionTTL
+	}
+	return d.cfg.Consumer.RegistrationTimeout
+}
+
+// prolong postpones expiration of the tier instance, so that it expires no
+// sooner than `ttl` from now. It returns false if the instance has already
+// expired.
+func (et *expiringTier) prolong(ttl time.Duration) bool {
+	if et.expired {
+		return false
+	}
+	expiresAt := time.Now().Add(ttl)
+	if expiresAt.Before(et.expiresAt) {
+		// The timer has not fired yet, for it is due at `et.expiresAt`.
+		return true
+	}
+	if !et.timer.Reset(ttl) {
+		return false
+	}
+	et.expiresAt = expiresAt
+	return true
+}
+
+// handleHeartbeat postpones expiration of the downstream dispatch tier that
+// the heartbeat request resolves to, and forwards the request to it. Unlike
+// consume requests heartbeats never cause creation of a tier.
+func (d *T) handleHeartbeat(req Request) {
+	et := d.children[d.factory.KeyOf(req)]
+	if et == nil || !et.prolong(d.subscriptionTTL(req)) {
+		req.ResponseCh <- Response{Err: consumer.ErrNotSubscribed}
+		return
+	}
+	select {
+	case et.instance.Requests() <- req:
+	default:
+		req.ResponseCh <- Response{Err: errs.New(errs.ErrTooManyRequests, "Too many requests")}
+	}
+}
+
 // handleExpired marks the respective dispatch tier as expired and triggers its
 // asynchronous stop. When the tier is stopped it will notify about that via the
 // `stoppedChildrenCh` channel.
@@ -218,7 +288,9 @@ func (d *T) handleStopped(dt Tier) Tier {
 	et.instance = successor
 	et.successor = nil
 	successor.Start(et.d.stoppedChildrenCh)
-	timeout := et.d.cfg.Consumer.RegistrationTimeout
+	timeout := et.successorTTL
+	et.successorTTL = 0
 	et.timer = time.AfterFunc(timeout, func() { et.d.expiredChildrenCh <- successor })
+	et.expiresAt = time.Now().Add(timeout)
 	return et.instance
 }
@@ -0,0 +1,64 @@
+package groupcsm
+
+import (
+	"sync"
+)
+
+// Assignments keeps partitions assigned to group consumers by the last
+// successful rebalancing of their groups. It can be shared by several group
+// consumers. A nil instance keeps nothing.
+type Assignments struct {
+	mu      sync.Mutex
+	byGroup map[string]assignment
+}
+
+type assignment struct {
+	owner      *T
+	partitions map[string][]int32
+}
+
+// NewAssignments creates a registry with no assignments.
+func NewAssignments() *Assignments {
+	return &Assignments{byGroup: make(map[string]assignment)}
+}
+
+// List returns assigned partitions by group and topic.
+func (as *Assignments) List() map[string]map[string][]int32 {
+	assigned := make(map[string]map[string][]int32)
+	if as == nil {
+		return assigned
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	for group, a := range as.byGroup {
+		topics := make(map[string][]int32, len(a.partitions))
+		for topic, partitions := range a.partitions {
+			topics[topic] = append([]int32(nil), partitions...)
+		}
+		assigned[group] = topics
+	}
+	return assigned
+}
+
+// set records partitions assigned to the group consumer.
+func (as *Assignments) set(gc *T, partitions map[string][]int32) {
+	if as == nil {
+		return
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.byGroup[gc.group] = assignment{owner: gc, partitions: partitions}
+}
+
+// clear forgets partitions assigned to the group consumer, unless they have
+// already been replaced by those of another group consumer of the group.
+func (as *Assignments) clear(gc *T) {
+	if as == nil {
+		return
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.byGroup[gc.group].owner == gc {
+		delete(as.byGroup, gc.group)
+	}
+}
@@ -0,0 +1,182 @@
+package groupcsm
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/mailgun/kafka-pixy/config"
+)
+
+// AssignPartitions divides partitions of topics consumed by a group among
+// group members subscribed to them, the same way every member of the group
+// assigns partitions to itself, and returns member -> topic -> partitions.
+// It lets partition ownership be resolved by those who are not group members,
+// e.g. for groups coordinated by Kafka where it is not recorded anywhere.
+func AssignPartitions(cfg *config.Proxy, partitions map[string][]int32, subscribers map[string][]string) map[string]map[string][]int32 {
+	return partitionAssignor(cfg).Assign(partitions, subscribers)
+}
+
+// partitionAssignor returns the partition assignor configured for the group
+// consumer: a custom one if an application embedding Kafka-Pixy provided it,
+// or otherwise the built-in one selected by `Consumer.PartitionAssignment`.
+func partitionAssignor(cfg *config.Proxy) config.PartitionAssignor {
+	if cfg.Consumer.PartitionAssignor != nil {
+		return cfg.Consumer.PartitionAssignor
+	}
+	switch cfg.Consumer.PartitionAssignment {
+	case config.PartitionAssignmentRoundRobin:
+		return roundRobinAssignor{}
+	case config.PartitionAssignmentSticky:
+		return stickyAssignor{}
+	}
+	return rangeAssignor{}
+}
+
+// rangeAssignor divides partitions of every topic into contiguous ranges, one
+// per member subscribed to the topic, see `assignTopicPartitions`. Members
+// that sort first get one partition more if partitions cannot be divided
+// evenly. When a member joins or leaves, range boundaries shift, so most
+// partitions of a topic can move to another member.
+//
+// implements `config.PartitionAssignor`.
+type rangeAssignor struct{}
+
+func (rangeAssignor) Assign(partitions map[string][]int32, subscribers map[string][]string) map[string]map[string][]int32 {
+	assigned := make(map[string]map[string][]int32)
+	for topic, topicPartitions := range partitions {
+		for member, memberPartitions := range assignTopicPartitions(topicPartitions, subscribers[topic]) {
+			addAssigned(assigned, member, topic, memberPartitions...)
+		}
+	}
+	return assigned
+}
+
+// roundRobinAssignor lays out partitions of all topics ordered by topic and
+// partition, and deals them to members one by one in the order of member IDs,
+// skipping members not subscribed to the topic of a partition. Unlike
+// `rangeAssignor` it spreads partitions of all topics evenly, so members that
+// sort first do not get an extra partition of every topic.
+//
+// implements `config.PartitionAssignor`.
+type roundRobinAssignor struct{}
+
+func (roundRobinAssignor) Assign(partitions map[string][]int32, subscribers map[string][]string) map[string]map[string][]int32 {
+	memberSet := make(map[string]bool)
+	subscribed := make(map[string]map[string]bool, len(subscribers))
+	for topic, members := range subscribers {
+		subscribed[topic] = make(map[string]bool, len(members))
+		for _, member := range members {
+			memberSet[member] = true
+			subscribed[topic][member] = true
+		}
+	}
+	members := make([]string, 0, len(memberSet))
+	for member := range memberSet {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	assigned := make(map[string]map[string][]int32)
+	next := 0
+	for _, topic := range sortedTopics(partitions) {
+		if len(subscribed[topic]) == 0 {
+			continue
+		}
+		for _, partition := range sortedPartitions(partitions[topic]) {
+			for !subscribed[topic][members[next%len(members)]] {
+				next++
+			}
+			addAssigned(assigned, members[next%len(members)], topic, partition)
+			next++
+		}
+	}
+	return assigned
+}
+
+// stickyAssignor assigns every partition to the member that ranks it highest
+// by a hash of the partition and the member ID (rendezvous hashing), as long
+// as the member does not get more than its fair share of partitions of the
+// topic. So when a member joins or leaves a group, only about as many
+// partitions as it gets or had move between members, rather than most of
+// them. Members cannot agree on assignments made by previous rebalancings, so
+// stickiness comes from the hashes rather than from the previous assignment.
+//
+// implements `config.PartitionAssignor`.
+type stickyAssignor struct{}
+
+func (stickyAssignor) Assign(partitions map[string][]int32, subscribers map[string][]string) map[string]map[string][]int32 {
+	assigned := make(map[string]map[string][]int32)
+	for topic, topicPartitions := range partitions {
+		members := subscribers[topic]
+		if len(members) == 0 {
+			continue
+		}
+		// Every member gets either `quota` or `quota+1` partitions, the
+		// latter only until `extra` members have got that many.
+		quota := len(topicPartitions) / len(members)
+		extra := len(topicPartitions) % len(members)
+		counts := make(map[string]int, len(members))
+		for _, partition := range sortedPartitions(topicPartitions) {
+			ranked := rankMembers(topic, partition, members)
+			for _, member := range ranked {
+				if counts[member] < quota || (counts[member] == quota && extra > 0) {
+					if counts[member] == quota {
+						extra--
+					}
+					counts[member]++
+					addAssigned(assigned, member, topic, partition)
+					break
+				}
+			}
+		}
+	}
+	for _, memberAssigned := range assigned {
+		for _, memberPartitions := range memberAssigned {
+			sort.Sort(Int32Slice(memberPartitions))
+		}
+	}
+	return assigned
+}
+
+// rankMembers returns members ordered by how high they rank a partition.
+func rankMembers(topic string, partition int32, members []string) []string {
+	ranked := append([]string(nil), members...)
+	scores := make(map[string]uint64, len(members))
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(topic + "/" + strconv.Itoa(int(partition)) + "/" + member))
+		scores[member] = h.Sum64()
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	return ranked
+}
+
+func addAssigned(assigned map[string]map[string][]int32, member, topic string, partitions ...int32) {
+	memberAssigned := assigned[member]
+	if memberAssigned == nil {
+		memberAssigned = make(map[string][]int32)
+		assigned[member] = memberAssigned
+	}
+	memberAssigned[topic] = append(memberAssigned[topic], partitions...)
+}
+
+func sortedTopics(partitions map[string][]int32) []string {
+	topics := make([]string, 0, len(partitions))
+	for topic := range partitions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func sortedPartitions(partitions []int32) []int32 {
+	sorted := append([]int32(nil), partitions...)
+	sort.Sort(Int32Slice(sorted))
+	return sorted
+}
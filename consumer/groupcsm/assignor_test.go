@@ -0,0 +1,114 @@
+package groupcsm
+
+import (
+	"fmt"
+
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+type AssignorSuite struct{}
+
+var _ = Suite(&AssignorSuite{})
+
+func (s *AssignorSuite) TestRange(c *C) {
+	assigned := rangeAssignor{}.Assign(
+		map[string][]int32{"t1": {2, 0, 1}, "t2": {0, 1, 2}},
+		map[string][]string{"t1": {"b", "a"}, "t2": {"a", "b", "c"}})
+
+	c.Assert(assigned, DeepEquals, map[string]map[string][]int32{
+		"a": {"t1": {0, 1}, "t2": {0}},
+		"b": {"t1": {2}, "t2": {1}},
+		"c": {"t2": {2}},
+	})
+}
+
+// Partitions of all topics are dealt to members one by one, skipping members
+// not subscribed to a topic.
+func (s *AssignorSuite) TestRoundRobin(c *C) {
+	assigned := roundRobinAssignor{}.Assign(
+		map[string][]int32{"t1": {2, 0, 1}, "t2": {0, 1, 2}, "t3": {0}},
+		map[string][]string{"t1": {"b", "a"}, "t2": {"a", "b", "c"}})
+
+	c.Assert(assigned, DeepEquals, map[string]map[string][]int32{
+		"a": {"t1": {0, 2}, "t2": {2}},
+		"b": {"t1": {1}, "t2": {0}},
+		"c": {"t2": {1}},
+	})
+}
+
+// Sticky assignments are balanced, and when a member joins far fewer
+// partitions move between the other members than with range assignment.
+func (s *AssignorSuite) TestSticky(c *C) {
+	partitions := make([]int32, 64)
+	for i := range partitions {
+		partitions[i] = int32(i)
+	}
+	members := []string{"a", "b", "c"}
+	before := stickyAssignor{}.Assign(map[string][]int32{"t1": partitions}, map[string][]string{"t1": members})
+
+	// When
+	after := stickyAssignor{}.Assign(map[string][]int32{"t1": partitions}, map[string][]string{"t1": append(members, "d")})
+
+	// Then
+	assertBalanced(c, before, partitions, 21, 22)
+	assertBalanced(c, after, partitions, 16, 16)
+	moved := 0
+	for _, member := range members {
+		kept := make(map[int32]bool)
+		for _, p := range after[member]["t1"] {
+			kept[p] = true
+		}
+		for _, p := range before[member]["t1"] {
+			if !kept[p] {
+				moved++
+			}
+		}
+	}
+	// Range assignment would move 40 partitions in this case.
+	c.Assert(moved < 24, Equals, true, Commentf("moved=%d", moved))
+}
+
+// All assignors return the same assignment whatever the order of input.
+func (s *AssignorSuite) TestDeterministic(c *C) {
+	for _, name := range []string{
+		config.PartitionAssignmentRange, config.PartitionAssignmentRoundRobin, config.PartitionAssignmentSticky,
+	} {
+		cfg := config.DefaultProxy()
+		cfg.Consumer.PartitionAssignment = name
+		assignor := partitionAssignor(cfg)
+		assigned1 := assignor.Assign(
+			map[string][]int32{"t1": {0, 1, 2, 3, 4}, "t2": {0, 1}},
+			map[string][]string{"t1": {"a", "b", "c"}, "t2": {"c", "a"}})
+		assigned2 := assignor.Assign(
+			map[string][]int32{"t2": {1, 0}, "t1": {4, 3, 2, 1, 0}},
+			map[string][]string{"t2": {"a", "c"}, "t1": {"c", "b", "a"}})
+		c.Assert(assigned1, DeepEquals, assigned2, Commentf("assignor=%s", name))
+		assertBalanced(c, assigned1, []int32{0, 1, 2, 3, 4}, 1, 2)
+	}
+}
+
+// A custom assignor provided by an embedding application takes precedence.
+func (s *AssignorSuite) TestCustom(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.PartitionAssignment = config.PartitionAssignmentSticky
+	cfg.Consumer.PartitionAssignor = roundRobinAssignor{}
+
+	c.Assert(partitionAssignor(cfg), Equals, roundRobinAssignor{})
+}
+
+// assertBalanced checks that every partition of topic `t1` is assigned to
+// exactly one member, and that members get between min and max of them.
+func assertBalanced(c *C, assigned map[string]map[string][]int32, partitions []int32, min, max int) {
+	owners := make(map[int32]string)
+	for member, topics := range assigned {
+		count := len(topics["t1"])
+		c.Assert(count >= min && count <= max, Equals, true, Commentf("member=%s, count=%d", member, count))
+		for _, p := range topics["t1"] {
+			_, ok := owners[p]
+			c.Assert(ok, Equals, false, Commentf("partition=%d", p))
+			owners[p] = member
+		}
+	}
+	c.Assert(len(owners), Equals, len(partitions), Commentf(fmt.Sprint(owners)))
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/dispatcher"
@@ -17,6 +18,8 @@ import (
 	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
 	"github.com/mailgun/kafka-pixy/consumer/partitioncsm"
 	"github.com/mailgun/kafka-pixy/consumer/topiccsm"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/events"
 	"github.com/mailgun/kafka-pixy/none"
 	"github.com/mailgun/log"
 	"github.com/wvanbergen/kazoo-go"
@@ -36,19 +39,31 @@ type T struct {
 	kafkaClt           sarama.Client
 	kazooClt           *kazoo.Kazoo
 	msgIStreamF        msgistream.Factory
+	fetchErrStats      *msgistream.ErrStats
+	brokerStats        *msgistream.BrokerStats
+	rebalanceLog       *RebalanceLog
+	pauses             *Pauses
+	rebalanceRequests  *RebalanceRequests
+	assignments        *Assignments
 	offsetMgrF         offsetmgr.Factory
-	groupMember        *groupmember.T
+	groupMember        groupmember.Member
 	multiplexers       map[string]*multiplexer.T
 	topicCsmLifespanCh chan *topiccsm.T
 	stopCh             chan none.T
 	wg                 sync.WaitGroup
 
+	// Partitions assigned to this group member by topic as of the last
+	// successful rebalancing.
+	assigned map[string][]int32
+
 	// Exist just to be overridden in tests with mocks.
 	fetchTopicPartitionsFn func(topic string) ([]int32, error)
 }
 
 func New(namespace *actor.ID, group string, cfg *config.Proxy, kafkaClt sarama.Client,
-	kazooClt *kazoo.Kazoo, offsetMgrF offsetmgr.Factory,
+	kazooClt *kazoo.Kazoo, offsetMgrF offsetmgr.Factory, fetchErrStats *msgistream.ErrStats,
+	brokerStats *msgistream.BrokerStats, rebalanceLog *RebalanceLog, pauses *Pauses,
+	rebalanceRequests *RebalanceRequests, assignments *Assignments,
 ) *T {
 	supervisorActorID := namespace.NewChild(fmt.Sprintf("G:%s", group))
 	gc := &T{
@@ -59,6 +74,12 @@ func New(namespace *actor.ID, group string, cfg *config.Proxy, kafkaClt sarama.C
 		kafkaClt:           kafkaClt,
 		kazooClt:           kazooClt,
 		offsetMgrF:         offsetMgrF,
+		fetchErrStats:      fetchErrStats,
+		brokerStats:        brokerStats,
+		rebalanceLog:       rebalanceLog,
+		pauses:             pauses,
+		rebalanceRequests:  rebalanceRequests,
+		assignments:        assignments,
 		multiplexers:       make(map[string]*multiplexer.T),
 		topicCsmLifespanCh: make(chan *topiccsm.T),
 		stopCh:             make(chan none.T),
@@ -95,12 +116,17 @@ func (gc *T) Start(stoppedCh chan<- dispatcher.Tier) {
 	actor.Spawn(gc.supActorID, &gc.wg, func() {
 		defer func() { stoppedCh <- gc }()
 		var err error
-		gc.msgIStreamF, err = msgistream.SpawnFactory(gc.supActorID, gc.kafkaClt)
+		gc.msgIStreamF, err = msgistream.SpawnFactory(gc.supActorID, gc.cfg, gc.kafkaClt, gc.fetchErrStats, gc.brokerStats)
 		if err != nil {
 			// Must never happen.
-			panic(consumer.ErrSetup(fmt.Errorf("failed to create sarama.Consumer: err=(%v)", err)))
+			panic(errs.Wrap(errs.ErrSetup, err, "failed to create sarama.Consumer"))
+		}
+		if gc.cfg.Consumer.GroupProtocol == config.GroupProtocolKafka {
+			gc.groupMember = groupmember.SpawnKafka(gc.supActorID, gc.group, gc.cfg.GroupMemberID(), gc.cfg, gc.kafkaClt, gc.offsetMgrF)
+		} else {
+			gc.groupMember = groupmember.Spawn(gc.supActorID, gc.group, gc.cfg.GroupMemberID(), gc.cfg, gc.kazooClt)
 		}
-		gc.groupMember = groupmember.Spawn(gc.supActorID, gc.group, gc.cfg.ClientID, gc.cfg, gc.kazooClt)
+		gc.emitEvent(events.TypeGroupJoined, "", nil)
 		var manageWg sync.WaitGroup
 		actor.Spawn(gc.mgrActorID, &manageWg, gc.runManager)
 		gc.dispatcher.Start()
@@ -110,6 +136,8 @@ func (gc *T) Start(stoppedCh chan<- dispatcher.Tier) {
 		gc.groupMember.Stop()
 		manageWg.Wait()
 		gc.msgIStreamF.Stop()
+		gc.assignments.clear(gc)
+		gc.emitEvent(events.TypeGroupLeft, "", nil)
 	})
 }
 
@@ -129,15 +157,19 @@ func (gc *T) runManager() {
 		topicConsumers        = make(map[string]*topiccsm.T)
 		topics                []string
 		subscriptions         map[string][]string
+		rebalancedSubs        map[string][]string
 		ok                    = true
 		nilOrRetryCh          <-chan time.Time
 		nilOrRegistryTopicsCh chan<- []string
 		rebalancingRequired   = false
+		rebalanceRequested    = false
 		rebalancingInProgress = false
 		retryScheduled        = false
 		stopped               = false
 		rebalanceResultCh     = make(chan error, 1)
+		rebalanceRequestCh    = gc.rebalanceRequests.register(gc.group)
 	)
+	defer gc.rebalanceRequests.unregister(gc.group, rebalanceRequestCh)
 	for {
 		select {
 		case tc := <-gc.topicCsmLifespanCh:
@@ -164,6 +196,15 @@ func (gc *T) runManager() {
 				continue
 			}
 			rebalancingRequired = true
+		case <-rebalanceRequestCh:
+			log.Infof("<%s> rebalancing requested", gc.mgrActorID)
+			// Until subscriptions are received for the first time there is
+			// nothing to rebalance, and then rebalancing happens anyway.
+			if subscriptions == nil {
+				continue
+			}
+			rebalancingRequired = true
+			rebalanceRequested = true
 		case err := <-rebalanceResultCh:
 			rebalancingInProgress = false
 			if err != nil {
@@ -171,7 +212,7 @@ func (gc *T) runManager() {
 				if stopped {
 					goto done
 				}
-				nilOrRetryCh = time.After(gc.cfg.Consumer.BackOffTimeout)
+				nilOrRetryCh = backoff.After(gc.cfg.Consumer.BackOffTimeout, gc.cfg.Consumer.BackOffJitter)
 				retryScheduled = true
 			}
 			if stopped {
@@ -190,12 +231,14 @@ func (gc *T) runManager() {
 			for topic, tc := range topicConsumers {
 				topicConsumersCopy[topic] = tc
 			}
-			subscriptions := subscriptions
+			subscriptions, prevSubscriptions, requested := subscriptions, rebalancedSubs, rebalanceRequested
 			actor.Spawn(actorID, nil, func() {
-				gc.runRebalancing(actorID, topicConsumersCopy, subscriptions, rebalanceResultCh)
+				gc.runRebalancing(actorID, topicConsumersCopy, prevSubscriptions, subscriptions, requested, rebalanceResultCh)
 			})
+			rebalancedSubs = subscriptions
 			rebalancingInProgress = true
 			rebalancingRequired = false
+			rebalanceRequested = false
 		}
 	}
 done:
@@ -211,10 +254,24 @@ done:
 }
 
 func (gc *T) runRebalancing(actorID *actor.ID, topicConsumers map[string]*topiccsm.T,
-	subscriptions map[string][]string, rebalanceResultCh chan<- error,
+	prevSubscriptions, subscriptions map[string][]string, requested bool, rebalanceResultCh chan<- error,
 ) {
+	begin := time.Now()
+	rebalance := consumer.Rebalance{
+		StartedAt:     begin,
+		Trigger:       rebalanceTrigger(prevSubscriptions, subscriptions),
+		MembersBefore: listMembers(prevSubscriptions),
+		MembersAfter:  listMembers(subscriptions),
+	}
+	if requested && rebalance.Trigger == consumer.RebalanceTriggerUnchanged {
+		rebalance.Trigger = consumer.RebalanceTriggerRequested
+	}
 	assignedPartitions, err := gc.resolvePartitions(subscriptions)
 	if err != nil {
+		rebalance.Error = err.Error()
+		rebalance.DurationMs = toMillis(time.Since(begin))
+		gc.rebalanceLog.add(gc.group, rebalance)
+		gc.emitRebalanced(rebalance)
 		rebalanceResultCh <- err
 		return
 	}
@@ -236,9 +293,9 @@ func (gc *T) runRebalancing(actorID *actor.ID, topicConsumers map[string]*topicc
 		topic := topic
 		spawnInFn := func(partition int32) multiplexer.In {
 			return partitioncsm.Spawn(gc.supActorID, gc.group, topic, partition,
-				gc.cfg, gc.groupMember, gc.msgIStreamF, gc.offsetMgrF)
+				gc.cfg, gc.groupMember, gc.msgIStreamF, gc.offsetMgrF, gc.pauses.get(gc.group, topic))
 		}
-		mux = multiplexer.New(gc.supActorID, spawnInFn)
+		mux = multiplexer.New(gc.supActorID, spawnInFn, gc.cfg.Consumer.RebalanceConcurrency)
 		gc.rewireMuxAsync(topic, &wg, mux, tc, assignedTopicPartitions)
 		gc.multiplexers[topic] = mux
 	}
@@ -249,11 +306,40 @@ func (gc *T) runRebalancing(actorID *actor.ID, topicConsumers map[string]*topicc
 			delete(gc.multiplexers, topic)
 		}
 	}
+	log.Infof("<%s> partition consumers rewired: took=%s", actorID, time.Since(begin))
+	rebalance.Assigned, rebalance.Revoked = diffPartitions(gc.assigned, assignedPartitions)
+	rebalance.DurationMs = toMillis(time.Since(begin))
+	gc.rebalanceLog.add(gc.group, rebalance)
+	gc.emitRebalanced(rebalance)
+	gc.assigned = assignedPartitions
+	gc.assignments.set(gc, assignedPartitions)
 	// Notify the caller that rebalancing has completed successfully.
 	rebalanceResultCh <- nil
 	return
 }
 
+// emitEvent notifies the event listener, if any, about an event of the group.
+func (gc *T) emitEvent(eventType, topic string, attrs map[string]interface{}) {
+	if listener := gc.cfg.Consumer.EventListener; listener != nil {
+		listener.OnEvent(eventType, gc.group, topic, attrs)
+	}
+}
+
+func (gc *T) emitRebalanced(rebalance consumer.Rebalance) {
+	attrs := map[string]interface{}{
+		"trigger":        rebalance.Trigger,
+		"members_before": rebalance.MembersBefore,
+		"members_after":  rebalance.MembersAfter,
+		"assigned":       rebalance.Assigned,
+		"revoked":        rebalance.Revoked,
+		"duration_ms":    rebalance.DurationMs,
+	}
+	if rebalance.Error != "" {
+		attrs["error"] = rebalance.Error
+	}
+	gc.emitEvent(events.TypeRebalanced, "", attrs)
+}
+
 // rewireMuxAsync calls muxInputs in another goroutine.
 func (gc *T) rewireMuxAsync(topic string, wg *sync.WaitGroup, mux *multiplexer.T, tc *topiccsm.T, assigned []int32) {
 	actor.Spawn(gc.supActorID.NewChild("rewire", topic), wg, func() {
@@ -268,7 +354,8 @@ func (gc *T) rewireMuxAsync(topic string, wg *sync.WaitGroup, mux *multiplexer.T
 }
 
 // resolvePartitions given topic subscriptions of all consumer group members,
-// resolves what topic partitions are assigned to the specified group member.
+// resolves what topic partitions are assigned to the specified group member
+// by the configured partition assignor.
 func (gc *T) resolvePartitions(subscriptions map[string][]string) (
 	map[string][]int32, error,
 ) {
@@ -279,20 +366,19 @@ func (gc *T) resolvePartitions(subscriptions map[string][]string) (
 			topicsToMembers[topic] = append(topicsToMembers[topic], groupMemberID)
 		}
 	}
-	// Create a set of topics this consumer group member subscribed to.
-	subscribedTopics := make(map[string]bool)
-	for _, topic := range subscriptions[gc.cfg.ClientID] {
-		subscribedTopics[topic] = true
-	}
-	// Resolve new partition assignments for all subscribed topics.
-	assignedPartitions := make(map[string][]int32)
-	for topic := range subscribedTopics {
+	// An assignor can take into account partitions of all topics consumed by
+	// the group, so they are fetched even if this member is not subscribed.
+	topicsToPartitions := make(map[string][]int32, len(topicsToMembers))
+	for _, topic := range sortedTopicKeys(topicsToMembers) {
 		topicPartitions, err := gc.fetchTopicPartitionsFn(topic)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get partition list: topic=%s, err=(%s)", topic, err)
 		}
-		subscribersToPartitions := assignTopicPartitions(topicPartitions, topicsToMembers[topic])
-		assignedTopicPartitions := subscribersToPartitions[gc.cfg.ClientID]
+		topicsToPartitions[topic] = topicPartitions
+	}
+	assignedPartitions := make(map[string][]int32)
+	assigned := AssignPartitions(gc.cfg, topicsToPartitions, topicsToMembers)
+	for topic, assignedTopicPartitions := range assigned[gc.cfg.GroupMemberID()] {
 		if len(assignedTopicPartitions) > 0 {
 			assignedPartitions[topic] = assignedTopicPartitions
 		}
@@ -335,6 +421,15 @@ func assignTopicPartitions(partitions []int32, subscribers []string) map[string]
 	return subscribersToPartitions
 }
 
+func sortedTopicKeys(topicsToMembers map[string][]string) []string {
+	topics := make([]string, 0, len(topicsToMembers))
+	for topic := range topicsToMembers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
 func listTopics(topicConsumers map[string]*topiccsm.T) []string {
 	topics := make([]string, 0, len(topicConsumers))
 	for topic := range topicConsumers {
@@ -2,10 +2,14 @@ package groupcsm
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/consumer/multiplexer"
+	"github.com/mailgun/kafka-pixy/events"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	. "gopkg.in/check.v1"
 )
@@ -161,3 +165,258 @@ func (s *GroupConsumerSuite) TestResolvePartitionsError(c *C) {
 	c.Assert(err.Error(), Equals, "failed to get partition list: topic=t1, err=(Kaboom!)")
 	c.Assert(topicsToPartitions, IsNil)
 }
+
+// Rebalancings are recorded along with partitions that were assigned to and
+// revoked from the group member, failed ones included.
+func (s *GroupConsumerSuite) TestRebalancingRecorded(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.ClientID = "c"
+	fetchErr := error(nil)
+	gc := T{
+		cfg:          cfg,
+		group:        "g",
+		rebalanceLog: NewRebalanceLog(10),
+		multiplexers: make(map[string]*multiplexer.T),
+		fetchTopicPartitionsFn: func(topic string) ([]int32, error) {
+			return []int32{1, 2, 3, 4}, fetchErr
+		},
+	}
+	resultCh := make(chan error, 1)
+	subs1 := map[string][]string{"c": {"t1"}}
+	subs2 := map[string][]string{"c": {"t1"}, "d": {"t1"}}
+
+	// When
+	gc.runRebalancing(s.ns, nil, nil, subs1, false, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	gc.runRebalancing(s.ns, nil, subs1, subs2, false, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	fetchErr = errors.New("Kaboom!")
+	gc.runRebalancing(s.ns, nil, subs2, subs2, false, resultCh)
+	c.Assert(<-resultCh, NotNil)
+
+	// Then
+	rebalances := gc.rebalanceLog.Get("g")
+	c.Assert(len(rebalances), Equals, 3)
+
+	c.Assert(rebalances[0].Trigger, Equals, consumer.RebalanceTriggerMembership)
+	c.Assert(rebalances[0].MembersBefore, DeepEquals, []string{})
+	c.Assert(rebalances[0].MembersAfter, DeepEquals, []string{"c"})
+	c.Assert(rebalances[0].Assigned, DeepEquals, map[string][]int32{"t1": {1, 2, 3, 4}})
+	c.Assert(rebalances[0].Revoked, DeepEquals, map[string][]int32{})
+
+	c.Assert(rebalances[1].Trigger, Equals, consumer.RebalanceTriggerMembership)
+	c.Assert(rebalances[1].MembersBefore, DeepEquals, []string{"c"})
+	c.Assert(rebalances[1].MembersAfter, DeepEquals, []string{"c", "d"})
+	c.Assert(rebalances[1].Assigned, DeepEquals, map[string][]int32{})
+	c.Assert(rebalances[1].Revoked, DeepEquals, map[string][]int32{"t1": {3, 4}})
+
+	c.Assert(rebalances[2].Trigger, Equals, consumer.RebalanceTriggerUnchanged)
+	c.Assert(rebalances[2].Error, Equals, "failed to get partition list: topic=t1, err=(Kaboom!)")
+}
+
+func (s *GroupConsumerSuite) TestRebalanceTrigger(c *C) {
+	for i, tc := range []struct {
+		before  map[string][]string
+		after   map[string][]string
+		trigger string
+	}{
+		/* 0 */ {nil, map[string][]string{"a": {"t1"}}, consumer.RebalanceTriggerMembership},
+		/* 1 */ {map[string][]string{"a": {"t1"}}, map[string][]string{"b": {"t1"}}, consumer.RebalanceTriggerMembership},
+		/* 2 */ {map[string][]string{"a": {"t1"}}, map[string][]string{"a": {"t1", "t2"}}, consumer.RebalanceTriggerSubscriptions},
+		/* 3 */ {map[string][]string{"a": {"t2", "t1"}}, map[string][]string{"a": {"t1", "t2"}}, consumer.RebalanceTriggerUnchanged},
+	} {
+		c.Assert(rebalanceTrigger(tc.before, tc.after), Equals, tc.trigger, Commentf("case #%d", i))
+	}
+}
+
+// Only the most recent rebalancings are kept for a group.
+func (s *GroupConsumerSuite) TestRebalanceLogSize(c *C) {
+	rl := NewRebalanceLog(2)
+
+	// When
+	for i := 0; i < 3; i++ {
+		rl.add("g1", consumer.Rebalance{Trigger: fmt.Sprintf("t%d", i)})
+	}
+
+	// Then
+	c.Assert(rl.Get("g1"), DeepEquals, []consumer.Rebalance{{Trigger: "t1"}, {Trigger: "t2"}})
+	c.Assert(rl.Get("g2"), DeepEquals, []consumer.Rebalance{})
+	c.Assert((*RebalanceLog)(nil).Get("g1"), DeepEquals, []consumer.Rebalance{})
+}
+
+// Pause switches are created on demand, and only switches that are on are
+// listed. Partition consumers watching a switch are notified of changes.
+func (s *GroupConsumerSuite) TestPauses(c *C) {
+	ps := NewPauses()
+	paused, changedCh := ps.get("g1", "t1").State()
+	c.Assert(paused, Equals, false)
+
+	// When
+	ps.Set("g1", "t1", true)
+	ps.Set("g1", "t2", true)
+	ps.Set("g2", "t1", true)
+	ps.Set("g2", "t1", false)
+
+	// Then
+	select {
+	case <-changedCh:
+	default:
+		c.Error("Change not notified")
+	}
+	paused, _ = ps.get("g1", "t1").State()
+	c.Assert(paused, Equals, true)
+	c.Assert(ps.List(), DeepEquals, map[string][]string{"g1": {"t1", "t2"}})
+	c.Assert((*Pauses)(nil).List(), DeepEquals, map[string][]string{})
+	paused, changedCh = (*Pauses)(nil).get("g1", "t1").State()
+	c.Assert(paused, Equals, false)
+	c.Assert(changedCh, IsNil)
+}
+
+// A requested rebalancing that does not coincide with membership or
+// subscription changes is recorded as such.
+func (s *GroupConsumerSuite) TestRebalancingRequested(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.ClientID = "c"
+	gc := T{
+		cfg:          cfg,
+		group:        "g",
+		rebalanceLog: NewRebalanceLog(10),
+		multiplexers: make(map[string]*multiplexer.T),
+		fetchTopicPartitionsFn: func(topic string) ([]int32, error) {
+			return []int32{1, 2}, nil
+		},
+	}
+	resultCh := make(chan error, 1)
+	subs1 := map[string][]string{"c": {"t1"}}
+	subs2 := map[string][]string{"c": {"t1"}, "d": {"t1"}}
+
+	// When
+	gc.runRebalancing(s.ns, nil, nil, subs1, true, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	gc.runRebalancing(s.ns, nil, subs1, subs1, true, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	gc.runRebalancing(s.ns, nil, subs1, subs2, true, resultCh)
+	c.Assert(<-resultCh, IsNil)
+
+	// Then
+	rebalances := gc.rebalanceLog.Get("g")
+	c.Assert(len(rebalances), Equals, 3)
+	c.Assert(rebalances[0].Trigger, Equals, consumer.RebalanceTriggerMembership)
+	c.Assert(rebalances[1].Trigger, Equals, consumer.RebalanceTriggerRequested)
+	c.Assert(rebalances[2].Trigger, Equals, consumer.RebalanceTriggerMembership)
+}
+
+// Rebalance requests are routed to the most recently registered channel of a
+// group, and pending requests are coalesced.
+func (s *GroupConsumerSuite) TestRebalanceRequests(c *C) {
+	rr := NewRebalanceRequests()
+	c.Assert(rr.Request("g1"), Equals, consumer.ErrGroupNotConsumed)
+	c.Assert((*RebalanceRequests)(nil).Request("g1"), Equals, consumer.ErrGroupNotConsumed)
+	staleCh := rr.register("g1")
+	requestCh := rr.register("g1")
+
+	// When
+	c.Assert(rr.Request("g1"), IsNil)
+	c.Assert(rr.Request("g1"), IsNil)
+
+	// Then
+	c.Assert(len(requestCh), Equals, 1)
+	c.Assert(len(staleCh), Equals, 0)
+	c.Assert(rr.Request("g2"), Equals, consumer.ErrGroupNotConsumed)
+
+	// When: a stale channel is unregistered, requests are still routed.
+	rr.unregister("g1", staleCh)
+	c.Assert(rr.Request("g1"), IsNil)
+	rr.unregister("g1", requestCh)
+
+	// Then
+	c.Assert(rr.Request("g1"), Equals, consumer.ErrGroupNotConsumed)
+}
+
+// Successful rebalancings update assignments, failed ones keep them as is.
+func (s *GroupConsumerSuite) TestAssignments(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.ClientID = "c"
+	fetchErr := error(nil)
+	gc := &T{
+		cfg:          cfg,
+		group:        "g",
+		assignments:  NewAssignments(),
+		multiplexers: make(map[string]*multiplexer.T),
+		fetchTopicPartitionsFn: func(topic string) ([]int32, error) {
+			return []int32{1, 2, 3, 4}, fetchErr
+		},
+	}
+	resultCh := make(chan error, 1)
+	subs1 := map[string][]string{"c": {"t1"}}
+	subs2 := map[string][]string{"c": {"t1"}, "d": {"t1"}}
+
+	// When
+	gc.runRebalancing(s.ns, nil, nil, subs1, false, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	gc.runRebalancing(s.ns, nil, subs1, subs2, false, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	fetchErr = errors.New("Kaboom!")
+	gc.runRebalancing(s.ns, nil, subs2, subs1, false, resultCh)
+	c.Assert(<-resultCh, NotNil)
+
+	// Then
+	c.Assert(gc.assignments.List(), DeepEquals, map[string]map[string][]int32{"g": {"t1": {1, 2}}})
+
+	// When: a stale group consumer clears assignments, they are kept.
+	gc.assignments.clear(&T{group: "g"})
+	c.Assert(len(gc.assignments.List()), Equals, 1)
+	gc.assignments.clear(gc)
+
+	// Then
+	c.Assert(gc.assignments.List(), DeepEquals, map[string]map[string][]int32{})
+	c.Assert((*Assignments)(nil).List(), DeepEquals, map[string]map[string][]int32{})
+}
+
+// Rebalancings are reported to the event listener, failed ones included.
+func (s *GroupConsumerSuite) TestRebalancingEmitted(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.ClientID = "c"
+	listener := &mockEventListener{}
+	cfg.Consumer.EventListener = listener
+	fetchErr := error(nil)
+	gc := T{
+		cfg:          cfg,
+		group:        "g",
+		multiplexers: make(map[string]*multiplexer.T),
+		fetchTopicPartitionsFn: func(topic string) ([]int32, error) {
+			return []int32{1, 2}, fetchErr
+		},
+	}
+	resultCh := make(chan error, 1)
+	subs := map[string][]string{"c": {"t1"}}
+
+	// When
+	gc.runRebalancing(s.ns, nil, nil, subs, false, resultCh)
+	c.Assert(<-resultCh, IsNil)
+	fetchErr = errors.New("Kaboom!")
+	gc.runRebalancing(s.ns, nil, subs, subs, false, resultCh)
+	c.Assert(<-resultCh, NotNil)
+
+	// Then
+	c.Assert(len(listener.events), Equals, 2)
+	c.Assert(listener.events[0].eventType, Equals, events.TypeRebalanced)
+	c.Assert(listener.events[0].group, Equals, "g")
+	c.Assert(listener.events[0].attrs["trigger"], Equals, consumer.RebalanceTriggerMembership)
+	c.Assert(listener.events[0].attrs["assigned"], DeepEquals, map[string][]int32{"t1": {1, 2}})
+	c.Assert(listener.events[0].attrs["error"], IsNil)
+	c.Assert(listener.events[1].attrs["error"], Equals, "failed to get partition list: topic=t1, err=(Kaboom!)")
+}
+
+type mockEvent struct {
+	eventType, group, topic string
+	attrs                   map[string]interface{}
+}
+
+type mockEventListener struct {
+	events []mockEvent
+}
+
+func (l *mockEventListener) OnEvent(eventType, group, topic string, attrs map[string]interface{}) {
+	l.events = append(l.events, mockEvent{eventType, group, topic, attrs})
+}
@@ -0,0 +1,69 @@
+package groupcsm
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/consumer/partitioncsm"
+)
+
+// Pauses keeps pause switches of group/topics. It can be shared by several
+// group consumers, and it outlives them, so that a group/topic stays paused
+// even if its consumer is disposed of due to inactivity. A nil instance never
+// pauses anything.
+type Pauses struct {
+	mu      sync.Mutex
+	byGroup map[string]map[string]*partitioncsm.Pause
+}
+
+// NewPauses creates a registry where nothing is paused.
+func NewPauses() *Pauses {
+	return &Pauses{byGroup: make(map[string]map[string]*partitioncsm.Pause)}
+}
+
+// Set pauses or resumes consumption of the topic by the group.
+func (ps *Pauses) Set(group, topic string, paused bool) {
+	if ps == nil {
+		return
+	}
+	ps.get(group, topic).Set(paused)
+}
+
+// List returns paused topics by group, topics are ordered by name.
+func (ps *Pauses) List() map[string][]string {
+	paused := make(map[string][]string)
+	if ps == nil {
+		return paused
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for group, topics := range ps.byGroup {
+		for topic, pause := range topics {
+			if ok, _ := pause.State(); ok {
+				paused[group] = append(paused[group], topic)
+			}
+		}
+		sort.Strings(paused[group])
+	}
+	return paused
+}
+
+// get returns the pause switch of the group/topic, creating it if necessary.
+func (ps *Pauses) get(group, topic string) *partitioncsm.Pause {
+	if ps == nil {
+		return nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	topics := ps.byGroup[group]
+	if topics == nil {
+		topics = make(map[string]*partitioncsm.Pause)
+		ps.byGroup[group] = topics
+	}
+	pause := topics[topic]
+	if pause == nil {
+		pause = partitioncsm.NewPause()
+		topics[topic] = pause
+	}
+	return pause
+}
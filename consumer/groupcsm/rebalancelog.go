@@ -0,0 +1,126 @@
+package groupcsm
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+)
+
+// RebalanceLog keeps the most recent rebalancings of every consumer group. It
+// can be shared by several group consumers, and it outlives them, so that the
+// history of a group survives disposal of its consumer due to inactivity. A
+// nil instance records nothing.
+type RebalanceLog struct {
+	mu      sync.Mutex
+	size    int
+	byGroup map[string][]consumer.Rebalance
+}
+
+// NewRebalanceLog creates a log that keeps at most `size` rebalancings per
+// group. If size is 0, then nothing is kept.
+func NewRebalanceLog(size int) *RebalanceLog {
+	return &RebalanceLog{size: size, byGroup: make(map[string][]consumer.Rebalance)}
+}
+
+// Get returns the most recent rebalancings of the group, oldest first.
+func (rl *RebalanceLog) Get(group string) []consumer.Rebalance {
+	if rl == nil {
+		return []consumer.Rebalance{}
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rebalances := rl.byGroup[group]
+	return append(make([]consumer.Rebalance, 0, len(rebalances)), rebalances...)
+}
+
+// add records a rebalancing of the group, forgetting the oldest one if the log
+// size is reached.
+func (rl *RebalanceLog) add(group string, rebalance consumer.Rebalance) {
+	if rl == nil || rl.size <= 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rebalances := rl.byGroup[group]
+	if len(rebalances) < rl.size {
+		rl.byGroup[group] = append(rebalances, rebalance)
+		return
+	}
+	copy(rebalances, rebalances[1:])
+	rebalances[len(rebalances)-1] = rebalance
+}
+
+// rebalanceTrigger tells why rebalancing is required given subscriptions of
+// group members as of the previous rebalancing and now.
+func rebalanceTrigger(before, after map[string][]string) string {
+	if !stringsEqual(listMembers(before), listMembers(after)) {
+		return consumer.RebalanceTriggerMembership
+	}
+	for member, topics := range after {
+		if !stringsEqual(sortedCopy(before[member]), sortedCopy(topics)) {
+			return consumer.RebalanceTriggerSubscriptions
+		}
+	}
+	return consumer.RebalanceTriggerUnchanged
+}
+
+// listMembers returns a sorted list of group members.
+func listMembers(subscriptions map[string][]string) []string {
+	members := make([]string, 0, len(subscriptions))
+	for member := range subscriptions {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// diffPartitions returns partitions by topic that are in `after` but not in
+// `before`, and the other way around.
+func diffPartitions(before, after map[string][]int32) (map[string][]int32, map[string][]int32) {
+	return subtractPartitions(after, before), subtractPartitions(before, after)
+}
+
+func subtractPartitions(from, what map[string][]int32) map[string][]int32 {
+	diff := make(map[string][]int32)
+	for topic, partitions := range from {
+		for _, p := range partitions {
+			if !hasPartition(what[topic], p) {
+				diff[topic] = append(diff[topic], p)
+			}
+		}
+	}
+	return diff
+}
+
+func hasPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func stringsEqual(lhs, rhs []string) bool {
+	if len(lhs) != len(rhs) {
+		return false
+	}
+	for i := range lhs {
+		if lhs[i] != rhs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
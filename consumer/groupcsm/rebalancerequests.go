@@ -0,0 +1,68 @@
+package groupcsm
+
+import (
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/none"
+)
+
+// RebalanceRequests routes requests to rebalance a consumer group to the group
+// consumer that is currently running for the group, if any. It can be shared
+// by several group consumers, and it outlives them. A nil instance routes
+// nothing.
+type RebalanceRequests struct {
+	mu      sync.Mutex
+	byGroup map[string]chan none.T
+}
+
+// NewRebalanceRequests creates a registry with no group consumers.
+func NewRebalanceRequests() *RebalanceRequests {
+	return &RebalanceRequests{byGroup: make(map[string]chan none.T)}
+}
+
+// Request makes the group consumer running for the group rebalance, even if
+// subscriptions of group members have not changed. It returns
+// `consumer.ErrGroupNotConsumed` if there is no such group consumer.
+func (rr *RebalanceRequests) Request(group string) error {
+	if rr == nil {
+		return consumer.ErrGroupNotConsumed
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	requestCh := rr.byGroup[group]
+	if requestCh == nil {
+		return consumer.ErrGroupNotConsumed
+	}
+	// Requests that come while one is pending are coalesced.
+	select {
+	case requestCh <- none.V:
+	default:
+	}
+	return nil
+}
+
+// register returns a channel that rebalance requests of the group are sent to.
+func (rr *RebalanceRequests) register(group string) <-chan none.T {
+	if rr == nil {
+		return nil
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	requestCh := make(chan none.T, 1)
+	rr.byGroup[group] = requestCh
+	return requestCh
+}
+
+// unregister stops routing rebalance requests of the group to the specified
+// channel, unless it has already been replaced by another one.
+func (rr *RebalanceRequests) unregister(group string, requestCh <-chan none.T) {
+	if rr == nil {
+		return
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if (<-chan none.T)(rr.byGroup[group]) == requestCh {
+		delete(rr.byGroup, group)
+	}
+}
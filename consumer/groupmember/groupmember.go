@@ -1,12 +1,14 @@
 package groupmember
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/none"
 	"github.com/mailgun/log"
@@ -19,6 +21,27 @@ import (
 // first several failures to claim a partition as an error.
 const safeClaimRetriesCount = 10
 
+// Member is a membership in a consumer group that partition consumption is
+// coordinated through. `T` implements it with ZooKeeper, and `Kafka` with the
+// group coordinator of the Kafka cluster.
+type Member interface {
+	// Topics returns a channel to receive a list of topics the member
+	// should subscribe to.
+	Topics() chan<- []string
+
+	// Subscriptions returns a channel that topic subscriptions of all group
+	// members, including this one, are sent down to whenever they change.
+	Subscriptions() <-chan map[string][]string
+
+	// ClaimPartition claims a topic partition to be consumed by the member.
+	// It blocks until either succeeds or canceled by the caller. It returns
+	// a function that should be called to release the claim.
+	ClaimPartition(claimerActorID *actor.ID, topic string, partition int32, cancelCh <-chan none.T) func()
+
+	// Stop makes the member leave the group.
+	Stop()
+}
+
 // T maintains a consumer group member registration in ZooKeeper, watches for
 // other members to join, leave and update their subscriptions, and generates
 // notifications of such changes.
@@ -34,8 +57,21 @@ type T struct {
 	subscriptionsCh  chan map[string][]string
 	stopCh           chan none.T
 	wg               sync.WaitGroup
+
+	// When members that left the group were first noticed missing. They
+	// are kept in subscriptions for a while if the member is static.
+	departedAt map[string]time.Time
+
+	// Members that registered as static, as of the last time they were seen
+	// in the group.
+	staticMembers map[string]bool
 }
 
+// Registration version of static members, that join groups with an instance
+// ID. Kazoo registrations do not have a field to tell that, and the version
+// is ignored by consumers of registrations.
+const staticRegVersion kazoo.RegVersion = kazoo.RegDefaultVersion + 1
+
 // Spawn creates a consumer group member instance and starts its background
 // goroutines.
 func Spawn(namespace *actor.ID, group, memberID string, cfg *config.Proxy, kazooClt *kazoo.Kazoo) *T {
@@ -50,6 +86,8 @@ func Spawn(namespace *actor.ID, group, memberID string, cfg *config.Proxy, kazoo
 		topicsCh:         make(chan []string),
 		subscriptionsCh:  make(chan map[string][]string),
 		stopCh:           make(chan none.T),
+		departedAt:       make(map[string]time.Time),
+		staticMembers:    make(map[string]bool),
 	}
 	actor.Spawn(gm.actorID, &gm.wg, gm.run)
 	return gm
@@ -84,7 +122,7 @@ func (gm *T) ClaimPartition(claimerActorID *actor.ID, topic string, partition in
 		logFailureFn("<%s> failed to claim partition: via=%s, retries=%d, took=%s, err=(%s)",
 			claimerActorID, gm.actorID, retries, millisSince(beginAt), err)
 		select {
-		case <-time.After(gm.cfg.Consumer.BackOffTimeout):
+		case <-backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter):
 		case <-cancelCh:
 			return func() {}
 		}
@@ -103,7 +141,7 @@ func (gm *T) ClaimPartition(claimerActorID *actor.ID, topic string, partition in
 			}
 			logFailureFn("<%s> failed to release partition: via=%s, retries=%d, took=%s, err=(%s)",
 				claimerActorID, gm.actorID, retries, millisSince(beginAt), err)
-			<-time.After(gm.cfg.Consumer.BackOffTimeout)
+			<-backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
 			err = gm.groupMemberZNode.ReleasePartition(topic, partition)
 		}
 		log.Infof("<%s> partition released: via=%s, retries=%d, took=%s",
@@ -126,7 +164,7 @@ func (gm *T) run() {
 	for err != nil {
 		log.Errorf("<%s> failed to create a group znode: err=(%s)", gm.actorID, err)
 		select {
-		case <-time.After(gm.cfg.Consumer.BackOffTimeout):
+		case <-backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter):
 		case <-gm.stopCh:
 			return
 		}
@@ -139,7 +177,7 @@ func (gm *T) run() {
 		err := gm.groupMemberZNode.Deregister()
 		for err != nil && err != kazoo.ErrInstanceNotRegistered {
 			log.Errorf("<%s> failed to deregister: err=(%s)", gm.actorID, err)
-			<-time.After(gm.cfg.Consumer.BackOffTimeout)
+			<-backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
 			err = gm.groupMemberZNode.Deregister()
 		}
 	}()
@@ -174,7 +212,7 @@ func (gm *T) run() {
 		if shouldSubmitTopics {
 			if err = gm.submitTopics(pendingTopics); err != nil {
 				log.Errorf("<%s> failed to submit topics: err=(%s)", gm.actorID, err)
-				nilOrTimeoutCh = time.After(gm.cfg.Consumer.BackOffTimeout)
+				nilOrTimeoutCh = backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
 				continue
 			}
 			log.Infof("<%s> submitted: topics=%v", gm.actorID, pendingTopics)
@@ -186,10 +224,27 @@ func (gm *T) run() {
 			members, nilOrGroupUpdatedCh, err = gm.groupZNode.WatchInstances()
 			if err != nil {
 				log.Errorf("<%s> failed to watch members: err=(%s)", gm.actorID, err)
-				nilOrTimeoutCh = time.After(gm.cfg.Consumer.BackOffTimeout)
+				nilOrTimeoutCh = backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
 				continue
 			}
 			shouldFetchMembers = false
+			// The registration may have been deleted behind our back, e.g.
+			// by an operator evicting the member from the group, and along
+			// with it partition claims. Then subscriptions without the member
+			// are reported right away to make it release all partitions, and
+			// the member registers again to get partitions assigned anew.
+			if gm.topics != nil && !hasMember(members, gm.groupMemberZNode.ID) {
+				log.Errorf("<%s> registration lost, re-registering: topics=%v", gm.actorID, gm.topics)
+				if pendingSubscriptions, err = gm.fetchSubscriptions(members); err != nil {
+					log.Errorf("<%s> failed to fetch subscriptions: err=(%s)", gm.actorID, err)
+					pendingSubscriptions = map[string][]string{}
+				}
+				nilOrSubscriptionsCh = gm.subscriptionsCh
+				pendingTopics, gm.topics = gm.topics, nil
+				shouldSubmitTopics = true
+				nilOrTimeoutCh = backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
+				continue
+			}
 			shouldFetchSubscriptions = true
 			// To avoid unnecessary rebalancing in case of a deregister/register
 			// sequences that happen when a member updates its topic subscriptions,
@@ -202,11 +257,17 @@ func (gm *T) run() {
 			pendingSubscriptions, err = gm.fetchSubscriptions(members)
 			if err != nil {
 				log.Errorf("<%s> failed to fetch subscriptions: err=(%s)", gm.actorID, err)
-				nilOrTimeoutCh = time.After(gm.cfg.Consumer.BackOffTimeout)
+				nilOrTimeoutCh = backoff.After(gm.cfg.Consumer.BackOffTimeout, gm.cfg.Consumer.BackOffJitter)
 				continue
 			}
 			shouldFetchSubscriptions = false
 			log.Infof("<%s> fetched subscriptions: %v", gm.actorID, pendingSubscriptions)
+			if wait := gm.holdDepartedMembers(pendingSubscriptions); wait > 0 {
+				log.Infof("<%s> waiting for members to come back: wait=%s, subscriptions=%v",
+					gm.actorID, wait, pendingSubscriptions)
+				shouldFetchSubscriptions = true
+				nilOrTimeoutCh = time.After(wait)
+			}
 			if subscriptionsEqual(pendingSubscriptions, gm.subscriptions) {
 				nilOrSubscriptionsCh = nil
 				pendingSubscriptions = nil
@@ -219,7 +280,7 @@ func (gm *T) run() {
 }
 
 // fetchSubscriptions retrieves registration records for the specified members
-// from ZooKeeper.
+// from ZooKeeper. It also remembers which of them are static.
 //
 // FIXME: It is assumed that all members of the group are registered with the
 // FIXME: `static` pattern. If a member that pattern is either `white_list` or
@@ -238,10 +299,50 @@ func (gm *T) fetchSubscriptions(members []*kazoo.ConsumergroupInstance) (map[str
 			topics = append(topics, topic)
 		}
 		subscriptions[member.ID] = normalizeTopics(topics)
+		gm.staticMembers[member.ID] = registration.Version == staticRegVersion
 	}
 	return subscriptions, nil
 }
 
+// holdDepartedMembers adds static members that have been reported before, but
+// are missing from the fetched subscriptions, back to them for up to the group
+// session timeout since they were first noticed missing. That gives static
+// members a chance to restart without other members rebalancing the group
+// twice. Dynamic members are never held, for they do not come back with the
+// same ID. It returns how long until the earliest hold expires, or zero if no
+// member is held.
+func (gm *T) holdDepartedMembers(subscriptions map[string][]string) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	for member, topics := range gm.subscriptions {
+		if _, ok := subscriptions[member]; ok || member == gm.groupMemberZNode.ID {
+			delete(gm.departedAt, member)
+			continue
+		}
+		if !gm.staticMembers[member] {
+			delete(gm.staticMembers, member)
+			continue
+		}
+		departedAt, ok := gm.departedAt[member]
+		if !ok {
+			departedAt = now
+			gm.departedAt[member] = now
+		}
+		remaining := gm.cfg.Consumer.GroupSessionTimeout - now.Sub(departedAt)
+		if remaining <= 0 {
+			log.Infof("<%s> member did not come back: member=%s", gm.actorID, member)
+			delete(gm.departedAt, member)
+			delete(gm.staticMembers, member)
+			continue
+		}
+		subscriptions[member] = topics
+		if wait == 0 || remaining < wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
 func (gm *T) submitTopics(topics []string) error {
 	if gm.topics != nil {
 		err := gm.groupMemberZNode.Deregister()
@@ -250,14 +351,36 @@ func (gm *T) submitTopics(topics []string) error {
 		}
 	}
 	gm.topics = nil
-	err := gm.groupMemberZNode.Register(topics)
-	for err != nil {
+	if err := gm.register(topics); err != nil {
 		return fmt.Errorf("failed to register: err=(%s)", err)
 	}
 	gm.topics = topics
 	return nil
 }
 
+// register registers the member with the topics in ZooKeeper. A static member
+// registers with `staticRegVersion`, so that other members can tell it from
+// dynamic ones.
+func (gm *T) register(topics []string) error {
+	if gm.cfg.Consumer.InstanceID == "" {
+		return gm.groupMemberZNode.Register(topics)
+	}
+	subscription := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		subscription[topic] = 1
+	}
+	data, err := json.Marshal(&kazoo.Registration{
+		Pattern:      kazoo.RegPatternStatic,
+		Subscription: subscription,
+		Timestamp:    time.Now().Unix(),
+		Version:      staticRegVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return gm.groupMemberZNode.RegisterWithSubscription(data)
+}
+
 func normalizeTopics(s []string) []string {
 	if s == nil || len(s) == 0 {
 		return nil
@@ -290,6 +413,15 @@ func subscriptionsEqual(lhs, rhs map[string][]string) bool {
 	return true
 }
 
+func hasMember(members []*kazoo.ConsumergroupInstance, memberID string) bool {
+	for _, member := range members {
+		if member.ID == memberID {
+			return true
+		}
+	}
+	return false
+}
+
 func millisSince(t time.Time) time.Duration {
 	return time.Now().Sub(t) / time.Millisecond * time.Millisecond
 }
@@ -43,6 +43,85 @@ func (s *GroupMemberSuite) TestNormalizeTopics(c *C) {
 	c.Assert(normalizeTopics([]string{"c", "a", "b"}), Not(DeepEquals), []string{"a", "b"})
 }
 
+// Members that left the group are kept in subscriptions for up to the group
+// session timeout since they were noticed missing.
+func (s *GroupMemberSuite) TestHoldDepartedMembers(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.InstanceID = "m1"
+	cfg.Consumer.GroupSessionTimeout = 200 * time.Millisecond
+	gm := &T{
+		cfg:              cfg,
+		groupMemberZNode: &kazoo.ConsumergroupInstance{ID: "m1"},
+		subscriptions:    map[string][]string{"m1": {"foo"}, "m2": {"foo"}, "m3": {"bar"}},
+		departedAt:       make(map[string]time.Time),
+		staticMembers:    map[string]bool{"m1": true, "m2": true, "m3": true},
+	}
+
+	// When
+	subscriptions := map[string][]string{"m1": {"foo"}, "m3": {"bar"}}
+	wait := gm.holdDepartedMembers(subscriptions)
+
+	// Then
+	c.Assert(subscriptions, DeepEquals, map[string][]string{"m1": {"foo"}, "m2": {"foo"}, "m3": {"bar"}})
+	c.Assert(wait > 100*time.Millisecond && wait <= 200*time.Millisecond, Equals, true, Commentf("wait=%s", wait))
+
+	// When: the hold expires
+	time.Sleep(wait)
+	subscriptions = map[string][]string{"m1": {"foo"}, "m3": {"bar"}}
+	wait = gm.holdDepartedMembers(subscriptions)
+
+	// Then
+	c.Assert(subscriptions, DeepEquals, map[string][]string{"m1": {"foo"}, "m3": {"bar"}})
+	c.Assert(wait, Equals, time.Duration(0))
+	c.Assert(gm.departedAt, DeepEquals, map[string]time.Time{})
+}
+
+// A member that comes back before the hold expires is not held anymore.
+func (s *GroupMemberSuite) TestHoldDepartedMembersBack(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.InstanceID = "m1"
+	gm := &T{
+		cfg:              cfg,
+		groupMemberZNode: &kazoo.ConsumergroupInstance{ID: "m1"},
+		subscriptions:    map[string][]string{"m1": {"foo"}, "m2": {"foo"}},
+		departedAt:       make(map[string]time.Time),
+		staticMembers:    map[string]bool{"m1": true, "m2": true},
+	}
+	gm.holdDepartedMembers(map[string][]string{"m1": {"foo"}})
+
+	// When
+	subscriptions := map[string][]string{"m1": {"foo"}, "m2": {"foo"}}
+	wait := gm.holdDepartedMembers(subscriptions)
+
+	// Then
+	c.Assert(subscriptions, DeepEquals, map[string][]string{"m1": {"foo"}, "m2": {"foo"}})
+	c.Assert(wait, Equals, time.Duration(0))
+	c.Assert(gm.departedAt, DeepEquals, map[string]time.Time{})
+}
+
+// Dynamic members are not held, even if the member itself is static, and they
+// are forgotten as soon as they leave.
+func (s *GroupMemberSuite) TestHoldDepartedMembersDynamic(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.InstanceID = "m1"
+	gm := &T{
+		cfg:              cfg,
+		groupMemberZNode: &kazoo.ConsumergroupInstance{ID: "m1"},
+		subscriptions:    map[string][]string{"m1": {"foo"}, "m2": {"foo"}, "m3": {"foo"}},
+		departedAt:       make(map[string]time.Time),
+		staticMembers:    map[string]bool{"m1": true, "m2": false, "m3": true},
+	}
+
+	// When
+	subscriptions := map[string][]string{"m1": {"foo"}}
+	wait := gm.holdDepartedMembers(subscriptions)
+
+	// Then
+	c.Assert(subscriptions, DeepEquals, map[string][]string{"m1": {"foo"}, "m3": {"foo"}})
+	c.Assert(wait > 0, Equals, true)
+	c.Assert(gm.staticMembers, DeepEquals, map[string]bool{"m1": true, "m3": true})
+}
+
 func (s *GroupMemberSuite) TestTopicsEqual(c *C) {
 	c.Assert(topicsEqual([]string{}, nil), Equals, true)
 	c.Assert(topicsEqual(nil, []string{}), Equals, true)
@@ -256,6 +335,29 @@ func (s *GroupMemberSuite) TestRedundantUpdateIgnored(c *C) {
 	}
 }
 
+// If the registration of a member is deleted behind its back, then it reports
+// subscriptions without itself, and registers again with the same topics.
+func (s *GroupMemberSuite) TestRegistrationLost(c *C) {
+	// Given
+	cfg := config.DefaultProxy()
+	cfg.Consumer.RebalanceDelay = 200 * time.Millisecond
+	cfg.Consumer.BackOffTimeout = 100 * time.Millisecond
+	gm1 := Spawn(s.ns.NewChild("m1"), "g1", "m1", cfg, s.kazooClt)
+	defer gm1.Stop()
+	gm1.Topics() <- []string{"foo", "bar"}
+	c.Assert(<-gm1.Subscriptions(), DeepEquals, map[string][]string{"m1": {"bar", "foo"}})
+
+	// When
+	c.Assert(s.kazooClt.Consumergroup("g1").Instance("m1").Deregister(), IsNil)
+
+	// Then
+	c.Assert(<-gm1.Subscriptions(), DeepEquals, map[string][]string{})
+	c.Assert(<-gm1.Subscriptions(), DeepEquals, map[string][]string{"m1": {"bar", "foo"}})
+	registered, err := s.kazooClt.Consumergroup("g1").Instance("m1").Registered()
+	c.Assert(err, IsNil)
+	c.Assert(registered, Equals, true)
+}
+
 // When a group registrator claims a topic partitions it becomes its owner.
 func (s *GroupMemberSuite) TestClaimPartition(c *C) {
 	// Given
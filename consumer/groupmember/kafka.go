@@ -0,0 +1,573 @@
+package groupmember
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Members join groups as regular Kafka consumers, so that groups can be
+	// inspected with standard Kafka tools.
+	protocolType = "consumer"
+
+	// Name of the assignment protocol. Kafka only lets members that support
+	// the same protocol into a group, so Kafka-Pixy does not share groups
+	// with other kinds of consumers.
+	protocolName = "kafka-pixy"
+)
+
+// Kafka maintains a consumer group membership with the group coordinator of the
+// Kafka cluster, and generates notifications when topic subscriptions of
+// group members change.
+//
+// Every member tells the topics it subscribes to along with its ID when it
+// joins the group. The member elected leader by the coordinator collects
+// subscriptions of all members and distributes them back to everybody, so
+// that each member can resolve its partitions the same way as if the group
+// were coordinated via ZooKeeper.
+//
+// implements `Member`.
+type Kafka struct {
+	actorID         *actor.ID
+	cfg             *config.Proxy
+	group           string
+	memberID        string
+	kafkaClt        sarama.Client
+	offsetMgrF      offsetmgr.Factory
+	topics          []string
+	subscriptions   map[string][]string
+	topicsCh        chan []string
+	subscriptionsCh chan map[string][]string
+	stopCh          chan none.T
+	wg              sync.WaitGroup
+
+	// Connection to the group coordinator, and the member of the current
+	// group generation as identified by the coordinator.
+	conn          *sarama.Broker
+	kafkaMemberID string
+	generationID  int32
+
+	// Number of partitions claimed by partition consumers, the member waits
+	// for them all to be released before it leaves or rejoins the group.
+	// Partitions can only be claimed while the member is in a settled
+	// generation, that is it has joined the group and does not have to
+	// rejoin it, and `settledCh` is closed.
+	claimsMu   sync.Mutex
+	claims     int
+	settled    bool
+	settledCh  chan none.T
+	releasedCh chan none.T
+}
+
+// SpawnKafka creates a consumer group member instance that joins the group via
+// the Kafka group coordinator, and starts its background goroutine. Offsets of the group are committed on behalf of the current
+// group generation through `offsetMgrF`.
+func SpawnKafka(namespace *actor.ID, group, memberID string, cfg *config.Proxy, kafkaClt sarama.Client, offsetMgrF offsetmgr.Factory) *Kafka {
+	km := &Kafka{
+		actorID:         namespace.NewChild("kafka_member"),
+		cfg:             cfg,
+		group:           group,
+		memberID:        memberID,
+		kafkaClt:        kafkaClt,
+		offsetMgrF:      offsetMgrF,
+		topicsCh:        make(chan []string),
+		subscriptionsCh: make(chan map[string][]string),
+		stopCh:          make(chan none.T),
+		generationID:    sarama.GroupGenerationUndefined,
+		settledCh:       make(chan none.T),
+		releasedCh:      make(chan none.T, 1),
+	}
+	actor.Spawn(km.actorID, &km.wg, km.run)
+	return km
+}
+
+// implements `Member`.
+func (km *Kafka) Topics() chan<- []string {
+	return km.topicsCh
+}
+
+// implements `Member`.
+func (km *Kafka) Subscriptions() <-chan map[string][]string {
+	return km.subscriptionsCh
+}
+
+// ClaimPartition blocks until the member is in a settled generation, see
+// `run`, or the claim is canceled. A member revokes all its partitions before
+// it rejoins the group, and claims are not granted until it has joined, so a
+// partition is never claimed by members of different generations at the same
+// time. Claims are also counted to delay leaving the group until final offsets
+// of released partitions are committed.
+//
+// implements `Member`.
+func (km *Kafka) ClaimPartition(claimerActorID *actor.ID, topic string, partition int32, cancelCh <-chan none.T) func() {
+	beginAt := time.Now()
+	km.claimsMu.Lock()
+	for !km.settled {
+		settledCh := km.settledCh
+		km.claimsMu.Unlock()
+		select {
+		case <-settledCh:
+		case <-cancelCh:
+			return func() {}
+		}
+		km.claimsMu.Lock()
+	}
+	km.claims++
+	km.claimsMu.Unlock()
+	log.Infof("<%s> partition claimed: via=%s, took=%s", claimerActorID, km.actorID, millisSince(beginAt))
+	return func() {
+		km.claimsMu.Lock()
+		km.claims--
+		km.claimsMu.Unlock()
+		select {
+		case km.releasedCh <- none.V:
+		default:
+		}
+		log.Infof("<%s> partition released: via=%s", claimerActorID, km.actorID)
+	}
+}
+
+// implements `Member`.
+func (km *Kafka) Stop() {
+	close(km.stopCh)
+	km.wg.Wait()
+}
+
+// run maintains the group membership. Whenever the member has to join the
+// group, be it because its topics changed or because the group rebalances, it
+// first stops granting partition claims, and if it has reported subscriptions
+// before, then it revokes all partitions by reporting subscriptions without
+// itself and waits for partition consumers to release them. Only then it
+// (re)joins the group, and once it has, partitions can be claimed again.
+func (km *Kafka) run() {
+	heartbeatTicker := time.NewTicker(km.cfg.Consumer.GroupSessionTimeout / 3)
+	defer heartbeatTicker.Stop()
+	var (
+		nilOrSubscriptionsCh chan<- map[string][]string
+		nilOrHeartbeatCh     <-chan time.Time
+		nilOrTimeoutCh       <-chan time.Time
+		nilOrReleasedCh      <-chan none.T
+		pendingTopics        []string
+		pendingSubscriptions map[string][]string
+		shouldJoin           = false
+		revoking             = false
+	)
+	for {
+		select {
+		case topics := <-km.topicsCh:
+			pendingTopics = normalizeTopics(topics)
+			shouldJoin = shouldJoin || !topicsEqual(pendingTopics, km.topics)
+		case nilOrSubscriptionsCh <- pendingSubscriptions:
+			nilOrSubscriptionsCh = nil
+			km.subscriptions = pendingSubscriptions
+		case <-nilOrHeartbeatCh:
+			if err := km.heartbeat(); err != nil && !shouldJoin {
+				log.Infof("<%s> rejoining: err=(%s)", km.actorID, err)
+				shouldJoin = true
+			}
+		case <-nilOrReleasedCh:
+		case <-nilOrTimeoutCh:
+		case <-km.stopCh:
+			km.stop(heartbeatTicker.C)
+			return
+		}
+
+		if !shouldJoin {
+			continue
+		}
+		km.setSettled(false)
+		if !revoking && len(km.subscriptions) != 0 {
+			log.Infof("<%s> revoking partitions: claims=%d", km.actorID, km.claimCount())
+			revoking = true
+			pendingSubscriptions = map[string][]string{}
+			nilOrSubscriptionsCh = km.subscriptionsCh
+			nilOrReleasedCh = km.releasedCh
+		}
+		if revoking && (nilOrSubscriptionsCh != nil || km.claimCount() > 0) {
+			continue
+		}
+		revoking = false
+		nilOrReleasedCh = nil
+		if len(pendingTopics) == 0 {
+			km.leave()
+			km.topics = nil
+			nilOrHeartbeatCh = nil
+			shouldJoin = false
+			continue
+		}
+		subscriptions, err := km.join(pendingTopics)
+		if err != nil {
+			log.Errorf("<%s> failed to join: err=(%s)", km.actorID, err)
+			nilOrTimeoutCh = backoff.After(km.cfg.Consumer.BackOffTimeout, km.cfg.Consumer.BackOffJitter)
+			continue
+		}
+		log.Infof("<%s> joined: generation=%d, subscriptions=%v", km.actorID, km.generationID, subscriptions)
+		km.topics = pendingTopics
+		nilOrHeartbeatCh = heartbeatTicker.C
+		shouldJoin = false
+		km.setSettled(true)
+		if subscriptionsEqual(subscriptions, km.subscriptions) {
+			nilOrSubscriptionsCh = nil
+			log.Infof("<%s> redundant group update ignored: %v", km.actorID, km.subscriptions)
+			continue
+		}
+		pendingSubscriptions = subscriptions
+		nilOrSubscriptionsCh = km.subscriptionsCh
+	}
+}
+
+// setSettled allows or disallows partitions to be claimed.
+func (km *Kafka) setSettled(settled bool) {
+	km.claimsMu.Lock()
+	defer km.claimsMu.Unlock()
+	if settled == km.settled {
+		return
+	}
+	km.settled = settled
+	if settled {
+		close(km.settledCh)
+		return
+	}
+	km.settledCh = make(chan none.T)
+}
+
+func (km *Kafka) claimCount() int {
+	km.claimsMu.Lock()
+	defer km.claimsMu.Unlock()
+	return km.claims
+}
+
+// stop makes partition consumers release all partitions, and leaves the group
+// after all of them have been released. The member keeps heartbeating in the
+// meantime, so that final offsets are committed within the current group
+// generation. Static members leave the group too, for the JoinGroup version
+// supported by the Kafka client cannot carry an instance ID (KIP-345), so the
+// coordinator would not give a restarted member its place back anyway.
+func (km *Kafka) stop(heartbeatCh <-chan time.Time) {
+	close(km.subscriptionsCh)
+	for {
+		claims := km.claimCount()
+		if claims == 0 {
+			break
+		}
+		select {
+		case <-km.releasedCh:
+		case <-heartbeatCh:
+			if km.kafkaMemberID == "" {
+				continue
+			}
+			if err := km.heartbeat(); err != nil {
+				log.Errorf("<%s> heartbeat failed while releasing partitions: claims=%d, err=(%s)",
+					km.actorID, claims, err)
+			}
+		}
+	}
+	km.leave()
+}
+
+// join joins the group, or rejoins it if the member has been in the group
+// already, and returns topic subscriptions of all group members.
+func (km *Kafka) join(topics []string) (map[string][]string, error) {
+	conn, err := km.coordinatorConn()
+	if err != nil {
+		return nil, err
+	}
+	joinReq := &sarama.JoinGroupRequest{
+		GroupId:        km.group,
+		SessionTimeout: int32(km.cfg.Consumer.GroupSessionTimeout / time.Millisecond),
+		MemberId:       km.kafkaMemberID,
+		ProtocolType:   protocolType,
+	}
+	meta := &sarama.ConsumerGroupMemberMetadata{Topics: topics, UserData: []byte(km.memberID)}
+	if err := joinReq.AddGroupProtocolMetadata(protocolName, meta); err != nil {
+		return nil, errors.Wrap(err, "failed to encode metadata")
+	}
+	joinRes, err := conn.JoinGroup(joinReq)
+	if err != nil {
+		km.resetConn()
+		return nil, errors.Wrap(err, "join request failed")
+	}
+	if joinRes.Err != sarama.ErrNoError {
+		km.onCoordinatorError(joinRes.Err)
+		return nil, errors.Wrap(joinRes.Err, "join rejected")
+	}
+	km.kafkaMemberID = joinRes.MemberId
+	km.generationID = joinRes.GenerationId
+
+	syncReq := &sarama.SyncGroupRequest{
+		GroupId:      km.group,
+		GenerationId: km.generationID,
+		MemberId:     km.kafkaMemberID,
+	}
+	if joinRes.LeaderId == joinRes.MemberId {
+		if err := addAssignments(syncReq, joinRes); err != nil {
+			return nil, err
+		}
+	}
+	syncRes, err := conn.SyncGroup(syncReq)
+	if err != nil {
+		km.resetConn()
+		return nil, errors.Wrap(err, "sync request failed")
+	}
+	if syncRes.Err != sarama.ErrNoError {
+		km.onCoordinatorError(syncRes.Err)
+		return nil, errors.Wrap(syncRes.Err, "sync rejected")
+	}
+	assignment, err := syncRes.GetMemberAssignment()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode assignment")
+	}
+	var subscriptions map[string][]string
+	if err := json.Unmarshal(assignment.UserData, &subscriptions); err != nil {
+		return nil, errors.Wrap(err, "failed to decode subscriptions")
+	}
+	km.offsetMgrF.SetGeneration(km.group, km.kafkaMemberID, km.generationID)
+	return subscriptions, nil
+}
+
+// addAssignments is called by the group leader to make every group member get
+// topic subscriptions of all members, indexed by Kafka-Pixy member IDs.
+func addAssignments(syncReq *sarama.SyncGroupRequest, joinRes *sarama.JoinGroupResponse) error {
+	members, err := joinRes.GetMembers()
+	if err != nil {
+		return errors.Wrap(err, "failed to decode member metadata")
+	}
+	subscriptions := make(map[string][]string, len(members))
+	for _, meta := range members {
+		subscriptions[string(meta.UserData)] = normalizeTopics(meta.Topics)
+	}
+	encoded, err := json.Marshal(subscriptions)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode subscriptions")
+	}
+	for kafkaMemberID := range members {
+		assignment := &sarama.ConsumerGroupMemberAssignment{UserData: encoded}
+		if err := syncReq.AddGroupAssignmentMember(kafkaMemberID, assignment); err != nil {
+			return errors.Wrap(err, "failed to encode assignment")
+		}
+	}
+	return nil
+}
+
+// heartbeat tells the coordinator that the member is alive. An error is
+// returned if the member has to rejoin the group, e.g. because the group is
+// rebalancing.
+func (km *Kafka) heartbeat() error {
+	conn, err := km.coordinatorConn()
+	if err != nil {
+		return err
+	}
+	res, err := conn.Heartbeat(&sarama.HeartbeatRequest{
+		GroupId:      km.group,
+		GenerationId: km.generationID,
+		MemberId:     km.kafkaMemberID,
+	})
+	if err != nil {
+		km.resetConn()
+		return errors.Wrap(err, "heartbeat request failed")
+	}
+	if res.Err != sarama.ErrNoError {
+		km.onCoordinatorError(res.Err)
+		return res.Err
+	}
+	return nil
+}
+
+// leave makes the member leave the group, so that the group rebalances right
+// away rather than after the session timeout.
+func (km *Kafka) leave() {
+	defer km.resetConn()
+	if km.kafkaMemberID == "" {
+		return
+	}
+	km.offsetMgrF.SetGeneration(km.group, "", sarama.GroupGenerationUndefined)
+	conn, err := km.coordinatorConn()
+	if err == nil {
+		var res *sarama.LeaveGroupResponse
+		res, err = conn.LeaveGroup(&sarama.LeaveGroupRequest{GroupId: km.group, MemberId: km.kafkaMemberID})
+		if err == nil && res.Err != sarama.ErrNoError {
+			err = res.Err
+		}
+	}
+	if err != nil {
+		log.Errorf("<%s> failed to leave: err=(%s)", km.actorID, err)
+	}
+	log.Infof("<%s> left: generation=%d", km.actorID, km.generationID)
+	km.kafkaMemberID = ""
+	km.generationID = sarama.GroupGenerationUndefined
+}
+
+// coordinatorConn returns a connection to the group coordinator. The member
+// uses a dedicated connection, for a join request blocks until all members
+// rejoin the group, and it would hold back other requests to the broker.
+func (km *Kafka) coordinatorConn() (*sarama.Broker, error) {
+	if km.conn != nil {
+		return km.conn, nil
+	}
+	coordinator, err := km.kafkaClt.Coordinator(km.group)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve coordinator")
+	}
+	// A join request can take up to the session timeout to complete.
+	saramaCfg := *km.kafkaClt.Config()
+	saramaCfg.Net.ReadTimeout += km.cfg.Consumer.GroupSessionTimeout
+	conn := sarama.NewBroker(coordinator.Addr())
+	if err := conn.Open(&saramaCfg); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to coordinator")
+	}
+	km.conn = conn
+	return conn, nil
+}
+
+func (km *Kafka) resetConn() {
+	if km.conn == nil {
+		return
+	}
+	_ = km.conn.Close()
+	km.conn = nil
+}
+
+// onCoordinatorError updates the member state according to an error returned
+// by the group coordinator.
+func (km *Kafka) onCoordinatorError(kerr sarama.KError) {
+	switch kerr {
+	case sarama.ErrUnknownMemberId:
+		km.kafkaMemberID = ""
+	case sarama.ErrNotCoordinatorForConsumer, sarama.ErrConsumerCoordinatorNotAvailable:
+		km.resetConn()
+		if err := km.kafkaClt.RefreshCoordinator(km.group); err != nil {
+			log.Errorf("<%s> failed to refresh coordinator: err=(%s)", km.actorID, err)
+		}
+	}
+}
+
+// KafkaGroupMember is a member of a group coordinated by the Kafka group
+// coordinator, as described by the coordinator.
+type KafkaGroupMember struct {
+	// ID is the Kafka-Pixy member ID, see `config.Proxy.GroupMemberID`.
+	ID string
+	// KafkaMemberID is the ID that the coordinator knows the member by.
+	KafkaMemberID string
+	// Topics the member is subscribed to.
+	Topics []string
+}
+
+// ListKafkaGroups returns consumer groups known to group coordinators of all
+// brokers of the Kafka cluster. The client does not expose brokers, so they
+// are discovered via the first seed broker that responds to a metadata request.
+func ListKafkaGroups(seedPeers []string, saramaCfg *sarama.Config) ([]string, error) {
+	var brokers []*sarama.Broker
+	err := errors.New("no seed brokers")
+	for _, addr := range seedPeers {
+		seed := sarama.NewBroker(addr)
+		if err = seed.Open(saramaCfg); err != nil {
+			continue
+		}
+		var res *sarama.MetadataResponse
+		res, err = seed.GetMetadata(&sarama.MetadataRequest{})
+		_ = seed.Close()
+		if err == nil {
+			brokers = res.Brokers
+			break
+		}
+	}
+	if brokers == nil {
+		return nil, errors.Wrap(err, "failed to discover brokers")
+	}
+	var groups []string
+	for _, broker := range brokers {
+		if err := broker.Open(saramaCfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to connect to broker %d", broker.ID())
+		}
+		res, err := broker.ListGroups(&sarama.ListGroupsRequest{})
+		_ = broker.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "list request to broker %d failed", broker.ID())
+		}
+		if res.Err != sarama.ErrNoError {
+			return nil, errors.Wrapf(res.Err, "list request to broker %d rejected", broker.ID())
+		}
+		for group, groupProtocolType := range res.Groups {
+			if groupProtocolType == protocolType {
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// DescribeKafkaGroup returns members of a group coordinated by the Kafka group
+// coordinator along with their topic subscriptions, sorted by member ID. If
+// the group is empty, or its members are not Kafka-Pixy instances, then no
+// members are returned.
+func DescribeKafkaGroup(kafkaClt sarama.Client, group string) ([]KafkaGroupMember, error) {
+	coordinator, err := kafkaClt.Coordinator(group)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve coordinator")
+	}
+	res, err := coordinator.DescribeGroups(&sarama.DescribeGroupsRequest{Groups: []string{group}})
+	if err != nil {
+		return nil, errors.Wrap(err, "describe request failed")
+	}
+	if len(res.Groups) != 1 {
+		return nil, errors.Errorf("unexpected number of groups described: %d", len(res.Groups))
+	}
+	desc := res.Groups[0]
+	if desc.Err != sarama.ErrNoError {
+		return nil, errors.Wrap(desc.Err, "describe request rejected")
+	}
+	if desc.ProtocolType != protocolType || desc.Protocol != protocolName {
+		return nil, nil
+	}
+	// The vendored Sarama decodes member metadata only as a part of a join
+	// response, hence the fake one.
+	joinRes := &sarama.JoinGroupResponse{Members: make(map[string][]byte, len(desc.Members))}
+	for kafkaMemberID, memberDesc := range desc.Members {
+		joinRes.Members[kafkaMemberID] = memberDesc.MemberMetadata
+	}
+	metas, err := joinRes.GetMembers()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode member metadata")
+	}
+	members := make([]KafkaGroupMember, 0, len(metas))
+	for kafkaMemberID, meta := range metas {
+		members = append(members, KafkaGroupMember{
+			ID:            string(meta.UserData),
+			KafkaMemberID: kafkaMemberID,
+			Topics:        normalizeTopics(meta.Topics),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, nil
+}
+
+// EvictKafkaGroupMember makes the group coordinator remove a member from the
+// group, as if the member left the group itself. That makes the group
+// rebalance, and if the member is still alive, then it joins the group again
+// as soon as it notices.
+func EvictKafkaGroupMember(kafkaClt sarama.Client, group, kafkaMemberID string) error {
+	coordinator, err := kafkaClt.Coordinator(group)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve coordinator")
+	}
+	res, err := coordinator.LeaveGroup(&sarama.LeaveGroupRequest{GroupId: group, MemberId: kafkaMemberID})
+	if err != nil {
+		return errors.Wrap(err, "leave request failed")
+	}
+	if res.Err != sarama.ErrNoError {
+		return errors.Wrap(res.Err, "leave request rejected")
+	}
+	return nil
+}
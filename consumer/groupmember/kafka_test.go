@@ -0,0 +1,410 @@
+package groupmember
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/mailgun/kafka-pixy/testhelpers"
+	. "gopkg.in/check.v1"
+)
+
+type KafkaSuite struct {
+	ns         *actor.ID
+	cfg        *config.Proxy
+	broker     *sarama.MockBroker
+	kafkaClt   sarama.Client
+	offsetMgrF *fakeOffsetMgrF
+}
+
+var _ = Suite(&KafkaSuite{})
+
+func (s *KafkaSuite) SetUpSuite(c *C) {
+	testhelpers.InitLogging(c)
+}
+
+func (s *KafkaSuite) SetUpTest(c *C) {
+	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
+	s.cfg.Consumer.GroupProtocol = config.GroupProtocolKafka
+	s.cfg.Consumer.GroupSessionTimeout = 300 * time.Millisecond
+	s.broker = sarama.NewMockBroker(c, 1)
+	s.offsetMgrF = &fakeOffsetMgrF{generations: make(map[string]generation)}
+}
+
+func (s *KafkaSuite) TearDownTest(c *C) {
+	if s.kafkaClt != nil {
+		s.kafkaClt.Close()
+		s.kafkaClt = nil
+	}
+	s.broker.Close()
+}
+
+func (s *KafkaSuite) spawn(c *C, handlers map[string]sarama.MockResponse) *Kafka {
+	s.spawnClient(c, handlers)
+	return SpawnKafka(s.ns.NewChild("m1"), "g1", "m1", s.cfg, s.kafkaClt, s.offsetMgrF)
+}
+
+func (s *KafkaSuite) spawnClient(c *C, handlers map[string]sarama.MockResponse) {
+	handlers["MetadataRequest"] = sarama.NewMockMetadataResponse(c).
+		SetBroker(s.broker.Addr(), s.broker.BrokerID())
+	handlers["ConsumerMetadataRequest"] = sarama.NewMockConsumerMetadataResponse(c).
+		SetCoordinator("g1", s.broker)
+	handlers["LeaveGroupRequest"] = sarama.NewMockWrapper(&sarama.LeaveGroupResponse{})
+	s.broker.SetHandlerByMap(handlers)
+	var err error
+	s.kafkaClt, err = sarama.NewClient([]string{s.broker.Addr()}, nil)
+	c.Assert(err, IsNil)
+}
+
+// A member that joins a group gets subscriptions of all group members from
+// the leader, and makes offsets be committed on behalf of the generation.
+func (s *KafkaSuite) TestJoin(c *C) {
+	// Given
+	subscriptions := map[string][]string{"m1": {"bar", "foo"}, "m2": {"bazz"}}
+	km := s.spawn(c, map[string]sarama.MockResponse{
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId: 7, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: encodeAssignment(c, subscriptions),
+		}),
+		"HeartbeatRequest": sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+	})
+	defer km.Stop()
+
+	// When
+	km.Topics() <- []string{"foo", "bar"}
+
+	// Then
+	c.Assert(<-km.Subscriptions(), DeepEquals, subscriptions)
+	c.Assert(s.offsetMgrF.generation("g1"), Equals, generation{"k1", 7})
+}
+
+// The leader distributes subscriptions of all members, as they were reported
+// on join, to every member.
+func (s *KafkaSuite) TestLeaderAssignments(c *C) {
+	// Given
+	joinRes := &sarama.JoinGroupResponse{
+		GenerationId: 7, GroupProtocol: protocolName, LeaderId: "k1", MemberId: "k1",
+		Members: map[string][]byte{
+			"k1": encodeMetadata(c, "m1", []string{"foo", "bar"}),
+			"k2": encodeMetadata(c, "m2", []string{"bazz"}),
+		},
+	}
+	syncReq := &sarama.SyncGroupRequest{}
+
+	// When
+	err := addAssignments(syncReq, joinRes)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(syncReq.GroupAssignments), Equals, 2)
+	for _, kafkaMemberID := range []string{"k1", "k2"} {
+		syncRes := sarama.SyncGroupResponse{MemberAssignment: syncReq.GroupAssignments[kafkaMemberID]}
+		assignment, err := syncRes.GetMemberAssignment()
+		c.Assert(err, IsNil)
+		var subscriptions map[string][]string
+		c.Assert(json.Unmarshal(assignment.UserData, &subscriptions), IsNil)
+		c.Assert(subscriptions, DeepEquals, map[string][]string{"m1": {"bar", "foo"}, "m2": {"bazz"}})
+	}
+}
+
+// When the coordinator tells that the group is rebalancing, the member revokes
+// its partitions, rejoins the group and gets updated subscriptions.
+func (s *KafkaSuite) TestRejoinOnRebalance(c *C) {
+	// Given
+	subscriptions1 := map[string][]string{"m1": {"foo"}}
+	subscriptions2 := map[string][]string{"m1": {"foo"}, "m2": {"foo"}}
+	km := s.spawn(c, map[string]sarama.MockResponse{
+		"JoinGroupRequest": sarama.NewMockSequence(
+			&sarama.JoinGroupResponse{GenerationId: 1, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1"},
+			&sarama.JoinGroupResponse{GenerationId: 2, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1"}),
+		"SyncGroupRequest": sarama.NewMockSequence(
+			&sarama.SyncGroupResponse{MemberAssignment: encodeAssignment(c, subscriptions1)},
+			&sarama.SyncGroupResponse{MemberAssignment: encodeAssignment(c, subscriptions2)}),
+		"HeartbeatRequest": sarama.NewMockSequence(
+			&sarama.HeartbeatResponse{Err: sarama.ErrRebalanceInProgress},
+			&sarama.HeartbeatResponse{}),
+	})
+	defer km.Stop()
+	km.Topics() <- []string{"foo"}
+	c.Assert(<-km.Subscriptions(), DeepEquals, subscriptions1)
+
+	// When
+	revoked := <-km.Subscriptions()
+	subscriptions := <-km.Subscriptions()
+
+	// Then
+	c.Assert(revoked, DeepEquals, map[string][]string{})
+	c.Assert(subscriptions, DeepEquals, subscriptions2)
+	c.Assert(s.offsetMgrF.generation("g1"), Equals, generation{"k1", 2})
+}
+
+// A member does not rejoin the group until all its partitions are released,
+// and partitions cannot be claimed until it has rejoined.
+func (s *KafkaSuite) TestRevokeBeforeRejoin(c *C) {
+	// Given
+	subscriptions1 := map[string][]string{"m1": {"foo"}}
+	subscriptions2 := map[string][]string{"m1": {"foo"}, "m2": {"foo"}}
+	km := s.spawn(c, map[string]sarama.MockResponse{
+		"JoinGroupRequest": sarama.NewMockSequence(
+			&sarama.JoinGroupResponse{GenerationId: 1, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1"},
+			&sarama.JoinGroupResponse{GenerationId: 2, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1"}),
+		"SyncGroupRequest": sarama.NewMockSequence(
+			&sarama.SyncGroupResponse{MemberAssignment: encodeAssignment(c, subscriptions1)},
+			&sarama.SyncGroupResponse{MemberAssignment: encodeAssignment(c, subscriptions2)}),
+		"HeartbeatRequest": sarama.NewMockSequence(
+			&sarama.HeartbeatResponse{Err: sarama.ErrRebalanceInProgress},
+			&sarama.HeartbeatResponse{}),
+	})
+	defer km.Stop()
+	km.Topics() <- []string{"foo"}
+	c.Assert(<-km.Subscriptions(), DeepEquals, subscriptions1)
+	release := km.ClaimPartition(s.ns, "foo", 1, nil)
+
+	// When
+	c.Assert(<-km.Subscriptions(), DeepEquals, map[string][]string{})
+	claimedCh := make(chan func())
+	go func() {
+		claimedCh <- km.ClaimPartition(s.ns, "foo", 2, nil)
+	}()
+
+	// Then
+	select {
+	case <-claimedCh:
+		c.Fatal("Claimed while rejoining")
+	case <-time.After(500 * time.Millisecond):
+	}
+	c.Assert(s.joinRequestCount(), Equals, 1)
+
+	// When
+	release()
+
+	// Then
+	c.Assert(<-km.Subscriptions(), DeepEquals, subscriptions2)
+	c.Assert(s.joinRequestCount(), Equals, 2)
+	(<-claimedCh)()
+}
+
+func (s *KafkaSuite) joinRequestCount() int {
+	count := 0
+	for _, rr := range s.broker.History() {
+		if _, ok := rr.Request.(*sarama.JoinGroupRequest); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// A stopped member leaves the group only after all claimed partitions have
+// been released, so that their final offsets are committed on behalf of the
+// current generation.
+func (s *KafkaSuite) TestStopWaitsForClaims(c *C) {
+	// Given
+	km := s.spawn(c, map[string]sarama.MockResponse{
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId: 7, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: encodeAssignment(c, map[string][]string{"m1": {"foo"}}),
+		}),
+		"HeartbeatRequest": sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+	})
+	km.Topics() <- []string{"foo"}
+	<-km.Subscriptions()
+	release := km.ClaimPartition(s.ns, "foo", 1, nil)
+
+	// When
+	stoppedCh := make(chan struct{})
+	go func() {
+		km.Stop()
+		close(stoppedCh)
+	}()
+
+	// Then
+	select {
+	case <-stoppedCh:
+		c.Fatal("Stopped before the partition is released")
+	case <-time.After(500 * time.Millisecond):
+	}
+	c.Assert(s.offsetMgrF.generation("g1"), Equals, generation{"k1", 7})
+	release()
+	<-stoppedCh
+	c.Assert(s.offsetMgrF.generation("g1"), Equals, generation{id: sarama.GroupGenerationUndefined})
+	leaveRequests := 0
+	for _, rr := range s.broker.History() {
+		if _, ok := rr.Request.(*sarama.LeaveGroupRequest); ok {
+			leaveRequests++
+		}
+	}
+	c.Assert(leaveRequests, Equals, 1)
+}
+
+// A static member leaves the group when stopped, just like a dynamic one, for
+// JoinGroup requests cannot carry its instance ID.
+func (s *KafkaSuite) TestStaticMemberStop(c *C) {
+	// Given
+	s.cfg.Consumer.InstanceID = "m1"
+	km := s.spawn(c, map[string]sarama.MockResponse{
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId: 7, GroupProtocol: protocolName, LeaderId: "k2", MemberId: "k1",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: encodeAssignment(c, map[string][]string{"m1": {"foo"}}),
+		}),
+		"HeartbeatRequest": sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+	})
+	km.Topics() <- []string{"foo"}
+	<-km.Subscriptions()
+
+	// When
+	km.Stop()
+
+	// Then
+	c.Assert(s.offsetMgrF.generation("g1"), Equals, generation{id: sarama.GroupGenerationUndefined})
+	var leaveReqs []*sarama.LeaveGroupRequest
+	for _, rr := range s.broker.History() {
+		if leaveReq, ok := rr.Request.(*sarama.LeaveGroupRequest); ok {
+			leaveReqs = append(leaveReqs, leaveReq)
+		}
+	}
+	c.Assert(leaveReqs, DeepEquals, []*sarama.LeaveGroupRequest{{GroupId: "g1", MemberId: "k1"}})
+}
+
+// Members of a Kafka-Pixy group are described with their Kafka-Pixy member
+// IDs and subscriptions, and groups of other consumers are ignored.
+func (s *KafkaSuite) TestDescribeKafkaGroup(c *C) {
+	// Given
+	s.spawnClient(c, map[string]sarama.MockResponse{
+		"DescribeGroupsRequest": sarama.NewMockSequence(
+			&sarama.DescribeGroupsResponse{Groups: []*sarama.GroupDescription{{
+				GroupId: "g1", State: "Stable", ProtocolType: protocolType, Protocol: protocolName,
+				Members: map[string]*sarama.GroupMemberDescription{
+					"k1": {MemberMetadata: encodeMetadata(c, "m2", []string{"foo", "bar"})},
+					"k2": {MemberMetadata: encodeMetadata(c, "m1", []string{"bazz"})},
+				},
+			}}},
+			&sarama.DescribeGroupsResponse{Groups: []*sarama.GroupDescription{{
+				GroupId: "g1", State: "Stable", ProtocolType: protocolType, Protocol: "range",
+				Members: map[string]*sarama.GroupMemberDescription{
+					"k3": {MemberMetadata: encodeMetadata(c, "m3", []string{"foo"})},
+				},
+			}}}),
+	})
+
+	// When
+	members, err := DescribeKafkaGroup(s.kafkaClt, "g1")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []KafkaGroupMember{
+		{ID: "m1", KafkaMemberID: "k2", Topics: []string{"bazz"}},
+		{ID: "m2", KafkaMemberID: "k1", Topics: []string{"bar", "foo"}},
+	})
+
+	// When
+	members, err = DescribeKafkaGroup(s.kafkaClt, "g1")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(members, IsNil)
+}
+
+// Groups are listed from all brokers discovered via a seed broker, and only
+// groups of consumers are returned.
+func (s *KafkaSuite) TestListKafkaGroups(c *C) {
+	// Given
+	s.spawnClient(c, map[string]sarama.MockResponse{
+		"ListGroupsRequest": sarama.NewMockWrapper(&sarama.ListGroupsResponse{
+			Groups: map[string]string{"g2": protocolType, "g1": protocolType, "connect-g3": "connect"},
+		}),
+	})
+
+	// When
+	groups, err := ListKafkaGroups([]string{s.broker.Addr()}, sarama.NewConfig())
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(groups, DeepEquals, []string{"g1", "g2"})
+}
+
+// A member is evicted by the coordinator on its behalf.
+func (s *KafkaSuite) TestEvictKafkaGroupMember(c *C) {
+	// Given
+	s.spawnClient(c, map[string]sarama.MockResponse{})
+
+	// When
+	err := EvictKafkaGroupMember(s.kafkaClt, "g1", "k2")
+
+	// Then
+	c.Assert(err, IsNil)
+	var leaveReqs []*sarama.LeaveGroupRequest
+	for _, rr := range s.broker.History() {
+		if leaveReq, ok := rr.Request.(*sarama.LeaveGroupRequest); ok {
+			leaveReqs = append(leaveReqs, leaveReq)
+		}
+	}
+	c.Assert(leaveReqs, DeepEquals, []*sarama.LeaveGroupRequest{{GroupId: "g1", MemberId: "k2"}})
+}
+
+func encodeMetadata(c *C, memberID string, topics []string) []byte {
+	joinReq := &sarama.JoinGroupRequest{}
+	meta := &sarama.ConsumerGroupMemberMetadata{Topics: topics, UserData: []byte(memberID)}
+	c.Assert(joinReq.AddGroupProtocolMetadata(protocolName, meta), IsNil)
+	return joinReq.GroupProtocols[protocolName]
+}
+
+func encodeAssignment(c *C, subscriptions map[string][]string) []byte {
+	encoded, err := json.Marshal(subscriptions)
+	c.Assert(err, IsNil)
+	syncReq := &sarama.SyncGroupRequest{}
+	c.Assert(syncReq.AddGroupAssignmentMember("k", &sarama.ConsumerGroupMemberAssignment{UserData: encoded}), IsNil)
+	return syncReq.GroupAssignments["k"]
+}
+
+// fakeOffsetMgrF records generations that offsets of groups would be committed
+// on behalf of.
+type fakeOffsetMgrF struct {
+	mu          sync.Mutex
+	generations map[string]generation
+}
+
+type generation struct {
+	memberID string
+	id       int32
+}
+
+func (f *fakeOffsetMgrF) SpawnOffsetManager(namespace *actor.ID, group, topic string, partition int32) (offsetmgr.T, error) {
+	panic("not implemented")
+}
+
+func (f *fakeOffsetMgrF) Stop() {}
+
+func (f *fakeOffsetMgrF) Coordinators() []offsetmgr.CoordinatorStatus {
+	return nil
+}
+
+func (f *fakeOffsetMgrF) SetGeneration(group, memberID string, generationID int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if generationID == sarama.GroupGenerationUndefined {
+		delete(f.generations, group)
+		return
+	}
+	f.generations[group] = generation{memberID, generationID}
+}
+
+func (f *fakeOffsetMgrF) generation(group string) generation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	gen, ok := f.generations[group]
+	if !ok {
+		return generation{id: sarama.GroupGenerationUndefined}
+	}
+	return gen
+}
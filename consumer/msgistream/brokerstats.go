@@ -0,0 +1,113 @@
+package msgistream
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/consumer"
+)
+
+// BrokerStats accumulates fetch request statistics per broker. It can be
+// shared by several message stream factories. A nil instance records nothing.
+type BrokerStats struct {
+	mu      sync.Mutex
+	brokers map[int32]*brokerStat
+}
+
+type brokerStat struct {
+	addr         string
+	fetches      int64
+	errors       int64
+	bytes        int64
+	totalLatency time.Duration
+	maxLatency   time.Duration
+	partitions   map[instanceID]int64
+}
+
+// NewBrokerStats creates an empty broker statistics accumulator.
+func NewBrokerStats() *BrokerStats {
+	return &BrokerStats{brokers: make(map[int32]*brokerStat)}
+}
+
+// Snapshot returns fetch statistics of all brokers seen so far by broker ID.
+func (bs *BrokerStats) Snapshot() map[int32]consumer.BrokerStat {
+	snapshot := make(map[int32]consumer.BrokerStat)
+	if bs == nil {
+		return snapshot
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	for brokerID, s := range bs.brokers {
+		stat := consumer.BrokerStat{
+			Addr:         s.addr,
+			Fetches:      s.fetches,
+			Errors:       s.errors,
+			Bytes:        s.bytes,
+			MaxLatencyMs: toMillis(s.maxLatency),
+			Partitions:   make([]consumer.PartitionStat, 0, len(s.partitions)),
+		}
+		if s.fetches > 0 {
+			stat.AvgLatencyMs = toMillis(s.totalLatency / time.Duration(s.fetches))
+		}
+		for id, bytes := range s.partitions {
+			ps := consumer.PartitionStat{Topic: id.topic, Partition: id.partition, Bytes: bytes}
+			if s.bytes > 0 {
+				ps.Share = float64(bytes) / float64(s.bytes)
+			}
+			stat.Partitions = append(stat.Partitions, ps)
+		}
+		sort.Slice(stat.Partitions, func(i, j int) bool {
+			if stat.Partitions[i].Topic != stat.Partitions[j].Topic {
+				return stat.Partitions[i].Topic < stat.Partitions[j].Topic
+			}
+			return stat.Partitions[i].Partition < stat.Partitions[j].Partition
+		})
+		snapshot[brokerID] = stat
+	}
+	return snapshot
+}
+
+// record accounts a batch fetch request made to the broker that took `latency`
+// to complete.
+func (bs *BrokerStats) record(conn *sarama.Broker, fetchRequests []fetchReq, res *sarama.FetchResponse, err error, latency time.Duration) {
+	if bs == nil {
+		return
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	s := bs.brokers[conn.ID()]
+	if s == nil {
+		s = &brokerStat{partitions: make(map[instanceID]int64)}
+		bs.brokers[conn.ID()] = s
+	}
+	s.addr = conn.Addr()
+	s.fetches++
+	s.totalLatency += latency
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+	if err != nil || res == nil {
+		s.errors++
+		return
+	}
+	for _, fr := range fetchRequests {
+		block := res.GetBlock(fr.Topic, fr.Partition)
+		if block == nil {
+			continue
+		}
+		var bytes int64
+		for _, msgBlock := range block.MsgSet.Messages {
+			for _, msg := range msgBlock.Messages() {
+				bytes += int64(len(msg.Msg.Key) + len(msg.Msg.Value))
+			}
+		}
+		s.partitions[instanceID{fr.Topic, fr.Partition}] += bytes
+		s.bytes += bytes
+	}
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
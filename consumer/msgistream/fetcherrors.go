@@ -0,0 +1,78 @@
+package msgistream
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// Classes of fetch errors. Every class has its own retry policy.
+const (
+	// Errors that are expected to go away shortly by themselves, e.g. a
+	// fetch request timed out on the broker side. The fetch is retried on
+	// the same broker after `Config.Consumer.BackOffTimeout`.
+	ErrClassTransient = "transient"
+
+	// Errors that indicate that the partition leader may have moved, or the
+	// broker connection failed. The partition is reassigned to the current
+	// leader broker, at most once per `Config.Consumer.BackOffTimeout`.
+	ErrClassLeadership = "leadership"
+
+	// Errors that are not expected to go away without an operator
+	// intervention, e.g. the topic is invalid or not authorized. They are
+	// logged as errors, and the partition is reassigned no more often than
+	// once per `Config.Consumer.FatalBackOffTimeout`.
+	ErrClassFatal = "fatal"
+)
+
+// ClassifyErr returns the class of a fetch error.
+func ClassifyErr(err error) string {
+	switch err {
+	case sarama.ErrRequestTimedOut, sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend, sarama.ErrIncompleteResponse:
+		return ErrClassTransient
+	case sarama.ErrInvalidTopic, sarama.ErrUnknownMemberId,
+		sarama.ErrTopicAuthorizationFailed, sarama.ErrClusterAuthorizationFailed:
+		return ErrClassFatal
+	}
+	return ErrClassLeadership
+}
+
+// ErrStats counts fetch errors by class. It can be shared by several message
+// stream factories. A nil instance counts nothing.
+type ErrStats struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewErrStats creates an empty fetch error counter.
+func NewErrStats() *ErrStats {
+	return &ErrStats{counts: make(map[string]int64)}
+}
+
+// Counts returns the number of fetch errors of every class seen so far.
+func (es *ErrStats) Counts() map[string]int64 {
+	counts := map[string]int64{
+		ErrClassTransient:  0,
+		ErrClassLeadership: 0,
+		ErrClassFatal:      0,
+	}
+	if es == nil {
+		return counts
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for class, count := range es.counts {
+		counts[class] = count
+	}
+	return counts
+}
+
+func (es *ErrStats) count(class string) {
+	if es == nil {
+		return
+	}
+	es.mu.Lock()
+	es.counts[class]++
+	es.mu.Unlock()
+}
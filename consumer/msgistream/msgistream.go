@@ -7,6 +7,8 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
+	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/mapper"
 	"github.com/mailgun/kafka-pixy/none"
@@ -74,11 +76,14 @@ func (ce Errors) Error() string {
 
 type factory struct {
 	namespace    *actor.ID
+	cfg          *config.Proxy
 	saramaCfg    *sarama.Config
 	kafkaClt     sarama.Client
 	children     map[instanceID]*msgIStream
 	childrenLock sync.Mutex
 	mapper       *mapper.T
+	errStats     *ErrStats
+	brokerStats  *BrokerStats
 }
 
 type instanceID struct {
@@ -88,13 +93,17 @@ type instanceID struct {
 
 // SpawnFactory creates a new message stream factory using the given client. It
 // is still necessary to call Stop() on the underlying client after shutting
-// down this factory.
-func SpawnFactory(namespace *actor.ID, kafkaClt sarama.Client) (Factory, error) {
+// down this factory. Fetch errors are counted in `errStats` and fetch requests
+// are accounted per broker in `brokerStats`, unless they are nil.
+func SpawnFactory(namespace *actor.ID, cfg *config.Proxy, kafkaClt sarama.Client, errStats *ErrStats, brokerStats *BrokerStats) (Factory, error) {
 	f := &factory{
-		namespace: namespace.NewChild("msg_stream_f"),
-		kafkaClt:  kafkaClt,
-		saramaCfg: kafkaClt.Config(),
-		children:  make(map[instanceID]*msgIStream),
+		namespace:   namespace.NewChild("msg_stream_f"),
+		cfg:         cfg,
+		kafkaClt:    kafkaClt,
+		saramaCfg:   kafkaClt.Config(),
+		children:    make(map[instanceID]*msgIStream),
+		errStats:    errStats,
+		brokerStats: brokerStats,
 	}
 	f.mapper = mapper.Spawn(f.namespace, f)
 	return f, nil
@@ -141,6 +150,7 @@ func (f *factory) SpawnExecutor(brokerConn *sarama.Broker) mapper.Executor {
 		execActorID:     f.namespace.NewChild("broker", brokerConn.ID(), "exec"),
 		config:          f.saramaCfg,
 		conn:            brokerConn,
+		stats:           f.brokerStats,
 		requestsCh:      make(chan fetchReq),
 		batchRequestsCh: make(chan []fetchReq),
 	}
@@ -176,6 +186,18 @@ func (f *factory) chooseStartingOffset(topic string, partition int32, offset int
 	}
 }
 
+// channelBufferSize returns the size of buffers that a message stream of the
+// specified topic should have. Topic specific configuration takes precedence
+// over the Kafka client settings. The size is only read when a stream is
+// spawned. Kafka-Pixy has no configuration reload, so there is nothing that
+// could change it for a running stream.
+func (f *factory) channelBufferSize(topic string) int {
+	if topicCfg := f.cfg.Consumer.Topics[topic]; topicCfg != nil && topicCfg.ChannelBufferSize > 0 {
+		return topicCfg.ChannelBufferSize
+	}
+	return f.saramaCfg.ChannelBufferSize
+}
+
 // implements `mapper.Worker`.
 type msgIStream struct {
 	actorID      *actor.ID
@@ -194,18 +216,20 @@ type msgIStream struct {
 	assignedBrokerRequestCh   chan<- fetchReq
 	nilOrBrokerRequestsCh     chan<- fetchReq
 	nilOrReassignRetryTimerCh <-chan time.Time
+	nilOrFetchRetryTimerCh    <-chan time.Time
 	lastReassignTime          time.Time
 }
 
 func (f *factory) spawnMsgIStream(namespace *actor.ID, id instanceID, offset int64) *msgIStream {
+	bufferSize := f.channelBufferSize(id.topic)
 	mis := &msgIStream{
 		actorID:      namespace.NewChild("msg_stream"),
 		f:            f,
 		id:           id,
 		assignmentCh: make(chan mapper.Executor, 1),
 		initErrorCh:  make(chan error),
-		messagesCh:   make(chan consumer.Message, f.saramaCfg.ChannelBufferSize),
-		errorsCh:     make(chan *Err, f.saramaCfg.ChannelBufferSize),
+		messagesCh:   make(chan consumer.Message, bufferSize),
+		errorsCh:     make(chan *Err, bufferSize),
 		closingCh:    make(chan none.T, 1),
 		offset:       offset,
 		fetchSize:    f.saramaCfg.Consumer.Fetch.Default,
@@ -248,11 +272,13 @@ func (mis *msgIStream) run() {
 	var (
 		fetchResultCh       = make(chan fetchRes, 1)
 		nilOrFetchResultsCh <-chan fetchRes
-		nilOrMessagesCh     chan<- consumer.Message
-		fetchedMessages     []consumer.Message
-		err                 error
-		currMessage         consumer.Message
-		currMessageIdx      int
+		// A broker executor that the pending fetch request was sent to.
+		pendingFetchBrokerCh chan<- fetchReq
+		nilOrMessagesCh      chan<- consumer.Message
+		fetchedMessages      []consumer.Message
+		err                  error
+		currMessage          consumer.Message
+		currMessageIdx       int
 	)
 pullMessagesLoop:
 	for {
@@ -266,29 +292,60 @@ pullMessagesLoop:
 			be := bw.(*brokerExecutor)
 			// A new leader broker has been assigned for the partition.
 			mis.assignedBrokerRequestCh = be.requestsCh
-			// Cancel the reassign retry timer.
+			// Cancel the reassign and fetch retry timers.
 			mis.nilOrReassignRetryTimerCh = nil
-			// If there is a fetch request pending, then let it complete,
-			// otherwise trigger one.
-			if nilOrFetchResultsCh == nil && nilOrMessagesCh == nil {
+			mis.nilOrFetchRetryTimerCh = nil
+			if nilOrFetchResultsCh != nil {
+				// If the pending fetch request was sent to the newly assigned
+				// broker, then let it complete.
+				if pendingFetchBrokerCh == mis.assignedBrokerRequestCh {
+					continue pullMessagesLoop
+				}
+				// Otherwise abandon it and fetch from the new broker right
+				// away. The result channel is replaced so that the old broker
+				// executor can still deliver the stale result without blocking
+				// and that result, an error most likely, does not trigger yet
+				// another reassign. The fetch offset, size and lag carry over.
+				log.Infof("<%s> pending fetch handed off: offset=%d", mis.actorID, mis.offset)
+				fetchResultCh = make(chan fetchRes, 1)
+				nilOrFetchResultsCh = nil
+				pendingFetchBrokerCh = nil
+			}
+			// Messages fetched from the old broker are still pushed to the
+			// user, and a new fetch request is made when they are all gone.
+			if nilOrMessagesCh == nil {
 				mis.nilOrBrokerRequestsCh = mis.assignedBrokerRequestCh
 			}
 
 		case mis.nilOrBrokerRequestsCh <- fetchReq{mis.id.topic, mis.id.partition, mis.offset, mis.fetchSize, mis.lag, fetchResultCh}:
+			pendingFetchBrokerCh = mis.nilOrBrokerRequestsCh
 			mis.nilOrBrokerRequestsCh = nil
 			nilOrFetchResultsCh = fetchResultCh
 
 		case result := <-nilOrFetchResultsCh:
 			nilOrFetchResultsCh = nil
+			pendingFetchBrokerCh = nil
 			if fetchedMessages, err = mis.parseFetchResult(mis.actorID, result); err != nil {
-				log.Infof("<%s> fetch failed: err=%s", mis.actorID, err)
 				mis.reportError(err)
 				if err == sarama.ErrOffsetOutOfRange {
+					log.Infof("<%s> fetch failed: err=%s", mis.actorID, err)
 					// There's no point in retrying this it will just fail the
 					// same way, therefore is nothing to do but give up.
 					goto done
 				}
-				mis.triggerOrScheduleReassign("fetch error")
+				errClass := ClassifyErr(err)
+				mis.f.errStats.count(errClass)
+				switch errClass {
+				case ErrClassTransient:
+					log.Infof("<%s> fetch failed, retrying: class=%s, err=%s", mis.actorID, errClass, err)
+					mis.nilOrFetchRetryTimerCh = backoff.After(mis.f.saramaCfg.Consumer.Retry.Backoff, mis.f.cfg.Consumer.BackOffJitter)
+				case ErrClassFatal:
+					log.Errorf("<%s> fetch failed: class=%s, err=%s", mis.actorID, errClass, err)
+					mis.scheduleReassign(mis.f.cfg.Consumer.FatalBackOffTimeout)
+				default:
+					log.Infof("<%s> fetch failed: class=%s, err=%s", mis.actorID, errClass, err)
+					mis.triggerOrScheduleReassign("fetch error")
+				}
 				continue pullMessagesLoop
 			}
 			// If no messages has been fetched, then trigger another request.
@@ -312,10 +369,16 @@ pullMessagesLoop:
 			nilOrMessagesCh = nil
 			mis.nilOrBrokerRequestsCh = mis.assignedBrokerRequestCh
 
+		case <-mis.nilOrFetchRetryTimerCh:
+			mis.nilOrFetchRetryTimerCh = nil
+			if nilOrFetchResultsCh == nil && nilOrMessagesCh == nil {
+				mis.nilOrBrokerRequestsCh = mis.assignedBrokerRequestCh
+			}
+
 		case <-mis.nilOrReassignRetryTimerCh:
 			mis.f.mapper.WorkerReassign() <- mis
 			log.Infof("<%s> reassign triggered by timeout", mis.actorID)
-			mis.nilOrReassignRetryTimerCh = time.After(mis.f.saramaCfg.Consumer.Retry.Backoff)
+			mis.nilOrReassignRetryTimerCh = backoff.After(mis.f.saramaCfg.Consumer.Retry.Backoff, mis.f.cfg.Consumer.BackOffJitter)
 
 		case <-mis.closingCh:
 			goto done
@@ -328,7 +391,7 @@ done:
 
 func (mis *msgIStream) triggerOrScheduleReassign(reason string) {
 	mis.assignedBrokerRequestCh = nil
-	now := time.Now().UTC()
+	now := time.Now()
 	if now.Sub(mis.lastReassignTime) > mis.f.saramaCfg.Consumer.Retry.Backoff {
 		log.Infof("<%s> trigger reassign: reason=(%s)", mis.actorID, reason)
 		mis.lastReassignTime = now
@@ -336,7 +399,14 @@ func (mis *msgIStream) triggerOrScheduleReassign(reason string) {
 	} else {
 		log.Infof("<%s> schedule reassign: reason=(%s)", mis.actorID, reason)
 	}
-	mis.nilOrReassignRetryTimerCh = time.After(mis.f.saramaCfg.Consumer.Retry.Backoff)
+	mis.nilOrReassignRetryTimerCh = backoff.After(mis.f.saramaCfg.Consumer.Retry.Backoff, mis.f.cfg.Consumer.BackOffJitter)
+}
+
+// scheduleReassign detaches the message stream from the assigned broker and
+// makes it request a reassignment after the specified back off.
+func (mis *msgIStream) scheduleReassign(backOff time.Duration) {
+	mis.assignedBrokerRequestCh = nil
+	mis.nilOrReassignRetryTimerCh = backoff.After(backOff, mis.f.cfg.Consumer.BackOffJitter)
 }
 
 // parseFetchResult parses a fetch response received a broker.
@@ -439,6 +509,7 @@ type brokerExecutor struct {
 	execActorID     *actor.ID
 	config          *sarama.Config
 	conn            *sarama.Broker
+	stats           *BrokerStats
 	requestsCh      chan fetchReq
 	batchRequestsCh chan []fetchReq
 	wg              sync.WaitGroup
@@ -501,7 +572,7 @@ func (be *brokerExecutor) runExecutor() {
 	for fetchRequests := range be.batchRequestsCh {
 		// Reject consume requests for awhile after a connection failure to
 		// allow the Kafka cluster some time to recuperate.
-		if time.Now().UTC().Sub(lastErrTime) < be.config.Consumer.Retry.Backoff {
+		if time.Since(lastErrTime) < be.config.Consumer.Retry.Backoff {
 			for _, fr := range fetchRequests {
 				fr.ReplyToCh <- fetchRes{nil, lastErr}
 			}
@@ -516,9 +587,11 @@ func (be *brokerExecutor) runExecutor() {
 			req.AddBlock(fr.Topic, fr.Partition, fr.Offset, fr.MaxBytes)
 		}
 		var res *sarama.FetchResponse
+		fetchBegin := time.Now()
 		res, lastErr = be.conn.Fetch(req)
+		be.stats.record(be.conn, fetchRequests, res, lastErr, time.Since(fetchBegin))
 		if lastErr != nil {
-			lastErrTime = time.Now().UTC()
+			lastErrTime = time.Now()
 			be.conn.Close()
 			log.Infof("<%s> connection reset: err=(%s)", be.execActorID, lastErr)
 		}
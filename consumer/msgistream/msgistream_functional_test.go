@@ -5,14 +5,16 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
 	. "gopkg.in/check.v1"
 )
 
 type MsgIStreamFuncSuite struct {
-	ns *actor.ID
-	kh *kafkahelper.T
+	ns  *actor.ID
+	cfg *config.Proxy
+	kh  *kafkahelper.T
 }
 
 var _ = Suite(&MsgIStreamFuncSuite{})
@@ -28,6 +30,7 @@ func (s *MsgIStreamFuncSuite) TearDownSuite(c *C) {
 
 func (s *MsgIStreamFuncSuite) SetUpTest(c *C) {
 	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
 }
 
 // BrokerConsumer used to be implemented so that if the message channel of one
@@ -53,7 +56,7 @@ func (s *MsgIStreamFuncSuite) TestSlacker(c *C) {
 	config.ChannelBufferSize = 10
 	client, _ := sarama.NewClient(testhelpers.KafkaPeers, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
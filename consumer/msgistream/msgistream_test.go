@@ -7,6 +7,8 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/log"
 	. "gopkg.in/check.v1"
@@ -17,7 +19,8 @@ func Test(t *testing.T) {
 }
 
 type MsgIStreamSuite struct {
-	ns *actor.ID
+	ns  *actor.ID
+	cfg *config.Proxy
 }
 
 var (
@@ -31,6 +34,7 @@ func (s *MsgIStreamSuite) SetUpSuite(c *C) {
 
 func (s *MsgIStreamSuite) SetUpTest(c *C) {
 	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
 }
 
 // If a particular offset is provided then messages are consumed starting from
@@ -59,7 +63,7 @@ func (s *MsgIStreamSuite) TestOffsetManual(c *C) {
 	defer client.Close()
 
 	// When
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -102,7 +106,7 @@ func (s *MsgIStreamSuite) TestOffsetNewest(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -136,7 +140,7 @@ func (s *MsgIStreamSuite) TestRecreate(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -173,7 +177,7 @@ func (s *MsgIStreamSuite) TestDuplicate(c *C) {
 	config.ChannelBufferSize = 0
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -218,7 +222,7 @@ func (s *MsgIStreamSuite) TestLeaderRefreshError(c *C) {
 	config.Metadata.Retry.Max = 0
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -275,7 +279,7 @@ func (s *MsgIStreamSuite) TestInvalidTopic(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -312,7 +316,7 @@ func (s *MsgIStreamSuite) TestClosePartitionWithoutLeader(c *C) {
 	config.Metadata.Retry.Max = 0
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -359,7 +363,7 @@ func (s *MsgIStreamSuite) TestShutsDownOutOfRange(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -399,7 +403,7 @@ func (s *MsgIStreamSuite) TestExtraOffsets(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -438,7 +442,7 @@ func (s *MsgIStreamSuite) TestNonSequentialOffsets(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -492,7 +496,7 @@ func (s *MsgIStreamSuite) TestRebalancingMultiplePartitions(c *C) {
 	config.Consumer.Retry.Backoff = 50 * time.Millisecond
 	client, _ := sarama.NewClient([]string{seedBroker.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -632,7 +636,7 @@ func (s *MsgIStreamSuite) TestInterleavedClose(c *C) {
 	config.ChannelBufferSize = 0
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -690,7 +694,7 @@ func (s *MsgIStreamSuite) TestBounceWithReferenceOpen(c *C) {
 	config.ChannelBufferSize = 1
 	client, _ := sarama.NewClient([]string{broker1.Addr()}, config)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -755,7 +759,7 @@ func (s *MsgIStreamSuite) TestOffsetOutOfRange(c *C) {
 
 	client, _ := sarama.NewClient([]string{broker0.Addr()}, nil)
 	defer client.Close()
-	f, err := SpawnFactory(s.ns, client)
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
 	c.Assert(err, IsNil)
 	defer f.Stop()
 
@@ -770,3 +774,280 @@ func (s *MsgIStreamSuite) TestOffsetOutOfRange(c *C) {
 	c.Assert(offset, Equals, int64(2000))
 	pc.Stop()
 }
+
+// Message streams of topics that have a buffer size override get buffers of
+// that size, the rest get the buffer size of the Kafka client.
+func (s *MsgIStreamSuite) TestTopicChannelBufferSize(c *C) {
+	// Given
+	broker0 := sarama.NewMockBroker(c, 0)
+	defer broker0.Close()
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()).
+			SetLeader("other_topic", 0, broker0.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(c).
+			SetOffset("my_topic", 0, sarama.OffsetNewest, 2000).
+			SetOffset("my_topic", 0, sarama.OffsetOldest, 1000).
+			SetOffset("other_topic", 0, sarama.OffsetNewest, 2000).
+			SetOffset("other_topic", 0, sarama.OffsetOldest, 1000),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1),
+	})
+	s.cfg.Consumer.Topics = map[string]*config.ConsumerTopic{
+		"my_topic": {ChannelBufferSize: 3},
+	}
+	saramaCfg := sarama.NewConfig()
+	saramaCfg.ChannelBufferSize = 7
+	client, _ := sarama.NewClient([]string{broker0.Addr()}, saramaCfg)
+	defer client.Close()
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
+	c.Assert(err, IsNil)
+	defer f.Stop()
+
+	// When
+	pc0, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 0), "my_topic", 0, sarama.OffsetNewest)
+	c.Assert(err, IsNil)
+	pc1, _, err := f.SpawnMessageIStream(s.ns.NewChild("other_topic", 0), "other_topic", 0, sarama.OffsetNewest)
+	c.Assert(err, IsNil)
+
+	// Then
+	c.Assert(cap(pc0.Messages()), Equals, 3)
+	c.Assert(cap(pc0.Errors()), Equals, 3)
+	c.Assert(cap(pc1.Messages()), Equals, 7)
+	c.Assert(cap(pc1.Errors()), Equals, 7)
+	pc0.Stop()
+	pc1.Stop()
+}
+
+// Transient fetch errors are retried on the same broker and counted in the
+// transient class.
+func (s *MsgIStreamSuite) TestTransientFetchError(c *C) {
+	// Given
+	broker0 := sarama.NewMockBroker(c, 0)
+	defer broker0.Close()
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(c).
+			SetOffset("my_topic", 0, sarama.OffsetOldest, 123).
+			SetOffset("my_topic", 0, sarama.OffsetNewest, 1000),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 123, testMsg),
+	})
+
+	config := sarama.NewConfig()
+	config.Consumer.Retry.Backoff = 100 * time.Millisecond
+	config.Consumer.Return.Errors = true
+	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
+	defer client.Close()
+	errStats := NewErrStats()
+	f, err := SpawnFactory(s.ns, s.cfg, client, errStats, nil)
+	c.Assert(err, IsNil)
+	defer f.Stop()
+
+	pc, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 0), "my_topic", 0, sarama.OffsetOldest)
+	c.Assert(err, IsNil)
+	defer pc.Stop()
+	c.Assert((<-pc.Messages()).Offset, Equals, int64(123))
+
+	fetchResponse := &sarama.FetchResponse{}
+	fetchResponse.AddError("my_topic", 0, sarama.ErrRequestTimedOut)
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"FetchRequest": sarama.NewMockWrapper(fetchResponse),
+	})
+	c.Assert((<-pc.Errors()).Err, Equals, sarama.ErrRequestTimedOut)
+
+	// When
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 124, testMsg),
+	})
+
+	// Then
+	c.Assert((<-pc.Messages()).Offset, Equals, int64(124))
+	counts := errStats.Counts()
+	c.Assert(counts[ErrClassTransient] > 0, Equals, true)
+	c.Assert(counts[ErrClassLeadership], Equals, int64(0))
+	c.Assert(counts[ErrClassFatal], Equals, int64(0))
+}
+
+// Fatal fetch errors are retried after `Config.Consumer.FatalBackOffTimeout`.
+func (s *MsgIStreamSuite) TestFatalFetchError(c *C) {
+	// Given
+	broker0 := sarama.NewMockBroker(c, 0)
+	defer broker0.Close()
+	fetchResponse := &sarama.FetchResponse{}
+	fetchResponse.AddError("my_topic", 0, sarama.ErrTopicAuthorizationFailed)
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(c).
+			SetOffset("my_topic", 0, sarama.OffsetOldest, 123).
+			SetOffset("my_topic", 0, sarama.OffsetNewest, 1000),
+		"FetchRequest": sarama.NewMockWrapper(fetchResponse),
+	})
+
+	config := sarama.NewConfig()
+	config.Consumer.Retry.Backoff = 50 * time.Millisecond
+	config.Consumer.Return.Errors = true
+	client, _ := sarama.NewClient([]string{broker0.Addr()}, config)
+	defer client.Close()
+	s.cfg.Consumer.FatalBackOffTimeout = 500 * time.Millisecond
+	errStats := NewErrStats()
+	f, err := SpawnFactory(s.ns, s.cfg, client, errStats, nil)
+	c.Assert(err, IsNil)
+	defer f.Stop()
+
+	pc, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 0), "my_topic", 0, sarama.OffsetOldest)
+	c.Assert(err, IsNil)
+	defer pc.Stop()
+	c.Assert((<-pc.Errors()).Err, Equals, sarama.ErrTopicAuthorizationFailed)
+	begin := time.Now()
+
+	// When
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 123, testMsg),
+	})
+
+	// Then
+	c.Assert((<-pc.Messages()).Offset, Equals, int64(123))
+	c.Assert(time.Since(begin) > 400*time.Millisecond, Equals, true)
+	c.Assert(errStats.Counts()[ErrClassFatal], Equals, int64(1))
+}
+
+// If a partition is reassigned to another broker while a fetch request is
+// pending, then the pending request is abandoned and messages are fetched from
+// the new broker right away.
+func (s *MsgIStreamSuite) TestReassignWhileFetchPending(c *C) {
+	// Given
+	broker0 := sarama.NewMockBroker(c, 0)
+	defer broker0.Close()
+	broker1 := sarama.NewMockBroker(c, 1)
+	defer broker1.Close()
+	broker1.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetBroker(broker1.Addr(), broker1.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+	})
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(c).
+			SetOffset("my_topic", 0, sarama.OffsetOldest, 123).
+			SetOffset("my_topic", 0, sarama.OffsetNewest, 1000),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 123, testMsg),
+	})
+
+	// Metadata is always requested from broker1, since it is the only seed.
+	client, _ := sarama.NewClient([]string{broker1.Addr()}, sarama.NewConfig())
+	defer client.Close()
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, nil)
+	c.Assert(err, IsNil)
+	defer f.Stop()
+
+	pc, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 0), "my_topic", 0, sarama.OffsetOldest)
+	c.Assert(err, IsNil)
+	defer pc.Stop()
+	c.Assert((<-pc.Messages()).Offset, Equals, int64(123))
+
+	// Make the next fetch from broker0 hang for awhile.
+	broker0.SetLatency(3 * time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	// When
+	broker1.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetBroker(broker1.Addr(), broker1.BrokerID()).
+			SetLeader("my_topic", 0, broker1.BrokerID()),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 124, testMsg),
+	})
+	begin := time.Now()
+	f.(*factory).mapper.WorkerReassign() <- pc.(*msgIStream)
+
+	// Then
+	c.Assert((<-pc.Messages()).Offset, Equals, int64(124))
+	c.Assert(time.Since(begin) < time.Second, Equals, true)
+}
+
+// Fetch requests are accounted per broker, and fetched bytes per partition.
+func (s *MsgIStreamSuite) TestBrokerStats(c *C) {
+	// Given
+	broker0 := sarama.NewMockBroker(c, 0)
+	defer broker0.Close()
+	broker0.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()).
+			SetLeader("my_topic", 1, broker0.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(c).
+			SetOffset("my_topic", 0, sarama.OffsetOldest, 0).
+			SetOffset("my_topic", 0, sarama.OffsetNewest, 1000).
+			SetOffset("my_topic", 1, sarama.OffsetOldest, 0).
+			SetOffset("my_topic", 1, sarama.OffsetNewest, 1000),
+		"FetchRequest": sarama.NewMockFetchResponse(c, 1).
+			SetMessage("my_topic", 0, 0, sarama.StringEncoder("Foo")).
+			SetMessage("my_topic", 1, 0, sarama.StringEncoder("Bazz")),
+	})
+
+	client, _ := sarama.NewClient([]string{broker0.Addr()}, sarama.NewConfig())
+	defer client.Close()
+	brokerStats := NewBrokerStats()
+	f, err := SpawnFactory(s.ns, s.cfg, client, nil, brokerStats)
+	c.Assert(err, IsNil)
+	defer f.Stop()
+
+	// When
+	pc0, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 0), "my_topic", 0, sarama.OffsetOldest)
+	c.Assert(err, IsNil)
+	defer pc0.Stop()
+	c.Assert((<-pc0.Messages()).Offset, Equals, int64(0))
+	pc1, _, err := f.SpawnMessageIStream(s.ns.NewChild("my_topic", 1), "my_topic", 1, sarama.OffsetOldest)
+	c.Assert(err, IsNil)
+	defer pc1.Stop()
+	c.Assert((<-pc1.Messages()).Offset, Equals, int64(0))
+
+	// Then
+	stat := brokerStats.Snapshot()[broker0.BrokerID()]
+	c.Assert(stat.Addr, Equals, broker0.Addr())
+	c.Assert(stat.Fetches >= 2, Equals, true)
+	c.Assert(stat.Errors, Equals, int64(0))
+	c.Assert(stat.Bytes, Equals, int64(7))
+	c.Assert(stat.MaxLatencyMs >= stat.AvgLatencyMs, Equals, true)
+	c.Assert(len(stat.Partitions), Equals, 2)
+	c.Assert(stat.Partitions[0].Partition, Equals, int32(0))
+	c.Assert(stat.Partitions[0].Bytes, Equals, int64(3))
+	c.Assert(stat.Partitions[1].Partition, Equals, int32(1))
+	c.Assert(stat.Partitions[1].Bytes, Equals, int64(4))
+	c.Assert(stat.Partitions[1].Share, Equals, 4.0/7.0)
+}
+
+func (s *MsgIStreamSuite) TestBrokerStatsNil(c *C) {
+	var brokerStats *BrokerStats
+	c.Assert(brokerStats.Snapshot(), DeepEquals, map[int32]consumer.BrokerStat{})
+}
+
+func (s *MsgIStreamSuite) TestClassifyErr(c *C) {
+	for i, tc := range []struct {
+		err   error
+		class string
+	}{
+		{sarama.ErrRequestTimedOut, ErrClassTransient},
+		{sarama.ErrIncompleteResponse, ErrClassTransient},
+		{sarama.ErrNotLeaderForPartition, ErrClassLeadership},
+		{sarama.ErrLeaderNotAvailable, ErrClassLeadership},
+		{sarama.ErrOutOfBrokers, ErrClassLeadership},
+		{sarama.ErrInvalidTopic, ErrClassFatal},
+		{sarama.ErrUnknownMemberId, ErrClassFatal},
+		{sarama.ErrTopicAuthorizationFailed, ErrClassFatal},
+	} {
+		c.Assert(ClassifyErr(tc.err), Equals, tc.class, Commentf("case #%d", i))
+	}
+}
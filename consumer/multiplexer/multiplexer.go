@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/consumer"
@@ -15,14 +16,24 @@ import (
 // preferences to inputs with higher lag. Multiplexes assumes ownership over
 // inputs in the sense that it decides when an new input instance needs to
 // started, or the old one stopped.
+//
+// Inputs that implement `Notifier` are only checked for messages when they
+// report that they have one, much like file descriptors registered with
+// epoll, and only inputs that have a message are considered when the next
+// message to send to the output is selected. So the cost of multiplexing a
+// message does not grow with the number of idle inputs, that allows to
+// multiplex thousands of partitions. Inputs that do not implement `Notifier`
+// are polled every time a message is multiplexed.
 type T struct {
-	actorID   *actor.ID
-	spawnInFn SpawnInFn
-	inputs    map[int32]*input
-	output    Out
-	isRunning bool
-	stopCh    chan none.T
-	wg        sync.WaitGroup
+	actorID     *actor.ID
+	spawnInFn   SpawnInFn
+	concurrency int
+	inputs      map[int32]*input
+	ready       *readySet
+	output      Out
+	isRunning   bool
+	stopCh      chan none.T
+	wg          sync.WaitGroup
 }
 
 // In defines an interface of a multiplexer input.
@@ -36,6 +47,14 @@ type In interface {
 	Stop()
 }
 
+// Notifier is an optional interface of a multiplexer input. An input that
+// implements it must call the function passed to `NotifyOnMessage` every time
+// after it makes a message available in, or closes, the `Messages()` channel.
+// The function is safe to call from any goroutine and never blocks.
+type Notifier interface {
+	NotifyOnMessage(notifyFn func())
+}
+
 // Out defines an interface of multiplexer output.
 type Out interface {
 	// Messages returns channel that multiplexer sends messages to.
@@ -46,13 +65,16 @@ type Out interface {
 // assigned partitions during rewiring.
 type SpawnInFn func(partition int32) In
 
-// New creates a new multiplexer instance.
-func New(namespace *actor.ID, spawnInFn SpawnInFn) *T {
+// New creates a new multiplexer instance. Inputs are spawned and stopped
+// during rewiring at most `concurrency` at a time.
+func New(namespace *actor.ID, spawnInFn SpawnInFn, concurrency int) *T {
 	return &T{
-		actorID:   namespace.NewChild("mux"),
-		inputs:    make(map[int32]*input),
-		spawnInFn: spawnInFn,
-		stopCh:    make(chan none.T),
+		actorID:     namespace.NewChild("mux"),
+		inputs:      make(map[int32]*input),
+		ready:       newReadySet(),
+		spawnInFn:   spawnInFn,
+		concurrency: concurrency,
+		stopCh:      make(chan none.T),
 	}
 }
 
@@ -61,6 +83,7 @@ func New(namespace *actor.ID, spawnInFn SpawnInFn) *T {
 type input struct {
 	In
 	partition int32
+	notifies  bool
 	msg       consumer.Message
 	msgOk     bool
 }
@@ -80,47 +103,52 @@ func (m *T) IsRunning() bool {
 //
 // WARNING: do not ever pass (*T)(nil) in output, that will cause panic.
 func (m *T) WireUp(output Out, assigned []int32) {
-	var wg sync.WaitGroup
-
+	begin := time.Now()
 	if m.output != output {
 		m.stopIfRunning()
 		m.output = output
 	}
-	// If output is not provided, then stop all inputs and return.
-	if output == nil {
-		for p, in := range m.inputs {
-			wg.Add(1)
-			go func(in *input) {
-				defer wg.Done()
-				in.Stop()
-			}(in)
-			delete(m.inputs, p)
-		}
-		wg.Wait()
-		return
+	// Stop inputs that are not assigned anymore, that is all of them if
+	// output is not provided.
+	isAssigned := make(map[int32]bool, len(assigned))
+	for _, p := range assigned {
+		isAssigned[p] = true
 	}
-	// Stop inputs that are not assigned anymore.
+	var stoppedIns []*input
 	for p, in := range m.inputs {
-		if !hasPartition(p, assigned) {
-			m.stopIfRunning()
-			wg.Add(1)
-			go func(in *input) {
-				defer wg.Done()
-				in.Stop()
-			}(in)
-			delete(m.inputs, p)
+		if output == nil || !isAssigned[p] {
+			stoppedIns = append(stoppedIns, in)
 		}
 	}
-	wg.Wait()
-	// Spawn newly assigned inputs, but stop multiplexer before spawning the
-	// first input.
-	for _, p := range assigned {
-		if _, ok := m.inputs[p]; !ok {
-			m.stopIfRunning()
-			m.inputs[p] = &input{In: m.spawnInFn(p), partition: p}
+	if len(stoppedIns) > 0 {
+		m.stopIfRunning()
+		for _, in := range stoppedIns {
+			delete(m.inputs, in.partition)
+		}
+		m.runBounded(len(stoppedIns), func(i int) { stoppedIns[i].Stop() })
+	}
+	// Spawn newly assigned inputs, but stop multiplexer before spawning.
+	var spawnedPartitions []int32
+	if output != nil {
+		for _, p := range assigned {
+			if _, ok := m.inputs[p]; !ok {
+				spawnedPartitions = append(spawnedPartitions, p)
+			}
+		}
+	}
+	if len(spawnedPartitions) > 0 {
+		m.stopIfRunning()
+		spawnedIns := make([]*input, len(spawnedPartitions))
+		m.runBounded(len(spawnedPartitions), func(i int) { spawnedIns[i] = m.spawnIn(spawnedPartitions[i]) })
+		for i, p := range spawnedPartitions {
+			m.inputs[p] = spawnedIns[i]
 		}
 	}
-	if !m.IsRunning() && len(m.inputs) > 0 {
+	if len(stoppedIns) > 0 || len(spawnedPartitions) > 0 {
+		log.Infof("<%s> rewired: stopped=%d, spawned=%d, took=%s",
+			m.actorID, len(stoppedIns), len(spawnedPartitions), time.Since(begin))
+	}
+	if output != nil && !m.IsRunning() && len(m.inputs) > 0 {
 		m.start()
 	}
 }
@@ -130,6 +158,44 @@ func (m *T) Stop() {
 	m.WireUp(nil, nil)
 }
 
+// spawnIn spawns an input for a partition. If the input is a notifier, then
+// it is checked for a message once anyway, for it could have made one
+// available before the notification function was registered.
+func (m *T) spawnIn(partition int32) *input {
+	in := &input{In: m.spawnInFn(partition), partition: partition}
+	if notifier, ok := in.In.(Notifier); ok {
+		in.notifies = true
+		notifier.NotifyOnMessage(func() { m.ready.add(partition) })
+		m.ready.add(partition)
+	}
+	return in
+}
+
+// runBounded calls fn for indexes from 0 to count-1 in parallel, but at most
+// `m.concurrency` at a time, and waits for all calls to complete.
+func (m *T) runBounded(count int, fn func(i int)) {
+	concurrency := m.concurrency
+	if concurrency <= 0 || concurrency > count {
+		concurrency = count
+	}
+	var wg sync.WaitGroup
+	nextCh := make(chan int, count)
+	for i := 0; i < count; i++ {
+		nextCh <- i
+	}
+	close(nextCh)
+	for j := 0; j < concurrency; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range nextCh {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func (m *T) start() {
 	actor.Spawn(m.actorID, &m.wg, m.run)
 	m.isRunning = true
@@ -150,62 +216,174 @@ reset:
 		return
 	}
 	sortedIns := makeSortedIns(m.inputs)
+	// Inputs that have a message fetched, sorted in ascending order of
+	// partition ids.
+	var pendingIns []*input
+	// Inputs that do not notify have to be polled. Inputs that do are all
+	// checked once after a reset, for notifications taken before the reset
+	// could have been left unprocessed.
+	var polledIns []*input
+	var notified []int32
+	for _, in := range sortedIns {
+		if in.msgOk {
+			pendingIns = append(pendingIns, in)
+		}
+		if in.notifies {
+			notified = append(notified, in.partition)
+		} else {
+			polledIns = append(polledIns, in)
+		}
+	}
 	// Prepare a list of reflective select cases. It is used when none of the
-	// inputs has fetched messages and we need to wait on all of them. Yes,
-	// reflection is slow, but it is only used when there is nothing to
-	// consume anyway.
-	selectCases := make([]reflect.SelectCase, inputCount+1)
-	for i, in := range sortedIns {
+	// inputs has fetched messages and we need to wait on all polled inputs
+	// and notifications. Yes, reflection is slow, but it is only used when
+	// there is nothing to consume anyway.
+	polledCount := len(polledIns)
+	selectCases := make([]reflect.SelectCase, polledCount+2)
+	for i, in := range polledIns {
 		selectCases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(in.Messages())}
 	}
-	selectCases[inputCount] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(m.stopCh)}
+	selectCases[polledCount] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(m.ready.wakeCh)}
+	selectCases[polledCount+1] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(m.stopCh)}
 
-	inputIdx := -1
+	prevPartition := int32(-1)
 	for {
-		// Collect next messages from inputs that have them available.
-		isAtLeastOneAvailable := false
-		for _, in := range sortedIns {
+		// Collect next messages from inputs that reported having them, and
+		// from polled inputs that have them available.
+		notified = m.ready.take(notified)
+		for _, p := range notified {
+			in := m.inputs[p]
+			if in == nil || !in.notifies || in.msgOk {
+				continue
+			}
+			if !m.fetch(in, &pendingIns) {
+				goto reset
+			}
+		}
+		notified = notified[:0]
+		for _, in := range polledIns {
 			if in.msgOk {
-				isAtLeastOneAvailable = true
 				continue
 			}
-			select {
-			case msg, ok := <-in.Messages():
-				// If a channel of an input is closed, then the input should be
-				// removed from the list of multiplexed inputs.
-				if !ok {
-					log.Infof("<%s> input channel closed: partition=%d", m.actorID, in.partition)
-					delete(m.inputs, in.partition)
-					goto reset
-				}
-				in.msg = msg
-				in.msgOk = true
-				isAtLeastOneAvailable = true
-			default:
+			if !m.fetch(in, &pendingIns) {
+				goto reset
 			}
 		}
 		// If none of the inputs has a message available, then wait until
 		// a message is fetched on any of them or a stop signal is received.
-		if !isAtLeastOneAvailable {
-			idx, value, _ := reflect.Select(selectCases)
-			// Check if it is a stop signal.
-			if idx == inputCount {
+		if len(pendingIns) == 0 {
+			if polledCount == 0 {
+				select {
+				case <-m.ready.wakeCh:
+					continue
+				case <-m.stopCh:
+					return
+				}
+			}
+			idx, value, ok := reflect.Select(selectCases)
+			switch idx {
+			case polledCount:
+				continue
+			case polledCount + 1:
 				return
 			}
-			sortedIns[idx].msg = value.Interface().(consumer.Message)
-			sortedIns[idx].msgOk = true
+			in := polledIns[idx]
+			if !ok {
+				log.Infof("<%s> input channel closed: partition=%d", m.actorID, in.partition)
+				delete(m.inputs, in.partition)
+				goto reset
+			}
+			in.msg = value.Interface().(consumer.Message)
+			in.msgOk = true
+			pendingIns = insertPending(pendingIns, in)
 		}
 		// At this point there is at least one message available.
-		inputIdx = selectInput(inputIdx, sortedIns)
+		prevIdx := sort.Search(len(pendingIns), func(i int) bool {
+			return pendingIns[i].partition > prevPartition
+		}) - 1
+		pendingIdx := selectInput(prevIdx, pendingIns)
+		in := pendingIns[pendingIdx]
 		// Block until the output reads the next message of the selected input
 		// or a stop signal is received.
 		select {
 		case <-m.stopCh:
 			return
-		case m.output.Messages() <- sortedIns[inputIdx].msg:
-			sortedIns[inputIdx].msgOk = false
+		case m.output.Messages() <- in.msg:
+			in.msgOk = false
+			pendingIns = append(pendingIns[:pendingIdx], pendingIns[pendingIdx+1:]...)
+			prevPartition = in.partition
+		}
+	}
+}
+
+// fetch receives a message from the input if one is available, and adds the
+// input to the pending inputs. If the input channel is closed then the input
+// is removed and false is returned.
+func (m *T) fetch(in *input, pendingIns *[]*input) bool {
+	select {
+	case msg, ok := <-in.Messages():
+		// If a channel of an input is closed, then the input should be
+		// removed from the list of multiplexed inputs.
+		if !ok {
+			log.Infof("<%s> input channel closed: partition=%d", m.actorID, in.partition)
+			delete(m.inputs, in.partition)
+			return false
 		}
+		in.msg = msg
+		in.msgOk = true
+		*pendingIns = insertPending(*pendingIns, in)
+	default:
 	}
+	return true
+}
+
+// insertPending inserts an input to a slice of inputs sorted in ascending
+// order of partition ids.
+func insertPending(pendingIns []*input, in *input) []*input {
+	i := sort.Search(len(pendingIns), func(i int) bool {
+		return pendingIns[i].partition > in.partition
+	})
+	pendingIns = append(pendingIns, nil)
+	copy(pendingIns[i+1:], pendingIns[i:])
+	pendingIns[i] = in
+	return pendingIns
+}
+
+// readySet collects partitions of inputs that have notified about available
+// messages since the last time it was taken. The wake channel has a pending
+// signal if the set is not empty.
+type readySet struct {
+	mu         sync.Mutex
+	partitions []int32
+	wakeCh     chan none.T
+}
+
+func newReadySet() *readySet {
+	return &readySet{wakeCh: make(chan none.T, 1)}
+}
+
+func (rs *readySet) add(partition int32) {
+	rs.mu.Lock()
+	rs.partitions = append(rs.partitions, partition)
+	rs.mu.Unlock()
+	select {
+	case rs.wakeCh <- none.V:
+	default:
+	}
+}
+
+// take returns the set partitions appended to `buf`, and clears the set. The
+// returned partitions may contain duplicates.
+func (rs *readySet) take(buf []int32) []int32 {
+	select {
+	case <-rs.wakeCh:
+	default:
+	}
+	rs.mu.Lock()
+	buf = append(buf, rs.partitions...)
+	rs.partitions = rs.partitions[:0]
+	rs.mu.Unlock()
+	return buf
 }
 
 // makeSortedIns given a partition->input map returns a slice of all the inputs
@@ -223,14 +401,6 @@ func makeSortedIns(inputs map[int32]*input) []*input {
 	return sortedIns
 }
 
-func hasPartition(partition int32, partitions []int32) bool {
-	count := len(partitions)
-	if count == 0 {
-		return false
-	}
-	return partitions[0] <= partition && partition <= partitions[count-1]
-}
-
 // selectInput picks an input that should be multiplexed next. It prefers the
 // inputs with the largest lag. If there is more then one input with the same
 // largest lag, then it picks the one that has index following prevSelectedIdx.
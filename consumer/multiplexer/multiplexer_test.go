@@ -1,6 +1,8 @@
 package multiplexer
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -103,7 +105,7 @@ func (s *MultiplexerSuite) TestOneInput(c *C) {
 		),
 	}
 	out := newMockOut(100)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 
 	// When
@@ -139,7 +141,7 @@ func (s *MultiplexerSuite) TestSameLag(c *C) {
 			msg(4001, 1),
 		)}
 	out := newMockOut(100)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 
 	// When
@@ -180,7 +182,7 @@ func (s *MultiplexerSuite) TestLargeLagPreferred(c *C) {
 		),
 	}
 	out := newMockOut(100)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	m.Stop()
 
 	// When
@@ -205,7 +207,7 @@ func (s *MultiplexerSuite) TestNoMessages(c *C) {
 		3: newMockIn(),
 	}
 	out := newMockOut(100)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	m.WireUp(out, []int32{1, 2, 3})
 
@@ -233,7 +235,7 @@ func (s *MultiplexerSuite) TestWireUp(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(100)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 
@@ -260,7 +262,7 @@ func (s *MultiplexerSuite) TestWireUpAdd(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -289,7 +291,7 @@ func (s *MultiplexerSuite) TestWireUpRemove(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -316,7 +318,7 @@ func (s *MultiplexerSuite) TestWireUpAddRemove(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -335,6 +337,32 @@ func (s *MultiplexerSuite) TestWireUpAddRemove(c *C) {
 	}
 }
 
+// Inputs of partitions that are not assigned anymore are stopped, even if
+// they lie between assigned partitions, as non-range assignors produce
+// non-contiguous assignments.
+func (s *MultiplexerSuite) TestWireUpRemoveNonContiguous(c *C) {
+	ins := map[int32]In{
+		0: newMockIn(),
+		1: newMockIn(),
+		2: newMockIn(),
+		3: newMockIn(),
+		4: newMockIn(),
+	}
+	out := newMockOut(0)
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
+	defer m.Stop()
+	m.WireUp(out, []int32{0, 1, 2, 3, 4})
+
+	// When
+	m.WireUp(out, []int32{0, 2, 4})
+
+	// Then
+	for p, in := range ins {
+		wantStopped := p == 1 || p == 3
+		c.Assert(in.(*mockIn).isStopped(), Equals, wantStopped, Commentf("partition=%d", p))
+	}
+}
+
 func (s *MultiplexerSuite) TestWireUpSame(c *C) {
 	ins := map[int32]In{
 		1: newMockIn(msg(1001, 1)),
@@ -344,7 +372,7 @@ func (s *MultiplexerSuite) TestWireUpSame(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -372,7 +400,7 @@ func (s *MultiplexerSuite) TestWireUpEmpty(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -398,7 +426,7 @@ func (s *MultiplexerSuite) TestWireUpNil(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out, []int32{2, 4})
@@ -425,7 +453,7 @@ func (s *MultiplexerSuite) TestWireUpOutChanged(c *C) {
 	}
 	out1 := newMockOut(0)
 	out2 := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out1, []int32{2, 4})
@@ -458,7 +486,7 @@ func (s *MultiplexerSuite) TestWireUpOutNil(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out1 := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	c.Assert(m.IsRunning(), Equals, false)
 	m.WireUp(out1, []int32{2, 4})
@@ -484,7 +512,7 @@ func (s *MultiplexerSuite) TestStop(c *C) {
 		5: newMockIn(msg(5001, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	m.WireUp(out, []int32{2, 4})
 	c.Assert(m.IsRunning(), Equals, true)
 
@@ -515,7 +543,7 @@ func (s *MultiplexerSuite) TestInputChanClose(c *C) {
 			msg(3003, 1)),
 	}
 	out := newMockOut(0)
-	m := New(s.ns, func(p int32) In { return ins[p] })
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
 	defer m.Stop()
 	m.WireUp(out, []int32{1, 2, 3})
 	c.Assert(m.IsRunning(), Equals, true)
@@ -533,8 +561,153 @@ func (s *MultiplexerSuite) TestInputChanClose(c *C) {
 	checkMsg(c, out.messagesCh, msg(3003, 1))
 }
 
+// Inputs that notify about messages are checked when they notify, and their
+// messages are multiplexed preferring the largest lag, as with polled inputs.
+func (s *MultiplexerSuite) TestNotifierLargeLagPreferred(c *C) {
+	ins := map[int32]In{
+		1: newMockNotifierIn(msg(1001, 1)),
+		2: newMockNotifierIn(msg(2001, 3)),
+		3: newMockNotifierIn(msg(3001, 2)),
+	}
+	out := newMockOut(100)
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
+	defer m.Stop()
+
+	// When
+	m.WireUp(out, []int32{1, 2, 3})
+
+	// Then
+	checkMsg(c, out.messagesCh, msg(2001, 3))
+	checkMsg(c, out.messagesCh, msg(3001, 2))
+	checkMsg(c, out.messagesCh, msg(1001, 1))
+}
+
+// If no input has a message available, then multiplexer waits for a
+// notification, and a message is not noticed until the input notifies.
+func (s *MultiplexerSuite) TestNotifierNoMessages(c *C) {
+	// Given
+	ins := map[int32]In{
+		1: newMockNotifierIn(msg(1001, 1)),
+		2: newMockNotifierIn(),
+		3: newMockNotifierIn(),
+	}
+	out := newMockOut(100)
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
+	defer m.Stop()
+	m.WireUp(out, []int32{1, 2, 3})
+	checkMsg(c, out.messagesCh, msg(1001, 1))
+
+	// When
+	ins[3].(*mockNotifierIn).messagesCh <- msg(3001, 1)
+
+	// Then
+	select {
+	case msg := <-out.messagesCh:
+		c.Errorf("Unexpected message: %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// When
+	ins[3].(*mockNotifierIn).notify()
+
+	// Then
+	checkMsg(c, out.messagesCh, msg(3001, 1))
+}
+
+// Inputs that notify and inputs that are polled can be multiplexed together.
+func (s *MultiplexerSuite) TestNotifierMixed(c *C) {
+	// Given
+	ins := map[int32]In{
+		1: newMockIn(),
+		2: newMockNotifierIn(),
+	}
+	out := newMockOut(100)
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
+	defer m.Stop()
+	m.WireUp(out, []int32{1, 2})
+
+	// When
+	ins[2].(*mockNotifierIn).messagesCh <- msg(2001, 1)
+	ins[2].(*mockNotifierIn).notify()
+
+	// Then
+	checkMsg(c, out.messagesCh, msg(2001, 1))
+
+	// When
+	ins[1].(*mockIn).messagesCh <- msg(1001, 1)
+
+	// Then
+	checkMsg(c, out.messagesCh, msg(1001, 1))
+}
+
+// If a channel of an input that notifies is closed, then the input is removed
+// from rotation.
+func (s *MultiplexerSuite) TestNotifierInputChanClose(c *C) {
+	// Given
+	ins := map[int32]In{
+		1: newMockNotifierIn(),
+		2: newMockNotifierIn(),
+	}
+	out := newMockOut(100)
+	m := New(s.ns, func(p int32) In { return ins[p] }, 4)
+	defer m.Stop()
+	m.WireUp(out, []int32{1, 2})
+
+	// When
+	close(ins[1].(*mockNotifierIn).messagesCh)
+	ins[1].(*mockNotifierIn).notify()
+	ins[2].(*mockNotifierIn).messagesCh <- msg(2001, 1)
+	ins[2].(*mockNotifierIn).notify()
+
+	// Then
+	checkMsg(c, out.messagesCh, msg(2001, 1))
+}
+
+// Inputs are spawned in parallel, but no more than the configured concurrency
+// at a time.
+func (s *MultiplexerSuite) TestWireUpConcurrency(c *C) {
+	var mu sync.Mutex
+	spawning, maxSpawning := 0, 0
+	m := New(s.ns, func(p int32) In {
+		mu.Lock()
+		spawning++
+		if spawning > maxSpawning {
+			maxSpawning = spawning
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		spawning--
+		mu.Unlock()
+		return newMockIn()
+	}, 3)
+	defer m.Stop()
+
+	// When
+	m.WireUp(newMockOut(0), []int32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+
+	// Then
+	c.Assert(m.IsRunning(), Equals, true)
+	c.Assert(len(m.inputs), Equals, 10)
+	c.Assert(maxSpawning, Equals, 3)
+}
+
+func (s *MultiplexerSuite) TestInsertPending(c *C) {
+	in1, in3, in5 := &input{partition: 1}, &input{partition: 3}, &input{partition: 5}
+	var pendingIns []*input
+
+	// When
+	pendingIns = insertPending(pendingIns, in3)
+	pendingIns = insertPending(pendingIns, in5)
+	pendingIns = insertPending(pendingIns, in1)
+
+	// Then
+	c.Assert(pendingIns, DeepEquals, []*input{in1, in3, in5})
+}
+
 type mockIn struct {
 	messagesCh chan consumer.Message
+	stopped    int32
 }
 
 func newMockIn(messages ...consumer.Message) *mockIn {
@@ -554,6 +727,11 @@ func (mi *mockIn) Messages() <-chan consumer.Message {
 
 // implements `In`
 func (mi *mockIn) Stop() {
+	atomic.StoreInt32(&mi.stopped, 1)
+}
+
+func (mi *mockIn) isStopped() bool {
+	return atomic.LoadInt32(&mi.stopped) == 1
 }
 
 type mockOut struct {
@@ -588,3 +766,42 @@ func lag(lag int64) consumer.Message {
 func checkMsg(c *C, outCh chan consumer.Message, want consumer.Message) {
 	c.Assert(<-outCh, DeepEquals, want)
 }
+
+type mockNotifierIn struct {
+	messagesCh chan consumer.Message
+	mu         sync.Mutex
+	notifyFn   func()
+}
+
+func newMockNotifierIn(messages ...consumer.Message) *mockNotifierIn {
+	mi := mockNotifierIn{
+		messagesCh: make(chan consumer.Message, len(messages)+1),
+	}
+	for _, m := range messages {
+		mi.messagesCh <- m
+	}
+	return &mi
+}
+
+// implements `In`
+func (mi *mockNotifierIn) Messages() <-chan consumer.Message {
+	return mi.messagesCh
+}
+
+// implements `In`
+func (mi *mockNotifierIn) Stop() {
+}
+
+// implements `Notifier`
+func (mi *mockNotifierIn) NotifyOnMessage(notifyFn func()) {
+	mi.mu.Lock()
+	mi.notifyFn = notifyFn
+	mi.mu.Unlock()
+}
+
+func (mi *mockNotifierIn) notify() {
+	mi.mu.Lock()
+	notifyFn := mi.notifyFn
+	mi.mu.Unlock()
+	notifyFn()
+}
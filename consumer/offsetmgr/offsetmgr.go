@@ -3,11 +3,13 @@ package offsetmgr
 import (
 	"errors"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer/mapper"
 	"github.com/mailgun/log"
@@ -35,6 +37,18 @@ type Factory interface {
 	// that all spawned offset managers has to be explicitly stopped by calling
 	// their Stop method.
 	Stop()
+
+	// Coordinators returns the current offset coordinator of every consumer
+	// group that offset managers have been spawned for, sorted by group.
+	Coordinators() []CoordinatorStatus
+
+	// SetGeneration makes offsets of the group be committed on behalf of the
+	// specified member of the specified group generation. Kafka rejects
+	// commits to groups that have members joined via the group coordinator
+	// unless they come from a member of the current generation. Pass an
+	// empty member ID and `sarama.GroupGenerationUndefined` to commit
+	// offsets without membership.
+	SetGeneration(group, memberID string, generationID int32)
 }
 
 // T provides interface to store and retrieve offsets for a particular
@@ -81,16 +95,36 @@ type OffsetCommitError struct {
 	Err       error
 }
 
+// CoordinatorStatus describes the broker that is currently the offset
+// coordinator of a consumer group, along with stats of coordinator changes.
+type CoordinatorStatus struct {
+	Group      string    `json:"group"`
+	BrokerID   int32     `json:"broker_id"`
+	BrokerAddr string    `json:"broker_addr"`
+	Since      time.Time `json:"since"`
+	// How many times the coordinator has moved to another broker.
+	Moves int64 `json:"moves"`
+	// How many times offset managers of the group had to be reassigned to
+	// a coordinator, e.g. to reroute commits when it moved.
+	Reassigns     int64     `json:"reassigns"`
+	Errors        int64     `json:"errors"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+}
+
 var ErrNoCoordinator = errors.New("failed to resolve coordinator")
 var ErrRequestTimeout = errors.New("request timeout")
 
 // SpawnFactory creates a new offset manager factory from the given client.
 func SpawnFactory(namespace *actor.ID, cfg *config.Proxy, kafkaClt sarama.Client) Factory {
 	f := &factory{
-		namespace: namespace.NewChild("offset_mgr_f"),
-		kafkaClt:  kafkaClt,
-		cfg:       cfg,
-		children:  make(map[instanceID]*offsetMgr),
+		namespace:   namespace.NewChild("offset_mgr_f"),
+		kafkaClt:    kafkaClt,
+		cfg:         cfg,
+		children:    make(map[instanceID]*offsetMgr),
+		coords:      make(map[string]*CoordinatorStatus),
+		stale:       make(map[string]bool),
+		generations: make(map[string]generation),
 	}
 	f.mapper = mapper.Spawn(f.namespace, f)
 	return f
@@ -105,11 +139,23 @@ type factory struct {
 	mapper       *mapper.T
 	children     map[instanceID]*offsetMgr
 	childrenLock sync.Mutex
+	coords       map[string]*CoordinatorStatus
+	stale        map[string]bool
+	coordsLock   sync.Mutex
+	generations  map[string]generation
+	genLock      sync.Mutex
 
 	// To be used in tests only!
 	testReportErrors bool
 }
 
+// generation identifies a member of a consumer group generation, on behalf of
+// which offsets of the group are committed.
+type generation struct {
+	memberID string
+	id       int32
+}
+
 type instanceID struct {
 	group     string
 	topic     string
@@ -134,29 +180,43 @@ func (f *factory) SpawnOffsetManager(namespace *actor.ID, group, topic string, p
 // implements `mapper.Resolver`.
 func (f *factory) ResolveBroker(pw mapper.Worker) (*sarama.Broker, error) {
 	om := pw.(*offsetMgr)
-	if err := f.kafkaClt.RefreshCoordinator(om.id.group); err != nil {
-		return nil, err
+	// All offset managers of a group are resolved to the same coordinator,
+	// so it is only refreshed when the group is new or some of its offset
+	// managers requested reassignment. Otherwise a group joining with many
+	// partitions would query the coordinator as many times.
+	if f.takeStale(om.id.group) {
+		if err := f.kafkaClt.RefreshCoordinator(om.id.group); err != nil {
+			return nil, err
+		}
 	}
 
 	brokerConn, err := f.kafkaClt.Coordinator(om.id.group)
 	if err != nil {
 		return nil, err
 	}
+	f.onCoordinatorResolved(om.id.group, brokerConn)
 	return brokerConn, nil
 }
 
 // implements `mapper.Resolver`.
 func (f *factory) SpawnExecutor(brokerConn *sarama.Broker) mapper.Executor {
 	be := &brokerExecutor{
-		aggrActorID:     f.namespace.NewChild("broker", brokerConn.ID(), "aggr"),
-		execActorID:     f.namespace.NewChild("broker", brokerConn.ID(), "exec"),
-		cfg:             f.cfg,
-		conn:            brokerConn,
-		requestsCh:      make(chan submitReq),
-		batchRequestsCh: make(chan map[string]map[instanceID]submitReq),
+		aggrActorID:          f.namespace.NewChild("broker", brokerConn.ID(), "aggr"),
+		execActorID:          f.namespace.NewChild("broker", brokerConn.ID(), "exec"),
+		fetchAggrActorID:     f.namespace.NewChild("broker", brokerConn.ID(), "fetch_aggr"),
+		fetchExecActorID:     f.namespace.NewChild("broker", brokerConn.ID(), "fetch_exec"),
+		cfg:                  f.cfg,
+		conn:                 brokerConn,
+		generationFn:         f.generation,
+		requestsCh:           make(chan submitReq),
+		batchRequestsCh:      make(chan map[string]map[instanceID]submitReq),
+		fetchRequestsCh:      make(chan fetchReq),
+		batchFetchRequestsCh: make(chan map[string][]fetchReq),
 	}
 	actor.Spawn(be.aggrActorID, &be.wg, be.runAggregator)
 	actor.Spawn(be.execActorID, &be.wg, be.runExecutor)
+	actor.Spawn(be.fetchAggrActorID, &be.wg, be.runFetchAggregator)
+	actor.Spawn(be.fetchExecActorID, &be.wg, be.runFetchExecutor)
 	return be
 }
 
@@ -177,6 +237,105 @@ func (f *factory) spawnOffsetManager(namespace *actor.ID, id instanceID) *offset
 	return om
 }
 
+// implements `Factory`
+func (f *factory) Coordinators() []CoordinatorStatus {
+	f.coordsLock.Lock()
+	defer f.coordsLock.Unlock()
+	coords := make([]CoordinatorStatus, 0, len(f.coords))
+	for _, cs := range f.coords {
+		coords = append(coords, *cs)
+	}
+	sort.Slice(coords, func(i, j int) bool { return coords[i].Group < coords[j].Group })
+	return coords
+}
+
+// implements `Factory`
+func (f *factory) SetGeneration(group, memberID string, generationID int32) {
+	f.genLock.Lock()
+	defer f.genLock.Unlock()
+	if generationID == sarama.GroupGenerationUndefined {
+		delete(f.generations, group)
+		return
+	}
+	f.generations[group] = generation{memberID, generationID}
+}
+
+// generation returns the member and the generation of the group that offsets
+// should be committed on behalf of.
+func (f *factory) generation(group string) generation {
+	f.genLock.Lock()
+	defer f.genLock.Unlock()
+	gen, ok := f.generations[group]
+	if !ok {
+		return generation{id: sarama.GroupGenerationUndefined}
+	}
+	return gen
+}
+
+// onCoordinatorResolved records the coordinator that a group offset manager
+// has been assigned to, and logs an event if it is not the same broker that
+// was the group coordinator before.
+func (f *factory) onCoordinatorResolved(group string, brokerConn *sarama.Broker) {
+	f.coordsLock.Lock()
+	defer f.coordsLock.Unlock()
+	cs := f.coordinatorStatus(group)
+	if cs.BrokerID == brokerConn.ID() {
+		return
+	}
+	now := time.Now().UTC()
+	if cs.BrokerID != -1 {
+		log.Warningf("<%s> coordinator moved: group=%s, from=%d(%s), to=%d(%s), after=%s",
+			f.namespace, group, cs.BrokerID, cs.BrokerAddr, brokerConn.ID(), brokerConn.Addr(),
+			now.Sub(cs.Since))
+		cs.Moves++
+	}
+	cs.BrokerID = brokerConn.ID()
+	cs.BrokerAddr = brokerConn.Addr()
+	cs.Since = now
+}
+
+// onCoordinatorError counts an error that an offset manager of a group has
+// got from the group coordinator or while resolving it.
+func (f *factory) onCoordinatorError(group string, err error) {
+	f.coordsLock.Lock()
+	defer f.coordsLock.Unlock()
+	cs := f.coordinatorStatus(group)
+	cs.Errors++
+	cs.LastError = err.Error()
+	cs.LastErrorTime = time.Now().UTC()
+}
+
+// onReassign counts reassignments of offset managers of a group, and makes
+// the group coordinator be refreshed on the next resolution.
+func (f *factory) onReassign(group string) {
+	f.coordsLock.Lock()
+	defer f.coordsLock.Unlock()
+	f.coordinatorStatus(group).Reassigns++
+	f.stale[group] = true
+}
+
+// takeStale tells whether the coordinator of a group has to be refreshed,
+// that is when it has never been resolved or a reassignment has been
+// requested since the last refresh, and clears the stale mark.
+func (f *factory) takeStale(group string) bool {
+	f.coordsLock.Lock()
+	defer f.coordsLock.Unlock()
+	stale := f.stale[group] || f.coordinatorStatus(group).BrokerID == -1
+	delete(f.stale, group)
+	return stale
+}
+
+// coordinatorStatus returns the coordinator status of a group creating it if
+// necessary. It must be called with `coordsLock` held.
+func (f *factory) coordinatorStatus(group string) *CoordinatorStatus {
+	cs := f.coords[group]
+	if cs == nil {
+		cs = &CoordinatorStatus{Group: group, BrokerID: -1}
+		f.coords[group] = cs
+	}
+	return cs
+}
+
 // implements `Factory.Stop()`
 func (f *factory) Stop() {
 	f.mapper.Stop()
@@ -196,6 +355,7 @@ type offsetMgr struct {
 
 	assignedBrokerRequestsCh  chan<- submitReq
 	nilOrBrokerRequestsCh     chan<- submitReq
+	nilOrFetchRequestsCh      chan<- fetchReq
 	nilOrReassignRetryTimerCh <-chan time.Time
 	lastReassignTime          time.Time
 
@@ -251,7 +411,9 @@ func (om *offsetMgr) run() {
 		lastSubmitRequest     = submitReq{offset: lastCommittedOffset}
 		nilOrSubmitRequestsCh = om.submitRequestsCh
 		submitResponseCh      = make(chan submitRes, 1)
+		fetchResponseCh       = make(chan fetchRes, 1)
 		initialOffsetFetched  = false
+		fetchPending          = false
 		stopped               = false
 		commitTicker          = time.NewTicker(om.f.cfg.Consumer.OffsetsCommitInterval)
 		offsetCommitTimeout   = om.f.cfg.Consumer.OffsetsCommitInterval * 3
@@ -270,19 +432,30 @@ func (om *offsetMgr) run() {
 			om.nilOrReassignRetryTimerCh = nil
 			om.assignedBrokerRequestsCh = be.requestsCh
 
-			if !initialOffsetFetched {
-				initialOffset, err := om.fetchInitialOffset(be.conn)
-				if err != nil {
-					om.triggerOrScheduleReassign(err, "failed to fetch initial offset")
-					continue
-				}
-				om.initialOffsetCh <- initialOffset
-				close(om.initialOffsetCh)
-				initialOffsetFetched = true
+			// The initial offset is fetched via the broker executor along
+			// with offsets of other partitions. There can be only one fetch
+			// request pending, if the assignment changes in the meantime
+			// then its outcome decides whether to fetch again.
+			if !initialOffsetFetched && !fetchPending {
+				om.nilOrFetchRequestsCh = be.fetchRequestsCh
 			}
 			if lastSubmitRequest.offset != lastCommittedOffset {
 				om.nilOrBrokerRequestsCh = om.assignedBrokerRequestsCh
 			}
+		case om.nilOrFetchRequestsCh <- fetchReq{id: om.id, resultCh: fetchResponseCh}:
+			om.nilOrFetchRequestsCh = nil
+			fetchPending = true
+
+		case fetchRes := <-fetchResponseCh:
+			fetchPending = false
+			initialOffset, err := om.getFetchedOffset(fetchRes)
+			if err != nil {
+				om.triggerOrScheduleReassign(err, "failed to fetch initial offset")
+				continue
+			}
+			om.initialOffsetCh <- initialOffset
+			close(om.initialOffsetCh)
+			initialOffsetFetched = true
 		case submitReq, ok := <-nilOrSubmitRequestsCh:
 			if !ok {
 				if lastSubmitRequest.offset == lastCommittedOffset {
@@ -297,7 +470,7 @@ func (om *offsetMgr) run() {
 
 		case om.nilOrBrokerRequestsCh <- lastSubmitRequest:
 			om.nilOrBrokerRequestsCh = nil
-			lastSubmitTime = time.Now().UTC()
+			lastSubmitTime = time.Now()
 
 		case submitRes := <-submitResponseCh:
 			if err := om.getCommitError(submitRes.kafkaRes); err != nil {
@@ -310,14 +483,15 @@ func (om *offsetMgr) run() {
 				return
 			}
 		case <-commitTicker.C:
-			isRequestTimeout := time.Now().UTC().Sub(lastSubmitTime) > offsetCommitTimeout
+			isRequestTimeout := time.Since(lastSubmitTime) > offsetCommitTimeout
 			if isRequestTimeout && lastSubmitRequest.offset != lastCommittedOffset {
 				om.triggerOrScheduleReassign(ErrRequestTimeout, "offset commit failed")
 			}
 		case <-om.nilOrReassignRetryTimerCh:
+			om.f.onReassign(om.id.group)
 			om.f.mapper.WorkerReassign() <- om
 			log.Infof("<%s> reassign triggered by timeout", om.actorID)
-			om.nilOrReassignRetryTimerCh = time.After(om.f.cfg.Consumer.BackOffTimeout)
+			om.nilOrReassignRetryTimerCh = backoff.After(om.f.cfg.Consumer.BackOffTimeout, om.f.cfg.Consumer.BackOffJitter)
 		}
 	}
 }
@@ -326,32 +500,25 @@ func (om *offsetMgr) triggerOrScheduleReassign(err error, reason string) {
 	om.reportError(err)
 	om.assignedBrokerRequestsCh = nil
 	om.nilOrBrokerRequestsCh = nil
-	now := time.Now().UTC()
+	om.nilOrFetchRequestsCh = nil
+	now := time.Now()
+	om.f.onCoordinatorError(om.id.group, err)
 	if now.Sub(om.lastReassignTime) > om.f.cfg.Consumer.BackOffTimeout {
 		log.Infof("<%s> trigger reassign: reason=%s, err=(%s)", om.actorID, reason, err)
 		om.lastReassignTime = now
+		om.f.onReassign(om.id.group)
 		om.f.mapper.WorkerReassign() <- om
 	} else {
 		log.Infof("<%s> schedule reassign: reason=%s, err=(%s)", om.actorID, reason, err)
 	}
-	om.nilOrReassignRetryTimerCh = time.After(om.f.cfg.Consumer.BackOffTimeout)
+	om.nilOrReassignRetryTimerCh = backoff.After(om.f.cfg.Consumer.BackOffTimeout, om.f.cfg.Consumer.BackOffJitter)
 }
 
-func (om *offsetMgr) fetchInitialOffset(conn *sarama.Broker) (Offset, error) {
-	request := new(sarama.OffsetFetchRequest)
-	request.Version = 1
-	request.ConsumerGroup = om.id.group
-	request.AddPartition(om.id.topic, om.id.partition)
-
-	response, err := conn.FetchOffset(request)
-	if err != nil {
-		// In case of network error the connection has to be explicitly closed,
-		// otherwise it won't be re-establish and following requests to this
-		// broker will fail as well.
-		_ = conn.Close()
-		return Offset{}, err
+func (om *offsetMgr) getFetchedOffset(res fetchRes) (Offset, error) {
+	if res.err != nil {
+		return Offset{}, res.err
 	}
-	block := response.GetBlock(om.id.topic, om.id.partition)
+	block := res.kafkaRes.GetBlock(om.id.topic, om.id.partition)
 	if block == nil {
 		return Offset{}, sarama.ErrIncompleteResponse
 	}
@@ -403,18 +570,35 @@ type submitRes struct {
 	kafkaRes *sarama.OffsetCommitResponse
 }
 
+type fetchReq struct {
+	id       instanceID
+	resultCh chan<- fetchRes
+}
+
+type fetchRes struct {
+	req      fetchReq
+	kafkaRes *sarama.OffsetFetchResponse
+	err      error
+}
+
 // brokerExecutor aggregates submitted offsets from partition offset managers
-// and periodically commits them to Kafka.
+// and periodically commits them to Kafka. Initial offset fetches are
+// aggregated likewise, but executed as soon as the previous fetch completes.
 //
 // implements `mapper.Executor`.
 type brokerExecutor struct {
-	aggrActorID     *actor.ID
-	execActorID     *actor.ID
-	cfg             *config.Proxy
-	conn            *sarama.Broker
-	requestsCh      chan submitReq
-	batchRequestsCh chan map[string]map[instanceID]submitReq
-	wg              sync.WaitGroup
+	aggrActorID          *actor.ID
+	execActorID          *actor.ID
+	fetchAggrActorID     *actor.ID
+	fetchExecActorID     *actor.ID
+	cfg                  *config.Proxy
+	conn                 *sarama.Broker
+	requestsCh           chan submitReq
+	batchRequestsCh      chan map[string]map[instanceID]submitReq
+	fetchRequestsCh      chan fetchReq
+	batchFetchRequestsCh chan map[string][]fetchReq
+	generationFn         func(group string) generation
+	wg                   sync.WaitGroup
 }
 
 // implements `mapper.Executor`.
@@ -425,6 +609,7 @@ func (be *brokerExecutor) BrokerConn() *sarama.Broker {
 // implements `mapper.Executor`.
 func (be *brokerExecutor) Stop() {
 	close(be.requestsCh)
+	close(be.fetchRequestsCh)
 	be.wg.Wait()
 }
 
@@ -471,15 +656,17 @@ offsetCommitLoop:
 			// Ignore submit requests for awhile after a connection failure to
 			// allow the Kafka cluster some time to recuperate. Ignored requests
 			// will be retried by originating partition offset managers.
-			if time.Now().UTC().Sub(lastErrTime) < be.cfg.Consumer.BackOffTimeout {
+			if time.Since(lastErrTime) < be.cfg.Consumer.BackOffTimeout {
 				continue offsetCommitLoop
 			}
 			nilOrBatchRequestsCh = nil
 			for group, groupRequests := range batchRequest {
+				gen := be.generationFn(group)
 				kafkaReq := &sarama.OffsetCommitRequest{
 					Version:                 1,
 					ConsumerGroup:           group,
-					ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+					ConsumerGroupGeneration: gen.id,
+					ConsumerID:              gen.memberID,
 				}
 				for _, req := range groupRequests {
 					kafkaReq.AddBlock(req.id.topic, req.id.partition, req.offset.Val, sarama.ReceiveTime, req.offset.Meta)
@@ -487,7 +674,7 @@ offsetCommitLoop:
 				var kafkaRes *sarama.OffsetCommitResponse
 				kafkaRes, lastErr = be.conn.CommitOffset(kafkaReq)
 				if lastErr != nil {
-					lastErrTime = time.Now().UTC()
+					lastErrTime = time.Now()
 					be.conn.Close()
 					log.Infof("<%s> connection reset: err=(%v)", be.execActorID, lastErr)
 					continue offsetCommitLoop
@@ -501,6 +688,65 @@ offsetCommitLoop:
 	}
 }
 
+// runFetchAggregator collects initial offset fetch requests of partition
+// offset managers while the fetch executor is busy, so that they are fetched
+// in one request per group. Requests collected by the time the executor is
+// stopped are still passed to it, for partition offset managers wait for a
+// response to every fetch request.
+func (be *brokerExecutor) runFetchAggregator() {
+	defer close(be.batchFetchRequestsCh)
+
+	batchRequests := make(map[string][]fetchReq)
+	var nilOrBatchRequestsCh chan map[string][]fetchReq
+	for {
+		select {
+		case req, ok := <-be.fetchRequestsCh:
+			if !ok {
+				if len(batchRequests) > 0 {
+					be.batchFetchRequestsCh <- batchRequests
+				}
+				return
+			}
+			batchRequests[req.id.group] = append(batchRequests[req.id.group], req)
+			nilOrBatchRequestsCh = be.batchFetchRequestsCh
+		case nilOrBatchRequestsCh <- batchRequests:
+			nilOrBatchRequestsCh = nil
+			batchRequests = make(map[string][]fetchReq)
+		}
+	}
+}
+
+func (be *brokerExecutor) runFetchExecutor() {
+	for batchRequest := range be.batchFetchRequestsCh {
+		be.fetchOffsets(batchRequest)
+	}
+}
+
+// fetchOffsets makes an offset fetch request for every group in the batch and
+// fans responses out to the partition offset managers that requested them.
+func (be *brokerExecutor) fetchOffsets(batch map[string][]fetchReq) {
+	for group, groupRequests := range batch {
+		kafkaReq := &sarama.OffsetFetchRequest{
+			Version:       1,
+			ConsumerGroup: group,
+		}
+		for _, req := range groupRequests {
+			kafkaReq.AddPartition(req.id.topic, req.id.partition)
+		}
+		kafkaRes, err := be.conn.FetchOffset(kafkaReq)
+		if err != nil {
+			// In case of network error the connection has to be explicitly
+			// closed, otherwise it won't be re-establish and following
+			// requests to this broker will fail as well.
+			_ = be.conn.Close()
+			log.Infof("<%s> connection reset: err=(%v)", be.fetchExecActorID, err)
+		}
+		for _, req := range groupRequests {
+			req.resultCh <- fetchRes{req, kafkaRes, err}
+		}
+	}
+}
+
 func (be *brokerExecutor) String() string {
 	if be == nil {
 		return "<nil>"
@@ -66,6 +66,57 @@ func (s *OffsetMgrSuite) TestInitialOffset(c *C) {
 	c.Assert(initialOffset, DeepEquals, Offset{2000, "bar"})
 }
 
+// When a group starts with many partitions, then the coordinator is resolved
+// only once, and initial offsets are fetched in a few requests rather than in
+// one per partition.
+func (s *OffsetMgrSuite) TestInitialOffsetBatched(c *C) {
+	// Given
+	broker1 := sarama.NewMockBroker(c, 101)
+	defer broker1.Close()
+	offsetFetchRes := sarama.NewMockOffsetFetchResponse(c)
+	for p := int32(0); p < 64; p++ {
+		offsetFetchRes.SetOffset("g1", "t1", p, 1000+int64(p), "foo", sarama.ErrNoError)
+	}
+	broker1.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker1.Addr(), broker1.BrokerID()),
+		"ConsumerMetadataRequest": sarama.NewMockConsumerMetadataResponse(c).
+			SetCoordinator("g1", broker1),
+		"OffsetFetchRequest": offsetFetchRes,
+	})
+
+	cfg := testhelpers.NewTestProxyCfg("c1")
+	client, err := sarama.NewClient([]string{broker1.Addr()}, nil)
+	c.Assert(err, IsNil)
+	f := SpawnFactory(s.ns.NewChild(), cfg, client)
+	defer f.Stop()
+
+	// When
+	oms := make([]T, 64)
+	for p := range oms {
+		oms[p], err = f.SpawnOffsetManager(s.ns.NewChild("g1", "t1", p), "g1", "t1", int32(p))
+		c.Assert(err, IsNil)
+	}
+
+	// Then
+	for p, om := range oms {
+		initialOffset := <-om.InitialOffset()
+		c.Assert(initialOffset, DeepEquals, Offset{1000 + int64(p), "foo"})
+		om.Stop()
+	}
+	coordReqCount, fetchReqCount := 0, 0
+	for _, rr := range broker1.History() {
+		switch rr.Request.(type) {
+		case *sarama.ConsumerMetadataRequest:
+			coordReqCount++
+		case *sarama.OffsetFetchRequest:
+			fetchReqCount++
+		}
+	}
+	c.Assert(coordReqCount, Equals, 1)
+	c.Assert(fetchReqCount < len(oms)/4, Equals, true, Commentf("fetches=%d", fetchReqCount))
+}
+
 // A partition offset manager can be closed even while it keeps trying to
 // resolve the coordinator for the broker.
 func (s *OffsetMgrSuite) TestInitialNoCoordinator(c *C) {
@@ -184,6 +235,68 @@ func (s *OffsetMgrSuite) TestCommitError(c *C) {
 	c.Assert(committedOffset, DeepEquals, Offset{1000, "foo"})
 }
 
+// When the group coordinator moves to another broker, then commits are
+// rerouted to the new coordinator, and the move is reflected in the factory
+// coordinator stats.
+func (s *OffsetMgrSuite) TestCoordinatorMoved(c *C) {
+	// Given
+	broker1 := sarama.NewMockBroker(c, 101)
+	defer broker1.Close()
+	broker2 := sarama.NewMockBroker(c, 102)
+	defer broker2.Close()
+
+	broker1.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker1.Addr(), broker1.BrokerID()).
+			SetBroker(broker2.Addr(), broker2.BrokerID()),
+		"ConsumerMetadataRequest": sarama.NewMockConsumerMetadataResponse(c).
+			SetCoordinator("g1", broker1),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(c).
+			SetOffset("g1", "t1", 7, 1234, "foo", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(c).
+			SetError("g1", "t1", 7, sarama.ErrNotCoordinatorForConsumer),
+	})
+	broker2.SetHandlerByMap(map[string]sarama.MockResponse{
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(c).
+			SetError("g1", "t1", 7, sarama.ErrNoError),
+	})
+
+	cfg := testhelpers.NewTestProxyCfg("c1")
+	cfg.Consumer.BackOffTimeout = 100 * time.Millisecond
+	cfg.Consumer.OffsetsCommitInterval = 50 * time.Millisecond
+	client, err := sarama.NewClient([]string{broker1.Addr()}, nil)
+	c.Assert(err, IsNil)
+
+	f := SpawnFactory(s.ns.NewChild(), cfg, client)
+	defer f.Stop()
+	f.(*factory).testReportErrors = true
+
+	om, err := f.SpawnOffsetManager(s.ns.NewChild("g1", "t1", 7), "g1", "t1", 7)
+	c.Assert(err, IsNil)
+	om.SubmitOffset(Offset{1000, "foo"})
+	oce := <-om.(*offsetMgr).testErrorsCh
+	c.Assert(oce.Err, Equals, sarama.ErrNotCoordinatorForConsumer)
+
+	// When
+	broker1.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ConsumerMetadataRequest": sarama.NewMockConsumerMetadataResponse(c).
+			SetCoordinator("g1", broker2),
+	})
+	om.Stop()
+
+	// Then
+	c.Assert(lastCommittedOffset(broker2, "g1", "t1", 7), DeepEquals, Offset{1000, "foo"})
+	coords := f.Coordinators()
+	c.Assert(len(coords), Equals, 1)
+	c.Assert(coords[0].Group, Equals, "g1")
+	c.Assert(coords[0].BrokerID, Equals, broker2.BrokerID())
+	c.Assert(coords[0].BrokerAddr, Equals, broker2.Addr())
+	c.Assert(coords[0].Moves, Equals, int64(1))
+	c.Assert(coords[0].Reassigns >= 1, Equals, true)
+	c.Assert(coords[0].Errors >= 1, Equals, true)
+	c.Assert(coords[0].LastError, Equals, sarama.ErrNotCoordinatorForConsumer.Error())
+}
+
 // If offset a response received from Kafka for an offset commit request does
 // not contain information for a submitted offset, then offset manager keeps,
 // retrying until it succeeds.
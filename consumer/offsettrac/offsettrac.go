@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mailgun/kafka-pixy/actor"
@@ -16,6 +17,13 @@ import (
 const (
 	base64EncodeMap = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
 	maxDelta        = 0xFFF
+
+	// Separates encoded ack ranges from user metadata in offset metadata.
+	userMetaSeparator = "|"
+
+	// Separates encoded ack ranges from encoded offer ranges in offset
+	// metadata.
+	offersSeparator = "~"
 )
 
 var (
@@ -38,14 +46,25 @@ type T struct {
 	offerTimeout time.Duration
 	offset       offsetmgr.Offset
 	ackRanges    []ackRange
+	userMeta     string
 	offers       []offer
+	// The number of offers that have been nacked and not redelivered yet.
+	nackedCount int
+
+	// Offsets of messages that had been offered but not acknowledged when
+	// the offset was committed by a previous tracker instance, e.g. before
+	// the proxy restarted, and that have not been fetched yet.
+	restoredOffers   []ackRange
+	restoredDeadline time.Time
 }
 
 // SparseAcks2Str returns human readable representation of sparsely committed
 // ranges encoded in the specified offset metadata.
 func SparseAcks2Str(offset offsetmgr.Offset) string {
 	var buf bytes.Buffer
-	ackRanges, _ := decodeAckRanges(offset.Val, offset.Meta)
+	encodedRanges, _ := splitMeta(offset.Meta)
+	encodedAckRanges, _ := splitRanges(encodedRanges)
+	ackRanges, _ := decodeAckRanges(offset.Val, encodedAckRanges)
 	for i, ar := range ackRanges {
 		if i != 0 {
 			buf.WriteString(",")
@@ -57,6 +76,13 @@ func SparseAcks2Str(offset offsetmgr.Offset) string {
 	return buf.String()
 }
 
+// UserMeta returns user metadata stored in the specified offset metadata, see
+// `OnAckedWithMeta`.
+func UserMeta(offset offsetmgr.Offset) string {
+	_, userMeta := splitMeta(offset.Meta)
+	return userMeta
+}
+
 // New creates a new offset tracker instance.
 func New(actorID *actor.ID, offset offsetmgr.Offset, offerTimeout time.Duration) *T {
 	ot := T{
@@ -65,12 +91,23 @@ func New(actorID *actor.ID, offset offsetmgr.Offset, offerTimeout time.Duration)
 		offset:       offset,
 	}
 	var err error
-	ot.ackRanges, err = decodeAckRanges(offset.Val, offset.Meta)
+	var encodedRanges string
+	encodedRanges, ot.userMeta = splitMeta(offset.Meta)
+	encodedAckRanges, encodedOfferRanges := splitRanges(encodedRanges)
+	ot.ackRanges, err = decodeAckRanges(offset.Val, encodedAckRanges)
 	if err != nil {
 		ot.ackRanges = nil
-		ot.offset.Meta = ""
+		ot.offset.Meta = joinMeta("", "", ot.userMeta)
 		log.Errorf("<%v> failed to decode ack ranges: %v, err=%+v", ot.actorID, offset, err)
+		return &ot
 	}
+	ot.restoredOffers, err = decodeOfferRanges(offset.Val, encodedOfferRanges)
+	if err != nil {
+		ot.restoredOffers = nil
+		ot.offset.Meta = joinMeta(encodedAckRanges, "", ot.userMeta)
+		log.Errorf("<%v> failed to decode offer ranges: %v, err=%+v", ot.actorID, offset, err)
+	}
+	ot.restoredDeadline = time.Now().Add(offerTimeout)
 	return &ot
 }
 
@@ -78,16 +115,60 @@ func New(actorID *actor.ID, offset offsetmgr.Offset, offerTimeout time.Duration)
 // returns the total number of offered messages. It is callers responsibility
 // to ensure that the number of offered message does not grow too large.
 func (ot *T) OnOffered(msg consumer.Message) int {
-	offersCount := len(ot.offers)
 	// Ignore messages that has already been acknowledged
 	if ot.IsAcked(msg) {
-		return offersCount
+		return len(ot.offers)
+	}
+	return ot.addOffer(ot.newOffer(msg))
+}
+
+// RestoreOffer should be called for every fetched message that has not been
+// acknowledged yet. If the message had been offered but not acknowledged when
+// the offset was committed by a previous tracker instance, then it is
+// registered as offered with a deadline set to the offer timeout since the
+// tracker was created, and true is returned. Such a message should not be
+// offered again right away, for the client that got it before the proxy
+// restarted may still acknowledge it.
+func (ot *T) RestoreOffer(msg consumer.Message) bool {
+	isRestored := false
+	for len(ot.restoredOffers) > 0 {
+		ar := &ot.restoredOffers[0]
+		if msg.Offset < ar.from {
+			break
+		}
+		if msg.Offset < ar.to {
+			isRestored = true
+			ar.from = msg.Offset + 1
+			if ar.from < ar.to {
+				break
+			}
+		}
+		// Messages are fetched in the order of their offsets, therefore
+		// restored offers below the fetched one are no longer needed.
+		ot.restoredOffers = ot.restoredOffers[1:]
 	}
+	if !isRestored {
+		return false
+	}
+	ot.addOffer(offer{msg: msg, offset: msg.Offset, deadline: ot.restoredDeadline})
+	return true
+}
+
+// Offset returns an offset to be submitted that reflects the current state of
+// offered and acknowledged messages.
+func (ot *T) Offset() offsetmgr.Offset {
+	ot.updateMeta()
+	return ot.offset
+}
+
+func (ot *T) addOffer(o offer) int {
+	offersCount := len(ot.offers)
+	msg := o.msg
 	// Even though the logic of this function allows offering in any order,
 	// this special case exists to expedite the most common real life usage
 	// pattern where messages are offered in their offset order.
 	if offersCount == 0 || msg.Offset > ot.offers[offersCount-1].offset {
-		ot.offers = append(ot.offers, ot.newOffer(msg))
+		ot.offers = append(ot.offers, o)
 		return offersCount + 1
 	}
 	// Find the spot where the message should be inserted to keep the offer
@@ -104,21 +185,148 @@ func (ot *T) OnOffered(msg consumer.Message) int {
 	// Insert the message to the offer list keeping it sorted by offsets.
 	ot.offers = append(ot.offers, offer{})
 	copy(ot.offers[i+1:], ot.offers[i:offersCount])
-	ot.offers[i] = ot.newOffer(msg)
+	ot.offers[i] = o
 	return offersCount + 1
 }
 
 // OnAcked should be called when a message has been acknowledged by a consumer.
 // It returns an offset to be submitted and a total number of offered messages.
 func (ot *T) OnAcked(offset int64) (offsetmgr.Offset, int) {
+	return ot.OnAckedWithMeta(offset, "")
+}
+
+// OnAckedWithMeta is the same as `OnAcked` except it also makes the offset
+// carry the specified user metadata. If `userMeta` is empty, then the offset
+// keeps user metadata of a previous ack.
+func (ot *T) OnAckedWithMeta(offset int64, userMeta string) (offsetmgr.Offset, int) {
 	ot.removeOffer(offset)
 	ot.updateAckRanges(offset)
-	var err error
-	ot.offset.Meta, err = encodeAckRanges(ot.offset.Val, ot.ackRanges)
+	if userMeta != "" {
+		ot.userMeta = userMeta
+	}
+	ot.updateMeta()
+	return ot.offset, len(ot.offers)
+}
+
+// OnAckedUpTo should be called when a consumer acknowledges all messages with
+// offsets at or below the specified one at once. Messages that have not been
+// offered yet are not affected, that is the acknowledged offset is capped by
+// the highest offered one. It returns an offset to be submitted and a total
+// number of offered messages. User metadata is handled the same way as by
+// `OnAckedWithMeta`.
+func (ot *T) OnAckedUpTo(offset int64, userMeta string) (offsetmgr.Offset, int) {
+	if highest := ot.highestOffered(); offset > highest {
+		offset = highest
+	}
+	if offset >= ot.offset.Val {
+		i := sort.Search(len(ot.offers), func(i int) bool {
+			return ot.offers[i].msg.Offset > offset
+		})
+		for j := 0; j < i; j++ {
+			if ot.offers[j].nacked {
+				ot.nackedCount--
+			}
+		}
+		offersCount := copy(ot.offers, ot.offers[i:])
+		for j := offersCount; j < len(ot.offers); j++ {
+			ot.offers[j].msg = consumer.Message{} // Makes it subject for garbage collection.
+		}
+		ot.offers = ot.offers[:offersCount]
+		ot.offset.Val = offset + 1
+		for len(ot.ackRanges) > 0 && ot.ackRanges[0].from <= ot.offset.Val {
+			if ot.ackRanges[0].to > ot.offset.Val {
+				ot.offset.Val = ot.ackRanges[0].to
+			}
+			ot.ackRanges = ot.ackRanges[1:]
+		}
+	}
+	if userMeta != "" {
+		ot.userMeta = userMeta
+	}
+	ot.updateMeta()
+	return ot.offset, len(ot.offers)
+}
+
+// OnNacked should be called when a consumer fails to process an offered
+// message and wants it redelivered after the specified delay, rather than
+// after the offer timeout. The message is returned by `NextRetry` once the
+// delay elapses, and it does not count as a retry attempt. It returns false if
+// the message is not offered at the moment, e.g. when it has already been
+// acknowledged.
+func (ot *T) OnNacked(offset int64, delay time.Duration) bool {
+	return ot.onNacked(offset, delay, time.Now())
+}
+func (ot *T) onNacked(offset int64, delay time.Duration, now time.Time) bool {
+	i := sort.Search(len(ot.offers), func(i int) bool {
+		return ot.offers[i].msg.Offset >= offset
+	})
+	if i >= len(ot.offers) || ot.offers[i].msg.Offset != offset {
+		log.Errorf("<%s> unknown message nacked: offset=%d", ot.actorID, offset)
+		return false
+	}
+	o := &ot.offers[i]
+	o.deadline = now.Add(delay)
+	if !o.nacked {
+		o.nacked = true
+		ot.nackedCount++
+	}
+	return true
+}
+
+// highestOffered returns the highest offset of messages that have been offered
+// whether acknowledged or not. If nothing has been offered past the committed
+// offset, then the offset right below it is returned.
+func (ot *T) highestOffered() int64 {
+	highest := ot.offset.Val - 1
+	if n := len(ot.offers); n > 0 && ot.offers[n-1].offset > highest {
+		highest = ot.offers[n-1].offset
+	}
+	if n := len(ot.ackRanges); n > 0 && ot.ackRanges[n-1].to-1 > highest {
+		highest = ot.ackRanges[n-1].to - 1
+	}
+	return highest
+}
+
+// updateMeta encodes the current ack ranges, offer ranges and user metadata
+// into the offset metadata.
+func (ot *T) updateMeta() {
+	encodedAckRanges, err := encodeAckRanges(ot.offset.Val, ot.ackRanges)
 	if err != nil {
 		log.Errorf("<%s> failed to encode ack ranges: err=%+v", ot.actorID, err)
 	}
-	return ot.offset, len(ot.offers)
+	encodedOfferRanges, err := encodeOfferRanges(ot.offset.Val, ot.offerRanges(time.Now()))
+	if err != nil {
+		log.Errorf("<%s> failed to encode offer ranges: err=%+v", ot.actorID, err)
+	}
+	ot.offset.Meta = joinMeta(encodedAckRanges, encodedOfferRanges, ot.userMeta)
+}
+
+// offerRanges returns offsets of offered messages that have not been
+// acknowledged yet and whose offer has not expired, including restored ones
+// that have not been fetched yet, as a sorted list of ranges.
+func (ot *T) offerRanges(now time.Time) []ackRange {
+	var offerRanges []ackRange
+	for _, o := range ot.offers {
+		if o.offset < ot.offset.Val || o.deadline.Before(now) {
+			continue
+		}
+		last := len(offerRanges) - 1
+		if last >= 0 && offerRanges[last].to == o.offset {
+			offerRanges[last].to++
+			continue
+		}
+		offerRanges = append(offerRanges, newAckRange(o.offset))
+	}
+	for _, ar := range ot.restoredOffers {
+		if ar.to <= ot.offset.Val {
+			continue
+		}
+		if ar.from < ot.offset.Val {
+			ar.from = ot.offset.Val
+		}
+		offerRanges = append(offerRanges, ar)
+	}
+	return offerRanges
 }
 
 func (ot *T) removeOffer(offset int64) {
@@ -130,6 +338,9 @@ func (ot *T) removeOffer(offset int64) {
 		log.Errorf("<%s> unknown message acked: offset=%d", ot.actorID, offset)
 		return
 	}
+	if ot.offers[i].nacked {
+		ot.nackedCount--
+	}
 	offersCount -= 1
 	copy(ot.offers[i:offersCount], ot.offers[i+1:])
 	ot.offers[offersCount].msg = consumer.Message{} // Makes it subject for garbage collection.
@@ -159,6 +370,19 @@ func (ot *T) NextRetry() (consumer.Message, int, bool) {
 	return ot.nextRetry(now)
 }
 func (ot *T) nextRetry(now time.Time) (consumer.Message, int, bool) {
+	// Nacked offers can be anywhere in the list regardless of their
+	// deadlines, so they are checked separately.
+	if ot.nackedCount > 0 {
+		for i := range ot.offers {
+			o := &ot.offers[i]
+			if o.nacked && !o.deadline.After(now) {
+				o.nacked = false
+				ot.nackedCount--
+				o.deadline = now.Add(ot.offerTimeout)
+				return o.msg, o.retryNo, true
+			}
+		}
+	}
 	for i := range ot.offers {
 		o := &ot.offers[i]
 		if o.deadline.Before(now) {
@@ -248,7 +472,37 @@ func (ot *T) updateAckRanges(offset int64) {
 }
 
 func (ot *T) newOffer(msg consumer.Message) offer {
-	return offer{msg, msg.Offset, 0, time.Now().Add(ot.offerTimeout)}
+	return offer{msg: msg, offset: msg.Offset, deadline: time.Now().Add(ot.offerTimeout)}
+}
+
+// splitMeta splits offset metadata into encoded ack ranges and user metadata.
+func splitMeta(meta string) (string, string) {
+	i := strings.Index(meta, userMetaSeparator)
+	if i < 0 {
+		return meta, ""
+	}
+	return meta[:i], meta[i+len(userMetaSeparator):]
+}
+
+func joinMeta(encodedAckRanges, encodedOfferRanges, userMeta string) string {
+	encodedRanges := encodedAckRanges
+	if encodedOfferRanges != "" {
+		encodedRanges += offersSeparator + encodedOfferRanges
+	}
+	if userMeta == "" {
+		return encodedRanges
+	}
+	return encodedRanges + userMetaSeparator + userMeta
+}
+
+// splitRanges splits the ranges part of offset metadata into encoded ack
+// ranges and encoded offer ranges.
+func splitRanges(encodedRanges string) (string, string) {
+	i := strings.Index(encodedRanges, offersSeparator)
+	if i < 0 {
+		return encodedRanges, ""
+	}
+	return encodedRanges[:i], encodedRanges[i+len(offersSeparator):]
 }
 
 func encodeAckRanges(base int64, ackRanges []ackRange) (string, error) {
@@ -284,6 +538,29 @@ func decodeAckRanges(base int64, encoded string) ([]ackRange, error) {
 	return ackRanges, nil
 }
 
+// encodeOfferRanges encodes offer ranges the same way as ack ranges, except
+// they are shifted by one, for the first offered message may be right at the
+// base offset, that can be 0, and that is not a valid range boundary.
+func encodeOfferRanges(base int64, offerRanges []ackRange) (string, error) {
+	shifted := make([]ackRange, len(offerRanges))
+	for i, ar := range offerRanges {
+		shifted[i] = ackRange{ar.from + 1, ar.to + 1}
+	}
+	return encodeAckRanges(base, shifted)
+}
+
+func decodeOfferRanges(base int64, encoded string) ([]ackRange, error) {
+	offerRanges, err := decodeAckRanges(base, encoded)
+	if err != nil {
+		return nil, err
+	}
+	for i := range offerRanges {
+		offerRanges[i].from--
+		offerRanges[i].to--
+	}
+	return offerRanges, nil
+}
+
 func newAckRange(offset int64) ackRange {
 	return ackRange{offset, offset + 1}
 }
@@ -338,6 +615,9 @@ type offer struct {
 	offset   int64
 	retryNo  int
 	deadline time.Time
+	// Nacked offers are redelivered once their deadline expires without
+	// counting that as a retry.
+	nacked bool
 }
 
 type ackRange struct {
@@ -167,6 +167,14 @@ func (s *OffsetTrackerSuite) TestNewOffsetAdjusted(c *C) {
 			offsetmgr.Offset{1000, "abra1234+/@S"},
 			offsetmgr.Offset{1000, ""},
 		},
+		/* 4 */ {
+			offsetmgr.Offset{1000, "abra1234+/PS|txn:42"},
+			offsetmgr.Offset{1000, "abra1234+/PS|txn:42"},
+		},
+		/* 5 */ {
+			offsetmgr.Offset{1000, "abra1234+/@S|txn:42"},
+			offsetmgr.Offset{1000, "|txn:42"},
+		},
 	} {
 		// When
 		ot := New(s.ns, tc.initial, -1)
@@ -176,6 +184,67 @@ func (s *OffsetTrackerSuite) TestNewOffsetAdjusted(c *C) {
 	}
 }
 
+// User metadata is carried by all offsets returned by the tracker, until a
+// message is acked with different user metadata.
+func (s *OffsetTrackerSuite) TestOnAckedWithMeta(c *C) {
+	ot := New(s.ns, offsetmgr.Offset{Val: 300, Meta: "|txn:1"}, -1)
+	for i, tc := range []struct {
+		offset   int64
+		userMeta string
+		meta     string
+	}{
+		/* 0 */ {offset: 302, userMeta: "", meta: "ACAB|txn:1"},
+		/* 1 */ {offset: 300, userMeta: "txn:2", meta: "ABAB|txn:2"},
+		/* 2 */ {offset: 301, userMeta: "", meta: "|txn:2"},
+		/* 3 */ {offset: 303, userMeta: "a|b", meta: "|a|b"},
+	} {
+		// When
+		offset, _ := ot.OnAckedWithMeta(tc.offset, tc.userMeta)
+
+		// Then
+		c.Assert(offset.Meta, Equals, tc.meta, Commentf("case: %d", i))
+		ot2 := New(s.ns, offset, -1)
+		c.Assert(ot2.offset, Equals, offset, Commentf("case: %d", i))
+	}
+	c.Assert(UserMeta(offsetmgr.Offset{Val: 304, Meta: "|a|b"}), Equals, "a|b")
+	c.Assert(SparseAcks2Str(offsetmgr.Offset{Val: 300, Meta: "ACAB|txn:1"}), Equals, "2-3")
+}
+
+// Acknowledging all messages up to an offset removes respective offers, and
+// moves the committed offset past it and past adjacent sparse acks. Messages
+// that have not been offered yet are not acknowledged.
+func (s *OffsetTrackerSuite) TestOnAckedUpTo(c *C) {
+	ot := New(s.ns, offsetmgr.Offset{Val: 300}, -1)
+	for offset := int64(300); offset <= 310; offset++ {
+		ot.OnOffered(consumer.Message{Offset: offset})
+	}
+	ot.OnAcked(305)
+	ot.OnAcked(306)
+	ot.OnAcked(309)
+	for i, tc := range []struct {
+		offset      int64
+		userMeta    string
+		committed   int64
+		offersCount int
+		ackRanges   []ackRange
+		meta        string
+	}{
+		/* 0 */ {offset: 299, committed: 300, offersCount: 8, ackRanges: []ackRange{{305, 307}, {309, 310}}, meta: "AFACACAB"},
+		/* 1 */ {offset: 303, committed: 304, offersCount: 4, ackRanges: []ackRange{{305, 307}, {309, 310}}, meta: "ABACACAB"},
+		/* 2 */ {offset: 304, userMeta: "txn:1", committed: 307, offersCount: 3, ackRanges: []ackRange{{309, 310}}, meta: "ACAB|txn:1"},
+		/* 3 */ {offset: 320, committed: 311, offersCount: 0, ackRanges: []ackRange{}, meta: "|txn:1"},
+	} {
+		// When
+		offset, offersCount := ot.OnAckedUpTo(tc.offset, tc.userMeta)
+
+		// Then
+		c.Assert(offset.Val, Equals, tc.committed, Commentf("case: %d", i))
+		c.Assert(offersCount, Equals, tc.offersCount, Commentf("case: %d", i))
+		c.Assert(ot.ackRanges, DeepEquals, tc.ackRanges, Commentf("case: %d", i))
+		c.Assert(offset.Meta, Equals, tc.meta, Commentf("case: %d", i))
+	}
+}
+
 func (s *OffsetTrackerSuite) TestIsAcked(c *C) {
 	meta, _ := encodeAckRanges(301, []ackRange{
 		{302, 305}, {307, 309}, {310, 313}})
@@ -323,6 +392,68 @@ func (s *OffsetTrackerSuite) TestNextRetry(c *C) {
 	}
 }
 
+// Nacked messages are retried once their delay elapses, wherever they are in
+// the offer list, and that does not count as a retry attempt.
+func (s *OffsetTrackerSuite) TestNextRetryNacked(c *C) {
+	ot := New(s.ns, offsetmgr.Offset{Val: 300}, 5*time.Second)
+	begin := time.Now()
+	for _, offset := range []int64{301, 302, 303} {
+		ot.OnOffered(consumer.Message{Offset: offset})
+	}
+	ot.offers[0].deadline = begin.Add(5 * time.Second)
+	ot.offers[1].deadline = begin.Add(7 * time.Second)
+	ot.offers[2].deadline = begin.Add(9 * time.Second)
+
+	// When
+	c.Assert(ot.onNacked(303, 0, begin), Equals, true)
+	c.Assert(ot.onNacked(302, 2*time.Second, begin), Equals, true)
+	c.Assert(ot.onNacked(304, 0, begin), Equals, false)
+
+	// Then
+	for i, tc := range []struct {
+		millis     int
+		offset     int64
+		retryCount int
+	}{
+		/* 0 */ {millis: 1, offset: 303, retryCount: 0},
+		/* 1 */ {millis: 1000},
+		/* 2 */ {millis: 2001, offset: 302, retryCount: 0},
+		/* 3 */ {millis: 5001, offset: 301, retryCount: 1},
+		/* 4 */ {millis: 6000},
+		/* 5 */ {millis: 7002, offset: 302, retryCount: 1},
+	} {
+		now := begin.Add(time.Duration(tc.millis) * time.Millisecond)
+		msg, retryCount, ok := ot.nextRetry(now)
+		if ok {
+			c.Assert(msg.Offset, Equals, tc.offset, Commentf("case: %d", i))
+			c.Assert(retryCount, Equals, tc.retryCount, Commentf("case: %d", i))
+		} else {
+			c.Assert(tc.offset, Equals, int64(0), Commentf("case: %d", i))
+		}
+	}
+	c.Assert(ot.nackedCount, Equals, 0)
+}
+
+// Acknowledged nacked messages are not retried.
+func (s *OffsetTrackerSuite) TestNackedAcked(c *C) {
+	ot := New(s.ns, offsetmgr.Offset{Val: 300}, 5*time.Second)
+	begin := time.Now()
+	for _, offset := range []int64{300, 301, 302} {
+		ot.OnOffered(consumer.Message{Offset: offset})
+	}
+	ot.onNacked(300, 0, begin)
+	ot.onNacked(302, 0, begin)
+
+	// When
+	ot.OnAckedUpTo(300, "")
+	ot.OnAcked(302)
+
+	// Then
+	c.Assert(ot.nackedCount, Equals, 0)
+	_, _, ok := ot.nextRetry(begin.Add(time.Second))
+	c.Assert(ok, Equals, false)
+}
+
 func (s *OffsetTrackerSuite) TestShouldWait4Ack(c *C) {
 	ot := New(s.ns, offsetmgr.Offset{Val: 300}, -1)
 	msgs := []consumer.Message{
@@ -363,3 +494,79 @@ func (s *OffsetTrackerSuite) TestShouldWait4Ack(c *C) {
 		c.Assert(timeout, Equals, time.Duration(tc.timeout)*time.Millisecond, Commentf("case: %d", i))
 	}
 }
+
+// Offers that have not been acknowledged or expired yet are encoded into the
+// offset metadata, and restored by a tracker created with that offset.
+func (s *OffsetTrackerSuite) TestOffersPersisted(c *C) {
+	ot := New(s.ns, offsetmgr.Offset{Val: 300, Meta: "|txn:1"}, 5*time.Second)
+	for _, offset := range []int64{300, 301, 302, 304, 305, 306} {
+		ot.OnOffered(consumer.Message{Offset: offset})
+	}
+	ot.OnAcked(302)
+	ot.OnAcked(300)
+	// The offer of 306 has expired.
+	ot.offers[len(ot.offers)-1].deadline = time.Now().Add(-time.Second)
+
+	// When
+	offset := ot.Offset()
+
+	// Then
+	c.Assert(offset.Val, Equals, int64(301))
+	c.Assert(offset.Meta, Equals, "ABAB~ABABACAC|txn:1")
+	c.Assert(SparseAcks2Str(offset), Equals, "1-2")
+	c.Assert(UserMeta(offset), Equals, "txn:1")
+
+	ot2 := New(s.ns, offset, 5*time.Second)
+	c.Assert(ot2.offset, Equals, offset)
+	c.Assert(ot2.restoredOffers, DeepEquals, []ackRange{{301, 302}, {304, 306}})
+}
+
+// Restored offers are registered as offered when respective messages are
+// fetched, the rest of fetched messages are not affected.
+func (s *OffsetTrackerSuite) TestRestoreOffer(c *C) {
+	offerRanges, _ := encodeOfferRanges(300, []ackRange{{300, 301}, {303, 306}, {308, 309}})
+	begin := time.Now()
+	ot := New(s.ns, offsetmgr.Offset{Val: 300, Meta: "~" + offerRanges}, 5*time.Second)
+
+	for i, tc := range []struct {
+		offset     int64
+		isRestored bool
+		count      int
+	}{
+		/* 0 */ {offset: 300, isRestored: true, count: 1},
+		/* 1 */ {offset: 301, isRestored: false, count: 1},
+		/* 2 */ {offset: 303, isRestored: true, count: 2},
+		//       Offset 304 has been skipped for some reason.
+		/* 3 */ {offset: 305, isRestored: true, count: 3},
+		/* 4 */ {offset: 306, isRestored: false, count: 3},
+		/* 5 */ {offset: 309, isRestored: false, count: 3},
+		/* 6 */ {offset: 310, isRestored: false, count: 3},
+	} {
+		// When
+		isRestored := ot.RestoreOffer(consumer.Message{Offset: tc.offset})
+
+		// Then
+		c.Assert(isRestored, Equals, tc.isRestored, Commentf("case: %d", i))
+		c.Assert(len(ot.offers), Equals, tc.count, Commentf("case: %d", i))
+	}
+	c.Assert(len(ot.restoredOffers), Equals, 0)
+	// Restored offers are retried after the offer timeout.
+	_, _, ok := ot.nextRetry(begin.Add(4 * time.Second))
+	c.Assert(ok, Equals, false)
+	msg, retryNo, ok := ot.nextRetry(begin.Add(6 * time.Second))
+	c.Assert(ok, Equals, true)
+	c.Assert(msg.Offset, Equals, int64(300))
+	c.Assert(retryNo, Equals, 1)
+}
+
+// If offer ranges cannot be decoded, then they are dropped but ack ranges and
+// user metadata are preserved.
+func (s *OffsetTrackerSuite) TestNewOfferRangesInvalid(c *C) {
+	// When
+	ot := New(s.ns, offsetmgr.Offset{Val: 1000, Meta: "abra~12@4|txn:42"}, -1)
+
+	// Then
+	c.Assert(ot.offset, Equals, offsetmgr.Offset{Val: 1000, Meta: "abra|txn:42"})
+	c.Assert(ot.restoredOffers, IsNil)
+	c.Assert(SparseAcks2Str(ot.offset), Equals, SparseAcks2Str(offsetmgr.Offset{Val: 1000, Meta: "abra"}))
+}
@@ -1,10 +1,12 @@
 package partitioncsm
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
@@ -12,7 +14,10 @@ import (
 	"github.com/mailgun/kafka-pixy/consumer/msgistream"
 	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
 	"github.com/mailgun/kafka-pixy/consumer/offsettrac"
+	"github.com/mailgun/kafka-pixy/events"
+	"github.com/mailgun/kafka-pixy/logging"
 	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/kafka-pixy/tracing"
 	"github.com/mailgun/log"
 	"github.com/pkg/errors"
 )
@@ -42,21 +47,38 @@ type T struct {
 	group       string
 	topic       string
 	partition   int32
-	groupMember *groupmember.T
+	groupMember groupmember.Member
 	msgIStreamF msgistream.Factory
 	offsetMgrF  offsetmgr.Factory
+	pause       *Pause
 	messagesCh  chan consumer.Message
 	eventsCh    chan consumer.Event
 	stopCh      chan none.T
+	doneCh      chan none.T
 	wg          sync.WaitGroup
 
+	// The number of ack timeouts after which a message is routed to the
+	// dead letter topic, zero if dead lettering is disabled.
+	deadLetterAfter int
+	deadLetteredCh  chan deadLetterResult
+
+	// The delay of the retry tier, if the partition is of a retry topic.
+	// Messages of a retry topic are not offered before the delay elapses
+	// since they were produced.
+	retryDelay time.Duration
+
+	notifyMu sync.Mutex
+	notifyFn func()
+
 	// For tests only!
 	firstMsgFetched bool
 }
 
-// Spawn creates a partition consumer instance and starts its goroutines.
+// Spawn creates a partition consumer instance and starts its goroutines. While
+// `pause` is on the partition consumer offers no messages, it can be nil.
 func Spawn(namespace *actor.ID, group, topic string, partition int32, cfg *config.Proxy,
-	groupMember *groupmember.T, msgIStreamF msgistream.Factory, offsetMgrF offsetmgr.Factory,
+	groupMember groupmember.Member, msgIStreamF msgistream.Factory, offsetMgrF offsetmgr.Factory,
+	pause *Pause,
 ) *T {
 	pc := &T{
 		actorID:     namespace.NewChild(fmt.Sprintf("P:%s_%d", topic, partition)),
@@ -67,9 +89,18 @@ func Spawn(namespace *actor.ID, group, topic string, partition int32, cfg *confi
 		groupMember: groupMember,
 		msgIStreamF: msgIStreamF,
 		offsetMgrF:  offsetMgrF,
+		pause:       pause,
 		messagesCh:  make(chan consumer.Message, 1),
 		eventsCh:    make(chan consumer.Event, 1),
 		stopCh:      make(chan none.T),
+		doneCh:      make(chan none.T),
+	}
+	if cfg.Consumer.DeadLetterProducer != nil {
+		pc.deadLetterAfter = cfg.ConsumerDeadLetterAfter(topic)
+		pc.deadLetteredCh = make(chan deadLetterResult)
+	}
+	if _, delay, ok := cfg.ParseRetryTopic(topic); ok {
+		pc.retryDelay = delay
 	}
 	actor.Spawn(pc.actorID, &pc.wg, pc.run)
 	return pc
@@ -85,8 +116,30 @@ func (pc *T) Messages() <-chan consumer.Message {
 	return pc.messagesCh
 }
 
+// implements `multiplexer.Notifier`
+func (pc *T) NotifyOnMessage(notifyFn func()) {
+	pc.notifyMu.Lock()
+	pc.notifyFn = notifyFn
+	pc.notifyMu.Unlock()
+}
+
+// notifyMessage tells the multiplexer, if one has registered, that a message
+// has been made available in, or the channel has been closed.
+func (pc *T) notifyMessage() {
+	pc.notifyMu.Lock()
+	notifyFn := pc.notifyFn
+	pc.notifyMu.Unlock()
+	if notifyFn != nil {
+		notifyFn()
+	}
+}
+
 func (pc *T) run() {
-	defer close(pc.messagesCh)
+	defer close(pc.doneCh)
+	defer func() {
+		close(pc.messagesCh)
+		pc.notifyMessage()
+	}()
 	defer pc.groupMember.ClaimPartition(pc.actorID, pc.topic, pc.partition, pc.stopCh)()
 
 	om, err := pc.offsetMgrF.SpawnOffsetManager(pc.actorID, pc.group, pc.topic, pc.partition)
@@ -108,19 +161,32 @@ func (pc *T) run() {
 		return
 	}
 	submittedOffset := committedOffset
+	isCommitted := committedOffset.Val != sarama.OffsetNewest
+	initialOffsetVal := committedOffset.Val
+	if !isCommitted {
+		initialOffsetVal = pc.resolveInitialOffset()
+	}
 
 	// Initialize the message input stream to read from the initial offset.
-	mis, realOffsetVal, err := pc.msgIStreamF.SpawnMessageIStream(pc.actorID, pc.topic, pc.partition, committedOffset.Val)
+	mis, realOffsetVal, err := pc.msgIStreamF.SpawnMessageIStream(pc.actorID, pc.topic, pc.partition, initialOffsetVal)
 	if err != nil {
 		// Must never happen!
-		panic(errors.Wrapf(err, "<%s> failed to start message stream, offset=%d", pc.actorID, committedOffset.Val))
+		panic(errors.Wrapf(err, "<%s> failed to start message stream, offset=%d", pc.actorID, initialOffsetVal))
 	}
 	defer mis.Stop()
 
 	// If the real initial offset is not what had been committed then adjust.
 	if committedOffset.Val != realOffsetVal {
-		log.Errorf("<%s> invalid initial offset: %d, sparseAcks=%s",
-			pc.actorID, committedOffset.Val, offsettrac.SparseAcks2Str(committedOffset))
+		if isCommitted {
+			log.Errorf("<%s> invalid initial offset: %d, sparseAcks=%s",
+				pc.actorID, committedOffset.Val, offsettrac.SparseAcks2Str(committedOffset))
+			pc.emitEvent(events.TypeOffsetReset, map[string]interface{}{
+				"committed_offset": committedOffset.Val,
+				"reset_offset":     realOffsetVal,
+			})
+		} else {
+			log.Infof("<%s> no committed offset, starting from %d", pc.actorID, realOffsetVal)
+		}
 		submittedOffset = offsetmgr.Offset{Val: realOffsetVal, Meta: ""}
 		om.SubmitOffset(submittedOffset)
 	}
@@ -136,38 +202,83 @@ func (pc *T) run() {
 		msg                    consumer.Message
 		msgOk                  = false
 		retryNo                int
+		paused, pauseChangedCh = pc.pause.State()
+		dueTimer               *time.Timer
+		dueCh                  <-chan time.Time
 	)
 	defer retryTicker.Stop()
+	defer func() {
+		if dueTimer != nil {
+			dueTimer.Stop()
+		}
+	}()
 	for {
+		// While paused neither messages are pulled from the stream nor
+		// offered, but acks of messages offered earlier are still accepted.
+		iStreamMessagesCh, messagesCh := nilOrIStreamMessagesCh, nilOrMessagesCh
+		if paused {
+			iStreamMessagesCh, messagesCh = nil, nil
+		}
 		select {
-		case msg = <-nilOrIStreamMessagesCh:
+		case <-pauseChangedCh:
+			paused, pauseChangedCh = pc.pause.State()
+			log.Infof("<%s> paused: %t", pc.actorID, paused)
+		case msg = <-iStreamMessagesCh:
 			if ot.IsAcked(msg) {
 				continue
 			}
 			msg.EventsCh = pc.eventsCh
+			var holdFor time.Duration
+			if pc.retryDelay > 0 {
+				var ok bool
+				if msg, holdFor, ok = pc.unwrapRetry(msg); !ok {
+					ot.OnOffered(msg)
+					submittedOffset, _ = ot.OnAcked(msg.Offset)
+					om.SubmitOffset(submittedOffset)
+					continue
+				}
+			}
+			// Messages that had been offered before the offset was
+			// committed by a previous partition consumer are not offered
+			// again until their ack timeout expires.
+			if ot.RestoreOffer(msg) {
+				log.Infof("<%s> offer restored: offset=%d", pc.actorID, msg.Offset)
+				continue
+			}
 			msgOk = true
+			pc.traceEvent(tracing.EventFetched, msg.Offset)
 			pc.notifyTestFetched()
 			nilOrIStreamMessagesCh = nil
+			if holdFor > 0 {
+				log.Infof("<%s> holding retry: offset=%d, for=%s", pc.actorID, msg.Offset, holdFor)
+				dueTimer = time.NewTimer(holdFor)
+				dueCh = dueTimer.C
+				continue
+			}
+			nilOrMessagesCh = pc.messagesCh
+		case <-dueCh:
+			dueCh = nil
 			nilOrMessagesCh = pc.messagesCh
 		case <-retryTicker.C:
-			if msgOk {
+			if msgOk || paused {
 				continue
 			}
-			msg, retryNo, msgOk = ot.NextRetry()
+			msg, retryNo, msgOk = pc.nextRetry(ot)
 			if !msgOk {
 				continue
 			}
-			if retryNo > retriesEmergencyBreak {
+			if pc.deadLetterAfter == 0 && retryNo > retriesEmergencyBreak {
 				log.Errorf("<%s> too many retries: offset=%d", pc.actorID, msg.Offset)
 				goto wait4Ack
 			}
 			if retryNo > retriesHighWaterMark {
-				log.Warningf("<%s> retries above HWM: retryNo=%d, offset=%d", pc.actorID, retryNo, msg.Offset)
+				logging.ConsumerWarnings.Warningf("<%s> retries above HWM: retryNo=%d, offset=%d", pc.actorID, retryNo, msg.Offset)
 			}
 			nilOrIStreamMessagesCh = nil
 			nilOrMessagesCh = pc.messagesCh
-		case nilOrMessagesCh <- msg:
+		case messagesCh <- msg:
 			nilOrMessagesCh = nil
+			pc.notifyMessage()
 		case event := <-pc.eventsCh:
 			switch event.T {
 			case consumer.ETOffered:
@@ -175,35 +286,78 @@ func (pc *T) run() {
 					// Must never happen!
 					panic(errors.Wrapf(err, "<%s> invalid offer offset %d, want=%d", pc.actorID, event.Offset, msg.Offset))
 				}
+				pc.traceEvent(tracing.EventOffered, event.Offset)
 				offeredCount := ot.OnOffered(msg)
-				msg, retryNo, msgOk = ot.NextRetry()
+				submittedOffset = ot.Offset()
+				om.SubmitOffset(submittedOffset)
+				msg, retryNo, msgOk = pc.nextRetry(ot)
 				if msgOk {
-					log.Warningf("<%s> retrying: offset=%d, no=%d", pc.actorID, msg.Offset, retryNo)
-					if retryNo > retriesEmergencyBreak {
+					logging.ConsumerWarnings.Warningf("<%s> retrying: offset=%d, no=%d", pc.actorID, msg.Offset, retryNo)
+					if pc.deadLetterAfter == 0 && retryNo > retriesEmergencyBreak {
 						log.Errorf("<%s> too many retries: offset=%d", pc.actorID, msg.Offset)
 						goto wait4Ack
 					}
 					if retryNo > retriesHighWaterMark {
-						log.Warningf("<%s> retries above HWM: %d, offset=%d", pc.actorID, retryNo, msg.Offset)
+						logging.ConsumerWarnings.Warningf("<%s> retries above HWM: %d, offset=%d", pc.actorID, retryNo, msg.Offset)
 					}
 					nilOrMessagesCh = pc.messagesCh
 					continue
 				}
 				if offeredCount > offeredHighWaterMark {
-					log.Warningf("<%s> offered count above HWM: %d", pc.actorID, offeredCount)
+					logging.ConsumerWarnings.Warningf("<%s> offered count above HWM: %d", pc.actorID, offeredCount)
 					nilOrIStreamMessagesCh = nil
 				} else {
 					nilOrIStreamMessagesCh = mis.Messages()
 				}
 			case consumer.ETAcked:
+				pc.traceEvent(tracing.EventAcked, event.Offset)
 				var offeredCount int
-				submittedOffset, offeredCount = ot.OnAcked(event.Offset)
+				submittedOffset, offeredCount = ot.OnAckedWithMeta(event.Offset, event.Meta)
 				om.SubmitOffset(submittedOffset)
 				if !msgOk && offeredCount <= offeredHighWaterMark {
 					nilOrIStreamMessagesCh = mis.Messages()
 				}
+			case consumer.ETAckedUpTo:
+				pc.traceEvent(tracing.EventAcked, event.Offset)
+				var offeredCount int
+				submittedOffset, offeredCount = ot.OnAckedUpTo(event.Offset, event.Meta)
+				om.SubmitOffset(submittedOffset)
+				if !msgOk && offeredCount <= offeredHighWaterMark {
+					nilOrIStreamMessagesCh = mis.Messages()
+				}
+			case consumer.ETNacked:
+				pc.traceEvent(tracing.EventNacked, event.Offset)
+				if !ot.OnNacked(event.Offset, event.Delay) {
+					continue
+				}
+				submittedOffset = ot.Offset()
+				om.SubmitOffset(submittedOffset)
+				// Redeliver right away rather than on the next retry check,
+				// unless there is a message pending already.
+				if event.Delay > 0 || msgOk || paused {
+					continue
+				}
+				if msg, retryNo, msgOk = pc.nextRetry(ot); !msgOk {
+					continue
+				}
+				if pc.deadLetterAfter == 0 && retryNo > retriesEmergencyBreak {
+					log.Errorf("<%s> too many retries: offset=%d", pc.actorID, msg.Offset)
+					goto wait4Ack
+				}
+				nilOrIStreamMessagesCh = nil
+				nilOrMessagesCh = pc.messagesCh
+			}
+		case result := <-pc.deadLetteredCh:
+			var offeredCount int
+			if submittedOffset, offeredCount = pc.onDeadLettered(ot, result); offeredCount < 0 {
+				continue
+			}
+			om.SubmitOffset(submittedOffset)
+			if !msgOk && offeredCount <= offeredHighWaterMark {
+				nilOrIStreamMessagesCh = mis.Messages()
 			}
 		case committedOffset = <-om.CommittedOffsets():
+			pc.traceCommitted(committedOffset.Val)
 		case <-pc.stopCh:
 			goto wait4Ack
 		}
@@ -212,24 +366,54 @@ wait4Ack:
 	for ok, timeout := ot.ShouldWait4Ack(); ok; ok, timeout = ot.ShouldWait4Ack() {
 		select {
 		case event := <-pc.eventsCh:
-			if event.T == consumer.ETAcked {
-				submittedOffset, _ = ot.OnAcked(event.Offset)
+			switch event.T {
+			case consumer.ETAcked:
+				pc.traceEvent(tracing.EventAcked, event.Offset)
+				submittedOffset, _ = ot.OnAckedWithMeta(event.Offset, event.Meta)
+				om.SubmitOffset(submittedOffset)
+			case consumer.ETAckedUpTo:
+				pc.traceEvent(tracing.EventAcked, event.Offset)
+				submittedOffset, _ = ot.OnAckedUpTo(event.Offset, event.Meta)
+				om.SubmitOffset(submittedOffset)
+			case consumer.ETNacked:
+				// A nacked message is not waited for, it is redelivered
+				// by the next consumer of the partition.
+				pc.traceEvent(tracing.EventNacked, event.Offset)
+				if ot.OnNacked(event.Offset, 0) {
+					submittedOffset = ot.Offset()
+					om.SubmitOffset(submittedOffset)
+				}
+			}
+		case result := <-pc.deadLetteredCh:
+			if offset, offeredCount := pc.onDeadLettered(ot, result); offeredCount >= 0 {
+				submittedOffset = offset
 				om.SubmitOffset(submittedOffset)
 			}
 		case <-time.After(timeout):
 			continue
 		}
 	}
+	// All offers have expired by now, make sure they are not committed.
+	if offset := ot.Offset(); offset != submittedOffset {
+		submittedOffset = offset
+		om.SubmitOffset(submittedOffset)
+	}
 	om.Stop()
 	// Drain committed offsets.
 	for committedOffset = range om.CommittedOffsets() {
 	}
+	pc.traceCommitted(committedOffset.Val)
 	// Reset `om` to prevent the deferred panic offset manager cleanup function
 	// from running and calling `Stop()` on the already stopped offset manager.
 	om = nil
 	if committedOffset != submittedOffset {
 		log.Errorf("<%s> failed to commit offset: %d, sparseAcks=%s",
 			pc.actorID, submittedOffset.Val, offsettrac.SparseAcks2Str(submittedOffset))
+		pc.emitEvent(events.TypeError, map[string]interface{}{
+			"error":            "failed to commit offset",
+			"offset":           submittedOffset.Val,
+			"committed_offset": committedOffset.Val,
+		})
 	}
 	log.Infof("<%s> last committed offset: %d, sparceAcks=%s",
 		pc.actorID, committedOffset.Val, offsettrac.SparseAcks2Str(committedOffset))
@@ -240,6 +424,132 @@ func (pc *T) Stop() {
 	pc.wg.Wait()
 }
 
+// nextRetry returns a next message to be retried along with the retry attempt
+// number, like `offsettrac.T.NextRetry` does, except that messages that were
+// not acknowledged in time too many times are routed to the dead letter topic
+// instead of being returned.
+func (pc *T) nextRetry(ot *offsettrac.T) (consumer.Message, int, bool) {
+	for {
+		msg, retryNo, ok := ot.NextRetry()
+		if !ok || pc.deadLetterAfter == 0 || retryNo < pc.deadLetterAfter {
+			return msg, retryNo, ok
+		}
+		pc.produceDeadLetter(msg, retryNo)
+	}
+}
+
+// produceDeadLetter produces a message to the dead letter topic. The message
+// stays offered until the result is received from `deadLetteredCh`, so if
+// producing fails, then it is routed again when its ack timeout expires.
+func (pc *T) produceDeadLetter(msg consumer.Message, ackTimeouts int) {
+	deadLetterTopic := pc.topic + config.DeadLetterTopicSuffix
+	log.Errorf("<%s> routing to dead letter topic: offset=%d, ackTimeouts=%d, topic=%s",
+		pc.actorID, msg.Offset, ackTimeouts, deadLetterTopic)
+	dl := config.DeadLetter{
+		Group:       pc.group,
+		Topic:       pc.topic,
+		Partition:   pc.partition,
+		Offset:      msg.Offset,
+		Key:         msg.Key,
+		Value:       msg.Value,
+		AckTimeouts: ackTimeouts,
+		Timestamp:   time.Now().UTC(),
+	}
+	pc.cfg.Consumer.DeadLetterProducer.ProduceDeadLetter(deadLetterTopic, dl, func(err error) {
+		// The result is delivered asynchronously, for the producer may
+		// call back before `ProduceDeadLetter` returns.
+		go func() {
+			select {
+			case pc.deadLetteredCh <- deadLetterResult{msg.Offset, err}:
+			case <-pc.doneCh:
+			}
+		}()
+	})
+}
+
+// onDeadLettered acknowledges a message that has been produced to the dead
+// letter topic, and returns an offset to be submitted along with the number
+// of offered messages. If producing failed, then the offered count is -1.
+func (pc *T) onDeadLettered(ot *offsettrac.T, result deadLetterResult) (offsetmgr.Offset, int) {
+	if result.err != nil {
+		log.Errorf("<%s> failed to produce dead letter: offset=%d, err=(%s)", pc.actorID, result.offset, result.err)
+		return offsetmgr.Offset{}, -1
+	}
+	pc.traceEvent(tracing.EventDeadLettered, result.offset)
+	pc.emitEvent(events.TypeDeadLettered, map[string]interface{}{
+		"offset": result.offset,
+	})
+	return ot.OnAcked(result.offset)
+}
+
+// unwrapRetry replaces the key and the value of a message fetched from a retry
+// topic with those of the retried message, and returns how long the message
+// has to be held before it is offered. It returns false if the message must
+// be skipped, for it is either malformed or retried by another group.
+func (pc *T) unwrapRetry(msg consumer.Message) (consumer.Message, time.Duration, bool) {
+	var env config.RetryEnvelope
+	if err := json.Unmarshal(msg.Value, &env); err != nil {
+		log.Errorf("<%s> invalid retry message skipped: offset=%d, err=(%s)", pc.actorID, msg.Offset, err)
+		return msg, 0, false
+	}
+	if env.Group != pc.group {
+		return msg, 0, false
+	}
+	msg.Key, msg.Value, msg.Retries = env.Key, env.Value, env.Retries
+	return msg, env.Timestamp.Add(pc.retryDelay).Sub(time.Now()), true
+}
+
+// resolveInitialOffset returns an offset to start consuming from when the
+// group has no committed offset for the partition. If an offset initializer
+// is configured then it is asked, otherwise the configured initial offset is
+// returned.
+func (pc *T) resolveInitialOffset() int64 {
+	offsetInitializer := pc.cfg.Consumer.OffsetInitializer
+	if offsetInitializer == nil {
+		return pc.configuredInitialOffset()
+	}
+	offset, err := offsetInitializer.InitialOffset(pc.group, pc.topic, pc.partition)
+	if err != nil {
+		log.Errorf("<%s> offset initializer failed: err=(%s)", pc.actorID, err)
+		return pc.configuredInitialOffset()
+	}
+	return offset
+}
+
+// configuredInitialOffset returns either `sarama.OffsetOldest` or
+// `sarama.OffsetNewest` as configured for the topic, or for the proxy if it
+// is not configured for the topic.
+func (pc *T) configuredInitialOffset() int64 {
+	if pc.cfg.ConsumerInitialOffset(pc.topic) == config.InitialOffsetOldest {
+		return sarama.OffsetOldest
+	}
+	return sarama.OffsetNewest
+}
+
+// traceEvent notifies the message tracer, if any, about an event of a message
+// at the specified offset.
+func (pc *T) traceEvent(event string, offset int64) {
+	if tracer := pc.cfg.Consumer.MessageTracer; tracer != nil {
+		tracer.OnConsumerEvent(event, pc.group, pc.topic, pc.partition, offset)
+	}
+}
+
+// traceCommitted notifies the message tracer, if any, about a committed offset.
+func (pc *T) traceCommitted(offset int64) {
+	if tracer := pc.cfg.Consumer.MessageTracer; tracer != nil {
+		tracer.OnCommitted(pc.group, pc.topic, pc.partition, offset)
+	}
+}
+
+// emitEvent notifies the event listener, if any, about an event of the
+// partition. The partition is added to the event attributes.
+func (pc *T) emitEvent(eventType string, attrs map[string]interface{}) {
+	if listener := pc.cfg.Consumer.EventListener; listener != nil {
+		attrs["partition"] = pc.partition
+		listener.OnEvent(eventType, pc.group, pc.topic, attrs)
+	}
+}
+
 // notifyTestInitialized sends initial offset to initialOffsetCh channel.
 func (pc *T) notifyTestInitialized(initialOffset offsetmgr.Offset) {
 	if initialOffsetCh != nil {
@@ -256,6 +566,11 @@ func (pc *T) notifyTestFetched() {
 	}
 }
 
+type deadLetterResult struct {
+	offset int64
+	err    error
+}
+
 func resetConstants() {
 	check4RetryInterval = time.Second
 	retriesHighWaterMark = 1
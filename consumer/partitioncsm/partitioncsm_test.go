@@ -1,6 +1,7 @@
 package partitioncsm
 
 import (
+	"encoding/json"
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
@@ -54,7 +55,7 @@ func (s *PartitionCsmSuite) SetUpTest(c *C) {
 	s.ns = actor.RootID.NewChild("T")
 	s.groupMember = groupmember.Spawn(s.ns, group, memberID, s.cfg, s.kh.KazooClt())
 	var err error
-	if s.msgIStreamF, err = msgistream.SpawnFactory(s.ns, s.kh.KafkaClt()); err != nil {
+	if s.msgIStreamF, err = msgistream.SpawnFactory(s.ns, s.cfg, s.kh.KafkaClt(), nil, nil); err != nil {
 		panic(err)
 	}
 	s.offsetMgrF = offsetmgr.SpawnFactory(s.ns, s.cfg, s.kh.KafkaClt())
@@ -77,7 +78,7 @@ func (s *PartitionCsmSuite) TestOldestOffset(c *C) {
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetOldest, ""}})
 	offsets := s.kh.GetCommittedOffsets(group, topic)
 	c.Assert(offsets[partition], Equals, offsetmgr.Offset{sarama.OffsetOldest, ""})
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	// When
 	<-pc.Messages()
@@ -88,6 +89,90 @@ func (s *PartitionCsmSuite) TestOldestOffset(c *C) {
 	c.Assert(offsets[partition].Val, Equals, oldestOffsets[partition])
 }
 
+// While paused, a partition consumer offers no messages, and once resumed it
+// offers messages starting from where it stopped.
+func (s *PartitionCsmSuite) TestPauseResume(c *C) {
+	offsets := s.kh.GetNewestOffsets(topic)
+	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{offsets[partition], ""}})
+	s.kh.PutMessages("pause", topic, map[string]int{"": 3})
+	pause := NewPause()
+	pause.Set(true)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, pause)
+	defer pc.Stop()
+
+	// When/Then
+	select {
+	case msg := <-pc.Messages():
+		c.Errorf("Unexpected message: %v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// When
+	pause.Set(false)
+
+	// Then
+	msg := <-pc.Messages()
+	c.Assert(msg.Offset, Equals, offsets[partition])
+	sendEOffered(msg)
+	sendEAcked(msg)
+}
+
+// If there is no offset committed for a partition, then a configured offset
+// initializer is used to determine where to start consuming from.
+func (s *PartitionCsmSuite) TestOffsetInitializer(c *C) {
+	oldestOffsets := s.kh.GetOldestOffsets(topic)
+	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetNewest, ""}})
+	var calledWith []interface{}
+	s.cfg.Consumer.OffsetInitializer = offsetInitializerFn(func(group, topic string, partition int32) (int64, error) {
+		calledWith = []interface{}{group, topic, partition}
+		return oldestOffsets[partition] + 1, nil
+	})
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
+
+	// When
+	msg := <-pc.Messages()
+	pc.Stop()
+
+	// Then
+	c.Assert(calledWith, DeepEquals, []interface{}{group, topic, int32(partition)})
+	c.Assert(msg.Offset, Equals, oldestOffsets[partition]+1)
+}
+
+// If there is no offset committed for a partition, then consumption starts
+// from the configured initial offset.
+func (s *PartitionCsmSuite) TestConfiguredInitialOffset(c *C) {
+	oldestOffsets := s.kh.GetOldestOffsets(topic)
+	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetNewest, ""}})
+	s.cfg.Consumer.InitialOffset = config.InitialOffsetOldest
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
+
+	// When
+	msg := <-pc.Messages()
+	pc.Stop()
+
+	// Then
+	c.Assert(msg.Offset, Equals, oldestOffsets[partition])
+}
+
+// The initial offset configured for a topic takes precedence over the one
+// configured for the proxy.
+func (s *PartitionCsmSuite) TestConfiguredInitialOffsetTopic(c *C) {
+	oldestOffsets := s.kh.GetOldestOffsets(topic)
+	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetNewest, ""}})
+	s.cfg.Consumer.InitialOffset = config.InitialOffsetNewest
+	s.cfg.Consumer.Topics = map[string]*config.ConsumerTopic{
+		topic: {InitialOffset: config.InitialOffsetOldest},
+	}
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
+
+	// When
+	msg := <-pc.Messages()
+	pc.Stop()
+
+	// Then
+	c.Assert(msg.Offset, Equals, oldestOffsets[partition])
+}
+
 // If initial offset stored in Kafka is greater then the newest offset for a
 // partition, then the first message consumed from the partition is the next one
 // posted to it.
@@ -96,7 +181,7 @@ func (s *PartitionCsmSuite) TestInitialOffsetTooLarge(c *C) {
 	newestOffsets := s.kh.GetNewestOffsets(topic)
 	log.Infof("*** test.1 offsets: oldest=%v, newest=%v", oldestOffsets, newestOffsets)
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{newestOffsets[partition] + 100, ""}})
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 	// Wait for the partition consumer to initialize.
 	initialOffset := <-s.initOffsetCh
@@ -114,7 +199,7 @@ func (s *PartitionCsmSuite) TestInitialOffsetTooLarge(c *C) {
 // one can be read from Messages().
 func (s *PartitionCsmSuite) TestMustBeOfferedToProceed(c *C) {
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetOldest, ""}})
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 
 	// When
@@ -157,7 +242,7 @@ func (s *PartitionCsmSuite) TestSparseAckedNotRead(c *C) {
 	c.Assert(offsettrac.SparseAcks2Str(initOffset), Equals, "1-4,6-7")
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{initOffset})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 
 	// When/Then
@@ -179,13 +264,13 @@ func (s *PartitionCsmSuite) TestSparseAckedNotRead(c *C) {
 // Messages() channel results in termination of the partition consumer.
 func (s *PartitionCsmSuite) TestOfferIvalid(c *C) {
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetOldest, ""}})
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 
 	// When
 	msg, ok := <-pc.Messages()
 	c.Assert(ok, Equals, true)
-	msg.EventsCh <- consumer.Event{consumer.ETOffered, msg.Offset + 1}
+	msg.EventsCh <- consumer.Event{T: consumer.ETOffered, Offset: msg.Offset + 1}
 
 	// Then
 	_, ok = <-pc.Messages()
@@ -199,7 +284,7 @@ func (s *PartitionCsmSuite) TestOfferedTooMany(c *C) {
 	offeredHighWaterMark = 3
 	s.cfg.Consumer.AckTimeout = 500 * time.Millisecond
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{sarama.OffsetOldest, ""}})
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 	var msg consumer.Message
 
@@ -254,7 +339,7 @@ func (s *PartitionCsmSuite) TestSparseAckedCommitted(c *C) {
 	}
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: sarama.OffsetOldest}})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	// When
 	for _, shouldAck := range acks {
@@ -280,7 +365,7 @@ func (s *PartitionCsmSuite) TestSparseAckedAfterStop(c *C) {
 	s.cfg.Consumer.AckTimeout = 300 * time.Millisecond
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: sarama.OffsetOldest}})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	var messages []consumer.Message
 	for i := 0; i < 10; i++ {
@@ -324,7 +409,7 @@ func (s *PartitionCsmSuite) TestMaxRetriesReached(c *C) {
 	retriesHighWaterMark = 1
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: sarama.OffsetOldest}})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	// Read and confirm offer of 2 messages
 	msg0 := <-pc.Messages()
@@ -378,7 +463,7 @@ func (s *PartitionCsmSuite) TestSeveralMessageReties(c *C) {
 	retriesHighWaterMark = 1
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: sarama.OffsetOldest}})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 	defer pc.Stop()
 
 	// Read and confirm offered several messages, but do not ack them.
@@ -408,7 +493,7 @@ func (s *PartitionCsmSuite) TestRetryNoMoreMessages(c *C) {
 	retriesHighWaterMark = 1
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: offsetBefore}})
 
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	// Read and confirm offer of 2 messages
 	msg0 := <-pc.Messages()
@@ -440,11 +525,56 @@ func (s *PartitionCsmSuite) TestRetryNoMoreMessages(c *C) {
 	c.Assert(offsettrac.SparseAcks2Str(offsetsAfter[partition]), Equals, "")
 }
 
+// A message that is not acknowledged within the ack timeout the configured
+// number of times is produced to the dead letter topic and acknowledged.
+func (s *PartitionCsmSuite) TestDeadLetter(c *C) {
+	newestOffsets := s.kh.GetNewestOffsets(topic)
+	offsetBefore := newestOffsets[partition] - int64(2)
+	s.cfg.Consumer.AckTimeout = 200 * time.Millisecond
+	s.cfg.Consumer.DeadLetterAfter = 2
+	deadLettersCh := make(chan config.DeadLetter, 1)
+	s.cfg.Consumer.DeadLetterProducer = deadLetterProducerFn(func(dlTopic string, dl config.DeadLetter, done func(error)) {
+		c.Check(dlTopic, Equals, topic+".dlq")
+		deadLettersCh <- dl
+		done(nil)
+	})
+	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: offsetBefore}})
+
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
+	msg0 := <-pc.Messages()
+	sendEOffered(msg0)
+	msg1 := <-pc.Messages()
+	sendEOffered(msg1)
+	sendEAcked(msg0)
+
+	// When: the ack timeout of the second message expires twice.
+	msg1_1 := <-pc.Messages()
+	c.Assert(msg1_1.Offset, Equals, msg1.Offset)
+	sendEOffered(msg1_1)
+
+	// Then
+	var dl config.DeadLetter
+	select {
+	case dl = <-deadLettersCh:
+	case <-time.After(3 * time.Second):
+		c.Fatal("Message is not dead lettered")
+	}
+	c.Assert(dl.Group, Equals, group)
+	c.Assert(dl.Topic, Equals, topic)
+	c.Assert(dl.Partition, Equals, int32(partition))
+	c.Assert(dl.Offset, Equals, msg1.Offset)
+	c.Assert(dl.Value, DeepEquals, msg1.Value)
+	c.Assert(dl.AckTimeouts, Equals, 2)
+	pc.Stop()
+	offsetsAfter := s.kh.GetCommittedOffsets(group, topic)
+	c.Assert(offsetsAfter[partition].Val, Equals, offsetBefore+int64(2))
+}
+
 func (s *PartitionCsmSuite) TestAckedOnStop(c *C) {
 	offsetBefore := s.kh.GetNewestOffsets(topic)[partition] - 10
 	s.kh.SetOffsets(group, topic, []offsetmgr.Offset{{Val: offsetBefore}})
 	s.cfg.Consumer.AckTimeout = 200 * time.Millisecond
-	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF)
+	pc := Spawn(s.ns, group, topic, partition, s.cfg, s.groupMember, s.msgIStreamF, s.offsetMgrF, nil)
 
 	// Read and confirm offer of 2 messages
 	msg0 := <-pc.Messages()
@@ -478,7 +608,7 @@ func (s *PartitionCsmSuite) TestAckedOnStop(c *C) {
 func sendEOffered(msg consumer.Message) {
 	log.Infof("*** sending `offered`: offset=%d", msg.Offset)
 	select {
-	case msg.EventsCh <- consumer.Event{consumer.ETOffered, msg.Offset}:
+	case msg.EventsCh <- consumer.Event{T: consumer.ETOffered, Offset: msg.Offset}:
 	case <-time.After(500 * time.Millisecond):
 		log.Infof("*** timeout sending `offered`: offset=%d", msg.Offset)
 	}
@@ -487,8 +617,65 @@ func sendEOffered(msg consumer.Message) {
 func sendEAcked(msg consumer.Message) {
 	log.Infof("*** sending `acked`: offset=%d", msg.Offset)
 	select {
-	case msg.EventsCh <- consumer.Event{consumer.ETAcked, msg.Offset}:
+	case msg.EventsCh <- consumer.Event{T: consumer.ETAcked, Offset: msg.Offset}:
 	case <-time.After(500 * time.Millisecond):
 		log.Infof("*** timeout sending `acked`: offset=%d", msg.Offset)
 	}
 }
+
+type offsetInitializerFn func(group, topic string, partition int32) (int64, error)
+
+func (f offsetInitializerFn) InitialOffset(group, topic string, partition int32) (int64, error) {
+	return f(group, topic, partition)
+}
+
+type deadLetterProducerFn func(topic string, dl config.DeadLetter, done func(error))
+
+func (f deadLetterProducerFn) ProduceDeadLetter(topic string, dl config.DeadLetter, done func(error)) {
+	f(topic, dl, done)
+}
+
+type RetrySuite struct{}
+
+var _ = Suite(&RetrySuite{})
+
+// Messages of retry topics carry the original key and value, and are held
+// until the tier delay elapses since they were produced.
+func (s *RetrySuite) TestUnwrapRetry(c *C) {
+	pc := &T{actorID: actor.RootID.NewChild("T"), group: group, retryDelay: time.Minute}
+	encoded, err := json.Marshal(config.RetryEnvelope{
+		Group:     group,
+		Topic:     topic,
+		Key:       []byte("foo"),
+		Value:     []byte("bar"),
+		Retries:   2,
+		Timestamp: time.Now().Add(-20 * time.Second),
+	})
+	c.Assert(err, IsNil)
+
+	// When
+	msg, holdFor, ok := pc.unwrapRetry(consumer.Message{Offset: 7, Value: encoded})
+
+	// Then
+	c.Assert(ok, Equals, true)
+	c.Assert(msg.Offset, Equals, int64(7))
+	c.Assert(string(msg.Key), Equals, "foo")
+	c.Assert(string(msg.Value), Equals, "bar")
+	c.Assert(msg.Retries, Equals, 2)
+	c.Assert(holdFor > 30*time.Second && holdFor <= 40*time.Second, Equals, true, Commentf("holdFor=%s", holdFor))
+}
+
+// Retries of other groups and malformed messages are skipped.
+func (s *RetrySuite) TestUnwrapRetrySkipped(c *C) {
+	pc := &T{actorID: actor.RootID.NewChild("T"), group: group, retryDelay: time.Minute}
+	encoded, err := json.Marshal(config.RetryEnvelope{Group: "other", Topic: topic})
+	c.Assert(err, IsNil)
+
+	for _, value := range [][]byte{encoded, []byte("foo")} {
+		// When
+		_, _, ok := pc.unwrapRetry(consumer.Message{Value: value})
+
+		// Then
+		c.Assert(ok, Equals, false)
+	}
+}
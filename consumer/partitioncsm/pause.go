@@ -0,0 +1,47 @@
+package partitioncsm
+
+import (
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/none"
+)
+
+// Pause is a switch that makes partition consumers of a group/topic stop
+// offering messages, and therefore stop pulling them from message streams,
+// until it is turned off. Group membership and topic subscriptions are not
+// affected, so pausing does not trigger a rebalancing. A nil instance is never
+// on.
+type Pause struct {
+	mu        sync.Mutex
+	paused    bool
+	changedCh chan none.T
+}
+
+// NewPause creates a switch that is off.
+func NewPause() *Pause {
+	return &Pause{changedCh: make(chan none.T)}
+}
+
+// Set turns the switch on or off, notifying everybody watching it if the
+// state changes.
+func (p *Pause) Set(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return
+	}
+	p.paused = paused
+	close(p.changedCh)
+	p.changedCh = make(chan none.T)
+}
+
+// State returns whether the switch is on, and a channel that is closed when
+// the state changes.
+func (p *Pause) State() (bool, <-chan none.T) {
+	if p == nil {
+		return false, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused, p.changedCh
+}
@@ -0,0 +1,82 @@
+package topiccsm
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+)
+
+// dedupWindow remembers SHA-256 hashes of a message field of recently
+// consumed messages to detect duplicates. Hashes are forgotten when they get
+// older than the window, or when there are too many of them, the oldest
+// first.
+type dedupWindow struct {
+	field   string
+	window  time.Duration
+	maxSize int
+	seen    map[[sha256.Size]byte]dedupEntry
+	order   []dedupEntry
+}
+
+type dedupEntry struct {
+	hash      [sha256.Size]byte
+	partition int32
+	offset    int64
+	seenAt    time.Time
+}
+
+func newDedupWindow(cfg *config.ConsumerDedup) *dedupWindow {
+	field := cfg.Field
+	if field == "" {
+		field = config.DedupValue
+	}
+	return &dedupWindow{
+		field:   field,
+		window:  cfg.Window,
+		maxSize: cfg.MaxSize,
+		seen:    make(map[[sha256.Size]byte]dedupEntry),
+	}
+}
+
+// isDuplicate tells whether a message with the same field has been seen
+// within the window, and remembers the message if it has not. A message that
+// is seen again at the same partition and offset is not a duplicate, it is
+// being retried because a client has not acknowledged it in time. Messages
+// with a nil field, e.g. tombstones, are never considered duplicates.
+func (dw *dedupWindow) isDuplicate(msg consumer.Message, now time.Time) bool {
+	fieldVal := msg.Value
+	if dw.field == config.DedupKey {
+		fieldVal = msg.Key
+	}
+	if fieldVal == nil {
+		return false
+	}
+	dw.expire(now)
+	hash := sha256.Sum256(fieldVal)
+	if entry, ok := dw.seen[hash]; ok {
+		return entry.partition != msg.Partition || entry.offset != msg.Offset
+	}
+	if len(dw.order) >= dw.maxSize {
+		dw.forgetOldest()
+	}
+	entry := dedupEntry{hash: hash, partition: msg.Partition, offset: msg.Offset, seenAt: now}
+	dw.seen[hash] = entry
+	dw.order = append(dw.order, entry)
+	return false
+}
+
+// expire forgets all hashes that have been seen earlier than the window
+// before `now`.
+func (dw *dedupWindow) expire(now time.Time) {
+	for len(dw.order) > 0 && now.Sub(dw.order[0].seenAt) >= dw.window {
+		dw.forgetOldest()
+	}
+}
+
+func (dw *dedupWindow) forgetOldest() {
+	delete(dw.seen, dw.order[0].hash)
+	dw.order[0] = dedupEntry{}
+	dw.order = dw.order[1:]
+}
@@ -0,0 +1,123 @@
+package topiccsm
+
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/consumer/dispatcher"
+)
+
+// fairQueue keeps consume requests waiting for messages. Requests of a client
+// are served in the order they were received, but clients take turns, so that
+// a client that keeps many requests waiting gets no more messages than a
+// client that keeps just one.
+type fairQueue struct {
+	clients []*clientQueue
+	byName  map[string]*clientQueue
+	next    int
+	len     int
+}
+
+type clientQueue struct {
+	name     string
+	requests []dispatcher.Request
+}
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{byName: make(map[string]*clientQueue)}
+}
+
+// push adds a request to the end of the queue of its client. A client that
+// had no requests waiting is given the last turn.
+func (fq *fairQueue) push(req dispatcher.Request) {
+	cq := fq.byName[req.Client]
+	if cq == nil {
+		cq = &clientQueue{name: req.Client}
+		fq.byName[req.Client] = cq
+		// Insert the client right before the one whose turn is next, so it
+		// goes after all clients that have been waiting already.
+		fq.clients = append(fq.clients, nil)
+		copy(fq.clients[fq.next+1:], fq.clients[fq.next:])
+		fq.clients[fq.next] = cq
+		fq.next = (fq.next + 1) % len(fq.clients)
+	}
+	cq.requests = append(cq.requests, req)
+	fq.len++
+}
+
+// pop removes and returns the oldest request of the client whose turn it is.
+// It must not be called on an empty queue.
+func (fq *fairQueue) pop() dispatcher.Request {
+	cq := fq.clients[fq.next]
+	req := cq.requests[0]
+	cq.requests[0] = dispatcher.Request{}
+	cq.requests = cq.requests[1:]
+	fq.len--
+	if len(cq.requests) == 0 {
+		fq.removeClient(fq.next)
+		return req
+	}
+	fq.next = (fq.next + 1) % len(fq.clients)
+	return req
+}
+
+// expire removes all requests that have been waiting for longer than their
+// timeout by `now` and returns them.
+func (fq *fairQueue) expire(now time.Time) []dispatcher.Request {
+	var expired []dispatcher.Request
+	for i := 0; i < len(fq.clients); {
+		cq := fq.clients[i]
+		kept := cq.requests[:0]
+		for _, req := range cq.requests {
+			if !now.Before(deadlineOf(req)) {
+				expired = append(expired, req)
+				continue
+			}
+			kept = append(kept, req)
+		}
+		for j := len(kept); j < len(cq.requests); j++ {
+			cq.requests[j] = dispatcher.Request{}
+		}
+		fq.len -= len(cq.requests) - len(kept)
+		cq.requests = kept
+		if len(kept) == 0 {
+			fq.removeClient(i)
+			continue
+		}
+		i++
+	}
+	return expired
+}
+
+// nextDeadline returns the earliest deadline of all waiting requests. It must
+// not be called on an empty queue.
+func (fq *fairQueue) nextDeadline() time.Time {
+	var earliest time.Time
+	for i, cq := range fq.clients {
+		// Requests of a client are ordered by arrival, but timeouts may be
+		// different, so all of them have to be checked.
+		for j, req := range cq.requests {
+			deadline := deadlineOf(req)
+			if (i == 0 && j == 0) || deadline.Before(earliest) {
+				earliest = deadline
+			}
+		}
+	}
+	return earliest
+}
+
+func (fq *fairQueue) removeClient(i int) {
+	delete(fq.byName, fq.clients[i].name)
+	copy(fq.clients[i:], fq.clients[i+1:])
+	fq.clients[len(fq.clients)-1] = nil
+	fq.clients = fq.clients[:len(fq.clients)-1]
+	if i < fq.next {
+		fq.next--
+	}
+	if fq.next >= len(fq.clients) {
+		fq.next = 0
+	}
+}
+
+func deadlineOf(req dispatcher.Request) time.Time {
+	return req.Timestamp.Add(req.Timeout)
+}
@@ -9,13 +9,17 @@ import (
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/dispatcher"
+	"github.com/mailgun/kafka-pixy/errs"
 )
 
 // T implements a consumer request dispatch tier responsible for a particular
 // topic. It receives requests on the `Requests()` channel and replies with
 // messages received on `Messages()` channel. If there has been no message
-// received for `Config.Consumer.LongPollingTimeout` then a timeout error is
-// sent to the requests' reply channel.
+// received for the request timeout then a timeout error is sent to the
+// requests' reply channel. Messages are distributed between clients that have
+// requests waiting in a round robin fashion, see `fairQueue`. If deduplication
+// is configured for the group, then duplicate messages are acknowledged right
+// away instead of being delivered, see `dedupWindow`.
 //
 // implements `dispatcher.Tier`.
 // implements `multiplexer.Out`.
@@ -27,13 +31,14 @@ type T struct {
 	lifespanCh chan<- *T
 	requestsCh chan dispatcher.Request
 	messagesCh chan consumer.Message
+	dedup      *dedupWindow
 	wg         sync.WaitGroup
 }
 
 // Creates a topic consumer instance. It should be explicitly started in
 // accordance with the `dispatcher.Tier` contract.
 func New(namespace *actor.ID, group, topic string, cfg *config.Proxy, lifespanCh chan<- *T) *T {
-	return &T{
+	tc := &T{
 		actorID:    namespace.NewChild(fmt.Sprintf("T:%s", topic)),
 		cfg:        cfg,
 		group:      group,
@@ -46,6 +51,10 @@ func New(namespace *actor.ID, group, topic string, cfg *config.Proxy, lifespanCh
 		// consumer group member.
 		messagesCh: make(chan consumer.Message),
 	}
+	if dedupCfg := cfg.Consumer.Dedup[group]; dedupCfg != nil {
+		tc.dedup = newDedupWindow(dedupCfg)
+	}
+	return tc
 }
 
 // Topic returns the topic name this topic consumer is responsible for.
@@ -88,26 +97,64 @@ func (tc *T) run() {
 		tc.lifespanCh <- tc
 	}()
 
-	timeoutErr := consumer.ErrRequestTimeout(fmt.Errorf("long polling timeout"))
+	timeoutErr := errs.New(errs.ErrRequestTimeout, "long polling timeout")
 	timeoutResult := dispatcher.Response{Err: timeoutErr}
-	for consumeReq := range tc.requestsCh {
-		requestAge := time.Now().UTC().Sub(consumeReq.Timestamp)
-		ttl := tc.cfg.Consumer.LongPollingTimeout - requestAge
-		// The request has been waiting in the buffer for too long. If we
+	waiting := newFairQueue()
+	requestsCh := tc.requestsCh
+	for {
+		// Requests that have been waiting for too long are rejected. If we
 		// reply with a fetched message, then there is a good chance that the
 		// client won't receive it due to the client HTTP timeout. Therefore
 		// we reject the request to avoid message loss.
-		if ttl <= 0 {
+		for _, consumeReq := range waiting.expire(time.Now()) {
 			consumeReq.ResponseCh <- timeoutResult
-			continue
 		}
-
+		// Requests that have been received before the tier was stopped are
+		// served anyway.
+		if requestsCh == nil && waiting.len == 0 {
+			return
+		}
+		// Requests are not taken off the channel when there are too many of
+		// them waiting already, so that the dispatcher rejects requests of
+		// clients that are pulling too aggressively.
+		nilOrRequestsCh := requestsCh
+		if waiting.len >= tc.cfg.Consumer.ChannelBufferSize {
+			nilOrRequestsCh = nil
+		}
+		var nilOrMessagesCh chan consumer.Message
+		var nilOrTimeoutCh <-chan time.Time
+		var timer *time.Timer
+		if waiting.len > 0 {
+			nilOrMessagesCh = tc.messagesCh
+			timer = time.NewTimer(time.Until(waiting.nextDeadline()))
+			nilOrTimeoutCh = timer.C
+		}
 		select {
-		case msg := <-tc.messagesCh:
-			msg.EventsCh <- consumer.Event{consumer.ETOffered, msg.Offset}
+		case consumeReq, ok := <-nilOrRequestsCh:
+			if !ok {
+				requestsCh = nil
+				break
+			}
+			// Heartbeats have already done their job by getting here.
+			if consumeReq.Heartbeat {
+				consumeReq.ResponseCh <- dispatcher.Response{}
+				break
+			}
+			waiting.push(consumeReq)
+		case msg := <-nilOrMessagesCh:
+			msg.EventsCh <- consumer.Event{T: consumer.ETOffered, Offset: msg.Offset}
+			// Duplicates are acknowledged, so that their offsets get
+			// committed, and the request keeps waiting for another message.
+			if tc.dedup != nil && tc.dedup.isDuplicate(msg, time.Now()) {
+				msg.EventsCh <- consumer.Ack(msg.Offset)
+				break
+			}
+			consumeReq := waiting.pop()
 			consumeReq.ResponseCh <- dispatcher.Response{Msg: msg}
-		case <-time.After(ttl):
-			consumeReq.ResponseCh <- timeoutResult
+		case <-nilOrTimeoutCh:
+		}
+		if timer != nil {
+			timer.Stop()
 		}
 	}
 }
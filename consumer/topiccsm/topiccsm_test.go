@@ -0,0 +1,225 @@
+package topiccsm
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/consumer/dispatcher"
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&TopicCsmSuite{})
+
+type TopicCsmSuite struct {
+	ns  *actor.ID
+	cfg *config.Proxy
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *TopicCsmSuite) SetUpTest(c *C) {
+	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
+}
+
+// Messages are distributed between clients in a round robin fashion, no
+// matter how many requests each of them has waiting.
+func (s *TopicCsmSuite) TestRoundRobin(c *C) {
+	tc, stop := s.spawn()
+	defer stop()
+
+	resultsCh := make(chan string, 10)
+	for _, client := range []string{"a", "a", "a", "b", "a", "c", "b"} {
+		s.request(tc, client, time.Minute, resultsCh)
+	}
+	// Make sure all requests are waiting before messages start coming.
+	time.Sleep(50 * time.Millisecond)
+
+	// When
+	eventsCh := make(chan consumer.Event, 10)
+	var clients string
+	for i := 0; i < 7; i++ {
+		tc.Messages() <- consumer.Message{Topic: "foo", Offset: int64(i), EventsCh: eventsCh}
+		clients += <-resultsCh
+	}
+
+	// Then
+	c.Assert(clients, Equals, "abcabaa")
+	c.Assert(len(eventsCh), Equals, 7)
+}
+
+// Requests that are not served within their timeouts are rejected, while
+// requests of the same client with longer timeouts keep waiting.
+func (s *TopicCsmSuite) TestTimeout(c *C) {
+	tc, stop := s.spawn()
+	defer stop()
+
+	resultsCh := make(chan string, 10)
+	s.request(tc, "a", time.Minute, resultsCh)
+	s.request(tc, "a", 100*time.Millisecond, resultsCh)
+	s.request(tc, "b", 200*time.Millisecond, resultsCh)
+
+	// When/Then
+	c.Assert(<-resultsCh, Equals, "a:timeout")
+	c.Assert(<-resultsCh, Equals, "b:timeout")
+
+	tc.Messages() <- consumer.Message{Topic: "foo", EventsCh: make(chan consumer.Event, 1)}
+	c.Assert(<-resultsCh, Equals, "a")
+}
+
+// Heartbeats are replied to right away, and do not take messages from
+// consume requests.
+func (s *TopicCsmSuite) TestHeartbeat(c *C) {
+	tc, stop := s.spawn()
+	defer stop()
+
+	resultsCh := make(chan string, 10)
+	s.request(tc, "a", time.Minute, resultsCh)
+	responseCh := make(chan dispatcher.Response, 1)
+
+	// When
+	tc.Requests() <- dispatcher.Request{
+		Timestamp:  time.Now(),
+		Group:      "g1",
+		Topic:      "foo",
+		ResponseCh: responseCh,
+		Heartbeat:  true,
+	}
+
+	// Then
+	c.Assert(<-responseCh, DeepEquals, dispatcher.Response{})
+	tc.Messages() <- consumer.Message{Topic: "foo", EventsCh: make(chan consumer.Event, 1)}
+	c.Assert(<-resultsCh, Equals, "a")
+}
+
+// Requests received before the tier is stopped are still served.
+func (s *TopicCsmSuite) TestStopWithWaiting(c *C) {
+	tc, _ := s.spawn()
+
+	resultsCh := make(chan string, 10)
+	s.request(tc, "a", 100*time.Millisecond, resultsCh)
+	s.request(tc, "b", 200*time.Millisecond, resultsCh)
+	time.Sleep(50 * time.Millisecond)
+
+	// When
+	tc.Stop()
+
+	// Then
+	c.Assert(<-resultsCh, Equals, "a:timeout")
+	c.Assert(<-resultsCh, Equals, "b:timeout")
+}
+
+// Messages with a value that has already been consumed within the dedup
+// window are acknowledged without being delivered, while the request keeps
+// waiting for the next message.
+func (s *TopicCsmSuite) TestDedup(c *C) {
+	s.cfg.Consumer.Dedup = map[string]*config.ConsumerDedup{
+		"g1": {Window: time.Minute, MaxSize: 10},
+	}
+	tc, stop := s.spawn()
+	defer stop()
+
+	resultsCh := make(chan string, 10)
+	eventsCh := make(chan consumer.Event, 10)
+	s.request(tc, "a", time.Minute, resultsCh)
+	s.request(tc, "b", time.Minute, resultsCh)
+	time.Sleep(50 * time.Millisecond)
+
+	// When
+	for i, value := range []string{"foo", "foo", "bar"} {
+		tc.Messages() <- consumer.Message{Topic: "foo", Offset: int64(i), Value: []byte(value), EventsCh: eventsCh}
+	}
+
+	// Then
+	results := []string{<-resultsCh, <-resultsCh}
+	sort.Strings(results)
+	c.Assert(results, DeepEquals, []string{"a", "b"})
+	c.Assert(len(eventsCh), Equals, 4)
+	c.Assert(<-eventsCh, Equals, consumer.Event{T: consumer.ETOffered, Offset: 0})
+	c.Assert(<-eventsCh, Equals, consumer.Event{T: consumer.ETOffered, Offset: 1})
+	c.Assert(<-eventsCh, Equals, consumer.Ack(1))
+	c.Assert(<-eventsCh, Equals, consumer.Event{T: consumer.ETOffered, Offset: 2})
+}
+
+// A message retried because it has not been acknowledged in time is not a
+// duplicate of itself.
+func (s *TopicCsmSuite) TestDedupRetry(c *C) {
+	s.cfg.Consumer.Dedup = map[string]*config.ConsumerDedup{
+		"g1": {Window: time.Minute, MaxSize: 10},
+	}
+	tc, stop := s.spawn()
+	defer stop()
+
+	resultsCh := make(chan string, 10)
+	eventsCh := make(chan consumer.Event, 10)
+	s.request(tc, "a", time.Minute, resultsCh)
+	s.request(tc, "a", time.Minute, resultsCh)
+	time.Sleep(50 * time.Millisecond)
+
+	// When
+	for i := 0; i < 2; i++ {
+		tc.Messages() <- consumer.Message{Topic: "foo", Offset: 7, Value: []byte("foo"), EventsCh: eventsCh}
+		c.Assert(<-resultsCh, Equals, "a")
+	}
+
+	// Then
+	c.Assert(len(eventsCh), Equals, 2)
+}
+
+// Hashes are forgotten when their window expires, or when there are too many
+// of them.
+func (s *TopicCsmSuite) TestDedupWindow(c *C) {
+	dw := newDedupWindow(&config.ConsumerDedup{Field: config.DedupKey, Window: time.Minute, MaxSize: 2})
+	now := time.Now()
+	msg := func(offset int64, key string) consumer.Message {
+		return consumer.Message{Offset: offset, Key: []byte(key)}
+	}
+
+	c.Assert(dw.isDuplicate(msg(0, "a"), now), Equals, false)
+	c.Assert(dw.isDuplicate(msg(1, "a"), now.Add(59*time.Second)), Equals, true)
+	c.Assert(dw.isDuplicate(msg(2, "a"), now.Add(time.Minute)), Equals, false)
+	c.Assert(dw.isDuplicate(msg(3, "b"), now.Add(time.Minute)), Equals, false)
+	c.Assert(dw.isDuplicate(msg(4, "c"), now.Add(time.Minute)), Equals, false)
+	c.Assert(dw.isDuplicate(msg(5, "a"), now.Add(time.Minute)), Equals, false)
+	c.Assert(dw.isDuplicate(msg(6, "c"), now.Add(time.Minute)), Equals, true)
+	// Messages without a key are never duplicates.
+	c.Assert(dw.isDuplicate(consumer.Message{Offset: 7}, now), Equals, false)
+	c.Assert(dw.isDuplicate(consumer.Message{Offset: 8}, now), Equals, false)
+}
+
+func (s *TopicCsmSuite) spawn() (*T, func()) {
+	lifespanCh := make(chan *T, 2)
+	tc := New(s.ns, "g1", "foo", s.cfg, lifespanCh)
+	stoppedCh := make(chan dispatcher.Tier, 1)
+	tc.Start(stoppedCh)
+	return tc, tc.Stop
+}
+
+// request sends a consume request to the topic consumer on behalf of the
+// client, and reports the client name to `resultsCh` when a reply comes in.
+func (s *TopicCsmSuite) request(tc *T, client string, timeout time.Duration, resultsCh chan<- string) {
+	responseCh := make(chan dispatcher.Response, 1)
+	tc.Requests() <- dispatcher.Request{
+		Timestamp:  time.Now(),
+		Group:      "g1",
+		Topic:      "foo",
+		Timeout:    timeout,
+		ResponseCh: responseCh,
+		Client:     client,
+	}
+	go func() {
+		res := <-responseCh
+		if errs.Is(res.Err, errs.ErrRequestTimeout) {
+			resultsCh <- client + ":timeout"
+			return
+		}
+		resultsCh <- client
+	}()
+}
@@ -0,0 +1,120 @@
+// Package errs defines kinds of errors returned by Kafka-Pixy components.
+// Errors returned by the components are either the sentinel values defined
+// here, or they wrap them, so they can be classified with `errors.Is`:
+//
+//	if errors.Is(err, errs.ErrRequestTimeout) {
+//	    // back off and retry
+//	}
+//
+// Details of an error are available via `errors.As` with `*errs.T`.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSetup is returned when a component fails to initialize, e.g. if it
+	// cannot connect to Kafka or ZooKeeper.
+	ErrSetup = errors.New("setup failed")
+
+	// ErrTooManyRequests is returned when a request cannot be accepted because
+	// internal buffers are full.
+	ErrTooManyRequests = errors.New("too many requests")
+
+	// ErrRequestTimeout is returned when a request has not been completed
+	// within the allotted time.
+	ErrRequestTimeout = errors.New("request timeout")
+
+	// ErrInvalidParam is returned when a request has an invalid parameter.
+	ErrInvalidParam = errors.New("invalid parameter")
+
+	// ErrQuery is returned when Kafka or ZooKeeper fails to serve a query.
+	ErrQuery = errors.New("query failed")
+
+	// ErrDisabled is returned when a request is rejected because the
+	// operation has been disabled by an operator.
+	ErrDisabled = errors.New("disabled")
+
+	// ErrMaintenance is returned when a request that produces messages or
+	// modifies offsets is rejected because the service is in maintenance
+	// mode.
+	ErrMaintenance = errors.New("maintenance")
+
+	// ErrDraining is returned when a consume request is rejected because the
+	// service is draining before shutdown.
+	ErrDraining = errors.New("draining")
+)
+
+// T is an error of a particular kind. `errors.Is(err, kind)` is true for it,
+// and it unwraps to the cause if there is one.
+type T struct {
+	Kind  error
+	Desc  string
+	Cause error
+}
+
+// New creates an error of the specified kind with a formatted description.
+func New(kind error, format string, v ...interface{}) error {
+	return &T{Kind: kind, Desc: fmt.Sprintf(format, v...)}
+}
+
+// Wrap creates an error of the specified kind with a formatted description
+// that is caused by `cause`.
+func Wrap(kind, cause error, format string, v ...interface{}) error {
+	return &T{Kind: kind, Desc: fmt.Sprintf(format, v...), Cause: cause}
+}
+
+func (e *T) Error() string {
+	if e.Cause == nil {
+		return e.Desc
+	}
+	return fmt.Sprintf("%s, err=(%s)", e.Desc, e.Cause)
+}
+
+// Is makes `errors.Is(e, e.Kind)` true.
+func (e *T) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap makes the cause available to `errors.Is` and `errors.As`.
+func (e *T) Unwrap() error {
+	return e.Cause
+}
+
+// Is is the same as `errors.Is`, except it also follows the chain of causes
+// of errors created by `github.com/pkg/errors`, that do not support
+// unwrapping.
+func Is(err, target error) bool {
+	for err != nil {
+		if errors.Is(err, target) {
+			return true
+		}
+		err = cause(err)
+	}
+	return false
+}
+
+// As is the same as `errors.As`, except it also follows the chain of causes
+// of errors created by `github.com/pkg/errors`, that do not support
+// unwrapping.
+func As(err error, target interface{}) bool {
+	for err != nil {
+		if errors.As(err, target) {
+			return true
+		}
+		err = cause(err)
+	}
+	return false
+}
+
+func cause(err error) error {
+	causer, ok := err.(interface {
+		Cause() error
+	})
+	if !ok {
+		return nil
+	}
+	return causer.Cause()
+}
@@ -0,0 +1,67 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ErrsSuite{})
+
+type ErrsSuite struct{}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type testErr struct {
+	code int
+}
+
+func (e testErr) Error() string {
+	return fmt.Sprintf("test error %d", e.code)
+}
+
+func (s *ErrsSuite) TestError(c *C) {
+	c.Assert(New(ErrRequestTimeout, "long polling timeout").Error(), Equals,
+		"long polling timeout")
+	c.Assert(Wrap(ErrSetup, testErr{1}, "failed to create %s", "zk.Conn").Error(), Equals,
+		"failed to create zk.Conn, err=(test error 1)")
+}
+
+// An error matches its kind and its cause, but not other kinds.
+func (s *ErrsSuite) TestIs(c *C) {
+	cause := testErr{1}
+	err := Wrap(ErrQuery, cause, "failed to fetch offsets")
+
+	c.Assert(errors.Is(err, ErrQuery), Equals, true)
+	c.Assert(errors.Is(err, cause), Equals, true)
+	c.Assert(errors.Is(err, ErrSetup), Equals, false)
+	c.Assert(errors.Is(err, testErr{2}), Equals, false)
+}
+
+// Errors wrapped with fmt.Errorf and github.com/pkg/errors are classified too.
+func (s *ErrsSuite) TestIsWrapped(c *C) {
+	err := New(ErrTooManyRequests, "buffer overflow")
+
+	c.Assert(Is(fmt.Errorf("consume failed: %w", err), ErrTooManyRequests), Equals, true)
+	c.Assert(Is(pkgerrors.Wrap(err, "consume failed"), ErrTooManyRequests), Equals, true)
+	c.Assert(Is(pkgerrors.Wrap(err, "consume failed"), ErrRequestTimeout), Equals, false)
+	c.Assert(Is(nil, ErrTooManyRequests), Equals, false)
+}
+
+func (s *ErrsSuite) TestAs(c *C) {
+	err := pkgerrors.Wrap(Wrap(ErrQuery, testErr{7}, "failed to fetch offsets"), "get offsets")
+
+	var errT *T
+	c.Assert(As(err, &errT), Equals, true)
+	c.Assert(errT.Kind, Equals, ErrQuery)
+	c.Assert(errT.Desc, Equals, "failed to fetch offsets")
+
+	var cause testErr
+	c.Assert(As(err, &cause), Equals, true)
+	c.Assert(cause.code, Equals, 7)
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+)
+
+// Event types.
+const (
+	// A group consumer of the proxy started or stopped consuming on behalf of
+	// a group.
+	TypeGroupJoined = "group_joined"
+	TypeGroupLeft   = "group_left"
+
+	// A group consumer rebalanced partitions, successfully or not.
+	TypeRebalanced = "rebalanced"
+
+	// A partition consumer found the committed offset out of range and
+	// started consuming from another one.
+	TypeOffsetReset = "offset_reset"
+
+	// Offsets of a group were committed via the admin API.
+	TypeOffsetsSet = "offsets_set"
+
+	// A partition consumer produced a message that had not been acknowledged
+	// in time too many times to the dead letter topic.
+	TypeDeadLettered = "dead_lettered"
+
+	// An error that an operator should know about occurred.
+	TypeError = "error"
+)
+
+// Producer defines a subset of the producer API that is used to publish
+// events to a Kafka topic.
+type Producer interface {
+	AsyncProduce(topic string, key, message sarama.Encoder)
+}
+
+// Event is a lifecycle event of a proxy in the form it is published in.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// Alias of the proxy and ID of the Kafka-Pixy instance the event
+	// occurred in.
+	Proxy    string `json:"proxy"`
+	ClientID string `json:"client_id"`
+	Group    string `json:"group,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+	// Event type specific details.
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// T publishes lifecycle events of a proxy to a Kafka topic. Events are
+// buffered and produced asynchronously, so emitting an event never blocks. A
+// nil instance publishes nothing.
+//
+// implements `config.EventListener`.
+type T struct {
+	actorID  *actor.ID
+	proxy    string
+	cfg      *config.Proxy
+	prod     Producer
+	eventsCh chan Event
+	dropped  int64
+	stopCh   chan none.T
+	wg       sync.WaitGroup
+
+	// To be used in tests only
+	now func() time.Time
+}
+
+// Spawn creates an event publisher instance and starts its internal
+// goroutine. Events are produced with `prod` to `Events.Topic` of `cfg`.
+func Spawn(namespace *actor.ID, proxy string, cfg *config.Proxy, prod Producer) *T {
+	p := &T{
+		actorID:  namespace.NewChild("events"),
+		proxy:    proxy,
+		cfg:      cfg,
+		prod:     prod,
+		eventsCh: make(chan Event, cfg.Events.BufferSize),
+		stopCh:   make(chan none.T),
+		now:      time.Now,
+	}
+	actor.Spawn(p.actorID, &p.wg, p.run)
+	return p
+}
+
+// Stop terminates the publisher goroutine. Buffered events are produced
+// before it returns, and events emitted after that are dropped.
+func (p *T) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+}
+
+// Emit publishes an event of the specified type. If the buffer is full then
+// the event is dropped.
+func (p *T) Emit(eventType, group, topic string, attrs map[string]interface{}) {
+	if p == nil {
+		return
+	}
+	event := Event{
+		Time:     p.now().UTC(),
+		Type:     eventType,
+		Proxy:    p.proxy,
+		ClientID: p.cfg.ClientID,
+		Group:    group,
+		Topic:    topic,
+		Attrs:    attrs,
+	}
+	select {
+	case p.eventsCh <- event:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+// implements `config.EventListener`.
+func (p *T) OnEvent(eventType, group, topic string, attrs map[string]interface{}) {
+	p.Emit(eventType, group, topic, attrs)
+}
+
+func (p *T) run() {
+	for {
+		select {
+		case event := <-p.eventsCh:
+			p.produce(event)
+		case <-p.stopCh:
+			for {
+				select {
+				case event := <-p.eventsCh:
+					p.produce(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// produce publishes the event keyed by group, so that events of a group are
+// ordered, or by client ID if the event is not related to a group.
+func (p *T) produce(event Event) {
+	if dropped := atomic.SwapInt64(&p.dropped, 0); dropped > 0 {
+		log.Warningf("<%s> events dropped: %d", p.actorID, dropped)
+	}
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("<%s> failed to encode event: type=%s, err=(%s)", p.actorID, event.Type, err)
+		return
+	}
+	key := event.Group
+	if key == "" {
+		key = event.ClientID
+	}
+	p.prod.AsyncProduce(p.cfg.Events.Topic, sarama.StringEncoder(key), sarama.ByteEncoder(encoded))
+}
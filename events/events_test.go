@@ -0,0 +1,101 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/none"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&EventsSuite{})
+
+type EventsSuite struct {
+	ns  *actor.ID
+	cfg *config.Proxy
+	now time.Time
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *EventsSuite) SetUpTest(c *C) {
+	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
+	s.cfg.ClientID = "pixy1"
+	s.cfg.Events.Topic = "pixy-events"
+	s.now = time.Date(2016, 11, 3, 10, 15, 0, 0, time.UTC)
+}
+
+// Events are produced to the events topic as JSON keyed by group, or by client
+// ID if they are not related to a group.
+func (s *EventsSuite) TestProduce(c *C) {
+	prod := &mockProducer{}
+	p := Spawn(s.ns, "pxy", s.cfg, prod)
+	p.now = func() time.Time { return s.now }
+
+	// When
+	p.OnEvent(TypeRebalanced, "g1", "", map[string]interface{}{"trigger": "membership"})
+	p.Emit(TypeError, "", "", map[string]interface{}{"error": "Kaboom!"})
+	p.Stop()
+
+	// Then
+	c.Assert(len(prod.msgs), Equals, 2)
+	c.Assert(prod.msgs[0].Topic, Equals, "pixy-events")
+	c.Assert(prod.msgs[0].Key, Equals, sarama.StringEncoder("g1"))
+	c.Assert(prod.msgs[1].Key, Equals, sarama.StringEncoder("pixy1"))
+	encoded, _ := prod.msgs[0].Value.Encode()
+	c.Assert(string(encoded), Equals, `{"time":"2016-11-03T10:15:00Z","type":"rebalanced",`+
+		`"proxy":"pxy","client_id":"pixy1","group":"g1","attrs":{"trigger":"membership"}}`)
+	var event Event
+	encoded, _ = prod.msgs[1].Value.Encode()
+	c.Assert(json.Unmarshal(encoded, &event), IsNil)
+	c.Assert(event, DeepEquals, Event{
+		Time: s.now, Type: TypeError, Proxy: "pxy", ClientID: "pixy1",
+		Attrs: map[string]interface{}{"error": "Kaboom!"}})
+}
+
+// Events emitted when the buffer is full are dropped.
+func (s *EventsSuite) TestBufferFull(c *C) {
+	prod := &mockProducer{}
+	p := &T{
+		actorID:  s.ns.NewChild("events"),
+		cfg:      s.cfg,
+		prod:     prod,
+		eventsCh: make(chan Event, 2),
+		stopCh:   make(chan none.T),
+		now:      time.Now,
+	}
+
+	// When
+	p.Emit(TypeGroupJoined, "g1", "", nil)
+	p.Emit(TypeGroupJoined, "g2", "", nil)
+	p.Emit(TypeGroupJoined, "g3", "", nil)
+
+	// Then
+	c.Assert(p.dropped, Equals, int64(1))
+	actor.Spawn(p.actorID, &p.wg, p.run)
+	p.Stop()
+	c.Assert(len(prod.msgs), Equals, 2)
+	c.Assert(prod.msgs[1].Key, Equals, sarama.StringEncoder("g2"))
+	c.Assert(p.dropped, Equals, int64(0))
+}
+
+// A nil instance ignores events.
+func (s *EventsSuite) TestNil(c *C) {
+	var p *T
+	p.Emit(TypeGroupLeft, "g1", "", nil)
+}
+
+type mockProducer struct {
+	msgs []*sarama.ProducerMessage
+}
+
+func (p *mockProducer) AsyncProduce(topic string, key, message sarama.Encoder) {
+	p.msgs = append(p.msgs, &sarama.ProducerMessage{Topic: topic, Key: key, Value: message})
+}
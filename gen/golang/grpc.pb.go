@@ -13,6 +13,20 @@ It has these top-level messages:
 	ProdRes
 	ConsReq
 	ConsRes
+	ConsNReq
+	AckReq
+	AckRes
+	RetryRes
+	NackReq
+	PartitionOffset
+	GetOffsetsReq
+	GetOffsetsRes
+	SetOffsetsReq
+	SetOffsetsRes
+	GroupMember
+	ConsumerGroup
+	ListConsumersReq
+	ListConsumersRes
 */
 package pb
 
@@ -37,12 +51,13 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type ProdReq struct {
-	Proxy        string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
-	Topic        string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
-	KeyValue     []byte `protobuf:"bytes,3,opt,name=key_value,json=keyValue,proto3" json:"key_value,omitempty"`
-	KeyUndefined bool   `protobuf:"varint,4,opt,name=key_undefined,json=keyUndefined" json:"key_undefined,omitempty"`
-	Message      []byte `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
-	AsyncMode    bool   `protobuf:"varint,6,opt,name=async_mode,json=asyncMode" json:"async_mode,omitempty"`
+	Proxy         string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic         string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	KeyValue      []byte `protobuf:"bytes,3,opt,name=key_value,json=keyValue,proto3" json:"key_value,omitempty"`
+	KeyUndefined  bool   `protobuf:"varint,4,opt,name=key_undefined,json=keyUndefined" json:"key_undefined,omitempty"`
+	Message       []byte `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	AsyncMode     bool   `protobuf:"varint,6,opt,name=async_mode,json=asyncMode" json:"async_mode,omitempty"`
+	CorrelationId string `protobuf:"bytes,7,opt,name=correlation_id,json=correlationId" json:"correlation_id,omitempty"`
 }
 
 func (m *ProdReq) Reset()                    { *m = ProdReq{} }
@@ -92,9 +107,19 @@ func (m *ProdReq) GetAsyncMode() bool {
 	return false
 }
 
+func (m *ProdReq) GetCorrelationId() string {
+	if m != nil {
+		return m.CorrelationId
+	}
+	return ""
+}
+
 type ProdRes struct {
-	Partition int32 `protobuf:"varint,1,opt,name=partition" json:"partition,omitempty"`
-	Offset    int64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Partition     int32  `protobuf:"varint,1,opt,name=partition" json:"partition,omitempty"`
+	Offset        int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	CorrelationId string `protobuf:"bytes,3,opt,name=correlation_id,json=correlationId" json:"correlation_id,omitempty"`
+	ErrorCode     int32  `protobuf:"varint,4,opt,name=error_code,json=errorCode" json:"error_code,omitempty"`
+	ErrorDesc     string `protobuf:"bytes,5,opt,name=error_desc,json=errorDesc" json:"error_desc,omitempty"`
 }
 
 func (m *ProdRes) Reset()                    { *m = ProdRes{} }
@@ -116,10 +141,34 @@ func (m *ProdRes) GetOffset() int64 {
 	return 0
 }
 
+func (m *ProdRes) GetCorrelationId() string {
+	if m != nil {
+		return m.CorrelationId
+	}
+	return ""
+}
+
+func (m *ProdRes) GetErrorCode() int32 {
+	if m != nil {
+		return m.ErrorCode
+	}
+	return 0
+}
+
+func (m *ProdRes) GetErrorDesc() string {
+	if m != nil {
+		return m.ErrorDesc
+	}
+	return ""
+}
+
 type ConsReq struct {
-	Proxy string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
-	Topic string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
-	Group string `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Proxy           string   `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic           string   `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group           string   `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	KeyFilter       []byte   `protobuf:"bytes,4,opt,name=key_filter,json=keyFilter,proto3" json:"key_filter,omitempty"`
+	KeyFilterPrefix bool     `protobuf:"varint,5,opt,name=key_filter_prefix,json=keyFilterPrefix" json:"key_filter_prefix,omitempty"`
+	Topics          []string `protobuf:"bytes,6,rep,name=topics" json:"topics,omitempty"`
 }
 
 func (m *ConsReq) Reset()                    { *m = ConsReq{} }
@@ -148,12 +197,36 @@ func (m *ConsReq) GetGroup() string {
 	return ""
 }
 
+func (m *ConsReq) GetKeyFilter() []byte {
+	if m != nil {
+		return m.KeyFilter
+	}
+	return nil
+}
+
+func (m *ConsReq) GetKeyFilterPrefix() bool {
+	if m != nil {
+		return m.KeyFilterPrefix
+	}
+	return false
+}
+
+func (m *ConsReq) GetTopics() []string {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
+}
+
 type ConsRes struct {
 	Partition    int32  `protobuf:"varint,1,opt,name=partition" json:"partition,omitempty"`
 	Offset       int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
 	KeyValue     []byte `protobuf:"bytes,3,opt,name=key_value,json=keyValue,proto3" json:"key_value,omitempty"`
 	KeyUndefined bool   `protobuf:"varint,4,opt,name=key_undefined,json=keyUndefined" json:"key_undefined,omitempty"`
 	Message      []byte `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Topic        string `protobuf:"bytes,6,opt,name=topic" json:"topic,omitempty"`
+	Retries      int32  `protobuf:"varint,7,opt,name=retries" json:"retries,omitempty"`
+	Fields       string `protobuf:"bytes,8,opt,name=fields" json:"fields,omitempty"`
 }
 
 func (m *ConsRes) Reset()                    { *m = ConsRes{} }
@@ -196,139 +269,1050 @@ func (m *ConsRes) GetMessage() []byte {
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*ProdReq)(nil), "ProdReq")
-	proto.RegisterType((*ProdRes)(nil), "ProdRes")
-	proto.RegisterType((*ConsReq)(nil), "ConsReq")
-	proto.RegisterType((*ConsRes)(nil), "ConsRes")
+func (m *ConsRes) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *ConsRes) GetRetries() int32 {
+	if m != nil {
+		return m.Retries
+	}
+	return 0
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+func (m *ConsRes) GetFields() string {
+	if m != nil {
+		return m.Fields
+	}
+	return ""
+}
 
-// Client API for KafkaPixy service
+type ConsNReq struct {
+	Proxy           string   `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic           string   `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group           string   `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	AutoAck         bool     `protobuf:"varint,4,opt,name=auto_ack,json=autoAck" json:"auto_ack,omitempty"`
+	KeyFilter       []byte   `protobuf:"bytes,5,opt,name=key_filter,json=keyFilter,proto3" json:"key_filter,omitempty"`
+	KeyFilterPrefix bool     `protobuf:"varint,6,opt,name=key_filter_prefix,json=keyFilterPrefix" json:"key_filter_prefix,omitempty"`
+	Topics          []string `protobuf:"bytes,7,rep,name=topics" json:"topics,omitempty"`
+}
 
-type KafkaPixyClient interface {
-	Produce(ctx context.Context, in *ProdReq, opts ...grpc.CallOption) (*ProdRes, error)
-	Consume(ctx context.Context, in *ConsReq, opts ...grpc.CallOption) (*ConsRes, error)
+func (m *ConsNReq) Reset()                    { *m = ConsNReq{} }
+func (m *ConsNReq) String() string            { return proto.CompactTextString(m) }
+func (*ConsNReq) ProtoMessage()               {}
+func (*ConsNReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ConsNReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
+	}
+	return ""
 }
 
-type kafkaPixyClient struct {
-	cc *grpc.ClientConn
+func (m *ConsNReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
 }
 
-func NewKafkaPixyClient(cc *grpc.ClientConn) KafkaPixyClient {
-	return &kafkaPixyClient{cc}
+func (m *ConsNReq) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
 }
 
-func (c *kafkaPixyClient) Produce(ctx context.Context, in *ProdReq, opts ...grpc.CallOption) (*ProdRes, error) {
-	out := new(ProdRes)
-	err := grpc.Invoke(ctx, "/KafkaPixy/Produce", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *ConsNReq) GetAutoAck() bool {
+	if m != nil {
+		return m.AutoAck
 	}
-	return out, nil
+	return false
 }
 
-func (c *kafkaPixyClient) Consume(ctx context.Context, in *ConsReq, opts ...grpc.CallOption) (*ConsRes, error) {
-	out := new(ConsRes)
-	err := grpc.Invoke(ctx, "/KafkaPixy/Consume", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *ConsNReq) GetKeyFilter() []byte {
+	if m != nil {
+		return m.KeyFilter
 	}
-	return out, nil
+	return nil
 }
 
-// Server API for KafkaPixy service
+func (m *ConsNReq) GetKeyFilterPrefix() bool {
+	if m != nil {
+		return m.KeyFilterPrefix
+	}
+	return false
+}
 
-type KafkaPixyServer interface {
-	Produce(context.Context, *ProdReq) (*ProdRes, error)
-	Consume(context.Context, *ConsReq) (*ConsRes, error)
+func (m *ConsNReq) GetTopics() []string {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
 }
 
-func RegisterKafkaPixyServer(s *grpc.Server, srv KafkaPixyServer) {
-	s.RegisterService(&_KafkaPixy_serviceDesc, srv)
+type AckReq struct {
+	Proxy     string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic     string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group     string `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Partition int32  `protobuf:"varint,4,opt,name=partition" json:"partition,omitempty"`
+	Offset    int64  `protobuf:"varint,5,opt,name=offset" json:"offset,omitempty"`
 }
 
-func _KafkaPixy_Produce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ProdReq)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *AckReq) Reset()                    { *m = AckReq{} }
+func (m *AckReq) String() string            { return proto.CompactTextString(m) }
+func (*AckReq) ProtoMessage()               {}
+func (*AckReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *AckReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
 	}
-	if interceptor == nil {
-		return srv.(KafkaPixyServer).Produce(ctx, in)
+	return ""
+}
+
+func (m *AckReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/KafkaPixy/Produce",
+	return ""
+}
+
+func (m *AckReq) GetGroup() string {
+	if m != nil {
+		return m.Group
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KafkaPixyServer).Produce(ctx, req.(*ProdReq))
+	return ""
+}
+
+func (m *AckReq) GetPartition() int32 {
+	if m != nil {
+		return m.Partition
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-func _KafkaPixy_Consume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ConsReq)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *AckReq) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
 	}
-	if interceptor == nil {
-		return srv.(KafkaPixyServer).Consume(ctx, in)
+	return 0
+}
+
+type AckRes struct {
+}
+
+func (m *AckRes) Reset()                    { *m = AckRes{} }
+func (m *AckRes) String() string            { return proto.CompactTextString(m) }
+func (*AckRes) ProtoMessage()               {}
+func (*AckRes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+type RetryRes struct {
+	Topic        string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+	Retries      int32  `protobuf:"varint,2,opt,name=retries" json:"retries,omitempty"`
+	DeadLettered bool   `protobuf:"varint,3,opt,name=dead_lettered,json=deadLettered" json:"dead_lettered,omitempty"`
+}
+
+func (m *RetryRes) Reset()                    { *m = RetryRes{} }
+func (m *RetryRes) String() string            { return proto.CompactTextString(m) }
+func (*RetryRes) ProtoMessage()               {}
+func (*RetryRes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *RetryRes) GetTopic() string {
+	if m != nil {
+		return m.Topic
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/KafkaPixy/Consume",
+	return ""
+}
+
+func (m *RetryRes) GetRetries() int32 {
+	if m != nil {
+		return m.Retries
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KafkaPixyServer).Consume(ctx, req.(*ConsReq))
+	return 0
+}
+
+func (m *RetryRes) GetDeadLettered() bool {
+	if m != nil {
+		return m.DeadLettered
 	}
-	return interceptor(ctx, in, info, handler)
+	return false
 }
 
-var _KafkaPixy_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "KafkaPixy",
-	HandlerType: (*KafkaPixyServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Produce",
-			Handler:    _KafkaPixy_Produce_Handler,
-		},
-		{
-			MethodName: "Consume",
-			Handler:    _KafkaPixy_Consume_Handler,
+type NackReq struct {
+	Proxy     string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic     string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group     string `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Partition int32  `protobuf:"varint,4,opt,name=partition" json:"partition,omitempty"`
+	Offset    int64  `protobuf:"varint,5,opt,name=offset" json:"offset,omitempty"`
+	DelayMs   int64  `protobuf:"varint,6,opt,name=delay_ms,json=delayMs" json:"delay_ms,omitempty"`
+}
+
+func (m *NackReq) Reset()                    { *m = NackReq{} }
+func (m *NackReq) String() string            { return proto.CompactTextString(m) }
+func (*NackReq) ProtoMessage()               {}
+func (*NackReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *NackReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
+	}
+	return ""
+}
+
+func (m *NackReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *NackReq) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *NackReq) GetPartition() int32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+func (m *NackReq) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *NackReq) GetDelayMs() int64 {
+	if m != nil {
+		return m.DelayMs
+	}
+	return 0
+}
+
+type PartitionOffset struct {
+	Partition   int32  `protobuf:"varint,1,opt,name=partition" json:"partition,omitempty"`
+	Begin       int64  `protobuf:"varint,2,opt,name=begin" json:"begin,omitempty"`
+	End         int64  `protobuf:"varint,3,opt,name=end" json:"end,omitempty"`
+	Count       int64  `protobuf:"varint,4,opt,name=count" json:"count,omitempty"`
+	Offset      int64  `protobuf:"varint,5,opt,name=offset" json:"offset,omitempty"`
+	Lag         int64  `protobuf:"varint,6,opt,name=lag" json:"lag,omitempty"`
+	Metadata    string `protobuf:"bytes,7,opt,name=metadata" json:"metadata,omitempty"`
+	SparseAcks  string `protobuf:"bytes,8,opt,name=sparse_acks,json=sparseAcks" json:"sparse_acks,omitempty"`
+	AckMetadata string `protobuf:"bytes,9,opt,name=ack_metadata,json=ackMetadata" json:"ack_metadata,omitempty"`
+}
+
+func (m *PartitionOffset) Reset()                    { *m = PartitionOffset{} }
+func (m *PartitionOffset) String() string            { return proto.CompactTextString(m) }
+func (*PartitionOffset) ProtoMessage()               {}
+func (*PartitionOffset) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *PartitionOffset) GetPartition() int32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetBegin() int64 {
+	if m != nil {
+		return m.Begin
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetEnd() int64 {
+	if m != nil {
+		return m.End
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetLag() int64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *PartitionOffset) GetMetadata() string {
+	if m != nil {
+		return m.Metadata
+	}
+	return ""
+}
+
+func (m *PartitionOffset) GetSparseAcks() string {
+	if m != nil {
+		return m.SparseAcks
+	}
+	return ""
+}
+
+func (m *PartitionOffset) GetAckMetadata() string {
+	if m != nil {
+		return m.AckMetadata
+	}
+	return ""
+}
+
+type GetOffsetsReq struct {
+	Proxy   string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic   string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group   string `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Refresh bool   `protobuf:"varint,4,opt,name=refresh" json:"refresh,omitempty"`
+}
+
+func (m *GetOffsetsReq) Reset()                    { *m = GetOffsetsReq{} }
+func (m *GetOffsetsReq) String() string            { return proto.CompactTextString(m) }
+func (*GetOffsetsReq) ProtoMessage()               {}
+func (*GetOffsetsReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *GetOffsetsReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
+	}
+	return ""
+}
+
+func (m *GetOffsetsReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *GetOffsetsReq) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *GetOffsetsReq) GetRefresh() bool {
+	if m != nil {
+		return m.Refresh
+	}
+	return false
+}
+
+type GetOffsetsRes struct {
+	Offsets []*PartitionOffset `protobuf:"bytes,1,rep,name=offsets" json:"offsets,omitempty"`
+}
+
+func (m *GetOffsetsRes) Reset()                    { *m = GetOffsetsRes{} }
+func (m *GetOffsetsRes) String() string            { return proto.CompactTextString(m) }
+func (*GetOffsetsRes) ProtoMessage()               {}
+func (*GetOffsetsRes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *GetOffsetsRes) GetOffsets() []*PartitionOffset {
+	if m != nil {
+		return m.Offsets
+	}
+	return nil
+}
+
+type SetOffsetsReq struct {
+	Proxy     string             `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic     string             `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group     string             `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Offsets   []*PartitionOffset `protobuf:"bytes,4,rep,name=offsets" json:"offsets,omitempty"`
+	Timestamp int64              `protobuf:"varint,5,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *SetOffsetsReq) Reset()                    { *m = SetOffsetsReq{} }
+func (m *SetOffsetsReq) String() string            { return proto.CompactTextString(m) }
+func (*SetOffsetsReq) ProtoMessage()               {}
+func (*SetOffsetsReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *SetOffsetsReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
+	}
+	return ""
+}
+
+func (m *SetOffsetsReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *SetOffsetsReq) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *SetOffsetsReq) GetOffsets() []*PartitionOffset {
+	if m != nil {
+		return m.Offsets
+	}
+	return nil
+}
+
+func (m *SetOffsetsReq) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+type SetOffsetsRes struct {
+	Offsets []*PartitionOffset `protobuf:"bytes,1,rep,name=offsets" json:"offsets,omitempty"`
+}
+
+func (m *SetOffsetsRes) Reset()                    { *m = SetOffsetsRes{} }
+func (m *SetOffsetsRes) String() string            { return proto.CompactTextString(m) }
+func (*SetOffsetsRes) ProtoMessage()               {}
+func (*SetOffsetsRes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *SetOffsetsRes) GetOffsets() []*PartitionOffset {
+	if m != nil {
+		return m.Offsets
+	}
+	return nil
+}
+
+type GroupMember struct {
+	MemberId   string  `protobuf:"bytes,1,opt,name=member_id,json=memberId" json:"member_id,omitempty"`
+	Partitions []int32 `protobuf:"varint,2,rep,packed,name=partitions" json:"partitions,omitempty"`
+}
+
+func (m *GroupMember) Reset()                    { *m = GroupMember{} }
+func (m *GroupMember) String() string            { return proto.CompactTextString(m) }
+func (*GroupMember) ProtoMessage()               {}
+func (*GroupMember) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *GroupMember) GetMemberId() string {
+	if m != nil {
+		return m.MemberId
+	}
+	return ""
+}
+
+func (m *GroupMember) GetPartitions() []int32 {
+	if m != nil {
+		return m.Partitions
+	}
+	return nil
+}
+
+type ConsumerGroup struct {
+	Group   string         `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Members []*GroupMember `protobuf:"bytes,2,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *ConsumerGroup) Reset()                    { *m = ConsumerGroup{} }
+func (m *ConsumerGroup) String() string            { return proto.CompactTextString(m) }
+func (*ConsumerGroup) ProtoMessage()               {}
+func (*ConsumerGroup) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *ConsumerGroup) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *ConsumerGroup) GetMembers() []*GroupMember {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+type ListConsumersReq struct {
+	Proxy   string `protobuf:"bytes,1,opt,name=proxy" json:"proxy,omitempty"`
+	Topic   string `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Group   string `protobuf:"bytes,3,opt,name=group" json:"group,omitempty"`
+	Refresh bool   `protobuf:"varint,4,opt,name=refresh" json:"refresh,omitempty"`
+}
+
+func (m *ListConsumersReq) Reset()                    { *m = ListConsumersReq{} }
+func (m *ListConsumersReq) String() string            { return proto.CompactTextString(m) }
+func (*ListConsumersReq) ProtoMessage()               {}
+func (*ListConsumersReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *ListConsumersReq) GetProxy() string {
+	if m != nil {
+		return m.Proxy
+	}
+	return ""
+}
+
+func (m *ListConsumersReq) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *ListConsumersReq) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *ListConsumersReq) GetRefresh() bool {
+	if m != nil {
+		return m.Refresh
+	}
+	return false
+}
+
+type ListConsumersRes struct {
+	Groups []*ConsumerGroup `protobuf:"bytes,1,rep,name=groups" json:"groups,omitempty"`
+}
+
+func (m *ListConsumersRes) Reset()                    { *m = ListConsumersRes{} }
+func (m *ListConsumersRes) String() string            { return proto.CompactTextString(m) }
+func (*ListConsumersRes) ProtoMessage()               {}
+func (*ListConsumersRes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *ListConsumersRes) GetGroups() []*ConsumerGroup {
+	if m != nil {
+		return m.Groups
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*ProdReq)(nil), "ProdReq")
+	proto.RegisterType((*ProdRes)(nil), "ProdRes")
+	proto.RegisterType((*ConsReq)(nil), "ConsReq")
+	proto.RegisterType((*ConsRes)(nil), "ConsRes")
+	proto.RegisterType((*ConsNReq)(nil), "ConsNReq")
+	proto.RegisterType((*AckReq)(nil), "AckReq")
+	proto.RegisterType((*AckRes)(nil), "AckRes")
+	proto.RegisterType((*RetryRes)(nil), "RetryRes")
+	proto.RegisterType((*NackReq)(nil), "NackReq")
+	proto.RegisterType((*PartitionOffset)(nil), "PartitionOffset")
+	proto.RegisterType((*GetOffsetsReq)(nil), "GetOffsetsReq")
+	proto.RegisterType((*GetOffsetsRes)(nil), "GetOffsetsRes")
+	proto.RegisterType((*SetOffsetsReq)(nil), "SetOffsetsReq")
+	proto.RegisterType((*SetOffsetsRes)(nil), "SetOffsetsRes")
+	proto.RegisterType((*GroupMember)(nil), "GroupMember")
+	proto.RegisterType((*ConsumerGroup)(nil), "ConsumerGroup")
+	proto.RegisterType((*ListConsumersReq)(nil), "ListConsumersReq")
+	proto.RegisterType((*ListConsumersRes)(nil), "ListConsumersRes")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for KafkaPixy service
+
+type KafkaPixyClient interface {
+	Produce(ctx context.Context, in *ProdReq, opts ...grpc.CallOption) (*ProdRes, error)
+	ProduceStream(ctx context.Context, opts ...grpc.CallOption) (KafkaPixy_ProduceStreamClient, error)
+	Consume(ctx context.Context, in *ConsReq, opts ...grpc.CallOption) (*ConsRes, error)
+	ConsumeStream(ctx context.Context, in *ConsNReq, opts ...grpc.CallOption) (KafkaPixy_ConsumeStreamClient, error)
+	Ack(ctx context.Context, in *AckReq, opts ...grpc.CallOption) (*AckRes, error)
+	Retry(ctx context.Context, in *AckReq, opts ...grpc.CallOption) (*RetryRes, error)
+	Nack(ctx context.Context, in *NackReq, opts ...grpc.CallOption) (*AckRes, error)
+	GetOffsets(ctx context.Context, in *GetOffsetsReq, opts ...grpc.CallOption) (*GetOffsetsRes, error)
+	SetOffsets(ctx context.Context, in *SetOffsetsReq, opts ...grpc.CallOption) (*SetOffsetsRes, error)
+	ListConsumers(ctx context.Context, in *ListConsumersReq, opts ...grpc.CallOption) (*ListConsumersRes, error)
+}
+
+type kafkaPixyClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewKafkaPixyClient(cc *grpc.ClientConn) KafkaPixyClient {
+	return &kafkaPixyClient{cc}
+}
+
+func (c *kafkaPixyClient) Produce(ctx context.Context, in *ProdReq, opts ...grpc.CallOption) (*ProdRes, error) {
+	out := new(ProdRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/Produce", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) ProduceStream(ctx context.Context, opts ...grpc.CallOption) (KafkaPixy_ProduceStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_KafkaPixy_serviceDesc.Streams[0], c.cc, "/KafkaPixy/ProduceStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kafkaPixyProduceStreamClient{stream}
+	return x, nil
+}
+
+type KafkaPixy_ProduceStreamClient interface {
+	Send(*ProdReq) error
+	Recv() (*ProdRes, error)
+	grpc.ClientStream
+}
+
+type kafkaPixyProduceStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *kafkaPixyProduceStreamClient) Send(m *ProdReq) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *kafkaPixyProduceStreamClient) Recv() (*ProdRes, error) {
+	m := new(ProdRes)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kafkaPixyClient) Consume(ctx context.Context, in *ConsReq, opts ...grpc.CallOption) (*ConsRes, error) {
+	out := new(ConsRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/Consume", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) ConsumeStream(ctx context.Context, in *ConsNReq, opts ...grpc.CallOption) (KafkaPixy_ConsumeStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_KafkaPixy_serviceDesc.Streams[1], c.cc, "/KafkaPixy/ConsumeStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kafkaPixyConsumeStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KafkaPixy_ConsumeStreamClient interface {
+	Recv() (*ConsRes, error)
+	grpc.ClientStream
+}
+
+type kafkaPixyConsumeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *kafkaPixyConsumeStreamClient) Recv() (*ConsRes, error) {
+	m := new(ConsRes)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kafkaPixyClient) Ack(ctx context.Context, in *AckReq, opts ...grpc.CallOption) (*AckRes, error) {
+	out := new(AckRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/Ack", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) Retry(ctx context.Context, in *AckReq, opts ...grpc.CallOption) (*RetryRes, error) {
+	out := new(RetryRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/Retry", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) Nack(ctx context.Context, in *NackReq, opts ...grpc.CallOption) (*AckRes, error) {
+	out := new(AckRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/Nack", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) GetOffsets(ctx context.Context, in *GetOffsetsReq, opts ...grpc.CallOption) (*GetOffsetsRes, error) {
+	out := new(GetOffsetsRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/GetOffsets", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) SetOffsets(ctx context.Context, in *SetOffsetsReq, opts ...grpc.CallOption) (*SetOffsetsRes, error) {
+	out := new(SetOffsetsRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/SetOffsets", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kafkaPixyClient) ListConsumers(ctx context.Context, in *ListConsumersReq, opts ...grpc.CallOption) (*ListConsumersRes, error) {
+	out := new(ListConsumersRes)
+	err := grpc.Invoke(ctx, "/KafkaPixy/ListConsumers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for KafkaPixy service
+
+type KafkaPixyServer interface {
+	Produce(context.Context, *ProdReq) (*ProdRes, error)
+	ProduceStream(KafkaPixy_ProduceStreamServer) error
+	Consume(context.Context, *ConsReq) (*ConsRes, error)
+	ConsumeStream(*ConsNReq, KafkaPixy_ConsumeStreamServer) error
+	Ack(context.Context, *AckReq) (*AckRes, error)
+	Retry(context.Context, *AckReq) (*RetryRes, error)
+	Nack(context.Context, *NackReq) (*AckRes, error)
+	GetOffsets(context.Context, *GetOffsetsReq) (*GetOffsetsRes, error)
+	SetOffsets(context.Context, *SetOffsetsReq) (*SetOffsetsRes, error)
+	ListConsumers(context.Context, *ListConsumersReq) (*ListConsumersRes, error)
+}
+
+func RegisterKafkaPixyServer(s *grpc.Server, srv KafkaPixyServer) {
+	s.RegisterService(&_KafkaPixy_serviceDesc, srv)
+}
+
+func _KafkaPixy_Produce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProdReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).Produce(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/Produce",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).Produce(ctx, req.(*ProdReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_ProduceStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KafkaPixyServer).ProduceStream(&kafkaPixyProduceStreamServer{stream})
+}
+
+type KafkaPixy_ProduceStreamServer interface {
+	Send(*ProdRes) error
+	Recv() (*ProdReq, error)
+	grpc.ServerStream
+}
+
+type kafkaPixyProduceStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *kafkaPixyProduceStreamServer) Send(m *ProdRes) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *kafkaPixyProduceStreamServer) Recv() (*ProdReq, error) {
+	m := new(ProdReq)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _KafkaPixy_Consume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).Consume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/Consume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).Consume(ctx, req.(*ConsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_ConsumeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsNReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KafkaPixyServer).ConsumeStream(m, &kafkaPixyConsumeStreamServer{stream})
+}
+
+type KafkaPixy_ConsumeStreamServer interface {
+	Send(*ConsRes) error
+	grpc.ServerStream
+}
+
+type kafkaPixyConsumeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *kafkaPixyConsumeStreamServer) Send(m *ConsRes) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KafkaPixy_Ack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).Ack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/Ack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).Ack(ctx, req.(*AckReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_Retry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).Retry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/Retry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).Retry(ctx, req.(*AckReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_Nack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NackReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).Nack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/Nack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).Nack(ctx, req.(*NackReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_GetOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOffsetsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).GetOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/GetOffsets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).GetOffsets(ctx, req.(*GetOffsetsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_SetOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetOffsetsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).SetOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/SetOffsets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).SetOffsets(ctx, req.(*SetOffsetsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KafkaPixy_ListConsumers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConsumersReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KafkaPixyServer).ListConsumers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KafkaPixy/ListConsumers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KafkaPixyServer).ListConsumers(ctx, req.(*ListConsumersReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _KafkaPixy_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "KafkaPixy",
+	HandlerType: (*KafkaPixyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Produce",
+			Handler:    _KafkaPixy_Produce_Handler,
+		},
+		{
+			MethodName: "Consume",
+			Handler:    _KafkaPixy_Consume_Handler,
+		},
+		{
+			MethodName: "Ack",
+			Handler:    _KafkaPixy_Ack_Handler,
+		},
+		{
+			MethodName: "Retry",
+			Handler:    _KafkaPixy_Retry_Handler,
+		},
+		{
+			MethodName: "Nack",
+			Handler:    _KafkaPixy_Nack_Handler,
+		},
+		{
+			MethodName: "GetOffsets",
+			Handler:    _KafkaPixy_GetOffsets_Handler,
+		},
+		{
+			MethodName: "SetOffsets",
+			Handler:    _KafkaPixy_SetOffsets_Handler,
+		},
+		{
+			MethodName: "ListConsumers",
+			Handler:    _KafkaPixy_ListConsumers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ProduceStream",
+			Handler:       _KafkaPixy_ProduceStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ConsumeStream",
+			Handler:       _KafkaPixy_ConsumeStream_Handler,
+			ServerStreams: true,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "grpc.proto",
 }
 
 func init() { proto.RegisterFile("grpc.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 300 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xb4, 0x92, 0xc1, 0x4a, 0x3b, 0x31,
-	0x10, 0xc6, 0xbb, 0x6d, 0xb7, 0x6d, 0x86, 0xfe, 0x2f, 0xa1, 0xfc, 0x09, 0x55, 0xb1, 0xc4, 0x4b,
-	0x4f, 0x3d, 0xe8, 0x03, 0x08, 0x7a, 0x2c, 0x85, 0x12, 0xd0, 0x83, 0x97, 0x92, 0xee, 0xce, 0x96,
-	0x65, 0xed, 0x26, 0x26, 0xbb, 0xd2, 0x3c, 0x8b, 0x2f, 0xe1, 0x23, 0x4a, 0xb2, 0x0d, 0x9e, 0x15,
-	0xbc, 0xcd, 0xef, 0xcb, 0x4c, 0xf8, 0xe6, 0x4b, 0x00, 0x0e, 0x46, 0x67, 0x2b, 0x6d, 0x54, 0xa3,
-	0xf8, 0x67, 0x02, 0xe3, 0xad, 0x51, 0xb9, 0xc0, 0x37, 0x3a, 0x83, 0x54, 0x1b, 0x75, 0x72, 0x2c,
-	0x59, 0x24, 0x4b, 0x22, 0x3a, 0xf0, 0x6a, 0xa3, 0x74, 0x99, 0xb1, 0x7e, 0xa7, 0x06, 0xa0, 0x17,
-	0x40, 0x2a, 0x74, 0xbb, 0x77, 0xf9, 0xda, 0x22, 0x1b, 0x2c, 0x92, 0xe5, 0x54, 0x4c, 0x2a, 0x74,
-	0xcf, 0x9e, 0xe9, 0x0d, 0xfc, 0xf3, 0x87, 0x6d, 0x9d, 0x63, 0x51, 0xd6, 0x98, 0xb3, 0xe1, 0x22,
-	0x59, 0x4e, 0xc4, 0xb4, 0x42, 0xf7, 0x14, 0x35, 0xca, 0x60, 0x7c, 0x44, 0x6b, 0xe5, 0x01, 0x59,
-	0x1a, 0xe6, 0x23, 0xd2, 0x2b, 0x00, 0x69, 0x5d, 0x9d, 0xed, 0x8e, 0x2a, 0x47, 0x36, 0x0a, 0xb3,
-	0x24, 0x28, 0x1b, 0x95, 0x23, 0xbf, 0x8f, 0x8e, 0x2d, 0xbd, 0x04, 0xa2, 0xa5, 0x69, 0xca, 0xa6,
-	0x54, 0x75, 0x70, 0x9d, 0x8a, 0x6f, 0x81, 0xfe, 0x87, 0x91, 0x2a, 0x0a, 0x8b, 0x4d, 0xb0, 0x3e,
-	0x10, 0x67, 0xe2, 0x6b, 0x18, 0x3f, 0xaa, 0xda, 0xfe, 0x74, 0xe5, 0x19, 0xa4, 0x07, 0xa3, 0x5a,
-	0x1d, 0xd6, 0x25, 0xa2, 0x03, 0xfe, 0x91, 0xc4, 0xdb, 0x7e, 0x69, 0xe7, 0x2f, 0xa3, 0xbc, 0xdd,
-	0x00, 0x59, 0xcb, 0xa2, 0x92, 0xdb, 0xf2, 0xe4, 0xe8, 0x75, 0x17, 0x5c, 0x9b, 0x21, 0x9d, 0xac,
-	0xce, 0x8f, 0x3e, 0x8f, 0x95, 0xe5, 0x3d, 0xdf, 0xe0, 0x57, 0x69, 0x8f, 0xbe, 0xe1, 0x1c, 0xd1,
-	0x3c, 0x56, 0x96, 0xf7, 0x1e, 0x86, 0x2f, 0x7d, 0xbd, 0xdf, 0x8f, 0xc2, 0xd7, 0xb9, 0xfb, 0x0a,
-	0x00, 0x00, 0xff, 0xff, 0xb6, 0x56, 0x65, 0x7a, 0x48, 0x02, 0x00, 0x00,
+	// 943 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xc4, 0x56, 0xcd, 0x8e, 0xdc, 0x44,
+	0x10, 0x5e, 0xaf, 0xc7, 0x63, 0xbb, 0x76, 0x66, 0xb3, 0x69, 0xad, 0x90, 0x33, 0x21, 0x64, 0x70,
+	0x44, 0x34, 0xe4, 0x60, 0x45, 0xcb, 0x01, 0x89, 0x9c, 0x96, 0x20, 0xa2, 0x40, 0x66, 0x59, 0xf5,
+	0x08, 0x0e, 0x5c, 0xac, 0x5e, 0xbb, 0x66, 0xb0, 0x3c, 0x1e, 0x9b, 0xee, 0x1e, 0xb4, 0x73, 0xe3,
+	0x19, 0xb8, 0xc2, 0x91, 0x33, 0x0f, 0xc2, 0x0b, 0xf0, 0x00, 0x3c, 0x04, 0x57, 0xd4, 0xed, 0xb6,
+	0xe7, 0x67, 0x77, 0x09, 0x41, 0x1b, 0x71, 0xeb, 0xfa, 0xba, 0xba, 0xea, 0xab, 0xfe, 0xaa, 0xcb,
+	0x06, 0x98, 0xf1, 0x2a, 0x89, 0x2a, 0x5e, 0xca, 0x32, 0xfc, 0xc3, 0x02, 0xf7, 0x9c, 0x97, 0x29,
+	0xc5, 0xef, 0xc9, 0x31, 0x38, 0x15, 0x2f, 0x2f, 0x57, 0x81, 0x35, 0xb4, 0x46, 0x3e, 0xad, 0x0d,
+	0x85, 0xca, 0xb2, 0xca, 0x92, 0x60, 0xbf, 0x46, 0xb5, 0x41, 0xee, 0x83, 0x9f, 0xe3, 0x2a, 0xfe,
+	0x81, 0xcd, 0x97, 0x18, 0xd8, 0x43, 0x6b, 0xd4, 0xa3, 0x5e, 0x8e, 0xab, 0x6f, 0x94, 0x4d, 0x1e,
+	0x41, 0x5f, 0x6d, 0x2e, 0x17, 0x29, 0x4e, 0xb3, 0x05, 0xa6, 0x41, 0x67, 0x68, 0x8d, 0x3c, 0xda,
+	0xcb, 0x71, 0xf5, 0x75, 0x83, 0x91, 0x00, 0xdc, 0x02, 0x85, 0x60, 0x33, 0x0c, 0x1c, 0x7d, 0xbe,
+	0x31, 0xc9, 0x03, 0x00, 0x26, 0x56, 0x8b, 0x24, 0x2e, 0xca, 0x14, 0x83, 0xae, 0x3e, 0xeb, 0x6b,
+	0x64, 0x5c, 0xa6, 0x48, 0x3e, 0x80, 0xc3, 0xa4, 0xe4, 0x1c, 0xe7, 0x4c, 0x66, 0xe5, 0x22, 0xce,
+	0xd2, 0xc0, 0xd5, 0xcc, 0xfa, 0x1b, 0xe8, 0xcb, 0x34, 0xfc, 0xb5, 0xad, 0x4c, 0x90, 0x77, 0xc1,
+	0xaf, 0x18, 0x97, 0x99, 0xda, 0xd2, 0xd5, 0x39, 0x74, 0x0d, 0x90, 0x77, 0xa0, 0x5b, 0x4e, 0xa7,
+	0x02, 0xa5, 0x2e, 0xd1, 0xa6, 0xc6, 0xba, 0x26, 0x91, 0x7d, 0x4d, 0x22, 0x45, 0x17, 0x39, 0x2f,
+	0x79, 0x9c, 0x28, 0xba, 0x9d, 0x3a, 0xba, 0x46, 0x9e, 0x2b, 0xba, 0xed, 0x76, 0x8a, 0x22, 0xd1,
+	0xa5, 0xfa, 0x66, 0xfb, 0x33, 0x14, 0x49, 0xf8, 0x9b, 0x05, 0xee, 0xf3, 0x72, 0x21, 0xde, 0x54,
+	0x80, 0x63, 0x70, 0x66, 0xbc, 0x5c, 0x56, 0x86, 0x53, 0x6d, 0xa8, 0x64, 0xea, 0xe6, 0xa7, 0xd9,
+	0x5c, 0x22, 0xd7, 0x5c, 0x7a, 0x54, 0x09, 0xf5, 0xb9, 0x06, 0xc8, 0x13, 0xb8, 0xbb, 0xde, 0x8e,
+	0x2b, 0x8e, 0xd3, 0xec, 0x52, 0x53, 0xf2, 0xe8, 0x9d, 0xd6, 0xeb, 0x5c, 0xc3, 0xea, 0x56, 0x74,
+	0x26, 0x11, 0x74, 0x87, 0xf6, 0xc8, 0xa7, 0xc6, 0x0a, 0xff, 0x6c, 0x09, 0xff, 0xd7, 0x7b, 0x7d,
+	0x9b, 0xbd, 0xd3, 0x5e, 0x56, 0x77, 0xf3, 0xb2, 0x02, 0x70, 0x39, 0x4a, 0x9e, 0xa1, 0xd0, 0xbd,
+	0xe2, 0xd0, 0xc6, 0x54, 0x1c, 0xa7, 0x19, 0xce, 0x53, 0x11, 0x78, 0xfa, 0x80, 0xb1, 0xc2, 0xdf,
+	0x2d, 0xf0, 0x54, 0x95, 0x67, 0xb7, 0xa3, 0xcb, 0x3d, 0xf0, 0xd8, 0x52, 0x96, 0x31, 0x4b, 0x72,
+	0x53, 0x90, 0xab, 0xec, 0xd3, 0x24, 0xdf, 0x91, 0xcc, 0xf9, 0x57, 0x92, 0x75, 0x5f, 0x27, 0x99,
+	0xbb, 0x25, 0xd9, 0x8f, 0x16, 0x74, 0x4f, 0x93, 0xfc, 0x76, 0x4a, 0xd9, 0xd2, 0xbc, 0x73, 0xb3,
+	0xe6, 0xce, 0xa6, 0xe6, 0xa1, 0x67, 0x18, 0x88, 0x30, 0x06, 0x8f, 0xa2, 0xe4, 0x2b, 0xd5, 0x3f,
+	0x6d, 0x5e, 0xeb, 0x06, 0xb5, 0xf6, 0xb7, 0xd5, 0x7a, 0x04, 0xfd, 0x14, 0x59, 0x1a, 0xcf, 0x51,
+	0x4a, 0xe4, 0x58, 0x3f, 0x48, 0x8f, 0xf6, 0x14, 0xf8, 0xca, 0x60, 0xe1, 0x2f, 0x16, 0xb8, 0x67,
+	0xec, 0x7f, 0x2d, 0x57, 0xe9, 0x9d, 0xe2, 0x9c, 0xad, 0xe2, 0x42, 0x68, 0xb1, 0x6c, 0xea, 0x6a,
+	0x7b, 0x2c, 0xc2, 0xbf, 0x2c, 0xb8, 0x73, 0xde, 0x04, 0xf8, 0xaa, 0x76, 0xff, 0xe7, 0x77, 0x74,
+	0x0c, 0xce, 0x05, 0xce, 0xb2, 0x85, 0x79, 0x46, 0xb5, 0x41, 0x8e, 0xc0, 0xc6, 0x45, 0x7d, 0x03,
+	0x36, 0x55, 0x4b, 0xe5, 0x97, 0x94, 0xcb, 0x85, 0xd4, 0x34, 0x6d, 0x5a, 0x1b, 0x37, 0x52, 0x3c,
+	0x02, 0x7b, 0xce, 0x66, 0x86, 0x9d, 0x5a, 0x92, 0x01, 0x78, 0x05, 0x4a, 0x96, 0x32, 0xc9, 0xcc,
+	0x48, 0x6d, 0x6d, 0xf2, 0x10, 0x0e, 0x44, 0xc5, 0xb8, 0x40, 0xd5, 0xc2, 0xcd, 0x63, 0x81, 0x1a,
+	0x3a, 0x4d, 0x72, 0x41, 0xde, 0x87, 0x1e, 0x4b, 0xf2, 0xb8, 0x0d, 0xe0, 0x6b, 0x8f, 0x03, 0x96,
+	0xe4, 0x63, 0x03, 0x85, 0x39, 0xf4, 0x5f, 0xa0, 0xac, 0x4b, 0xbe, 0xa5, 0x79, 0xa7, 0x5b, 0x65,
+	0xca, 0x51, 0x7c, 0xd7, 0x3c, 0x2b, 0x63, 0x86, 0xcf, 0xb6, 0x93, 0x09, 0xf2, 0x04, 0xdc, 0xba,
+	0x72, 0x11, 0x58, 0x43, 0x7b, 0x74, 0x70, 0x72, 0x14, 0xed, 0xc8, 0x40, 0x1b, 0x87, 0xf0, 0x67,
+	0x0b, 0xfa, 0x93, 0x5b, 0xa6, 0xba, 0x91, 0xbf, 0xf3, 0x9a, 0xfc, 0xaa, 0x1f, 0x64, 0x56, 0xa0,
+	0x90, 0xac, 0xa8, 0x8c, 0x6c, 0x6b, 0x20, 0x7c, 0xb6, 0x4d, 0xee, 0xcd, 0x4a, 0xfb, 0x02, 0x0e,
+	0x5e, 0x28, 0x3e, 0x63, 0x2c, 0x2e, 0x90, 0xab, 0x59, 0x5c, 0xe8, 0x95, 0xfa, 0xbc, 0x59, 0x8d,
+	0xe8, 0x0a, 0x78, 0x99, 0x92, 0xf7, 0x00, 0xda, 0x2e, 0x54, 0x6f, 0xd1, 0x1e, 0x39, 0x74, 0x03,
+	0x09, 0xc7, 0xd0, 0x57, 0x33, 0x72, 0x59, 0x20, 0xd7, 0x31, 0xd7, 0x95, 0x5b, 0x9b, 0x95, 0x3f,
+	0x06, 0xb7, 0x0e, 0x59, 0xc7, 0x38, 0x38, 0xe9, 0x45, 0x1b, 0x14, 0x68, 0xb3, 0x19, 0x2e, 0xe0,
+	0xe8, 0x55, 0x26, 0x64, 0x13, 0xf2, 0xad, 0xb7, 0xc8, 0x27, 0x57, 0xf2, 0x09, 0xf2, 0x18, 0xba,
+	0xfa, 0x58, 0x73, 0x93, 0x87, 0xd1, 0x56, 0x85, 0xd4, 0xec, 0x9e, 0xfc, 0x64, 0x83, 0xff, 0x25,
+	0x9b, 0xe6, 0xec, 0x3c, 0xbb, 0x5c, 0x91, 0x87, 0xf5, 0xaf, 0xc6, 0x32, 0x41, 0xe2, 0x45, 0xe6,
+	0x77, 0x6a, 0xd0, 0xac, 0x44, 0xb8, 0x47, 0x3e, 0x84, 0xbe, 0x71, 0x98, 0x48, 0x8e, 0xac, 0xb8,
+	0xde, 0x6d, 0x64, 0x3d, 0xb5, 0x54, 0x2c, 0x93, 0x92, 0x78, 0x91, 0xf9, 0x33, 0x18, 0x34, 0x2b,
+	0x15, 0x6b, 0xd4, 0xde, 0xba, 0x89, 0xe5, 0x47, 0xcd, 0x97, 0x6a, 0xd3, 0xef, 0xa9, 0x45, 0xee,
+	0x81, 0xad, 0xbe, 0x30, 0x6e, 0x54, 0x0f, 0xff, 0x81, 0x59, 0xa8, 0x20, 0x0f, 0xc0, 0xd1, 0x53,
+	0x78, 0xbd, 0xe9, 0x47, 0xcd, 0x58, 0x0e, 0xf7, 0xc8, 0x7d, 0xe8, 0xa8, 0x11, 0x4a, 0xbc, 0xe8,
+	0x8c, 0x5d, 0x39, 0x1b, 0x01, 0xac, 0x9f, 0x16, 0x39, 0x8c, 0xb6, 0x1e, 0xf5, 0x60, 0xdb, 0x36,
+	0xfe, 0x93, 0x4d, 0xff, 0xc9, 0x8e, 0xff, 0x64, 0xc7, 0xff, 0x63, 0xe8, 0x6f, 0xe9, 0x42, 0xee,
+	0x46, 0xbb, 0x7d, 0x31, 0xb8, 0x02, 0x89, 0x70, 0xef, 0xd3, 0xce, 0xb7, 0xfb, 0xd5, 0xc5, 0x45,
+	0x57, 0xff, 0xd9, 0x7e, 0xf4, 0xf7, 0x00, 0xeb, 0x9b, 0xdc, 0x25, 0xe7, 0x0a, 0x00, 0x00,
 }
@@ -19,7 +19,7 @@ DESCRIPTOR = _descriptor.FileDescriptor(
   name='grpc.proto',
   package='',
   syntax='proto3',
-  serialized_pb=_b('\n\ngrpc.proto\"v\n\x07ProdReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\x11\n\tkey_value\x18\x03 \x01(\x0c\x12\x15\n\rkey_undefined\x18\x04 \x01(\x08\x12\x0f\n\x07message\x18\x05 \x01(\x0c\x12\x12\n\nasync_mode\x18\x06 \x01(\x08\",\n\x07ProdRes\x12\x11\n\tpartition\x18\x01 \x01(\x05\x12\x0e\n\x06offset\x18\x02 \x01(\x03\"6\n\x07\x43onsReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\"g\n\x07\x43onsRes\x12\x11\n\tpartition\x18\x01 \x01(\x05\x12\x0e\n\x06offset\x18\x02 \x01(\x03\x12\x11\n\tkey_value\x18\x03 \x01(\x0c\x12\x15\n\rkey_undefined\x18\x04 \x01(\x08\x12\x0f\n\x07message\x18\x05 \x01(\x0c\x32M\n\tKafkaPixy\x12\x1f\n\x07Produce\x12\x08.ProdReq\x1a\x08.ProdRes\"\x00\x12\x1f\n\x07\x43onsume\x12\x08.ConsReq\x1a\x08.ConsRes\"\x00\x42\x04Z\x02pbb\x06proto3')
+  serialized_pb=_b('\n\ngrpc.proto\"\x8e\x01\n\x07ProdReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\x11\n\tkey_value\x18\x03 \x01(\x0c\x12\x15\n\rkey_undefined\x18\x04 \x01(\x08\x12\x0f\n\x07message\x18\x05 \x01(\x0c\x12\x12\n\nasync_mode\x18\x06 \x01(\x08\x12\x16\n\x0e\x63orrelation_id\x18\x07 \x01(\t\"l\n\x07ProdRes\x12\x11\n\tpartition\x18\x01 \x01(\x05\x12\x0e\n\x06offset\x18\x02 \x01(\x03\x12\x16\n\x0e\x63orrelation_id\x18\x03 \x01(\t\x12\x12\n\nerror_code\x18\x04 \x01(\x05\x12\x12\n\nerror_desc\x18\x05 \x01(\t\"u\n\x07\x43onsReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x12\n\nkey_filter\x18\x04 \x01(\x0c\x12\x19\n\x11key_filter_prefix\x18\x05 \x01(\x08\x12\x0e\n\x06topics\x18\x06 \x03(\t\"\x97\x01\n\x07\x43onsRes\x12\x11\n\tpartition\x18\x01 \x01(\x05\x12\x0e\n\x06offset\x18\x02 \x01(\x03\x12\x11\n\tkey_value\x18\x03 \x01(\x0c\x12\x15\n\rkey_undefined\x18\x04 \x01(\x08\x12\x0f\n\x07message\x18\x05 \x01(\x0c\x12\r\n\x05topic\x18\x06 \x01(\t\x12\x0f\n\x07retries\x18\x07 \x01(\x05\x12\x0e\n\x06\x66ields\x18\x08 \x01(\t\"\x88\x01\n\x08\x43onsNReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x10\n\x08\x61uto_ack\x18\x04 \x01(\x08\x12\x12\n\nkey_filter\x18\x05 \x01(\x0c\x12\x19\n\x11key_filter_prefix\x18\x06 \x01(\x08\x12\x0e\n\x06topics\x18\x07 \x03(\t\"X\n\x06\x41\x63kReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x11\n\tpartition\x18\x04 \x01(\x05\x12\x0e\n\x06offset\x18\x05 \x01(\x03\"\x08\n\x06\x41\x63kRes\"A\n\x08RetryRes\x12\r\n\x05topic\x18\x01 \x01(\t\x12\x0f\n\x07retries\x18\x02 \x01(\x05\x12\x15\n\rdead_lettered\x18\x03 \x01(\x08\"k\n\x07NackReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x11\n\tpartition\x18\x04 \x01(\x05\x12\x0e\n\x06offset\x18\x05 \x01(\x03\x12\x10\n\x08\x64\x65lay_ms\x18\x06 \x01(\x03\"\xa9\x01\n\x0fPartitionOffset\x12\x11\n\tpartition\x18\x01 \x01(\x05\x12\r\n\x05\x62\x65gin\x18\x02 \x01(\x03\x12\x0b\n\x03\x65nd\x18\x03 \x01(\x03\x12\r\n\x05\x63ount\x18\x04 \x01(\x03\x12\x0e\n\x06offset\x18\x05 \x01(\x03\x12\x0b\n\x03lag\x18\x06 \x01(\x03\x12\x10\n\x08metadata\x18\x07 \x01(\t\x12\x13\n\x0bsparse_acks\x18\x08 \x01(\t\x12\x14\n\x0c\x61\x63k_metadata\x18\t \x01(\t\"M\n\rGetOffsetsReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x0f\n\x07refresh\x18\x04 \x01(\x08\"2\n\rGetOffsetsRes\x12!\n\x07offsets\x18\x01 \x03(\x0b\x32\x10.PartitionOffset\"r\n\rSetOffsetsReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12!\n\x07offsets\x18\x04 \x03(\x0b\x32\x10.PartitionOffset\x12\x11\n\ttimestamp\x18\x05 \x01(\x03\"2\n\rSetOffsetsRes\x12!\n\x07offsets\x18\x01 \x03(\x0b\x32\x10.PartitionOffset\"4\n\x0bGroupMember\x12\x11\n\tmember_id\x18\x01 \x01(\t\x12\x12\n\npartitions\x18\x02 \x03(\x05\"=\n\rConsumerGroup\x12\r\n\x05group\x18\x01 \x01(\t\x12\x1d\n\x07members\x18\x02 \x03(\x0b\x32\x0c.GroupMember\"P\n\x10ListConsumersReq\x12\r\n\x05proxy\x18\x01 \x01(\t\x12\r\n\x05topic\x18\x02 \x01(\t\x12\r\n\x05group\x18\x03 \x01(\t\x12\x0f\n\x07refresh\x18\x04 \x01(\x08\"2\n\x10ListConsumersRes\x12\x1e\n\x06groups\x18\x01 \x03(\x0b\x32\x0e.ConsumerGroup2\x92\x03\n\tKafkaPixy\x12\x1f\n\x07Produce\x12\x08.ProdReq\x1a\x08.ProdRes\"\x00\x12)\n\rProduceStream\x12\x08.ProdReq\x1a\x08.ProdRes\"\x00(\x01\x30\x01\x12\x1f\n\x07\x43onsume\x12\x08.ConsReq\x1a\x08.ConsRes\"\x00\x12(\n\rConsumeStream\x12\t.ConsNReq\x1a\x08.ConsRes\"\x00\x30\x01\x12\x19\n\x03\x41\x63k\x12\x07.AckReq\x1a\x07.AckRes\"\x00\x12\x1d\n\x05Retry\x12\x07.AckReq\x1a\t.RetryRes\"\x00\x12\x1b\n\x04Nack\x12\x08.NackReq\x1a\x07.AckRes\"\x00\x12.\n\nGetOffsets\x12\x0e.GetOffsetsReq\x1a\x0e.GetOffsetsRes\"\x00\x12.\n\nSetOffsets\x12\x0e.SetOffsetsReq\x1a\x0e.SetOffsetsRes\"\x00\x12\x37\n\rListConsumers\x12\x11.ListConsumersReq\x1a\x11.ListConsumersRes\"\x00\x42\x04Z\x02pbb\x06proto3')
 )
 _sym_db.RegisterFileDescriptor(DESCRIPTOR)
 
@@ -75,6 +75,655 @@ _PRODREQ = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
+    _descriptor.FieldDescriptor(
+      name='correlation_id', full_name='ProdReq.correlation_id', index=6,
+      number=7, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=15,
+  serialized_end=157,
+)
+
+
+_PRODRES = _descriptor.Descriptor(
+  name='ProdRes',
+  full_name='ProdRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='partition', full_name='ProdRes.partition', index=0,
+      number=1, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offset', full_name='ProdRes.offset', index=1,
+      number=2, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='correlation_id', full_name='ProdRes.correlation_id', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='error_code', full_name='ProdRes.error_code', index=3,
+      number=4, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='error_desc', full_name='ProdRes.error_desc', index=4,
+      number=5, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=159,
+  serialized_end=267,
+)
+
+
+_CONSREQ = _descriptor.Descriptor(
+  name='ConsReq',
+  full_name='ConsReq',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='proxy', full_name='ConsReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='ConsReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='ConsReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_filter', full_name='ConsReq.key_filter', index=3,
+      number=4, type=12, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b(""),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_filter_prefix', full_name='ConsReq.key_filter_prefix', index=4,
+      number=5, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topics', full_name='ConsReq.topics', index=5,
+      number=6, type=9, cpp_type=9, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=269,
+  serialized_end=386,
+)
+
+
+_CONSRES = _descriptor.Descriptor(
+  name='ConsRes',
+  full_name='ConsRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='partition', full_name='ConsRes.partition', index=0,
+      number=1, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offset', full_name='ConsRes.offset', index=1,
+      number=2, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_value', full_name='ConsRes.key_value', index=2,
+      number=3, type=12, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b(""),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_undefined', full_name='ConsRes.key_undefined', index=3,
+      number=4, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='message', full_name='ConsRes.message', index=4,
+      number=5, type=12, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b(""),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='ConsRes.topic', index=5,
+      number=6, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='retries', full_name='ConsRes.retries', index=6,
+      number=7, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='fields', full_name='ConsRes.fields', index=7,
+      number=8, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=389,
+  serialized_end=540,
+)
+
+
+_CONSNREQ = _descriptor.Descriptor(
+  name='ConsNReq',
+  full_name='ConsNReq',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='proxy', full_name='ConsNReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='ConsNReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='ConsNReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='auto_ack', full_name='ConsNReq.auto_ack', index=3,
+      number=4, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_filter', full_name='ConsNReq.key_filter', index=4,
+      number=5, type=12, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b(""),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='key_filter_prefix', full_name='ConsNReq.key_filter_prefix', index=5,
+      number=6, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topics', full_name='ConsNReq.topics', index=6,
+      number=7, type=9, cpp_type=9, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=543,
+  serialized_end=679,
+)
+
+
+_ACKREQ = _descriptor.Descriptor(
+  name='AckReq',
+  full_name='AckReq',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='proxy', full_name='AckReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='AckReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='AckReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='partition', full_name='AckReq.partition', index=3,
+      number=4, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offset', full_name='AckReq.offset', index=4,
+      number=5, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=681,
+  serialized_end=769,
+)
+
+
+_ACKRES = _descriptor.Descriptor(
+  name='AckRes',
+  full_name='AckRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=771,
+  serialized_end=779,
+)
+
+
+_RETRYRES = _descriptor.Descriptor(
+  name='RetryRes',
+  full_name='RetryRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='RetryRes.topic', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='retries', full_name='RetryRes.retries', index=1,
+      number=2, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='dead_lettered', full_name='RetryRes.dead_lettered', index=2,
+      number=3, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=781,
+  serialized_end=846,
+)
+
+
+_NACKREQ = _descriptor.Descriptor(
+  name='NackReq',
+  full_name='NackReq',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='proxy', full_name='NackReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='NackReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='NackReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='partition', full_name='NackReq.partition', index=3,
+      number=4, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offset', full_name='NackReq.offset', index=4,
+      number=5, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='delay_ms', full_name='NackReq.delay_ms', index=5,
+      number=6, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=848,
+  serialized_end=955,
+)
+
+
+_PARTITIONOFFSET = _descriptor.Descriptor(
+  name='PartitionOffset',
+  full_name='PartitionOffset',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='partition', full_name='PartitionOffset.partition', index=0,
+      number=1, type=5, cpp_type=1, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='begin', full_name='PartitionOffset.begin', index=1,
+      number=2, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='end', full_name='PartitionOffset.end', index=2,
+      number=3, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='count', full_name='PartitionOffset.count', index=3,
+      number=4, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offset', full_name='PartitionOffset.offset', index=4,
+      number=5, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='lag', full_name='PartitionOffset.lag', index=5,
+      number=6, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='metadata', full_name='PartitionOffset.metadata', index=6,
+      number=7, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='sparse_acks', full_name='PartitionOffset.sparse_acks', index=7,
+      number=8, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='ack_metadata', full_name='PartitionOffset.ack_metadata', index=8,
+      number=9, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=958,
+  serialized_end=1127,
+)
+
+
+_GETOFFSETSREQ = _descriptor.Descriptor(
+  name='GetOffsetsReq',
+  full_name='GetOffsetsReq',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='proxy', full_name='GetOffsetsReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='topic', full_name='GetOffsetsReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='GetOffsetsReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='refresh', full_name='GetOffsetsReq.refresh', index=3,
+      number=4, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=1129,
+  serialized_end=1206,
+)
+
+
+_GETOFFSETSRES = _descriptor.Descriptor(
+  name='GetOffsetsRes',
+  full_name='GetOffsetsRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='offsets', full_name='GetOffsetsRes.offsets', index=0,
+      number=1, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
   ],
   extensions=[
   ],
@@ -87,28 +736,49 @@ _PRODREQ = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=14,
-  serialized_end=132,
+  serialized_start=1208,
+  serialized_end=1258,
 )
 
 
-_PRODRES = _descriptor.Descriptor(
-  name='ProdRes',
-  full_name='ProdRes',
+_SETOFFSETSREQ = _descriptor.Descriptor(
+  name='SetOffsetsReq',
+  full_name='SetOffsetsReq',
   filename=None,
   file=DESCRIPTOR,
   containing_type=None,
   fields=[
     _descriptor.FieldDescriptor(
-      name='partition', full_name='ProdRes.partition', index=0,
-      number=1, type=5, cpp_type=1, label=1,
-      has_default_value=False, default_value=0,
+      name='proxy', full_name='SetOffsetsReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
     _descriptor.FieldDescriptor(
-      name='offset', full_name='ProdRes.offset', index=1,
-      number=2, type=3, cpp_type=2, label=1,
+      name='topic', full_name='SetOffsetsReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='group', full_name='SetOffsetsReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='offsets', full_name='SetOffsetsReq.offsets', index=3,
+      number=4, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+    _descriptor.FieldDescriptor(
+      name='timestamp', full_name='SetOffsetsReq.timestamp', index=4,
+      number=5, type=3, cpp_type=2, label=1,
       has_default_value=False, default_value=0,
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
@@ -125,39 +795,101 @@ _PRODRES = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=134,
-  serialized_end=178,
+  serialized_start=1260,
+  serialized_end=1374,
 )
 
 
-_CONSREQ = _descriptor.Descriptor(
-  name='ConsReq',
-  full_name='ConsReq',
+_SETOFFSETSRES = _descriptor.Descriptor(
+  name='SetOffsetsRes',
+  full_name='SetOffsetsRes',
   filename=None,
   file=DESCRIPTOR,
   containing_type=None,
   fields=[
     _descriptor.FieldDescriptor(
-      name='proxy', full_name='ConsReq.proxy', index=0,
+      name='offsets', full_name='SetOffsetsRes.offsets', index=0,
+      number=1, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=1376,
+  serialized_end=1426,
+)
+
+
+_GROUPMEMBER = _descriptor.Descriptor(
+  name='GroupMember',
+  full_name='GroupMember',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='member_id', full_name='GroupMember.member_id', index=0,
       number=1, type=9, cpp_type=9, label=1,
       has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
     _descriptor.FieldDescriptor(
-      name='topic', full_name='ConsReq.topic', index=1,
-      number=2, type=9, cpp_type=9, label=1,
-      has_default_value=False, default_value=_b("").decode('utf-8'),
+      name='partitions', full_name='GroupMember.partitions', index=1,
+      number=2, type=5, cpp_type=1, label=3,
+      has_default_value=False, default_value=[],
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=1428,
+  serialized_end=1480,
+)
+
+
+_CONSUMERGROUP = _descriptor.Descriptor(
+  name='ConsumerGroup',
+  full_name='ConsumerGroup',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
     _descriptor.FieldDescriptor(
-      name='group', full_name='ConsReq.group', index=2,
-      number=3, type=9, cpp_type=9, label=1,
+      name='group', full_name='ConsumerGroup.group', index=0,
+      number=1, type=9, cpp_type=9, label=1,
       has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
+    _descriptor.FieldDescriptor(
+      name='members', full_name='ConsumerGroup.members', index=1,
+      number=2, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None),
   ],
   extensions=[
   ],
@@ -170,50 +902,74 @@ _CONSREQ = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=180,
-  serialized_end=234,
+  serialized_start=1482,
+  serialized_end=1543,
 )
 
 
-_CONSRES = _descriptor.Descriptor(
-  name='ConsRes',
-  full_name='ConsRes',
+_LISTCONSUMERSREQ = _descriptor.Descriptor(
+  name='ListConsumersReq',
+  full_name='ListConsumersReq',
   filename=None,
   file=DESCRIPTOR,
   containing_type=None,
   fields=[
     _descriptor.FieldDescriptor(
-      name='partition', full_name='ConsRes.partition', index=0,
-      number=1, type=5, cpp_type=1, label=1,
-      has_default_value=False, default_value=0,
+      name='proxy', full_name='ListConsumersReq.proxy', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
     _descriptor.FieldDescriptor(
-      name='offset', full_name='ConsRes.offset', index=1,
-      number=2, type=3, cpp_type=2, label=1,
-      has_default_value=False, default_value=0,
+      name='topic', full_name='ListConsumersReq.topic', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
     _descriptor.FieldDescriptor(
-      name='key_value', full_name='ConsRes.key_value', index=2,
-      number=3, type=12, cpp_type=9, label=1,
-      has_default_value=False, default_value=_b(""),
+      name='group', full_name='ListConsumersReq.group', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
     _descriptor.FieldDescriptor(
-      name='key_undefined', full_name='ConsRes.key_undefined', index=3,
+      name='refresh', full_name='ListConsumersReq.refresh', index=3,
       number=4, type=8, cpp_type=7, label=1,
       has_default_value=False, default_value=False,
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=1545,
+  serialized_end=1625,
+)
+
+
+_LISTCONSUMERSRES = _descriptor.Descriptor(
+  name='ListConsumersRes',
+  full_name='ListConsumersRes',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
     _descriptor.FieldDescriptor(
-      name='message', full_name='ConsRes.message', index=4,
-      number=5, type=12, cpp_type=9, label=1,
-      has_default_value=False, default_value=_b(""),
+      name='groups', full_name='ListConsumersRes.groups', index=0,
+      number=1, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None),
@@ -229,14 +985,33 @@ _CONSRES = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=236,
-  serialized_end=339,
+  serialized_start=1627,
+  serialized_end=1677,
 )
 
+_GETOFFSETSRES.fields_by_name['offsets'].message_type = _PARTITIONOFFSET
+_SETOFFSETSREQ.fields_by_name['offsets'].message_type = _PARTITIONOFFSET
+_SETOFFSETSRES.fields_by_name['offsets'].message_type = _PARTITIONOFFSET
+_CONSUMERGROUP.fields_by_name['members'].message_type = _GROUPMEMBER
+_LISTCONSUMERSRES.fields_by_name['groups'].message_type = _CONSUMERGROUP
 DESCRIPTOR.message_types_by_name['ProdReq'] = _PRODREQ
 DESCRIPTOR.message_types_by_name['ProdRes'] = _PRODRES
 DESCRIPTOR.message_types_by_name['ConsReq'] = _CONSREQ
 DESCRIPTOR.message_types_by_name['ConsRes'] = _CONSRES
+DESCRIPTOR.message_types_by_name['ConsNReq'] = _CONSNREQ
+DESCRIPTOR.message_types_by_name['AckReq'] = _ACKREQ
+DESCRIPTOR.message_types_by_name['AckRes'] = _ACKRES
+DESCRIPTOR.message_types_by_name['RetryRes'] = _RETRYRES
+DESCRIPTOR.message_types_by_name['NackReq'] = _NACKREQ
+DESCRIPTOR.message_types_by_name['PartitionOffset'] = _PARTITIONOFFSET
+DESCRIPTOR.message_types_by_name['GetOffsetsReq'] = _GETOFFSETSREQ
+DESCRIPTOR.message_types_by_name['GetOffsetsRes'] = _GETOFFSETSRES
+DESCRIPTOR.message_types_by_name['SetOffsetsReq'] = _SETOFFSETSREQ
+DESCRIPTOR.message_types_by_name['SetOffsetsRes'] = _SETOFFSETSRES
+DESCRIPTOR.message_types_by_name['GroupMember'] = _GROUPMEMBER
+DESCRIPTOR.message_types_by_name['ConsumerGroup'] = _CONSUMERGROUP
+DESCRIPTOR.message_types_by_name['ListConsumersReq'] = _LISTCONSUMERSREQ
+DESCRIPTOR.message_types_by_name['ListConsumersRes'] = _LISTCONSUMERSRES
 
 ProdReq = _reflection.GeneratedProtocolMessageType('ProdReq', (_message.Message,), dict(
   DESCRIPTOR = _PRODREQ,
@@ -266,6 +1041,104 @@ ConsRes = _reflection.GeneratedProtocolMessageType('ConsRes', (_message.Message,
   ))
 _sym_db.RegisterMessage(ConsRes)
 
+ConsNReq = _reflection.GeneratedProtocolMessageType('ConsNReq', (_message.Message,), dict(
+  DESCRIPTOR = _CONSNREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:ConsNReq)
+  ))
+_sym_db.RegisterMessage(ConsNReq)
+
+AckReq = _reflection.GeneratedProtocolMessageType('AckReq', (_message.Message,), dict(
+  DESCRIPTOR = _ACKREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:AckReq)
+  ))
+_sym_db.RegisterMessage(AckReq)
+
+AckRes = _reflection.GeneratedProtocolMessageType('AckRes', (_message.Message,), dict(
+  DESCRIPTOR = _ACKRES,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:AckRes)
+  ))
+_sym_db.RegisterMessage(AckRes)
+
+RetryRes = _reflection.GeneratedProtocolMessageType('RetryRes', (_message.Message,), dict(
+  DESCRIPTOR = _RETRYRES,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:RetryRes)
+  ))
+_sym_db.RegisterMessage(RetryRes)
+
+NackReq = _reflection.GeneratedProtocolMessageType('NackReq', (_message.Message,), dict(
+  DESCRIPTOR = _NACKREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:NackReq)
+  ))
+_sym_db.RegisterMessage(NackReq)
+
+PartitionOffset = _reflection.GeneratedProtocolMessageType('PartitionOffset', (_message.Message,), dict(
+  DESCRIPTOR = _PARTITIONOFFSET,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:PartitionOffset)
+  ))
+_sym_db.RegisterMessage(PartitionOffset)
+
+GetOffsetsReq = _reflection.GeneratedProtocolMessageType('GetOffsetsReq', (_message.Message,), dict(
+  DESCRIPTOR = _GETOFFSETSREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:GetOffsetsReq)
+  ))
+_sym_db.RegisterMessage(GetOffsetsReq)
+
+GetOffsetsRes = _reflection.GeneratedProtocolMessageType('GetOffsetsRes', (_message.Message,), dict(
+  DESCRIPTOR = _GETOFFSETSRES,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:GetOffsetsRes)
+  ))
+_sym_db.RegisterMessage(GetOffsetsRes)
+
+SetOffsetsReq = _reflection.GeneratedProtocolMessageType('SetOffsetsReq', (_message.Message,), dict(
+  DESCRIPTOR = _SETOFFSETSREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:SetOffsetsReq)
+  ))
+_sym_db.RegisterMessage(SetOffsetsReq)
+
+SetOffsetsRes = _reflection.GeneratedProtocolMessageType('SetOffsetsRes', (_message.Message,), dict(
+  DESCRIPTOR = _SETOFFSETSRES,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:SetOffsetsRes)
+  ))
+_sym_db.RegisterMessage(SetOffsetsRes)
+
+GroupMember = _reflection.GeneratedProtocolMessageType('GroupMember', (_message.Message,), dict(
+  DESCRIPTOR = _GROUPMEMBER,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:GroupMember)
+  ))
+_sym_db.RegisterMessage(GroupMember)
+
+ConsumerGroup = _reflection.GeneratedProtocolMessageType('ConsumerGroup', (_message.Message,), dict(
+  DESCRIPTOR = _CONSUMERGROUP,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:ConsumerGroup)
+  ))
+_sym_db.RegisterMessage(ConsumerGroup)
+
+ListConsumersReq = _reflection.GeneratedProtocolMessageType('ListConsumersReq', (_message.Message,), dict(
+  DESCRIPTOR = _LISTCONSUMERSREQ,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:ListConsumersReq)
+  ))
+_sym_db.RegisterMessage(ListConsumersReq)
+
+ListConsumersRes = _reflection.GeneratedProtocolMessageType('ListConsumersRes', (_message.Message,), dict(
+  DESCRIPTOR = _LISTCONSUMERSRES,
+  __module__ = 'grpc_pb2'
+  # @@protoc_insertion_point(class_scope:ListConsumersRes)
+  ))
+_sym_db.RegisterMessage(ListConsumersRes)
+
 
 DESCRIPTOR.has_options = True
 DESCRIPTOR._options = _descriptor._ParseOptions(descriptor_pb2.FileOptions(), _b('Z\002pb'))
@@ -292,11 +1165,51 @@ try:
           request_serializer=ProdReq.SerializeToString,
           response_deserializer=ProdRes.FromString,
           )
+      self.ProduceStream = channel.stream_stream(
+          '/KafkaPixy/ProduceStream',
+          request_serializer=ProdReq.SerializeToString,
+          response_deserializer=ProdRes.FromString,
+          )
       self.Consume = channel.unary_unary(
           '/KafkaPixy/Consume',
           request_serializer=ConsReq.SerializeToString,
           response_deserializer=ConsRes.FromString,
           )
+      self.ConsumeStream = channel.unary_stream(
+          '/KafkaPixy/ConsumeStream',
+          request_serializer=ConsNReq.SerializeToString,
+          response_deserializer=ConsRes.FromString,
+          )
+      self.Ack = channel.unary_unary(
+          '/KafkaPixy/Ack',
+          request_serializer=AckReq.SerializeToString,
+          response_deserializer=AckRes.FromString,
+          )
+      self.Retry = channel.unary_unary(
+          '/KafkaPixy/Retry',
+          request_serializer=AckReq.SerializeToString,
+          response_deserializer=RetryRes.FromString,
+          )
+      self.Nack = channel.unary_unary(
+          '/KafkaPixy/Nack',
+          request_serializer=NackReq.SerializeToString,
+          response_deserializer=AckRes.FromString,
+          )
+      self.GetOffsets = channel.unary_unary(
+          '/KafkaPixy/GetOffsets',
+          request_serializer=GetOffsetsReq.SerializeToString,
+          response_deserializer=GetOffsetsRes.FromString,
+          )
+      self.SetOffsets = channel.unary_unary(
+          '/KafkaPixy/SetOffsets',
+          request_serializer=SetOffsetsReq.SerializeToString,
+          response_deserializer=SetOffsetsRes.FromString,
+          )
+      self.ListConsumers = channel.unary_unary(
+          '/KafkaPixy/ListConsumers',
+          request_serializer=ListConsumersReq.SerializeToString,
+          response_deserializer=ListConsumersRes.FromString,
+          )
 
 
   class KafkaPixyServicer(object):
@@ -306,11 +1219,51 @@ try:
       context.set_details('Method not implemented!')
       raise NotImplementedError('Method not implemented!')
 
+    def ProduceStream(self, request_iterator, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
     def Consume(self, request, context):
       context.set_code(grpc.StatusCode.UNIMPLEMENTED)
       context.set_details('Method not implemented!')
       raise NotImplementedError('Method not implemented!')
 
+    def ConsumeStream(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def Ack(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def Retry(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def Nack(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def GetOffsets(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def SetOffsets(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
+    def ListConsumers(self, request, context):
+      context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+      context.set_details('Method not implemented!')
+      raise NotImplementedError('Method not implemented!')
+
 
   def add_KafkaPixyServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -319,11 +1272,51 @@ try:
             request_deserializer=ProdReq.FromString,
             response_serializer=ProdRes.SerializeToString,
         ),
+        'ProduceStream': grpc.stream_stream_rpc_method_handler(
+            servicer.ProduceStream,
+            request_deserializer=ProdReq.FromString,
+            response_serializer=ProdRes.SerializeToString,
+        ),
         'Consume': grpc.unary_unary_rpc_method_handler(
             servicer.Consume,
             request_deserializer=ConsReq.FromString,
             response_serializer=ConsRes.SerializeToString,
         ),
+        'ConsumeStream': grpc.unary_stream_rpc_method_handler(
+            servicer.ConsumeStream,
+            request_deserializer=ConsNReq.FromString,
+            response_serializer=ConsRes.SerializeToString,
+        ),
+        'Ack': grpc.unary_unary_rpc_method_handler(
+            servicer.Ack,
+            request_deserializer=AckReq.FromString,
+            response_serializer=AckRes.SerializeToString,
+        ),
+        'Retry': grpc.unary_unary_rpc_method_handler(
+            servicer.Retry,
+            request_deserializer=AckReq.FromString,
+            response_serializer=RetryRes.SerializeToString,
+        ),
+        'Nack': grpc.unary_unary_rpc_method_handler(
+            servicer.Nack,
+            request_deserializer=NackReq.FromString,
+            response_serializer=AckRes.SerializeToString,
+        ),
+        'GetOffsets': grpc.unary_unary_rpc_method_handler(
+            servicer.GetOffsets,
+            request_deserializer=GetOffsetsReq.FromString,
+            response_serializer=GetOffsetsRes.SerializeToString,
+        ),
+        'SetOffsets': grpc.unary_unary_rpc_method_handler(
+            servicer.SetOffsets,
+            request_deserializer=SetOffsetsReq.FromString,
+            response_serializer=SetOffsetsRes.SerializeToString,
+        ),
+        'ListConsumers': grpc.unary_unary_rpc_method_handler(
+            servicer.ListConsumers,
+            request_deserializer=ListConsumersReq.FromString,
+            response_serializer=ListConsumersRes.SerializeToString,
+        ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
         'KafkaPixy', rpc_method_handlers)
@@ -338,8 +1331,24 @@ try:
     only to ease transition from grpcio<0.15.0 to grpcio>=0.15.0."""
     def Produce(self, request, context):
       context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def ProduceStream(self, request_iterator, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
     def Consume(self, request, context):
       context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def ConsumeStream(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def Ack(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def Retry(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def Nack(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def GetOffsets(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def SetOffsets(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
+    def ListConsumers(self, request, context):
+      context.code(beta_interfaces.StatusCode.UNIMPLEMENTED)
 
 
   class BetaKafkaPixyStub(object):
@@ -351,9 +1360,31 @@ try:
     def Produce(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
       raise NotImplementedError()
     Produce.future = None
+    def ProduceStream(self, request_iterator, timeout, metadata=None, protocol_options=None):
+      raise NotImplementedError()
     def Consume(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
       raise NotImplementedError()
     Consume.future = None
+    def ConsumeStream(self, request, timeout, metadata=None, protocol_options=None):
+      raise NotImplementedError()
+    def Ack(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    Ack.future = None
+    def Retry(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    Retry.future = None
+    def Nack(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    Nack.future = None
+    def GetOffsets(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    GetOffsets.future = None
+    def SetOffsets(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    SetOffsets.future = None
+    def ListConsumers(self, request, timeout, metadata=None, with_call=False, protocol_options=None):
+      raise NotImplementedError()
+    ListConsumers.future = None
 
 
   def beta_create_KafkaPixy_server(servicer, pool=None, pool_size=None, default_timeout=None, maximum_timeout=None):
@@ -363,16 +1394,40 @@ try:
     file not marked beta) for all further purposes. This function was
     generated only to ease transition from grpcio<0.15.0 to grpcio>=0.15.0"""
     request_deserializers = {
+      ('KafkaPixy', 'Ack'): AckReq.FromString,
       ('KafkaPixy', 'Consume'): ConsReq.FromString,
+      ('KafkaPixy', 'ConsumeStream'): ConsNReq.FromString,
+      ('KafkaPixy', 'GetOffsets'): GetOffsetsReq.FromString,
+      ('KafkaPixy', 'ListConsumers'): ListConsumersReq.FromString,
+      ('KafkaPixy', 'Nack'): NackReq.FromString,
       ('KafkaPixy', 'Produce'): ProdReq.FromString,
+      ('KafkaPixy', 'ProduceStream'): ProdReq.FromString,
+      ('KafkaPixy', 'Retry'): AckReq.FromString,
+      ('KafkaPixy', 'SetOffsets'): SetOffsetsReq.FromString,
     }
     response_serializers = {
+      ('KafkaPixy', 'Ack'): AckRes.SerializeToString,
       ('KafkaPixy', 'Consume'): ConsRes.SerializeToString,
+      ('KafkaPixy', 'ConsumeStream'): ConsRes.SerializeToString,
+      ('KafkaPixy', 'GetOffsets'): GetOffsetsRes.SerializeToString,
+      ('KafkaPixy', 'ListConsumers'): ListConsumersRes.SerializeToString,
+      ('KafkaPixy', 'Nack'): AckRes.SerializeToString,
       ('KafkaPixy', 'Produce'): ProdRes.SerializeToString,
+      ('KafkaPixy', 'ProduceStream'): ProdRes.SerializeToString,
+      ('KafkaPixy', 'Retry'): RetryRes.SerializeToString,
+      ('KafkaPixy', 'SetOffsets'): SetOffsetsRes.SerializeToString,
     }
     method_implementations = {
+      ('KafkaPixy', 'Ack'): face_utilities.unary_unary_inline(servicer.Ack),
       ('KafkaPixy', 'Consume'): face_utilities.unary_unary_inline(servicer.Consume),
+      ('KafkaPixy', 'ConsumeStream'): face_utilities.unary_stream_inline(servicer.ConsumeStream),
+      ('KafkaPixy', 'GetOffsets'): face_utilities.unary_unary_inline(servicer.GetOffsets),
+      ('KafkaPixy', 'ListConsumers'): face_utilities.unary_unary_inline(servicer.ListConsumers),
+      ('KafkaPixy', 'Nack'): face_utilities.unary_unary_inline(servicer.Nack),
       ('KafkaPixy', 'Produce'): face_utilities.unary_unary_inline(servicer.Produce),
+      ('KafkaPixy', 'ProduceStream'): face_utilities.stream_stream_inline(servicer.ProduceStream),
+      ('KafkaPixy', 'Retry'): face_utilities.unary_unary_inline(servicer.Retry),
+      ('KafkaPixy', 'SetOffsets'): face_utilities.unary_unary_inline(servicer.SetOffsets),
     }
     server_options = beta_implementations.server_options(request_deserializers=request_deserializers, response_serializers=response_serializers, thread_pool=pool, thread_pool_size=pool_size, default_timeout=default_timeout, maximum_timeout=maximum_timeout)
     return beta_implementations.server(method_implementations, options=server_options)
@@ -385,16 +1440,40 @@ try:
     file not marked beta) for all further purposes. This function was
     generated only to ease transition from grpcio<0.15.0 to grpcio>=0.15.0"""
     request_serializers = {
+      ('KafkaPixy', 'Ack'): AckReq.SerializeToString,
       ('KafkaPixy', 'Consume'): ConsReq.SerializeToString,
+      ('KafkaPixy', 'ConsumeStream'): ConsNReq.SerializeToString,
+      ('KafkaPixy', 'GetOffsets'): GetOffsetsReq.SerializeToString,
+      ('KafkaPixy', 'ListConsumers'): ListConsumersReq.SerializeToString,
+      ('KafkaPixy', 'Nack'): NackReq.SerializeToString,
       ('KafkaPixy', 'Produce'): ProdReq.SerializeToString,
+      ('KafkaPixy', 'ProduceStream'): ProdReq.SerializeToString,
+      ('KafkaPixy', 'Retry'): AckReq.SerializeToString,
+      ('KafkaPixy', 'SetOffsets'): SetOffsetsReq.SerializeToString,
     }
     response_deserializers = {
+      ('KafkaPixy', 'Ack'): AckRes.FromString,
       ('KafkaPixy', 'Consume'): ConsRes.FromString,
+      ('KafkaPixy', 'ConsumeStream'): ConsRes.FromString,
+      ('KafkaPixy', 'GetOffsets'): GetOffsetsRes.FromString,
+      ('KafkaPixy', 'ListConsumers'): ListConsumersRes.FromString,
+      ('KafkaPixy', 'Nack'): AckRes.FromString,
       ('KafkaPixy', 'Produce'): ProdRes.FromString,
+      ('KafkaPixy', 'ProduceStream'): ProdRes.FromString,
+      ('KafkaPixy', 'Retry'): RetryRes.FromString,
+      ('KafkaPixy', 'SetOffsets'): SetOffsetsRes.FromString,
     }
     cardinalities = {
+      'Ack': cardinality.Cardinality.UNARY_UNARY,
       'Consume': cardinality.Cardinality.UNARY_UNARY,
+      'ConsumeStream': cardinality.Cardinality.UNARY_STREAM,
+      'GetOffsets': cardinality.Cardinality.UNARY_UNARY,
+      'ListConsumers': cardinality.Cardinality.UNARY_UNARY,
+      'Nack': cardinality.Cardinality.UNARY_UNARY,
       'Produce': cardinality.Cardinality.UNARY_UNARY,
+      'ProduceStream': cardinality.Cardinality.STREAM_STREAM,
+      'Retry': cardinality.Cardinality.UNARY_UNARY,
+      'SetOffsets': cardinality.Cardinality.UNARY_UNARY,
     }
     stub_options = beta_implementations.stub_options(host=host, metadata_transformer=metadata_transformer, request_serializers=request_serializers, response_deserializers=response_deserializers, thread_pool=pool, thread_pool_size=pool_size)
     return beta_implementations.dynamic_stub(channel, 'KafkaPixy', cardinalities, options=stub_options)
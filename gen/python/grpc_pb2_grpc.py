@@ -19,11 +19,51 @@ class KafkaPixyStub(object):
         request_serializer=grpc__pb2.ProdReq.SerializeToString,
         response_deserializer=grpc__pb2.ProdRes.FromString,
         )
+    self.ProduceStream = channel.stream_stream(
+        '/KafkaPixy/ProduceStream',
+        request_serializer=grpc__pb2.ProdReq.SerializeToString,
+        response_deserializer=grpc__pb2.ProdRes.FromString,
+        )
     self.Consume = channel.unary_unary(
         '/KafkaPixy/Consume',
         request_serializer=grpc__pb2.ConsReq.SerializeToString,
         response_deserializer=grpc__pb2.ConsRes.FromString,
         )
+    self.ConsumeStream = channel.unary_stream(
+        '/KafkaPixy/ConsumeStream',
+        request_serializer=grpc__pb2.ConsNReq.SerializeToString,
+        response_deserializer=grpc__pb2.ConsRes.FromString,
+        )
+    self.Ack = channel.unary_unary(
+        '/KafkaPixy/Ack',
+        request_serializer=grpc__pb2.AckReq.SerializeToString,
+        response_deserializer=grpc__pb2.AckRes.FromString,
+        )
+    self.Retry = channel.unary_unary(
+        '/KafkaPixy/Retry',
+        request_serializer=grpc__pb2.AckReq.SerializeToString,
+        response_deserializer=grpc__pb2.RetryRes.FromString,
+        )
+    self.Nack = channel.unary_unary(
+        '/KafkaPixy/Nack',
+        request_serializer=grpc__pb2.NackReq.SerializeToString,
+        response_deserializer=grpc__pb2.AckRes.FromString,
+        )
+    self.GetOffsets = channel.unary_unary(
+        '/KafkaPixy/GetOffsets',
+        request_serializer=grpc__pb2.GetOffsetsReq.SerializeToString,
+        response_deserializer=grpc__pb2.GetOffsetsRes.FromString,
+        )
+    self.SetOffsets = channel.unary_unary(
+        '/KafkaPixy/SetOffsets',
+        request_serializer=grpc__pb2.SetOffsetsReq.SerializeToString,
+        response_deserializer=grpc__pb2.SetOffsetsRes.FromString,
+        )
+    self.ListConsumers = channel.unary_unary(
+        '/KafkaPixy/ListConsumers',
+        request_serializer=grpc__pb2.ListConsumersReq.SerializeToString,
+        response_deserializer=grpc__pb2.ListConsumersRes.FromString,
+        )
 
 
 class KafkaPixyServicer(object):
@@ -33,11 +73,51 @@ class KafkaPixyServicer(object):
     context.set_details('Method not implemented!')
     raise NotImplementedError('Method not implemented!')
 
+  def ProduceStream(self, request_iterator, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
   def Consume(self, request, context):
     context.set_code(grpc.StatusCode.UNIMPLEMENTED)
     context.set_details('Method not implemented!')
     raise NotImplementedError('Method not implemented!')
 
+  def ConsumeStream(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def Ack(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def Retry(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def Nack(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def GetOffsets(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def SetOffsets(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def ListConsumers(self, request, context):
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
 
 def add_KafkaPixyServicer_to_server(servicer, server):
   rpc_method_handlers = {
@@ -46,11 +126,51 @@ def add_KafkaPixyServicer_to_server(servicer, server):
           request_deserializer=grpc__pb2.ProdReq.FromString,
           response_serializer=grpc__pb2.ProdRes.SerializeToString,
       ),
+      'ProduceStream': grpc.stream_stream_rpc_method_handler(
+          servicer.ProduceStream,
+          request_deserializer=grpc__pb2.ProdReq.FromString,
+          response_serializer=grpc__pb2.ProdRes.SerializeToString,
+      ),
       'Consume': grpc.unary_unary_rpc_method_handler(
           servicer.Consume,
           request_deserializer=grpc__pb2.ConsReq.FromString,
           response_serializer=grpc__pb2.ConsRes.SerializeToString,
       ),
+      'ConsumeStream': grpc.unary_stream_rpc_method_handler(
+          servicer.ConsumeStream,
+          request_deserializer=grpc__pb2.ConsNReq.FromString,
+          response_serializer=grpc__pb2.ConsRes.SerializeToString,
+      ),
+      'Ack': grpc.unary_unary_rpc_method_handler(
+          servicer.Ack,
+          request_deserializer=grpc__pb2.AckReq.FromString,
+          response_serializer=grpc__pb2.AckRes.SerializeToString,
+      ),
+      'Retry': grpc.unary_unary_rpc_method_handler(
+          servicer.Retry,
+          request_deserializer=grpc__pb2.AckReq.FromString,
+          response_serializer=grpc__pb2.RetryRes.SerializeToString,
+      ),
+      'Nack': grpc.unary_unary_rpc_method_handler(
+          servicer.Nack,
+          request_deserializer=grpc__pb2.NackReq.FromString,
+          response_serializer=grpc__pb2.AckRes.SerializeToString,
+      ),
+      'GetOffsets': grpc.unary_unary_rpc_method_handler(
+          servicer.GetOffsets,
+          request_deserializer=grpc__pb2.GetOffsetsReq.FromString,
+          response_serializer=grpc__pb2.GetOffsetsRes.SerializeToString,
+      ),
+      'SetOffsets': grpc.unary_unary_rpc_method_handler(
+          servicer.SetOffsets,
+          request_deserializer=grpc__pb2.SetOffsetsReq.FromString,
+          response_serializer=grpc__pb2.SetOffsetsRes.SerializeToString,
+      ),
+      'ListConsumers': grpc.unary_unary_rpc_method_handler(
+          servicer.ListConsumers,
+          request_deserializer=grpc__pb2.ListConsumersReq.FromString,
+          response_serializer=grpc__pb2.ListConsumersRes.SerializeToString,
+      ),
   }
   generic_handler = grpc.method_handlers_generic_handler(
       'KafkaPixy', rpc_method_handlers)
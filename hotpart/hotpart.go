@@ -0,0 +1,288 @@
+package hotpart
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+)
+
+// Byte counters are kept in this many buckets per window, and the oldest
+// bucket is discarded as time goes by, so rates are averaged over a window
+// that slides in steps of window/bucketCount.
+const bucketCount = 10
+
+// PartitionsFn returns IDs of all partitions of a topic. It is used to
+// account for partitions that have no traffic at all.
+type PartitionsFn func(topic string) ([]int32, error)
+
+// Partition describes byte rates of a partition, in bytes per second.
+type Partition struct {
+	Partition    int32   `json:"partition"`
+	ProducedRate float64 `json:"produced_rate"`
+	ConsumedRate float64 `json:"consumed_rate"`
+	Hot          bool    `json:"hot"`
+}
+
+// Report describes byte rates of all partitions of a topic ordered by
+// partition ID, and median rates that partitions are compared against.
+type Report struct {
+	Topic              string      `json:"topic"`
+	Window             string      `json:"window"`
+	SkewFactor         float64     `json:"skew_factor"`
+	MedianProducedRate float64     `json:"median_produced_rate"`
+	MedianConsumedRate float64     `json:"median_consumed_rate"`
+	Partitions         []Partition `json:"partitions"`
+}
+
+// T tracks produce and consume byte rates per partition, and periodically
+// checks topics for partitions that receive much more traffic than the others.
+type T struct {
+	actorID      *actor.ID
+	cfg          *config.Proxy
+	partitionsFn PartitionsFn
+	bucketSize   time.Duration
+	stopCh       chan none.T
+	wg           sync.WaitGroup
+
+	mu     sync.Mutex
+	meters map[partitionKey]*meter
+	hot    map[partitionKey]bool
+
+	// To be used in tests only
+	now func() time.Time
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+type meter struct {
+	produced counter
+	consumed counter
+}
+
+// counter is a sliding window byte counter. Each bucket holds bytes counted
+// during a period of time identified by a sequence number in `seqs`.
+type counter struct {
+	bytes [bucketCount]int64
+	seqs  [bucketCount]int64
+}
+
+// Spawn creates a hot partition tracker and starts its internal goroutine.
+// `partitionsFn` is used to get all partitions of topics being checked.
+func Spawn(namespace *actor.ID, cfg *config.Proxy, partitionsFn PartitionsFn) *T {
+	t := &T{
+		actorID:      namespace.NewChild("hotpart"),
+		cfg:          cfg,
+		partitionsFn: partitionsFn,
+		bucketSize:   cfg.HotPartitions.Window / bucketCount,
+		stopCh:       make(chan none.T),
+		meters:       make(map[partitionKey]*meter),
+		hot:          make(map[partitionKey]bool),
+		now:          time.Now,
+	}
+	actor.Spawn(t.actorID, &t.wg, t.run)
+	return t
+}
+
+// Stop terminates the tracker goroutine.
+func (t *T) Stop() {
+	close(t.stopCh)
+	t.wg.Wait()
+}
+
+// CountProduced registers a message of the specified size produced to a
+// partition. It implements `config.PartitionMeter`.
+func (t *T) CountProduced(topic string, partition int32, size int) {
+	seq := t.seq()
+	t.mu.Lock()
+	t.getMeter(topic, partition).produced.add(seq, int64(size))
+	t.mu.Unlock()
+}
+
+// CountConsumed registers a message of the specified size consumed from a
+// partition.
+func (t *T) CountConsumed(topic string, partition int32, size int) {
+	seq := t.seq()
+	t.mu.Lock()
+	t.getMeter(topic, partition).consumed.add(seq, int64(size))
+	t.mu.Unlock()
+}
+
+// Report returns byte rates of the specified partitions of a topic, or of
+// the partitions that had traffic during the window if none are specified.
+func (t *T) Report(topic string, partitions []int32) Report {
+	seq := t.seq()
+	windowSec := t.cfg.HotPartitions.Window.Seconds()
+	t.mu.Lock()
+	if len(partitions) == 0 {
+		for key := range t.meters {
+			if key.topic == topic {
+				partitions = append(partitions, key.partition)
+			}
+		}
+	}
+	report := Report{
+		Topic:      topic,
+		Window:     t.cfg.HotPartitions.Window.String(),
+		SkewFactor: t.cfg.HotPartitions.SkewFactor,
+		Partitions: make([]Partition, len(partitions)),
+	}
+	for i, partition := range partitions {
+		report.Partitions[i].Partition = partition
+		if m := t.meters[partitionKey{topic, partition}]; m != nil {
+			report.Partitions[i].ProducedRate = float64(m.produced.sum(seq)) / windowSec
+			report.Partitions[i].ConsumedRate = float64(m.consumed.sum(seq)) / windowSec
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		return report.Partitions[i].Partition < report.Partitions[j].Partition
+	})
+	producedRates := make([]float64, len(report.Partitions))
+	consumedRates := make([]float64, len(report.Partitions))
+	for i, p := range report.Partitions {
+		producedRates[i] = p.ProducedRate
+		consumedRates[i] = p.ConsumedRate
+	}
+	report.MedianProducedRate = median(producedRates)
+	report.MedianConsumedRate = median(consumedRates)
+	for i, p := range report.Partitions {
+		report.Partitions[i].Hot = t.isHot(p.ProducedRate, report.MedianProducedRate) ||
+			t.isHot(p.ConsumedRate, report.MedianConsumedRate)
+	}
+	return report
+}
+
+// isHot tells whether a rate is skewed compared to the median rate.
+func (t *T) isHot(rate, median float64) bool {
+	if rate < float64(t.cfg.HotPartitions.MinRate) || rate == 0 {
+		return false
+	}
+	return rate > median*t.cfg.HotPartitions.SkewFactor
+}
+
+func (t *T) run() {
+	ticker := time.NewTicker(t.cfg.HotPartitions.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.check()
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// check discards meters of partitions that had no traffic during the window,
+// and reports partitions of the remaining topics that became hot since the
+// last check.
+func (t *T) check() {
+	seq := t.seq()
+	topics := make(map[string]bool)
+	t.mu.Lock()
+	for key, m := range t.meters {
+		if m.produced.sum(seq) == 0 && m.consumed.sum(seq) == 0 {
+			delete(t.meters, key)
+			continue
+		}
+		topics[key.topic] = true
+	}
+	t.mu.Unlock()
+
+	hot := make(map[partitionKey]bool)
+	for topic := range topics {
+		var partitions []int32
+		if t.partitionsFn != nil {
+			var err error
+			if partitions, err = t.partitionsFn(topic); err != nil {
+				log.Errorf("<%s> failed to get partitions: topic=%s, err=(%s)", t.actorID, topic, err)
+				continue
+			}
+		}
+		report := t.Report(topic, partitions)
+		for _, p := range report.Partitions {
+			if !p.Hot {
+				continue
+			}
+			key := partitionKey{topic, p.Partition}
+			hot[key] = true
+			if t.hot[key] {
+				continue
+			}
+			log.Warningf("<%s> hot partition: topic=%s, partition=%d, produced_rate=%.0f, consumed_rate=%.0f, median_produced_rate=%.0f, median_consumed_rate=%.0f",
+				t.actorID, topic, p.Partition, p.ProducedRate, p.ConsumedRate, report.MedianProducedRate, report.MedianConsumedRate)
+			if t.cfg.HotPartitions.Listener != nil {
+				t.cfg.HotPartitions.Listener.OnHotPartition(config.HotPartition{
+					Topic:              topic,
+					Partition:          p.Partition,
+					ProducedRate:       p.ProducedRate,
+					ConsumedRate:       p.ConsumedRate,
+					MedianProducedRate: report.MedianProducedRate,
+					MedianConsumedRate: report.MedianConsumedRate,
+				})
+			}
+		}
+	}
+	// Only the run goroutine accesses the hot set.
+	t.hot = hot
+}
+
+// getMeter returns a meter of the specified partition. It must be called with
+// `mu` locked.
+func (t *T) getMeter(topic string, partition int32) *meter {
+	key := partitionKey{topic, partition}
+	m := t.meters[key]
+	if m == nil {
+		m = &meter{}
+		t.meters[key] = m
+	}
+	return m
+}
+
+// seq returns the sequence number of the current bucket.
+func (t *T) seq() int64 {
+	return t.now().UnixNano() / int64(t.bucketSize)
+}
+
+func (c *counter) add(seq, bytes int64) {
+	i := seq % bucketCount
+	if c.seqs[i] != seq {
+		c.seqs[i] = seq
+		c.bytes[i] = 0
+	}
+	c.bytes[i] += bytes
+}
+
+// sum returns the number of bytes counted during the window ending with the
+// bucket `seq`.
+func (c *counter) sum(seq int64) int64 {
+	var total int64
+	for i := range c.bytes {
+		if c.seqs[i] > seq-bucketCount && c.seqs[i] <= seq {
+			total += c.bytes[i]
+		}
+	}
+	return total
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,156 @@
+package hotpart
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&HotPartSuite{})
+
+type HotPartSuite struct {
+	ns  *actor.ID
+	cfg *config.Proxy
+	now time.Time
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *HotPartSuite) SetUpTest(c *C) {
+	s.ns = actor.RootID.NewChild("T")
+	s.cfg = config.DefaultProxy()
+	s.cfg.HotPartitions.Enabled = true
+	s.cfg.HotPartitions.Window = 10 * time.Second
+	s.cfg.HotPartitions.MinRate = 10
+	s.cfg.HotPartitions.CheckInterval = time.Hour
+	s.now = time.Date(2016, 11, 3, 10, 15, 0, 0, time.UTC)
+}
+
+func (s *HotPartSuite) spawn(partitionsFn PartitionsFn) *T {
+	t := Spawn(s.ns, s.cfg, partitionsFn)
+	t.now = func() time.Time { return s.now }
+	return t
+}
+
+// Rates are averaged over the window, and a partition is hot if its rate is
+// more than skew factor times the median.
+func (s *HotPartSuite) TestReport(c *C) {
+	t := s.spawn(nil)
+	defer t.Stop()
+
+	// When
+	t.CountProduced("foo", 0, 100)
+	t.CountProduced("foo", 1, 150)
+	t.CountProduced("foo", 2, 1000)
+	t.CountConsumed("foo", 1, 200)
+	t.CountProduced("bar", 0, 5000)
+
+	// Then
+	c.Assert(t.Report("foo", []int32{3, 2, 1, 0}), DeepEquals, Report{
+		Topic:              "foo",
+		Window:             "10s",
+		SkewFactor:         5,
+		MedianProducedRate: 12.5,
+		MedianConsumedRate: 0,
+		Partitions: []Partition{
+			{Partition: 0, ProducedRate: 10},
+			{Partition: 1, ProducedRate: 15, ConsumedRate: 20, Hot: true},
+			{Partition: 2, ProducedRate: 100, Hot: true},
+			{Partition: 3},
+		},
+	})
+}
+
+// Partitions with rates below the minimum are never hot.
+func (s *HotPartSuite) TestReportMinRate(c *C) {
+	t := s.spawn(nil)
+	defer t.Stop()
+
+	// When
+	t.CountProduced("foo", 0, 90)
+
+	// Then
+	report := t.Report("foo", []int32{0, 1, 2})
+	c.Assert(report.Partitions[0].ProducedRate, Equals, float64(9))
+	c.Assert(report.Partitions[0].Hot, Equals, false)
+}
+
+// Bytes counted before the window are not taken into account.
+func (s *HotPartSuite) TestWindowSlides(c *C) {
+	t := s.spawn(nil)
+	defer t.Stop()
+	t.CountProduced("foo", 0, 100)
+	s.now = s.now.Add(5 * time.Second)
+	t.CountProduced("foo", 0, 200)
+
+	// When
+	s.now = s.now.Add(6 * time.Second)
+
+	// Then
+	c.Assert(t.Report("foo", nil).Partitions, DeepEquals, []Partition{
+		{Partition: 0, ProducedRate: 20},
+	})
+}
+
+// A partition that became hot is reported to the listener once, and again
+// only after it cooled down.
+func (s *HotPartSuite) TestCheck(c *C) {
+	listener := &hotPartitionListener{}
+	s.cfg.HotPartitions.Listener = listener
+	t := s.spawn(func(topic string) ([]int32, error) {
+		return []int32{0, 1, 2}, nil
+	})
+	defer t.Stop()
+	t.CountProduced("foo", 0, 1000)
+
+	// When
+	t.check()
+	t.check()
+	s.now = s.now.Add(11 * time.Second)
+	t.check()
+	t.CountProduced("foo", 0, 1000)
+	t.check()
+
+	// Then
+	hp := config.HotPartition{Topic: "foo", Partition: 0, ProducedRate: 100}
+	c.Assert(listener.hotPartitions(), DeepEquals, []config.HotPartition{hp, hp})
+}
+
+// Meters of partitions that had no traffic during the window are discarded.
+func (s *HotPartSuite) TestCheckDiscardsIdle(c *C) {
+	t := s.spawn(nil)
+	defer t.Stop()
+	t.CountProduced("foo", 0, 1000)
+	s.now = s.now.Add(11 * time.Second)
+	t.CountConsumed("foo", 1, 1000)
+
+	// When
+	t.check()
+
+	// Then
+	c.Assert(t.meters, HasLen, 1)
+	c.Assert(t.meters[partitionKey{"foo", 1}], NotNil)
+}
+
+type hotPartitionListener struct {
+	mu  sync.Mutex
+	hps []config.HotPartition
+}
+
+func (l *hotPartitionListener) OnHotPartition(hp config.HotPartition) {
+	l.mu.Lock()
+	l.hps = append(l.hps, hp)
+	l.mu.Unlock()
+}
+
+func (l *hotPartitionListener) hotPartitions() []config.HotPartition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.hps
+}
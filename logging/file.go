@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mailgun/log"
+	"github.com/pkg/errors"
+)
+
+// FileLogger is the name of the logger that writes to a file, it is to be
+// used in logging configuration along with the file path.
+const FileLogger = "file"
+
+var (
+	fileLoggersMu sync.Mutex
+	fileLoggers   []*fileLogger
+)
+
+// Config is a configuration of an individual logger. It extends
+// `log.Config` with parameters of file loggers.
+type Config struct {
+	log.Config
+	// Path to the log file, it is used by file loggers only.
+	Path string `json:"path"`
+}
+
+// Init instantiates loggers based on the provided configs and initializes the
+// `mailgun/log` facility with them.
+func Init(configs ...Config) error {
+	for _, cfg := range configs {
+		if cfg.Name != FileLogger {
+			if err := log.InitWithConfig(cfg.Config); err != nil {
+				return err
+			}
+			continue
+		}
+		fl, err := newFileLogger(cfg)
+		if err != nil {
+			return err
+		}
+		fileLoggersMu.Lock()
+		fileLoggers = append(fileLoggers, fl)
+		fileLoggersMu.Unlock()
+		log.Init(fl)
+	}
+	return nil
+}
+
+// ReopenFiles makes all file loggers close their files and open them again,
+// so that logs can be rotated by external tools like logrotate, that rename
+// log files and then signal the process to start writing to new ones.
+func ReopenFiles() error {
+	fileLoggersMu.Lock()
+	defer fileLoggersMu.Unlock()
+	for _, fl := range fileLoggers {
+		if err := fl.reopen(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileLogger appends log records to a file.
+//
+// implements `log.Logger`.
+type fileLogger struct {
+	path string
+
+	mu   sync.Mutex
+	sev  log.Severity
+	file *os.File
+}
+
+func newFileLogger(cfg Config) (*fileLogger, error) {
+	if cfg.Path == "" {
+		return nil, errors.Errorf("path is not specified for %s logger", FileLogger)
+	}
+	sev, err := log.SeverityFromString(cfg.Severity)
+	if err != nil {
+		return nil, err
+	}
+	fl := &fileLogger{path: cfg.Path, sev: sev}
+	if err := fl.reopen(); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+// implements `log.Logger`.
+func (fl *fileLogger) Writer(sev log.Severity) io.Writer {
+	if sev < fl.GetSeverity() {
+		return nil
+	}
+	return fl
+}
+
+// implements `log.Logger`.
+func (fl *fileLogger) FormatMessage(sev log.Severity, caller *log.CallerInfo, format string, args ...interface{}) string {
+	return fmt.Sprintf("%v %-5s %s\n",
+		time.Now().UTC().Format(time.StampMilli), sev, fmt.Sprintf(format, args...))
+}
+
+// implements `log.Logger`.
+func (fl *fileLogger) SetSeverity(sev log.Severity) {
+	fl.mu.Lock()
+	fl.sev = sev
+	fl.mu.Unlock()
+}
+
+// implements `log.Logger`.
+func (fl *fileLogger) GetSeverity() log.Severity {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return fl.sev
+}
+
+// implements `io.Writer`.
+func (fl *fileLogger) Write(p []byte) (int, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return fl.file.Write(p)
+}
+
+// reopen opens the log file, creating it if it does not exist, and closes the
+// one that has been written to so far.
+func (fl *fileLogger) reopen() error {
+	file, err := os.OpenFile(fl.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open log file %s", fl.path)
+	}
+	fl.mu.Lock()
+	prevFile := fl.file
+	fl.file = file
+	fl.mu.Unlock()
+	if prevFile != nil {
+		prevFile.Close()
+	}
+	return nil
+}
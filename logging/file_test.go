@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mailgun/log"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&FileSuite{})
+
+type FileSuite struct {
+	dir string
+}
+
+func (s *FileSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// When a log file is renamed, records keep going to it until the logger
+// reopens the file, and then they go to a new file.
+func (s *FileSuite) TestReopen(c *C) {
+	path := filepath.Join(s.dir, "pixy.log")
+	fl, err := newFileLogger(Config{Config: log.Config{Name: FileLogger, Severity: "info"}, Path: path})
+	c.Assert(err, IsNil)
+	fl.Writer(log.SeverityInfo).Write([]byte("foo\n"))
+	c.Assert(os.Rename(path, path+".1"), IsNil)
+	fl.Writer(log.SeverityError).Write([]byte("bar\n"))
+
+	// When
+	err = fl.reopen()
+
+	// Then
+	c.Assert(err, IsNil)
+	fl.Writer(log.SeverityInfo).Write([]byte("bazz\n"))
+	rotated, _ := ioutil.ReadFile(path + ".1")
+	c.Assert(string(rotated), Equals, "foo\nbar\n")
+	current, _ := ioutil.ReadFile(path)
+	c.Assert(string(current), Equals, "bazz\n")
+}
+
+// Records below the configured severity are not written.
+func (s *FileSuite) TestSeverity(c *C) {
+	fl, err := newFileLogger(Config{Config: log.Config{Name: FileLogger, Severity: "warn"}, Path: filepath.Join(s.dir, "pixy.log")})
+	c.Assert(err, IsNil)
+	c.Assert(fl.Writer(log.SeverityInfo), IsNil)
+	c.Assert(fl.Writer(log.SeverityWarning), NotNil)
+}
+
+func (s *FileSuite) TestPathMissing(c *C) {
+	_, err := newFileLogger(Config{Config: log.Config{Name: FileLogger, Severity: "info"}})
+	c.Assert(err, ErrorMatches, "path is not specified for file logger")
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/log"
+)
+
+var (
+	// Requests samples log records of API requests that did not fail.
+	Requests = NewSampler(0)
+
+	// FailedRequests samples log records of API requests that failed.
+	FailedRequests = NewSampler(1)
+
+	// ConsumerWarnings samples warnings that consumers log per message.
+	ConsumerWarnings = NewSampler(1)
+)
+
+// Sampler decides which log records of a particular kind should be logged, so
+// that only the configured fraction of them is. Records are sampled evenly,
+// e.g. with rate 0.01 every 100th record is logged.
+type Sampler struct {
+	mu      sync.Mutex
+	rate    float64
+	seen    float64
+	allowed float64
+}
+
+// NewSampler creates a sampler that allows the specified fraction of records,
+// from 0 (none) to 1 (all).
+func NewSampler(rate float64) *Sampler {
+	return &Sampler{rate: rate}
+}
+
+// InitSampling configures the global samplers.
+func InitSampling(cfg *config.App) {
+	Requests.SetRate(cfg.LogSampling.Requests)
+	FailedRequests.SetRate(cfg.LogSampling.FailedRequests)
+	ConsumerWarnings.SetRate(cfg.LogSampling.ConsumerWarnings)
+}
+
+// SetRate changes the fraction of records that the sampler allows.
+func (s *Sampler) SetRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = rate
+	s.seen, s.allowed = 0, 0
+}
+
+// Allow tells whether the next record should be logged.
+func (s *Sampler) Allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	s.seen++
+	if s.allowed+1 > s.seen*s.rate {
+		return false
+	}
+	s.allowed++
+	return true
+}
+
+// Infof logs an info record if it is allowed by the sampler.
+func (s *Sampler) Infof(format string, v ...interface{}) {
+	if s.Allow() {
+		log.Logfmt(1, log.SeverityInfo, format, v...)
+	}
+}
+
+// Warningf logs a warning record if it is allowed by the sampler.
+func (s *Sampler) Warningf(format string, v ...interface{}) {
+	if s.Allow() {
+		log.Logfmt(1, log.SeverityWarning, format, v...)
+	}
+}
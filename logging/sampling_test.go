@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SamplingSuite{})
+
+type SamplingSuite struct{}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+// Records are sampled evenly with the configured rate.
+func (s *SamplingSuite) TestAllow(c *C) {
+	for i, tc := range []struct {
+		rate    float64
+		allowed []int
+	}{
+		/* 0 */ {0, nil},
+		/* 1 */ {1, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		/* 2 */ {0.5, []int{2, 4, 6, 8, 10}},
+		/* 3 */ {0.3, []int{4, 7, 10}},
+		/* 4 */ {0.1, []int{10}},
+		/* 5 */ {0.01, nil},
+	} {
+		sampler := NewSampler(tc.rate)
+		var allowed []int
+		for n := 1; n <= 10; n++ {
+			if sampler.Allow() {
+				allowed = append(allowed, n)
+			}
+		}
+		c.Assert(allowed, DeepEquals, tc.allowed, Commentf("case #%d", i))
+	}
+}
+
+// Changing the rate resets the sampler.
+func (s *SamplingSuite) TestSetRate(c *C) {
+	sampler := NewSampler(0.5)
+	c.Assert(sampler.Allow(), Equals, false)
+
+	// When
+	sampler.SetRate(0.5)
+
+	// Then
+	c.Assert(sampler.Allow(), Equals, false)
+	c.Assert(sampler.Allow(), Equals, true)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,9 +11,15 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/bench"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/logging"
-	"github.com/mailgun/kafka-pixy/service"
+	"github.com/mailgun/kafka-pixy/pixy"
+	"github.com/mailgun/kafka-pixy/producer"
+	"github.com/mailgun/kafka-pixy/replay"
+	"github.com/mailgun/kafka-pixy/version"
 	"github.com/mailgun/log"
 )
 
@@ -30,6 +37,7 @@ var (
 	cmdZookeeperPeers string
 	cmdPIDFile        string
 	cmdLoggingJSONCfg string
+	cmdStateDumpFile  string
 )
 
 func init() {
@@ -40,11 +48,19 @@ func init() {
 	flag.StringVar(&cmdKafkaPeers, "kafkaPeers", "", "Comma separated list of brokers")
 	flag.StringVar(&cmdZookeeperPeers, "zookeeperPeers", "", "Comma separated list of ZooKeeper nodes followed by optional chroot")
 	flag.StringVar(&cmdPIDFile, "pidFile", "", "Path to the PID file")
-	flag.StringVar(&cmdLoggingJSONCfg, "logging", defaultLoggingCfg, "Logging configuration")
+	flag.StringVar(&cmdLoggingJSONCfg, "logging", defaultLoggingCfg, "Logging configuration, file loggers are configured as {\"name\": \"file\", \"severity\": \"info\", \"path\": \"/var/log/kafka-pixy.log\"}")
+	flag.StringVar(&cmdStateDumpFile, "stateDumpFile", "", "Path to the file that state dumps triggered by SIGUSR1 are written to, if not specified then they are logged")
 	flag.Parse()
 }
 
 func main() {
+	switch flag.Arg(0) {
+	case "bench":
+		os.Exit(runBench(flag.Args()[1:]))
+	case "replay-file":
+		os.Exit(runReplayFile(flag.Args()[1:]))
+	}
+
 	cfg, err := makeConfig()
 	if err != nil {
 		fmt.Printf("Failed to load config: err=(%s)\n", err)
@@ -63,17 +79,9 @@ func main() {
 		}
 	}
 
-	// Clean up the unix domain socket file in case we failed to clean up on
-	// shutdown the last time. Otherwise the service won't be able to listen
-	// on this address and as a result will fail to start up.
-	if cfg.UnixAddr != "" {
-		if err := os.Remove(cfg.UnixAddr); err != nil && !os.IsNotExist(err) {
-			log.Errorf("Cannot remove %s: err=(%s)", cfg.UnixAddr, err)
-		}
-	}
-
+	log.Infof("Starting: version=%s, commit=%s, buildDate=%s", version.Version, version.GitCommit, version.BuildDate)
 	log.Infof("Starting with config: %+v", cfg)
-	svc, err := service.Spawn(cfg)
+	svc, err := pixy.Start(cfg)
 	if err != nil {
 		log.Errorf("Failed to start service: err=(%s)", err)
 		os.Exit(1)
@@ -81,11 +89,49 @@ func main() {
 
 	// Spawn OS signal listener to ensure graceful stop.
 	osSigCh := make(chan os.Signal, 1)
-	signal.Notify(osSigCh, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	signal.Notify(osSigCh, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// Wait for a quit signal and terminate the service when it is received,
+	// unless the service has been drained via the API already. SIGUSR1 and
+	// SIGUSR2 make the service dump its state and reopen log files
+	// respectively.
+	for {
+		select {
+		case sig := <-osSigCh:
+			switch sig {
+			case syscall.SIGUSR1:
+				dumpState(svc)
+				continue
+			case syscall.SIGUSR2:
+				if err := logging.ReopenFiles(); err != nil {
+					log.Errorf("Failed to reopen log files: err=(%s)", err)
+					continue
+				}
+				log.Infof("Log files reopened")
+				continue
+			}
+			svc.Stop()
+		case <-svc.Done():
+			log.Infof("Service drained")
+		}
+		return
+	}
+}
 
-	// Wait for a quit signal and terminate the service when it is received.
-	<-osSigCh
-	svc.Stop()
+// dumpState writes a snapshot of the service state to the state dump file,
+// if one is configured, or to the log otherwise.
+func dumpState(svc *pixy.Service) {
+	var buf bytes.Buffer
+	svc.DumpState(&buf)
+	if cmdStateDumpFile == "" {
+		log.Infof("State dump:\n%s", buf.String())
+		return
+	}
+	if err := ioutil.WriteFile(cmdStateDumpFile, buf.Bytes(), 0644); err != nil {
+		log.Errorf("Failed to write state dump: file=%s, err=(%s)", cmdStateDumpFile, err)
+		return
+	}
+	log.Infof("State dumped: file=%s", cmdStateDumpFile)
 }
 
 func makeConfig() (*config.App, error) {
@@ -93,6 +139,12 @@ func makeConfig() (*config.App, error) {
 	// If a YAML configuration file is provided, then load it and ignore all
 	// parameters provided on the command line.
 	if cmdConfig != "" {
+		// Secret references are resolved from Vault if it is configured the
+		// same way as for the Vault CLI.
+		if vaultAddr := os.Getenv("VAULT_ADDR"); vaultAddr != "" {
+			config.RegisterSecretsProvider(config.VaultScheme,
+				config.NewVaultSecretsProvider(vaultAddr, os.Getenv("VAULT_TOKEN")))
+		}
 		var err error
 		if cfg, err = config.FromYAMLFile(cmdConfig); err != nil {
 			return nil, err
@@ -126,17 +178,149 @@ func makeConfig() (*config.App, error) {
 }
 
 func initLogging() error {
-	var loggingCfg []log.Config
+	var loggingCfg []logging.Config
 	if err := json.Unmarshal([]byte(cmdLoggingJSONCfg), &loggingCfg); err != nil {
 		return fmt.Errorf("failed to parse logger config: err=(%s)", err)
 	}
-	if err := log.InitWithConfig(loggingCfg...); err != nil {
+	if err := logging.Init(loggingCfg...); err != nil {
 		return err
 	}
 	logging.Init3rdParty()
 	return nil
 }
 
+// runBench implements the `bench` subcommand that drives produce/consume load
+// against a running Kafka-Pixy, or against one started in-process with a
+// mock Kafka cluster, and reports the results.
+func runBench(args []string) int {
+	var (
+		benchCfg bench.Config
+		ops      string
+		mock     bool
+	)
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.StringVar(&benchCfg.Addr, "addr", "localhost:19092", "Either TCP address or unix domain socket path of the HTTP API")
+	fs.StringVar(&ops, "ops", "produce,consume", "Comma separated list of operations to run one after another: produce, consume")
+	fs.StringVar(&benchCfg.Topic, "topic", "test", "Topic to produce to and consume from")
+	fs.StringVar(&benchCfg.Group, "group", "bench", "Consumer group to consume as")
+	fs.BoolVar(&benchCfg.Sync, "sync", false, "Produce synchronously")
+	fs.IntVar(&benchCfg.Threads, "threads", 1, "Number of concurrent clients")
+	fs.IntVar(&benchCfg.Count, "count", 10000, "Number of requests per operation")
+	fs.IntVar(&benchCfg.Size, "size", 1000, "Size of produced messages in bytes")
+	fs.BoolVar(&mock, "mock", false, "Start Kafka-Pixy in-process with a mock Kafka cluster listening on `addr` (produce only)")
+	fs.Parse(args)
+	benchCfg.Ops = strings.Split(ops, ",")
+
+	if err := initLogging(); err != nil {
+		fmt.Printf("Failed to initialize logger: err=(%s)\n", err)
+		return 1
+	}
+	if mock {
+		for _, op := range benchCfg.Ops {
+			if op != bench.OpProduce {
+				fmt.Printf("Only produce is supported with a mock cluster: op=%s\n", op)
+				return 1
+			}
+		}
+		mockCluster := bench.SpawnMockCluster(benchCfg.Topic, 8)
+		defer mockCluster.Close()
+		cfg := config.DefaultApp(defaultPxyAlias)
+		cfg.GRPCAddr = ""
+		cfg.TCPAddr = benchCfg.Addr
+		cfg.Proxies[defaultPxyAlias].Kafka.SeedPeers = []string{mockCluster.Addr()}
+		svc, err := pixy.Start(cfg)
+		if err != nil {
+			fmt.Printf("Failed to start service: err=(%s)\n", err)
+			return 1
+		}
+		defer svc.Stop()
+	}
+
+	reports, err := bench.Drive(benchCfg)
+	if err != nil {
+		fmt.Printf("Failed to run benchmark: err=(%s)\n", err)
+		return 1
+	}
+	for _, report := range reports {
+		fmt.Println(report)
+	}
+	return 0
+}
+
+// runReplayFile implements the `replay-file` subcommand that produces messages
+// of a local JSON lines file straight to Kafka, bypassing the HTTP and gRPC
+// APIs. The cluster is configured the same way as for the service, that is
+// with either `-config` or `-kafkaPeers`.
+func runReplayFile(args []string) int {
+	var (
+		topic    string
+		rate     int
+		pxyAlias string
+	)
+	fs := flag.NewFlagSet("replay-file", flag.ExitOnError)
+	fs.StringVar(&topic, "topic", "", "Topic to produce to")
+	fs.IntVar(&rate, "rate", 0, "Maximum number of messages per second, 0 means as fast as possible")
+	fs.StringVar(&pxyAlias, "proxy", "", "Alias of the proxy in the config to produce with, the default proxy if not specified")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-config FILE | -kafkaPeers PEERS] replay-file [flags] FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if topic == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := makeConfig()
+	if err != nil {
+		fmt.Printf("Failed to load config: err=(%s)\n", err)
+		return 1
+	}
+	if pxyAlias == "" {
+		pxyAlias = cfg.DefaultProxy
+	}
+	proxyCfg := cfg.Proxies[pxyAlias]
+	if proxyCfg == nil {
+		fmt.Printf("Unknown proxy: %s\n", pxyAlias)
+		return 1
+	}
+	if err := initLogging(); err != nil {
+		fmt.Printf("Failed to initialize logger: err=(%s)\n", err)
+		return 1
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed to open file: err=(%s)\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	prod, err := producer.Spawn(actor.RootID.NewChild("replay"), proxyCfg)
+	if err != nil {
+		fmt.Printf("Failed to spawn producer: err=(%s)\n", err)
+		return 1
+	}
+	stats, err := replay.Stream(file, rate, func(key, value []byte, done func(error)) {
+		var keyEnc sarama.Encoder
+		if key != nil {
+			keyEnc = sarama.ByteEncoder(key)
+		}
+		prod.AsyncProduceNotify(topic, keyEnc, sarama.ByteEncoder(value), func(_ *sarama.ProducerMessage, err error) {
+			done(err)
+		})
+	})
+	prod.Stop()
+	fmt.Printf("Replayed: messages=%d, failed=%d, bytes=%d, took=%.fms\n", stats.Messages, stats.Failed, stats.Bytes, stats.TookMs)
+	if err != nil {
+		fmt.Printf("Failed to replay file: err=(%s)\n", err)
+		return 1
+	}
+	if stats.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
 func writePID(path string) error {
 	pid := os.Getpid()
 	return ioutil.WriteFile(path, []byte(fmt.Sprint(pid)), 0644)
@@ -0,0 +1,80 @@
+// Package pixy allows Go applications to embed Kafka-Pixy, that is to run
+// proxies to Kafka/ZooKeeper clusters along with gRPC and HTTP API servers
+// in-process, the same way the `kafka-pixy` executable does.
+//
+//	cfg := config.DefaultApp("default")
+//	cfg.Proxies["default"].Kafka.SeedPeers = []string{"kafka1:9092"}
+//	svc, err := pixy.Start(cfg)
+//	if err != nil {
+//	    ...
+//	}
+//	defer svc.Stop()
+//
+// Applications can also use proxies directly bypassing API servers, see
+// `Service.ProxySet`. Configure API server addresses to empty strings in
+// `config.App` to disable respective servers.
+package pixy
+
+import (
+	"io"
+	"os"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/proxy"
+	"github.com/mailgun/kafka-pixy/service"
+	"github.com/mailgun/log"
+)
+
+// Service represents a running Kafka-Pixy instance.
+type Service struct {
+	svc *service.T
+}
+
+// Start spawns proxies to all Kafka/ZooKeeper clusters defined in the
+// specified config and starts API servers. It returns an error if either a
+// proxy or an API server fails to start. A stale unix domain socket file that
+// cannot be removed is only logged, and then it is up to the HTTP API server
+// whether it can listen on the address.
+//
+// Note that it is up to the caller to initialize logging, see `logging`
+// package.
+func Start(cfg *config.App) (*Service, error) {
+	// Clean up the unix domain socket file in case we failed to clean up on
+	// shutdown the last time. Otherwise the service won't be able to listen
+	// on this address and as a result will fail to start up.
+	if cfg.UnixAddr != "" {
+		if err := os.Remove(cfg.UnixAddr); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Cannot remove %s: err=(%s)", cfg.UnixAddr, err)
+		}
+	}
+	svc, err := service.Spawn(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{svc: svc}, nil
+}
+
+// Stop gracefully stops all API servers waiting for pending requests to
+// complete, and then stops all proxies.
+func (s *Service) Stop() {
+	s.svc.Stop()
+}
+
+// Done returns a channel that is closed when the service has stopped, either
+// because `Stop` was called, or because a drain was requested via the API.
+func (s *Service) Done() <-chan struct{} {
+	return s.svc.Done()
+}
+
+// ProxySet returns a set of proxies to all configured clusters. It can be
+// used to produce and consume messages bypassing API servers.
+func (s *Service) ProxySet() *proxy.Set {
+	return s.svc.ProxySet()
+}
+
+// DumpState writes a human readable snapshot of the service state, that is
+// running actors, consumer partition assignments, and API requests in
+// flight, to `w`. It is meant for troubleshooting.
+func (s *Service) DumpState(w io.Writer) {
+	s.svc.DumpState(w)
+}
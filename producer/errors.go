@@ -0,0 +1,86 @@
+package producer
+
+import (
+	"net"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// Names of errors that a message can fail with, that can be used to configure
+// retry policies in `Config.Producer.Retry.Policies`. Errors that have no name
+// are reported as `ErrNameOther`.
+const (
+	ErrNameNotLeaderForPartition        = "NotLeaderForPartition"
+	ErrNameLeaderNotAvailable           = "LeaderNotAvailable"
+	ErrNameUnknownTopicOrPartition      = "UnknownTopicOrPartition"
+	ErrNameRequestTimedOut              = "RequestTimedOut"
+	ErrNameNotEnoughReplicas            = "NotEnoughReplicas"
+	ErrNameNotEnoughReplicasAfterAppend = "NotEnoughReplicasAfterAppend"
+	ErrNameMessageTooLarge              = "MessageTooLarge"
+	ErrNameCorruptMessage               = "CorruptMessage"
+	ErrNameOutOfBrokers                 = "OutOfBrokers"
+	ErrNameNetwork                      = "Network"
+	ErrNameShuttingDown                 = "ShuttingDown"
+	ErrNameOther                        = "Other"
+)
+
+var errNames = map[error]string{
+	sarama.ErrNotLeaderForPartition:        ErrNameNotLeaderForPartition,
+	sarama.ErrLeaderNotAvailable:           ErrNameLeaderNotAvailable,
+	sarama.ErrUnknownTopicOrPartition:      ErrNameUnknownTopicOrPartition,
+	sarama.ErrRequestTimedOut:              ErrNameRequestTimedOut,
+	sarama.ErrNotEnoughReplicas:            ErrNameNotEnoughReplicas,
+	sarama.ErrNotEnoughReplicasAfterAppend: ErrNameNotEnoughReplicasAfterAppend,
+	sarama.ErrMessageSizeTooLarge:          ErrNameMessageTooLarge,
+	sarama.ErrMessageTooLarge:              ErrNameMessageTooLarge,
+	sarama.ErrInvalidMessage:               ErrNameCorruptMessage,
+	sarama.ErrOutOfBrokers:                 ErrNameOutOfBrokers,
+	sarama.ErrShuttingDown:                 ErrNameShuttingDown,
+}
+
+// IsErrName tells if the specified string is a known error name.
+func IsErrName(name string) bool {
+	if name == ErrNameNetwork || name == ErrNameOther {
+		return true
+	}
+	for _, errName := range errNames {
+		if errName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrName returns the name of an error that a message failed with.
+func ErrName(err error) string {
+	if name, ok := errNames[err]; ok {
+		return name
+	}
+	if _, ok := err.(net.Error); ok {
+		return ErrNameNetwork
+	}
+	return ErrNameOther
+}
+
+// errStats counts messages that failed after all retries by error name.
+type errStats struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (es *errStats) count(err error) {
+	es.mu.Lock()
+	es.counts[ErrName(err)]++
+	es.mu.Unlock()
+}
+
+func (es *errStats) snapshot() map[string]int64 {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	counts := make(map[string]int64, len(es.counts))
+	for name, count := range es.counts {
+		counts[name] = count
+	}
+	return counts
+}
@@ -2,27 +2,46 @@ package producer
 
 import (
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/backoff"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/redaction"
 	"github.com/mailgun/log"
 )
 
 const (
 	maxEncoderReprLength = 4096
+
+	// Messages are flushed to a broker when this many bytes are buffered for
+	// it, or when this much time has elapsed since the last flush. The sticky
+	// partitioner uses the same values to decide when a batch is complete.
+	flushBytes     = 1024 * 1024
+	flushFrequency = 500 * time.Millisecond
 )
 
+// AnyPartition makes a message be placed to a partition selected by the hash
+// of the message key, or a random one if the key is `nil`. If sticky
+// partitioning is enabled for the topic, then messages with a `nil` key stick
+// to one random partition until a batch worth of them is accumulated.
+const AnyPartition int32 = -1
+
+// ErrTimeout is returned by `ProduceWithTimeout` when a message has not been
+// committed to Kafka within the specified timeout.
+var ErrTimeout = errs.New(errs.ErrRequestTimeout, "produce timeout")
+
 // T builds on top of `sarama.AsyncProducer` to improve the shutdown handling.
 // The problem it solves is that `sarama.AsyncProducer` drops all buffered
 // messages as soon as it is ordered to shutdown. On the contrary, when `T` is
 // ordered to stop it allows some time for the buffered messages to be
 // committed to the Kafka cluster, and only when that time has elapsed it drops
-// uncommitted messages.
-//
-// TODO Consider implementing some sort of dead message processing.
+// uncommitted messages, or writes them to the shutdown spool if one is
+// configured.
 type T struct {
 	mergerActorID     *actor.ID
 	dispatcherActorID *actor.ID
@@ -31,8 +50,20 @@ type T struct {
 	shutdownTimeout   time.Duration
 	dispatcherCh      chan *sarama.ProducerMessage
 	resultCh          chan produceResult
+	redactor          *redaction.T
+	errStats          errStats
+	meter             config.PartitionMeter
+	spool             *spool
 	wg                sync.WaitGroup
 
+	// Messages that the Kafka client gave up on are resubmitted according
+	// to the retry policies. Resubmission state is only accessed by the
+	// dispatcher goroutine.
+	retryCfg     retryConfig
+	resubmitCh   chan produceResult
+	resubmits    map[*sarama.ProducerMessage]int
+	resubmitting map[*sarama.ProducerMessage]*resubmission
+
 	// To be used in tests only
 	testDroppedMsgCh chan<- *sarama.ProducerMessage
 }
@@ -42,19 +73,64 @@ type produceResult struct {
 	Err error
 }
 
+type retryConfig struct {
+	backoff      time.Duration
+	jitter       float64
+	maxResubmits int
+	resubmit     map[string]bool
+}
+
+// resubmission is a message that is waiting to be resubmitted.
+type resubmission struct {
+	result produceResult
+	timer  *time.Timer
+}
+
+// Record is a message to be produced as a part of a batch.
+type Record struct {
+	Key, Value sarama.Encoder
+}
+
+// BatchResult is an outcome of producing a message of a batch. If `Err` is nil,
+// then `Msg` is the committed message.
+type BatchResult struct {
+	Msg *sarama.ProducerMessage
+	Err error
+}
+
 // Spawn creates a producer instance and starts its internal goroutines.
 func Spawn(namespace *actor.ID, cfg *config.Proxy) (*T, error) {
 	saramaCfg := sarama.NewConfig()
 	saramaCfg.ChannelBufferSize = cfg.Producer.ChannelBufferSize
-	saramaCfg.ClientID = fmt.Sprintf("%s_producer", cfg.ClientID)
+	saramaCfg.ClientID = cfg.KafkaClientID("_producer")
 	saramaCfg.Producer.RequiredAcks = sarama.WaitForAll
 	saramaCfg.Producer.Return.Successes = true
 	saramaCfg.Producer.Return.Errors = true
 	saramaCfg.Producer.Compression = sarama.CompressionSnappy
-	saramaCfg.Producer.Retry.Backoff = 10 * time.Second
-	saramaCfg.Producer.Retry.Max = 6
-	saramaCfg.Producer.Flush.Frequency = 500 * time.Millisecond
-	saramaCfg.Producer.Flush.Bytes = 1024 * 1024
+	saramaCfg.Producer.Retry.Backoff = cfg.Producer.Retry.Backoff
+	saramaCfg.Producer.Retry.Max = cfg.Producer.Retry.Max
+	saramaCfg.Producer.Flush.Frequency = flushFrequency
+	saramaCfg.Producer.Flush.Bytes = flushBytes
+	saramaCfg.Producer.Partitioner = func(topic string) sarama.Partitioner {
+		return newPartitioner(topic, cfg.ProducerStickyPartitioning(topic))
+	}
+
+	retryCfg := retryConfig{
+		backoff:      cfg.Producer.Retry.Backoff,
+		jitter:       cfg.Producer.Retry.BackoffJitter,
+		maxResubmits: cfg.Producer.Retry.MaxResubmits,
+		resubmit:     make(map[string]bool),
+	}
+	for errName, policy := range cfg.Producer.Retry.Policies {
+		if !IsErrName(errName) {
+			return nil, fmt.Errorf("unknown error in retry policies: %s", errName)
+		}
+		retryCfg.resubmit[errName] = policy == config.RetryResubmit
+	}
+	redactor, err := redaction.New(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	saramaClient, err := sarama.NewClient(cfg.Kafka.SeedPeers, saramaCfg)
 	if err != nil {
@@ -74,6 +150,16 @@ func Spawn(namespace *actor.ID, cfg *config.Proxy) (*T, error) {
 		shutdownTimeout:   cfg.Producer.ShutdownTimeout,
 		dispatcherCh:      make(chan *sarama.ProducerMessage, cfg.Producer.ChannelBufferSize),
 		resultCh:          make(chan produceResult, cfg.Producer.ChannelBufferSize),
+		redactor:          redactor,
+		errStats:          errStats{counts: make(map[string]int64)},
+		meter:             cfg.Producer.PartitionMeter,
+		retryCfg:          retryCfg,
+		resubmitCh:        make(chan produceResult, cfg.Producer.ChannelBufferSize),
+		resubmits:         make(map[*sarama.ProducerMessage]int),
+		resubmitting:      make(map[*sarama.ProducerMessage]*resubmission),
+	}
+	if cfg.Producer.ShutdownSpool != "" {
+		p.spool = newSpool(p.dispatcherActorID, cfg.Producer.ShutdownSpool)
 	}
 	actor.Spawn(p.mergerActorID, &p.wg, p.runMerger)
 	actor.Spawn(p.dispatcherActorID, &p.wg, p.runDispatcher)
@@ -86,6 +172,22 @@ func (p *T) Stop() {
 	p.wg.Wait()
 }
 
+// Spooled returns the number of messages that were written to the shutdown
+// spool, because they had not been committed when the shutdown timeout
+// expired.
+func (p *T) Spooled() int64 {
+	if p.spool == nil {
+		return 0
+	}
+	return p.spool.spooled()
+}
+
+// ErrorCounts returns the number of messages that failed after all retries and
+// resubmissions since the producer started, by error name, see `ErrName`.
+func (p *T) ErrorCounts() map[string]int64 {
+	return p.errStats.snapshot()
+}
+
 // Produce submits a message to the specified `topic` of the Kafka cluster
 // using `key` to identify a destination partition. The exact algorithm used to
 // map keys to partitions is implementation specific but it is guaranteed that
@@ -95,25 +197,111 @@ func (p *T) Stop() {
 // Errors usually indicate a catastrophic failure of the Kafka cluster, or
 // missing topic if there cluster is not configured to auto create topics.
 func (p *T) Produce(topic string, key, message sarama.Encoder) (*sarama.ProducerMessage, error) {
+	return p.ProduceWithTimeout(topic, key, message, 0)
+}
+
+// ProduceWithTimeout is the same as `Produce` except it waits for at most
+// `timeout` for the message to be committed, and returns `ErrTimeout` if it
+// has not been. Note that the message can still be committed to Kafka after
+// that. Zero timeout means wait for as long as it takes.
+func (p *T) ProduceWithTimeout(topic string, key, message sarama.Encoder, timeout time.Duration) (*sarama.ProducerMessage, error) {
+	return p.ProduceToPartition(topic, AnyPartition, key, message, timeout)
+}
+
+// ProduceToPartition is the same as `ProduceWithTimeout` except the message
+// is placed to the specified `partition` regardless of the key, unless it is
+// `AnyPartition`. If the topic does not have such partition, then
+// `sarama.ErrInvalidPartition` is returned.
+func (p *T) ProduceToPartition(topic string, partition int32, key, message sarama.Encoder, timeout time.Duration) (*sarama.ProducerMessage, error) {
 	replyCh := make(chan produceResult, 1)
 	prodMsg := &sarama.ProducerMessage{
-		Topic:    topic,
-		Key:      key,
-		Value:    message,
-		Metadata: replyCh,
+		Topic:     topic,
+		Key:       key,
+		Value:     message,
+		Metadata:  replyCh,
+		Partition: partition,
 	}
 	p.dispatcherCh <- prodMsg
-	result := <-replyCh
-	return result.Msg, result.Err
+	if timeout <= 0 {
+		result := <-replyCh
+		return result.Msg, result.Err
+	}
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+	select {
+	case result := <-replyCh:
+		return result.Msg, result.Err
+	case <-timeoutTimer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// ProduceBatchWithTimeout submits all records to the specified `topic` at once,
+// so that they can be sent to Kafka in as few requests as possible, and then
+// waits for all of them to be committed. It returns a result for every record
+// in the same order. Records that have not been committed within `timeout`
+// fail with `ErrTimeout`. Zero timeout means wait for as long as it takes.
+func (p *T) ProduceBatchWithTimeout(topic string, records []Record, timeout time.Duration) []BatchResult {
+	replyCh := make(chan produceResult, len(records))
+	indexes := make(map[*sarama.ProducerMessage]int, len(records))
+	for i, record := range records {
+		prodMsg := &sarama.ProducerMessage{
+			Topic:     topic,
+			Key:       record.Key,
+			Value:     record.Value,
+			Metadata:  replyCh,
+			Partition: AnyPartition,
+		}
+		indexes[prodMsg] = i
+		p.dispatcherCh <- prodMsg
+	}
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timeoutTimer := time.NewTimer(timeout)
+		defer timeoutTimer.Stop()
+		timeoutCh = timeoutTimer.C
+	}
+	results := make([]BatchResult, len(records))
+	for i := range results {
+		results[i].Err = ErrTimeout
+	}
+	for pending := len(records); pending > 0; pending-- {
+		select {
+		case result := <-replyCh:
+			results[indexes[result.Msg]] = BatchResult{Msg: result.Msg, Err: result.Err}
+		case <-timeoutCh:
+			return results
+		}
+	}
+	return results
 }
 
 // AsyncProduce is an asynchronously counterpart of the `Produce` function.
 // Errors are silently ignored.
 func (p *T) AsyncProduce(topic string, key, message sarama.Encoder) {
+	p.AsyncProduceToPartition(topic, AnyPartition, key, message, nil)
+}
+
+// AsyncProduceNotify is the same as `AsyncProduce` except `onResult` is
+// called with the submitted message and a submission error, if any, when the
+// result is known. The callback is called from an internal goroutine, so it
+// must not block.
+func (p *T) AsyncProduceNotify(topic string, key, message sarama.Encoder, onResult func(*sarama.ProducerMessage, error)) {
+	p.AsyncProduceToPartition(topic, AnyPartition, key, message, onResult)
+}
+
+// AsyncProduceToPartition is the same as `AsyncProduceNotify` except the
+// message is placed to the specified `partition`, see `ProduceToPartition`.
+// `onResult` can be nil.
+func (p *T) AsyncProduceToPartition(topic string, partition int32, key, message sarama.Encoder, onResult func(*sarama.ProducerMessage, error)) {
 	prodMsg := &sarama.ProducerMessage{
-		Topic: topic,
-		Key:   key,
-		Value: message,
+		Topic:     topic,
+		Key:       key,
+		Value:     message,
+		Partition: partition,
+	}
+	if onResult != nil {
+		prodMsg.Metadata = onResult
 	}
 	p.dispatcherCh <- prodMsg
 }
@@ -161,12 +349,13 @@ mergeLoop:
 // the embedded `sarama.AsyncProducer`.
 func (p *T) runDispatcher() {
 	nilOrDispatcherCh := p.dispatcherCh
+	nilOrResubmitCh := p.resubmitCh
 	var nilOrProdInputCh chan<- *sarama.ProducerMessage
 	pendingMsgCount := 0
 	// The normal operation loop is implemented as two-stroke machine. On the
-	// first stroke a message is received from `dispatchCh`, and on the second
-	// it is sent to `prodInputCh`. Note that producer results can be received
-	// at any time.
+	// first stroke a message is received from either `dispatchCh` or
+	// `resubmitCh`, and on the second it is sent to `prodInputCh`. Note that
+	// producer results can be received at any time.
 	prodMsg := (*sarama.ProducerMessage)(nil)
 	channelOpened := true
 	for {
@@ -177,16 +366,37 @@ func (p *T) runDispatcher() {
 			}
 			pendingMsgCount += 1
 			nilOrDispatcherCh = nil
+			nilOrResubmitCh = nil
+			nilOrProdInputCh = p.saramaProducer.Input()
+		case resubmitted := <-nilOrResubmitCh:
+			// A resubmitted message is still pending, so it is not counted.
+			delete(p.resubmitting, resubmitted.Msg)
+			prodMsg = resubmitted.Msg
+			nilOrDispatcherCh = nil
+			nilOrResubmitCh = nil
 			nilOrProdInputCh = p.saramaProducer.Input()
 		case nilOrProdInputCh <- prodMsg:
 			nilOrDispatcherCh = p.dispatcherCh
+			nilOrResubmitCh = p.resubmitCh
 			nilOrProdInputCh = nil
 		case prodResult := <-p.resultCh:
+			if p.scheduleResubmit(prodResult) {
+				continue
+			}
 			pendingMsgCount -= 1
 			p.handleProduceResult(prodResult)
 		}
 	}
 gracefulShutdown:
+	// Messages waiting to be resubmitted fail right away, for the producer
+	// is not going to accept them anymore.
+	for _, rs := range p.resubmitting {
+		if rs.timer.Stop() {
+			delete(p.resubmitting, rs.result.Msg)
+			pendingMsgCount -= 1
+			p.handleShutdownResult(rs.result)
+		}
+	}
 	// Give the `sarama.AsyncProducer` some time to commit buffered messages.
 	log.Infof("<%v> About to stop producer: pendingMsgCount=%d", p.dispatcherActorID, pendingMsgCount)
 	shutdownTimeoutCh := time.After(p.shutdownTimeout)
@@ -197,34 +407,126 @@ gracefulShutdown:
 		case prodResult := <-p.resultCh:
 			pendingMsgCount -= 1
 			p.handleProduceResult(prodResult)
+		case resubmitted := <-p.resubmitCh:
+			delete(p.resubmitting, resubmitted.Msg)
+			pendingMsgCount -= 1
+			p.handleProduceResult(resubmitted)
 		}
 	}
 shutdownNow:
 	log.Infof("<%v> Stopping producer: pendingMsgCount=%d", p.dispatcherActorID, pendingMsgCount)
 	p.saramaProducer.AsyncClose()
 	for prodResult := range p.resultCh {
-		p.handleProduceResult(prodResult)
+		p.handleShutdownResult(prodResult)
+	}
+	// Timers of the remaining resubmissions have already fired, so their
+	// messages are either in `resubmitCh` or about to be sent there.
+	for len(p.resubmitting) > 0 {
+		resubmitted := <-p.resubmitCh
+		delete(p.resubmitting, resubmitted.Msg)
+		p.handleShutdownResult(resubmitted)
+	}
+	if p.spool != nil {
+		p.spool.close()
+		if spooled := p.spool.spooled(); spooled > 0 {
+			log.Warningf("<%v> Spooled messages: count=%d, path=%s", p.dispatcherActorID, spooled, p.spool.path)
+		}
+	}
+}
+
+// scheduleResubmit schedules resubmission of a message that the Kafka client
+// gave up on, if the retry policy of the error says so and the message has not
+// been resubmitted too many times yet. It returns false if the message should
+// fail instead.
+func (p *T) scheduleResubmit(result produceResult) bool {
+	if result.Err == nil || !p.retryCfg.resubmit[ErrName(result.Err)] {
+		delete(p.resubmits, result.Msg)
+		return false
+	}
+	attempt := p.resubmits[result.Msg]
+	if attempt >= p.retryCfg.maxResubmits {
+		delete(p.resubmits, result.Msg)
+		return false
 	}
+	p.resubmits[result.Msg] = attempt + 1
+	log.Infof("<%v> Resubmitting message: attempt=%d, msg=%v, err=(%s)",
+		p.dispatcherActorID, attempt+1, p.messageRepr(result.Msg), result.Err)
+	delay := backoff.Jittered(p.retryCfg.backoff, p.retryCfg.jitter)
+	p.resubmitting[result.Msg] = &resubmission{
+		result: result,
+		timer:  time.AfterFunc(delay, func() { p.resubmitCh <- result }),
+	}
+	return true
+}
+
+// handleShutdownResult is the same as `handleProduceResult` except a failed
+// message is also written to the shutdown spool, if one is configured. It is
+// used for messages that fail because the producer is shutting down.
+func (p *T) handleShutdownResult(result produceResult) {
+	if result.Err != nil && p.spool != nil {
+		p.spool.write(result.Msg, result.Err)
+	}
+	p.handleProduceResult(result)
 }
 
 // handleProduceResult inspects a production results and if it is an error
 // then logs it.
 func (p *T) handleProduceResult(result produceResult) {
-	if replyCh, ok := result.Msg.Metadata.(chan produceResult); ok {
-		replyCh <- result
+	switch md := result.Msg.Metadata.(type) {
+	case chan produceResult:
+		md <- result
+	case func(*sarama.ProducerMessage, error):
+		md(result.Msg, result.Err)
 	}
 	if result.Err == nil {
+		if p.meter != nil {
+			p.meter.CountProduced(result.Msg.Topic, result.Msg.Partition, encodedLen(result.Msg.Key)+encodedLen(result.Msg.Value))
+		}
 		return
 	}
-	prodMsgRepr := fmt.Sprintf(`{Topic: "%s", Key: "%s", Value: "%s"}`,
-		result.Msg.Topic, encoderRepr(result.Msg.Key), encoderRepr(result.Msg.Value))
+	p.errStats.count(result.Err)
 	log.Errorf("<%v> Failed to submit message: msg=%v, err=(%s)",
-		p.dispatcherActorID, prodMsgRepr, result.Err)
+		p.dispatcherActorID, p.messageRepr(result.Msg), result.Err)
 	if p.testDroppedMsgCh != nil {
 		p.testDroppedMsgCh <- result.Msg
 	}
 }
 
+// messageRepr returns the string representation of a message to be used in
+// logs. Message fields that are configured to be redacted for the message
+// topic are replaced with their hashes.
+func (p *T) messageRepr(msg *sarama.ProducerMessage) string {
+	keyRepr := encoderRepr(msg.Key)
+	if p.redactor.KeyRedacted(msg.Topic) {
+		keyRepr = p.redactedRepr(msg.Key)
+	}
+	valueRepr := encoderRepr(msg.Value)
+	if p.redactor.ValueRedacted(msg.Topic) {
+		valueRepr = p.redactedRepr(msg.Value)
+	}
+	return fmt.Sprintf(`{Topic: "%s", Key: "%s", Value: "%s"}`, msg.Topic, keyRepr, valueRepr)
+}
+
+// encodedLen returns the length of an encoded value, or 0 if it is nil.
+func encodedLen(e sarama.Encoder) int {
+	if e == nil {
+		return 0
+	}
+	return e.Length()
+}
+
+// redactedRepr returns the hash of an encoder value, see `redaction.T.Hash`.
+func (p *T) redactedRepr(e sarama.Encoder) string {
+	if e == nil {
+		return "<nil>"
+	}
+	encoded, err := e.Encode()
+	if err != nil {
+		return "<redacted>"
+	}
+	return p.redactor.Hash(encoded)
+}
+
 // encoderRepr returns the string representation of an encoder value. The value
 // is truncated to `maxEncoderReprLength`.
 func encoderRepr(e sarama.Encoder) string {
@@ -243,3 +545,96 @@ func encoderRepr(e sarama.Encoder) string {
 	}
 	return repr
 }
+
+// partitioner places messages to partitions explicitly specified by producers,
+// and falls back to hashing keys for messages with `AnyPartition`. Messages
+// with `AnyPartition` and a `nil` key are placed by the sticky partitioner if
+// it is enabled.
+//
+// implements `sarama.Partitioner`.
+type partitioner struct {
+	hash   sarama.Partitioner
+	sticky *stickyPartitioner
+}
+
+func newPartitioner(topic string, sticky bool) sarama.Partitioner {
+	p := &partitioner{hash: sarama.NewHashPartitioner(topic)}
+	if sticky {
+		p.sticky = newStickyPartitioner(flushBytes, flushFrequency)
+	}
+	return p
+}
+
+// implements `sarama.Partitioner`.
+func (p *partitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if msg.Partition == AnyPartition {
+		if msg.Key == nil && p.sticky != nil {
+			return p.sticky.partition(msg, numPartitions), nil
+		}
+		return p.hash.Partition(msg, numPartitions)
+	}
+	return msg.Partition, nil
+}
+
+// implements `sarama.Partitioner`.
+func (p *partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// stickyPartitioner places messages to one partition until a batch worth of
+// them is accumulated, or until the batch is old enough to be flushed anyway,
+// and then switches to another random partition. That is the behaviour of the
+// sticky partitioner of KIP-480, except that the Kafka client does not tell
+// when it starts a new batch, so batch boundaries are estimated by the flush
+// thresholds of the client.
+//
+// Sarama partitions messages of a topic in a single goroutine, therefore
+// stickyPartitioner is not safe for concurrent use.
+type stickyPartitioner struct {
+	maxBatchBytes int
+	maxBatchAge   time.Duration
+	now           func() time.Time
+	rand          *rand.Rand
+
+	current    int32
+	batchBytes int
+	batchBegin time.Time
+}
+
+func newStickyPartitioner(maxBatchBytes int, maxBatchAge time.Duration) *stickyPartitioner {
+	return &stickyPartitioner{
+		maxBatchBytes: maxBatchBytes,
+		maxBatchAge:   maxBatchAge,
+		now:           time.Now,
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		current:       -1,
+	}
+}
+
+// partition returns a partition to place the message to.
+func (sp *stickyPartitioner) partition(msg *sarama.ProducerMessage, numPartitions int32) int32 {
+	now := sp.now()
+	if sp.current < 0 || sp.current >= numPartitions ||
+		sp.batchBytes >= sp.maxBatchBytes || now.Sub(sp.batchBegin) >= sp.maxBatchAge {
+		sp.current = sp.next(numPartitions)
+		sp.batchBytes = 0
+		sp.batchBegin = now
+	}
+	if msg.Value != nil {
+		sp.batchBytes += msg.Value.Length()
+	}
+	return sp.current
+}
+
+// next picks a random partition other than the current one, unless there is
+// only one to choose from.
+func (sp *stickyPartitioner) next(numPartitions int32) int32 {
+	if sp.current < 0 || sp.current >= numPartitions || numPartitions == 1 {
+		return sp.rand.Int31n(numPartitions)
+	}
+	partition := sp.rand.Int31n(numPartitions - 1)
+	if partition >= sp.current {
+		partition++
+	}
+	return partition
+}
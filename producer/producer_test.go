@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/redaction"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
 	. "gopkg.in/check.v1"
@@ -68,6 +70,67 @@ func (s *ProducerSuite) TestProduce(c *C) {
 	p.Stop()
 }
 
+// Results of a batch are returned in the order of records, and messages with
+// the same key go to the same partition.
+func (s *ProducerSuite) TestProduceBatch(c *C) {
+	p, _ := Spawn(s.ns, s.cfg)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	results := p.ProduceBatchWithTimeout("test.4", []Record{
+		{Key: sarama.StringEncoder("1"), Value: sarama.StringEncoder("Foo")},
+		{Key: sarama.StringEncoder("1"), Value: sarama.StringEncoder("Bar")},
+		{Key: sarama.StringEncoder("1"), Value: sarama.StringEncoder("Bazz")},
+	}, 0)
+
+	// Then
+	c.Assert(len(results), Equals, 3)
+	for i, result := range results {
+		c.Assert(result.Err, IsNil)
+		c.Assert(result.Msg.Partition, Equals, int32(0))
+		c.Assert(result.Msg.Offset, Equals, offsetsBefore[0]+int64(i))
+	}
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+	c.Assert(offsetsAfter[0], Equals, offsetsBefore[0]+3)
+
+	// Cleanup
+	p.Stop()
+}
+
+// A message produced to an explicitly specified partition ends up there
+// regardless of the key hash.
+func (s *ProducerSuite) TestProduceToPartition(c *C) {
+	p, _ := Spawn(s.ns, s.cfg)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	prodMsg, err := p.ProduceToPartition("test.4", 3, sarama.StringEncoder("1"), sarama.StringEncoder("Foo"), 0)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(prodMsg.Partition, Equals, int32(3))
+	c.Assert(prodMsg.Offset, Equals, offsetsBefore[3])
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+	c.Assert(offsetsAfter[0], Equals, offsetsBefore[0])
+	c.Assert(offsetsAfter[3], Equals, offsetsBefore[3]+1)
+
+	// Cleanup
+	p.Stop()
+}
+
+func (s *ProducerSuite) TestProduceToPartitionInvalid(c *C) {
+	p, _ := Spawn(s.ns, s.cfg)
+
+	// When
+	_, err := p.ProduceToPartition("test.4", 4, sarama.StringEncoder("1"), sarama.StringEncoder("Foo"), 0)
+
+	// Then
+	c.Assert(err, Equals, sarama.ErrInvalidPartition)
+
+	// Cleanup
+	p.Stop()
+}
+
 func (s *ProducerSuite) TestProduceInvalidTopic(c *C) {
 	p, _ := Spawn(s.ns, s.cfg)
 
@@ -131,6 +194,32 @@ func (s *ProducerSuite) TestAsyncProduceNilKey(c *C) {
 	}
 }
 
+// If sticky partitioning is enabled, then messages with a `nil` key produced
+// in a quick succession all go to the same partition.
+func (s *ProducerSuite) TestAsyncProduceNilKeySticky(c *C) {
+	s.cfg.Producer.StickyPartitioning = true
+	p, _ := Spawn(s.ns, s.cfg)
+	p.testDroppedMsgCh = s.droppedMsgCh
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	for i := 0; i < 100; i++ {
+		p.AsyncProduce("test.4", nil, sarama.StringEncoder(strconv.Itoa(i)))
+	}
+	p.Stop()
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+
+	// Then
+	c.Assert(s.failedMessages(), DeepEquals, []string{})
+	deltas := []int64{}
+	for i := 0; i < 4; i++ {
+		if delta := offsetsAfter[i] - offsetsBefore[i]; delta != 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	c.Assert(deltas, DeepEquals, []int64{100})
+}
+
 // Even though wrapped `sarama.Producer` is instructed to stop immediately on
 // client stop due to `ShutdownTimeout == 0`, still none of messages is lost.
 // because none of them are retries. This test is mostly to increase coverage.
@@ -192,3 +281,171 @@ func (s *ProducerSuite) failedMessages() []string {
 done:
 	return b
 }
+
+var _ = Suite(&MessageReprSuite{})
+
+type MessageReprSuite struct{}
+
+// Keys and values of the topics configured for redaction are replaced with
+// their keyed hashes.
+func (s *MessageReprSuite) TestRedaction(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Redaction.Topics = map[string][]string{"foo": {"key", "value"}, "bar": {"value"}}
+	cfg.Redaction.HashKey = "s4lt"
+	redactor, err := redaction.New(cfg)
+	c.Assert(err, IsNil)
+	p := &T{redactor: redactor}
+	for i, tc := range []struct {
+		topic string
+		repr  string
+	}{
+		/* 0 */ {"foo", `{Topic: "foo", Key: "hmac-sha256:e783caa0abc14279da74bf59685cd6ebd421843f860bc6dcf8462c2a52ecd207", Value: "hmac-sha256:36c93037ff4a622472ee3e51952c5a118d2746bcab8a85f20c5e0e438f09ae18"}`},
+		/* 1 */ {"bar", `{Topic: "bar", Key: "foo", Value: "hmac-sha256:36c93037ff4a622472ee3e51952c5a118d2746bcab8a85f20c5e0e438f09ae18"}`},
+		/* 2 */ {"bazz", `{Topic: "bazz", Key: "foo", Value: "bar"}`},
+	} {
+		prodMsg := &sarama.ProducerMessage{
+			Topic: tc.topic,
+			Key:   sarama.StringEncoder("foo"),
+			Value: sarama.StringEncoder("bar"),
+		}
+		c.Assert(p.messageRepr(prodMsg), Equals, tc.repr, Commentf("case #%d", i))
+	}
+}
+
+var _ = Suite(&RetrySuite{})
+
+type RetrySuite struct {
+	p *T
+}
+
+func (s *RetrySuite) SetUpTest(c *C) {
+	redactor, err := redaction.New(config.DefaultProxy())
+	c.Assert(err, IsNil)
+	s.p = &T{
+		dispatcherActorID: actor.RootID.NewChild("T"),
+		redactor:          redactor,
+		errStats:          errStats{counts: make(map[string]int64)},
+		retryCfg: retryConfig{
+			backoff:      time.Millisecond,
+			maxResubmits: 2,
+			resubmit:     map[string]bool{ErrNameNotLeaderForPartition: true},
+		},
+		resubmitCh:   make(chan produceResult, 1),
+		resubmits:    make(map[*sarama.ProducerMessage]int),
+		resubmitting: make(map[*sarama.ProducerMessage]*resubmission),
+	}
+}
+
+// Messages that failed with an error configured to be resubmitted are
+// resubmitted at most `maxResubmits` times.
+func (s *RetrySuite) TestResubmit(c *C) {
+	prodMsg := &sarama.ProducerMessage{Topic: "foo", Value: sarama.StringEncoder("bar")}
+	result := produceResult{Msg: prodMsg, Err: sarama.ErrNotLeaderForPartition}
+
+	// When/Then
+	for i := 0; i < 2; i++ {
+		c.Assert(s.p.scheduleResubmit(result), Equals, true, Commentf("attempt #%d", i))
+		c.Assert(<-s.p.resubmitCh, DeepEquals, result)
+	}
+	c.Assert(s.p.scheduleResubmit(result), Equals, false)
+	c.Assert(len(s.p.resubmits), Equals, 0)
+}
+
+// Messages that failed with other errors are not resubmitted.
+func (s *RetrySuite) TestNoResubmit(c *C) {
+	prodMsg := &sarama.ProducerMessage{Topic: "foo", Value: sarama.StringEncoder("bar")}
+
+	// When/Then
+	c.Assert(s.p.scheduleResubmit(produceResult{Msg: prodMsg, Err: sarama.ErrMessageSizeTooLarge}), Equals, false)
+	c.Assert(s.p.scheduleResubmit(produceResult{Msg: prodMsg}), Equals, false)
+	c.Assert(len(s.p.resubmitting), Equals, 0)
+}
+
+// Messages that failed are counted by error name.
+func (s *RetrySuite) TestErrorCounts(c *C) {
+	prodMsg := &sarama.ProducerMessage{Topic: "foo", Value: sarama.StringEncoder("bar")}
+
+	// When
+	s.p.handleProduceResult(produceResult{Msg: prodMsg, Err: sarama.ErrNotLeaderForPartition})
+	s.p.handleProduceResult(produceResult{Msg: prodMsg, Err: sarama.ErrMessageSizeTooLarge})
+	s.p.handleProduceResult(produceResult{Msg: prodMsg, Err: sarama.ErrMessageTooLarge})
+	s.p.handleProduceResult(produceResult{Msg: prodMsg, Err: fmt.Errorf("foo")})
+	s.p.handleProduceResult(produceResult{Msg: prodMsg})
+
+	// Then
+	c.Assert(s.p.ErrorCounts(), DeepEquals, map[string]int64{
+		ErrNameNotLeaderForPartition: 1,
+		ErrNameMessageTooLarge:       2,
+		ErrNameOther:                 1,
+	})
+}
+
+var _ = Suite(&StickyPartitionerSuite{})
+
+type StickyPartitionerSuite struct {
+	now time.Time
+	sp  *stickyPartitioner
+}
+
+func (s *StickyPartitionerSuite) SetUpTest(c *C) {
+	s.now = time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	s.sp = newStickyPartitioner(10, time.Second)
+	s.sp.now = func() time.Time { return s.now }
+}
+
+// Messages stick to one partition until a batch worth of bytes is placed to
+// it, and then another partition is picked.
+func (s *StickyPartitionerSuite) TestBatchBytes(c *C) {
+	msg := &sarama.ProducerMessage{Value: sarama.StringEncoder("1234")}
+	first := s.sp.partition(msg, 4)
+
+	// When/Then
+	c.Assert(s.sp.partition(msg, 4), Equals, first)
+	c.Assert(s.sp.partition(msg, 4), Equals, first)
+	c.Assert(s.sp.partition(msg, 4), Not(Equals), first)
+}
+
+// Messages stick to one partition until the batch is old enough to be
+// flushed, and then another partition is picked.
+func (s *StickyPartitionerSuite) TestBatchAge(c *C) {
+	msg := &sarama.ProducerMessage{Value: sarama.StringEncoder("1")}
+	first := s.sp.partition(msg, 4)
+
+	// When/Then
+	s.now = s.now.Add(999 * time.Millisecond)
+	c.Assert(s.sp.partition(msg, 4), Equals, first)
+	s.now = s.now.Add(time.Millisecond)
+	c.Assert(s.sp.partition(msg, 4), Not(Equals), first)
+}
+
+// Switching partitions never picks the current one, unless there is only one,
+// and a partition that no longer exists is never returned.
+func (s *StickyPartitionerSuite) TestNext(c *C) {
+	for i := 0; i < 100; i++ {
+		s.sp.current = int32(i % 4)
+		c.Assert(s.sp.next(4), Not(Equals), s.sp.current)
+	}
+	s.sp.current = 0
+	c.Assert(s.sp.next(1), Equals, int32(0))
+	s.sp.current = 3
+	c.Assert(s.sp.next(2) < 2, Equals, true)
+}
+
+// Messages with a key, or with an explicit partition, are not affected by
+// sticky partitioning.
+func (s *StickyPartitionerSuite) TestPartitioner(c *C) {
+	p := newPartitioner("foo", true)
+	keyed := &sarama.ProducerMessage{Key: sarama.StringEncoder(""), Partition: AnyPartition}
+	explicit := &sarama.ProducerMessage{Partition: 2}
+
+	// When/Then
+	for i := 0; i < 10; i++ {
+		partition, err := p.Partition(keyed, 4)
+		c.Assert(err, IsNil)
+		c.Assert(partition, Equals, int32(3))
+		partition, err = p.Partition(explicit, 4)
+		c.Assert(err, IsNil)
+		c.Assert(partition, Equals, int32(2))
+	}
+	c.Assert(p.(*partitioner).sticky.current, Equals, int32(-1))
+}
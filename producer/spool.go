@@ -0,0 +1,86 @@
+package producer
+
+import (
+	"encoding/json"
+	"os"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/log"
+)
+
+// SpooledMessage is a message that the producer failed to submit because it
+// was shutting down, as it is written to the shutdown spool file, one JSON
+// document per line.
+type SpooledMessage struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Error     string `json:"error"`
+}
+
+// spool appends messages to a file, that is created on the first write.
+// It is only accessed by the dispatcher goroutine, except for the count.
+type spool struct {
+	actorID *actor.ID
+	path    string
+	file    *os.File
+	count   int64
+}
+
+func newSpool(actorID *actor.ID, path string) *spool {
+	return &spool{actorID: actorID, path: path}
+}
+
+// write appends a failed message to the spool file. If the message cannot be
+// written, then the error is logged and the message is lost.
+func (s *spool) write(msg *sarama.ProducerMessage, err error) {
+	if s.file == nil {
+		file, openErr := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if openErr != nil {
+			log.Errorf("<%v> failed to open spool: path=%s, err=(%s)", s.actorID, s.path, openErr)
+			return
+		}
+		s.file = file
+	}
+	spooled := SpooledMessage{Topic: msg.Topic, Partition: msg.Partition, Error: err.Error()}
+	var encodeErr error
+	if msg.Key != nil {
+		if spooled.Key, encodeErr = msg.Key.Encode(); encodeErr != nil {
+			log.Errorf("<%v> failed to encode spooled key: err=(%s)", s.actorID, encodeErr)
+			return
+		}
+	}
+	if msg.Value != nil {
+		if spooled.Value, encodeErr = msg.Value.Encode(); encodeErr != nil {
+			log.Errorf("<%v> failed to encode spooled value: err=(%s)", s.actorID, encodeErr)
+			return
+		}
+	}
+	line, _ := json.Marshal(spooled)
+	// The line is written at once, so that lines spooled by producers of
+	// several proxies to the same file do not interleave.
+	if _, writeErr := s.file.Write(append(line, '\n')); writeErr != nil {
+		log.Errorf("<%v> failed to write spool: path=%s, err=(%s)", s.actorID, s.path, writeErr)
+		return
+	}
+	atomic.AddInt64(&s.count, 1)
+}
+
+// close closes the spool file if it has been opened.
+func (s *spool) close() {
+	if s.file == nil {
+		return
+	}
+	if err := s.file.Close(); err != nil {
+		log.Errorf("<%v> failed to close spool: path=%s, err=(%s)", s.actorID, s.path, err)
+	}
+	s.file = nil
+}
+
+// spooled returns the number of messages written to the spool.
+func (s *spool) spooled() int64 {
+	return atomic.LoadInt64(&s.count)
+}
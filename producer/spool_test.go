@@ -0,0 +1,72 @@
+package producer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SpoolSuite{})
+
+type SpoolSuite struct {
+	dir string
+}
+
+func (s *SpoolSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// Failed messages are appended to the spool file as JSON lines.
+func (s *SpoolSuite) TestWrite(c *C) {
+	path := filepath.Join(s.dir, "spool.jsonl")
+	c.Assert(ioutil.WriteFile(path, []byte("{}\n"), 0600), IsNil)
+	sp := newSpool(actor.RootID.NewChild("T"), path)
+
+	// When
+	sp.write(&sarama.ProducerMessage{
+		Topic: "foo", Partition: 3, Key: sarama.StringEncoder("bar"), Value: sarama.StringEncoder("bazz"),
+	}, sarama.ErrShuttingDown)
+	sp.write(&sarama.ProducerMessage{
+		Topic: "foo", Partition: 1, Value: sarama.ByteEncoder{1, 2},
+	}, sarama.ErrNotLeaderForPartition)
+	sp.close()
+
+	// Then
+	c.Assert(sp.spooled(), Equals, int64(2))
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	c.Assert(len(lines), Equals, 3)
+	var spooled []SpooledMessage
+	for _, line := range lines[1:] {
+		var msg SpooledMessage
+		c.Assert(json.Unmarshal([]byte(line), &msg), IsNil)
+		spooled = append(spooled, msg)
+	}
+	c.Assert(spooled, DeepEquals, []SpooledMessage{
+		{Topic: "foo", Partition: 3, Key: []byte("bar"), Value: []byte("bazz"), Error: sarama.ErrShuttingDown.Error()},
+		{Topic: "foo", Partition: 1, Value: []byte{1, 2}, Error: sarama.ErrNotLeaderForPartition.Error()},
+	})
+}
+
+// If the spool file cannot be opened, then messages are not counted as
+// spooled.
+func (s *SpoolSuite) TestOpenError(c *C) {
+	path := filepath.Join(s.dir, "missing", "spool.jsonl")
+	sp := newSpool(actor.RootID.NewChild("T"), path)
+
+	// When
+	sp.write(&sarama.ProducerMessage{Topic: "foo", Value: sarama.StringEncoder("bar")}, sarama.ErrShuttingDown)
+	sp.close()
+
+	// Then
+	c.Assert(sp.spooled(), Equals, int64(0))
+	_, err := os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
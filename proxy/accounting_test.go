@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/accounting"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AccountingSuite{})
+
+type AccountingSuite struct {
+	cons *mockConsumer
+	p    *T
+}
+
+func (s *AccountingSuite) SetUpTest(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Accounting.Enabled = true
+	s.cons = &mockConsumer{messages: make(map[string][]consumer.Message)}
+	s.p = &T{
+		name:        "default",
+		cfg:         cfg,
+		cons:        s.cons,
+		acc:         accounting.Spawn(actor.RootID.NewChild("T"), cfg, nil),
+		sw:          newTopicSwitches(cfg),
+		eventsChMap: make(map[eventsChID]chan<- consumer.Event),
+		shadows:     make(map[shadowID]*shadowMirror),
+	}
+}
+
+func (s *AccountingSuite) TearDownTest(c *C) {
+	s.p.acc.Stop()
+}
+
+// Messages skipped by a key filter are not accounted.
+func (s *AccountingSuite) TestFilteredNotAccounted(c *C) {
+	s.cons.add("foo", "a", "bb", "ccc")
+
+	// When
+	msg, err := s.p.ConsumeFiltered("t1", "", "g1", "foo", NoAck(), &KeyFilter{Key: []byte("bb")}, time.Second, 0)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(string(msg.Key), Equals, "bb")
+	assertConsumed(c, s.p, "t1", "foo", 1, 2)
+}
+
+// Messages fetched from topics that lose the race are nacked and not
+// accounted, only the returned one is.
+func (s *AccountingSuite) TestLosersNotAccounted(c *C) {
+	s.cons.skipBatchFill = true
+	s.cons.add("foo", "aa")
+	s.cons.add("bar", "bb")
+
+	// When
+	msg, err := s.p.ConsumeTopics("t1", "", "g1", []string{"foo", "bar"}, NoAck(), time.Second, 0)
+
+	// Then
+	c.Assert(err, IsNil)
+	assertConsumed(c, s.p, "t1", msg.Topic, 1, 2)
+}
+
+func assertConsumed(c *C, p *T, tenant, topic string, messages, bytes int64) {
+	usage, err := p.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(len(usage), Equals, 1)
+	c.Assert(usage[0].Tenant, Equals, tenant)
+	c.Assert(usage[0].Topic, Equals, topic)
+	c.Assert(usage[0].ConsumedMessages, Equals, messages)
+	c.Assert(usage[0].ConsumedBytes, Equals, bytes)
+}
+
+// mockConsumer returns preset messages of topics one by one, and a long
+// polling timeout error when a topic has no messages left.
+type mockConsumer struct {
+	consumer.T
+	mu       sync.Mutex
+	messages map[string][]consumer.Message
+
+	// If true then requests made to fill batches fail as if no messages were
+	// readily available.
+	skipBatchFill bool
+}
+
+func (mc *mockConsumer) add(topic string, keys ...string) {
+	for i, key := range keys {
+		mc.messages[topic] = append(mc.messages[topic], consumer.Message{
+			Topic:    topic,
+			Offset:   int64(i),
+			Key:      []byte(key),
+			EventsCh: make(chan consumer.Event, 2),
+		})
+	}
+}
+
+// implements `consumer.T`.
+func (mc *mockConsumer) ConsumeWithTimeout(client, group, topic string, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	msgs := mc.messages[topic]
+	if len(msgs) == 0 || (mc.skipBatchFill && timeout == batchFillTimeout) {
+		return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "long polling timeout")
+	}
+	mc.messages[topic] = msgs[1:]
+	return msgs[0], nil
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ConsumeFirstSuite{})
+
+type ConsumeFirstSuite struct{}
+
+// Messages fetched by requests that lose the race are nacked without a delay,
+// even if they are fetched after the winner has been returned.
+func (s *ConsumeFirstSuite) TestLosersNacked(c *C) {
+	p := &T{}
+	eventsChs := []chan consumer.Event{make(chan consumer.Event, 1), make(chan consumer.Event, 1)}
+	releaseCh := make(chan struct{})
+
+	// When
+	idx, msg, err := p.consumeFirst(3, func(i int) (consumer.Message, error) {
+		switch i {
+		case 0:
+			return consumer.Message{Offset: 10, EventsCh: eventsChs[0]}, nil
+		case 1:
+			<-releaseCh
+			return consumer.Message{Offset: 20, EventsCh: eventsChs[1]}, nil
+		default:
+			<-releaseCh
+			return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "long polling timeout")
+		}
+	})
+	close(releaseCh)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(idx, Equals, 0)
+	c.Assert(msg.Offset, Equals, int64(10))
+	select {
+	case event := <-eventsChs[1]:
+		c.Assert(event, Equals, consumer.Nack(20, 0))
+	case <-time.After(3 * time.Second):
+		c.Fatal("the losing message is not nacked")
+	}
+	c.Assert(len(eventsChs[0]), Equals, 0)
+}
+
+// If all requests fail, then the error of the first one is returned.
+func (s *ConsumeFirstSuite) TestAllFailed(c *C) {
+	p := &T{}
+
+	// When
+	_, _, err := p.consumeFirst(2, func(i int) (consumer.Message, error) {
+		return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "request %d", i)
+	})
+
+	// Then
+	c.Assert(err.Error(), Equals, "request 0")
+}
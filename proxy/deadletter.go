@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/producer"
+)
+
+// deadLetterProducer produces dead letters of consumer groups with the proxy
+// producer. A dead letter is a JSON document that carries the failed message
+// along with the failure details, for the Kafka client does not support
+// message headers. It is keyed by the failed message key, so that dead
+// letters of messages with the same key stay in order.
+//
+// implements `config.DeadLetterProducer`.
+type deadLetterProducer struct {
+	prod *producer.T
+}
+
+// implements `config.DeadLetterProducer`.
+func (dlp deadLetterProducer) ProduceDeadLetter(topic string, dl config.DeadLetter, done func(error)) {
+	encoded, err := json.Marshal(dl)
+	if err != nil {
+		done(err)
+		return
+	}
+	var key sarama.Encoder
+	if dl.Key != nil {
+		key = sarama.ByteEncoder(dl.Key)
+	}
+	dlp.prod.AsyncProduceNotify(topic, key, sarama.ByteEncoder(encoded), func(_ *sarama.ProducerMessage, err error) {
+		done(err)
+	})
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/log"
+)
+
+// enrichmentErrorField is the name of the field that carries an error
+// returned by an enricher.
+const enrichmentErrorField = "enrichment_error"
+
+// checkEnrichers makes sure that all enrichers configured globally and for
+// individual topics are registered.
+func checkEnrichers(cfg *config.Proxy) error {
+	names := append([]string(nil), cfg.Consumer.Enrichers...)
+	for _, topicCfg := range cfg.Consumer.Topics {
+		if topicCfg != nil {
+			names = append(names, topicCfg.Enrichers...)
+		}
+	}
+	for _, name := range names {
+		if _, err := config.GetEnricher(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enrich applies enrichers configured for the topic of a message to it, see
+// `config.Enricher`. If an enricher fails, then the message is returned as
+// enriched by the preceding ones with the error in the `enrichment_error`
+// field. Error texts are logged via the redactor, for they may quote fragments
+// of the message.
+func (p *T) enrich(msg consumer.Message) consumer.Message {
+	names := p.cfg.ConsumerEnrichers(msg.Topic)
+	if len(names) == 0 {
+		return msg
+	}
+	enriched := config.EnrichedMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Fields:    make(map[string]interface{}),
+	}
+	for _, name := range names {
+		enricher, err := config.GetEnricher(name)
+		if err == nil {
+			err = enricher.Enrich(&enriched)
+		}
+		if err != nil {
+			log.Errorf("<%s> enrichment failed: enricher=%s, topic=%s, partition=%d, offset=%d, err=(%s)",
+				p.actorID, name, msg.Topic, msg.Partition, msg.Offset, p.red.Error(msg.Topic, err))
+			enriched.Fields[enrichmentErrorField] = err.Error()
+			break
+		}
+	}
+	msg.Key, msg.Value = enriched.Key, enriched.Value
+	if len(enriched.Fields) != 0 {
+		msg.Fields = enriched.Fields
+	}
+	return msg
+}
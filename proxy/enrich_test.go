@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/redaction"
+	"github.com/mailgun/kafka-pixy/testhelpers"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&EnrichSuite{})
+
+type EnrichSuite struct{}
+
+func (s *EnrichSuite) TearDownTest(c *C) {
+	config.RegisterEnricher("upper", nil)
+	config.RegisterEnricher("failing", nil)
+	config.RegisterEnricher("quoting", nil)
+}
+
+type upperEnricher struct{}
+
+func (upperEnricher) Enrich(msg *config.EnrichedMessage) error {
+	msg.Value = append([]byte("UPPER:"), msg.Value...)
+	msg.Fields["upper"] = true
+	return nil
+}
+
+type failingEnricher struct{}
+
+func (failingEnricher) Enrich(msg *config.EnrichedMessage) error {
+	return errors.New("kaboom")
+}
+
+type quotingEnricher struct{}
+
+func (quotingEnricher) Enrich(msg *config.EnrichedMessage) error {
+	return fmt.Errorf("invalid value: %s", msg.Value)
+}
+
+// Enrichers configured for a topic override global ones, and are applied in
+// order. If one fails, the error is reported in a field and the rest are
+// skipped.
+func (s *EnrichSuite) TestEnrich(c *C) {
+	config.RegisterEnricher("upper", upperEnricher{})
+	config.RegisterEnricher("failing", failingEnricher{})
+	cfg := config.DefaultProxy()
+	cfg.Consumer.Enrichers = []string{"upper"}
+	cfg.Consumer.Topics = map[string]*config.ConsumerTopic{
+		"bar": {Enrichers: []string{"upper", "failing", "upper"}},
+	}
+	c.Assert(checkEnrichers(cfg), IsNil)
+	p := &T{actorID: actor.RootID.NewChild("T"), cfg: cfg, red: newRedactor(c, cfg)}
+
+	// When
+	foo := p.enrich(consumer.Message{Topic: "foo", Value: []byte("1")})
+	bar := p.enrich(consumer.Message{Topic: "bar", Value: []byte("2")})
+
+	// Then
+	c.Assert(string(foo.Value), Equals, "UPPER:1")
+	c.Assert(foo.Fields, DeepEquals, map[string]interface{}{"upper": true})
+	c.Assert(string(bar.Value), Equals, "UPPER:2")
+	c.Assert(bar.Fields, DeepEquals, map[string]interface{}{"upper": true, "enrichment_error": "kaboom"})
+}
+
+// Enrichment errors of topics with redacted fields are logged as hashes, for
+// they may quote the messages.
+func (s *EnrichSuite) TestErrorRedacted(c *C) {
+	config.RegisterEnricher("quoting", quotingEnricher{})
+	cfg := config.DefaultProxy()
+	cfg.Consumer.Enrichers = []string{"quoting"}
+	cfg.Redaction.Topics = map[string][]string{"foo": {config.RedactValue}}
+	p := &T{actorID: actor.RootID.NewChild("T"), cfg: cfg, red: newRedactor(c, cfg)}
+	stopCapture := testhelpers.CaptureLogs()
+
+	// When
+	foo := p.enrich(consumer.Message{Topic: "foo", Value: []byte("s3cr3t")})
+	bar := p.enrich(consumer.Message{Topic: "bar", Value: []byte("0p3n")})
+
+	// Then
+	logs := stopCapture()
+	c.Assert(foo.Fields, DeepEquals, map[string]interface{}{"enrichment_error": "invalid value: s3cr3t"})
+	c.Assert(bar.Fields, DeepEquals, map[string]interface{}{"enrichment_error": "invalid value: 0p3n"})
+	c.Assert(strings.Contains(logs, "s3cr3t"), Equals, false, Commentf("%s", logs))
+	c.Assert(strings.Contains(logs, p.red.Hash([]byte("invalid value: s3cr3t"))), Equals, true, Commentf("%s", logs))
+	c.Assert(strings.Contains(logs, "invalid value: 0p3n"), Equals, true, Commentf("%s", logs))
+}
+
+// Messages of topics without enrichers are returned as is.
+func (s *EnrichSuite) TestNoEnrichers(c *C) {
+	p := &T{actorID: actor.RootID.NewChild("T"), cfg: config.DefaultProxy()}
+
+	// When
+	msg := p.enrich(consumer.Message{Topic: "foo", Value: []byte("1")})
+
+	// Then
+	c.Assert(string(msg.Value), Equals, "1")
+	c.Assert(msg.Fields, IsNil)
+}
+
+// Unknown enrichers are reported.
+func (s *EnrichSuite) TestCheckUnknown(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.Topics = map[string]*config.ConsumerTopic{
+		"bar": {Enrichers: []string{config.EnricherDeadLetter, "upper"}},
+	}
+
+	// When
+	err := checkEnrichers(cfg)
+
+	// Then
+	c.Assert(err, ErrorMatches, "unknown enricher: upper")
+}
+
+func newRedactor(c *C, cfg *config.Proxy) *redaction.T {
+	red, err := redaction.New(cfg)
+	c.Assert(err, IsNil)
+	return red
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+)
+
+// failover periodically checks health of the primary Kafka cluster and
+// decides whether produce traffic should be sent to the standby cluster.
+type failover struct {
+	actorID *actor.ID
+	cfg     *config.Proxy
+	stopCh  chan none.T
+	wg      sync.WaitGroup
+
+	// Checks health of the primary cluster. It is a field to be replaced
+	// in tests.
+	checkHealth func() error
+	kafkaClt    sarama.Client
+
+	mu           sync.Mutex
+	onStandby    bool
+	failingSince time.Time
+	healthySince time.Time
+}
+
+func spawnFailover(namespace *actor.ID, cfg *config.Proxy) *failover {
+	f := newFailover(namespace, cfg)
+	f.checkHealth = f.checkPrimaryHealth
+	actor.Spawn(f.actorID, &f.wg, f.run)
+	return f
+}
+
+func newFailover(namespace *actor.ID, cfg *config.Proxy) *failover {
+	return &failover{
+		actorID: namespace.NewChild("failover"),
+		cfg:     cfg,
+		stopCh:  make(chan none.T),
+	}
+}
+
+func (f *failover) stop() {
+	close(f.stopCh)
+	f.wg.Wait()
+}
+
+// useStandby tells whether produce traffic should go to the standby cluster.
+func (f *failover) useStandby() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.onStandby
+}
+
+func (f *failover) run() {
+	defer func() {
+		if f.kafkaClt != nil {
+			f.kafkaClt.Close()
+		}
+	}()
+	ticker := time.NewTicker(f.cfg.Failover.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.onHealthCheck(f.checkHealth(), time.Now())
+		case <-f.stopCh:
+			return
+		}
+	}
+}
+
+// onHealthCheck updates the failover state with a result of a primary
+// cluster health check.
+func (f *failover) onHealthCheck(err error, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.healthySince = time.Time{}
+		if f.failingSince.IsZero() {
+			log.Warningf("<%s> primary cluster is failing: err=(%s)", f.actorID, err)
+			f.failingSince = now
+		}
+		if !f.onStandby && now.Sub(f.failingSince) >= f.cfg.Failover.FailoverAfter {
+			log.Errorf("<%s> switched produce traffic to standby cluster: failingFor=%s",
+				f.actorID, now.Sub(f.failingSince))
+			f.onStandby = true
+		}
+		return
+	}
+	f.failingSince = time.Time{}
+	if f.healthySince.IsZero() {
+		f.healthySince = now
+	}
+	if f.onStandby && f.cfg.Failover.FailbackAfter > 0 && now.Sub(f.healthySince) >= f.cfg.Failover.FailbackAfter {
+		log.Warningf("<%s> switched produce traffic back to primary cluster: healthyFor=%s",
+			f.actorID, now.Sub(f.healthySince))
+		f.onStandby = false
+	}
+}
+
+// checkPrimaryHealth succeeds if metadata can be retrieved from the primary
+// cluster.
+func (f *failover) checkPrimaryHealth() error {
+	if f.kafkaClt == nil {
+		saramaCfg := sarama.NewConfig()
+		saramaCfg.ClientID = f.cfg.KafkaClientID("_failover")
+		saramaCfg.Metadata.Retry.Max = 0
+		kafkaClt, err := sarama.NewClient(f.cfg.Kafka.SeedPeers, saramaCfg)
+		if err != nil {
+			return err
+		}
+		f.kafkaClt = kafkaClt
+		return nil
+	}
+	return f.kafkaClt.RefreshMetadata()
+}
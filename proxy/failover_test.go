@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/pkg/errors"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&FailoverSuite{})
+
+type FailoverSuite struct {
+	cfg   *config.Proxy
+	begin time.Time
+}
+
+func (s *FailoverSuite) SetUpTest(c *C) {
+	s.cfg = config.DefaultProxy()
+	s.cfg.Failover.StandbySeedPeers = []string{"standby:9092"}
+	s.cfg.Failover.FailoverAfter = 30 * time.Second
+	s.begin = time.Date(2016, 11, 3, 10, 0, 0, 0, time.UTC)
+}
+
+// Traffic is switched to standby only after the primary has been failing for
+// `FailoverAfter`, and stays there if fail back is not configured.
+func (s *FailoverSuite) TestFailoverSticky(c *C) {
+	f := newFailover(actor.RootID.NewChild("T"), s.cfg)
+	failure := errors.New("kaboom")
+
+	for i, tc := range []struct {
+		at         time.Duration
+		err        error
+		useStandby bool
+	}{
+		/* 0 */ {0, nil, false},
+		/* 1 */ {5 * time.Second, failure, false},
+		/* 2 */ {30 * time.Second, failure, false},
+		//        A successful check resets the failure period.
+		/* 3 */ {35 * time.Second, nil, false},
+		/* 4 */ {40 * time.Second, failure, false},
+		/* 5 */ {65 * time.Second, failure, false},
+		/* 6 */ {70 * time.Second, failure, true},
+		/* 7 */ {75 * time.Second, nil, true},
+		/* 8 */ {24 * time.Hour, nil, true},
+	} {
+		f.onHealthCheck(tc.err, s.begin.Add(tc.at))
+		c.Assert(f.useStandby(), Equals, tc.useStandby, Commentf("case #%d", i))
+	}
+}
+
+// If fail back is configured, then traffic is switched back to the primary
+// after it has been healthy for `FailbackAfter`.
+func (s *FailoverSuite) TestFailback(c *C) {
+	s.cfg.Failover.FailbackAfter = time.Minute
+	f := newFailover(actor.RootID.NewChild("T"), s.cfg)
+	failure := errors.New("kaboom")
+
+	for i, tc := range []struct {
+		at         time.Duration
+		err        error
+		useStandby bool
+	}{
+		/* 0 */ {0, failure, false},
+		/* 1 */ {30 * time.Second, failure, true},
+		/* 2 */ {40 * time.Second, nil, true},
+		/* 3 */ {90 * time.Second, nil, true},
+		//        A failed check resets the healthy period.
+		/* 4 */ {95 * time.Second, failure, true},
+		/* 5 */ {100 * time.Second, nil, true},
+		/* 6 */ {160 * time.Second, nil, false},
+	} {
+		f.onHealthCheck(tc.err, s.begin.Add(tc.at))
+		c.Assert(f.useStandby(), Equals, tc.useStandby, Commentf("case #%d", i))
+	}
+}
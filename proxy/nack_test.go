@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&NackSuite{})
+
+type NackSuite struct{}
+
+// A nack is sent to the partition consumer as an event with the delay.
+func (s *NackSuite) TestNack(c *C) {
+	cfg := config.DefaultProxy()
+	eventsCh := make(chan consumer.Event, 1)
+	p := &T{cfg: cfg, eventsChMap: map[eventsChID]chan<- consumer.Event{{"g1", "foo", 3}: eventsCh}}
+	ack, err := Ack(3, 42)
+	c.Assert(err, IsNil)
+
+	// When
+	err = p.Nack("g1", "foo", ack, time.Second)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(<-eventsCh, Equals, consumer.Nack(42, time.Second))
+	c.Assert(p.Nack("g1", "bar", ack, 0), Equals, ErrNotConsumed)
+}
+
+// The nack delay cannot be negative or exceed the ack timeout.
+func (s *NackSuite) TestNackInvalidDelay(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Consumer.AckTimeout = 5 * time.Second
+	p := &T{cfg: cfg, eventsChMap: make(map[eventsChID]chan<- consumer.Event)}
+	ack, err := Ack(3, 42)
+	c.Assert(err, IsNil)
+
+	for i, delay := range []time.Duration{-time.Second, 5*time.Second + 1} {
+		// When
+		err := p.Nack("g1", "foo", ack, delay)
+
+		// Then
+		c.Assert(errs.Is(err, errs.ErrInvalidParam), Equals, true, Commentf("case #%d", i))
+		c.Assert(err.Error(), Equals, "nack delay must be within [0, 5s]", Commentf("case #%d", i))
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
+)
+
+// Kind of query that the list of topic names is cached for, see
+// `T.topicNames`.
+const queryTopicNames = "topic_names"
+
+// CompileTopicPattern compiles a topic pattern, that is a regular expression
+// that topic names must match entirely, e.g. `orders\..*`.
+func CompileTopicPattern(pattern string) (*regexp.Regexp, error) {
+	// The pattern is checked on its own, so that errors refer to it rather
+	// than to the anchored expression.
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, errs.Wrap(errs.ErrInvalidParam, err, "invalid topic pattern")
+	}
+	return regexp.MustCompile("^(?:" + pattern + ")$"), nil
+}
+
+// ConsumePattern consumes a message on behalf of the group from whichever
+// topic matching the pattern has one available first. Topics are matched
+// against the list of topics of the cluster, that is refreshed at most every
+// `Config.Consumer.TopicPatternRefresh`, so topics created later get consumed
+// as soon as they are picked up. The group is subscribed to every matching
+// topic, so partitions of all of them are assigned to group members. Internal
+// Kafka topics, that start with `__`, never match. The topic of the returned
+// message is in `consumer.Message.Topic`.
+//
+// Topics are consumed the same way as by `ConsumeTopics`. If no topic matches
+// the pattern, then the request waits for the long polling timeout as if there
+// were no messages. The `ack` must be either `AutoAck`, optionally with
+// metadata, or `NoAck`. The `tenant`, `client`, `timeout` and
+// `subscriptionTTL` have the same meaning as in `ConsumeWithTimeout`.
+func (p *T) ConsumePattern(tenant, client, group string, pattern *regexp.Regexp, ack ack, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	timeout, err := p.checkMultiTopicConsume(ack, timeout, subscriptionTTL)
+	if err != nil {
+		return consumer.Message{}, err
+	}
+	topics, err := p.matchTopics(pattern)
+	if err != nil {
+		return consumer.Message{}, err
+	}
+	if len(topics) == 0 {
+		time.Sleep(timeout)
+		return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "long polling timeout")
+	}
+	return p.consumeTopics(tenant, client, group, topics, ack, timeout, subscriptionTTL)
+}
+
+// matchTopics returns topics of the cluster that match the pattern ordered by
+// name. The list of topics is cached for `Config.Consumer.TopicPatternRefresh`.
+func (p *T) matchTopics(pattern *regexp.Regexp) ([]string, error) {
+	result, _, err := p.topicNames.get(queryKey{kind: queryTopicNames}, false, func() (interface{}, error) {
+		topicInfos, err := p.adm.GetTopics(false, false)
+		if err != nil {
+			return nil, err
+		}
+		topics := make([]string, len(topicInfos))
+		for i, topicInfo := range topicInfos {
+			topics[i] = topicInfo.Topic
+		}
+		return topics, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, topic := range result.([]string) {
+		if !strings.HasPrefix(topic, "__") && pattern.MatchString(topic) {
+			matched = append(matched, topic)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PatternSuite{})
+
+type PatternSuite struct{}
+
+// Topic names must match a pattern entirely.
+func (s *PatternSuite) TestCompileTopicPattern(c *C) {
+	// When
+	re, err := CompileTopicPattern(`orders\..*|billing`)
+
+	// Then
+	c.Assert(err, IsNil)
+	for i, tc := range []struct {
+		topic   string
+		matches bool
+	}{
+		/* 0 */ {"orders.eu", true},
+		/* 1 */ {"orders.", true},
+		/* 2 */ {"billing", true},
+		/* 3 */ {"orders", false},
+		/* 4 */ {"old.orders.eu", false},
+		/* 5 */ {"billing.eu", false},
+	} {
+		c.Assert(re.MatchString(tc.topic), Equals, tc.matches, Commentf("case #%d", i))
+	}
+}
+
+func (s *PatternSuite) TestCompileTopicPatternInvalid(c *C) {
+	// When
+	_, err := CompileTopicPattern(`orders[`)
+
+	// Then
+	c.Assert(errs.Is(err, errs.ErrInvalidParam), Equals, true)
+	c.Assert(err.Error(), Equals, "invalid topic pattern, err=(error parsing regexp: missing closing ]: `[`)")
+}
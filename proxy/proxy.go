@@ -1,48 +1,92 @@
 package proxy
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/accounting"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/admin"
 	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/consumerimpl"
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/mailgun/kafka-pixy/consumer/offsettrac"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/events"
+	"github.com/mailgun/kafka-pixy/hotpart"
 	"github.com/mailgun/kafka-pixy/producer"
+	"github.com/mailgun/kafka-pixy/redaction"
+	"github.com/mailgun/kafka-pixy/tracing"
 	"github.com/mailgun/log"
 	"github.com/pkg/errors"
 )
 
 const (
 	initEventsChMapCapacity = 256
+
+	// A batch consume request waits for at most this long for every message
+	// in a batch after the first one.
+	batchFillTimeout = 10 * time.Millisecond
 )
 
 var (
 	noAck   = ack{partition: -1}
 	autoAck = ack{partition: -2}
+
+	ErrAccountingDisabled = errors.New("accounting is disabled")
+	ErrTracingDisabled    = errors.New("message tracing is disabled")
+	ErrHotPartsDisabled   = errors.New("hot partition tracking is disabled")
+	ErrTraceNotFound      = errors.New("trace not found")
+	ErrNotConsumed        = errors.New("partition is not consumed via the proxy")
 )
 
 // T implements a proxy to a particular Kafka/ZooKeeper cluster.
 type T struct {
 	actorID *actor.ID
+	name    string
 	cfg     *config.Proxy
 	prod    *producer.T
 	cons    consumer.T
 	adm     *admin.T
+	acc     *accounting.T
+	hot     *hotpart.T
+	vld     *validator
+	red     *redaction.T
+	sw      *topicSwitches
+	tracer  *tracing.T
+	events  *events.T
+	queries *queryCache
+
+	// Topic names that consume requests with topic patterns are matched
+	// against, see `ConsumePattern`, and the number of requests consuming
+	// several topics made so far, see `ConsumeTopics`.
+	topicNames  *queryCache
+	topicSweeps uint32
+
+	// Standby producer and failover are only set if a standby cluster is
+	// configured.
+	standbyProd *producer.T
+	fo          *failover
 
 	// FIXME: We never remove stale elements from eventsChMap. It is sort of ok
 	// FIXME: since the number of group/topic/partition combinations is fairly
 	// FIXME: limited and should not cause any significant system memory usage.
 	eventsChMapMu sync.RWMutex
 	eventsChMap   map[eventsChID]chan<- consumer.Event
+
+	shadowsMu sync.RWMutex
+	shadows   map[shadowID]*shadowMirror
 }
 
 type ack struct {
 	partition int32
 	offset    int64
+	meta      string
 }
 
 // Ack creates an acknowledgement instance from a partition and an offset.
@@ -55,7 +99,7 @@ func Ack(partition int32, offset int64) (ack, error) {
 	if offset < 0 {
 		return ack{}, errors.Errorf("bad offset: %d", offset)
 	}
-	return ack{partition, offset}, nil
+	return ack{partition: partition, offset: offset}, nil
 }
 
 // NoAck returns an ack value that should be passed to proxy.Consume function
@@ -70,6 +114,42 @@ func AutoAck() ack {
 	return autoAck
 }
 
+// WithMeta returns a copy of the ack that makes the committed offset of the
+// acknowledged partition carry the specified metadata. The metadata can be
+// retrieved with `GetGroupOffsets`, see `offsettrac.UserMeta`. It is ignored
+// by `NoAck`.
+func (a ack) WithMeta(meta string) ack {
+	a.meta = meta
+	return a
+}
+
+func (a ack) isNoAck() bool {
+	return a.partition == noAck.partition
+}
+
+func (a ack) isAutoAck() bool {
+	return a.partition == autoAck.partition
+}
+
+// KeyFilter selects messages returned by `ConsumeFiltered` by key.
+type KeyFilter struct {
+	// Key that selected messages have, or start with if Prefix is set.
+	Key    []byte
+	Prefix bool
+}
+
+// Match tells whether a message with the specified key is selected by the
+// filter. Messages without a key are never selected.
+func (kf *KeyFilter) Match(key []byte) bool {
+	if key == nil {
+		return false
+	}
+	if kf.Prefix {
+		return bytes.HasPrefix(key, kf.Key)
+	}
+	return bytes.Equal(key, kf.Key)
+}
+
 type eventsChID struct {
 	group     string
 	topic     string
@@ -80,38 +160,117 @@ type eventsChID struct {
 func Spawn(namespace *actor.ID, name string, cfg *config.Proxy) (*T, error) {
 	p := T{
 		actorID:     namespace.NewChild(name),
+		name:        name,
 		cfg:         cfg,
+		vld:         newValidator(cfg),
+		sw:          newTopicSwitches(cfg),
+		queries:     newQueryCache(cfg.QueryCache.TTL),
+		topicNames:  newQueryCache(cfg.Consumer.TopicPatternRefresh),
 		eventsChMap: make(map[eventsChID]chan<- consumer.Event, initEventsChMapCapacity),
+		shadows:     make(map[shadowID]*shadowMirror),
+	}
+	if err := checkEnrichers(cfg); err != nil {
+		return nil, err
 	}
 	var err error
+	if p.red, err = redaction.New(cfg); err != nil {
+		return nil, err
+	}
 
-	if p.prod, err = producer.Spawn(p.actorID, cfg); err != nil {
+	hookedCfg := cfg
+	deadLetters := cfg.ConsumerDeadLettersEnabled() && cfg.Consumer.DeadLetterProducer == nil
+	if cfg.Tracing.Enabled || cfg.Events.Topic != "" || deadLetters || cfg.HotPartitions.Enabled {
+		cfgCopy := *cfg
+		hookedCfg = &cfgCopy
+	}
+	if cfg.HotPartitions.Enabled {
+		p.hot = hotpart.Spawn(p.actorID, cfg, p.topicPartitions)
+		hookedCfg.Producer.PartitionMeter = p.hot
+	}
+	if p.prod, err = producer.Spawn(p.actorID, hookedCfg); err != nil {
 		return nil, fmt.Errorf("failed to spawn producer, err=(%s)", err)
 	}
-	if p.cons, err = consumerimpl.Spawn(p.actorID, cfg); err != nil {
+	if cfg.Tracing.Enabled {
+		p.tracer = tracing.New(cfg.Tracing.MaxTraces)
+		hookedCfg.Consumer.MessageTracer = p.tracer
+	}
+	if cfg.Events.Topic != "" {
+		p.events = events.Spawn(p.actorID, name, cfg, p.prod)
+		hookedCfg.Consumer.EventListener = p.events
+	}
+	if deadLetters {
+		hookedCfg.Consumer.DeadLetterProducer = deadLetterProducer{p.prod}
+	}
+	if p.cons, err = consumerimpl.Spawn(p.actorID, hookedCfg); err != nil {
 		return nil, fmt.Errorf("failed to spawn consumer, err=(%s)", err)
 	}
 	if p.adm, err = admin.Spawn(p.actorID, cfg); err != nil {
 		return nil, fmt.Errorf("failed to spawn admin, err=(%s)", err)
 	}
+	if len(cfg.Failover.StandbySeedPeers) > 0 {
+		standbyCfg := *cfg
+		standbyCfg.Kafka.SeedPeers = cfg.Failover.StandbySeedPeers
+		if p.standbyProd, err = producer.Spawn(p.actorID.NewChild("standby"), &standbyCfg); err != nil {
+			return nil, fmt.Errorf("failed to spawn standby producer, err=(%s)", err)
+		}
+		p.fo = spawnFailover(p.actorID, cfg)
+	}
+	if cfg.Accounting.Enabled {
+		p.acc = accounting.Spawn(p.actorID, cfg, p.prod)
+	}
 	return &p, nil
 }
 
-// Stop terminates the proxy instances synchronously.
+// Stop terminates the proxy instances synchronously. Time it takes to stop
+// every component is logged, that helps to figure out why a shutdown is slow.
 func (p *T) Stop() {
+	p.stopShadows()
+	// Accounting and events are stopped first to let the final usage export
+	// and buffered events go through the producer.
+	if p.acc != nil {
+		p.stopTimed("accounting", p.acc.Stop)
+	}
+	if p.events != nil {
+		p.stopTimed("events", p.events.Stop)
+	}
+	if p.hot != nil {
+		p.hot.Stop()
+	}
+	if p.fo != nil {
+		p.fo.stop()
+	}
+	// Partition consumers produce dead letters with the producer, so if dead
+	// lettering is enabled then the consumer has to be stopped before the
+	// producer, otherwise a dead letter can be submitted to a stopped one.
+	consStopped := false
+	if p.cons != nil && p.cfg.ConsumerDeadLettersEnabled() {
+		p.stopTimed("consumer", p.cons.Stop)
+		consStopped = true
+	}
 	var wg sync.WaitGroup
 	if p.prod != nil {
-		actor.Spawn(p.actorID.NewChild("producer_stop"), &wg, p.prod.Stop)
+		actor.Spawn(p.actorID.NewChild("producer_stop"), &wg, func() { p.stopTimed("producer", p.prod.Stop) })
+	}
+	if p.standbyProd != nil {
+		actor.Spawn(p.actorID.NewChild("standby_producer_stop"), &wg, func() { p.stopTimed("standby producer", p.standbyProd.Stop) })
 	}
-	if p.cons != nil {
-		actor.Spawn(p.actorID.NewChild("consumer_stop"), &wg, p.cons.Stop)
+	if p.cons != nil && !consStopped {
+		actor.Spawn(p.actorID.NewChild("consumer_stop"), &wg, func() { p.stopTimed("consumer", p.cons.Stop) })
 	}
 	if p.adm != nil {
-		actor.Spawn(p.actorID.NewChild("admin_stop"), &wg, p.adm.Stop)
+		actor.Spawn(p.actorID.NewChild("admin_stop"), &wg, func() { p.stopTimed("admin", p.adm.Stop) })
 	}
 	wg.Wait()
 }
 
+// stopTimed calls the stop function of a proxy component and logs how long it
+// took.
+func (p *T) stopTimed(component string, stop func()) {
+	begin := time.Now()
+	stop()
+	log.Infof("<%s> %s stopped in %s", p.actorID, component, time.Since(begin))
+}
+
 // Produce submits a message to the specified `topic` of the Kafka cluster
 // using `key` to identify a destination partition. The exact algorithm used to
 // map keys to partitions is implementation specific but it is guaranteed that
@@ -119,30 +278,261 @@ func (p *T) Stop() {
 // into a random partition.
 //
 // Errors usually indicate a catastrophic failure of the Kafka cluster, or
-// missing topic if there cluster is not configured to auto create topics.
+// missing topic if there cluster is not configured to auto create topics. If
+// a validation webhook is configured for the topic and it rejects the message,
+// then `ErrRejected` is returned.
 func (p *T) Produce(topic string, key, message sarama.Encoder) (*sarama.ProducerMessage, error) {
-	return p.prod.Produce(topic, key, message)
+	return p.ProduceWithTimeout(topic, key, message, 0)
+}
+
+// ProduceWithTimeout is the same as `Produce` except it waits for at most
+// `timeout` for the message to be committed to Kafka, and returns
+// `producer.ErrTimeout` if it has not been. The timeout is capped by
+// `Config.Producer.MaxSyncTimeout`, and zero timeout means wait for as long as
+// it takes, just like `Produce` does.
+func (p *T) ProduceWithTimeout(topic string, key, message sarama.Encoder, timeout time.Duration) (*sarama.ProducerMessage, error) {
+	return p.ProduceToPartition("", topic, producer.AnyPartition, key, message, timeout)
+}
+
+// ProduceToPartition is the same as `ProduceWithTimeout` except the message is
+// placed to the specified `partition` regardless of the key, unless it is
+// `producer.AnyPartition`. It is intended for applications that do their own
+// partition assignment. If the topic does not have such partition, then
+// `sarama.ErrInvalidPartition` is returned.
+//
+// The message is accounted to `tenant`, that is the principal that the
+// request has been authenticated as, see `Usage`. If it is empty, then the
+// proxy alias is used, and so it is by `Produce` and `ProduceWithTimeout`.
+func (p *T) ProduceToPartition(tenant, topic string, partition int32, key, message sarama.Encoder, timeout time.Duration) (*sarama.ProducerMessage, error) {
+	if timeout > p.cfg.Producer.MaxSyncTimeout {
+		timeout = p.cfg.Producer.MaxSyncTimeout
+	}
+	if err := p.sw.check(OpProduce, topic); err != nil {
+		return nil, err
+	}
+	if err := p.vld.validate(topic, key, message); err != nil {
+		return nil, err
+	}
+	prodMsg, err := p.producer().ProduceToPartition(topic, partition, key, message, timeout)
+	if err == nil && p.acc != nil {
+		p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(key)+encodedLen(message))
+	}
+	return prodMsg, err
 }
 
 // AsyncProduce is an asynchronously counterpart of the `Produce` function.
-// Errors are silently ignored.
-func (p *T) AsyncProduce(topic string, key, message sarama.Encoder) {
-	p.prod.AsyncProduce(topic, key, message)
+// Errors that occur when the message is submitted to Kafka are silently
+// ignored, but if a validation webhook is configured for the topic, then the
+// message is validated synchronously and validation errors are returned.
+func (p *T) AsyncProduce(topic string, key, message sarama.Encoder) error {
+	return p.AsyncProduceToPartition("", topic, producer.AnyPartition, key, message)
+}
+
+// AsyncProduceToPartition is an asynchronous counterpart of the
+// `ProduceToPartition` function. Note that if the topic does not have the
+// specified partition, then the message is silently dropped.
+func (p *T) AsyncProduceToPartition(tenant, topic string, partition int32, key, message sarama.Encoder) error {
+	if err := p.sw.check(OpProduce, topic); err != nil {
+		return err
+	}
+	if err := p.vld.validate(topic, key, message); err != nil {
+		return err
+	}
+	p.producer().AsyncProduceToPartition(topic, partition, key, message, nil)
+	if p.acc != nil {
+		p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(key)+encodedLen(message))
+	}
+	return nil
+}
+
+// ProduceBatch submits all records to the specified `topic` at once, and waits
+// for all of them to be committed to Kafka for at most `timeout`, that has the
+// same meaning as in `ProduceWithTimeout`. It returns a result for every
+// record in the same order. If a validation webhook is configured for the
+// topic, then all records are validated before any is submitted, and if any
+// of them is rejected, then the batch is not produced and an error is
+// returned. Batches larger than `Config.Producer.MaxBatchSize` are rejected
+// with `errs.ErrInvalidParam`. Records are accounted to `tenant` the same way
+// as by `ProduceToPartition`.
+func (p *T) ProduceBatch(tenant, topic string, records []producer.Record, timeout time.Duration) ([]producer.BatchResult, error) {
+	if timeout > p.cfg.Producer.MaxSyncTimeout {
+		timeout = p.cfg.Producer.MaxSyncTimeout
+	}
+	if err := p.validateBatch(topic, records); err != nil {
+		return nil, err
+	}
+	results := p.producer().ProduceBatchWithTimeout(topic, records, timeout)
+	if p.acc != nil {
+		for i, result := range results {
+			if result.Err == nil {
+				p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(records[i].Key)+encodedLen(records[i].Value))
+			}
+		}
+	}
+	return results, nil
+}
+
+// AsyncProduceBatch is an asynchronous counterpart of the `ProduceBatch`
+// function. Errors that occur when records are submitted to Kafka are silently
+// ignored, but validation errors are returned.
+func (p *T) AsyncProduceBatch(tenant, topic string, records []producer.Record) error {
+	if err := p.validateBatch(topic, records); err != nil {
+		return err
+	}
+	prod := p.producer()
+	for _, record := range records {
+		prod.AsyncProduce(topic, record.Key, record.Value)
+		if p.acc != nil {
+			p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(record.Key)+encodedLen(record.Value))
+		}
+	}
+	return nil
+}
+
+// validateBatch validates all records of a batch, and returns the error of the
+// first rejected one, if any.
+func (p *T) validateBatch(topic string, records []producer.Record) error {
+	if len(records) > p.cfg.Producer.MaxBatchSize {
+		return errs.New(errs.ErrInvalidParam, "batch too large: max=%d", p.cfg.Producer.MaxBatchSize)
+	}
+	if err := p.sw.check(OpProduce, topic); err != nil {
+		return err
+	}
+	for i, record := range records {
+		if err := p.vld.validate(topic, record.Key, record.Value); err != nil {
+			return errors.Wrapf(err, "record %d", i)
+		}
+	}
+	return nil
+}
+
+// ProduceTraced is the same as `ProduceToPartition` except if message tracing
+// is enabled, then lifecycle events of the message are recorded under the
+// specified trace ID, see `Trace`.
+func (p *T) ProduceTraced(tenant, traceID, topic string, partition int32, key, message sarama.Encoder, timeout time.Duration) (*sarama.ProducerMessage, error) {
+	if p.tracer == nil {
+		return p.ProduceToPartition(tenant, topic, partition, key, message, timeout)
+	}
+	p.tracer.OnReceived(traceID, topic)
+	prodMsg, err := p.ProduceToPartition(tenant, topic, partition, key, message, timeout)
+	if err != nil {
+		p.tracer.OnProduced(traceID, 0, 0, err)
+		return nil, err
+	}
+	p.tracer.OnProduced(traceID, prodMsg.Partition, prodMsg.Offset, nil)
+	return prodMsg, nil
+}
+
+// AsyncProduceTraced is the same as `AsyncProduceToPartition` except if
+// message tracing is enabled, then lifecycle events of the message are
+// recorded under the specified trace ID, see `Trace`.
+func (p *T) AsyncProduceTraced(tenant, traceID, topic string, partition int32, key, message sarama.Encoder) error {
+	if p.tracer == nil {
+		return p.AsyncProduceToPartition(tenant, topic, partition, key, message)
+	}
+	p.tracer.OnReceived(traceID, topic)
+	if err := p.sw.check(OpProduce, topic); err != nil {
+		p.tracer.OnProduced(traceID, 0, 0, err)
+		return err
+	}
+	if err := p.vld.validate(topic, key, message); err != nil {
+		p.tracer.OnProduced(traceID, 0, 0, err)
+		return err
+	}
+	p.producer().AsyncProduceToPartition(topic, partition, key, message, func(prodMsg *sarama.ProducerMessage, err error) {
+		p.tracer.OnProduced(traceID, prodMsg.Partition, prodMsg.Offset, err)
+	})
+	if p.acc != nil {
+		p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(key)+encodedLen(message))
+	}
+	return nil
+}
+
+// Trace returns lifecycle events recorded for a message produced with the
+// specified trace ID. An error is returned if message tracing is disabled or
+// the trace is not known, e.g. because it has already been evicted.
+func (p *T) Trace(traceID string) (tracing.Trace, error) {
+	if p.tracer == nil {
+		return tracing.Trace{}, ErrTracingDisabled
+	}
+	trace, ok := p.tracer.Get(traceID)
+	if !ok {
+		return tracing.Trace{}, ErrTraceNotFound
+	}
+	return trace, nil
+}
+
+// producer returns the producer of the cluster that produce traffic should
+// currently go to.
+func (p *T) producer() *producer.T {
+	if p.fo != nil && p.fo.useStandby() {
+		return p.standbyProd
+	}
+	return p.prod
 }
 
 // Consume consumes a message from the specified topic on behalf of the
 // specified consumer group. If there are no more new messages in the topic
 // at the time of the request then it will block for
 // `Config.Consumer.LongPollingTimeout`. If no new message is produced during
-// that time, then `ErrRequestTimeout` is returned.
+// that time, then `errs.ErrRequestTimeout` is returned.
 //
 // Note that during state transitions topic subscribe<->unsubscribe and
 // consumer group register<->deregister the method may return either
-// `ErrBufferOverflow` or `ErrRequestTimeout` even when there are messages
-// available for consumption. In that case the user should back off a bit
-// and then repeat the request.
+// `errs.ErrTooManyRequests` or `errs.ErrRequestTimeout` even when there are
+// messages available for consumption. In that case the user should back off
+// a bit and then repeat the request.
+//
+// If the group is a shadow group for the topic, then it stops mirroring the
+// source group offsets, see `StartShadow`.
 func (p *T) Consume(group, topic string, ack ack) (consumer.Message, error) {
-	if ack != noAck && ack != autoAck {
+	return p.ConsumeWithTimeout("", "", group, topic, ack, 0, 0)
+}
+
+// ConsumeWithTimeout is the same as `Consume` except it blocks for at most
+// `timeout` if there are no messages available. The timeout is capped by
+// `Config.Consumer.MaxLongPollingTimeout`, and zero timeout means
+// `Config.Consumer.LongPollingTimeout`.
+//
+// The request is made on behalf of `client`, an arbitrary name of the
+// application instance. Messages are distributed between clients with waiting
+// requests in a round robin fashion, so a client that makes many concurrent
+// requests does not starve the others. `Consume` uses an empty client name.
+// Consumed messages are accounted to `tenant` the same way as produced ones
+// are by `ProduceToPartition`.
+//
+// The proxy stays subscribed to the topic on behalf of the group for at least
+// `subscriptionTTL` after the request, so that clients that poll rarely do
+// not cause rebalancing. Zero means `Config.Consumer.RegistrationTimeout`.
+// If not zero, it must be greater than the long polling timeout, otherwise
+// `errs.ErrInvalidParam` is returned.
+//
+// The returned message is enriched by enrichers configured for the topic, see
+// `Config.Consumer.Enrichers`, so key filters match enriched keys.
+func (p *T) ConsumeWithTimeout(tenant, client, group, topic string, ack ack, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	msg, err := p.consume(client, group, topic, ack, timeout, subscriptionTTL)
+	if err != nil {
+		return consumer.Message{}, err
+	}
+	p.countConsumed(tenant, msg)
+	return msg, nil
+}
+
+// consume is the same as `ConsumeWithTimeout` except the message is not
+// accounted. It is used by requests that may not return the consumed message
+// to the client, e.g. because it is skipped by a key filter, so that they
+// account only the messages that they actually return.
+func (p *T) consume(client, group, topic string, ack ack, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	if err := p.sw.check(OpConsume, topic); err != nil {
+		return consumer.Message{}, err
+	}
+	timeout = p.longPollingTimeout(timeout)
+	if subscriptionTTL != 0 && subscriptionTTL <= timeout {
+		return consumer.Message{}, errs.New(errs.ErrInvalidParam,
+			"subscription TTL must be > long polling timeout: timeout=%s", timeout)
+	}
+	p.promoteShadow(group, topic)
+	if !ack.isNoAck() && !ack.isAutoAck() {
 		p.eventsChMapMu.RLock()
 		eventsChID := eventsChID{group, topic, ack.partition}
 		eventsCh, ok := p.eventsChMap[eventsChID]
@@ -150,7 +540,7 @@ func (p *T) Consume(group, topic string, ack ack) (consumer.Message, error) {
 		if ok {
 			go func() {
 				select {
-				case eventsCh <- consumer.Ack(ack.offset):
+				case eventsCh <- consumer.AckWithMeta(ack.offset, ack.meta):
 				case <-time.After(p.cfg.Consumer.LongPollingTimeout):
 					log.Errorf("<%s> ack timeout: partition=%d, offset=%d",
 						p.actorID, ack.partition, ack.offset)
@@ -158,7 +548,7 @@ func (p *T) Consume(group, topic string, ack ack) (consumer.Message, error) {
 			}()
 		}
 	}
-	msg, err := p.cons.Consume(group, topic)
+	msg, err := p.cons.ConsumeWithTimeout(client, group, topic, timeout, subscriptionTTL)
 	if err != nil {
 		return consumer.Message{}, err
 	}
@@ -168,34 +558,733 @@ func (p *T) Consume(group, topic string, ack ack) (consumer.Message, error) {
 	p.eventsChMap[eventsChID] = msg.EventsCh
 	p.eventsChMapMu.Unlock()
 
-	if ack == autoAck {
-		msg.EventsCh <- consumer.Ack(msg.Offset)
+	if ack.isAutoAck() {
+		msg.EventsCh <- consumer.AckWithMeta(msg.Offset, ack.meta)
 	}
-	return msg, nil
+	return p.enrich(msg), nil
+}
+
+// countConsumed accounts a message returned to the client to the tenant, and
+// registers it with the hot partition tracker.
+func (p *T) countConsumed(tenant string, msg consumer.Message) {
+	if p.acc != nil {
+		p.acc.CountConsumed(p.tenant(tenant), msg.Topic, len(msg.Key)+len(msg.Value))
+	}
+	if p.hot != nil {
+		p.hot.CountConsumed(msg.Topic, msg.Partition, len(msg.Key)+len(msg.Value))
+	}
+}
+
+// ConsumeFiltered is the same as `ConsumeWithTimeout`, except that only a
+// message selected by the key filter is returned. Messages that are not
+// selected are acknowledged and skipped, so they are never delivered to the
+// group. All skipped messages count against the same long polling timeout,
+// therefore if no message is selected in time `errs.ErrRequestTimeout` is
+// returned. A nil filter selects all messages.
+func (p *T) ConsumeFiltered(tenant, client, group, topic string, ack ack, filter *KeyFilter, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	if filter == nil {
+		return p.ConsumeWithTimeout(tenant, client, group, topic, ack, timeout, subscriptionTTL)
+	}
+	// Only the selected message should be acknowledged with the metadata
+	// passed with the ack, so auto acknowledgement is done here.
+	nextAck := ack
+	if ack.isAutoAck() {
+		nextAck = noAck
+	}
+	deadline := time.Now().Add(p.longPollingTimeout(timeout))
+	for {
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "long polling timeout")
+		}
+		msg, err := p.consume(client, group, topic, nextAck, remaining, subscriptionTTL)
+		if err != nil {
+			return consumer.Message{}, err
+		}
+		nextAck = noAck
+		if !filter.Match(msg.Key) {
+			msg.EventsCh <- consumer.Ack(msg.Offset)
+			continue
+		}
+		if ack.isAutoAck() {
+			msg.EventsCh <- consumer.AckWithMeta(msg.Offset, ack.meta)
+		}
+		p.countConsumed(tenant, msg)
+		return msg, nil
+	}
+}
+
+// ConsumeAny consumes a message from the specified topic on behalf of whichever
+// of the specified consumer groups has a message available first. Groups are
+// listed in the order of priority, so if messages are available for several
+// groups at the same time then the message of the group listed first is
+// returned. The returned message is acknowledged immediately.
+//
+// All groups are consumed concurrently, and messages that are fetched for
+// groups other than the returned one are nacked, so they are redelivered to
+// the other groups right away.
+//
+// The returned message ack carries `ackMeta`, see `ack.WithMeta`. The
+// `tenant`, `client`, `timeout` and `subscriptionTTL` have the same meaning as
+// in `ConsumeWithTimeout`.
+func (p *T) ConsumeAny(tenant, client string, groups []string, topic, ackMeta string, timeout, subscriptionTTL time.Duration) (string, consumer.Message, error) {
+	if len(groups) == 1 {
+		msg, err := p.ConsumeWithTimeout(tenant, client, groups[0], topic, autoAck.WithMeta(ackMeta), timeout, subscriptionTTL)
+		return groups[0], msg, err
+	}
+	idx, msg, err := p.consumeFirst(len(groups), func(i int) (consumer.Message, error) {
+		return p.consume(client, groups[i], topic, noAck, timeout, subscriptionTTL)
+	})
+	if err != nil {
+		return groups[idx], consumer.Message{}, err
+	}
+	msg.EventsCh <- consumer.AckWithMeta(msg.Offset, ackMeta)
+	p.countConsumed(tenant, msg)
+	return groups[idx], msg, nil
+}
+
+// ConsumeTopics consumes a message on behalf of the group from whichever of
+// the specified topics has one available first. The topic of the returned
+// message is in `consumer.Message.Topic`.
+//
+// Topics are checked for readily available messages one by one first, each
+// request starting with the next topic, so that low-volume topics are not
+// starved by busy ones. If none has a message, then all of them are long
+// polled concurrently, and messages that happen to be fetched from topics
+// other than the returned one are nacked, so they are redelivered right away
+// rather than after `Config.Consumer.AckTimeout`, and do not count towards
+// `Config.Consumer.DeadLetterAfter`.
+//
+// The `ack` must be either `AutoAck`, optionally with metadata, or `NoAck`.
+// The `tenant`, `client`, `timeout` and `subscriptionTTL` have the same
+// meaning as in `ConsumeWithTimeout`.
+func (p *T) ConsumeTopics(tenant, client, group string, topics []string, ack ack, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	timeout, err := p.checkMultiTopicConsume(ack, timeout, subscriptionTTL)
+	if err != nil {
+		return consumer.Message{}, err
+	}
+	if len(topics) == 0 {
+		return consumer.Message{}, errs.New(errs.ErrInvalidParam, "at least one topic is required")
+	}
+	return p.consumeTopics(tenant, client, group, dedupTopics(topics), ack, timeout, subscriptionTTL)
+}
+
+// checkMultiTopicConsume validates parameters of a request that consumes from
+// several topics, and returns the long polling timeout to use.
+func (p *T) checkMultiTopicConsume(ack ack, timeout, subscriptionTTL time.Duration) (time.Duration, error) {
+	if !ack.isNoAck() && !ack.isAutoAck() {
+		return 0, errs.New(errs.ErrInvalidParam, "consuming several topics requires either auto ack or no ack")
+	}
+	timeout = p.longPollingTimeout(timeout)
+	if subscriptionTTL != 0 && subscriptionTTL <= timeout {
+		return 0, errs.New(errs.ErrInvalidParam,
+			"subscription TTL must be > long polling timeout: timeout=%s", timeout)
+	}
+	return timeout, nil
+}
+
+func (p *T) consumeTopics(tenant, client, group string, topics []string, ack ack, timeout, subscriptionTTL time.Duration) (consumer.Message, error) {
+	if len(topics) == 1 {
+		return p.ConsumeWithTimeout(tenant, client, group, topics[0], ack, timeout, subscriptionTTL)
+	}
+	deadline := time.Now().Add(timeout)
+	first := int(atomic.AddUint32(&p.topicSweeps, 1))
+	for i := range topics {
+		topic := topics[(first+i)%len(topics)]
+		// Errors are ignored, for they are reported by long polling below
+		// if no topic has a message.
+		msg, err := p.ConsumeWithTimeout(tenant, client, group, topic, noAck, batchFillTimeout, subscriptionTTL)
+		if err == nil {
+			return autoAckIfRequested(msg, ack), nil
+		}
+	}
+	remaining := deadline.Sub(time.Now())
+	if remaining <= 0 {
+		return consumer.Message{}, errs.New(errs.ErrRequestTimeout, "long polling timeout")
+	}
+	_, msg, err := p.consumeFirst(len(topics), func(i int) (consumer.Message, error) {
+		return p.consume(client, group, topics[i], noAck, remaining, subscriptionTTL)
+	})
+	if err != nil {
+		return consumer.Message{}, err
+	}
+	p.countConsumed(tenant, msg)
+	return autoAckIfRequested(msg, ack), nil
+}
+
+func autoAckIfRequested(msg consumer.Message, ack ack) consumer.Message {
+	if ack.isAutoAck() {
+		msg.EventsCh <- consumer.AckWithMeta(msg.Offset, ack.meta)
+	}
+	return msg
+}
+
+// dedupTopics returns topics in the original order without repetitions, so
+// that a topic listed twice does not get twice as many chances to be consumed.
+func dedupTopics(topics []string) []string {
+	seen := make(map[string]bool, len(topics))
+	deduped := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if !seen[topic] {
+			seen[topic] = true
+			deduped = append(deduped, topic)
+		}
+	}
+	return deduped
+}
+
+// consumeFirst makes `n` consume requests concurrently, and returns the index
+// and the message of the first request that succeeds. Requests are ordered by
+// priority, so if several succeed at the same time then the one with the
+// lowest index wins. Messages of the other requests, including those that are
+// fetched by requests still long polling when the winner is returned, are
+// nacked without a delay, so that they are redelivered right away rather than
+// after the ack timeout, and do not count towards `DeadLetterAfter`. If all
+// requests fail, then the error of the first one is returned.
+func (p *T) consumeFirst(n int, consumeFn func(i int) (consumer.Message, error)) (int, consumer.Message, error) {
+	resultsCh := make(chan consumeResult, n)
+	for i := 0; i < n; i++ {
+		go func(idx int) {
+			msg, err := consumeFn(idx)
+			resultsCh <- consumeResult{idx, msg, err}
+		}(i)
+	}
+	results := make([]*consumeResult, n)
+	for received := 0; received < n; {
+		res := <-resultsCh
+		results[res.idx] = &res
+		received++
+		if res.err != nil {
+			continue
+		}
+		// Pick up results that have already arrived for other requests to
+		// make sure that the highest priority message is returned.
+	drain:
+		for received < n {
+			select {
+			case res := <-resultsCh:
+				results[res.idx] = &res
+				received++
+			default:
+				break drain
+			}
+		}
+		for i, res := range results {
+			if res != nil && res.err == nil {
+				for j, loser := range results {
+					if j != i && loser != nil {
+						loser.nack()
+					}
+				}
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						loser := <-resultsCh
+						loser.nack()
+					}
+				}(n - received)
+				return i, res.msg, nil
+			}
+		}
+	}
+	return 0, consumer.Message{}, results[0].err
+}
+
+// consumeResult is the outcome of a consume request made by `consumeFirst`.
+type consumeResult struct {
+	idx int
+	msg consumer.Message
+	err error
+}
+
+// nack makes the message of a request that lost a `consumeFirst` race due
+// for redelivery right away, if the request succeeded.
+func (res *consumeResult) nack() {
+	if res.err == nil {
+		res.msg.EventsCh <- consumer.Nack(res.msg.Offset, 0)
+	}
+}
+
+// ConsumeBatch consumes up to `size` messages from the specified topic on
+// behalf of the specified consumer group. It blocks for the first message the
+// same way `ConsumeWithTimeout` does, but then it only takes messages that are
+// readily available, so a batch can be shorter than requested. The batch size
+// is capped by `Config.Consumer.MaxBatchSize`. The `ack` must be either
+// `AutoAck`, optionally with metadata, to acknowledge all returned messages
+// immediately, or `NoAck` to leave them to be acknowledged with `Ack`.
+//
+// An error is returned only if not a single message could be consumed.
+func (p *T) ConsumeBatch(tenant, client, group, topic string, ack ack, size int, timeout, subscriptionTTL time.Duration) ([]consumer.Message, error) {
+	if size > p.cfg.Consumer.MaxBatchSize {
+		size = p.cfg.Consumer.MaxBatchSize
+	}
+	msg, err := p.ConsumeWithTimeout(tenant, client, group, topic, ack, timeout, subscriptionTTL)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []consumer.Message{msg}
+	for len(msgs) < size {
+		msg, err := p.ConsumeWithTimeout(tenant, client, group, topic, ack, batchFillTimeout, subscriptionTTL)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// Heartbeat keeps the proxy subscribed to the topic on behalf of the group, as
+// if a message has been consumed, but without consuming one. It allows clients
+// to stay members of the group during quiet periods, and so avoid rebalancing
+// when traffic resumes. It returns `consumer.ErrNotSubscribed` if the topic is
+// not being consumed via the proxy on behalf of the group.
+func (p *T) Heartbeat(group, topic string) error {
+	return p.cons.Heartbeat(group, topic)
+}
+
+// Ack acknowledges a message that has been consumed with `NoAck`, without
+// consuming another one. It returns `ErrNotConsumed` if the partition of the
+// acknowledged message has not been consumed via the proxy on behalf of the
+// group. If the partition consumer does not accept the ack within
+// `Config.Consumer.LongPollingTimeout`, then `errs.ErrRequestTimeout` is
+// returned.
+func (p *T) Ack(group, topic string, ack ack) error {
+	return p.sendAckEvent(group, topic, ack.partition, consumer.AckWithMeta(ack.offset, ack.meta))
+}
+
+// AckUpTo acknowledges all messages of the partition with offsets at or below
+// the offset of the `ack`, that have been consumed with `NoAck`, at once.
+// Messages that have not been consumed yet are not acknowledged, even if
+// their offsets are below the specified one. Errors are the same as those
+// returned by `Ack`.
+func (p *T) AckUpTo(group, topic string, ack ack) error {
+	return p.sendAckEvent(group, topic, ack.partition, consumer.AckUpTo(ack.offset, ack.meta))
+}
+
+// Nack tells that a message consumed with `NoAck` failed to be processed, and
+// makes it due for redelivery to the group after `delay`, rather than after
+// `Config.Consumer.AckTimeout`. Zero delay means redelivery right away. The
+// delay cannot exceed the ack timeout, for a message that is neither
+// acknowledged nor nacked is redelivered after the ack timeout anyway. A
+// nacked message does not count as one that was not acknowledged in time,
+// see `Config.Consumer.DeadLetterAfter`. Errors are the same as those returned
+// by `Ack`.
+func (p *T) Nack(group, topic string, ack ack, delay time.Duration) error {
+	if delay < 0 || delay > p.cfg.Consumer.AckTimeout {
+		return errs.New(errs.ErrInvalidParam, "nack delay must be within [0, %s]", p.cfg.Consumer.AckTimeout)
+	}
+	return p.sendAckEvent(group, topic, ack.partition, consumer.Nack(ack.offset, delay))
+}
+
+func (p *T) sendAckEvent(group, topic string, partition int32, event consumer.Event) error {
+	p.eventsChMapMu.RLock()
+	eventsCh, ok := p.eventsChMap[eventsChID{group, topic, partition}]
+	p.eventsChMapMu.RUnlock()
+	if !ok {
+		return ErrNotConsumed
+	}
+	select {
+	case eventsCh <- event:
+		return nil
+	case <-time.After(p.cfg.Consumer.LongPollingTimeout):
+		return errs.New(errs.ErrRequestTimeout, "ack timeout")
+	}
+}
+
+// longPollingTimeout returns the long polling timeout to use for a consume
+// request that asked for the specified timeout.
+func (p *T) longPollingTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return p.cfg.Consumer.LongPollingTimeout
+	}
+	maxTimeout := p.cfg.Consumer.MaxLongPollingTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = p.cfg.Consumer.LongPollingTimeout
+	}
+	if timeout > maxTimeout {
+		return maxTimeout
+	}
+	return timeout
+}
+
+// Usage returns usage records collected by the proxy accounting. An error is
+// returned if accounting is disabled.
+func (p *T) Usage() ([]accounting.Usage, error) {
+	if p.acc == nil {
+		return nil, ErrAccountingDisabled
+	}
+	return p.acc.Usage(), nil
+}
+
+// tenant returns the tenant to account a request to. Requests made on behalf
+// of an unknown principal are accounted to the proxy alias.
+func (p *T) tenant(tenant string) string {
+	if tenant == "" {
+		return p.name
+	}
+	return tenant
+}
+
+// HotPartitions returns produce and consume byte rates of all partitions of a
+// topic, with partitions that receive much more traffic than the others
+// marked hot. An error is returned if hot partition tracking is disabled.
+func (p *T) HotPartitions(topic string) (hotpart.Report, error) {
+	if p.hot == nil {
+		return hotpart.Report{}, ErrHotPartsDisabled
+	}
+	partitions, err := p.topicPartitions(topic)
+	if err != nil {
+		return hotpart.Report{}, err
+	}
+	return p.hot.Report(topic, partitions), nil
+}
+
+// topicPartitions returns IDs of all partitions of a topic.
+func (p *T) topicPartitions(topic string) ([]int32, error) {
+	metadata, err := p.adm.GetTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	partitions := make([]int32, len(metadata))
+	for i, pm := range metadata {
+		partitions[i] = pm.Partition
+	}
+	return partitions, nil
+}
+
+// Coordinators returns the current offset coordinator broker of every consumer
+// group that has been consumed via the proxy.
+func (p *T) Coordinators() []offsetmgr.CoordinatorStatus {
+	return p.cons.Coordinators()
+}
+
+// FetchErrors returns the number of errors that occurred while fetching
+// messages from Kafka by error class.
+func (p *T) FetchErrors() map[string]int64 {
+	return p.cons.FetchErrors()
+}
+
+// DisableTopic makes requests of the specified operation, either `OpProduce`
+// or `OpConsume`, to the topic fail with `errs.ErrDisabled` that carries the
+// reason. Consume disabled also rejects reading messages, but acknowledgements
+// of messages consumed before are still accepted. The change is not persisted
+// and is lost when the proxy is restarted.
+func (p *T) DisableTopic(op, topic, reason string) error {
+	return p.sw.set(op, topic, false, reason)
+}
+
+// EnableTopic reverts `DisableTopic`, or topic disabling configured in
+// `Config.DisabledTopics`.
+func (p *T) EnableTopic(op, topic string) error {
+	return p.sw.set(op, topic, true, "")
+}
+
+// DisabledTopics returns topics mapped to reasons by operations disabled for
+// them.
+func (p *T) DisabledTopics() map[string]map[string]string {
+	return p.sw.snapshot()
+}
+
+// ProduceErrors returns the number of messages that failed to be produced
+// after all retries since the proxy started, by error name, see
+// `producer.ErrName`.
+func (p *T) ProduceErrors() map[string]int64 {
+	return p.producer().ErrorCounts()
+}
+
+// Brokers returns fetch request statistics of every broker that messages have
+// been fetched from via the proxy, by broker ID.
+func (p *T) Brokers() map[int32]consumer.BrokerStat {
+	return p.cons.Brokers()
+}
+
+// Clients returns the number of messages delivered via the proxy to every
+// client by group and topic, see `ConsumeWithTimeout`.
+func (p *T) Clients() []consumer.ClientStat {
+	return p.cons.Clients()
+}
+
+// PauseConsumption makes the proxy stop offering messages of the topic to the
+// group until `ResumeConsumption` is called. Consume requests are still
+// accepted, and time out unless consumption is resumed. See
+// `consumer.T.SetPaused`.
+func (p *T) PauseConsumption(group, topic string) {
+	p.cons.SetPaused(group, topic, true)
+}
+
+// ResumeConsumption reverts `PauseConsumption`.
+func (p *T) ResumeConsumption(group, topic string) {
+	p.cons.SetPaused(group, topic, false)
+}
+
+// PausedConsumption returns paused topics by group.
+func (p *T) PausedConsumption() map[string][]string {
+	return p.cons.Paused()
+}
+
+// EvictGroupMember deletes the registration of a consumer group member along
+// with its partition claims, and returns the released partitions by topic.
+func (p *T) EvictGroupMember(group, member string) (map[string][]int32, error) {
+	return p.adm.EvictGroupMember(group, member)
+}
+
+// RebalanceGroup makes the proxy rebalance the consumer group, see
+// `consumer.T.Rebalance`.
+func (p *T) RebalanceGroup(group string) error {
+	return p.cons.Rebalance(group)
+}
+
+// ConsumerAssignments returns partitions assigned to the proxy by group and
+// topic, see `consumer.T.Assignments`.
+func (p *T) ConsumerAssignments() map[string]map[string][]int32 {
+	return p.cons.Assignments()
+}
+
+// CheckKafka verifies that cluster metadata can be fetched from Kafka.
+func (p *T) CheckKafka() error {
+	return p.adm.CheckKafka()
+}
+
+// CheckZooKeeper returns the state of the ZooKeeper session, and an error if
+// there is no session.
+func (p *T) CheckZooKeeper() (string, error) {
+	return p.adm.CheckZooKeeper()
+}
+
+// UsesZooKeeper tells whether consumer groups of the proxy are coordinated via
+// ZooKeeper. Otherwise they are coordinated by Kafka, and the proxy does not
+// need ZooKeeper to consume.
+func (p *T) UsesZooKeeper() bool {
+	return p.cfg.Consumer.GroupProtocol != config.GroupProtocolKafka
+}
+
+// Rebalances returns the most recent rebalancings of the specified consumer
+// group as seen by the proxy, oldest first.
+func (p *T) Rebalances(group string) []consumer.Rebalance {
+	return p.cons.Rebalances(group)
 }
 
 // GetGroupOffsets for every partition of the specified topic it returns the
 // current offset range along with the latest offset and metadata committed by
 // the specified consumer group.
-func (p *T) GetGroupOffsets(group, topic string) ([]admin.PartitionOffset, error) {
-	return p.adm.GetGroupOffsets(group, topic)
+//
+// The result may be served from the query cache, see `Config.QueryCache`,
+// unless `refresh` is true, and it is returned along with the time it was
+// fetched at. Cached results must not be modified.
+func (p *T) GetGroupOffsets(group, topic string, refresh bool) ([]admin.PartitionOffset, time.Time, error) {
+	result, fetchedAt, err := p.queries.get(queryKey{queryGroupOffsets, group, topic}, refresh, func() (interface{}, error) {
+		return p.adm.GetGroupOffsets(group, topic)
+	})
+	if err != nil {
+		return nil, fetchedAt, err
+	}
+	return result.([]admin.PartitionOffset), fetchedAt, nil
+}
+
+// GetAllGroupOffsets returns offsets of the specified consumer group for every
+// topic that the group has committed offsets for, see `GetGroupOffsets`.
+func (p *T) GetAllGroupOffsets(group string, refresh bool) (map[string][]admin.PartitionOffset, time.Time, error) {
+	result, fetchedAt, err := p.queries.get(queryKey{queryAllGroupOffsets, group, ""}, refresh, func() (interface{}, error) {
+		return p.adm.GetAllGroupOffsets(group)
+	})
+	if err != nil {
+		return nil, fetchedAt, err
+	}
+	return result.(map[string][]admin.PartitionOffset), fetchedAt, nil
+}
+
+// GetTopics returns all topics of the cluster, see `admin.GetTopics`.
+func (p *T) GetTopics(withPartitions, withConfig bool) ([]admin.TopicInfo, error) {
+	return p.adm.GetTopics(withPartitions, withConfig)
+}
+
+// GetTopicMetadata returns metadata of all partitions of the specified topic
+// fresh from the cluster, see `admin.GetTopicMetadata`.
+func (p *T) GetTopicMetadata(topic string) ([]admin.PartitionMetadata, error) {
+	return p.adm.GetTopicMetadata(topic)
+}
+
+// ReadMessages reads up to `count` messages from a partition of a topic
+// starting from `offset`, bypassing consumer groups, see `admin.ReadMessages`.
+// The count is capped by `Config.Consumer.MaxBatchSize`.
+func (p *T) ReadMessages(topic string, partition int32, offset int64, count int) ([]admin.Message, error) {
+	if err := p.sw.check(OpConsume, topic); err != nil {
+		return nil, err
+	}
+	if count > p.cfg.Consumer.MaxBatchSize {
+		count = p.cfg.Consumer.MaxBatchSize
+	}
+	return p.adm.ReadMessages(topic, partition, offset, count)
+}
+
+// ReadCommittedMessages is the same as `ReadMessages` except messages are read
+// from the offset committed by the consumer group, and messages that the group
+// has acknowledged out of order are skipped. That is what consumers of the
+// group are going to get next, apart from redeliveries of messages that are
+// offered but not acknowledged yet. The group is not joined and no offsets are
+// committed. If the group has not committed an offset for the partition, then
+// messages are read from the configured initial offset, that is nothing is
+// returned unless it is the oldest one. An offset initializer, if any, is not
+// consulted.
+func (p *T) ReadCommittedMessages(group, topic string, partition int32, count int) ([]admin.Message, error) {
+	if err := p.sw.check(OpConsume, topic); err != nil {
+		return nil, err
+	}
+	if count > p.cfg.Consumer.MaxBatchSize {
+		count = p.cfg.Consumer.MaxBatchSize
+	}
+	partitionOffsets, err := p.adm.GetGroupOffsets(group, topic)
+	if err != nil {
+		return nil, err
+	}
+	var committed *admin.PartitionOffset
+	for i := range partitionOffsets {
+		if partitionOffsets[i].Partition == partition {
+			committed = &partitionOffsets[i]
+			break
+		}
+	}
+	if committed == nil {
+		return nil, errs.New(errs.ErrInvalidParam, "unknown partition: partition=%d", partition)
+	}
+	// Consumption starts from the nearest available offset if the committed
+	// one is out of range, so reading does the same.
+	offset := committed.Offset
+	if offset == sarama.OffsetNewest && p.cfg.ConsumerInitialOffset(topic) == config.InitialOffsetOldest {
+		offset = sarama.OffsetOldest
+	}
+	switch {
+	case offset == sarama.OffsetNewest || offset >= committed.End:
+		return nil, nil
+	case offset < committed.Begin:
+		offset = committed.Begin
+	}
+	ot := offsettrac.New(p.actorID.NewChild("read", group, topic, partition),
+		offsetmgr.Offset{Val: committed.Offset, Meta: committed.Metadata}, 0)
+	var messages []admin.Message
+	for len(messages) < count {
+		chunk, err := p.adm.ReadMessages(topic, partition, offset, count-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		for _, msg := range chunk {
+			if !ot.IsAcked(consumer.Message{Offset: msg.Offset}) {
+				messages = append(messages, msg)
+			}
+		}
+		offset = chunk[len(chunk)-1].Offset + 1
+	}
+	return messages, nil
+}
+
+// ExportMessages reads messages of a partition of a topic with offsets from
+// `from` up to but not including `to`, bypassing consumer groups the same way
+// as `ReadMessages`. Messages are passed to `fn` in chunks of up to
+// `Config.Consumer.MaxBatchSize` as soon as they are read, so that a range of
+// any size can be exported without being held in memory. Reading stops early
+// if the end of the partition is reached, or if `fn` returns an error, that is
+// returned then.
+func (p *T) ExportMessages(topic string, partition int32, from, to int64, fn func([]admin.Message) error) error {
+	if err := p.sw.check(OpConsume, topic); err != nil {
+		return err
+	}
+	for offset := from; offset < to; {
+		count := p.cfg.Consumer.MaxBatchSize
+		if remaining := to - offset; remaining < int64(count) {
+			count = int(remaining)
+		}
+		chunk, err := p.adm.ReadMessages(topic, partition, offset, count)
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			return nil
+		}
+		offset = chunk[len(chunk)-1].Offset + 1
+		// Offsets of compacted topics have gaps, so the last messages of a
+		// chunk can be past the range.
+		for len(chunk) > 0 && chunk[len(chunk)-1].Offset >= to {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // SetGroupOffsets commits specific offset values along with metadata for a list
 // of partitions of a particular topic on behalf of the specified group.
 func (p *T) SetGroupOffsets(group, topic string, offsets []admin.PartitionOffset) error {
-	return p.adm.SetGroupOffsets(group, topic, offsets)
+	if err := p.adm.SetGroupOffsets(group, topic, offsets); err != nil {
+		return err
+	}
+	p.emitOffsetsSet(group, topic, offsets)
+	return nil
+}
+
+// RewindGroupOffsets commits offsets of messages produced around the
+// specified time, see `admin.T.GetOffsetsByTime`, for all partitions of a
+// particular topic on behalf of the specified group. The committed offsets
+// are returned.
+func (p *T) RewindGroupOffsets(group, topic string, t time.Time) ([]admin.PartitionOffset, error) {
+	offsets, err := p.adm.GetOffsetsByTime(topic, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.adm.SetGroupOffsets(group, topic, offsets); err != nil {
+		return nil, err
+	}
+	p.emitOffsetsSet(group, topic, offsets)
+	return offsets, nil
+}
+
+// emitOffsetsSet publishes an event about offsets committed via the admin API,
+// if events are enabled.
+func (p *T) emitOffsetsSet(group, topic string, offsets []admin.PartitionOffset) {
+	committed := make(map[int32]int64, len(offsets))
+	for _, po := range offsets {
+		committed[po.Partition] = po.Offset
+	}
+	p.events.Emit(events.TypeOffsetsSet, group, topic, map[string]interface{}{"offsets": committed})
 }
 
 // GetTopicConsumers returns client-id -> consumed-partitions-list mapping
-// for a clients from a particular consumer group and a particular topic.
-func (p *T) GetTopicConsumers(group, topic string) (map[string][]int32, error) {
-	return p.adm.GetTopicConsumers(group, topic)
+// for a clients from a particular consumer group and a particular topic. The
+// result may be served from the query cache, see `GetGroupOffsets`.
+func (p *T) GetTopicConsumers(group, topic string, refresh bool) (map[string][]int32, time.Time, error) {
+	result, fetchedAt, err := p.queries.get(queryKey{queryTopicConsumers, group, topic}, refresh, func() (interface{}, error) {
+		return p.adm.GetTopicConsumers(group, topic)
+	})
+	if err != nil {
+		return nil, fetchedAt, err
+	}
+	return result.(map[string][]int32), fetchedAt, nil
 }
 
 // GetAllTopicConsumers returns group -> client-id -> consumed-partitions-list
 // mapping for a particular topic. Warning, the function performs scan of all
 // consumer groups registered in ZooKeeper and therefore can take a lot of time.
-func (p *T) GetAllTopicConsumers(topic string) (map[string]map[string][]int32, error) {
-	return p.adm.GetAllTopicConsumers(topic)
+// The result may be served from the query cache, see `GetGroupOffsets`.
+func (p *T) GetAllTopicConsumers(topic string, refresh bool) (map[string]map[string][]int32, time.Time, error) {
+	result, fetchedAt, err := p.queries.get(queryKey{queryAllTopicConsumers, "", topic}, refresh, func() (interface{}, error) {
+		return p.adm.GetAllTopicConsumers(topic)
+	})
+	if err != nil {
+		return nil, fetchedAt, err
+	}
+	return result.(map[string]map[string][]int32), fetchedAt, nil
+}
+
+// encodedLen returns the length of an encoded value, or 0 if it is nil.
+func encodedLen(e sarama.Encoder) int {
+	if e == nil {
+		return 0
+	}
+	return e.Length()
 }
@@ -1,34 +1,230 @@
 package proxy
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/errs"
 	"github.com/pkg/errors"
 )
 
+// ErrNotReady is returned by `Set.Get` for a proxy that has failed to start.
+type ErrNotReady struct {
+	Alias string
+	Cause error
+}
+
+func (e ErrNotReady) Error() string {
+	return fmt.Sprintf("proxy `%s` is not ready: %s", e.Alias, e.Cause)
+}
+
+func (e ErrNotReady) Unwrap() error {
+	return e.Cause
+}
+
 // Set represents a collection of proxy.T instances with a default value.
 type Set struct {
-	proxies    map[string]*T
-	defaultPxy *T
+	mu           sync.RWMutex
+	proxies      map[string]*T
+	notReady     map[string]notReadyProxy
+	defaultAlias string
+	maintenance  bool
+
+	// Consume requests are counted, so that draining can wait for those in
+	// flight to complete.
+	draining         bool
+	consumesInFlight int
+	drainedCh        chan struct{}
+}
+
+type notReadyProxy struct {
+	err      error
+	retrying bool
+}
+
+// ProxyStatus describes whether a proxy of a set is ready to serve requests.
+// A proxy that is not ready is either being restarted in the background, or
+// it has failed for good.
+type ProxyStatus struct {
+	Alias    string `json:"alias"`
+	Default  bool   `json:"default,omitempty"`
+	Ready    bool   `json:"ready"`
+	Retrying bool   `json:"retrying,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
-// NewSet creates a proxy.Set from an alias to proxy map and a default proxy.
-func NewSet(proxies map[string]*T, defaultPxy *T) *Set {
-	if len(proxies) < 1 {
-		panic("set must contain at least one proxy")
+// NewSet creates a proxy.Set from an alias to proxy map and a default proxy
+// alias. Proxies that are not ready yet should be added with `SetNotReady`.
+func NewSet(proxies map[string]*T, defaultAlias string) *Set {
+	s := &Set{
+		proxies:      make(map[string]*T, len(proxies)),
+		notReady:     make(map[string]notReadyProxy),
+		defaultAlias: defaultAlias,
 	}
-	if defaultPxy == nil {
-		panic("default proxy must be provided")
+	for alias, pxy := range proxies {
+		s.proxies[alias] = pxy
 	}
-	return &Set{proxies: proxies, defaultPxy: defaultPxy}
+	return s
 }
 
-// Get returns a proxy with the specified alias or the default proxy if there
-// is no proxy with such alias.
+// Get returns a proxy with the specified alias or the default proxy if the
+// alias is empty. If the proxy has not been started yet, then
+// `ErrNotReady` is returned.
 func (s *Set) Get(alias string) (*T, error) {
 	if alias == "" {
-		return s.defaultPxy, nil
+		alias = s.defaultAlias
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if pxy := s.proxies[alias]; pxy != nil {
 		return pxy, nil
 	}
+	if nrp, ok := s.notReady[alias]; ok {
+		return nil, ErrNotReady{Alias: alias, Cause: nrp.err}
+	}
 	return nil, errors.Errorf("proxy `%s` does not exist", alias)
 }
+
+// GetForWrite is the same as `Get`, except it fails with
+// `errs.ErrMaintenance` if the set is in maintenance mode. It is to be used
+// to serve requests that produce messages or modify offsets.
+func (s *Set) GetForWrite(alias string) (*T, error) {
+	s.mu.RLock()
+	maintenance := s.maintenance
+	s.mu.RUnlock()
+	if maintenance {
+		return nil, errs.New(errs.ErrMaintenance, "service is in maintenance mode, only reads are allowed")
+	}
+	return s.Get(alias)
+}
+
+// GetForConsume is the same as `Get`, except it fails with `errs.ErrDraining`
+// if the set is draining. It is to be used to serve requests that consume
+// messages, and the returned function must be called when the request is over.
+func (s *Set) GetForConsume(alias string) (*T, func(), error) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return nil, nil, errs.New(errs.ErrDraining, "service is draining, consume requests are not accepted")
+	}
+	s.consumesInFlight++
+	s.mu.Unlock()
+	pxy, err := s.Get(alias)
+	if err != nil {
+		s.consumeDone()
+		return nil, nil, err
+	}
+	return pxy, s.consumeDone, nil
+}
+
+func (s *Set) consumeDone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consumesInFlight--
+	if s.consumesInFlight == 0 && s.drainedCh != nil {
+		close(s.drainedCh)
+		s.drainedCh = nil
+	}
+}
+
+// Drain makes the set reject new consume requests, and blocks until consume
+// requests in flight complete. Other requests are served as usual.
+func (s *Set) Drain() {
+	s.mu.Lock()
+	s.draining = true
+	if s.consumesInFlight == 0 {
+		s.mu.Unlock()
+		return
+	}
+	if s.drainedCh == nil {
+		s.drainedCh = make(chan struct{})
+	}
+	drainedCh := s.drainedCh
+	s.mu.Unlock()
+	<-drainedCh
+}
+
+// Draining tells whether the set is draining.
+func (s *Set) Draining() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.draining
+}
+
+// SetMaintenance turns the maintenance mode of all proxies in the set on or
+// off.
+func (s *Set) SetMaintenance(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maintenance = enabled
+}
+
+// Maintenance tells whether the set is in maintenance mode.
+func (s *Set) Maintenance() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maintenance
+}
+
+// SetReady makes the proxy available in the set.
+func (s *Set) SetReady(alias string, pxy *T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notReady, alias)
+	s.proxies[alias] = pxy
+}
+
+// SetNotReady records the error that the proxy has failed to start with, and
+// whether it is being restarted in the background.
+func (s *Set) SetNotReady(alias string, err error, retrying bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notReady[alias] = notReadyProxy{err, retrying}
+}
+
+// Status returns readiness of all proxies in the set sorted by alias.
+func (s *Set) Status() []ProxyStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]ProxyStatus, 0, len(s.proxies)+len(s.notReady))
+	for alias := range s.proxies {
+		statuses = append(statuses, ProxyStatus{
+			Alias:   alias,
+			Default: alias == s.defaultAlias,
+			Ready:   true,
+		})
+	}
+	for alias, nrp := range s.notReady {
+		statuses = append(statuses, ProxyStatus{
+			Alias:    alias,
+			Default:  alias == s.defaultAlias,
+			Retrying: nrp.retrying,
+			Error:    nrp.err.Error(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Alias < statuses[j].Alias })
+	return statuses
+}
+
+// Readiness tells whether a service with proxies of the specified statuses is
+// ready to serve requests. It is not if some of the proxies are still being
+// started, or if none of them is ready. Proxies that have failed for good make
+// the service degraded, but not unready, for they will never become ready.
+func Readiness(pxyStatuses []ProxyStatus) (ready, degraded bool) {
+	retrying := false
+	for _, pxyStatus := range pxyStatuses {
+		switch {
+		case pxyStatus.Ready:
+			ready = true
+		case pxyStatus.Retrying:
+			retrying = true
+		default:
+			degraded = true
+		}
+	}
+	if retrying {
+		ready = false
+	}
+	return ready, degraded
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/pkg/errors"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SetSuite{})
+
+type SetSuite struct{}
+
+// Proxies that are not ready are reported with the error they failed to start
+// with, until they become ready.
+func (s *SetSuite) TestNotReady(c *C) {
+	foo, bar := &T{}, &T{}
+	set := NewSet(map[string]*T{"foo": foo}, "bar")
+	startErr := errors.New("kaboom")
+	set.SetNotReady("bar", startErr, true)
+
+	// When/Then
+	pxy, err := set.Get("foo")
+	c.Assert(err, IsNil)
+	c.Assert(pxy, Equals, foo)
+	_, err = set.Get("")
+	c.Assert(err, DeepEquals, ErrNotReady{Alias: "bar", Cause: startErr})
+	c.Assert(err.Error(), Equals, "proxy `bar` is not ready: kaboom")
+	_, err = set.Get("bazz")
+	c.Assert(err.Error(), Equals, "proxy `bazz` does not exist")
+	c.Assert(set.Status(), DeepEquals, []ProxyStatus{
+		{Alias: "bar", Default: true, Retrying: true, Error: "kaboom"},
+		{Alias: "foo", Ready: true},
+	})
+
+	// When
+	set.SetReady("bar", bar)
+
+	// Then
+	pxy, err = set.Get("")
+	c.Assert(err, IsNil)
+	c.Assert(pxy, Equals, bar)
+	c.Assert(set.Status(), DeepEquals, []ProxyStatus{
+		{Alias: "bar", Default: true, Ready: true},
+		{Alias: "foo", Ready: true},
+	})
+}
+
+// In maintenance mode proxies can be got for reads, but not for writes.
+func (s *SetSuite) TestMaintenance(c *C) {
+	foo := &T{}
+	set := NewSet(map[string]*T{"foo": foo}, "foo")
+
+	// When
+	set.SetMaintenance(true)
+
+	// Then
+	c.Assert(set.Maintenance(), Equals, true)
+	pxy, err := set.Get("")
+	c.Assert(err, IsNil)
+	c.Assert(pxy, Equals, foo)
+	_, err = set.GetForWrite("")
+	c.Assert(errs.Is(err, errs.ErrMaintenance), Equals, true)
+
+	// When
+	set.SetMaintenance(false)
+
+	// Then
+	c.Assert(set.Maintenance(), Equals, false)
+	pxy, err = set.GetForWrite("")
+	c.Assert(err, IsNil)
+	c.Assert(pxy, Equals, foo)
+}
+
+// Drain rejects new consume requests and waits for those in flight, while
+// other requests are still served.
+func (s *SetSuite) TestDrain(c *C) {
+	foo := &T{}
+	set := NewSet(map[string]*T{"foo": foo}, "foo")
+	_, done, err := set.GetForConsume("")
+	c.Assert(err, IsNil)
+
+	// When
+	drainedCh := make(chan struct{})
+	go func() {
+		set.Drain()
+		close(drainedCh)
+	}()
+
+	// Then
+	for !set.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	_, _, err = set.GetForConsume("")
+	c.Assert(errs.Is(err, errs.ErrDraining), Equals, true)
+	c.Assert(err.Error(), Equals, "service is draining, consume requests are not accepted")
+	pxy, err := set.Get("")
+	c.Assert(err, IsNil)
+	c.Assert(pxy, Equals, foo)
+	select {
+	case <-drainedCh:
+		c.Error("Drain completed while a consume request is in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// When
+	done()
+
+	// Then
+	select {
+	case <-drainedCh:
+	case <-time.After(3 * time.Second):
+		c.Error("Drain did not complete")
+	}
+}
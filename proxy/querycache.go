@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/none"
+)
+
+// Kinds of queries that results are cached for.
+const (
+	queryGroupOffsets      = "group_offsets"
+	queryAllGroupOffsets   = "all_group_offsets"
+	queryTopicConsumers    = "topic_consumers"
+	queryAllTopicConsumers = "all_topic_consumers"
+)
+
+type queryKey struct {
+	kind  string
+	group string
+	topic string
+}
+
+// queryCache keeps results of expensive queries for `ttl`, so that concurrent
+// and repeated queries are served without hitting the clusters. Concurrent
+// identical queries are coalesced, that is only one of them is executed, and
+// the others wait for its result. Failed queries are not cached. Cached
+// results are shared by all callers and must not be modified.
+type queryCache struct {
+	ttl time.Duration
+
+	mu          sync.Mutex
+	entries     map[queryKey]*queryEntry
+	lastCleanup time.Time
+
+	// To be used in tests only
+	now func() time.Time
+}
+
+type queryEntry struct {
+	doneCh    chan none.T
+	result    interface{}
+	err       error
+	fetchedAt time.Time
+}
+
+func newQueryCache(ttl time.Duration) *queryCache {
+	return &queryCache{
+		ttl:     ttl,
+		entries: make(map[queryKey]*queryEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns the result of the query identified by the key, and the time it
+// was fetched at. The result is fetched if it is not in the cache, it has
+// expired, or `refresh` is true. If the cache TTL is zero, then results are
+// always fetched.
+func (qc *queryCache) get(key queryKey, refresh bool, fetch func() (interface{}, error)) (interface{}, time.Time, error) {
+	if qc.ttl <= 0 {
+		fetchedAt := qc.now()
+		result, err := fetch()
+		return result, fetchedAt, err
+	}
+	qc.mu.Lock()
+	now := qc.now()
+	qc.cleanup(now)
+	qe := qc.entries[key]
+	if qe != nil {
+		select {
+		case <-qe.doneCh:
+			if refresh || qe.err != nil || now.Sub(qe.fetchedAt) >= qc.ttl {
+				qe = nil
+			}
+		default:
+			// The query is being executed right now, so its result is fresh
+			// enough even if a refresh is requested.
+		}
+	}
+	if qe != nil {
+		qc.mu.Unlock()
+		<-qe.doneCh
+		return qe.result, qe.fetchedAt, qe.err
+	}
+	qe = &queryEntry{doneCh: make(chan none.T), fetchedAt: now}
+	qc.entries[key] = qe
+	qc.mu.Unlock()
+
+	qe.result, qe.err = fetch()
+	close(qe.doneCh)
+	if qe.err != nil {
+		qc.mu.Lock()
+		if qc.entries[key] == qe {
+			delete(qc.entries, key)
+		}
+		qc.mu.Unlock()
+	}
+	return qe.result, qe.fetchedAt, qe.err
+}
+
+// cleanup deletes expired entries, but not more often than once per TTL. It
+// must be called with the mutex held.
+func (qc *queryCache) cleanup(now time.Time) {
+	if now.Sub(qc.lastCleanup) < qc.ttl {
+		return
+	}
+	for key, qe := range qc.entries {
+		select {
+		case <-qe.doneCh:
+			if now.Sub(qe.fetchedAt) >= qc.ttl {
+				delete(qc.entries, key)
+			}
+		default:
+		}
+	}
+	qc.lastCleanup = now
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&QueryCacheSuite{})
+
+type QueryCacheSuite struct{}
+
+// Results are served from the cache until they expire or a refresh is
+// requested.
+func (s *QueryCacheSuite) TestExpireAndRefresh(c *C) {
+	now := time.Unix(1000, 0)
+	qc := newQueryCache(5 * time.Second)
+	qc.now = func() time.Time { return now }
+	fetches := 0
+	fetch := func() (interface{}, error) {
+		fetches++
+		return fetches, nil
+	}
+	key := queryKey{queryGroupOffsets, "g1", "t1"}
+
+	// When/Then
+	result, fetchedAt, err := qc.get(key, false, fetch)
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, 1)
+	c.Assert(fetchedAt, Equals, now)
+
+	now = now.Add(4 * time.Second)
+	result, fetchedAt, _ = qc.get(key, false, fetch)
+	c.Assert(result, Equals, 1)
+	c.Assert(fetchedAt, Equals, time.Unix(1000, 0))
+
+	result, _, _ = qc.get(queryKey{queryGroupOffsets, "g1", "t2"}, false, fetch)
+	c.Assert(result, Equals, 2)
+
+	result, fetchedAt, _ = qc.get(key, true, fetch)
+	c.Assert(result, Equals, 3)
+	c.Assert(fetchedAt, Equals, now)
+
+	now = now.Add(5 * time.Second)
+	result, _, _ = qc.get(key, false, fetch)
+	c.Assert(result, Equals, 4)
+	// Expired entries are cleaned up.
+	c.Assert(len(qc.entries), Equals, 1)
+}
+
+// Failed queries are not cached.
+func (s *QueryCacheSuite) TestErrorNotCached(c *C) {
+	qc := newQueryCache(time.Minute)
+	fetchErr := errors.New("Kaboom!")
+	key := queryKey{queryAllTopicConsumers, "", "t1"}
+
+	// When
+	_, _, err := qc.get(key, false, func() (interface{}, error) { return nil, fetchErr })
+
+	// Then
+	c.Assert(err, Equals, fetchErr)
+	result, _, err := qc.get(key, false, func() (interface{}, error) { return 42, nil })
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, 42)
+}
+
+// Concurrent identical queries are executed only once.
+func (s *QueryCacheSuite) TestCoalesced(c *C) {
+	qc := newQueryCache(time.Minute)
+	key := queryKey{queryAllGroupOffsets, "g1", ""}
+	releaseCh := make(chan struct{})
+	startedCh := make(chan struct{})
+	var mu sync.Mutex
+	fetches := 0
+	fetch := func() (interface{}, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		close(startedCh)
+		<-releaseCh
+		return "foo", nil
+	}
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, _ = qc.get(key, false, fetch)
+	}()
+	<-startedCh
+
+	// When
+	for i := 1; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Even a refresh joins the query in progress.
+			results[i], _, _ = qc.get(key, i == 2, fetch)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(releaseCh)
+	wg.Wait()
+
+	// Then
+	c.Assert(fetches, Equals, 1)
+	c.Assert(results, DeepEquals, []interface{}{"foo", "foo", "foo"})
+}
+
+// With zero TTL results are always fetched.
+func (s *QueryCacheSuite) TestDisabled(c *C) {
+	qc := newQueryCache(0)
+	fetches := 0
+	fetch := func() (interface{}, error) {
+		fetches++
+		return fetches, nil
+	}
+	key := queryKey{queryTopicConsumers, "g1", "t1"}
+
+	// When
+	qc.get(key, false, fetch)
+	result, _, _ := qc.get(key, false, fetch)
+
+	// Then
+	c.Assert(result, Equals, 2)
+	c.Assert(len(qc.entries), Equals, 0)
+}
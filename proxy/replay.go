@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"io"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/replay"
+)
+
+// Replay produces messages read from `r` in the JSON lines format, see
+// `replay.Stream`, to the topic at most `rate` messages per second, or as fast as
+// possible if `rate` is zero. Messages go straight to the producer, so unlike
+// `AsyncProduce` they are not checked by a validation webhook, for they are
+// meant to be data that has been produced before, e.g. restored from an
+// archive. It returns when all messages are either committed or failed.
+// Messages are accounted to `tenant` the same way as by `ProduceToPartition`.
+func (p *T) Replay(tenant string, r io.Reader, topic string, rate int) (replay.Stats, error) {
+	if err := p.sw.check(OpProduce, topic); err != nil {
+		return replay.Stats{}, err
+	}
+	prod := p.producer()
+	return replay.Stream(r, rate, func(key, value []byte, done func(error)) {
+		var keyEnc sarama.Encoder
+		if key != nil {
+			keyEnc = sarama.ByteEncoder(key)
+		}
+		valueEnc := sarama.ByteEncoder(value)
+		prod.AsyncProduceNotify(topic, keyEnc, valueEnc, func(_ *sarama.ProducerMessage, err error) {
+			done(err)
+		})
+		if p.acc != nil {
+			p.acc.CountProduced(p.tenant(tenant), topic, encodedLen(keyEnc)+encodedLen(valueEnc))
+		}
+	})
+}
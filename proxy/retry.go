@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/pkg/errors"
+)
+
+// RetryResult tells where a message was produced to by `Retry`.
+type RetryResult struct {
+	// Either the retry topic of the next tier, or the dead letter topic if
+	// the message has been retried in all tiers.
+	Topic string
+	// The number of times the message has been retried, including this one.
+	Retries      int
+	DeadLettered bool
+}
+
+// Retry schedules redelivery of a message that has been consumed with `NoAck`,
+// identified by the partition and the offset of the `ack`, to the group after
+// the delay of the next retry tier, see `Config.Consumer.RetryTiers`. The
+// message is produced to the retry topic of the tier, or to the dead letter
+// topic if it has been retried in all tiers, and then acknowledged with the
+// metadata of the `ack`. The `topic` is the one the message was consumed from,
+// that is either the original topic or one of its retry topics.
+//
+// Retried messages are consumed from retry topics by the same group, e.g. by
+// consuming the original topic and all its retry topics with `ConsumeTopics`.
+// They carry the original key and value, and the number of retries in
+// `consumer.Message.Retries`.
+func (p *T) Retry(group, topic string, ack ack) (RetryResult, error) {
+	origTopic, _, isRetryTopic := p.cfg.ParseRetryTopic(topic)
+	if !isRetryTopic {
+		origTopic = topic
+	}
+	tiers := p.cfg.ConsumerRetryTiers(origTopic)
+	if len(tiers) == 0 {
+		return RetryResult{}, errs.New(errs.ErrInvalidParam, "retries are not configured for the topic")
+	}
+	if err := p.sw.check(OpProduce, origTopic); err != nil {
+		return RetryResult{}, err
+	}
+	p.eventsChMapMu.RLock()
+	_, ok := p.eventsChMap[eventsChID{group, topic, ack.partition}]
+	p.eventsChMapMu.RUnlock()
+	if !ok {
+		return RetryResult{}, ErrNotConsumed
+	}
+
+	msgs, err := p.adm.ReadMessages(topic, ack.partition, ack.offset, 1)
+	if err != nil {
+		return RetryResult{}, err
+	}
+	if len(msgs) == 0 || msgs[0].Offset != ack.offset {
+		return RetryResult{}, errs.New(errs.ErrInvalidParam, "message not found: offset=%d", ack.offset)
+	}
+	env := config.RetryEnvelope{
+		Group:     group,
+		Topic:     origTopic,
+		Partition: ack.partition,
+		Offset:    ack.offset,
+		Key:       msgs[0].Key,
+		Value:     msgs[0].Value,
+	}
+	if isRetryTopic {
+		if err := json.Unmarshal(msgs[0].Value, &env); err != nil {
+			return RetryResult{}, errors.Wrap(err, "invalid retry message")
+		}
+	}
+	env.Retries++
+	env.Timestamp = time.Now().UTC()
+
+	var res RetryResult
+	var encoded []byte
+	if env.Retries > len(tiers) {
+		res = RetryResult{Topic: origTopic + config.DeadLetterTopicSuffix, Retries: env.Retries - 1, DeadLettered: true}
+		encoded, err = json.Marshal(config.DeadLetter{
+			Group:     env.Group,
+			Topic:     env.Topic,
+			Partition: env.Partition,
+			Offset:    env.Offset,
+			Key:       env.Key,
+			Value:     env.Value,
+			Timestamp: env.Timestamp,
+		})
+	} else {
+		res = RetryResult{Topic: config.RetryTopic(origTopic, tiers[env.Retries-1]), Retries: env.Retries}
+		encoded, err = json.Marshal(env)
+	}
+	if err != nil {
+		return RetryResult{}, err
+	}
+	var key sarama.Encoder
+	if env.Key != nil {
+		key = sarama.ByteEncoder(env.Key)
+	}
+	if _, err := p.producer().Produce(res.Topic, key, sarama.ByteEncoder(encoded)); err != nil {
+		return RetryResult{}, errors.Wrapf(err, "failed to produce to %s", res.Topic)
+	}
+	if err := p.sendAckEvent(group, topic, ack.partition, consumer.AckWithMeta(ack.offset, ack.meta)); err != nil {
+		return RetryResult{}, err
+	}
+	return res, nil
+}
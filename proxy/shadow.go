@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/admin"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrShadowSameGroup = errors.New("shadow group must differ from the source group")
+	ErrShadowExists    = errors.New("shadow group already exists")
+	ErrShadowNotFound  = errors.New("shadow group does not exist")
+)
+
+type shadowID struct {
+	shadow string
+	topic  string
+}
+
+// shadowMirror periodically copies offsets committed by a source group for a
+// topic to a shadow group.
+type shadowMirror struct {
+	actorID *actor.ID
+	adm     *admin.T
+	source  string
+	id      shadowID
+	period  time.Duration
+	stopCh  chan none.T
+	wg      sync.WaitGroup
+}
+
+// StartShadow makes the `shadow` group mirror offsets committed by the
+// `source` group for the specified topic. Offsets are copied right away and
+// then every `Consumer.OffsetsCommitInterval`, until either `StopShadow` is
+// called or the shadow group is consumed from, whatever happens first. So
+// clients can switch to the shadow group at any time and continue from the
+// position of the source group, give or take the offsets committed by the
+// source group since the last copy.
+//
+// Shadow groups are kept in memory only, and so they stop mirroring when the
+// proxy is stopped.
+func (p *T) StartShadow(source, shadow, topic string) error {
+	if source == shadow {
+		return ErrShadowSameGroup
+	}
+	id := shadowID{shadow, topic}
+	p.shadowsMu.Lock()
+	defer p.shadowsMu.Unlock()
+	if _, ok := p.shadows[id]; ok {
+		return ErrShadowExists
+	}
+	sm := &shadowMirror{
+		actorID: p.actorID.NewChild("shadow", shadow, topic),
+		adm:     p.adm,
+		source:  source,
+		id:      id,
+		period:  p.cfg.Consumer.OffsetsCommitInterval,
+		stopCh:  make(chan none.T),
+	}
+	// The first copy is made synchronously to report invalid parameters.
+	if err := sm.copyOffsets(); err != nil {
+		return err
+	}
+	p.shadows[id] = sm
+	actor.Spawn(sm.actorID, &sm.wg, sm.run)
+	return nil
+}
+
+// StopShadow stops mirroring of the source group offsets to the `shadow`
+// group for the specified topic.
+func (p *T) StopShadow(shadow, topic string) error {
+	id := shadowID{shadow, topic}
+	p.shadowsMu.Lock()
+	sm, ok := p.shadows[id]
+	delete(p.shadows, id)
+	p.shadowsMu.Unlock()
+	if !ok {
+		return ErrShadowNotFound
+	}
+	sm.stop()
+	return nil
+}
+
+// promoteShadow stops offset mirroring if the group is a shadow of another
+// group for the topic.
+func (p *T) promoteShadow(group, topic string) {
+	id := shadowID{group, topic}
+	p.shadowsMu.RLock()
+	_, ok := p.shadows[id]
+	p.shadowsMu.RUnlock()
+	if !ok {
+		return
+	}
+	if err := p.StopShadow(group, topic); err == nil {
+		log.Infof("<%s> shadow promoted: group=%s, topic=%s", p.actorID, group, topic)
+	}
+}
+
+// stopShadows stops all shadow group mirrors.
+func (p *T) stopShadows() {
+	p.shadowsMu.Lock()
+	shadows := p.shadows
+	p.shadows = make(map[shadowID]*shadowMirror)
+	p.shadowsMu.Unlock()
+	for _, sm := range shadows {
+		sm.stop()
+	}
+}
+
+func (sm *shadowMirror) run() {
+	ticker := time.NewTicker(sm.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := sm.copyOffsets(); err != nil {
+				log.Errorf("<%s> failed to copy offsets: err=(%s)", sm.actorID, err)
+			}
+		case <-sm.stopCh:
+			return
+		}
+	}
+}
+
+func (sm *shadowMirror) stop() {
+	close(sm.stopCh)
+	sm.wg.Wait()
+}
+
+// copyOffsets commits offsets and metadata of the source group to the shadow
+// group. Partitions that the source group has not committed offsets for are
+// skipped.
+func (sm *shadowMirror) copyOffsets() error {
+	offsets, err := sm.adm.GetGroupOffsets(sm.source, sm.id.topic)
+	if err != nil {
+		return err
+	}
+	committed := offsets[:0]
+	for _, po := range offsets {
+		if po.Offset >= 0 {
+			committed = append(committed, po)
+		}
+	}
+	if len(committed) == 0 {
+		return nil
+	}
+	return sm.adm.SetGroupOffsets(sm.id.shadow, sm.id.topic, committed)
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/errs"
+)
+
+// Operations that can be disabled for a topic.
+const (
+	OpProduce = "produce"
+	OpConsume = "consume"
+)
+
+// topicSwitches keeps track of topics that produce or consume is disabled for,
+// along with the reasons reported to clients.
+type topicSwitches struct {
+	mu       sync.RWMutex
+	disabled map[string]map[string]string
+}
+
+func newTopicSwitches(cfg *config.Proxy) *topicSwitches {
+	ts := &topicSwitches{disabled: map[string]map[string]string{
+		OpProduce: make(map[string]string),
+		OpConsume: make(map[string]string),
+	}}
+	for topic, reason := range cfg.DisabledTopics.Produce {
+		ts.disabled[OpProduce][topic] = reason
+	}
+	for topic, reason := range cfg.DisabledTopics.Consume {
+		ts.disabled[OpConsume][topic] = reason
+	}
+	return ts
+}
+
+// check returns `errs.ErrDisabled` if the operation is disabled for the topic.
+func (ts *topicSwitches) check(op, topic string) error {
+	ts.mu.RLock()
+	reason, disabled := ts.disabled[op][topic]
+	ts.mu.RUnlock()
+	if !disabled {
+		return nil
+	}
+	if reason == "" {
+		return errs.New(errs.ErrDisabled, "%s is disabled for topic %s", op, topic)
+	}
+	return errs.New(errs.ErrDisabled, "%s is disabled for topic %s: %s", op, topic, reason)
+}
+
+func (ts *topicSwitches) set(op, topic string, enabled bool, reason string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	opDisabled, ok := ts.disabled[op]
+	if !ok {
+		return errs.New(errs.ErrInvalidParam, "unknown operation: %s", op)
+	}
+	if enabled {
+		delete(opDisabled, topic)
+		return nil
+	}
+	opDisabled[topic] = reason
+	return nil
+}
+
+func (ts *topicSwitches) snapshot() map[string]map[string]string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	snapshot := make(map[string]map[string]string, len(ts.disabled))
+	for op, opDisabled := range ts.disabled {
+		snapshot[op] = make(map[string]string, len(opDisabled))
+		for topic, reason := range opDisabled {
+			snapshot[op][topic] = reason
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/errs"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SwitchesSuite{})
+
+type SwitchesSuite struct{}
+
+// Topics disabled in the config are disabled only for the configured
+// operation.
+func (s *SwitchesSuite) TestConfigured(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.DisabledTopics.Produce = map[string]string{"foo": "migrating"}
+	cfg.DisabledTopics.Consume = map[string]string{"bar": ""}
+
+	// When
+	ts := newTopicSwitches(cfg)
+
+	// Then
+	err := ts.check(OpProduce, "foo")
+	c.Assert(errs.Is(err, errs.ErrDisabled), Equals, true)
+	c.Assert(err.Error(), Equals, "produce is disabled for topic foo: migrating")
+	c.Assert(ts.check(OpConsume, "foo"), IsNil)
+	err = ts.check(OpConsume, "bar")
+	c.Assert(errs.Is(err, errs.ErrDisabled), Equals, true)
+	c.Assert(err.Error(), Equals, "consume is disabled for topic bar")
+	c.Assert(ts.check(OpProduce, "bar"), IsNil)
+	c.Assert(ts.check(OpProduce, "bazz"), IsNil)
+}
+
+// Topics can be disabled and enabled back at runtime, including those disabled
+// in the config.
+func (s *SwitchesSuite) TestSet(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.DisabledTopics.Produce = map[string]string{"foo": "migrating"}
+	ts := newTopicSwitches(cfg)
+
+	// When
+	c.Assert(ts.set(OpProduce, "foo", true, ""), IsNil)
+	c.Assert(ts.set(OpConsume, "bar", false, "poison message"), IsNil)
+
+	// Then
+	c.Assert(ts.check(OpProduce, "foo"), IsNil)
+	c.Assert(errs.Is(ts.check(OpConsume, "bar"), errs.ErrDisabled), Equals, true)
+	c.Assert(ts.snapshot(), DeepEquals, map[string]map[string]string{
+		OpProduce: {},
+		OpConsume: {"bar": "poison message"},
+	})
+}
+
+// Operations other than produce and consume cannot be disabled.
+func (s *SwitchesSuite) TestUnknownOp(c *C) {
+	ts := newTopicSwitches(config.DefaultProxy())
+
+	// When
+	err := ts.set("delete", "foo", false, "")
+
+	// Then
+	c.Assert(errs.Is(err, errs.ErrInvalidParam), Equals, true)
+	c.Assert(ts.snapshot(), DeepEquals, map[string]map[string]string{
+		OpProduce: {},
+		OpConsume: {},
+	})
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxRejectReasonLength = 1024
+)
+
+// ErrRejected is returned by produce functions when a message is rejected by
+// the validation webhook of the topic.
+type ErrRejected struct {
+	Status int
+	Reason string
+}
+
+func (e ErrRejected) Error() string {
+	return fmt.Sprintf("message rejected by validation webhook: status=%d, reason=(%s)", e.Status, e.Reason)
+}
+
+// validationRequest is the JSON document posted to validation webhooks.
+type validationRequest struct {
+	Topic string `json:"topic"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// validator checks messages with per topic validation webhooks.
+type validator struct {
+	cfg        *config.Proxy
+	httpClient *http.Client
+}
+
+func newValidator(cfg *config.Proxy) *validator {
+	return &validator{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Producer.ValidationTimeout},
+	}
+}
+
+// validate sends the message to the validation webhook of the topic, if one
+// is configured. It returns `ErrRejected` if the webhook responds with a non
+// 2xx status code, or another error if the webhook could not be called at all.
+func (v *validator) validate(topic string, key, message sarama.Encoder) error {
+	topicCfg := v.cfg.Producer.Topics[topic]
+	if topicCfg == nil || topicCfg.ValidationWebhook == "" {
+		return nil
+	}
+	var req validationRequest
+	var err error
+	req.Topic = topic
+	if key != nil {
+		if req.Key, err = key.Encode(); err != nil {
+			return errors.Wrap(err, "failed to encode key")
+		}
+	}
+	if message != nil {
+		if req.Value, err = message.Encode(); err != nil {
+			return errors.Wrap(err, "failed to encode message")
+		}
+	}
+	encodedReq, err := json.Marshal(req)
+	if err != nil {
+		panic(err)
+	}
+	res, err := v.httpClient.Post(topicCfg.ValidationWebhook, "application/json", bytes.NewReader(encodedReq))
+	if err != nil {
+		return errors.Wrap(err, "validation webhook failed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	reason, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxRejectReasonLength))
+	return ErrRejected{Status: res.StatusCode, Reason: string(reason)}
+}
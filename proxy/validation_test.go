@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&ValidatorSuite{})
+
+type ValidatorSuite struct {
+	cfg      *config.Proxy
+	webhook  *httptest.Server
+	status   int
+	requests []validationRequest
+}
+
+func (s *ValidatorSuite) SetUpTest(c *C) {
+	s.status = http.StatusOK
+	s.requests = nil
+	s.webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req validationRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Check(json.Unmarshal(body, &req), IsNil)
+		s.requests = append(s.requests, req)
+		w.WriteHeader(s.status)
+		w.Write([]byte("Policy violation"))
+	}))
+	s.cfg = config.DefaultProxy()
+	s.cfg.Producer.Topics = map[string]*config.ProducerTopic{
+		"foo": {ValidationWebhook: s.webhook.URL},
+	}
+}
+
+func (s *ValidatorSuite) TearDownTest(c *C) {
+	s.webhook.Close()
+}
+
+// Messages accepted by the webhook pass validation.
+func (s *ValidatorSuite) TestAccepted(c *C) {
+	v := newValidator(s.cfg)
+
+	// When
+	err := v.validate("foo", sarama.StringEncoder("bar"), sarama.StringEncoder("bazz"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(s.requests, DeepEquals, []validationRequest{
+		{Topic: "foo", Key: []byte("bar"), Value: []byte("bazz")}})
+}
+
+// If the webhook responds with a non 2xx status, then the message is rejected.
+func (s *ValidatorSuite) TestRejected(c *C) {
+	s.status = http.StatusForbidden
+	v := newValidator(s.cfg)
+
+	// When
+	err := v.validate("foo", nil, sarama.StringEncoder("bazz"))
+
+	// Then
+	c.Assert(err, DeepEquals, ErrRejected{Status: http.StatusForbidden, Reason: "Policy violation"})
+	c.Assert(s.requests, DeepEquals, []validationRequest{{Topic: "foo", Value: []byte("bazz")}})
+}
+
+// Messages to topics without a webhook are not validated.
+func (s *ValidatorSuite) TestNoWebhook(c *C) {
+	s.status = http.StatusForbidden
+	v := newValidator(s.cfg)
+
+	// When
+	err := v.validate("bar", nil, sarama.StringEncoder("bazz"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(len(s.requests), Equals, 0)
+}
+
+// If the webhook does not respond in time, then validation fails.
+func (s *ValidatorSuite) TestTimeout(c *C) {
+	blockCh := make(chan struct{})
+	slowWebhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blockCh
+	}))
+	defer slowWebhook.Close()
+	defer close(blockCh)
+	s.cfg.Producer.Topics["foo"].ValidationWebhook = slowWebhook.URL
+	s.cfg.Producer.ValidationTimeout = 100 * time.Millisecond
+	v := newValidator(s.cfg)
+
+	// When
+	err := v.validate("foo", nil, sarama.StringEncoder("bazz"))
+
+	// Then
+	c.Assert(err, ErrorMatches, "validation webhook failed: .*")
+	_, ok := err.(ErrRejected)
+	c.Assert(ok, Equals, false)
+}
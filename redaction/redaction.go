@@ -0,0 +1,93 @@
+// Package redaction keeps message fields of topics listed in
+// `config.Proxy.Redaction` out of logs and error messages. The fields are
+// replaced with their HMAC-SHA256 hashes, that allow to correlate log records
+// mentioning the same value without revealing it.
+package redaction
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/config"
+)
+
+var (
+	// The hash key used when none is configured. It is generated once, so
+	// that hashes logged by all components of the process can be correlated.
+	randomHashKeyOnce sync.Once
+	randomHashKey     []byte
+	randomHashKeyErr  error
+)
+
+// T tells which message fields are redacted, and makes their representations
+// to be logged.
+type T struct {
+	keys    map[string]bool
+	values  map[string]bool
+	hashKey []byte
+}
+
+// New creates a redactor for the proxy configuration. The configured hash key
+// is used if there is one, otherwise a random key is generated per process.
+func New(cfg *config.Proxy) (*T, error) {
+	r := &T{
+		keys:   make(map[string]bool),
+		values: make(map[string]bool),
+	}
+	for topic, fields := range cfg.Redaction.Topics {
+		for _, field := range fields {
+			switch field {
+			case config.RedactKey:
+				r.keys[topic] = true
+			case config.RedactValue:
+				r.values[topic] = true
+			}
+		}
+	}
+	if cfg.Redaction.HashKey != "" {
+		r.hashKey = []byte(cfg.Redaction.HashKey)
+		return r, nil
+	}
+	randomHashKeyOnce.Do(func() {
+		randomHashKey = make([]byte, sha256.Size)
+		if _, err := crand.Read(randomHashKey); err != nil {
+			randomHashKeyErr = fmt.Errorf("failed to generate redaction hash key, err=(%s)", err)
+		}
+	})
+	if randomHashKeyErr != nil {
+		return nil, randomHashKeyErr
+	}
+	r.hashKey = randomHashKey
+	return r, nil
+}
+
+// KeyRedacted tells whether keys of messages of the topic are redacted.
+func (r *T) KeyRedacted(topic string) bool {
+	return r.keys[topic]
+}
+
+// ValueRedacted tells whether values of messages of the topic are redacted.
+func (r *T) ValueRedacted(topic string) bool {
+	return r.values[topic]
+}
+
+// Error returns the text of an error that occurred while handling a message
+// of the topic, to be logged. If any field of the topic is redacted, then the
+// hash of the text is returned instead, for the error may quote fragments of
+// the message.
+func (r *T) Error(topic string, err error) string {
+	if r.keys[topic] || r.values[topic] {
+		return r.Hash([]byte(err.Error()))
+	}
+	return err.Error()
+}
+
+// Hash returns the keyed hash of the data.
+func (r *T) Hash(data []byte) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write(data)
+	return fmt.Sprintf("hmac-sha256:%x", mac.Sum(nil))
+}
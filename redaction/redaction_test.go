@@ -0,0 +1,75 @@
+package redaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type RedactionSuite struct{}
+
+var _ = Suite(&RedactionSuite{})
+
+// Only the configured fields of the configured topics are redacted, and they
+// are replaced with their keyed hashes.
+func (s *RedactionSuite) TestFields(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Redaction.Topics = map[string][]string{"foo": {"key", "value"}, "bar": {"value"}}
+	cfg.Redaction.HashKey = "s4lt"
+
+	// When
+	r, err := New(cfg)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.KeyRedacted("foo"), Equals, true)
+	c.Assert(r.ValueRedacted("foo"), Equals, true)
+	c.Assert(r.KeyRedacted("bar"), Equals, false)
+	c.Assert(r.ValueRedacted("bar"), Equals, true)
+	c.Assert(r.KeyRedacted("bazz"), Equals, false)
+	c.Assert(r.ValueRedacted("bazz"), Equals, false)
+	c.Assert(r.Hash([]byte("foo")), Equals, "hmac-sha256:e783caa0abc14279da74bf59685cd6ebd421843f860bc6dcf8462c2a52ecd207")
+}
+
+// Errors related to messages of topics with any redacted field are replaced
+// with their hashes, for they may quote the messages.
+func (s *RedactionSuite) TestError(c *C) {
+	cfg := config.DefaultProxy()
+	cfg.Redaction.Topics = map[string][]string{"foo": {"key"}, "bar": {"value"}}
+	cfg.Redaction.HashKey = "s4lt"
+	r, err := New(cfg)
+	c.Assert(err, IsNil)
+	msgErr := errors.New("invalid value: s3cr3t")
+
+	c.Assert(r.Error("foo", msgErr), Equals, r.Hash([]byte("invalid value: s3cr3t")))
+	c.Assert(r.Error("bar", msgErr), Equals, r.Hash([]byte("invalid value: s3cr3t")))
+	c.Assert(r.Error("bazz", msgErr), Equals, "invalid value: s3cr3t")
+}
+
+// If no hash key is configured then a random one is generated, that is shared
+// by all redactors of the process, so that their hashes can be correlated.
+func (s *RedactionSuite) TestRandomHashKey(c *C) {
+	cfg := config.DefaultProxy()
+
+	// When
+	r1, err1 := New(cfg)
+	r2, err2 := New(cfg)
+
+	// Then
+	c.Assert(err1, IsNil)
+	c.Assert(err2, IsNil)
+	c.Assert(len(r1.hashKey), Equals, 32)
+	c.Assert(r1.Hash([]byte("foo")), Equals, r2.Hash([]byte("foo")))
+
+	cfg.Redaction.HashKey = "s4lt"
+	r3, err := New(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(string(r3.hashKey), Equals, "s4lt")
+	c.Assert(r3.Hash([]byte("foo")), Not(Equals), r1.Hash([]byte("foo")))
+}
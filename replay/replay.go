@@ -0,0 +1,90 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a message to be replayed, as it is read from a line of a JSON
+// lines file. Lines written by the export API endpoint and by the producer
+// shutdown spool have this format. Only the key and the value are replayed,
+// other fields are ignored.
+type Message struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ProduceFn submits a message to Kafka asynchronously, and calls `done` with
+// the submission error, if any, when the result is known.
+type ProduceFn func(key, value []byte, done func(error))
+
+// Stats summarizes a replay.
+type Stats struct {
+	// The number of messages read from the file.
+	Messages int64 `json:"messages"`
+	// The number of messages that failed to be produced.
+	Failed int64   `json:"failed"`
+	Bytes  int64   `json:"bytes"`
+	TookMs float64 `json:"took_ms"`
+}
+
+// Stream reads messages from `r`, one JSON document per line, and submits them
+// with `produce` at most `rate` messages per second, or as fast as possible
+// if `rate` is zero. Empty lines are skipped. It returns when all submitted
+// messages are either committed or failed. If a line cannot be parsed, then
+// reading stops and an error is returned along with stats of messages
+// submitted before.
+func Stream(r io.Reader, rate int, produce ProduceFn) (Stats, error) {
+	begin := time.Now()
+	var (
+		stats   Stats
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		readErr error
+	)
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			readErr = errors.Wrap(err, "failed to read file")
+			break
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var msg Message
+			if jsonErr := json.Unmarshal(trimmed, &msg); jsonErr != nil {
+				readErr = errors.Errorf("invalid message at line %d: %s", lineNo, jsonErr)
+				break
+			}
+			if rate > 0 {
+				// Messages are paced evenly from the beginning of the
+				// replay, so that short stalls are made up for.
+				time.Sleep(time.Until(begin.Add(time.Duration(stats.Messages) * time.Second / time.Duration(rate))))
+			}
+			stats.Messages++
+			stats.Bytes += int64(len(msg.Key) + len(msg.Value))
+			wg.Add(1)
+			produce(msg.Key, msg.Value, func(err error) {
+				if err != nil {
+					mu.Lock()
+					stats.Failed++
+					mu.Unlock()
+				}
+				wg.Done()
+			})
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	stats.TookMs = float64(time.Since(begin)) / float64(time.Millisecond)
+	return stats, readErr
+}
@@ -0,0 +1,103 @@
+package replay
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ReplaySuite{})
+
+type ReplaySuite struct{}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+// Keys and values are base64 encoded, the way they are written by the export
+// endpoint, and empty lines are skipped.
+func (s *ReplaySuite) TestStream(c *C) {
+	input := `{"key":"Zm9v","value":"YmFy","partition":1,"offset":10}
+
+{"value":"YmF6"}
+`
+	var produced []string
+
+	// When
+	stats, err := Stream(strings.NewReader(input), 0, func(key, value []byte, done func(error)) {
+		produced = append(produced, string(key)+":"+string(value))
+		done(nil)
+	})
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(produced, DeepEquals, []string{"foo:bar", ":baz"})
+	c.Assert(stats.Messages, Equals, int64(2))
+	c.Assert(stats.Failed, Equals, int64(0))
+	c.Assert(stats.Bytes, Equals, int64(9))
+}
+
+// Failures reported asynchronously are counted, and Stream waits for all of
+// them.
+func (s *ReplaySuite) TestFailed(c *C) {
+	input := "{\"value\":\"YQ==\"}\n{\"value\":\"Yg==\"}\n{\"value\":\"Yw==\"}"
+	var wg sync.WaitGroup
+
+	// When
+	stats, err := Stream(strings.NewReader(input), 0, func(key, value []byte, done func(error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+			if string(value) == "b" {
+				done(errors.New("kaboom"))
+				return
+			}
+			done(nil)
+		}()
+	})
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(stats.Messages, Equals, int64(3))
+	c.Assert(stats.Failed, Equals, int64(1))
+	wg.Wait()
+}
+
+// Reading stops at an invalid line, and the messages submitted before are
+// reported.
+func (s *ReplaySuite) TestInvalidLine(c *C) {
+	input := "{\"value\":\"YQ==\"}\nfoo\n{\"value\":\"Yw==\"}\n"
+	produced := 0
+
+	// When
+	stats, err := Stream(strings.NewReader(input), 0, func(key, value []byte, done func(error)) {
+		produced++
+		done(nil)
+	})
+
+	// Then
+	c.Assert(err, ErrorMatches, "invalid message at line 2: .*")
+	c.Assert(produced, Equals, 1)
+	c.Assert(stats.Messages, Equals, int64(1))
+}
+
+// Messages are submitted no faster than the given rate.
+func (s *ReplaySuite) TestRate(c *C) {
+	input := strings.Repeat("{\"value\":\"YQ==\"}\n", 5)
+
+	// When
+	stats, err := Stream(strings.NewReader(input), 100, func(key, value []byte, done func(error)) {
+		done(nil)
+	})
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(stats.Messages, Equals, int64(5))
+	// The 5th message is submitted 40ms after the first one.
+	c.Assert(stats.TookMs >= 40, Equals, true, Commentf("took=%vms", stats.TookMs))
+}
@@ -0,0 +1,173 @@
+package grpcsrv
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/auth"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Methods of this service are served without authentication, so that load
+// balancers can check health without credentials.
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// authenticator runs requests through a chain of authenticators built from
+// `config.App.GRPCAuth`. The first one in the chain accepts requests with
+// either a valid token or a valid client certificate, if any of those are
+// configured, and the rest are the ones set by the embedding application.
+type authenticator struct {
+	chain       []auth.Authenticator
+	clientCerts bool
+
+	// IDs of configured API tokens by their SHA-256 hashes. An ID is a prefix
+	// of the hash, that identifies a token without revealing it.
+	tokenIDs map[[sha256.Size]byte]string
+}
+
+func newAuthenticator(cfg *config.App) *authenticator {
+	a := authenticator{tokenIDs: make(map[[sha256.Size]byte]string, len(cfg.GRPCAuth.Tokens))}
+	var anyOf []auth.Authenticator
+	if len(cfg.GRPCAuth.Tokens) != 0 {
+		anyOf = append(anyOf, auth.Tokens(cfg.GRPCAuth.Tokens))
+		for _, token := range cfg.GRPCAuth.Tokens {
+			hash := sha256.Sum256([]byte(token))
+			a.tokenIDs[hash] = hex.EncodeToString(hash[:4])
+		}
+	}
+	if cfg.GRPCTLS.ClientCAFile != "" {
+		anyOf = append(anyOf, auth.ClientCert(cfg.GRPCAuth.ClientCertCNs))
+		a.clientCerts = true
+	}
+	if len(anyOf) != 0 {
+		a.chain = append(a.chain, auth.Any(anyOf...))
+	}
+	a.chain = append(a.chain, cfg.GRPCAuth.Authenticators...)
+	return &a
+}
+
+// authenticate returns an error if any authenticator in the chain rejects the
+// request. Errors are converted to `Unauthenticated` unless authenticators
+// return gRPC errors themselves.
+func (a *authenticator) authenticate(ctx context.Context, fullMethod string) error {
+	if strings.HasPrefix(fullMethod, healthServicePrefix) {
+		return nil
+	}
+	for _, authenticator := range a.chain {
+		if err := authenticator.Authenticate(ctx, fullMethod); err != nil {
+			if grpc.Code(err) != codes.Unknown {
+				return err
+			}
+			return grpc.Errorf(codes.Unauthenticated, "%s", err)
+		}
+	}
+	return nil
+}
+
+// tenant returns the principal that the request has been authenticated as, to
+// account produced and consumed messages to. That is the common name of the
+// verified client certificate, or the ID of the API token that the request
+// carries. An empty string is returned if the principal is not known, then
+// the proxy alias is used as the tenant.
+func (a *authenticator) tenant(ctx context.Context) string {
+	if a.clientCerts {
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok &&
+				len(tlsInfo.State.VerifiedChains) != 0 && len(tlsInfo.State.VerifiedChains[0]) != 0 {
+				return "cert:" + tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+			}
+		}
+	}
+	md, _ := metadata.FromContext(ctx)
+	for _, value := range md["authorization"] {
+		if !strings.HasPrefix(value, "Bearer ") {
+			continue
+		}
+		if tokenID, ok := a.tokenIDs[sha256.Sum256([]byte(strings.TrimPrefix(value, "Bearer ")))]; ok {
+			return "token:" + tokenID
+		}
+	}
+	return ""
+}
+
+// implements `grpc.UnaryServerInterceptor`.
+func (a *authenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// implements `grpc.StreamServerInterceptor`.
+func (a *authenticator) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authenticate(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// chainUnaryInterceptors returns an interceptor that calls the given ones in
+// order, each one wrapping the rest of the chain and the handler, for gRPC
+// servers accept only one interceptor.
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return chained(ctx, req)
+	}
+}
+
+// chainStreamInterceptors is the same as `chainUnaryInterceptors` but for
+// stream interceptors.
+func chainStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, next)
+			}
+		}
+		return chained(srv, stream)
+	}
+}
+
+// newTLSConfig returns a TLS config of the gRPC server. If a client CA is
+// configured, then client certificates are requested and verified, but it is
+// up to authenticators to reject requests without them.
+func newTLSConfig(cfg *config.App) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCTLS.CertFile, cfg.GRPCTLS.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load server certificate")
+	}
+	tlsCfg := tls.Config{Certificates: []tls.Certificate{cert}}
+	if cfg.GRPCTLS.ClientCAFile != "" {
+		caPEM, err := ioutil.ReadFile(cfg.GRPCTLS.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read client CA file")
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.Errorf("no certificates found in %s", cfg.GRPCTLS.ClientCAFile)
+		}
+		tlsCfg.ClientCAs = clientCAs
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return &tlsCfg, nil
+}
@@ -1,21 +1,49 @@
 package grpcsrv
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/admin"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
+	"github.com/mailgun/kafka-pixy/consumer/offsettrac"
+	"github.com/mailgun/kafka-pixy/errs"
 	pb "github.com/mailgun/kafka-pixy/gen/golang"
+	"github.com/mailgun/kafka-pixy/logging"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/kafka-pixy/producer"
 	"github.com/mailgun/kafka-pixy/proxy"
+	"github.com/mailgun/kafka-pixy/shutdown"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 )
 
 const (
 	maxRequestSize = 1 * 1024 * 1024 // 1Mb
+
+	// The maximum number of messages received via a produce stream that can
+	// be waiting to be produced. Once it is reached, no more messages are
+	// read from the stream until some results are sent back.
+	maxStreamPendingProduces = 256
+
+	// Time reserved from a request deadline to send the response back, so
+	// that a message consumed right before the deadline reaches the client.
+	deadlineMargin = 100 * time.Millisecond
 )
 
 type T struct {
@@ -23,26 +51,64 @@ type T struct {
 	listener net.Listener
 	grpcSrv  *grpc.Server
 	proxySet *proxy.Set
+	auth     *authenticator
 	wg       sync.WaitGroup
 	errorCh  chan error
 }
 
-// New creates a gRPC server instance.
-func New(addr string, proxySet *proxy.Set) (*T, error) {
+// New creates a gRPC server instance. Requests in flight are reported to
+// `shutdownTr`.
+func New(addr string, proxySet *proxy.Set, cfg *config.App, shutdownTr *shutdown.T) (*T, error) {
+	serverOpts := []grpc.ServerOption{grpc.MaxMsgSize(maxRequestSize)}
+	if cfg.GRPCTLS.CertFile != "" {
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create listener")
 	}
 
-	grpcSrv := grpc.NewServer(grpc.MaxMsgSize(maxRequestSize))
+	name := fmt.Sprintf("grpc://%s", addr)
+	trackRequests := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := shutdownTr.TrackRequest(name)
+		defer done()
+		begin := time.Now()
+		res, err := handler(ctx, req)
+		logRequest(name, info.FullMethod, err, time.Since(begin))
+		return res, err
+	}
+	trackStreams := func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := shutdownTr.TrackRequest(name)
+		defer done()
+		begin := time.Now()
+		err := handler(srv, stream)
+		logRequest(name, info.FullMethod, err, time.Since(begin))
+		return err
+	}
+	// Requests are tracked before they are authenticated, so that rejected
+	// requests are logged too.
+	authenticate := newAuthenticator(cfg)
+	serverOpts = append(serverOpts,
+		grpc.UnaryInterceptor(chainUnaryInterceptors(trackRequests, authenticate.unaryInterceptor)),
+		grpc.StreamInterceptor(chainStreamInterceptors(trackStreams, authenticate.streamInterceptor)))
+	grpcSrv := grpc.NewServer(serverOpts...)
 	s := T{
-		actorID:  actor.RootID.NewChild(fmt.Sprintf("grpc://%s", addr)),
+		actorID:  actor.RootID.NewChild(name),
 		listener: listener,
 		grpcSrv:  grpcSrv,
 		proxySet: proxySet,
+		auth:     authenticate,
 		errorCh:  make(chan error, 1),
 	}
 	pb.RegisterKafkaPixyServer(grpcSrv, &s)
+	// Make the service discoverable by load balancers and tools like
+	// grpcurl, that do not have the proto files at hand.
+	healthpb.RegisterHealthServer(grpcSrv, &healthServer{proxySet: proxySet})
+	reflection.Register(grpcSrv)
 	return &s, nil
 }
 
@@ -74,47 +140,482 @@ func (s *T) Stop() {
 
 // Produce implements pb.KafkaPixyServer
 func (s *T) Produce(ctx context.Context, req *pb.ProdReq) (*pb.ProdRes, error) {
-	pxy, err := s.proxySet.Get(req.Proxy)
+	return s.produce(ctx, req)
+}
+
+// ProduceStream implements pb.KafkaPixyServer. Messages received from the
+// stream are produced concurrently, and results are sent back as soon as they
+// are available, that is not necessarily in the order the messages were
+// received, therefore clients should match them by correlation ID. A failure
+// to produce a message is reported in the error fields of its result and does
+// not break the stream.
+func (s *T) ProduceStream(stream pb.KafkaPixy_ProduceStreamServer) error {
+	resultsCh := make(chan *pb.ProdRes, maxStreamPendingProduces)
+	pendingCh := make(chan none.T, maxStreamPendingProduces)
+	sendErrCh := make(chan error, 1)
+	go func() {
+		var sendErr error
+		for res := range resultsCh {
+			<-pendingCh
+			// Keep draining results after a failure, so that producing
+			// goroutines are not blocked.
+			if sendErr == nil {
+				sendErr = stream.Send(res)
+			}
+		}
+		sendErrCh <- sendErr
+	}()
+	var (
+		wg      sync.WaitGroup
+		recvErr error
+	)
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				recvErr = err
+			}
+			break
+		}
+		pendingCh <- none.V
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			begin := time.Now()
+			res, err := s.produce(stream.Context(), req)
+			if err != nil {
+				logRequest(s.actorID.String(), "/KafkaPixy/ProduceStream", err, time.Since(begin))
+				res = &pb.ProdRes{ErrorCode: int32(grpc.Code(err)), ErrorDesc: grpc.ErrorDesc(err)}
+			}
+			res.CorrelationId = req.CorrelationId
+			resultsCh <- res
+		}()
+	}
+	wg.Wait()
+	close(resultsCh)
+	if err := <-sendErrCh; err != nil {
+		return err
+	}
+	return recvErr
+}
+
+func (s *T) produce(ctx context.Context, req *pb.ProdReq) (*pb.ProdRes, error) {
+	pxy, err := s.proxySet.GetForWrite(req.Proxy)
 	if err != nil {
-		return nil, err
+		return nil, proxyError(err)
 	}
 
 	if req.AsyncMode {
-		pxy.AsyncProduce(req.Topic, keyEncoderFor(req), sarama.StringEncoder(req.Message))
-		return &pb.ProdRes{Partition: -1, Offset: -1}, nil
+		if err := pxy.AsyncProduceToPartition(s.auth.tenant(ctx), req.Topic, producer.AnyPartition,
+			keyEncoderFor(req), sarama.StringEncoder(req.Message)); err != nil {
+			return nil, produceError(err)
+		}
+		return &pb.ProdRes{Partition: -1, Offset: -1, CorrelationId: req.CorrelationId}, nil
 	}
 
-	prodMsg, err := pxy.Produce(req.Topic, keyEncoderFor(req), sarama.StringEncoder(req.Message))
+	timeout, err := timeoutFor(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &pb.ProdRes{Partition: prodMsg.Partition, Offset: prodMsg.Offset}, nil
+	prodMsg, err := pxy.ProduceToPartition(s.auth.tenant(ctx), req.Topic, producer.AnyPartition,
+		keyEncoderFor(req), sarama.StringEncoder(req.Message), timeout)
+	if err != nil {
+		return nil, deadlineError(ctx, produceError(err))
+	}
+	return &pb.ProdRes{Partition: prodMsg.Partition, Offset: prodMsg.Offset, CorrelationId: req.CorrelationId}, nil
 }
 
 // Consume implements pb.KafkaPixyServer
 func (s *T) Consume(ctx context.Context, req *pb.ConsReq) (*pb.ConsRes, error) {
-	pxy, err := s.proxySet.Get(req.Proxy)
+	pxy, done, err := s.proxySet.GetForConsume(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	defer done()
+
+	timeout, err := timeoutFor(ctx)
 	if err != nil {
 		return nil, err
 	}
+	keyFilter := keyFilterFor(req.KeyFilter, req.KeyFilterPrefix)
+	if err := checkTopics(req.Topic, req.Topics, keyFilter); err != nil {
+		return nil, err
+	}
+	var consMsg consumer.Message
+	if len(req.Topics) > 0 {
+		consMsg, err = pxy.ConsumeTopics(s.auth.tenant(ctx), peerHost(ctx), req.Group, req.Topics, proxy.AutoAck(), timeout, 0)
+	} else {
+		consMsg, err = pxy.ConsumeFiltered(s.auth.tenant(ctx), peerHost(ctx), req.Group, req.Topic, proxy.AutoAck(), keyFilter, timeout, 0)
+	}
+	if err != nil {
+		return nil, deadlineError(ctx, consumeError(err))
+	}
+	return consResFor(consMsg), nil
+}
+
+// ConsumeStream implements pb.KafkaPixyServer. It sends messages consumed from
+// the requested topic, or any of the requested topics, down the stream until the client closes it, or the
+// service starts draining, in which case the stream fails with `Unavailable`. Unless auto acknowledgement is requested, every
+// sent message has to be acknowledged with the `Ack` call, otherwise it is
+// redelivered after `Consumer.RetryTimeout`.
+func (s *T) ConsumeStream(req *pb.ConsNReq, stream pb.KafkaPixy_ConsumeStreamServer) error {
+	ctx := stream.Context()
+	tenant := s.auth.tenant(ctx)
+	client := peerHost(ctx)
+	ack := proxy.NoAck()
+	if req.AutoAck {
+		ack = proxy.AutoAck()
+	}
+	keyFilter := keyFilterFor(req.KeyFilter, req.KeyFilterPrefix)
+	if err := checkTopics(req.Topic, req.Topics, keyFilter); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		timeout, err := timeoutFor(ctx)
+		if err != nil {
+			return err
+		}
+		// The proxy is acquired for every message rather than for the entire
+		// stream, so that streams do not hold back draining.
+		pxy, done, err := s.proxySet.GetForConsume(req.Proxy)
+		if err != nil {
+			return proxyError(err)
+		}
+		var consMsg consumer.Message
+		if len(req.Topics) > 0 {
+			consMsg, err = pxy.ConsumeTopics(tenant, client, req.Group, req.Topics, ack, timeout, 0)
+		} else {
+			consMsg, err = pxy.ConsumeFiltered(tenant, client, req.Group, req.Topic, ack, keyFilter, timeout, 0)
+		}
+		done()
+		if err != nil {
+			if errs.Is(err, errs.ErrRequestTimeout) {
+				continue
+			}
+			return consumeError(err)
+		}
+		if err := stream.Send(consResFor(consMsg)); err != nil {
+			if ctx.Err() != nil {
+				// Closing the stream is how clients stop consuming.
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
 
-	consMsg, err := pxy.Consume(req.Group, req.Topic, proxy.AutoAck())
+// Ack implements pb.KafkaPixyServer
+func (s *T) Ack(ctx context.Context, req *pb.AckReq) (*pb.AckRes, error) {
+	pxy, err := s.proxySet.Get(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	ack, err := proxy.Ack(req.Partition, req.Offset)
 	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := pxy.Ack(req.Group, req.Topic, ack); err != nil {
+		if err == proxy.ErrNotConsumed {
+			return nil, grpc.Errorf(codes.NotFound, "%s", err)
+		}
 		return nil, err
 	}
+	return &pb.AckRes{}, nil
+}
+
+// Retry implements pb.KafkaPixyServer. It is the gRPC counterpart of
+// `POST /topics/{topic}/messages/retry`.
+func (s *T) Retry(ctx context.Context, req *pb.AckReq) (*pb.RetryRes, error) {
+	pxy, err := s.proxySet.GetForWrite(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	ack, err := proxy.Ack(req.Partition, req.Offset)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	res, err := pxy.Retry(req.Group, req.Topic, ack)
+	if err != nil {
+		if err == proxy.ErrNotConsumed {
+			return nil, grpc.Errorf(codes.NotFound, "%s", err)
+		}
+		return nil, adminError(produceError(err))
+	}
+	return &pb.RetryRes{Topic: res.Topic, Retries: int32(res.Retries), DeadLettered: res.DeadLettered}, nil
+}
+
+// Nack implements pb.KafkaPixyServer. It is the gRPC counterpart of
+// `POST /topics/{topic}/messages/nack`.
+func (s *T) Nack(ctx context.Context, req *pb.NackReq) (*pb.AckRes, error) {
+	pxy, err := s.proxySet.Get(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	ack, err := proxy.Ack(req.Partition, req.Offset)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := pxy.Nack(req.Group, req.Topic, ack, time.Duration(req.DelayMs)*time.Millisecond); err != nil {
+		if err == proxy.ErrNotConsumed {
+			return nil, grpc.Errorf(codes.NotFound, "%s", err)
+		}
+		return nil, adminError(err)
+	}
+	return &pb.AckRes{}, nil
+}
+
+// GetOffsets implements pb.KafkaPixyServer. It is the gRPC counterpart of
+// `GET /topics/{topic}/offsets`.
+func (s *T) GetOffsets(ctx context.Context, req *pb.GetOffsetsReq) (*pb.GetOffsetsRes, error) {
+	pxy, err := s.proxySet.Get(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	if req.Group == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "group is not specified")
+	}
+	partitionOffsets, _, err := pxy.GetGroupOffsets(req.Group, req.Topic, req.Refresh)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &pb.GetOffsetsRes{Offsets: partitionOffsetsFor(partitionOffsets)}, nil
+}
+
+// SetOffsets implements pb.KafkaPixyServer. It is the gRPC counterpart of
+// `POST /topics/{topic}/offsets`. If a timestamp is specified, then the group
+// offsets are rewound to it, and the offsets given in the request are ignored.
+// Only in that case the resulting offsets are returned.
+func (s *T) SetOffsets(ctx context.Context, req *pb.SetOffsetsReq) (*pb.SetOffsetsRes, error) {
+	pxy, err := s.proxySet.GetForWrite(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	if req.Group == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "group is not specified")
+	}
+	if req.Timestamp != 0 {
+		timestamp := time.Unix(0, req.Timestamp*int64(time.Millisecond))
+		partitionOffsets, err := pxy.RewindGroupOffsets(req.Group, req.Topic, timestamp)
+		if err != nil {
+			return nil, adminError(err)
+		}
+		return &pb.SetOffsetsRes{Offsets: partitionOffsetsFor(partitionOffsets)}, nil
+	}
+	partitionOffsets := make([]admin.PartitionOffset, len(req.Offsets))
+	for i, po := range req.Offsets {
+		partitionOffsets[i].Partition = po.Partition
+		partitionOffsets[i].Offset = po.Offset
+		partitionOffsets[i].Metadata = po.Metadata
+	}
+	if err := pxy.SetGroupOffsets(req.Group, req.Topic, partitionOffsets); err != nil {
+		return nil, adminError(err)
+	}
+	return &pb.SetOffsetsRes{}, nil
+}
 
+// ListConsumers implements pb.KafkaPixyServer. It is the gRPC counterpart of
+// `GET /topics/{topic}/consumers`. Groups and their members are sorted by
+// name, if the group is not specified, then all groups consuming from the
+// topic are returned.
+func (s *T) ListConsumers(ctx context.Context, req *pb.ListConsumersReq) (*pb.ListConsumersRes, error) {
+	pxy, err := s.proxySet.Get(req.Proxy)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	var consumers map[string]map[string][]int32
+	if req.Group == "" {
+		consumers, _, err = pxy.GetAllTopicConsumers(req.Topic, req.Refresh)
+		if err != nil {
+			return nil, adminError(err)
+		}
+	} else {
+		groupConsumers, _, err := pxy.GetTopicConsumers(req.Group, req.Topic, req.Refresh)
+		if err != nil {
+			return nil, adminError(err)
+		}
+		consumers = make(map[string]map[string][]int32)
+		if len(groupConsumers) != 0 {
+			consumers[req.Group] = groupConsumers
+		}
+	}
+	var res pb.ListConsumersRes
+	for group, groupConsumers := range consumers {
+		cg := pb.ConsumerGroup{Group: group}
+		for memberID, partitions := range groupConsumers {
+			cg.Members = append(cg.Members, &pb.GroupMember{MemberId: memberID, Partitions: partitions})
+		}
+		sort.Slice(cg.Members, func(i, j int) bool { return cg.Members[i].MemberId < cg.Members[j].MemberId })
+		res.Groups = append(res.Groups, &cg)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Group < res.Groups[j].Group })
+	return &res, nil
+}
+
+func partitionOffsetsFor(partitionOffsets []admin.PartitionOffset) []*pb.PartitionOffset {
+	res := make([]*pb.PartitionOffset, len(partitionOffsets))
+	for i, po := range partitionOffsets {
+		offset := offsetmgr.Offset{Val: po.Offset, Meta: po.Metadata}
+		res[i] = &pb.PartitionOffset{
+			Partition:   po.Partition,
+			Begin:       po.Begin,
+			End:         po.End,
+			Count:       po.End - po.Begin,
+			Offset:      po.Offset,
+			Lag:         po.Lag(),
+			Metadata:    po.Metadata,
+			SparseAcks:  offsettrac.SparseAcks2Str(offset),
+			AckMetadata: offsettrac.UserMeta(offset),
+		}
+	}
+	return res
+}
+
+func consResFor(consMsg consumer.Message) *pb.ConsRes {
 	res := pb.ConsRes{
+		Topic:     consMsg.Topic,
 		Partition: consMsg.Partition,
 		Offset:    consMsg.Offset,
 		Message:   consMsg.Value,
+		Retries:   int32(consMsg.Retries),
 	}
 	if consMsg.Key == nil {
 		res.KeyUndefined = true
 	} else {
 		res.KeyValue = consMsg.Key
 	}
+	// Fields are passed as a JSON object, for their values can be of any
+	// type.
+	if len(consMsg.Fields) != 0 {
+		encoded, err := json.Marshal(consMsg.Fields)
+		if err != nil {
+			encoded, _ = json.Marshal(map[string]string{"enrichment_error": err.Error()})
+		}
+		res.Fields = string(encoded)
+	}
+	return &res
+}
 
-	return &res, nil
+// peerHost returns the host of the client that made the request. It is used to
+// identify the client for fair distribution of consumed messages.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// logRequest logs a served request if it is sampled as configured by
+// `config.App.LogSampling`. Requests that time out, or that are rejected as
+// invalid, are not considered failed.
+func logRequest(name, method string, err error, took time.Duration) {
+	if err == nil {
+		logging.Requests.Infof("<%s> request served: %s, took=%s", name, method, took)
+		return
+	}
+	if errs.Is(err, errs.ErrRequestTimeout) || grpc.Code(err) == codes.InvalidArgument || grpc.Code(err) == codes.DeadlineExceeded {
+		logging.Requests.Infof("<%s> request served: %s, took=%s, err=(%s)", name, method, took, err)
+		return
+	}
+	logging.FailedRequests.Warningf("<%s> request failed: %s, took=%s, err=(%s)", name, method, took, err)
+}
+
+// timeoutFor returns how long a request can wait for a result to fit into the
+// deadline of its context, if any, with a margin for the response to be sent
+// back. Zero is returned for requests without a deadline. The returned timeout
+// is still capped by the respective proxy config parameters, e.g.
+// `Consumer.MaxLongPollingTimeout`.
+func timeoutFor(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	timeout := deadline.Sub(time.Now()) - deadlineMargin
+	if timeout <= 0 {
+		return 0, grpc.Errorf(codes.DeadlineExceeded, "deadline is too close")
+	}
+	return timeout, nil
+}
+
+// deadlineError converts timeouts of requests with a deadline to the gRPC
+// deadline exceeded errors.
+func deadlineError(ctx context.Context, err error) error {
+	if _, ok := ctx.Deadline(); ok && errs.Is(err, errs.ErrRequestTimeout) {
+		return grpc.Errorf(codes.DeadlineExceeded, "%s", err)
+	}
+	return err
+}
+
+// proxyError converts errors of requests to proxies that are not ready, in
+// maintenance, or draining, to the gRPC unavailable errors, so that clients
+// know to retry.
+func proxyError(err error) error {
+	if _, ok := err.(proxy.ErrNotReady); ok || errs.Is(err, errs.ErrMaintenance) || errs.Is(err, errs.ErrDraining) {
+		return grpc.Errorf(codes.Unavailable, "%s", err)
+	}
+	return err
+}
+
+// produceError converts message rejections to the gRPC invalid argument
+// errors, so that clients can tell them from failures.
+func produceError(err error) error {
+	if _, ok := err.(proxy.ErrRejected); ok {
+		return grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if errs.Is(err, errs.ErrDisabled) {
+		return grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	return err
+}
+
+// consumeError converts errors of requests to consume from topics disabled by
+// an operator to the gRPC permission denied errors.
+func consumeError(err error) error {
+	if errs.Is(err, errs.ErrDisabled) {
+		return grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	return err
+}
+
+// adminError converts errors of administrative requests for unknown topics, or
+// with invalid parameters, to the respective gRPC errors.
+func adminError(err error) error {
+	if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return grpc.Errorf(codes.NotFound, "unknown topic")
+	}
+	if errs.Is(err, errs.ErrInvalidParam) {
+		return grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return err
+}
+
+// keyFilterFor returns a key filter for consume request fields. Since proto3
+// cannot tell an empty key from a missing one, an empty key means no filter.
+func keyFilterFor(key []byte, prefix bool) *proxy.KeyFilter {
+	if len(key) == 0 {
+		return nil
+	}
+	return &proxy.KeyFilter{Key: key, Prefix: prefix}
+}
+
+// checkTopics makes sure that a consume request specifies either one topic or
+// several, and that a key filter is only given along with one topic.
+func checkTopics(topic string, topics []string, keyFilter *proxy.KeyFilter) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	if topic != "" {
+		return grpc.Errorf(codes.InvalidArgument, "either topic or topics can be specified, not both")
+	}
+	if keyFilter != nil {
+		return grpc.Errorf(codes.InvalidArgument, "key filter does not support several topics")
+	}
+	return nil
 }
 
 func keyEncoderFor(prodReq *pb.ProdReq) sarama.Encoder {
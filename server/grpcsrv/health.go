@@ -0,0 +1,35 @@
+package grpcsrv
+
+import (
+	"github.com/mailgun/kafka-pixy/proxy"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Name of the Kafka-Pixy gRPC service as it should be given in health check
+// requests.
+const kafkaPixyService = "KafkaPixy"
+
+// healthServer reports serving status of the service to standard gRPC health
+// checks. The service is serving when it is ready, see `proxy.Readiness`, and
+// it is not draining. Both the overall status, that is requested with an empty
+// service name, and the status of `KafkaPixy` are the same.
+//
+// implements `healthpb.HealthServer`.
+type healthServer struct {
+	proxySet *proxy.Set
+}
+
+// Check implements `healthpb.HealthServer`.
+func (hs *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.Service != "" && req.Service != kafkaPixyService {
+		return nil, grpc.Errorf(codes.NotFound, "unknown service")
+	}
+	status := healthpb.HealthCheckResponse_SERVING
+	if ready, _ := proxy.Readiness(hs.proxySet.Status()); !ready || hs.proxySet.Draining() {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return &healthpb.HealthCheckResponse{Status: status}, nil
+}
@@ -0,0 +1,205 @@
+package httpsrv
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/config"
+)
+
+const (
+	hdrAcceptEncoding  = "Accept-Encoding"
+	hdrContentEncoding = "Content-Encoding"
+	hdrVary            = "Vary"
+	hdrUpgrade         = "Upgrade"
+
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// compressor compresses HTTP responses with an encoding negotiated via the
+// `Accept-Encoding` request header. Whether responses are compressed is
+// configured per proxy. Requests made via `[/v2]/proxies/<alias>/...` are
+// subject to configuration of the respective proxy, and all others to
+// configuration of the default proxy.
+type compressor struct {
+	cfg *config.App
+}
+
+func newCompressor(cfg *config.App) *compressor {
+	return &compressor{cfg: cfg}
+}
+
+// wrap returns a handler that compresses responses of the specified handler
+// if the client accepts compressed responses and compression is enabled.
+// WebSocket upgrade requests are passed through as is.
+func (cp *compressor) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyCfg := proxyCfgByPath(cp.cfg, r.URL.Path)
+		if proxyCfg == nil || !proxyCfg.Compression.Enabled || r.Header.Get(hdrUpgrade) != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add(hdrVary, hdrAcceptEncoding)
+		encoding := negotiateEncoding(r.Header.Get(hdrAcceptEncoding))
+		if encoding == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        proxyCfg.Compression.MinSize,
+		}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// proxyCfgByPath returns configuration of the proxy that a request with the
+// specified URL path is made to, or nil if there is no such proxy.
+func proxyCfgByPath(cfg *config.App, path string) *config.Proxy {
+	alias := cfg.DefaultProxy
+	path = strings.TrimPrefix(path, v2Prefix)
+	if strings.HasPrefix(path, "/proxies/") {
+		alias = strings.SplitN(path[len("/proxies/"):], "/", 2)[0]
+	}
+	return cfg.Proxies[alias]
+}
+
+// negotiateEncoding returns an encoding that the client accepts according to
+// the specified `Accept-Encoding` header value, gzip being preferred over
+// deflate. An empty string is returned if the client accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	var gzipOk, deflateOk bool
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q <= 0 {
+				accepted = false
+			}
+		}
+		if !accepted {
+			continue
+		}
+		switch coding {
+		case encodingGzip, "*":
+			gzipOk = true
+		case encodingDeflate:
+			deflateOk = true
+		}
+	}
+	switch {
+	case gzipOk:
+		return encodingGzip
+	case deflateOk:
+		return encodingDeflate
+	}
+	return ""
+}
+
+// compressWriter buffers a response until it grows to the minimum size, and
+// then compresses it and everything written after. If the response turns out
+// to be smaller, then it is sent uncompressed when the writer is closed. The
+// response status is held back until it is known whether the response is
+// compressed, for compression affects response headers.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      []byte
+	started  bool
+	encoder  io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started || cw.status != 0 {
+		return
+	}
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.started {
+		if cw.encoder != nil {
+			return cw.encoder.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start sends the response status and the buffered part of the response,
+// compressed if `compress` is true, unless the handler has already encoded
+// the response.
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	hdr := cw.Header()
+	if compress && hdr.Get(hdrContentEncoding) == "" {
+		hdr.Set(hdrContentEncoding, cw.encoding)
+		hdr.Del(hdrContentLength)
+		if cw.encoding == encodingGzip {
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.encoder = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends everything written so far. The size of a response that is
+// flushed is not known in advance, so it is compressed.
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true)
+	}
+	if f, ok := cw.encoder.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close sends whatever is left of the response.
+func (cw *compressWriter) close() {
+	if !cw.started {
+		cw.start(false)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
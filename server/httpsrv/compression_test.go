@@ -0,0 +1,155 @@
+package httpsrv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CompressionSuite{})
+
+type CompressionSuite struct {
+	cfg *config.App
+	h   http.Handler
+}
+
+func (s *CompressionSuite) SetUpTest(c *C) {
+	s.cfg = config.DefaultApp("foo")
+	s.cfg.Proxies["foo"].Compression.Enabled = true
+	s.cfg.Proxies["foo"].Compression.MinSize = 10
+	s.cfg.Proxies["bar"] = config.DefaultProxy()
+	s.h = newCompressor(s.cfg).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+}
+
+func (s *CompressionSuite) TestNegotiateEncoding(c *C) {
+	for i, tc := range []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		/* 0 */ {"", ""},
+		/* 1 */ {"gzip", "gzip"},
+		/* 2 */ {"deflate", "deflate"},
+		/* 3 */ {"deflate, gzip", "gzip"},
+		/* 4 */ {"deflate, gzip;q=0", "deflate"},
+		/* 5 */ {"GZIP;q=0.5", "gzip"},
+		/* 6 */ {"*", "gzip"},
+		/* 7 */ {"br, identity", ""},
+	} {
+		c.Assert(negotiateEncoding(tc.acceptEncoding), Equals, tc.encoding, Commentf("case #%d", i))
+	}
+}
+
+// Responses of at least the minimum size are compressed with the negotiated
+// encoding.
+func (s *CompressionSuite) TestCompressed(c *C) {
+	body := strings.Repeat("Hello", 10)
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		r := httptest.NewRequest("GET", "/topics/foo?body="+body, nil)
+		r.Header.Set(hdrAcceptEncoding, encoding)
+		w := httptest.NewRecorder()
+
+		// When
+		s.h.ServeHTTP(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusCreated)
+		c.Assert(w.Header().Get(hdrContentEncoding), Equals, encoding)
+		c.Assert(w.Header().Get(hdrVary), Equals, hdrAcceptEncoding)
+		var decoded []byte
+		var err error
+		if encoding == encodingGzip {
+			gr, _ := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+			decoded, err = ioutil.ReadAll(gr)
+		} else {
+			zr, _ := zlib.NewReader(bytes.NewReader(w.Body.Bytes()))
+			decoded, err = ioutil.ReadAll(zr)
+		}
+		c.Assert(err, IsNil)
+		c.Assert(string(decoded), Equals, body)
+	}
+}
+
+// Responses smaller than the minimum size are sent uncompressed.
+func (s *CompressionSuite) TestTooSmall(c *C) {
+	r := httptest.NewRequest("GET", "/topics/foo?body=Hello", nil)
+	r.Header.Set(hdrAcceptEncoding, encodingGzip)
+	w := httptest.NewRecorder()
+
+	// When
+	s.h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusCreated)
+	c.Assert(w.Header().Get(hdrContentEncoding), Equals, "")
+	c.Assert(w.Body.String(), Equals, "Hello")
+}
+
+// A flushed response is compressed whatever its size, and everything written
+// before the flush is sent right away.
+func (s *CompressionSuite) TestFlush(c *C) {
+	var flushed []byte
+	h := newCompressor(s.cfg).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+		w.(http.Flusher).Flush()
+		flushed = append(flushed, w.(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.Bytes()...)
+		w.Write([]byte(" world"))
+	}))
+	r := httptest.NewRequest("GET", "/topics/foo", nil)
+	r.Header.Set(hdrAcceptEncoding, encodingGzip)
+	w := httptest.NewRecorder()
+
+	// When
+	h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get(hdrContentEncoding), Equals, encodingGzip)
+	gr, err := gzip.NewReader(bytes.NewReader(flushed))
+	c.Assert(err, IsNil)
+	buf := make([]byte, 5)
+	_, err = gr.Read(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "Hello")
+	gr, err = gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	c.Assert(err, IsNil)
+	decoded, err := ioutil.ReadAll(gr)
+	c.Assert(err, IsNil)
+	c.Assert(string(decoded), Equals, "Hello world")
+}
+
+// Compression is configured per proxy, requests that do not specify a proxy
+// are subject to configuration of the default proxy.
+func (s *CompressionSuite) TestPerProxy(c *C) {
+	body := strings.Repeat("Hello", 10)
+	for i, tc := range []struct {
+		path     string
+		encoding string
+	}{
+		/* 0 */ {"/topics/foo", encodingGzip},
+		/* 1 */ {"/proxies/foo/topics/foo", encodingGzip},
+		/* 2 */ {"/proxies/bar/topics/foo", ""},
+		/* 3 */ {"/proxies/baz/topics/foo", ""},
+		/* 4 */ {"/v2/topics/foo", encodingGzip},
+		/* 5 */ {"/v2/proxies/bar/topics/foo", ""},
+	} {
+		r := httptest.NewRequest("GET", tc.path+"?body="+body, nil)
+		r.Header.Set(hdrAcceptEncoding, encodingGzip)
+		w := httptest.NewRecorder()
+
+		// When
+		s.h.ServeHTTP(w, r)
+
+		// Then
+		c.Assert(w.Header().Get(hdrContentEncoding), Equals, tc.encoding, Commentf("case #%d", i))
+	}
+}
@@ -0,0 +1,115 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/config"
+)
+
+const (
+	hdrOrigin         = "Origin"
+	hdrAllowOrigin    = "Access-Control-Allow-Origin"
+	hdrAllowMethods   = "Access-Control-Allow-Methods"
+	hdrAllowHeaders   = "Access-Control-Allow-Headers"
+	hdrExposeHeaders  = "Access-Control-Expose-Headers"
+	hdrMaxAge         = "Access-Control-Max-Age"
+	hdrRequestMethod  = "Access-Control-Request-Method"
+	hdrRequestHeaders = "Access-Control-Request-Headers"
+
+	corsAnyOrigin = "*"
+)
+
+// Response headers that browser-based clients need to read, e.g. to consume
+// messages in the raw format.
+var corsExposedHeaders = strings.Join([]string{
+	hdrTraceID, hdrGroup, hdrPartition, hdrOffset, hdrKey, hdrTombstone,
+}, ", ")
+
+// corsHandler implements Cross-Origin Resource Sharing, so that browser-based
+// clients can use the HTTP API directly. It is configured per proxy the same
+// way as compression, and only applies on listeners that it is enabled for.
+type corsHandler struct {
+	cfg      *config.App
+	listener string
+}
+
+func newCORSHandler(cfg *config.App, listener string) *corsHandler {
+	return &corsHandler{cfg: cfg, listener: listener}
+}
+
+// wrap returns a handler that adds CORS headers to responses of the specified
+// handler to requests from allowed origins, and responds to preflight
+// requests itself. Requests from other origins are passed through as is, and
+// it is up to browsers to deny them.
+func (ch *corsHandler) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(hdrOrigin)
+		proxyCfg := proxyCfgByPath(ch.cfg, r.URL.Path)
+		if origin == "" || proxyCfg == nil || !ch.isEnabled(proxyCfg) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		hdr := w.Header()
+		hdr.Add(hdrVary, hdrOrigin)
+		originAllowed := containsFold(proxyCfg.CORS.AllowedOrigins, origin) ||
+			containsFold(proxyCfg.CORS.AllowedOrigins, corsAnyOrigin)
+		if !isPreflight(r) {
+			if originAllowed {
+				hdr.Set(hdrAllowOrigin, origin)
+				hdr.Set(hdrExposeHeaders, corsExposedHeaders)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !originAllowed {
+			respondWithJSON(w, http.StatusForbidden, errorHTTPResponse{fmt.Sprintf("Origin not allowed: %s", origin)})
+			return
+		}
+		method := r.Header.Get(hdrRequestMethod)
+		if !containsFold(proxyCfg.CORS.AllowedMethods, method) {
+			respondWithJSON(w, http.StatusForbidden, errorHTTPResponse{fmt.Sprintf("Method not allowed: %s", method)})
+			return
+		}
+		var requestHeaders []string
+		for _, header := range strings.Split(r.Header.Get(hdrRequestHeaders), ",") {
+			header = strings.TrimSpace(header)
+			if header == "" {
+				continue
+			}
+			if !containsFold(proxyCfg.CORS.AllowedHeaders, header) {
+				respondWithJSON(w, http.StatusForbidden, errorHTTPResponse{fmt.Sprintf("Header not allowed: %s", header)})
+				return
+			}
+			requestHeaders = append(requestHeaders, header)
+		}
+		hdr.Set(hdrAllowOrigin, origin)
+		hdr.Set(hdrAllowMethods, strings.Join(proxyCfg.CORS.AllowedMethods, ", "))
+		if len(requestHeaders) > 0 {
+			hdr.Set(hdrAllowHeaders, strings.Join(requestHeaders, ", "))
+		}
+		hdr.Set(hdrMaxAge, strconv.Itoa(int(proxyCfg.CORS.MaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (ch *corsHandler) isEnabled(proxyCfg *config.Proxy) bool {
+	return len(proxyCfg.CORS.AllowedOrigins) > 0 && containsFold(proxyCfg.CORS.Listeners, ch.listener)
+}
+
+// isPreflight tells whether the request is a CORS preflight request, that a
+// browser makes to check whether the actual request is allowed.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get(hdrOrigin) != "" && r.Header.Get(hdrRequestMethod) != ""
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
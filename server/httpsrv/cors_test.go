@@ -0,0 +1,160 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CORSSuite{})
+
+type CORSSuite struct {
+	cfg *config.App
+	h   http.Handler
+}
+
+func (s *CORSSuite) SetUpTest(c *C) {
+	s.cfg = config.DefaultApp("foo")
+	s.cfg.Proxies["foo"].CORS.AllowedOrigins = []string{"https://app.example.com"}
+	s.cfg.Proxies["bar"] = config.DefaultProxy()
+	s.h = newCORSHandler(s.cfg, networkTCP).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+}
+
+// Responses to requests from allowed origins let the browser read them.
+func (s *CORSSuite) TestAllowedOrigin(c *C) {
+	r := httptest.NewRequest("GET", "/topics/foo/messages?group=bar", nil)
+	r.Header.Set(hdrOrigin, "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	// When
+	s.h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusCreated)
+	c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "https://app.example.com")
+	c.Assert(w.Header().Get(hdrExposeHeaders), Equals, corsExposedHeaders)
+	c.Assert(w.Header().Get(hdrVary), Equals, hdrOrigin)
+}
+
+// Requests are passed through without CORS headers if the origin is not
+// allowed, if CORS is not enabled for the proxy, or if it is not a
+// cross-origin request at all.
+func (s *CORSSuite) TestNotAllowed(c *C) {
+	for i, tc := range []struct {
+		path   string
+		origin string
+	}{
+		/* 0 */ {"/topics/foo/messages", "https://evil.example.com"},
+		/* 1 */ {"/proxies/bar/topics/foo/messages", "https://app.example.com"},
+		/* 2 */ {"/proxies/unknown/topics/foo/messages", "https://app.example.com"},
+		/* 3 */ {"/topics/foo/messages", ""},
+	} {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		if tc.origin != "" {
+			r.Header.Set(hdrOrigin, tc.origin)
+		}
+		w := httptest.NewRecorder()
+
+		// When
+		s.h.ServeHTTP(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusCreated, Commentf("case #%d", i))
+		c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "", Commentf("case #%d", i))
+	}
+}
+
+// CORS applies only to listeners it is enabled for.
+func (s *CORSSuite) TestListener(c *C) {
+	h := newCORSHandler(s.cfg, networkUnix).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	r := httptest.NewRequest("GET", "/topics/foo/messages", nil)
+	r.Header.Set(hdrOrigin, "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	// When
+	h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusCreated)
+	c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "")
+
+	// When
+	s.cfg.Proxies["foo"].CORS.Listeners = []string{config.ListenerTCP, config.ListenerUnix}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "https://app.example.com")
+}
+
+// Preflight requests are responded to without calling the wrapped handler.
+func (s *CORSSuite) TestPreflight(c *C) {
+	r := httptest.NewRequest("OPTIONS", "/v2/topics/foo/messages", nil)
+	r.Header.Set(hdrOrigin, "https://app.example.com")
+	r.Header.Set(hdrRequestMethod, "POST")
+	r.Header.Set(hdrRequestHeaders, "content-type")
+	w := httptest.NewRecorder()
+
+	// When
+	s.h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+	c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "https://app.example.com")
+	c.Assert(w.Header().Get(hdrAllowMethods), Equals, "GET, POST, DELETE")
+	c.Assert(w.Header().Get(hdrAllowHeaders), Equals, "content-type")
+	c.Assert(w.Header().Get(hdrMaxAge), Equals, "600")
+}
+
+// Any origin is allowed if `*` is listed among allowed origins.
+func (s *CORSSuite) TestPreflightAnyOrigin(c *C) {
+	s.cfg.Proxies["foo"].CORS.AllowedOrigins = []string{corsAnyOrigin}
+	r := httptest.NewRequest("OPTIONS", "/topics/foo/messages", nil)
+	r.Header.Set(hdrOrigin, "https://other.example.com")
+	r.Header.Set(hdrRequestMethod, "GET")
+	w := httptest.NewRecorder()
+
+	// When
+	s.h.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+	c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "https://other.example.com")
+	c.Assert(w.Header().Get(hdrAllowHeaders), Equals, "")
+}
+
+func (s *CORSSuite) TestPreflightRejected(c *C) {
+	for i, tc := range []struct {
+		origin  string
+		method  string
+		headers string
+		error   string
+	}{
+		/* 0 */ {"https://evil.example.com", "GET", "", "Origin not allowed: https://evil.example.com"},
+		/* 1 */ {"https://app.example.com", "PUT", "", "Method not allowed: PUT"},
+		/* 2 */ {"https://app.example.com", "POST", "Content-Type, X-Foo", "Header not allowed: X-Foo"},
+	} {
+		r := httptest.NewRequest("OPTIONS", "/topics/foo/messages", nil)
+		r.Header.Set(hdrOrigin, tc.origin)
+		r.Header.Set(hdrRequestMethod, tc.method)
+		r.Header.Set(hdrRequestHeaders, tc.headers)
+		w := httptest.NewRecorder()
+
+		// When
+		s.h.ServeHTTP(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusForbidden, Commentf("case #%d", i))
+		c.Assert(w.Header().Get(hdrAllowOrigin), Equals, "", Commentf("case #%d", i))
+		var body errorHTTPResponse
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+		c.Assert(body.Error, Equals, tc.error, Commentf("case #%d", i))
+	}
+}
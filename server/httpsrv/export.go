@@ -0,0 +1,112 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/kafka-pixy/admin"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/log"
+)
+
+const (
+	prmFrom = "from"
+	prmTo   = "to"
+
+	// The only format of exported messages, newline delimited JSON.
+	formatJSONL      = "jsonl"
+	contentTypeJSONL = "application/x-ndjson"
+)
+
+var exportParams = []string{prmFrom, prmTo, prmFormat}
+
+// handleExport is an HTTP request handler for
+// `GET /topics/{topic}/partitions/{partition}/export`. Messages with offsets
+// from `from` up to but not including `to` are streamed as newline delimited
+// JSON, a message per line, and every chunk of messages is flushed as soon as
+// it is read. The response status is sent along with the first chunk, so if
+// the export fails after that, then a line with an error object ends the
+// response instead.
+func (s *T) handleExport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if format := r.FormValue(prmFormat); format != "" && format != formatJSONL {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid format: %s", format)})
+		return
+	}
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	partitionStr := mux.Vars(r)[prmPartition]
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil || partition < 0 {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+		return
+	}
+	fromStr := r.FormValue(prmFrom)
+	from, err := strconv.ParseInt(fromStr, 10, 64)
+	if err != nil || from < 0 {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid from: %s", fromStr)})
+		return
+	}
+	toStr := r.FormValue(prmTo)
+	to, err := strconv.ParseInt(toStr, 10, 64)
+	if err != nil || to < from {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid to: %s", toStr)})
+		return
+	}
+
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set(hdrContentType, contentTypeJSONL)
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	err = pxy.ExportMessages(topic, int32(partition), from, to, func(messages []admin.Message) error {
+		start()
+		for _, msg := range messages {
+			line := messageV2View{
+				Topic:     topic,
+				Partition: int32(partition),
+				Offset:    msg.Offset,
+				Key:       msg.Key,
+				Value:     msg.Value,
+			}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		start()
+		return
+	}
+	if started {
+		log.Warningf("<%s> export interrupted: topic=%s, partition=%d, err=%+v", s.actorID, topic, partition, err)
+		encoder.Encode(errorHTTPResponse{err.Error()})
+		return
+	}
+	var status int
+	switch {
+	case errs.Is(err, errs.ErrInvalidParam):
+		status = http.StatusBadRequest
+	case errs.Is(err, errs.ErrDisabled):
+		status = http.StatusForbidden
+	default:
+		status = http.StatusInternalServerError
+	}
+	respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+}
@@ -1,28 +1,43 @@
 package httpsrv
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/gorilla/mux"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/admin"
+	"github.com/mailgun/kafka-pixy/auth"
+	"github.com/mailgun/kafka-pixy/config"
 	"github.com/mailgun/kafka-pixy/consumer"
 	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
 	"github.com/mailgun/kafka-pixy/consumer/offsettrac"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/logging"
+	"github.com/mailgun/kafka-pixy/none"
 	"github.com/mailgun/kafka-pixy/prettyfmt"
+	"github.com/mailgun/kafka-pixy/producer"
 	"github.com/mailgun/kafka-pixy/proxy"
+	"github.com/mailgun/kafka-pixy/shutdown"
+	"github.com/mailgun/kafka-pixy/version"
 	"github.com/mailgun/log"
 	"github.com/mailgun/manners"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -32,13 +47,50 @@ const (
 	// HTTP headers used by the API.
 	hdrContentLength = "Content-Length"
 	hdrContentType   = "Content-Type"
+	hdrTraceID       = "X-Kafka-Pixy-Trace-Id"
+	hdrAge           = "Age"
+	hdrTiming        = "X-Timing"
 
 	// HTTP request parameters.
-	prmProxy = "proxy"
-	prmTopic = "topic"
-	prmKey   = "key"
-	prmSync  = "sync"
-	prmGroup = "group"
+	prmProxy   = "proxy"
+	prmTopic   = "topic"
+	prmKey     = "key"
+	prmSync    = "sync"
+	prmGroup   = "group"
+	prmShadow  = "shadow"
+	prmMember  = "member"
+	prmTraceID = "traceID"
+
+	prmTombstone   = "tombstone"
+	prmTimeout     = "timeout"
+	prmBatch       = "batch"
+	prmAckMetadata = "ackMetadata"
+	prmNoAutoAck   = "noAutoAck"
+	prmPartition   = "partition"
+	prmOffset      = "offset"
+	prmClient      = "client"
+	prmCount       = "count"
+	prmSubTTL      = "subscription_ttl"
+	prmWithParts   = "withPartitions"
+	prmWithConfig  = "withConfig"
+	prmCommitted   = "committed"
+	prmTimestamp   = "timestamp"
+	prmWait        = "wait"
+	prmOp          = "op"
+	prmReason      = "reason"
+	prmFormat      = "format"
+	prmFields      = "fields"
+	prmLimit       = "limit"
+	prmCursor      = "cursor"
+	prmRefresh     = "refresh"
+	prmKeyFilter   = "key_filter"
+	prmKeyPrefix   = "key_filter_prefix"
+	prmPattern     = "pattern"
+	prmDelay       = "delay"
+
+	// Kafka limits the size of offset metadata, so ack metadata should leave
+	// enough room for sparse acks.
+	maxAckMetadataLength = 1024
 )
 
 var (
@@ -50,57 +102,180 @@ type T struct {
 	addr       string
 	listener   net.Listener
 	httpServer *manners.GracefulServer
+	cfg        *config.App
 	proxySet   *proxy.Set
+	shutdownTr *shutdown.T
 	wg         sync.WaitGroup
 	errorCh    chan error
+	routes     []route
+
+	wsMu      sync.Mutex
+	wsStopped bool
+	wsStopCh  chan none.T
+	wsWG      sync.WaitGroup
 }
 
 // New creates an HTTP server instance that will accept API requests at the
 // specified `network`/`address` and execute them with the specified `producer`,
-// `consumer`, or `admin`, depending on the request type.
-func New(addr string, proxySet *proxy.Set) (*T, error) {
-	network := networkUnix
-	if strings.Contains(addr, ":") {
-		network = networkTCP
+// `consumer`, or `admin`, depending on the request type. If HMAC keys are
+// configured in `cfg`, then only signed requests are accepted. Requests in
+// flight are reported to `shutdownTr`.
+func New(addr string, proxySet *proxy.Set, cfg *config.App, shutdownTr *shutdown.T) (*T, error) {
+	router := mux.NewRouter()
+	name := fmt.Sprintf("http://%s", addr)
+	handler := newCompressor(cfg).wrap(router)
+	handler = newCORSHandler(cfg, listenerNetwork(addr)).wrap(handler)
+	handler = logRequests(name, trackRequests(name, shutdownTr, handler))
+	hs, err := newServer(addr, cfg, handler, shutdownTr)
+	if err != nil {
+		return nil, err
+	}
+	hs.proxySet = proxySet
+	// Configure the API request handlers.
+	hs.registerRoutes(router, "", apiRoutes)
+	hs.registerRoutes(router, v2Prefix, v2Routes)
+	hs.registerRoutes(router, "", adminRoutes)
+	return hs, nil
+}
+
+// NewAdmin creates an HTTP server instance that serves admin requests only.
+// Unlike API servers, an admin server is supposed to be stopped after all
+// proxies, so that it can report progress of a service shutdown.
+func NewAdmin(addr string, cfg *config.App, shutdownTr *shutdown.T) (*T, error) {
+	router := mux.NewRouter()
+	hs, err := newServer(addr, cfg, router, shutdownTr)
+	if err != nil {
+		return nil, err
 	}
+	hs.registerRoutes(router, "", adminRoutes)
+	return hs, nil
+}
+
+func newServer(addr string, cfg *config.App, handler http.Handler, shutdownTr *shutdown.T) (*T, error) {
+	network := listenerNetwork(addr)
 	// Start listening on the specified network/address.
 	listener, err := net.Listen(network, addr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create listener")
 	}
-	// If the address is Unix Domain Socket then make it accessible for everyone.
+	actorID := actor.RootID.NewChild(fmt.Sprintf("http://%s", addr))
+	// If the address is Unix Domain Socket then make it accessible for
+	// everyone, and identify clients by credentials of their processes.
 	if network == networkUnix {
 		if err := os.Chmod(addr, 0777); err != nil {
 			return nil, errors.Wrap(err, "failed to change socket permissions")
 		}
+		listener = peerCredListener{Listener: listener, actorID: actorID}
 	}
 	// Create a graceful HTTP server instance.
-	router := mux.NewRouter()
-	httpServer := manners.NewWithServer(&http.Server{Handler: router})
-	hs := &T{
-		actorID:    actor.RootID.NewChild(fmt.Sprintf("http://%s", addr)),
+	if len(cfg.HMAC.Keys) > 0 {
+		handler = newSignatureVerifier(cfg.HMAC.Keys, cfg.HMAC.MaxClockSkew, maxRequestBodySize(cfg)).wrap(handler)
+	}
+	handler = timeRequests(requestTimings, cfg.Debug.TimingHeader, handler)
+	httpServer := manners.NewWithServer(&http.Server{Handler: handler, ConnContext: withPeerCred})
+	return &T{
+		actorID:    actorID,
 		addr:       addr,
 		listener:   manners.NewListener(listener),
 		httpServer: httpServer,
-		proxySet:   proxySet,
+		cfg:        cfg,
+		shutdownTr: shutdownTr,
 		errorCh:    make(chan error, 1),
+		wsStopCh:   make(chan none.T),
+	}, nil
+}
+
+// listenerNetwork returns the network of the specified listener address, that
+// is Unix domain socket unless the address has a port.
+func listenerNetwork(addr string) string {
+	if strings.Contains(addr, ":") {
+		return networkTCP
+	}
+	return networkUnix
+}
+
+// trackRequests wraps an HTTP handler to report requests in flight to the
+// shutdown tracker.
+func trackRequests(name string, shutdownTr *shutdown.T, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := shutdownTr.TrackRequest(name)
+		defer done()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// logRequests wraps an HTTP handler to log requests along with the response
+// status and the time it took to serve them. Only a sample of requests is
+// logged as configured by `config.App.LogSampling`. Message keys passed in
+// query parameters are not logged, see `loggedURI`.
+func logRequests(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		begin := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sr, r)
+		if sr.status >= http.StatusInternalServerError || sr.status == http.StatusTooManyRequests {
+			logging.FailedRequests.Warningf("<%s> request failed: %s %s, status=%d, took=%s, remote=%s",
+				name, r.Method, loggedURI(r.URL), sr.status, time.Since(begin), remoteAddr(r))
+			return
+		}
+		logging.Requests.Infof("<%s> request served: %s %s, status=%d, took=%s, remote=%s",
+			name, r.Method, loggedURI(r.URL), sr.status, time.Since(begin), remoteAddr(r))
+	})
+}
+
+// Query parameters that carry message keys, that must not appear in logs.
+var keyParams = []string{prmKey, prmKeyFilter, prmKeyPrefix}
+
+// loggedURI returns the request URI to be logged, where values of query
+// parameters that carry message keys are replaced with `config.Redacted`.
+func loggedURI(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, name := range keyParams {
+		values, ok := query[name]
+		if !ok {
+			continue
+		}
+		for i := range values {
+			values[i] = config.Redacted
+		}
+		redacted = true
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.RequestURI()
+}
+
+// statusRecorder remembers the status of a response written to the wrapped
+// response writer.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets WebSocket requests take over the connection.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	sr.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// Flush lets streamed responses be sent as they are written.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	// Configure the API request handlers.
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/messages", prmProxy, prmTopic), hs.handleProduce).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/messages", prmTopic), hs.handleProduce).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/messages", prmProxy, prmTopic), hs.handleProduce).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/messages", prmTopic), hs.handleProduce).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/messages", prmProxy, prmTopic), hs.handleProduce).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/messages", prmTopic), hs.handleConsume).Methods("GET")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/messages", prmProxy, prmTopic), hs.handleConsume).Methods("GET")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/offsets", prmTopic), hs.handleGetOffsets).Methods("GET")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/offsets", prmProxy, prmTopic), hs.handleGetOffsets).Methods("GET")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/offsets", prmTopic), hs.handleSetOffsets).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/offsets", prmProxy, prmTopic), hs.handleSetOffsets).Methods("POST")
-	router.HandleFunc(fmt.Sprintf("/topics/{%s}/consumers", prmTopic), hs.handleGetTopicConsumers).Methods("GET")
-	router.HandleFunc(fmt.Sprintf("/proxies/{%s}/topics/{%s}/consumers", prmProxy, prmTopic), hs.handleGetTopicConsumers).Methods("GET")
-	router.HandleFunc("/_ping", hs.handlePing).Methods("GET")
-	return hs, nil
 }
 
 // Starts triggers asynchronous HTTP server start. If it fails then the error
@@ -122,10 +297,15 @@ func (s *T) ErrorCh() <-chan error {
 
 // Stop gracefully stops the HTTP API server. It stops listening on the socket
 // for incoming requests first, and then blocks waiting for pending requests to
-// complete.
+// complete. WebSocket connections are closed.
 func (s *T) Stop() {
+	s.wsMu.Lock()
+	s.wsStopped = true
+	close(s.wsStopCh)
+	s.wsMu.Unlock()
 	s.httpServer.Close()
 	s.wg.Wait()
+	s.wsWG.Wait()
 	close(s.errorCh)
 }
 
@@ -134,62 +314,109 @@ func (s *T) getProxy(r *http.Request) (*proxy.T, error) {
 	return s.proxySet.Get(pxyAlias)
 }
 
+// getProxyForWrite is the same as getProxy, but for requests that produce
+// messages or modify offsets, that are rejected in maintenance mode.
+func (s *T) getProxyForWrite(r *http.Request) (*proxy.T, error) {
+	pxyAlias := mux.Vars(r)[prmProxy]
+	return s.proxySet.GetForWrite(pxyAlias)
+}
+
 // handleProduce is an HTTP request handler for `POST /topic/{topic}/messages`
 func (s *T) handleProduce(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	pxy, err := s.getProxy(r)
+	pxy, err := s.getProxyForWrite(r)
 	if err != nil {
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		respondWithProxyError(w, err)
 		return
 	}
 	topic := mux.Vars(r)[prmTopic]
-	key := getParamBytes(r, prmKey)
-	_, isSync := r.Form[prmSync]
-
-	// Get the message body from the HTTP request.
-	if _, ok := r.Header[hdrContentLength]; !ok {
-		errorText := fmt.Sprintf("Missing %s header", hdrContentLength)
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
-		return
-	}
-	messageSizeStr := r.Header.Get(hdrContentLength)
-	messageSize, err := strconv.Atoi(messageSizeStr)
+	format, err := getFormatParam(r)
 	if err != nil {
-		errorText := fmt.Sprintf("Invalid %s header: %s", hdrContentLength, messageSizeStr)
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-	message, err := ioutil.ReadAll(r.Body)
+	// In the raw format the message key and partition are specified in
+	// headers, so that the key can be arbitrary binary.
+	var key, partitionStr []byte
+	var isTombstone bool
+	if format == formatRaw {
+		if key, partitionStr, isTombstone, err = getRawMessageHeaders(r); err != nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			return
+		}
+	} else {
+		key = getParamBytes(r, prmKey)
+		partitionStr = getParamBytes(r, prmPartition)
+		_, isTombstone = r.Form[prmTombstone]
+	}
+	isSync := hasParam(r, prmSync)
+	timeout, err := getTimeoutParam(r)
 	if err != nil {
-		errorText := fmt.Sprintf("Failed to read a message: err=(%s)", err)
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-	if len(message) != messageSize {
-		errorText := fmt.Sprintf("Message size does not match %s: expected=%v, actual=%v",
-			hdrContentLength, messageSize, len(message))
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
-		return
+	partition := producer.AnyPartition
+	if partitionStr != nil {
+		parsed, err := strconv.ParseInt(string(partitionStr), 10, 32)
+		if err != nil || parsed < 0 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+			return
+		}
+		partition = int32(parsed)
+	}
+
+	var message sarama.Encoder
+	if isTombstone {
+		// A tombstone is a message with a null value, that is used to delete
+		// a key from a compacted topic, therefore it must have a key but no
+		// body.
+		if key == nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Tombstone requires a key"})
+			return
+		}
+		if r.ContentLength > 0 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Tombstone must not have a body"})
+			return
+		}
+	} else {
+		maxSize := proxyCfgByPath(s.cfg, r.URL.Path).Producer.MaxMessageSize
+		body, err := readMessageBody(w, r, maxSize)
+		if err != nil {
+			respondWithBodyError(w, err)
+			return
+		}
+		message = sarama.StringEncoder(body)
 	}
 
+	// Messages with a trace header are traced if message tracing is enabled.
+	traceID := r.Header.Get(hdrTraceID)
+
 	// Asynchronously submit the message to the Kafka cluster.
 	if !isSync {
-		pxy.AsyncProduce(topic, toEncoderPreservingNil(key), sarama.StringEncoder(message))
+		if traceID != "" {
+			err = pxy.AsyncProduceTraced(getTenant(r), traceID, topic, partition, toEncoderPreservingNil(key), message)
+		} else {
+			err = pxy.AsyncProduceToPartition(getTenant(r), topic, partition, toEncoderPreservingNil(key), message)
+		}
+		if err != nil {
+			respondWithProduceError(w, err)
+			return
+		}
 		respondWithJSON(w, http.StatusOK, EmptyResponse)
 		return
 	}
 
-	prodMsg, err := pxy.Produce(topic, toEncoderPreservingNil(key), sarama.StringEncoder(message))
+	var prodMsg *sarama.ProducerMessage
+	queueDone := trackQueue(r)
+	if traceID != "" {
+		prodMsg, err = pxy.ProduceTraced(getTenant(r), traceID, topic, partition, toEncoderPreservingNil(key), message, timeout)
+	} else {
+		prodMsg, err = pxy.ProduceToPartition(getTenant(r), topic, partition, toEncoderPreservingNil(key), message, timeout)
+	}
+	queueDone()
 	if err != nil {
-		var status int
-		switch err {
-		case sarama.ErrUnknownTopicOrPartition:
-			status = http.StatusNotFound
-		default:
-			status = http.StatusInternalServerError
-		}
-		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		respondWithProduceError(w, err)
 		return
 	}
 
@@ -199,196 +426,1505 @@ func (s *T) handleProduce(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleConsume is an HTTP request handler for `GET /topic/{topic}/messages`
-func (s *T) handleConsume(w http.ResponseWriter, r *http.Request) {
+// handleProduceBatch is an HTTP request handler for
+// `POST /topic/{topic}/messages/batch`
+func (s *T) handleProduceBatch(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	pxy, err := s.getProxy(r)
+	pxy, err := s.getProxyForWrite(r)
 	if err != nil {
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		respondWithProxyError(w, err)
 		return
 	}
 	topic := mux.Vars(r)[prmTopic]
-	group, err := getGroupParam(r, false)
+	isSync := hasParam(r, prmSync)
+	timeout, err := getTimeoutParam(r)
 	if err != nil {
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-
-	consMsg, err := pxy.Consume(group, topic, proxy.AutoAck())
+	maxSize := proxyCfgByPath(s.cfg, r.URL.Path).Producer.MaxBatchBytes
+	body, err := readMessageBody(w, r, maxSize)
 	if err != nil {
-		var status int
-		switch err.(type) {
-		case consumer.ErrRequestTimeout:
-			status = http.StatusRequestTimeout
-		case consumer.ErrTooManyRequests:
-			status = http.StatusTooManyRequests
-		default:
-			status = http.StatusInternalServerError
+		respondWithBodyError(w, err)
+		return
+	}
+	var batch []produceBatchHTTPRecord
+	if err := json.Unmarshal(body, &batch); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Invalid batch: " + err.Error()})
+		return
+	}
+	if len(batch) == 0 {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Empty batch"})
+		return
+	}
+	records := make([]producer.Record, len(batch))
+	for i, rec := range batch {
+		// Message headers require Kafka protocol version 0.11, that is not
+		// supported yet.
+		if len(rec.Headers) != 0 {
+			errorText := fmt.Sprintf("Record %d: message headers are not supported", i)
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+			return
 		}
-		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		if rec.Value == nil && rec.Key == nil {
+			errorText := fmt.Sprintf("Record %d: tombstone requires a key", i)
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+			return
+		}
+		records[i] = producer.Record{
+			Key:   toEncoderPreservingNil(rec.Key),
+			Value: toEncoderPreservingNil(rec.Value),
+		}
+	}
+
+	if !isSync {
+		if err := pxy.AsyncProduceBatch(getTenant(r), topic, records); err != nil {
+			respondWithProduceError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, EmptyResponse)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, consumeHTTPResponse{
-		Key:       consMsg.Key,
-		Value:     consMsg.Value,
-		Partition: consMsg.Partition,
-		Offset:    consMsg.Offset,
-	})
+	queueDone := trackQueue(r)
+	results, err := pxy.ProduceBatch(getTenant(r), topic, records, timeout)
+	queueDone()
+	if err != nil {
+		respondWithProduceError(w, err)
+		return
+	}
+	// If some messages failed, then the status is chosen by the error of the
+	// first failed one, but results of all messages are returned anyway.
+	status := http.StatusOK
+	res := make([]produceBatchHTTPResponse, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			if status == http.StatusOK {
+				status = produceErrorStatus(result.Err)
+			}
+			res[i].Error = result.Err.Error()
+			continue
+		}
+		res[i].Partition = result.Msg.Partition
+		res[i].Offset = result.Msg.Offset
+	}
+	respondWithJSON(w, status, res)
 }
 
-// handleGetOffsets is an HTTP request handler for `GET /topic/{topic}/offsets`
-func (s *T) handleGetOffsets(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
+// readMessageBody reads a message from the HTTP request body making sure that
+// its size matches the `Content-Length` header and does not exceed `maxSize`.
+// A request that declares a larger body is rejected before the body is read,
+// and the body is read through `http.MaxBytesReader` anyway, so that the whole
+// body is never buffered whatever the client sends. If the message is too
+// large then `errMessageTooLarge` is returned.
+func readMessageBody(w http.ResponseWriter, r *http.Request, maxSize int) ([]byte, error) {
+	if _, ok := r.Header[hdrContentLength]; !ok {
+		return nil, errors.Errorf("Missing %s header", hdrContentLength)
+	}
+	messageSizeStr := r.Header.Get(hdrContentLength)
+	messageSize, err := strconv.Atoi(messageSizeStr)
+	if err != nil {
+		return nil, errors.Errorf("Invalid %s header: %s", hdrContentLength, messageSizeStr)
+	}
+	if messageSize > maxSize {
+		return nil, errMessageTooLarge{size: messageSize, maxSize: maxSize}
+	}
+	message, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxSize)))
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			return nil, errMessageTooLarge{size: -1, maxSize: maxSize}
+		}
+		return nil, errors.Errorf("Failed to read a message: err=(%s)", err)
+	}
+	if len(message) != messageSize {
+		return nil, errors.Errorf("Message size does not match %s: expected=%v, actual=%v",
+			hdrContentLength, messageSize, len(message))
+	}
+	return message, nil
+}
 
-	pxy, err := s.getProxy(r)
+// handleConsume is an HTTP request handler for `GET /topic/{topic}/messages`
+func (s *T) handleConsume(w http.ResponseWriter, r *http.Request) {
+	format, err := getConsumeFormat(r)
 	if err != nil {
+		r.Body.Close()
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-	topic := mux.Vars(r)[prmTopic]
-	group, err := getGroupParam(r, false)
-	if err != nil {
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+	if format == formatRaw {
+		s.serveConsume(w, r, rawFormat{})
 		return
 	}
+	s.serveConsume(w, r, v1Format{})
+}
 
-	partitionOffsets, err := pxy.GetGroupOffsets(group, topic)
+// getConsumeFormat returns the message format requested with the `format`
+// parameter. The raw format cannot carry more than one message, so it is an
+// error to request it along with a batch.
+func getConsumeFormat(r *http.Request) (string, error) {
+	format, err := getFormatParam(r)
 	if err != nil {
-		if err, ok := err.(admin.ErrQuery); ok && err.Cause() == sarama.ErrUnknownTopicOrPartition {
-			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
-			return
-		}
-		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
-		return
+		return "", err
 	}
-
-	offsetViews := make([]partitionOffsetView, len(partitionOffsets))
-	for i, po := range partitionOffsets {
-		offsetViews[i].Partition = po.Partition
-		offsetViews[i].Begin = po.Begin
-		offsetViews[i].End = po.End
-		offsetViews[i].Count = po.End - po.Begin
-		offsetViews[i].Offset = po.Offset
-		if po.Offset == sarama.OffsetNewest {
-			offsetViews[i].Lag = 0
-		} else if po.Offset == sarama.OffsetOldest {
-			offsetViews[i].Lag = po.End - po.Begin
-		} else {
-			offsetViews[i].Lag = po.End - po.Offset
-		}
-		offsetViews[i].Metadata = po.Metadata
-		offset := offsetmgr.Offset{Val: po.Offset, Meta: po.Metadata}
-		offsetViews[i].SparseAcks = offsettrac.SparseAcks2Str(offset)
+	if _, isBatch := r.URL.Query()[prmBatch]; isBatch && format == formatRaw {
+		return "", errors.New("Batch consume does not support raw format")
 	}
-	respondWithJSON(w, http.StatusOK, offsetViews)
+	return format, nil
 }
 
-// handleGetOffsets is an HTTP request handler for `POST /topic/{topic}/offsets`
-func (s *T) handleSetOffsets(w http.ResponseWriter, r *http.Request) {
+// serveConsume consumes messages as requested and sends them in the specified
+// format.
+func (s *T) serveConsume(w http.ResponseWriter, r *http.Request, format messageFormat) {
 	defer r.Body.Close()
 
-	pxy, err := s.getProxy(r)
+	pxy, done, err := s.proxySet.GetForConsume(mux.Vars(r)[prmProxy])
 	if err != nil {
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		respondWithProxyError(w, err)
 		return
 	}
+	defer done()
 	topic := mux.Vars(r)[prmTopic]
-	group, err := getGroupParam(r, false)
+	groups, err := getGroupsParam(r)
 	if err != nil {
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-
-	body, err := ioutil.ReadAll(r.Body)
+	timeout, err := getWaitParam(r)
 	if err != nil {
-		errorText := fmt.Sprintf("Failed to read the request: err=(%s)", err)
-		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-
-	var partitionOffsetViews []partitionOffsetView
-	if err := json.Unmarshal(body, &partitionOffsetViews); err != nil {
-		errorText := fmt.Sprintf("Failed to parse the request: err=(%s)", err)
+	subscriptionTTL, err := getSubscriptionTTLParam(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	ackMeta := string(getParamBytes(r, prmAckMetadata))
+	if len(ackMeta) > maxAckMetadataLength {
+		errorText := fmt.Sprintf("Ack metadata too long: max=%d", maxAckMetadataLength)
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
 		return
 	}
 
-	partitionOffsets := make([]admin.PartitionOffset, len(partitionOffsetViews))
-	for i, pov := range partitionOffsetViews {
-		partitionOffsets[i].Partition = pov.Partition
-		partitionOffsets[i].Offset = pov.Offset
-		partitionOffsets[i].Metadata = pov.Metadata
+	batchSize, isBatch, err := getBatchParam(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
 	}
-
-	err = pxy.SetGroupOffsets(group, topic, partitionOffsets)
+	client := getClientParam(r)
+	// Messages consumed in the explicit ack mode have to be acknowledged with
+	// a separate ack request.
+	_, noAutoAck := r.Form[prmNoAutoAck]
+	ack := proxy.AutoAck().WithMeta(ackMeta)
+	if noAutoAck {
+		if len(groups) > 1 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Explicit ack requires one consumer group"})
+			return
+		}
+		ack = proxy.NoAck()
+	}
+	keyFilter, err := getKeyFilterParam(r)
 	if err != nil {
-		if err, ok := err.(admin.ErrQuery); ok && err.Cause() == sarama.ErrUnknownTopicOrPartition {
-			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	if keyFilter != nil {
+		if len(groups) > 1 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Key filter requires one consumer group"})
 			return
 		}
-		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		if isBatch {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Batch consume does not support key filter"})
+			return
+		}
+	}
+	var pattern *regexp.Regexp
+	if _, isPattern := r.Form[prmPattern]; isPattern {
+		var errorText string
+		switch {
+		case len(groups) > 1:
+			errorText = "Topic pattern requires one consumer group"
+		case isBatch:
+			errorText = "Batch consume does not support topic pattern"
+		case keyFilter != nil:
+			errorText = "Key filter does not support topic pattern"
+		}
+		if errorText != "" {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+			return
+		}
+		if pattern, err = proxy.CompileTopicPattern(topic); err != nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			return
+		}
+	}
+	if isBatch {
+		if len(groups) > 1 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Batch consume requires one consumer group"})
+			return
+		}
+		queueDone := trackQueue(r)
+		consMsgs, err := pxy.ConsumeBatch(getTenant(r), client, groups[0], topic, ack, batchSize, timeout, subscriptionTTL)
+		queueDone()
+		if err != nil {
+			respondWithConsumeError(w, err)
+			return
+		}
+		format.writeMessages(w, groups[0], consMsgs)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, EmptyResponse)
+	var group string
+	var consMsg consumer.Message
+	queueDone := trackQueue(r)
+	if pattern != nil {
+		group = groups[0]
+		consMsg, err = pxy.ConsumePattern(getTenant(r), client, group, pattern, ack, timeout, subscriptionTTL)
+	} else if noAutoAck || keyFilter != nil {
+		group = groups[0]
+		consMsg, err = pxy.ConsumeFiltered(getTenant(r), client, group, topic, ack, keyFilter, timeout, subscriptionTTL)
+	} else {
+		group, consMsg, err = pxy.ConsumeAny(getTenant(r), client, groups, topic, ackMeta, timeout, subscriptionTTL)
+	}
+	queueDone()
+	if err != nil {
+		respondWithConsumeError(w, err)
+		return
+	}
+	format.writeMessage(w, group, len(groups) > 1, pattern != nil, consMsg)
 }
 
-// handleGetTopicConsumers is an HTTP request handler for `GET /topic/{topic}/consumers`
-func (s *T) handleGetTopicConsumers(w http.ResponseWriter, r *http.Request) {
+// handleConsumeTopics is an HTTP request handler for
+// `GET /groups/{group}/messages`. It returns the next message available in any
+// of the topics given with the `topic` parameter.
+func (s *T) handleConsumeTopics(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	var err error
 
-	pxy, err := s.getProxy(r)
+	format, err := getFormatParam(r)
 	if err != nil {
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
-	topic := mux.Vars(r)[prmTopic]
-
-	group, err := getGroupParam(r, true)
+	pxy, done, err := s.proxySet.GetForConsume(mux.Vars(r)[prmProxy])
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	defer done()
+	group := mux.Vars(r)[prmGroup]
+	r.ParseForm()
+	topics := r.Form[prmTopic]
+	if len(topics) == 0 {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"At least one topic is expected"})
+		return
+	}
+	timeout, err := getWaitParam(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	subscriptionTTL, err := getSubscriptionTTLParam(r)
 	if err != nil {
 		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
 		return
 	}
+	ackMeta := string(getParamBytes(r, prmAckMetadata))
+	if len(ackMeta) > maxAckMetadataLength {
+		errorText := fmt.Sprintf("Ack metadata too long: max=%d", maxAckMetadataLength)
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+	ack := proxy.AutoAck().WithMeta(ackMeta)
+	if _, noAutoAck := r.Form[prmNoAutoAck]; noAutoAck {
+		ack = proxy.NoAck()
+	}
 
-	var consumers map[string]map[string][]int32
+	queueDone := trackQueue(r)
+	consMsg, err := pxy.ConsumeTopics(getTenant(r), getClientParam(r), group, topics, ack, timeout, subscriptionTTL)
+	queueDone()
+	if err != nil {
+		respondWithConsumeError(w, err)
+		return
+	}
+	var msgFormat messageFormat = v1Format{}
+	if format == formatRaw {
+		msgFormat = rawFormat{}
+	}
+	msgFormat.writeMessage(w, group, false, true, consMsg)
+}
+
+// handleAck is an HTTP request handler for
+// `POST /topics/{topic}/messages/ack`
+func (s *T) handleAck(w http.ResponseWriter, r *http.Request) {
+	s.serveAck(w, r, false)
+}
+
+// handleAckUpTo is an HTTP request handler for
+// `POST /topics/{topic}/acks/upto`. It acknowledges all consumed messages of
+// the partition at or below the given offset at once.
+func (s *T) handleAckUpTo(w http.ResponseWriter, r *http.Request) {
+	s.serveAck(w, r, true)
+}
+
+func (s *T) serveAck(w http.ResponseWriter, r *http.Request, upTo bool) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	partitionStr := string(getParamBytes(r, prmPartition))
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+		return
+	}
+	offsetStr := string(getParamBytes(r, prmOffset))
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid offset: %s", offsetStr)})
+		return
+	}
+	ack, err := proxy.Ack(int32(partition), offset)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	ackMeta := string(getParamBytes(r, prmAckMetadata))
+	if len(ackMeta) > maxAckMetadataLength {
+		errorText := fmt.Sprintf("Ack metadata too long: max=%d", maxAckMetadataLength)
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+
+	ackFn := pxy.Ack
+	if upTo {
+		ackFn = pxy.AckUpTo
+	}
+	if err := ackFn(group, topic, ack.WithMeta(ackMeta)); err != nil {
+		var status int
+		switch {
+		case err == proxy.ErrNotConsumed:
+			status = http.StatusNotFound
+		case errs.Is(err, errs.ErrRequestTimeout):
+			status = http.StatusRequestTimeout
+		default:
+			status = http.StatusInternalServerError
+		}
+		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleReadMessages is an HTTP request handler for
+// `GET /topics/{topic}/partitions/{partition}/messages`. Messages are read
+// either from the given offset, or from the offset committed by the group if
+// the `committed` flag is set.
+func (s *T) handleReadMessages(w http.ResponseWriter, r *http.Request) {
+	s.serveReadMessages(w, r, v1Format{})
+}
+
+// serveReadMessages reads messages as requested and sends them in the
+// specified format.
+func (s *T) serveReadMessages(w http.ResponseWriter, r *http.Request, format messageFormat) {
+	defer r.Body.Close()
+
+	// Read messages are returned as a list, that the raw format cannot carry.
+	if formatParam, err := getFormatParam(r); err != nil || formatParam == formatRaw {
+		if err == nil {
+			err = errors.New("Read messages does not support raw format")
+		}
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	partitionStr := mux.Vars(r)[prmPartition]
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil || partition < 0 {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+		return
+	}
+	committed, err := getFlagParam(r, prmCommitted)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	var group string
+	var offset int64
+	if committed {
+		if getParamBytes(r, prmOffset) != nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Offset cannot be specified with committed"})
+			return
+		}
+		if group, err = getGroupParam(r, false); err != nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			return
+		}
+	} else {
+		offsetStr := string(getParamBytes(r, prmOffset))
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid offset: %s", offsetStr)})
+			return
+		}
+	}
+	count := 1
+	if countStr := getParamBytes(r, prmCount); countStr != nil {
+		count, err = strconv.Atoi(string(countStr))
+		if err != nil || count <= 0 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid count: %s", countStr)})
+			return
+		}
+	}
+
+	var messages []admin.Message
+	if committed {
+		messages, err = pxy.ReadCommittedMessages(group, topic, int32(partition), count)
+	} else {
+		messages, err = pxy.ReadMessages(topic, int32(partition), offset, count)
+	}
+	if err != nil {
+		var status int
+		switch {
+		case errs.Is(err, errs.ErrInvalidParam):
+			status = http.StatusBadRequest
+		case errs.Is(err, errs.ErrDisabled):
+			status = http.StatusForbidden
+		default:
+			status = http.StatusInternalServerError
+		}
+		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		return
+	}
+	consMsgs := make([]consumer.Message, len(messages))
+	for i, msg := range messages {
+		consMsgs[i] = consumer.Message{
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Topic:     topic,
+			Partition: int32(partition),
+			Offset:    msg.Offset,
+		}
+	}
+	format.writeMessages(w, group, consMsgs)
+}
+
+// handleHeartbeat is an HTTP request handler for `POST /groups/{group}/heartbeat`
+func (s *T) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	r.ParseForm()
+	topics := r.Form[prmTopic]
+	if len(topics) != 1 {
+		errorText := fmt.Sprintf("one topic is expected, but %d provided", len(topics))
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+	if err := pxy.Heartbeat(group, topics[0]); err != nil {
+		var status int
+		switch {
+		case err == consumer.ErrNotSubscribed:
+			status = http.StatusNotFound
+		case errs.Is(err, errs.ErrTooManyRequests):
+			status = http.StatusTooManyRequests
+		default:
+			status = http.StatusInternalServerError
+		}
+		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleEvictGroupMember is an HTTP request handler for
+// `DELETE /groups/{group}/members/{member}`
+func (s *T) handleEvictGroupMember(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	member := mux.Vars(r)[prmMember]
+	released, err := pxy.EvictGroupMember(group, member)
+	if err != nil {
+		if errs.Is(err, errs.ErrInvalidParam) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, evictHTTPResponse{Released: released})
+}
+
+// handleRebalanceGroup is an HTTP request handler for
+// `POST /groups/{group}/rebalance`
+func (s *T) handleRebalanceGroup(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	if err := pxy.RebalanceGroup(group); err != nil {
+		if err == consumer.ErrGroupNotConsumed {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, EmptyResponse)
+}
+
+// handleGetOffsets is an HTTP request handler for `GET /topic/{topic}/offsets`
+func (s *T) handleGetOffsets(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	fields, err := getFieldsParam(r, partitionOffsetFields)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	pgr, err := getPager(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	refresh, err := getFlagParam(r, prmRefresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	partitionOffsets, fetchedAt, err := pxy.GetGroupOffsets(group, topic, refresh)
+	if err != nil {
+		if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	setAgeHeader(w, fetchedAt)
+
+	offsetViews := pagePartitionOffsetViews(pgr, "", newPartitionOffsetViews(partitionOffsets))
+	pgr.setNextCursor(w)
+	if fields != nil {
+		respondWithJSON(w, http.StatusOK, selectPartitionOffsetFields(offsetViews, fields))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, offsetViews)
+}
+
+// handleGetTopics is an HTTP request handler for `GET /topics`
+func (s *T) handleGetTopics(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	withPartitions, err := getFlagParam(r, prmWithParts)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	withConfig, err := getFlagParam(r, prmWithConfig)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	topicInfos, err := pxy.GetTopics(withPartitions, withConfig)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	// Without details topics are listed by name only.
+	if !withPartitions && !withConfig {
+		topics := make([]string, len(topicInfos))
+		for i, ti := range topicInfos {
+			topics[i] = ti.Topic
+		}
+		respondWithJSON(w, http.StatusOK, topics)
+		return
+	}
+	// Only requested details are included, but those are included even if
+	// empty, e.g. a topic without config overrides has an empty config.
+	res := make(map[string]map[string]interface{}, len(topicInfos))
+	for _, ti := range topicInfos {
+		tiv := make(map[string]interface{}, 2)
+		if withPartitions {
+			tiv["partitions"] = ti.Partitions
+		}
+		if withConfig {
+			tiv["config"] = ti.Config
+		}
+		res[ti.Topic] = tiv
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handleGetTopicMetadata is an HTTP request handler for `GET /topics/{topic}`
+func (s *T) handleGetTopicMetadata(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+
+	partitionsMetadata, err := pxy.GetTopicMetadata(topic)
+	if err != nil {
+		if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	res := topicMetadataHTTPResponse{
+		Partitions: make([]partitionMetadataView, len(partitionsMetadata)),
+	}
+	for i, pm := range partitionsMetadata {
+		res.Partitions[i] = partitionMetadataView{
+			Partition: pm.Partition,
+			Leader:    pm.Leader,
+			Replicas:  pm.Replicas,
+			ISR:       pm.ISR,
+		}
+	}
+	res.PartitionCount = len(res.Partitions)
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handleGetAllGroupOffsets is an HTTP request handler for
+// `GET /groups/{group}/offsets`
+func (s *T) handleGetAllGroupOffsets(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	fields, err := getFieldsParam(r, partitionOffsetFields)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	pgr, err := getPager(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	refresh, err := getFlagParam(r, prmRefresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	topicOffsets, fetchedAt, err := pxy.GetAllGroupOffsets(group, refresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	setAgeHeader(w, fetchedAt)
+	// Topics are paged through in alphabetical order, and those that have
+	// no partitions in the page are omitted.
+	topics := make([]string, 0, len(topicOffsets))
+	for topic := range topicOffsets {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	res := make(map[string]interface{}, len(topicOffsets))
+	for _, topic := range topics {
+		offsetViews := pagePartitionOffsetViews(pgr, topic, newPartitionOffsetViews(topicOffsets[topic]))
+		if len(offsetViews) == 0 {
+			continue
+		}
+		if fields != nil {
+			res[topic] = selectPartitionOffsetFields(offsetViews, fields)
+			continue
+		}
+		res[topic] = offsetViews
+	}
+	pgr.setNextCursor(w)
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handleGetGroupLag is an HTTP request handler for `GET /groups/{group}/lag`
+func (s *T) handleGetGroupLag(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	refresh, err := getFlagParam(r, prmRefresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	topicOffsets, fetchedAt, err := pxy.GetAllGroupOffsets(group, refresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	setAgeHeader(w, fetchedAt)
+	res := groupLagHTTPResponse{Topics: make(map[string]topicLagView, len(topicOffsets))}
+	for topic, partitionOffsets := range topicOffsets {
+		tlv := topicLagView{Partitions: make([]partitionLagView, len(partitionOffsets))}
+		for i, po := range partitionOffsets {
+			lag := po.Lag()
+			tlv.Partitions[i] = partitionLagView{Partition: po.Partition, Lag: lag}
+			tlv.TotalLag += lag
+		}
+		res.Topics[topic] = tlv
+		res.TotalLag += tlv.TotalLag
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handleGetGroupRebalances is an HTTP request handler for
+// `GET /groups/{group}/rebalances`
+func (s *T) handleGetGroupRebalances(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	group := mux.Vars(r)[prmGroup]
+	respondWithJSON(w, http.StatusOK, pxy.Rebalances(group))
+}
+
+func newPartitionOffsetViews(partitionOffsets []admin.PartitionOffset) []partitionOffsetView {
+	offsetViews := make([]partitionOffsetView, len(partitionOffsets))
+	for i, po := range partitionOffsets {
+		offsetViews[i].Partition = po.Partition
+		offsetViews[i].Begin = po.Begin
+		offsetViews[i].End = po.End
+		offsetViews[i].Count = po.End - po.Begin
+		offsetViews[i].Offset = po.Offset
+		offsetViews[i].Lag = po.Lag()
+		offsetViews[i].Metadata = po.Metadata
+		offset := offsetmgr.Offset{Val: po.Offset, Meta: po.Metadata}
+		offsetViews[i].SparseAcks = offsettrac.SparseAcks2Str(offset)
+		offsetViews[i].AckMetadata = offsettrac.UserMeta(offset)
+	}
+	return offsetViews
+}
+
+// selectPartitionOffsetFields returns partition offset views with only the
+// specified fields, and the partition. As with complete views, empty string
+// fields are omitted.
+func selectPartitionOffsetFields(offsetViews []partitionOffsetView, fields []string) []map[string]interface{} {
+	selected := make([]map[string]interface{}, len(offsetViews))
+	for i, ov := range offsetViews {
+		sov := make(map[string]interface{}, len(fields)+1)
+		sov["partition"] = ov.Partition
+		for _, field := range fields {
+			switch field {
+			case "begin":
+				sov[field] = ov.Begin
+			case "end":
+				sov[field] = ov.End
+			case "count":
+				sov[field] = ov.Count
+			case "offset":
+				sov[field] = ov.Offset
+			case "lag":
+				sov[field] = ov.Lag
+			case "metadata":
+				setIfNotEmpty(sov, field, ov.Metadata)
+			case "sparse_acks":
+				setIfNotEmpty(sov, field, ov.SparseAcks)
+			case "ack_metadata":
+				setIfNotEmpty(sov, field, ov.AckMetadata)
+			}
+		}
+		selected[i] = sov
+	}
+	return selected
+}
+
+func setIfNotEmpty(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// handleGetOffsets is an HTTP request handler for `POST /topic/{topic}/offsets`
+func (s *T) handleSetOffsets(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxyForWrite(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	timestamp, err := getTimestampParam(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	// If a timestamp is specified, then offsets are resolved from it, rather
+	// than taken from the request content.
+	if !timestamp.IsZero() {
+		partitionOffsets, err := pxy.RewindGroupOffsets(group, topic, timestamp)
+		if err != nil {
+			if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+				respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+				return
+			}
+			respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusOK, newPartitionOffsetViews(partitionOffsets))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorText := fmt.Sprintf("Failed to read the request: err=(%s)", err)
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+
+	var partitionOffsetViews []partitionOffsetView
+	if err := json.Unmarshal(body, &partitionOffsetViews); err != nil {
+		errorText := fmt.Sprintf("Failed to parse the request: err=(%s)", err)
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+
+	partitionOffsets := make([]admin.PartitionOffset, len(partitionOffsetViews))
+	for i, pov := range partitionOffsetViews {
+		partitionOffsets[i].Partition = pov.Partition
+		partitionOffsets[i].Offset = pov.Offset
+		partitionOffsets[i].Metadata = pov.Metadata
+	}
+
+	err = pxy.SetGroupOffsets(group, topic, partitionOffsets)
+	if err != nil {
+		if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleGetTopicConsumers is an HTTP request handler for `GET /topic/{topic}/consumers`
+func (s *T) handleGetTopicConsumers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+
+	group, err := getGroupParam(r, true)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	pgr, err := getPager(r)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	refresh, err := getFlagParam(r, prmRefresh)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	var consumers map[string]map[string][]int32
+	var fetchedAt time.Time
 	if group == "" {
-		consumers, err = pxy.GetAllTopicConsumers(topic)
+		consumers, fetchedAt, err = pxy.GetAllTopicConsumers(topic, refresh)
+		if err != nil {
+			respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+			return
+		}
+	} else {
+		var groupConsumers map[string][]int32
+		groupConsumers, fetchedAt, err = pxy.GetTopicConsumers(group, topic, refresh)
 		if err != nil {
+			if errs.Is(err, errs.ErrInvalidParam) {
+				respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+				return
+			}
 			respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
 			return
 		}
-	} else {
-		groupConsumers, err := pxy.GetTopicConsumers(group, topic)
+		consumers = make(map[string]map[string][]int32)
+		if len(groupConsumers) != 0 {
+			consumers[group] = groupConsumers
+		}
+	}
+
+	consumers = pageTopicConsumers(pgr, consumers)
+	pgr.setNextCursor(w)
+	setAgeHeader(w, fetchedAt)
+
+	encodedRes, err := json.MarshalIndent(consumers, "", "  ")
+	if err != nil {
+		log.Errorf("Failed to send HTTP response: status=%d, err=%+v", http.StatusOK, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	encodedRes = prettyfmt.CollapseJSON(encodedRes)
+
+	w.Header().Add(hdrContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(encodedRes); err != nil {
+		log.Errorf("Failed to send HTTP response: status=%d, err=%+v", http.StatusOK, err)
+	}
+}
+
+// handleStartShadow is an HTTP request handler for `POST /topics/{topic}/shadows`
+func (s *T) handleStartShadow(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxyForWrite(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	shadow := r.Form.Get(prmShadow)
+	if shadow == "" {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"shadow group is expected"})
+		return
+	}
+
+	if err := pxy.StartShadow(group, shadow, topic); err != nil {
+		switch err {
+		case proxy.ErrShadowSameGroup:
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			return
+		case proxy.ErrShadowExists:
+			respondWithJSON(w, http.StatusConflict, errorHTTPResponse{err.Error()})
+			return
+		}
+		if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleStopShadow is an HTTP request handler for `DELETE /topics/{topic}/shadows`
+func (s *T) handleStopShadow(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	r.ParseForm()
+	shadow := r.Form.Get(prmShadow)
+	if shadow == "" {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"shadow group is expected"})
+		return
+	}
+
+	if err := pxy.StopShadow(shadow, topic); err != nil {
+		if err == proxy.ErrShadowNotFound {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleGetUsage is an HTTP request handler for `GET /accounting`
+func (s *T) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	usage, err := pxy.Usage()
+	if err != nil {
+		if err == proxy.ErrAccountingDisabled {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, usage)
+}
+
+// handleGetHotPartitions is an HTTP request handler for
+// `GET /topics/{topic}/hot-partitions`
+func (s *T) handleGetHotPartitions(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+
+	report, err := pxy.HotPartitions(topic)
+	if err != nil {
+		if err == proxy.ErrHotPartsDisabled {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		if errs.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{"Unknown topic"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handleGetCoordinators is an HTTP request handler for
+// `GET /admin/coordinators`
+func (s *T) handleGetCoordinators(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.Coordinators())
+}
+
+// handleGetFetchErrors is an HTTP request handler for
+// `GET /admin/fetch-errors`
+func (s *T) handleGetFetchErrors(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.FetchErrors())
+}
+
+// handleGetProduceErrors is an HTTP request handler for
+// `GET /admin/produce-errors`
+func (s *T) handleGetProduceErrors(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.ProduceErrors())
+}
+
+// handleGetBrokers is an HTTP request handler for `GET /admin/brokers`
+func (s *T) handleGetBrokers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.Brokers())
+}
+
+// handleGetClients is an HTTP request handler for `GET /admin/clients`
+func (s *T) handleGetClients(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.Clients())
+}
+
+// handleGetDisabledTopics is an HTTP request handler for
+// `GET /admin/disabled-topics`
+func (s *T) handleGetDisabledTopics(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.DisabledTopics())
+}
+
+// handleDisableTopic is an HTTP request handler for
+// `POST /admin/disabled-topics/{op}/{topic}`
+func (s *T) handleDisableTopic(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	vars := mux.Vars(r)
+	if err := pxy.DisableTopic(vars[prmOp], vars[prmTopic], r.FormValue(prmReason)); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleEnableTopic is an HTTP request handler for
+// `DELETE /admin/disabled-topics/{op}/{topic}`
+func (s *T) handleEnableTopic(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	vars := mux.Vars(r)
+	if err := pxy.EnableTopic(vars[prmOp], vars[prmTopic]); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handlePauseConsumption is an HTTP request handler for
+// `POST /topics/{topic}/consumption/pause`
+func (s *T) handlePauseConsumption(w http.ResponseWriter, r *http.Request) {
+	s.setConsumptionPaused(w, r, true)
+}
+
+// handleResumeConsumption is an HTTP request handler for
+// `POST /topics/{topic}/consumption/resume`
+func (s *T) handleResumeConsumption(w http.ResponseWriter, r *http.Request) {
+	s.setConsumptionPaused(w, r, false)
+}
+
+func (s *T) setConsumptionPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	if paused {
+		pxy.PauseConsumption(group, topic)
+	} else {
+		pxy.ResumeConsumption(group, topic)
+	}
+	log.Infof("<%s> consumption paused=%t: group=%s, topic=%s", s.actorID, paused, group, topic)
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
+
+// handleGetPausedConsumption is an HTTP request handler for
+// `GET /admin/paused-consumption`
+func (s *T) handleGetPausedConsumption(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pxy.PausedConsumption())
+}
+
+// handleGetTrace is an HTTP request handler for `GET /traces/{traceID}`
+func (s *T) handleGetTrace(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	trace, err := pxy.Trace(mux.Vars(r)[prmTraceID])
+	if err != nil {
+		if err == proxy.ErrTracingDisabled || err == proxy.ErrTraceNotFound {
+			respondWithJSON(w, http.StatusNotFound, errorHTTPResponse{err.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, trace)
+}
+
+// handleGetProxies is an HTTP request handler for `GET /proxies`
+func (s *T) handleGetProxies(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, s.proxySet.Status())
+}
+
+// handleGetReady is an HTTP request handler for `GET /ready`. It responds with
+// 503 Service Unavailable if some of the proxies are still being started, or
+// if none of them is ready. Proxies that have failed for good make the
+// service degraded, but not unready, for they will never become ready.
+func (s *T) handleGetReady(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	res := readyHTTPResponse{Proxies: s.proxySet.Status()}
+	res.Ready, res.Degraded = proxy.Readiness(res.Proxies)
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, status, res)
+}
+
+// handleGetReadyz is an HTTP request handler for `GET /_readyz`. On top of
+// what `GET /ready` checks, it verifies that every ready proxy can fetch
+// metadata from its Kafka cluster and, unless its consumer groups are
+// coordinated by Kafka, has a ZooKeeper session. Checks of all proxies run in
+// parallel.
+func (s *T) handleGetReadyz(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	pxyStatuses := s.proxySet.Status()
+	res := readyzHTTPResponse{Proxies: make([]readyzProxyHTTPResponse, len(pxyStatuses))}
+	res.Ready, res.Degraded = proxy.Readiness(pxyStatuses)
+	var wg sync.WaitGroup
+	for i, pxyStatus := range pxyStatuses {
+		res.Proxies[i].ProxyStatus = pxyStatus
+		if !pxyStatus.Ready {
+			continue
+		}
+		pxy, err := s.proxySet.Get(pxyStatus.Alias)
 		if err != nil {
-			if _, ok := err.(admin.ErrInvalidParam); ok {
-				respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			// The proxy has been stopped since the status was taken.
+			res.Ready = false
+			res.Proxies[i].Ready = false
+			res.Proxies[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(pxyRes *readyzProxyHTTPResponse) {
+			defer wg.Done()
+			begin := time.Now()
+			err := pxy.CheckKafka()
+			pxyRes.Kafka = newCheckHTTPResponse("", err, time.Since(begin))
+			if !pxy.UsesZooKeeper() {
 				return
 			}
-			respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
-			return
-		}
-		consumers = make(map[string]map[string][]int32)
-		if len(groupConsumers) != 0 {
-			consumers[group] = groupConsumers
+			begin = time.Now()
+			state, err := pxy.CheckZooKeeper()
+			pxyRes.ZooKeeper = newCheckHTTPResponse(state, err, time.Since(begin))
+		}(&res.Proxies[i])
+	}
+	wg.Wait()
+	for _, pxyRes := range res.Proxies {
+		if pxyRes.Kafka != nil && !pxyRes.Kafka.OK || pxyRes.ZooKeeper != nil && !pxyRes.ZooKeeper.OK {
+			res.Ready = false
 		}
 	}
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, status, res)
+}
 
-	encodedRes, err := json.MarshalIndent(consumers, "", "  ")
+// handleGetHealthz is an HTTP request handler for `GET /_healthz`. It tells
+// that the process is alive, regardless of the state of proxies.
+func (s *T) handleGetHealthz(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, healthzHTTPResponse{Alive: true})
+}
+
+// handleGetMaintenance is an HTTP request handler for
+// `GET /admin/maintenance`
+func (s *T) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, maintenanceHTTPResponse{s.proxySet.Maintenance()})
+}
+
+// handleStartMaintenance is an HTTP request handler for
+// `POST /admin/maintenance`. Until maintenance is stopped, requests that
+// produce messages or modify offsets are rejected by all proxies.
+func (s *T) handleStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	s.proxySet.SetMaintenance(true)
+	log.Infof("<%s> maintenance started", s.actorID)
+	respondWithJSON(w, http.StatusOK, maintenanceHTTPResponse{true})
+}
+
+// handleStopMaintenance is an HTTP request handler for
+// `DELETE /admin/maintenance`
+func (s *T) handleStopMaintenance(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	s.proxySet.SetMaintenance(false)
+	log.Infof("<%s> maintenance stopped", s.actorID)
+	respondWithJSON(w, http.StatusOK, maintenanceHTTPResponse{false})
+}
+
+// handleGetRequestTimings is an HTTP request handler for
+// `GET /admin/request-timings`
+func (s *T) handleGetRequestTimings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, requestTimings.snapshot())
+}
+
+// handleGetShutdownStatus is an HTTP request handler for
+// `GET /admin/shutdown-status`
+func (s *T) handleGetShutdownStatus(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, s.shutdownTr.Status())
+}
+
+// handleGetConfig is an HTTP request handler for `GET /admin/config`. The
+// effective configuration is returned with the same parameter names as in the
+// YAML configuration file, and with secrets redacted.
+func (s *T) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	encodedCfg, err := yaml.Marshal(s.cfg.Redacted())
 	if err != nil {
-		log.Errorf("Failed to send HTTP response: status=%d, body=%v, err=%+v", http.StatusOK, encodedRes, err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
 		return
 	}
-	encodedRes = prettyfmt.CollapseJSON(encodedRes)
+	var cfgView interface{}
+	if err := yaml.Unmarshal(encodedCfg, &cfgView); err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jsonCompatible(cfgView))
+}
 
-	w.Header().Add(hdrContentType, "application/json")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(encodedRes); err != nil {
-		log.Errorf("Failed to send HTTP response: status=%d, body=%v, err=%+v", http.StatusOK, encodedRes, err)
+// jsonCompatible converts maps decoded from YAML, that have keys of arbitrary
+// types, into maps with string keys, so that they can be encoded to JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+		return v
+	}
+	return v
+}
+
+// handleGetVersion is an HTTP request handler for `GET /_version`
+func (s *T) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	res := versionHTTPResponse{
+		Version:       version.Version,
+		GitCommit:     version.GitCommit,
+		BuildDate:     version.BuildDate,
+		GoVersion:     runtime.Version(),
+		SaramaVersion: version.SaramaVersion,
+		Proxies:       make(map[string]version.KafkaProtocol, len(s.cfg.Proxies)),
 	}
+	for alias := range s.cfg.Proxies {
+		res.Proxies[alias] = version.Protocol()
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handleDrain is an HTTP request handler for `POST /_drain`. It makes the
+// service stop accepting consume requests, wait for those in flight, commit
+// offsets, and shut down. The progress can be followed via
+// `GET /admin/shutdown-status` on the admin server.
+func (s *T) handleDrain(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	s.shutdownTr.RequestDrain()
+	log.Infof("<%s> drain requested", s.actorID)
+	respondWithJSON(w, http.StatusAccepted, EmptyResponse)
 }
 
 func (s *T) handlePing(w http.ResponseWriter, r *http.Request) {
@@ -397,27 +1933,140 @@ func (s *T) handlePing(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("pong"))
 }
 
+type versionHTTPResponse struct {
+	Version       string                           `json:"version"`
+	GitCommit     string                           `json:"git_commit"`
+	BuildDate     string                           `json:"build_date"`
+	GoVersion     string                           `json:"go_version"`
+	SaramaVersion string                           `json:"sarama_version"`
+	Proxies       map[string]version.KafkaProtocol `json:"proxies"`
+}
+
 type produceHTTPResponse struct {
 	Partition int32 `json:"partition"`
 	Offset    int64 `json:"offset"`
 }
 
+type produceBatchHTTPRecord struct {
+	Key     []byte            `json:"key"`
+	Value   []byte            `json:"value"`
+	Headers []json.RawMessage `json:"headers"`
+}
+
+type produceBatchHTTPResponse struct {
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Error     string `json:"error,omitempty"`
+}
+
 type consumeHTTPResponse struct {
 	Key       []byte `json:"key"`
 	Value     []byte `json:"value"`
 	Partition int32  `json:"partition"`
 	Offset    int64  `json:"offset"`
+	Group     string `json:"group,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	Retries   int    `json:"retries,omitempty"`
+
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// partitionOffsetFields are fields of `partitionOffsetView` that can be
+// selected with the `fields` request parameter. The partition is always
+// included.
+var partitionOffsetFields = map[string]bool{
+	"begin":        true,
+	"end":          true,
+	"count":        true,
+	"offset":       true,
+	"lag":          true,
+	"metadata":     true,
+	"sparse_acks":  true,
+	"ack_metadata": true,
 }
 
 type partitionOffsetView struct {
-	Partition  int32  `json:"partition"`
-	Begin      int64  `json:"begin"`
-	End        int64  `json:"end"`
-	Count      int64  `json:"count"`
-	Offset     int64  `json:"offset"`
-	Lag        int64  `json:"lag"`
-	Metadata   string `json:"metadata,omitempty"`
-	SparseAcks string `json:"sparse_acks,omitempty"`
+	Partition   int32  `json:"partition"`
+	Begin       int64  `json:"begin"`
+	End         int64  `json:"end"`
+	Count       int64  `json:"count"`
+	Offset      int64  `json:"offset"`
+	Lag         int64  `json:"lag"`
+	Metadata    string `json:"metadata,omitempty"`
+	SparseAcks  string `json:"sparse_acks,omitempty"`
+	AckMetadata string `json:"ack_metadata,omitempty"`
+}
+
+type groupLagHTTPResponse struct {
+	TotalLag int64                   `json:"total_lag"`
+	Topics   map[string]topicLagView `json:"topics"`
+}
+
+type topicLagView struct {
+	TotalLag   int64              `json:"total_lag"`
+	Partitions []partitionLagView `json:"partitions"`
+}
+
+type partitionLagView struct {
+	Partition int32 `json:"partition"`
+	Lag       int64 `json:"lag"`
+}
+
+type topicMetadataHTTPResponse struct {
+	PartitionCount int                     `json:"partition_count"`
+	Partitions     []partitionMetadataView `json:"partitions"`
+}
+
+type partitionMetadataView struct {
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	ISR       []int32 `json:"isr"`
+}
+
+type evictHTTPResponse struct {
+	Released map[string][]int32 `json:"released"`
+}
+
+type readyHTTPResponse struct {
+	Ready    bool                `json:"ready"`
+	Degraded bool                `json:"degraded"`
+	Proxies  []proxy.ProxyStatus `json:"proxies"`
+}
+
+type readyzHTTPResponse struct {
+	Ready    bool                      `json:"ready"`
+	Degraded bool                      `json:"degraded"`
+	Proxies  []readyzProxyHTTPResponse `json:"proxies"`
+}
+
+type readyzProxyHTTPResponse struct {
+	proxy.ProxyStatus
+	Kafka     *checkHTTPResponse `json:"kafka,omitempty"`
+	ZooKeeper *checkHTTPResponse `json:"zookeeper,omitempty"`
+}
+
+type checkHTTPResponse struct {
+	OK    bool   `json:"ok"`
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+	Took  string `json:"took"`
+}
+
+func newCheckHTTPResponse(state string, err error, took time.Duration) *checkHTTPResponse {
+	res := checkHTTPResponse{OK: err == nil, State: state, Took: took.String()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return &res
+}
+
+type healthzHTTPResponse struct {
+	Alive bool `json:"alive"`
+}
+
+type maintenanceHTTPResponse struct {
+	Enabled bool `json:"enabled"`
 }
 
 type errorHTTPResponse struct {
@@ -436,12 +2085,270 @@ func getParamBytes(r *http.Request, name string) []byte {
 	return []byte(values[0])
 }
 
+// hasParam returns true if the request parameter is specified, whatever its
+// value, e.g. `?sync`. Unlike a lookup in `r.Form` it does not rely on the
+// form having been parsed by an earlier parameter read.
+func hasParam(r *http.Request, name string) bool {
+	return getParamBytes(r, name) != nil
+}
+
+// getTimeoutParam returns the value of the `timeout` request parameter, or
+// zero if it is not specified. The value should be a positive duration in a
+// format accepted by `time.ParseDuration`, e.g. `500ms` or `10s`.
+func getTimeoutParam(r *http.Request) (time.Duration, error) {
+	return getDurationParam(r, prmTimeout)
+}
+
+// getWaitParam returns the long polling timeout of a consume request, that can
+// be specified with either the `timeout` or the `wait` request parameter, but
+// not both. Zero is returned if neither is specified.
+func getWaitParam(r *http.Request) (time.Duration, error) {
+	if getParamBytes(r, prmWait) == nil {
+		return getTimeoutParam(r)
+	}
+	if getParamBytes(r, prmTimeout) != nil {
+		return 0, errors.Errorf("Either %s or %s can be specified, not both", prmTimeout, prmWait)
+	}
+	return getDurationParam(r, prmWait)
+}
+
+// getSubscriptionTTLParam returns the value of the `subscription_ttl` request
+// parameter, or zero if it is not specified. The value format is the same as
+// of the `timeout` parameter.
+func getSubscriptionTTLParam(r *http.Request) (time.Duration, error) {
+	return getDurationParam(r, prmSubTTL)
+}
+
+// getFlagParam returns the value of a boolean request parameter. A parameter
+// that is present without a value, e.g. `?withConfig`, is true.
+func getFlagParam(r *http.Request, name string) (bool, error) {
+	value := getParamBytes(r, name)
+	if value == nil {
+		return false, nil
+	}
+	if len(value) == 0 {
+		return true, nil
+	}
+	flag, err := strconv.ParseBool(string(value))
+	if err != nil {
+		return false, errors.Errorf("Invalid %s: %s", name, value)
+	}
+	return flag, nil
+}
+
+// getKeyFilterParam returns a key filter if one is specified in the request,
+// or nil otherwise.
+func getKeyFilterParam(r *http.Request) (*proxy.KeyFilter, error) {
+	key := getParamBytes(r, prmKeyFilter)
+	prefix, err := getFlagParam(r, prmKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		if prefix {
+			return nil, errors.Errorf("%s requires %s", prmKeyPrefix, prmKeyFilter)
+		}
+		return nil, nil
+	}
+	return &proxy.KeyFilter{Key: key, Prefix: prefix}, nil
+}
+
+// setAgeHeader adds the standard `Age` header to the response, that tells how
+// many seconds ago the response data was fetched, for it may have been served
+// from the query cache.
+func setAgeHeader(w http.ResponseWriter, fetchedAt time.Time) {
+	age := time.Since(fetchedAt) / time.Second
+	if age < 0 {
+		age = 0
+	}
+	w.Header().Set(hdrAge, strconv.Itoa(int(age)))
+}
+
+// getFieldsParam returns response fields selected with a comma separated list
+// in the `fields` request parameter, or nil if the parameter is not given.
+func getFieldsParam(r *http.Request, valid map[string]bool) ([]string, error) {
+	value := getParamBytes(r, prmFields)
+	if value == nil {
+		return nil, nil
+	}
+	fields := []string{}
+	for _, field := range strings.Split(string(value), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !valid[field] {
+			return nil, errors.Errorf("Invalid %s: unknown field %s", prmFields, field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func getDurationParam(r *http.Request, name string) (time.Duration, error) {
+	durationStr := string(getParamBytes(r, name))
+	if durationStr == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("Invalid %s: %s", name, durationStr)
+	}
+	return duration, nil
+}
+
+// getTimestampParam returns the value of the `timestamp` request parameter,
+// that can be given either in RFC 3339 format or as a number of milliseconds
+// since the Unix epoch. If it is not specified, then zero time is returned.
+func getTimestampParam(r *http.Request) (time.Time, error) {
+	timestampStr := string(getParamBytes(r, prmTimestamp))
+	if timestampStr == "" {
+		return time.Time{}, nil
+	}
+	if timestampMs, err := strconv.ParseInt(timestampStr, 10, 64); err == nil && timestampMs > 0 {
+		return time.Unix(0, timestampMs*int64(time.Millisecond)), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, timestampStr)
+	if err != nil {
+		return time.Time{}, errors.Errorf("Invalid %s: %s", prmTimestamp, timestampStr)
+	}
+	return timestamp, nil
+}
+
+// getClientParam returns the value of the `client` request parameter. If it is
+// not specified, then the host of the remote address is used, so that every
+// client host is treated as a separate client. Clients connected via a unix
+// domain socket are identified by credentials of their processes.
+func getClientParam(r *http.Request) string {
+	if client := getParamBytes(r, prmClient); client != nil {
+		return string(client)
+	}
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	if cred, ok := auth.PeerCredFromContext(r.Context()); ok {
+		return cred.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// getTenant returns the principal that the request has been authenticated as,
+// to account produced and consumed messages to. That is the ID of the key the
+// request has been signed with, or for requests received over a unix domain
+// socket the user ID of the peer process. An empty string is returned if the
+// principal is not known, then the proxy alias is used as the tenant.
+func getTenant(r *http.Request) string {
+	if keyID, ok := r.Context().Value(signingKeyIDKey{}).(string); ok {
+		return "hmac:" + keyID
+	}
+	if cred, ok := auth.PeerCredFromContext(r.Context()); ok {
+		return fmt.Sprintf("uid:%d", cred.UID)
+	}
+	return ""
+}
+
+// getBatchParam returns the value of the `batch` request parameter, and
+// whether it is specified at all. The value should be a positive integer.
+func getBatchParam(r *http.Request) (int, bool, error) {
+	batchStr := getParamBytes(r, prmBatch)
+	if batchStr == nil {
+		return 0, false, nil
+	}
+	batchSize, err := strconv.Atoi(string(batchStr))
+	if err != nil || batchSize <= 0 {
+		return 0, false, errors.Errorf("Invalid batch: %s", batchStr)
+	}
+	return batchSize, true, nil
+}
+
+// respondWithProxyError sends an HTTP response with a status code that
+// corresponds to an error returned by `getProxy`.
+func respondWithProxyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if _, ok := err.(proxy.ErrNotReady); ok || errs.Is(err, errs.ErrMaintenance) || errs.Is(err, errs.ErrDraining) {
+		status = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+}
+
+// errMessageTooLarge is returned by `readMessageBody` if a request body is
+// larger than allowed. The size is -1 if it is not known, for the body turned
+// out to be larger than declared.
+type errMessageTooLarge struct {
+	size    int
+	maxSize int
+}
+
+func (e errMessageTooLarge) Error() string {
+	if e.size < 0 {
+		return fmt.Sprintf("Message too large: max=%d", e.maxSize)
+	}
+	return fmt.Sprintf("Message too large: size=%d, max=%d", e.size, e.maxSize)
+}
+
+// respondWithBodyError sends an HTTP response with a status code that
+// corresponds to an error returned by `readMessageBody`.
+func respondWithBodyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if _, ok := err.(errMessageTooLarge); ok {
+		status = http.StatusRequestEntityTooLarge
+	}
+	respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+}
+
+// respondWithConsumeError sends an HTTP response with a status code that
+// corresponds to the consume error.
+func respondWithConsumeError(w http.ResponseWriter, err error) {
+	var status int
+	switch {
+	case errs.Is(err, errs.ErrRequestTimeout):
+		status = http.StatusRequestTimeout
+	case errs.Is(err, errs.ErrTooManyRequests):
+		status = http.StatusTooManyRequests
+	case errs.Is(err, errs.ErrInvalidParam):
+		status = http.StatusBadRequest
+	case errs.Is(err, errs.ErrDisabled):
+		status = http.StatusForbidden
+	default:
+		status = http.StatusInternalServerError
+	}
+	respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+}
+
+// respondWithProduceError sends an HTTP response with a status code that
+// corresponds to the produce error.
+func respondWithProduceError(w http.ResponseWriter, err error) {
+	respondWithJSON(w, produceErrorStatus(err), errorHTTPResponse{err.Error()})
+}
+
+// produceErrorStatus returns an HTTP status code that corresponds to a produce
+// error.
+func produceErrorStatus(err error) int {
+	var rejected proxy.ErrRejected
+	switch {
+	case errs.As(err, &rejected), errs.Is(err, errs.ErrInvalidParam), err == sarama.ErrInvalidPartition:
+		return http.StatusBadRequest
+	case errs.Is(err, errs.ErrDisabled):
+		return http.StatusForbidden
+	case err == sarama.ErrUnknownTopicOrPartition:
+		return http.StatusNotFound
+	case errs.Is(err, errs.ErrRequestTimeout):
+		return http.StatusRequestTimeout
+	}
+	return http.StatusInternalServerError
+}
+
 // respondWithJSON marshals `body` to a JSON string and sends it s an HTTP
 // response body along with the specified `status` code.
 func respondWithJSON(w http.ResponseWriter, status int, body interface{}) {
 	encodedRes, err := json.MarshalIndent(body, "", "  ")
 	if err != nil {
-		log.Errorf("Failed to send HTTP response: status=%d, body=%v, err=%+v", status, body, err)
+		log.Errorf("Failed to send HTTP response: status=%d, err=%+v", status, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -449,7 +2356,7 @@ func respondWithJSON(w http.ResponseWriter, status int, body interface{}) {
 	w.Header().Add(hdrContentType, "application/json")
 	w.WriteHeader(status)
 	if _, err := w.Write(encodedRes); err != nil {
-		log.Errorf("Failed to send HTTP response: status=%d, body=%v, err=%+v", status, body, err)
+		log.Errorf("Failed to send HTTP response: status=%d, err=%+v", status, err)
 	}
 }
 
@@ -465,6 +2372,25 @@ func getGroupParam(r *http.Request, opt bool) (string, error) {
 	return groups[0], nil
 }
 
+// getGroupsParam returns all consumer groups specified in the request in the
+// order they are given. At least one group is required, and a group cannot be
+// specified more than once.
+func getGroupsParam(r *http.Request) ([]string, error) {
+	r.ParseForm()
+	groups := r.Form[prmGroup]
+	if len(groups) == 0 {
+		return nil, errors.Errorf("one consumer group is expected, but 0 provided")
+	}
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		if seen[group] {
+			return nil, errors.Errorf("consumer group %s provided more than once", group)
+		}
+		seen[group] = true
+	}
+	return groups, nil
+}
+
 // toEncoderPreservingNil converts a slice of bytes to `sarama.Encoder` but
 // returns `nil` if the passed slice is `nil`.
 func toEncoderPreservingNil(b []byte) sarama.Encoder {
@@ -0,0 +1,345 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/logging"
+	"github.com/mailgun/kafka-pixy/proxy"
+	"github.com/mailgun/kafka-pixy/shutdown"
+	"github.com/mailgun/kafka-pixy/testhelpers"
+	"github.com/mailgun/kafka-pixy/version"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&HTTPSrvSuite{})
+
+type HTTPSrvSuite struct{}
+
+// The effective configuration is returned with parameter names of the YAML
+// configuration file and with secrets redacted.
+func (s *HTTPSrvSuite) TestGetConfig(c *C) {
+	cfg := config.DefaultApp("foo")
+	cfg.HMAC.Keys = map[string]string{"k1": "secret1"}
+	cfg.Proxies["foo"].Kafka.SeedPeers = []string{"kafka-1:9092"}
+	hs := &T{cfg: cfg}
+	w := httptest.NewRecorder()
+
+	// When
+	hs.handleGetConfig(w, httptest.NewRequest("GET", "/admin/config", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body["default_proxy"], Equals, "foo")
+	c.Assert(body["hmac"], DeepEquals, map[string]interface{}{
+		"keys":           map[string]interface{}{"k1": config.Redacted},
+		"max_clock_skew": "5m0s",
+	})
+	proxyView := body["proxies"].(map[string]interface{})["foo"].(map[string]interface{})
+	c.Assert(proxyView["kafka"], DeepEquals, map[string]interface{}{
+		"seed_peers": []interface{}{"kafka-1:9092"},
+		"client_id":  "",
+	})
+	c.Assert(cfg.HMAC.Keys["k1"], Equals, "secret1")
+}
+
+// Build information is reported along with the Kafka protocol of every proxy.
+func (s *HTTPSrvSuite) TestGetVersion(c *C) {
+	cfg := config.DefaultApp("foo")
+	cfg.Proxies["bar"] = config.DefaultProxy()
+	hs := &T{cfg: cfg}
+	w := httptest.NewRecorder()
+
+	// When
+	hs.handleGetVersion(w, httptest.NewRequest("GET", "/_version", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var body versionHTTPResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body.Version, Equals, version.Version)
+	c.Assert(body.GoVersion, Equals, runtime.Version())
+	c.Assert(body.SaramaVersion, Equals, version.SaramaVersion)
+	c.Assert(body.Proxies, DeepEquals, map[string]version.KafkaProtocol{
+		"foo": version.Protocol(),
+		"bar": version.Protocol(),
+	})
+}
+
+// In maintenance mode requests that produce messages or modify offsets are
+// rejected with 503 Service Unavailable.
+func (s *HTTPSrvSuite) TestMaintenance(c *C) {
+	hs := &T{
+		actorID:  actor.RootID.NewChild("T"),
+		proxySet: proxy.NewSet(map[string]*proxy.T{"foo": {}}, "foo"),
+	}
+
+	// When
+	w := httptest.NewRecorder()
+	hs.handleStartMaintenance(w, httptest.NewRequest("POST", "/admin/maintenance", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	for i, handler := range []http.HandlerFunc{hs.handleProduce, hs.handleProduceBatch, hs.handleSetOffsets, hs.handleStartShadow} {
+		w = httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/topics/bar/messages", nil))
+		c.Assert(w.Code, Equals, http.StatusServiceUnavailable, Commentf("case #%d", i))
+		var body errorHTTPResponse
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+		c.Assert(body.Error, Equals, "service is in maintenance mode, only reads are allowed", Commentf("case #%d", i))
+	}
+
+	// When
+	w = httptest.NewRecorder()
+	hs.handleStopMaintenance(w, httptest.NewRequest("DELETE", "/admin/maintenance", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	w = httptest.NewRecorder()
+	hs.handleGetMaintenance(w, httptest.NewRequest("GET", "/admin/maintenance", nil))
+	var body maintenanceHTTPResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body, Equals, maintenanceHTTPResponse{Enabled: false})
+}
+
+// Produce requests with bodies larger than allowed are rejected with 413
+// Request Entity Too Large before anything is produced.
+func (s *HTTPSrvSuite) TestProduceTooLarge(c *C) {
+	cfg := config.DefaultApp("foo")
+	cfg.Proxies["foo"].Producer.MaxMessageSize = 4
+	cfg.Proxies["foo"].Producer.MaxBatchBytes = 8
+	hs := &T{
+		cfg:      cfg,
+		proxySet: proxy.NewSet(map[string]*proxy.T{"foo": {}}, "foo"),
+	}
+	for i, tc := range []struct {
+		handler http.HandlerFunc
+		url     string
+		body    string
+		error   string
+	}{
+		/* 0 */ {hs.handleProduce, "/topics/bar/messages", "12345",
+			"Message too large: size=5, max=4"},
+		/* 1 */ {hs.handleProduceBatch, "/topics/bar/messages/batch", `[{"value": "MTIz"}]`,
+			"Message too large: size=19, max=8"},
+	} {
+		r := httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		r.Header.Set(hdrContentLength, strconv.Itoa(len(tc.body)))
+		w := httptest.NewRecorder()
+
+		// When
+		tc.handler(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusRequestEntityTooLarge, Commentf("case #%d", i))
+		var body errorHTTPResponse
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+		c.Assert(body.Error, Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
+// A body is never read past the limit, even if it is larger than declared.
+func (s *HTTPSrvSuite) TestReadMessageBodyLargerThanDeclared(c *C) {
+	r := httptest.NewRequest("POST", "/topics/bar/messages", strings.NewReader("12345"))
+	r.Header.Set(hdrContentLength, "3")
+	w := httptest.NewRecorder()
+
+	// When
+	_, err := readMessageBody(w, r, 4)
+
+	// Then
+	c.Assert(err, Equals, errMessageTooLarge{size: -1, maxSize: 4})
+	c.Assert(err.Error(), Equals, "Message too large: max=4")
+}
+
+// A parameter is detected even if it is the first one read from a request,
+// that is before the request form has been parsed.
+func (s *HTTPSrvSuite) TestHasParam(c *C) {
+	for i, tc := range []struct {
+		url  string
+		want bool
+	}{
+		/* 0 */ {"/topics/foo/messages/batch?sync", true},
+		/* 1 */ {"/topics/foo/messages/batch?sync=false", true},
+		/* 2 */ {"/topics/foo/messages/batch?timeout=1s&sync", true},
+		/* 3 */ {"/topics/foo/messages/batch?timeout=1s", false},
+	} {
+		r := httptest.NewRequest("POST", tc.url, nil)
+
+		// When
+		isSync := hasParam(r, prmSync)
+
+		// Then
+		c.Assert(isSync, Equals, tc.want, Commentf("case #%d", i))
+	}
+}
+
+// Message keys passed in query parameters are not logged.
+func (s *HTTPSrvSuite) TestLoggedURI(c *C) {
+	for i, tc := range []struct {
+		uri  string
+		want string
+	}{
+		/* 0 */ {"/topics/foo/messages?sync", "/topics/foo/messages?sync"},
+		/* 1 */ {"/topics/foo/messages?key=bar&sync", "/topics/foo/messages?key=REDACTED&sync="},
+		/* 2 */ {"/topics/foo/messages?group=g&key_filter=bar", "/topics/foo/messages?group=g&key_filter=REDACTED"},
+		/* 3 */ {"/topics/foo/messages?group=g&key_filter_prefix=ba", "/topics/foo/messages?group=g&key_filter_prefix=REDACTED"},
+	} {
+		r := httptest.NewRequest("POST", tc.uri, nil)
+
+		// When
+		uri := loggedURI(r.URL)
+
+		// Then
+		c.Assert(uri, Equals, tc.want, Commentf("case #%d", i))
+	}
+}
+
+// Keys of messages of a redacted topic never appear in the request log,
+// whether requests succeed or fail.
+func (s *HTTPSrvSuite) TestRequestLogRedacted(c *C) {
+	logging.Requests.SetRate(1)
+	defer logging.Requests.SetRate(0)
+	h := logRequests("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	stopCapture := testhelpers.CaptureLogs()
+
+	// When
+	for _, uri := range []string{
+		"/topics/pci/messages?key=s3cr3t",
+		"/topics/pci/messages?key=s3cr3t&fail=1",
+		"/topics/pci/messages?group=g&key_filter=s3cr3t",
+		"/topics/pci/messages?group=g&key_filter=s3cr3t&fail=1",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", uri, nil))
+	}
+
+	// Then
+	logs := stopCapture()
+	c.Assert(strings.Count(logs, "/topics/pci/messages"), Equals, 4, Commentf("%s", logs))
+	c.Assert(strings.Contains(logs, "s3cr3t"), Equals, false, Commentf("%s", logs))
+}
+
+// A drain request is handed over to the shutdown tracker, and once the proxy
+// set is draining consume requests are rejected with 503 Service Unavailable.
+func (s *HTTPSrvSuite) TestDrain(c *C) {
+	hs := &T{
+		actorID:    actor.RootID.NewChild("T"),
+		proxySet:   proxy.NewSet(map[string]*proxy.T{"foo": {}}, "foo"),
+		shutdownTr: shutdown.New(),
+	}
+	w := httptest.NewRecorder()
+
+	// When
+	hs.handleDrain(w, httptest.NewRequest("POST", "/_drain", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+	select {
+	case <-hs.shutdownTr.DrainRequested():
+	default:
+		c.Error("Drain not requested")
+	}
+
+	// When
+	hs.proxySet.Drain()
+	w = httptest.NewRecorder()
+	hs.handleConsume(w, httptest.NewRequest("GET", "/topics/bar/messages?group=g", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	var body errorHTTPResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body.Error, Equals, "service is draining, consume requests are not accepted")
+}
+
+// Liveness does not depend on proxies, and readiness checks are not run for
+// proxies that are not ready.
+func (s *HTTPSrvSuite) TestHealthzReadyz(c *C) {
+	set := proxy.NewSet(map[string]*proxy.T{}, "foo")
+	set.SetNotReady("foo", errors.New("kaboom"), true)
+	hs := &T{proxySet: set}
+	w := httptest.NewRecorder()
+
+	// When
+	hs.handleGetHealthz(w, httptest.NewRequest("GET", "/_healthz", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, "{\n  \"alive\": true\n}")
+
+	// When
+	w = httptest.NewRecorder()
+	hs.handleGetReadyz(w, httptest.NewRequest("GET", "/_readyz", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body, DeepEquals, map[string]interface{}{
+		"ready":    false,
+		"degraded": false,
+		"proxies": []interface{}{map[string]interface{}{
+			"alias":    "foo",
+			"default":  true,
+			"ready":    false,
+			"retrying": true,
+			"error":    "kaboom",
+		}},
+	})
+}
+
+// Only selected fields of partition offsets are returned, along with the
+// partition, and empty string fields are omitted.
+func (s *HTTPSrvSuite) TestSelectPartitionOffsetFields(c *C) {
+	offsetViews := []partitionOffsetView{
+		{Partition: 0, Begin: 10, End: 20, Count: 10, Offset: 15, Lag: 5, SparseAcks: "1-2"},
+		{Partition: 1, Begin: 10, End: 20, Count: 10, Offset: 20, Lag: 0},
+	}
+
+	// When
+	selected := selectPartitionOffsetFields(offsetViews, []string{"lag", "offset", "sparse_acks"})
+
+	// Then
+	c.Assert(selected, DeepEquals, []map[string]interface{}{
+		{"partition": int32(0), "lag": int64(5), "offset": int64(15), "sparse_acks": "1-2"},
+		{"partition": int32(1), "lag": int64(0), "offset": int64(20)},
+	})
+}
+
+func (s *HTTPSrvSuite) TestGetFieldsParam(c *C) {
+	for i, tc := range []struct {
+		url    string
+		fields []string
+		error  string
+	}{
+		/* 0 */ {"/topics/foo/offsets?group=bar", nil, ""},
+		/* 1 */ {"/topics/foo/offsets?fields=lag,offset", []string{"lag", "offset"}, ""},
+		/* 2 */ {"/topics/foo/offsets?fields=lag,%20offset,", []string{"lag", "offset"}, ""},
+		/* 3 */ {"/topics/foo/offsets?fields=", []string{}, ""},
+		/* 4 */ {"/topics/foo/offsets?fields=lag,bazz", nil, "Invalid fields: unknown field bazz"},
+	} {
+		// When
+		fields, err := getFieldsParam(httptest.NewRequest("GET", tc.url, nil), partitionOffsetFields)
+
+		// Then
+		if tc.error != "" {
+			c.Assert(err, ErrorMatches, tc.error, Commentf("case #%d", i))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(fields, DeepEquals, tc.fields, Commentf("case #%d", i))
+	}
+}
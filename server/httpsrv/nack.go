@@ -0,0 +1,69 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/proxy"
+)
+
+// handleNack is an HTTP request handler for
+// `POST /topics/{topic}/messages/nack`. It makes a consumed message due for
+// redelivery after the optional delay, rather than after the ack timeout.
+func (s *T) handleNack(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	partitionStr := string(getParamBytes(r, prmPartition))
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+		return
+	}
+	offsetStr := string(getParamBytes(r, prmOffset))
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid offset: %s", offsetStr)})
+		return
+	}
+	ack, err := proxy.Ack(int32(partition), offset)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	delay, err := getDurationParam(r, prmDelay)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+
+	if err := pxy.Nack(group, topic, ack, delay); err != nil {
+		var status int
+		switch {
+		case err == proxy.ErrNotConsumed:
+			status = http.StatusNotFound
+		case errs.Is(err, errs.ErrInvalidParam):
+			status = http.StatusBadRequest
+		case errs.Is(err, errs.ErrRequestTimeout):
+			status = http.StatusRequestTimeout
+		default:
+			status = http.StatusInternalServerError
+		}
+		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, EmptyResponse)
+}
@@ -0,0 +1,171 @@
+package httpsrv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HTTP header that carries a cursor to request the next page with. It is
+	// missing if the returned page is the last one.
+	hdrNextCursor = "X-Kafka-Pixy-Next-Cursor"
+)
+
+// pageCursor identifies the last item of a page. Items are ordered by key,
+// that is a group or a topic depending on the endpoint, and then by partition.
+type pageCursor struct {
+	Key       string `json:"k,omitempty"`
+	Partition int32  `json:"p"`
+}
+
+// encode returns an opaque representation of the cursor to be passed to
+// clients.
+func (pc pageCursor) encode() string {
+	encoded, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	var pc pageCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pc, err
+	}
+	err = json.Unmarshal(decoded, &pc)
+	return pc, err
+}
+
+// pager selects items of a page from a sequence of items, that is offered to
+// it item by item in the order defined by `pageCursor`. Items are filtered by
+// partition, if the `partition` request parameter is given, and the page size
+// is limited by the `limit` request parameter. The page starts after the item
+// identified by the `cursor` request parameter.
+type pager struct {
+	partitions map[int32]bool
+	limit      int
+	after      *pageCursor
+	count      int
+	last       pageCursor
+	next       *pageCursor
+}
+
+// getPager returns a pager configured with the `partition`, `limit`, and
+// `cursor` request parameters. If none of them is given, the pager admits all
+// items to the page.
+func getPager(r *http.Request) (*pager, error) {
+	r.ParseForm()
+	p := pager{}
+	for _, value := range r.Form[prmPartition] {
+		for _, partitionStr := range strings.Split(value, ",") {
+			partitionStr = strings.TrimSpace(partitionStr)
+			if partitionStr == "" {
+				continue
+			}
+			partition, err := strconv.ParseInt(partitionStr, 10, 32)
+			if err != nil || partition < 0 {
+				return nil, errors.Errorf("Invalid %s: %s", prmPartition, partitionStr)
+			}
+			if p.partitions == nil {
+				p.partitions = make(map[int32]bool)
+			}
+			p.partitions[int32(partition)] = true
+		}
+	}
+	if limitStr := r.Form.Get(prmLimit); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return nil, errors.Errorf("Invalid %s: %s", prmLimit, limitStr)
+		}
+		p.limit = limit
+	}
+	if cursorStr := r.Form.Get(prmCursor); cursorStr != "" {
+		after, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return nil, errors.Errorf("Invalid %s: %s", prmCursor, cursorStr)
+		}
+		p.after = &after
+	}
+	return &p, nil
+}
+
+// admit tells whether the item belongs to the page.
+func (p *pager) admit(key string, partition int32) bool {
+	if p.partitions != nil && !p.partitions[partition] {
+		return false
+	}
+	if p.after != nil && (key < p.after.Key || key == p.after.Key && partition <= p.after.Partition) {
+		return false
+	}
+	if p.limit > 0 && p.count >= p.limit {
+		// There are more items than fit in the page, so the page is to be
+		// continued after its last item.
+		if p.next == nil {
+			next := p.last
+			p.next = &next
+		}
+		return false
+	}
+	p.count++
+	p.last = pageCursor{Key: key, Partition: partition}
+	return true
+}
+
+// setNextCursor adds a cursor to request the next page with to the response
+// headers, if the page is not the last one.
+func (p *pager) setNextCursor(w http.ResponseWriter) {
+	if p.next != nil {
+		w.Header().Set(hdrNextCursor, p.next.encode())
+	}
+}
+
+// pagePartitionOffsetViews returns views of the page sorted by partition.
+func pagePartitionOffsetViews(p *pager, key string, offsetViews []partitionOffsetView) []partitionOffsetView {
+	sort.Slice(offsetViews, func(i, j int) bool { return offsetViews[i].Partition < offsetViews[j].Partition })
+	paged := make([]partitionOffsetView, 0, len(offsetViews))
+	for _, ov := range offsetViews {
+		if p.admit(key, ov.Partition) {
+			paged = append(paged, ov)
+		}
+	}
+	return paged
+}
+
+// pageTopicConsumers returns consumed partitions by member by group that are
+// in the page. Groups that have no partitions in the page are omitted.
+func pageTopicConsumers(p *pager, consumers map[string]map[string][]int32) map[string]map[string][]int32 {
+	groups := make([]string, 0, len(consumers))
+	for group := range consumers {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	type claim struct {
+		partition int32
+		member    string
+	}
+	paged := make(map[string]map[string][]int32)
+	for _, group := range groups {
+		var claims []claim
+		for member, partitions := range consumers[group] {
+			for _, partition := range partitions {
+				claims = append(claims, claim{partition, member})
+			}
+		}
+		sort.Slice(claims, func(i, j int) bool { return claims[i].partition < claims[j].partition })
+		for _, c := range claims {
+			if !p.admit(group, c.partition) {
+				continue
+			}
+			if paged[group] == nil {
+				paged[group] = make(map[string][]int32)
+			}
+			paged[group][c.member] = append(paged[group][c.member], c.partition)
+		}
+	}
+	return paged
+}
@@ -0,0 +1,99 @@
+package httpsrv
+
+import (
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PagingSuite{})
+
+type PagingSuite struct{}
+
+func (s *PagingSuite) TestGetPager(c *C) {
+	for i, tc := range []struct {
+		url        string
+		partitions map[int32]bool
+		limit      int
+		error      string
+	}{
+		/* 0 */ {"/topics/foo/offsets", nil, 0, ""},
+		/* 1 */ {"/topics/foo/offsets?partition=1&partition=3,%205", map[int32]bool{1: true, 3: true, 5: true}, 0, ""},
+		/* 2 */ {"/topics/foo/offsets?limit=10", nil, 10, ""},
+		/* 3 */ {"/topics/foo/offsets?partition=a", nil, 0, "Invalid partition: a"},
+		/* 4 */ {"/topics/foo/offsets?partition=-1", nil, 0, "Invalid partition: -1"},
+		/* 5 */ {"/topics/foo/offsets?limit=0", nil, 0, "Invalid limit: 0"},
+		/* 6 */ {"/topics/foo/offsets?cursor=@@@", nil, 0, "Invalid cursor: @@@"},
+	} {
+		// When
+		p, err := getPager(httptest.NewRequest("GET", tc.url, nil))
+
+		// Then
+		if tc.error != "" {
+			c.Assert(err, ErrorMatches, tc.error, Commentf("case #%d", i))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(p.partitions, DeepEquals, tc.partitions, Commentf("case #%d", i))
+		c.Assert(p.limit, Equals, tc.limit, Commentf("case #%d", i))
+	}
+}
+
+// Following next cursors pages through all items exactly once.
+func (s *PagingSuite) TestPagePartitionOffsetViews(c *C) {
+	offsetViews := []partitionOffsetView{{Partition: 3}, {Partition: 0}, {Partition: 2}, {Partition: 1}, {Partition: 4}}
+	var pages [][]int32
+	url := "/topics/foo/offsets?limit=2&partition=0,1,3,4"
+	for url != "" {
+		p, err := getPager(httptest.NewRequest("GET", url, nil))
+		c.Assert(err, IsNil)
+		w := httptest.NewRecorder()
+
+		// When
+		paged := pagePartitionOffsetViews(p, "", offsetViews)
+		p.setNextCursor(w)
+
+		// Then
+		var page []int32
+		for _, ov := range paged {
+			page = append(page, ov.Partition)
+		}
+		pages = append(pages, page)
+		url = ""
+		if cursor := w.Header().Get(hdrNextCursor); cursor != "" {
+			url = "/topics/foo/offsets?limit=2&partition=0,1,3,4&cursor=" + cursor
+		}
+	}
+	c.Assert(pages, DeepEquals, [][]int32{{0, 1}, {3, 4}})
+}
+
+// Consumers are paged through by group and then by partition.
+func (s *PagingSuite) TestPageTopicConsumers(c *C) {
+	consumers := map[string]map[string][]int32{
+		"g2": {"m1": {0, 2}, "m2": {1}},
+		"g1": {"m3": {0, 1}},
+	}
+	p, err := getPager(httptest.NewRequest("GET", "/topics/foo/consumers?limit=3", nil))
+	c.Assert(err, IsNil)
+
+	// When
+	paged := pageTopicConsumers(p, consumers)
+
+	// Then
+	c.Assert(paged, DeepEquals, map[string]map[string][]int32{
+		"g1": {"m3": {0, 1}},
+		"g2": {"m1": {0}},
+	})
+	c.Assert(p.next, DeepEquals, &pageCursor{Key: "g2", Partition: 0})
+
+	// When
+	p, err = getPager(httptest.NewRequest("GET", "/topics/foo/consumers?limit=3&cursor="+p.next.encode(), nil))
+	c.Assert(err, IsNil)
+	paged = pageTopicConsumers(p, consumers)
+
+	// Then
+	c.Assert(paged, DeepEquals, map[string]map[string][]int32{
+		"g2": {"m1": {2}, "m2": {1}},
+	})
+	c.Assert(p.next, IsNil)
+}
@@ -0,0 +1,87 @@
+package httpsrv
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/auth"
+	"github.com/mailgun/log"
+)
+
+// peerCredListener wraps a unix domain socket listener to obtain credentials
+// of connecting processes, so that requests can be attributed to them.
+type peerCredListener struct {
+	net.Listener
+	actorID *actor.ID
+}
+
+// Accept implements `net.Listener`.
+func (l peerCredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	cred, err := getPeerCred(unixConn)
+	if err != nil {
+		log.Warningf("<%s> failed to get peer credentials: %s", l.actorID, err)
+		return conn, nil
+	}
+	addr := peerCredAddr{cred: cred}
+	if remoteAddr := conn.RemoteAddr(); remoteAddr != nil {
+		addr.addr = remoteAddr.String()
+	}
+	return &peerCredConn{Conn: conn, addr: &addr}, nil
+}
+
+// peerCredConn is a connection that reports peer credentials via its remote
+// address, for that is what HTTP server wrappers pass through.
+type peerCredConn struct {
+	net.Conn
+	addr *peerCredAddr
+}
+
+// RemoteAddr implements `net.Conn`.
+func (c *peerCredConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+type peerCredAddr struct {
+	addr string
+	cred auth.PeerCred
+}
+
+// Network implements `net.Addr`.
+func (a *peerCredAddr) Network() string {
+	return networkUnix
+}
+
+// String implements `net.Addr`.
+func (a *peerCredAddr) String() string {
+	return a.addr
+}
+
+// withPeerCred is an `http.Server.ConnContext` function that adds credentials
+// of the peer process to contexts of requests received over the connection,
+// where they can be retrieved with `auth.PeerCredFromContext`.
+func withPeerCred(ctx context.Context, conn net.Conn) context.Context {
+	if addr, ok := conn.RemoteAddr().(*peerCredAddr); ok {
+		return auth.NewPeerCredContext(ctx, addr.cred)
+	}
+	return ctx
+}
+
+// remoteAddr returns a description of the request origin for logs. For
+// requests received over unix domain sockets that is credentials of the peer
+// process, if they are known.
+func remoteAddr(r *http.Request) string {
+	if cred, ok := auth.PeerCredFromContext(r.Context()); ok {
+		return cred.String()
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,30 @@
+package httpsrv
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/mailgun/kafka-pixy/auth"
+	"github.com/pkg/errors"
+)
+
+// getPeerCred returns credentials of the process on the other end of the
+// connection, as captured by the kernel when the connection was made.
+func getPeerCred(conn *net.UnixConn) (auth.PeerCred, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return auth.PeerCred{}, errors.Wrap(err, "failed to get raw connection")
+	}
+	var ucred *syscall.Ucred
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return auth.PeerCred{}, errors.Wrap(err, "failed to access socket")
+	}
+	if sockErr != nil {
+		return auth.PeerCred{}, errors.Wrap(sockErr, "failed to get SO_PEERCRED")
+	}
+	return auth.PeerCred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,52 @@
+package httpsrv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/shutdown"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PeerCredSuite{})
+
+type PeerCredSuite struct {
+	dir string
+}
+
+func (s *PeerCredSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// Requests received over a unix domain socket carry credentials of the client
+// process, and the client is identified by them.
+func (s *PeerCredSuite) TestUnixSocket(c *C) {
+	addr := filepath.Join(s.dir, "kafka-pixy.sock")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, getClientParam(r))
+	})
+	hs, err := newServer(addr, &config.App{}, handler, shutdown.New())
+	c.Assert(err, IsNil)
+	hs.Start()
+	defer hs.Stop()
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial(networkUnix, addr)
+		},
+	}}
+
+	// When
+	r, err := client.Get("http://_/")
+
+	// Then
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(r.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, fmt.Sprintf("pid=%d,uid=%d,gid=%d", os.Getpid(), os.Getuid(), os.Getgid()))
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package httpsrv
+
+import (
+	"net"
+
+	"github.com/mailgun/kafka-pixy/auth"
+	"github.com/pkg/errors"
+)
+
+// getPeerCred returns an error, for peer credentials are only supported on
+// Linux.
+func getPeerCred(conn *net.UnixConn) (auth.PeerCred, error) {
+	return auth.PeerCred{}, errors.New("peer credentials are not supported on this platform")
+}
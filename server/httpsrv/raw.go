@@ -0,0 +1,98 @@
+package httpsrv
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Headers that carry everything of a message but the value in the raw
+	// format.
+	hdrGroup     = "X-Kafka-Pixy-Group"
+	hdrTopic     = "X-Kafka-Pixy-Topic"
+	hdrPartition = "X-Kafka-Pixy-Partition"
+	hdrOffset    = "X-Kafka-Pixy-Offset"
+	hdrKey       = "X-Kafka-Pixy-Key"
+	hdrTombstone = "X-Kafka-Pixy-Tombstone"
+	hdrRetries   = "X-Kafka-Pixy-Retries"
+
+	contentTypeRaw = "application/octet-stream"
+
+	// Values of the `format` request parameter.
+	formatJSON = "json"
+	formatRaw  = "raw"
+)
+
+// getFormatParam returns the message format requested with the `format`
+// parameter, or an empty string if it is not specified.
+func getFormatParam(r *http.Request) (string, error) {
+	format := r.FormValue(prmFormat)
+	switch format {
+	case "", formatJSON, formatRaw:
+		return format, nil
+	}
+	return "", errors.Errorf("Invalid format: %s", format)
+}
+
+// getRawMessageHeaders returns the key, the partition, and whether the
+// message is a tombstone, as specified in headers of a request that produces
+// a message in the raw format. The key is expected to be base64 encoded, and
+// the key is nil if the header is missing. The partition is nil if the header
+// is missing.
+func getRawMessageHeaders(r *http.Request) ([]byte, []byte, bool, error) {
+	var key, partition []byte
+	if _, ok := r.Header[hdrKey]; ok {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(r.Header.Get(hdrKey)); err != nil {
+			return nil, nil, false, errors.Errorf("Invalid %s header: %s", hdrKey, err)
+		}
+	}
+	if _, ok := r.Header[hdrPartition]; ok {
+		partition = []byte(r.Header.Get(hdrPartition))
+	}
+	isTombstone := false
+	if tombstoneStr := r.Header.Get(hdrTombstone); tombstoneStr != "" {
+		var err error
+		if isTombstone, err = strconv.ParseBool(tombstoneStr); err != nil {
+			return nil, nil, false, errors.Errorf("Invalid %s header: %s", hdrTombstone, tombstoneStr)
+		}
+	}
+	return key, partition, isTombstone, nil
+}
+
+// rawFormat sends a message value as the response body as is, and everything
+// else in headers. The key is base64 encoded, and the header is omitted if the
+// key is null. A null value, that is a tombstone, is marked with a header to
+// tell it from an empty one.
+type rawFormat struct{}
+
+func (rawFormat) writeMessage(w http.ResponseWriter, group string, groupChosen, topicChosen bool, msg consumer.Message) {
+	hdr := w.Header()
+	hdr.Set(hdrContentType, contentTypeRaw)
+	hdr.Set(hdrGroup, group)
+	hdr.Set(hdrTopic, msg.Topic)
+	hdr.Set(hdrPartition, strconv.Itoa(int(msg.Partition)))
+	hdr.Set(hdrOffset, strconv.FormatInt(msg.Offset, 10))
+	if msg.Key != nil {
+		hdr.Set(hdrKey, base64.StdEncoding.EncodeToString(msg.Key))
+	}
+	if msg.Value == nil {
+		hdr.Set(hdrTombstone, "true")
+	}
+	if msg.Retries > 0 {
+		hdr.Set(hdrRetries, strconv.Itoa(msg.Retries))
+	}
+	hdr.Set(hdrContentLength, strconv.Itoa(len(msg.Value)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(msg.Value)
+}
+
+// writeMessages is never called, for handlers reject requests for lists of
+// messages in the raw format before anything is consumed.
+func (rawFormat) writeMessages(w http.ResponseWriter, group string, msgs []consumer.Message) {
+	respondWithJSON(w, http.StatusNotAcceptable, errorHTTPResponse{"Raw format cannot carry a list of messages"})
+}
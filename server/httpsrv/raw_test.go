@@ -0,0 +1,144 @@
+package httpsrv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RawSuite{})
+
+type RawSuite struct{}
+
+// In the raw format the message value is the response body, and everything
+// else is sent in headers.
+func (s *RawSuite) TestRawFormat(c *C) {
+	w := httptest.NewRecorder()
+
+	// When
+	rawFormat{}.writeMessage(w, "bar", false, false, consumer.Message{
+		Key: []byte{0, 1, 2}, Value: []byte("Hello"), Topic: "foo", Partition: 3, Offset: 42})
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get(hdrContentType), Equals, contentTypeRaw)
+	c.Assert(w.Header().Get(hdrGroup), Equals, "bar")
+	c.Assert(w.Header().Get(hdrTopic), Equals, "foo")
+	c.Assert(w.Header().Get(hdrPartition), Equals, "3")
+	c.Assert(w.Header().Get(hdrOffset), Equals, "42")
+	c.Assert(w.Header().Get(hdrKey), Equals, base64.StdEncoding.EncodeToString([]byte{0, 1, 2}))
+	c.Assert(w.Header().Get(hdrTombstone), Equals, "")
+	c.Assert(w.Body.String(), Equals, "Hello")
+}
+
+// A null key is not reported, and a null value is marked as a tombstone.
+func (s *RawSuite) TestRawFormatNulls(c *C) {
+	w := httptest.NewRecorder()
+
+	// When
+	rawFormat{}.writeMessage(w, "bar", false, false, consumer.Message{Topic: "foo", Partition: 3, Offset: 42})
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	_, hasKey := w.Header()[hdrKey]
+	c.Assert(hasKey, Equals, false)
+	c.Assert(w.Header().Get(hdrTombstone), Equals, "true")
+	c.Assert(w.Body.Len(), Equals, 0)
+}
+
+// Message key, partition and tombstone flag are taken from headers of a raw
+// produce request.
+func (s *RawSuite) TestGetRawMessageHeaders(c *C) {
+	r := httptest.NewRequest("POST", "/topics/foo/messages?format=raw", nil)
+	r.Header.Set(hdrKey, base64.StdEncoding.EncodeToString([]byte{0, 1, 2}))
+	r.Header.Set(hdrPartition, "7")
+	r.Header.Set(hdrTombstone, "true")
+
+	// When
+	key, partition, isTombstone, err := getRawMessageHeaders(r)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(key, DeepEquals, []byte{0, 1, 2})
+	c.Assert(string(partition), Equals, "7")
+	c.Assert(isTombstone, Equals, true)
+}
+
+// If headers are missing, then the key and the partition are nil, that is
+// different from an empty key.
+func (s *RawSuite) TestGetRawMessageHeadersMissing(c *C) {
+	r := httptest.NewRequest("POST", "/topics/foo/messages?format=raw", nil)
+
+	// When
+	key, partition, isTombstone, err := getRawMessageHeaders(r)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(key, IsNil)
+	c.Assert(partition, IsNil)
+	c.Assert(isTombstone, Equals, false)
+
+	// When
+	r.Header.Set(hdrKey, "")
+	key, _, _, err = getRawMessageHeaders(r)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(key, DeepEquals, []byte{})
+}
+
+func (s *RawSuite) TestGetRawMessageHeadersInvalid(c *C) {
+	for i, tc := range []struct {
+		hdr   string
+		value string
+		error string
+	}{
+		/* 0 */ {hdrKey, "not base64!", "Invalid X-Kafka-Pixy-Key header: illegal base64 data at input byte 3"},
+		/* 1 */ {hdrTombstone, "maybe", "Invalid X-Kafka-Pixy-Tombstone header: maybe"},
+	} {
+		r := httptest.NewRequest("POST", "/topics/foo/messages?format=raw", nil)
+		r.Header.Set(tc.hdr, tc.value)
+
+		// When
+		_, _, _, err := getRawMessageHeaders(r)
+
+		// Then
+		c.Assert(err, NotNil, Commentf("case #%d", i))
+		c.Assert(err.Error(), Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
+// Invalid formats, and the raw format requested for more than one message,
+// are rejected before anything is consumed.
+func (s *RawSuite) TestInvalidFormat(c *C) {
+	hs := &T{}
+	for i, tc := range []struct {
+		method  string
+		url     string
+		handler http.HandlerFunc
+		error   string
+	}{
+		/* 0 */ {"GET", "/topics/foo/messages?group=bar&format=xml", hs.handleConsume, "Invalid format: xml"},
+		/* 1 */ {"GET", "/topics/foo/messages?group=bar&format=raw&batch=10", hs.handleConsume,
+			"Batch consume does not support raw format"},
+		/* 2 */ {"GET", "/v2/topics/foo/messages?group=bar&format=raw&batch=10", hs.handleConsumeV2,
+			"Batch consume does not support raw format"},
+	} {
+		r := httptest.NewRequest(tc.method, tc.url, strings.NewReader("Hello"))
+		w := httptest.NewRecorder()
+
+		// When
+		tc.handler(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		var body errorHTTPResponse
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+		c.Assert(body.Error, Equals, tc.error, Commentf("case #%d", i))
+	}
+}
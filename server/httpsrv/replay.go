@@ -0,0 +1,118 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/replay"
+	"github.com/mailgun/log"
+)
+
+const (
+	prmPath = "path"
+	prmRate = "rate"
+)
+
+var replayParams = []string{prmPath, prmTopic, prmRate}
+
+type replayHTTPResponse struct {
+	replay.Stats
+	Error string `json:"error,omitempty"`
+}
+
+// handleReplayFile is an HTTP request handler for `POST /admin/replay-file`.
+// It produces messages of a JSON lines file on the server to a topic, and
+// responds when all of them are either committed or failed. Only files in
+// `config.App.ReplayDir` can be replayed, so that API clients cannot make the
+// server read arbitrary files.
+func (s *T) handleReplayFile(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if s.cfg.ReplayDir == "" {
+		respondWithJSON(w, http.StatusForbidden, errorHTTPResponse{"Replaying files is disabled"})
+		return
+	}
+	pxy, err := s.getProxyForWrite(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := r.FormValue(prmTopic)
+	if topic == "" {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{"Topic is not specified"})
+		return
+	}
+	rate := 0
+	if rateStr := r.FormValue(prmRate); rateStr != "" {
+		if rate, err = strconv.Atoi(rateStr); err != nil || rate < 0 {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid rate: %s", rateStr)})
+			return
+		}
+	}
+	path, err := resolveReplayPath(s.cfg.ReplayDir, r.FormValue(prmPath))
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Failed to open file: %s", err)})
+		return
+	}
+	defer file.Close()
+
+	log.Infof("<%s> replaying file: path=%s, topic=%s, rate=%d", s.actorID, path, topic, rate)
+	stats, err := pxy.Replay(getTenant(r), file, topic, rate)
+	log.Infof("<%s> file replayed: path=%s, topic=%s, stats=%+v, err=%v", s.actorID, path, topic, stats, err)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errs.Is(err, errs.ErrDisabled) {
+			status = http.StatusForbidden
+		}
+		respondWithJSON(w, status, replayHTTPResponse{Stats: stats, Error: err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, replayHTTPResponse{Stats: stats})
+}
+
+// resolveReplayPath returns the real path of a file to be replayed, that is
+// either absolute or relative to the replay directory, making sure that the
+// file is in the replay directory. Paths outside of the directory are rejected
+// before they are resolved, and resolution errors are not disclosed, so that
+// API clients cannot probe what files exist on the server.
+func resolveReplayPath(dir, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("Path is not specified")
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("Invalid replay directory: %s", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !isInDir(dir, path) && !isInDir(realDir, path) {
+		return "", fmt.Errorf("Path must be in the replay directory")
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("File not found")
+	}
+	if !isInDir(realDir, realPath) {
+		return "", fmt.Errorf("Path must be in the replay directory")
+	}
+	return realPath, nil
+}
+
+// isInDir tells whether a path is strictly inside of a directory, judging by
+// the path names alone.
+func isInDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,60 @@
+package httpsrv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ReplaySuite{})
+
+type ReplaySuite struct {
+	dir string
+}
+
+func (s *ReplaySuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(s.dir, "replay"), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "replay", "in.jsonl"), nil, 0600), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "out.jsonl"), nil, 0600), IsNil)
+}
+
+// Paths are either absolute or relative to the replay directory.
+func (s *ReplaySuite) TestResolve(c *C) {
+	dir := filepath.Join(s.dir, "replay")
+	realPath, err := filepath.EvalSymlinks(filepath.Join(dir, "in.jsonl"))
+	c.Assert(err, IsNil)
+
+	path, err := resolveReplayPath(dir, "in.jsonl")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, realPath)
+
+	path, err = resolveReplayPath(dir, filepath.Join(dir, "in.jsonl"))
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, realPath)
+}
+
+// Files outside of the replay directory are rejected, even if they are
+// referenced via a symlink inside of it.
+func (s *ReplaySuite) TestResolveOutside(c *C) {
+	dir := filepath.Join(s.dir, "replay")
+	c.Assert(os.Symlink(filepath.Join(s.dir, "out.jsonl"), filepath.Join(dir, "link.jsonl")), IsNil)
+
+	for _, path := range []string{
+		"../out.jsonl",
+		"../missing.jsonl",
+		filepath.Join(s.dir, "missing.jsonl"),
+		filepath.Join(s.dir, "out.jsonl"),
+		"link.jsonl",
+		dir,
+	} {
+		_, err := resolveReplayPath(dir, path)
+		c.Assert(err, ErrorMatches, "Path must be in the replay directory", Commentf("path=%s", path))
+	}
+	_, err := resolveReplayPath(dir, "missing.jsonl")
+	c.Assert(err, ErrorMatches, "File not found")
+	_, err = resolveReplayPath(dir, "")
+	c.Assert(err, ErrorMatches, "Path is not specified")
+}
@@ -0,0 +1,83 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/proxy"
+)
+
+type retryHTTPResponse struct {
+	Topic        string `json:"topic"`
+	Retries      int    `json:"retries"`
+	DeadLettered bool   `json:"dead_lettered,omitempty"`
+}
+
+// handleRetry is an HTTP request handler for
+// `POST /topics/{topic}/messages/retry`. It schedules redelivery of a consumed
+// message after the delay of the next retry tier, and acknowledges it.
+func (s *T) handleRetry(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxyForWrite(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	topic := mux.Vars(r)[prmTopic]
+	group, err := getGroupParam(r, false)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	partitionStr := string(getParamBytes(r, prmPartition))
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid partition: %s", partitionStr)})
+		return
+	}
+	offsetStr := string(getParamBytes(r, prmOffset))
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{fmt.Sprintf("Invalid offset: %s", offsetStr)})
+		return
+	}
+	ack, err := proxy.Ack(int32(partition), offset)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	ackMeta := string(getParamBytes(r, prmAckMetadata))
+	if len(ackMeta) > maxAckMetadataLength {
+		errorText := fmt.Sprintf("Ack metadata too long: max=%d", maxAckMetadataLength)
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{errorText})
+		return
+	}
+
+	res, err := pxy.Retry(group, topic, ack.WithMeta(ackMeta))
+	if err != nil {
+		var status int
+		switch {
+		case err == proxy.ErrNotConsumed:
+			status = http.StatusNotFound
+		case errs.Is(err, errs.ErrInvalidParam):
+			status = http.StatusBadRequest
+		case errs.Is(err, errs.ErrDisabled):
+			status = http.StatusForbidden
+		case errs.Is(err, errs.ErrRequestTimeout):
+			status = http.StatusRequestTimeout
+		default:
+			status = http.StatusInternalServerError
+		}
+		respondWithJSON(w, status, errorHTTPResponse{err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, retryHTTPResponse{
+		Topic:        res.Topic,
+		Retries:      res.Retries,
+		DeadLettered: res.DeadLettered,
+	})
+}
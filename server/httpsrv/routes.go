@@ -0,0 +1,324 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/kafka-pixy/version"
+)
+
+// route describes an HTTP API endpoint. Request handlers are registered from
+// route tables, and the OpenAPI document served at `GET /openapi.json` is
+// generated from the same tables, so that it cannot get out of sync with the
+// code.
+type route struct {
+	method  string
+	path    string
+	handler func(*T, http.ResponseWriter, *http.Request)
+	// If true, then the endpoint is also served under `/proxies/{proxy}`
+	// for a particular proxy, rather than the default one.
+	proxied bool
+	summary string
+	// Query parameters accepted by the endpoint.
+	params []string
+}
+
+// apiRoutes are endpoints of the unversioned, that is version 1, API.
+var apiRoutes = []route{
+	{"POST", fmt.Sprintf("/topics/{%s}/messages", prmTopic), (*T).handleProduce, true,
+		"Produce a message", produceParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/batch", prmTopic), (*T).handleProduceBatch, true,
+		"Produce a batch of messages", produceBatchParams},
+	{"GET", fmt.Sprintf("/topics/{%s}/messages", prmTopic), (*T).handleConsume, true,
+		"Consume a message", consumeParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/ack", prmTopic), (*T).handleAck, true,
+		"Acknowledge a consumed message", ackParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/acks/upto", prmTopic), (*T).handleAckUpTo, true,
+		"Acknowledge all consumed messages up to an offset", ackParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/retry", prmTopic), (*T).handleRetry, true,
+		"Retry a consumed message after a delay", ackParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/nack", prmTopic), (*T).handleNack, true,
+		"Redeliver a consumed message without waiting for the ack timeout", []string{prmGroup, prmPartition, prmOffset, prmDelay}},
+	{"GET", fmt.Sprintf("/topics/{%s}/partitions/{%s}/messages", prmTopic, prmPartition), (*T).handleReadMessages, true,
+		"Read messages from a partition", readMessagesParams},
+	{"GET", fmt.Sprintf("/topics/{%s}/partitions/{%s}/export", prmTopic, prmPartition), (*T).handleExport, true,
+		"Export a range of messages from a partition", exportParams},
+	{"GET", fmt.Sprintf("/groups/{%s}/messages", prmGroup), (*T).handleConsumeTopics, true,
+		"Consume a message from any of several topics", consumeTopicsParams},
+	{"POST", fmt.Sprintf("/groups/{%s}/heartbeat", prmGroup), (*T).handleHeartbeat, true,
+		"Keep a group subscribed to topics", []string{prmTopic}},
+	{"GET", "/topics", (*T).handleGetTopics, true,
+		"List topics", []string{prmWithParts, prmWithConfig}},
+	{"GET", fmt.Sprintf("/topics/{%s}", prmTopic), (*T).handleGetTopicMetadata, true,
+		"Get topic metadata", nil},
+	{"GET", fmt.Sprintf("/topics/{%s}/offsets", prmTopic), (*T).handleGetOffsets, true,
+		"Get offsets of a group", []string{prmGroup, prmFields, prmPartition, prmLimit, prmCursor, prmRefresh}},
+	{"POST", fmt.Sprintf("/topics/{%s}/offsets", prmTopic), (*T).handleSetOffsets, true,
+		"Set offsets of a group", []string{prmGroup, prmTimestamp}},
+	{"GET", fmt.Sprintf("/groups/{%s}/offsets", prmGroup), (*T).handleGetAllGroupOffsets, true,
+		"Get offsets of a group in all topics", []string{prmFields, prmPartition, prmLimit, prmCursor, prmRefresh}},
+	{"GET", fmt.Sprintf("/groups/{%s}/lag", prmGroup), (*T).handleGetGroupLag, true,
+		"Get lag of a group", []string{prmRefresh}},
+	{"GET", fmt.Sprintf("/groups/{%s}/rebalances", prmGroup), (*T).handleGetGroupRebalances, true,
+		"Get recent rebalancings of a group", nil},
+	{"DELETE", fmt.Sprintf("/groups/{%s}/members/{%s}", prmGroup, prmMember), (*T).handleEvictGroupMember, true,
+		"Evict a member from a group", nil},
+	{"POST", fmt.Sprintf("/groups/{%s}/rebalance", prmGroup), (*T).handleRebalanceGroup, true,
+		"Rebalance a group", nil},
+	{"GET", fmt.Sprintf("/topics/{%s}/consumers", prmTopic), (*T).handleGetTopicConsumers, true,
+		"List consumers of a topic", []string{prmGroup, prmPartition, prmLimit, prmCursor, prmRefresh}},
+	{"POST", fmt.Sprintf("/topics/{%s}/shadows", prmTopic), (*T).handleStartShadow, true,
+		"Start a shadow group", []string{prmGroup, prmShadow}},
+	{"DELETE", fmt.Sprintf("/topics/{%s}/shadows", prmTopic), (*T).handleStopShadow, true,
+		"Stop a shadow group", []string{prmGroup, prmShadow}},
+	{"GET", "/accounting", (*T).handleGetUsage, true,
+		"Get usage by client", nil},
+	{"GET", fmt.Sprintf("/topics/{%s}/hot-partitions", prmTopic), (*T).handleGetHotPartitions, true,
+		"Get byte rates of topic partitions", nil},
+	{"GET", "/admin/coordinators", (*T).handleGetCoordinators, true,
+		"List group coordinators", nil},
+	{"GET", "/admin/fetch-errors", (*T).handleGetFetchErrors, true,
+		"List recent fetch errors", nil},
+	{"GET", "/admin/produce-errors", (*T).handleGetProduceErrors, true,
+		"List recent produce errors", nil},
+	{"GET", "/admin/brokers", (*T).handleGetBrokers, true,
+		"List brokers", nil},
+	{"GET", "/admin/clients", (*T).handleGetClients, true,
+		"List clients", nil},
+	{"GET", "/admin/disabled-topics", (*T).handleGetDisabledTopics, true,
+		"List disabled topics", nil},
+	{"POST", fmt.Sprintf("/admin/disabled-topics/{%s}/{%s}", prmOp, prmTopic), (*T).handleDisableTopic, true,
+		"Disable an operation on a topic", []string{prmReason}},
+	{"DELETE", fmt.Sprintf("/admin/disabled-topics/{%s}/{%s}", prmOp, prmTopic), (*T).handleEnableTopic, true,
+		"Enable an operation on a topic", nil},
+	{"POST", "/admin/replay-file", (*T).handleReplayFile, true,
+		"Produce messages of a server-local file to a topic", replayParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/consumption/pause", prmTopic), (*T).handlePauseConsumption, true,
+		"Pause consumption of a topic by a group", []string{prmGroup}},
+	{"POST", fmt.Sprintf("/topics/{%s}/consumption/resume", prmTopic), (*T).handleResumeConsumption, true,
+		"Resume consumption of a topic by a group", []string{prmGroup}},
+	{"GET", "/admin/paused-consumption", (*T).handleGetPausedConsumption, true,
+		"List topics paused by group", nil},
+	{"GET", fmt.Sprintf("/traces/{%s}", prmTraceID), (*T).handleGetTrace, true,
+		"Get a message trace", nil},
+	{"GET", "/ws", (*T).handleWebSocket, true,
+		"Open a WebSocket session", []string{prmClient}},
+	{"GET", "/proxies", (*T).handleGetProxies, false,
+		"List proxies", nil},
+	{"GET", "/ready", (*T).handleGetReady, false,
+		"Tell whether the server is ready", nil},
+	{"GET", "/_readyz", (*T).handleGetReadyz, false,
+		"Tell whether the server is ready and connected to clusters", nil},
+	{"GET", "/admin/maintenance", (*T).handleGetMaintenance, false,
+		"Get maintenance mode", nil},
+	{"POST", "/admin/maintenance", (*T).handleStartMaintenance, false,
+		"Start maintenance mode", nil},
+	{"DELETE", "/admin/maintenance", (*T).handleStopMaintenance, false,
+		"Stop maintenance mode", nil},
+}
+
+// adminRoutes are served by both API and admin servers.
+var adminRoutes = []route{
+	{"GET", "/admin/shutdown-status", (*T).handleGetShutdownStatus, false,
+		"Get shutdown progress", nil},
+	{"GET", "/admin/config", (*T).handleGetConfig, false,
+		"Get the effective configuration", nil},
+	{"GET", "/admin/request-timings", (*T).handleGetRequestTimings, false,
+		"Get request timings by route", nil},
+	{"GET", "/_ping", (*T).handlePing, false,
+		"Ping", nil},
+	{"GET", "/_healthz", (*T).handleGetHealthz, false,
+		"Tell whether the process is alive", nil},
+	{"POST", "/_drain", (*T).handleDrain, false,
+		"Drain consume requests and shut down", nil},
+	{"GET", "/_version", (*T).handleGetVersion, false,
+		"Get the version", nil},
+	{"GET", "/openapi.json", (*T).handleGetOpenAPI, false,
+		"Get the OpenAPI document", nil},
+}
+
+// Query parameters of endpoints that are served by both API versions.
+var (
+	produceParams      = []string{prmKey, prmPartition, prmSync, prmTombstone, prmTimeout, prmFormat}
+	produceBatchParams = []string{prmSync, prmTimeout}
+	ackParams          = []string{prmGroup, prmPartition, prmOffset, prmAckMetadata}
+	consumeParams      = []string{
+		prmGroup, prmTimeout, prmWait, prmSubTTL, prmBatch, prmClient, prmNoAutoAck, prmAckMetadata, prmFormat,
+		prmKeyFilter, prmKeyPrefix, prmPattern,
+	}
+	readMessagesParams = []string{prmGroup, prmOffset, prmCount, prmCommitted, prmFormat}
+)
+
+var consumeTopicsParams = []string{
+	prmTopic, prmTimeout, prmWait, prmSubTTL, prmClient, prmNoAutoAck, prmAckMetadata, prmFormat,
+}
+
+var pathParamRegexp = regexp.MustCompile(`{([^}]+)}`)
+
+// Endpoint describes an HTTP API endpoint to client code generators, see
+// `tools/genclients`.
+type Endpoint struct {
+	Method string
+	Path   string
+	// The name of the operation derived from the name of the request
+	// handler, e.g. `AckUpTo` for `handleAckUpTo`.
+	Operation string
+	// If true, then the endpoint is also served under `/proxies/{proxy}`.
+	Proxied bool
+	Summary string
+	// Query parameters accepted by the endpoint.
+	Params []string
+}
+
+// Endpoints returns endpoints of the unversioned API, including those that
+// are also served by admin servers.
+func Endpoints() []Endpoint {
+	var endpoints []Endpoint
+	for _, routes := range [][]route{apiRoutes, adminRoutes} {
+		for _, rt := range routes {
+			endpoints = append(endpoints, Endpoint{
+				Method:    rt.method,
+				Path:      rt.path,
+				Operation: operationName(rt.handler),
+				Proxied:   rt.proxied,
+				Summary:   rt.summary,
+				Params:    rt.params,
+			})
+		}
+	}
+	return endpoints
+}
+
+// operationName returns the name of a request handler without the `handle`
+// prefix.
+func operationName(handler func(*T, http.ResponseWriter, *http.Request)) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".handle")+len(".handle"):]
+}
+
+// registerRoutes registers handlers of the specified routes with the router,
+// prefixing their paths with `prefix`. Registered routes are remembered to be
+// described in the OpenAPI document, and requests are timed per route.
+func (s *T) registerRoutes(router *mux.Router, prefix string, routes []route) {
+	for _, rt := range routes {
+		handler := rt.handler
+		paths := []string{prefix + rt.path}
+		if rt.proxied {
+			paths = append(paths, fmt.Sprintf("%s/proxies/{%s}%s", prefix, prmProxy, rt.path))
+		}
+		for _, path := range paths {
+			routeName := rt.method + " " + path
+			handlerFn := func(w http.ResponseWriter, r *http.Request) {
+				setTimingRoute(r, routeName)
+				handler(s, w, r)
+			}
+			router.HandleFunc(path, handlerFn).Methods(rt.method)
+			registered := rt
+			registered.path = path
+			s.routes = append(s.routes, registered)
+		}
+	}
+}
+
+// handleGetOpenAPI is an HTTP request handler for `GET /openapi.json`
+func (s *T) handleGetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, newOpenAPIDoc(s.routes))
+}
+
+// newOpenAPIDoc returns an OpenAPI 3 document that describes the specified
+// routes. Parameters are described as strings, for it is how they are parsed.
+func newOpenAPIDoc(routes []route) *openAPIDoc {
+	doc := &openAPIDoc{
+		OpenAPI: "3.0.0",
+		Info:    openAPIInfo{Title: "Kafka-Pixy", Version: version.Version},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{Schemas: map[string]*openAPISchema{
+			"Error": {
+				Type:       "object",
+				Properties: map[string]*openAPISchema{"error": {Type: "string"}},
+			},
+		}},
+	}
+	stringSchema := &openAPISchema{Type: "string"}
+	for _, rt := range routes {
+		op := &openAPIOperation{
+			Summary: rt.summary,
+			Responses: map[string]*openAPIResponse{
+				"200": {Description: "OK"},
+				"default": {
+					Description: "Error",
+					Content: map[string]*openAPIMediaType{
+						contentTypeJSON: {Schema: &openAPISchema{Ref: "#/components/schemas/Error"}},
+					},
+				},
+			},
+		}
+		for _, match := range pathParamRegexp.FindAllStringSubmatch(rt.path, -1) {
+			op.Parameters = append(op.Parameters, &openAPIParameter{
+				Name: match[1], In: "path", Required: true, Schema: stringSchema,
+			})
+		}
+		for _, param := range rt.params {
+			op.Parameters = append(op.Parameters, &openAPIParameter{
+				Name: param, In: "query", Schema: stringSchema,
+			})
+		}
+		pathItem := doc.Paths[rt.path]
+		if pathItem == nil {
+			pathItem = make(map[string]*openAPIOperation)
+			doc.Paths[rt.path] = pathItem
+		}
+		pathItem[strings.ToLower(rt.method)] = op
+	}
+	return doc
+}
+
+type openAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	Summary    string                      `json:"summary"`
+	Parameters []*openAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+}
@@ -0,0 +1,105 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RoutesSuite{})
+
+type RoutesSuite struct{}
+
+// Every endpoint is registered only once and has a summary.
+func (s *RoutesSuite) TestRoutesUnique(c *C) {
+	hs := &T{}
+	router := mux.NewRouter()
+	hs.registerRoutes(router, "", apiRoutes)
+	hs.registerRoutes(router, v2Prefix, v2Routes)
+	hs.registerRoutes(router, "", adminRoutes)
+
+	seen := make(map[string]bool)
+	for _, rt := range hs.routes {
+		endpoint := rt.method + " " + rt.path
+		c.Assert(seen[endpoint], Equals, false, Commentf(endpoint))
+		c.Assert(rt.summary, Not(Equals), "", Commentf(endpoint))
+		seen[endpoint] = true
+	}
+	c.Assert(seen["POST /proxies/{proxy}/topics/{topic}/messages"], Equals, true)
+	c.Assert(seen["GET /v2/proxies/{proxy}/topics/{topic}/messages"], Equals, true)
+	c.Assert(seen["GET /proxies/{proxy}/ready"], Equals, false)
+}
+
+// The OpenAPI document describes registered endpoints along with their path
+// and query parameters.
+func (s *RoutesSuite) TestOpenAPIDoc(c *C) {
+	hs := &T{}
+	router := mux.NewRouter()
+	hs.registerRoutes(router, "", apiRoutes)
+	hs.registerRoutes(router, v2Prefix, v2Routes)
+	hs.registerRoutes(router, "", adminRoutes)
+	r := httptest.NewRequest("GET", "/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	// When
+	router.ServeHTTP(w, r)
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var doc openAPIDoc
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &doc), IsNil)
+	c.Assert(doc.OpenAPI, Equals, "3.0.0")
+	c.Assert(doc.Paths["/openapi.json"]["get"], NotNil)
+
+	pathItem := doc.Paths["/v2/proxies/{proxy}/topics/{topic}/partitions/{partition}/messages"]
+	c.Assert(len(pathItem), Equals, 1)
+	op := pathItem["get"]
+	c.Assert(op.Summary, Equals, "Read messages from a partition")
+	var params []openAPIParameter
+	for _, param := range op.Parameters {
+		params = append(params, openAPIParameter{Name: param.Name, In: param.In, Required: param.Required})
+	}
+	c.Assert(params, DeepEquals, []openAPIParameter{
+		{Name: "proxy", In: "path", Required: true},
+		{Name: "topic", In: "path", Required: true},
+		{Name: "partition", In: "path", Required: true},
+		{Name: "group", In: "query"},
+		{Name: "offset", In: "query"},
+		{Name: "count", In: "query"},
+		{Name: "committed", In: "query"},
+		{Name: "format", In: "query"},
+	})
+
+	pathItem = doc.Paths["/topics/{topic}/messages"]
+	c.Assert(len(pathItem), Equals, 2)
+	c.Assert(pathItem["post"].Summary, Equals, "Produce a message")
+	c.Assert(pathItem["get"].Summary, Equals, "Consume a message")
+}
+
+// Endpoints exposed to client code generators are named after their request
+// handlers, and every name is unique.
+func (s *RoutesSuite) TestEndpoints(c *C) {
+	// When
+	endpoints := Endpoints()
+
+	// Then
+	c.Assert(len(endpoints), Equals, len(apiRoutes)+len(adminRoutes))
+	byOperation := make(map[string]Endpoint)
+	for _, ep := range endpoints {
+		_, seen := byOperation[ep.Operation]
+		c.Assert(seen, Equals, false, Commentf(ep.Operation))
+		byOperation[ep.Operation] = ep
+	}
+	c.Assert(byOperation["AckUpTo"], DeepEquals, Endpoint{
+		Method:    "POST",
+		Path:      "/topics/{topic}/acks/upto",
+		Operation: "AckUpTo",
+		Proxied:   true,
+		Summary:   "Acknowledge all consumed messages up to an offset",
+		Params:    []string{"group", "partition", "offset", "ackMetadata"},
+	})
+	c.Assert(byOperation["GetVersion"].Path, Equals, "/_version")
+}
@@ -0,0 +1,189 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// HTTP headers used to sign requests.
+	hdrKeyID     = "X-Kafka-Pixy-Key-Id"
+	hdrTimestamp = "X-Kafka-Pixy-Timestamp"
+	hdrNonce     = "X-Kafka-Pixy-Nonce"
+	hdrSignature = "X-Kafka-Pixy-Signature"
+)
+
+// signingKeyIDKey is the request context key of the ID of the key that the
+// request has been signed with.
+type signingKeyIDKey struct{}
+
+// unsignedPaths are served without a signature check.
+var unsignedPaths = map[string]bool{
+	"/_ping":    true,
+	"/_healthz": true,
+	"/_readyz":  true,
+}
+
+// signatureVerifier checks that HTTP requests are signed with one of the
+// configured HMAC keys, and that they are not replays of earlier requests.
+//
+// A request is signed by passing a key ID, a Unix timestamp in seconds, a
+// unique nonce, and a hex encoded HMAC-SHA256 signature in the respective
+// headers. The signature is calculated over the following string:
+//
+//	<method>\n<request URI>\n<timestamp>\n<nonce>\n<body>
+//
+// The body is buffered to calculate the signature before the request is
+// authenticated, so it is read up to `maxBodySize` only, that is the largest
+// body that any proxy accepts, see `maxRequestBodySize`.
+type signatureVerifier struct {
+	keys         map[string][]byte
+	maxClockSkew time.Duration
+	maxBodySize  int
+
+	mu          sync.Mutex
+	nonces      map[string]time.Time
+	lastCleanup time.Time
+
+	// To be used in tests only
+	now func() time.Time
+}
+
+func newSignatureVerifier(keys map[string]string, maxClockSkew time.Duration, maxBodySize int) *signatureVerifier {
+	sv := &signatureVerifier{
+		keys:         make(map[string][]byte, len(keys)),
+		maxClockSkew: maxClockSkew,
+		maxBodySize:  maxBodySize,
+		nonces:       make(map[string]time.Time),
+		now:          time.Now,
+	}
+	for keyID, secret := range keys {
+		sv.keys[keyID] = []byte(secret)
+	}
+	return sv
+}
+
+// wrap returns a handler that passes only requests with valid signatures to
+// the specified handler, responding with 401 Unauthorized to all others, or
+// with 413 Request Entity Too Large if the body is too large to be verified.
+// The ID of the signing key is passed in the request context.
+func (sv *signatureVerifier) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Browsers never sign CORS preflight requests, and neither do
+		// orchestrators probing liveness and readiness.
+		if !unsignedPaths[r.URL.Path] && !isPreflight(r) {
+			if err := sv.verify(w, r); err != nil {
+				if _, ok := err.(errMessageTooLarge); ok {
+					respondWithJSON(w, http.StatusRequestEntityTooLarge, errorHTTPResponse{err.Error()})
+					return
+				}
+				respondWithJSON(w, http.StatusUnauthorized, errorHTTPResponse{err.Error()})
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), signingKeyIDKey{}, r.Header.Get(hdrKeyID)))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// verify checks the request signature. The request body is read to calculate
+// the signature, and then replaced with an in-memory copy. If the body is
+// larger than `maxBodySize`, then `errMessageTooLarge` is returned.
+func (sv *signatureVerifier) verify(w http.ResponseWriter, r *http.Request) error {
+	keyID := r.Header.Get(hdrKeyID)
+	key, ok := sv.keys[keyID]
+	if !ok {
+		return errors.Errorf("unknown signing key: %s", keyID)
+	}
+	timestampStr := r.Header.Get(hdrTimestamp)
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid signature timestamp: %s", timestampStr)
+	}
+	now := sv.now()
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew > sv.maxClockSkew || skew < -sv.maxClockSkew {
+		return errors.Errorf("signature timestamp is out of window: %s", timestampStr)
+	}
+	nonce := r.Header.Get(hdrNonce)
+	if nonce == "" {
+		return errors.New("signature nonce is missing")
+	}
+	signature, err := hex.DecodeString(r.Header.Get(hdrSignature))
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	if r.ContentLength > int64(sv.maxBodySize) {
+		return errMessageTooLarge{size: int(r.ContentLength), maxSize: sv.maxBodySize}
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(sv.maxBodySize)))
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			return errMessageTooLarge{size: -1, maxSize: sv.maxBodySize}
+		}
+		return errors.Wrap(err, "failed to read request body")
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + timestampStr + "\n" + nonce + "\n"))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	// The nonce is registered only after the signature is verified, so that
+	// unauthenticated clients cannot fill up the nonce registry.
+	if !sv.registerNonce(keyID+"/"+nonce, now) {
+		return errors.New("request replay detected")
+	}
+	return nil
+}
+
+// maxRequestBodySize returns the largest request body that any proxy accepts,
+// that is the largest of message and batch size limits of all proxies.
+func maxRequestBodySize(cfg *config.App) int {
+	maxSize := 0
+	for _, proxyCfg := range cfg.Proxies {
+		if proxyCfg.Producer.MaxMessageSize > maxSize {
+			maxSize = proxyCfg.Producer.MaxMessageSize
+		}
+		if proxyCfg.Producer.MaxBatchBytes > maxSize {
+			maxSize = proxyCfg.Producer.MaxBatchBytes
+		}
+	}
+	return maxSize
+}
+
+// registerNonce remembers a nonce for as long as requests that use it could
+// pass the timestamp check. It returns false if the nonce has been seen
+// already.
+func (sv *signatureVerifier) registerNonce(nonce string, now time.Time) bool {
+	ttl := 2 * sv.maxClockSkew
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if now.Sub(sv.lastCleanup) > sv.maxClockSkew {
+		for n, seenAt := range sv.nonces {
+			if now.Sub(seenAt) > ttl {
+				delete(sv.nonces, n)
+			}
+		}
+		sv.lastCleanup = now
+	}
+	if seenAt, ok := sv.nonces[nonce]; ok && now.Sub(seenAt) <= ttl {
+		return false
+	}
+	sv.nonces[nonce] = now
+	return true
+}
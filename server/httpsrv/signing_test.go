@@ -0,0 +1,188 @@
+package httpsrv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/config"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&SigningSuite{})
+
+type SigningSuite struct {
+	now time.Time
+	sv  *signatureVerifier
+}
+
+func (s *SigningSuite) SetUpTest(c *C) {
+	s.now = time.Unix(1478167200, 0)
+	s.sv = newSignatureVerifier(map[string]string{"k1": "secret1", "k2": "secret2"}, time.Minute, 8)
+	s.sv.now = func() time.Time { return s.now }
+}
+
+func (s *SigningSuite) TestValid(c *C) {
+	r := newSignedRequest("POST", "/topics/foo/messages?key=bar", "Hello", "k2", "secret2", s.now, "n1")
+
+	// When
+	err := s.sv.verify(httptest.NewRecorder(), r)
+
+	// Then
+	c.Assert(err, IsNil)
+	body, _ := ioutil.ReadAll(r.Body)
+	c.Assert(string(body), Equals, "Hello")
+}
+
+func (s *SigningSuite) TestInvalid(c *C) {
+	for i, tc := range []struct {
+		r     *http.Request
+		error string
+	}{
+		/* 0 */ {newSignedRequest("GET", "/", "", "k3", "secret1", s.now, "n"), "unknown signing key: k3"},
+		/* 1 */ {newSignedRequest("GET", "/", "", "k1", "secret2", s.now, "n"), "invalid signature"},
+		/* 2 */ {newSignedRequest("GET", "/", "", "k1", "secret1", s.now.Add(-61*time.Second), "n"), "signature timestamp is out of window: 1478167139"},
+		/* 3 */ {newSignedRequest("GET", "/", "", "k1", "secret1", s.now.Add(61*time.Second), "n"), "signature timestamp is out of window: 1478167261"},
+		/* 4 */ {newSignedRequest("GET", "/", "", "k1", "secret1", s.now, ""), "signature nonce is missing"},
+	} {
+		c.Assert(s.sv.verify(httptest.NewRecorder(), tc.r), ErrorMatches, tc.error, Commentf("case #%d", i))
+	}
+}
+
+// If the body or the URI is tampered with, then the signature does not match.
+func (s *SigningSuite) TestTampered(c *C) {
+	r := newSignedRequest("POST", "/topics/foo/messages", "Hello", "k1", "secret1", s.now, "n1")
+	r.Body = ioutil.NopCloser(strings.NewReader("Hello!"))
+	c.Assert(s.sv.verify(httptest.NewRecorder(), r), ErrorMatches, "invalid signature")
+
+	r = newSignedRequest("POST", "/topics/foo/messages", "Hello", "k1", "secret1", s.now, "n2")
+	r.URL.Path = "/topics/bar/messages"
+	c.Assert(s.sv.verify(httptest.NewRecorder(), r), ErrorMatches, "invalid signature")
+}
+
+// A request with the same nonce is rejected while it is within the window,
+// but the nonce is forgotten afterwards.
+func (s *SigningSuite) TestReplay(c *C) {
+	c.Assert(s.sv.verify(httptest.NewRecorder(), newSignedRequest("GET", "/", "", "k1", "secret1", s.now, "n1")), IsNil)
+	c.Assert(s.sv.verify(httptest.NewRecorder(), newSignedRequest("GET", "/", "", "k1", "secret1", s.now, "n1")), ErrorMatches, "request replay detected")
+	// The same nonce used with a different key is fine.
+	c.Assert(s.sv.verify(httptest.NewRecorder(), newSignedRequest("GET", "/", "", "k2", "secret2", s.now, "n1")), IsNil)
+
+	// When
+	s.now = s.now.Add(121 * time.Second)
+
+	// Then
+	c.Assert(s.sv.verify(httptest.NewRecorder(), newSignedRequest("GET", "/", "", "k1", "secret1", s.now, "n1")), IsNil)
+	c.Assert(len(s.sv.nonces), Equals, 1)
+}
+
+// Unsigned requests are rejected with 401, except for ping.
+func (s *SigningSuite) TestWrap(c *C) {
+	h := s.sv.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/topics/foo/offsets", nil))
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+	c.Assert(w.Body.String(), Equals, "{\n  \"error\": \"unknown signing key: \"\n}")
+
+	// Liveness and readiness probes are not signed.
+	for _, path := range []string{"/_ping", "/_healthz", "/_readyz"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		c.Assert(w.Code, Equals, http.StatusOK, Commentf("path=%s", path))
+	}
+
+	// CORS preflight requests are not signed by browsers.
+	w = httptest.NewRecorder()
+	preflight := httptest.NewRequest("OPTIONS", "/topics/foo/messages", nil)
+	preflight.Header.Set(hdrOrigin, "https://app.example.com")
+	preflight.Header.Set(hdrRequestMethod, "POST")
+	h.ServeHTTP(w, preflight)
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("GET", "/topics/foo/offsets", "", "k1", "secret1", s.now, "n1"))
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
+
+// Requests are accounted to the key they are signed with, and unsigned ones
+// to the proxy alias.
+func (s *SigningSuite) TestTenant(c *C) {
+	var tenant string
+	h := s.sv.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = getTenant(r)
+	}))
+
+	// When
+	h.ServeHTTP(httptest.NewRecorder(), newSignedRequest("GET", "/topics/foo/offsets", "", "k2", "secret2", s.now, "n1"))
+
+	// Then
+	c.Assert(tenant, Equals, "hmac:k2")
+
+	// When
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_ping", nil))
+
+	// Then
+	c.Assert(tenant, Equals, "")
+}
+
+// A body larger than any proxy accepts is rejected with 413 before it is read
+// in full, whether its size is declared or not.
+func (s *SigningSuite) TestTooLarge(c *C) {
+	h := s.sv.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i, contentLength := range []int64{9, -1} {
+		r := newSignedRequest("POST", "/topics/foo/messages", "123456789", "k1", "secret1", s.now, "n1")
+		r.ContentLength = contentLength
+		w := httptest.NewRecorder()
+
+		// When
+		h.ServeHTTP(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusRequestEntityTooLarge, Commentf("case #%d", i))
+	}
+	c.Assert(len(s.sv.nonces), Equals, 0)
+}
+
+// The body size limit is the largest message or batch size of all proxies.
+func (s *SigningSuite) TestMaxRequestBodySize(c *C) {
+	cfg := config.DefaultApp("foo")
+	cfg.Proxies["foo"].Producer.MaxMessageSize = 100
+	cfg.Proxies["foo"].Producer.MaxBatchBytes = 200
+	cfg.Proxies["bar"] = config.DefaultProxy()
+	cfg.Proxies["bar"].Producer.MaxMessageSize = 300
+	cfg.Proxies["bar"].Producer.MaxBatchBytes = 50
+
+	// When
+	maxSize := maxRequestBodySize(cfg)
+
+	// Then
+	c.Assert(maxSize, Equals, 300)
+}
+
+func newSignedRequest(method, uri, body, keyID, secret string, timestamp time.Time, nonce string) *http.Request {
+	r := httptest.NewRequest(method, uri, strings.NewReader(body))
+	timestampStr := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestampStr + "\n" + nonce + "\n" + body))
+	r.Header.Set(hdrKeyID, keyID)
+	r.Header.Set(hdrTimestamp, timestampStr)
+	r.Header.Set(hdrNonce, nonce)
+	r.Header.Set(hdrSignature, hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
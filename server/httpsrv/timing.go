@@ -0,0 +1,191 @@
+package httpsrv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timings of requests served by all HTTP servers of the process, reported by
+// `GET /admin/request-timings`.
+var requestTimings = newTimingStats()
+
+// requestTiming splits the time it takes to serve a request into time spent
+// waiting for Kafka operations, e.g. long polling for a message to consume,
+// or waiting for a produced message to be acknowledged, and the time spent
+// processing the request otherwise, e.g. reading, verifying and parsing the
+// request, and writing the response.
+type requestTiming struct {
+	begin time.Time
+	route string
+	queue time.Duration
+}
+
+type requestTimingKey struct{}
+
+func (rt *requestTiming) processing() time.Duration {
+	return time.Since(rt.begin) - rt.queue
+}
+
+// String returns the timing in the format of the `X-Timing` header.
+func (rt *requestTiming) String() string {
+	return fmt.Sprintf("queue=%.3fms, processing=%.3fms", toMillis(rt.queue), toMillis(rt.processing()))
+}
+
+// timeRequests wraps an HTTP handler to measure requests from the moment they
+// are received. Timings of requests to known routes are recorded to `stats`,
+// and if `withHeader` is true, then they are also reported to clients in the
+// `X-Timing` header, as of the moment the response header is written.
+func timeRequests(stats *timingStats, withHeader bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt := &requestTiming{begin: time.Now()}
+		r = r.WithContext(context.WithValue(r.Context(), requestTimingKey{}, rt))
+		if withHeader {
+			w = &timingHeaderWriter{ResponseWriter: w, rt: rt}
+		}
+		h.ServeHTTP(w, r)
+		if rt.route != "" {
+			stats.record(rt.route, rt.queue, rt.processing())
+		}
+	})
+}
+
+// setTimingRoute tells what route the request is for, so that its timing is
+// recorded for the route.
+func setTimingRoute(r *http.Request, route string) {
+	if rt, ok := r.Context().Value(requestTimingKey{}).(*requestTiming); ok {
+		rt.route = route
+	}
+}
+
+// trackQueue should be called right before the request starts waiting for a
+// Kafka operation. It returns a function to be called when the operation
+// completes, that accounts the time in between as queue time of the request.
+func trackQueue(r *http.Request) func() {
+	rt, ok := r.Context().Value(requestTimingKey{}).(*requestTiming)
+	if !ok {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() {
+		rt.queue += time.Since(begin)
+	}
+}
+
+// timingHeaderWriter adds the `X-Timing` header to a response when its header
+// is written.
+type timingHeaderWriter struct {
+	http.ResponseWriter
+	rt          *requestTiming
+	wroteHeader bool
+}
+
+func (tw *timingHeaderWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Set(hdrTiming, tw.rt.String())
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingHeaderWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket requests take over the connection.
+func (tw *timingHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	tw.wroteHeader = true
+	return hj.Hijack()
+}
+
+// Flush lets streamed responses be sent as they are written.
+func (tw *timingHeaderWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// routeTiming is timing statistics of requests to a route, as reported by
+// `GET /admin/request-timings`.
+type routeTiming struct {
+	Count           int64   `json:"count"`
+	AvgQueueMs      float64 `json:"avg_queue_ms"`
+	MaxQueueMs      float64 `json:"max_queue_ms"`
+	AvgProcessingMs float64 `json:"avg_processing_ms"`
+	MaxProcessingMs float64 `json:"max_processing_ms"`
+}
+
+// timingStats accumulates request timings per route.
+type timingStats struct {
+	mu     sync.Mutex
+	routes map[string]*routeTimingStat
+}
+
+type routeTimingStat struct {
+	count           int64
+	totalQueue      time.Duration
+	maxQueue        time.Duration
+	totalProcessing time.Duration
+	maxProcessing   time.Duration
+}
+
+func newTimingStats() *timingStats {
+	return &timingStats{routes: make(map[string]*routeTimingStat)}
+}
+
+func (ts *timingStats) record(route string, queue, processing time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	s := ts.routes[route]
+	if s == nil {
+		s = &routeTimingStat{}
+		ts.routes[route] = s
+	}
+	s.count++
+	s.totalQueue += queue
+	if queue > s.maxQueue {
+		s.maxQueue = queue
+	}
+	s.totalProcessing += processing
+	if processing > s.maxProcessing {
+		s.maxProcessing = processing
+	}
+}
+
+// snapshot returns timing statistics of all routes requested so far, indexed
+// by route names in the `<method> <path>` format.
+func (ts *timingStats) snapshot() map[string]routeTiming {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	snapshot := make(map[string]routeTiming, len(ts.routes))
+	for route, s := range ts.routes {
+		snapshot[route] = routeTiming{
+			Count:           s.count,
+			AvgQueueMs:      toMillis(s.totalQueue / time.Duration(s.count)),
+			MaxQueueMs:      toMillis(s.maxQueue),
+			AvgProcessingMs: toMillis(s.totalProcessing / time.Duration(s.count)),
+			MaxProcessingMs: toMillis(s.maxProcessing),
+		}
+	}
+	return snapshot
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
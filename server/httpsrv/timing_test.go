@@ -0,0 +1,87 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&TimingSuite{})
+
+type TimingSuite struct {
+	stats *timingStats
+}
+
+func (s *TimingSuite) SetUpTest(c *C) {
+	s.stats = newTimingStats()
+}
+
+func (s *TimingSuite) handler(queue, processing time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setTimingRoute(r, "GET /topics/{topic}/messages")
+		queueDone := trackQueue(r)
+		time.Sleep(queue)
+		queueDone()
+		time.Sleep(processing)
+		respondWithJSON(w, http.StatusOK, EmptyResponse)
+	})
+}
+
+// Time spent waiting for Kafka operations and the rest of the request time
+// are recorded separately per route.
+func (s *TimingSuite) TestStats(c *C) {
+	h := timeRequests(s.stats, false, s.handler(50*time.Millisecond, 20*time.Millisecond))
+
+	// When
+	for i := 0; i < 2; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/topics/foo/messages", nil))
+	}
+
+	// Then
+	snapshot := s.stats.snapshot()
+	c.Assert(len(snapshot), Equals, 1)
+	timing := snapshot["GET /topics/{topic}/messages"]
+	c.Assert(timing.Count, Equals, int64(2))
+	c.Assert(timing.AvgQueueMs >= 50, Equals, true, Commentf("%+v", timing))
+	c.Assert(timing.MaxQueueMs >= timing.AvgQueueMs, Equals, true, Commentf("%+v", timing))
+	c.Assert(timing.AvgProcessingMs >= 20 && timing.AvgProcessingMs < 50, Equals, true, Commentf("%+v", timing))
+	c.Assert(timing.MaxProcessingMs >= timing.AvgProcessingMs, Equals, true, Commentf("%+v", timing))
+}
+
+// Requests that are not routed to any endpoint are not recorded.
+func (s *TimingSuite) TestStatsUnknownRoute(c *C) {
+	h := timeRequests(s.stats, false, http.NotFoundHandler())
+
+	// When
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	c.Assert(s.stats.snapshot(), DeepEquals, map[string]routeTiming{})
+}
+
+// In debug mode the timing of a request is reported in the response header.
+func (s *TimingSuite) TestHeader(c *C) {
+	h := timeRequests(s.stats, true, s.handler(50*time.Millisecond, 0))
+	w := httptest.NewRecorder()
+
+	// When
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/topics/foo/messages", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get(hdrTiming), Matches, `queue=\d{2,}\.\d{3}ms, processing=\d+\.\d{3}ms`)
+}
+
+func (s *TimingSuite) TestHeaderDisabled(c *C) {
+	h := timeRequests(s.stats, false, s.handler(0, 0))
+	w := httptest.NewRecorder()
+
+	// When
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/topics/foo/messages", nil))
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get(hdrTiming), Equals, "")
+}
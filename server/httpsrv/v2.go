@@ -0,0 +1,243 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+)
+
+const (
+	hdrAccept = "Accept"
+
+	contentTypeJSON = "application/json"
+
+	// The path prefix of the version 2 API.
+	v2Prefix = "/v2"
+)
+
+// v2Routes are endpoints of the version 2 API, that are served under the
+// `/v2` prefix along with the unversioned API, that is version 1. Version 2
+// differs by the format of responses that carry messages: message values can
+// be returned either as JSON, or raw in the response body, as negotiated via
+// the `Accept` header. Responses that carry no messages are the same as in
+// version 1, so respective handlers are shared.
+var v2Routes = []route{
+	{"POST", fmt.Sprintf("/topics/{%s}/messages", prmTopic), (*T).handleProduce, true,
+		"Produce a message", produceParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/batch", prmTopic), (*T).handleProduceBatch, true,
+		"Produce a batch of messages", produceBatchParams},
+	{"GET", fmt.Sprintf("/topics/{%s}/messages", prmTopic), (*T).handleConsumeV2, true,
+		"Consume a message", consumeParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/messages/ack", prmTopic), (*T).handleAck, true,
+		"Acknowledge a consumed message", ackParams},
+	{"POST", fmt.Sprintf("/topics/{%s}/acks/upto", prmTopic), (*T).handleAckUpTo, true,
+		"Acknowledge all consumed messages up to an offset", ackParams},
+	{"GET", fmt.Sprintf("/topics/{%s}/partitions/{%s}/messages", prmTopic, prmPartition), (*T).handleReadMessagesV2, true,
+		"Read messages from a partition", readMessagesParams},
+}
+
+// handleConsumeV2 is an HTTP request handler for
+// `GET /v2/topics/{topic}/messages`. The raw format cannot carry more than one
+// message, so batch requests have to accept JSON. Requests are rejected before
+// anything is consumed, for a message consumed with auto ack would be lost
+// otherwise.
+func (s *T) handleConsumeV2(w http.ResponseWriter, r *http.Request) {
+	// The format parameter takes precedence over the `Accept` header.
+	format, err := getConsumeFormat(r)
+	if err != nil {
+		r.Body.Close()
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	switch format {
+	case formatJSON:
+		s.serveConsume(w, r, v2JSONFormat{})
+		return
+	case formatRaw:
+		s.serveConsume(w, r, rawFormat{})
+		return
+	}
+	contentType := negotiateContentType(r.Header.Get(hdrAccept))
+	switch contentType {
+	case contentTypeJSON:
+		s.serveConsume(w, r, v2JSONFormat{})
+	case contentTypeRaw:
+		if _, isBatch := r.URL.Query()[prmBatch]; isBatch {
+			r.Body.Close()
+			respondWithJSON(w, http.StatusNotAcceptable, errorHTTPResponse{"Batch consume requires " + contentTypeJSON})
+			return
+		}
+		s.serveConsume(w, r, rawFormat{})
+	default:
+		r.Body.Close()
+		respondWithNotAcceptable(w)
+	}
+}
+
+// handleReadMessagesV2 is an HTTP request handler for
+// `GET /v2/topics/{topic}/partitions/{partition}/messages`. Read messages are
+// always returned as a list, so only JSON is supported.
+func (s *T) handleReadMessagesV2(w http.ResponseWriter, r *http.Request) {
+	if negotiateContentType(r.Header.Get(hdrAccept)) != contentTypeJSON {
+		r.Body.Close()
+		respondWithJSON(w, http.StatusNotAcceptable, errorHTTPResponse{"Read messages requires " + contentTypeJSON})
+		return
+	}
+	s.serveReadMessages(w, r, v2JSONFormat{})
+}
+
+func respondWithNotAcceptable(w http.ResponseWriter) {
+	errorText := fmt.Sprintf("Either %s or %s must be acceptable", contentTypeJSON, contentTypeRaw)
+	respondWithJSON(w, http.StatusNotAcceptable, errorHTTPResponse{errorText})
+}
+
+// negotiateContentType returns a content type of messages that the client
+// accepts according to the specified `Accept` header value, preferring the
+// one with the highest quality, and JSON if qualities are equal. JSON is
+// returned if the header is not specified, and an empty string if the client
+// accepts neither.
+func negotiateContentType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeJSON
+	}
+	// Qualities of content types that are not mentioned are -1. An exact
+	// content type takes precedence over wildcards whatever its quality is.
+	jsonQ, rawQ, wildcardQ := -1.0, -1.0, -1.0
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case contentTypeJSON:
+			jsonQ = q
+		case contentTypeRaw:
+			rawQ = q
+		case "application/*", "*/*":
+			if q > wildcardQ {
+				wildcardQ = q
+			}
+		}
+	}
+	if jsonQ < 0 {
+		jsonQ = wildcardQ
+	}
+	if rawQ < 0 {
+		rawQ = wildcardQ
+	}
+	switch {
+	case jsonQ > 0 && jsonQ >= rawQ:
+		return contentTypeJSON
+	case rawQ > 0:
+		return contentTypeRaw
+	}
+	return ""
+}
+
+// messageFormat sends consumed messages in a response format of a particular
+// API version.
+type messageFormat interface {
+	// writeMessage sends a message consumed by a group. `groupChosen` tells
+	// whether the group was chosen among several requested ones, and
+	// `topicChosen` whether the topic was chosen among ones matching a
+	// pattern.
+	writeMessage(w http.ResponseWriter, group string, groupChosen, topicChosen bool, msg consumer.Message)
+
+	// writeMessages sends a list of messages, consumed by a group if one is
+	// specified.
+	writeMessages(w http.ResponseWriter, group string, msgs []consumer.Message)
+}
+
+// v1Format is the format of the unversioned API.
+type v1Format struct{}
+
+func (v1Format) writeMessage(w http.ResponseWriter, group string, groupChosen, topicChosen bool, msg consumer.Message) {
+	res := consumeHTTPResponse{
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Retries:   msg.Retries,
+		Fields:    msg.Fields,
+	}
+	// The group and the topic are reported only if there was a choice.
+	if groupChosen {
+		res.Group = group
+	}
+	if topicChosen {
+		res.Topic = msg.Topic
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (v1Format) writeMessages(w http.ResponseWriter, group string, msgs []consumer.Message) {
+	res := make([]consumeHTTPResponse, len(msgs))
+	for i, msg := range msgs {
+		res[i] = consumeHTTPResponse{
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Retries:   msg.Retries,
+			Fields:    msg.Fields,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// v2JSONFormat is the JSON format of the version 2 API. Unlike version 1, a
+// message always carries the topic and the group, and lists of messages are
+// wrapped in an object, so that fields can be added to the response later.
+type v2JSONFormat struct{}
+
+func (v2JSONFormat) writeMessage(w http.ResponseWriter, group string, groupChosen, topicChosen bool, msg consumer.Message) {
+	respondWithJSON(w, http.StatusOK, newMessageV2View(group, msg))
+}
+
+func (v2JSONFormat) writeMessages(w http.ResponseWriter, group string, msgs []consumer.Message) {
+	res := messagesV2HTTPResponse{Messages: make([]messageV2View, len(msgs))}
+	for i, msg := range msgs {
+		res.Messages[i] = newMessageV2View(group, msg)
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+type messageV2View struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Group     string `json:"group,omitempty"`
+	Retries   int    `json:"retries,omitempty"`
+
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+func newMessageV2View(group string, msg consumer.Message) messageV2View {
+	return messageV2View{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Group:     group,
+		Retries:   msg.Retries,
+		Fields:    msg.Fields,
+	}
+}
+
+type messagesV2HTTPResponse struct {
+	Messages []messageV2View `json:"messages"`
+}
@@ -0,0 +1,85 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mailgun/kafka-pixy/consumer"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&V2Suite{})
+
+type V2Suite struct{}
+
+func (s *V2Suite) TestNegotiateContentType(c *C) {
+	for i, tc := range []struct {
+		accept      string
+		contentType string
+	}{
+		/* 0 */ {"", contentTypeJSON},
+		/* 1 */ {"application/json", contentTypeJSON},
+		/* 2 */ {"application/octet-stream", contentTypeRaw},
+		/* 3 */ {"application/octet-stream, application/json", contentTypeJSON},
+		/* 4 */ {"application/octet-stream, application/json;q=0.5", contentTypeRaw},
+		/* 5 */ {"*/*", contentTypeJSON},
+		/* 6 */ {"application/*;q=0.3, application/octet-stream", contentTypeRaw},
+		/* 7 */ {"application/json;q=0, */*", contentTypeRaw},
+		/* 8 */ {"text/plain, application/json-seq", ""},
+		/* 9 */ {"APPLICATION/OCTET-STREAM", contentTypeRaw},
+	} {
+		c.Assert(negotiateContentType(tc.accept), Equals, tc.contentType, Commentf("case #%d", i))
+	}
+}
+
+// In the JSON format messages always carry the topic and the group, and lists
+// of messages are wrapped in an object.
+func (s *V2Suite) TestJSONFormat(c *C) {
+	w := httptest.NewRecorder()
+
+	// When
+	v2JSONFormat{}.writeMessages(w, "bar", []consumer.Message{
+		{Key: []byte("k1"), Value: []byte("v1"), Topic: "foo", Partition: 3, Offset: 42},
+		{Value: []byte("v2"), Topic: "foo", Partition: 3, Offset: 43},
+	})
+
+	// Then
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var body messagesV2HTTPResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+	c.Assert(body, DeepEquals, messagesV2HTTPResponse{Messages: []messageV2View{
+		{Topic: "foo", Partition: 3, Offset: 42, Key: []byte("k1"), Value: []byte("v1"), Group: "bar"},
+		{Topic: "foo", Partition: 3, Offset: 43, Value: []byte("v2"), Group: "bar"},
+	}})
+}
+
+// Consume requests that accept neither JSON nor raw messages, and batch
+// requests that accept only raw messages, are rejected before anything is
+// consumed.
+func (s *V2Suite) TestConsumeNotAcceptable(c *C) {
+	hs := &T{}
+	for i, tc := range []struct {
+		url    string
+		accept string
+		error  string
+	}{
+		/* 0 */ {"/v2/topics/foo/messages?group=bar", "text/plain",
+			"Either application/json or application/octet-stream must be acceptable"},
+		/* 1 */ {"/v2/topics/foo/messages?group=bar&batch=10", "application/octet-stream",
+			"Batch consume requires application/json"},
+	} {
+		r := httptest.NewRequest("GET", tc.url, nil)
+		r.Header.Set(hdrAccept, tc.accept)
+		w := httptest.NewRecorder()
+
+		// When
+		hs.handleConsumeV2(w, r)
+
+		// Then
+		c.Assert(w.Code, Equals, http.StatusNotAcceptable, Commentf("case #%d", i))
+		var body errorHTTPResponse
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &body), IsNil)
+		c.Assert(body.Error, Equals, tc.error, Commentf("case #%d", i))
+	}
+}
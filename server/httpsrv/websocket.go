@@ -0,0 +1,237 @@
+package httpsrv
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsWriteTimeout = 10 * time.Second
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	// The largest payload a control frame is allowed to have.
+	wsMaxControlPayload = 125
+)
+
+var errWSClosed = errors.New("connection closed by peer")
+
+// wsConn is a minimal server side implementation of the WebSocket protocol
+// (RFC 6455). It supports text and binary messages, fragmented messages, ping,
+// pong and close frames, that is enough for the WebSocket API. Extensions,
+// e.g. per message compression, are not supported.
+//
+// Only one goroutine may read messages, but any number of goroutines may write
+// them concurrently.
+type wsConn struct {
+	conn           net.Conn
+	br             *bufio.Reader
+	maxMessageSize int
+	writeMu        sync.Mutex
+	closeOnce      sync.Once
+}
+
+// upgradeWS performs a WebSocket handshake and takes over the underlying
+// connection of the HTTP request. If an error is returned, then nothing has
+// been written to `w` yet.
+func upgradeWS(w http.ResponseWriter, r *http.Request, maxMessageSize int) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, errors.New("Not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("Unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("Missing Sec-WebSocket-Key header")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("WebSocket is not supported by the connection")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hijack connection")
+	}
+	wsc := &wsConn{conn: conn, br: brw.Reader, maxMessageSize: maxMessageSize}
+	res := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := conn.Write([]byte(res)); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to complete handshake")
+	}
+	return wsc, nil
+}
+
+// readMessage reads the next data message from the connection. Control frames
+// that arrive in between are handled transparently. If the peer closes the
+// connection, then `errWSClosed` is returned.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	inMessage := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			// Echo the status code back as the protocol requires.
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(wsOpClose, payload)
+			return nil, errWSClosed
+		case wsOpText, wsOpBinary:
+			if inMessage {
+				return nil, errors.New("new message started before previous one finished")
+			}
+			inMessage = true
+			message = payload
+		case wsOpContinuation:
+			if !inMessage {
+				return nil, errors.New("continuation frame without message")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, errors.Errorf("unknown opcode: %d", opcode)
+		}
+		if len(message) > c.maxMessageSize {
+			return nil, errors.Errorf("message too large: max=%d", c.maxMessageSize)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// writeMessage sends a text message to the peer.
+func (c *wsConn) writeMessage(message []byte) error {
+	return c.writeFrame(wsOpText, message)
+}
+
+// close sends a close frame to the peer and closes the connection. It is safe
+// to call it several times.
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		c.writeFrame(wsOpClose, nil)
+		c.conn.Close()
+	})
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := hdr[0]&0x80 != 0
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("reserved bits set")
+	}
+	opcode := hdr[0] & 0x0F
+	// All frames sent by a client must be masked.
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("frame is not masked")
+	}
+	length := uint64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (!fin || length > wsMaxControlPayload) {
+		return false, 0, nil, errors.New("invalid control frame")
+	}
+	if length > uint64(c.maxMessageSize) {
+		return false, 0, nil, errors.Errorf("message too large: max=%d", c.maxMessageSize)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&0x3]
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(length))
+		frame = append(frame, ext[:]...)
+	}
+	frame = append(frame, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerHasToken tells if a comma separated list header contains the token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package httpsrv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&WebSocketSuite{})
+
+type WebSocketSuite struct {
+	srv *httptest.Server
+}
+
+func (s *WebSocketSuite) SetUpTest(c *C) {
+	// The server echoes every message it gets back in upper case.
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWS(w, r, 1024)
+		if err != nil {
+			respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+			return
+		}
+		defer conn.close()
+		for {
+			message, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			conn.writeMessage([]byte(strings.ToUpper(string(message))))
+		}
+	}))
+}
+
+func (s *WebSocketSuite) TearDownTest(c *C) {
+	s.srv.Close()
+}
+
+// The handshake response carries the accept key computed as RFC 6455 requires.
+func (s *WebSocketSuite) TestAcceptKey(c *C) {
+	c.Assert(wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="), Equals, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+}
+
+func (s *WebSocketSuite) TestEcho(c *C) {
+	conn, br := s.dial(c)
+	defer conn.Close()
+
+	// When
+	writeClientFrame(c, conn, true, wsOpText, []byte("hello"))
+
+	// Then
+	opcode, payload := readServerFrame(c, br)
+	c.Assert(opcode, Equals, byte(wsOpText))
+	c.Assert(string(payload), Equals, "HELLO")
+}
+
+// Fragmented messages are reassembled, control frames in between are handled
+// transparently.
+func (s *WebSocketSuite) TestFragmented(c *C) {
+	conn, br := s.dial(c)
+	defer conn.Close()
+
+	// When
+	writeClientFrame(c, conn, false, wsOpText, []byte("foo"))
+	writeClientFrame(c, conn, true, wsOpPing, []byte("ping"))
+	writeClientFrame(c, conn, false, wsOpContinuation, []byte("bar"))
+	writeClientFrame(c, conn, true, wsOpContinuation, []byte(strings.Repeat("z", 300)))
+
+	// Then
+	opcode, payload := readServerFrame(c, br)
+	c.Assert(opcode, Equals, byte(wsOpPong))
+	c.Assert(string(payload), Equals, "ping")
+	opcode, payload = readServerFrame(c, br)
+	c.Assert(opcode, Equals, byte(wsOpText))
+	c.Assert(string(payload), Equals, "FOOBAR"+strings.Repeat("Z", 300))
+}
+
+func (s *WebSocketSuite) TestClose(c *C) {
+	conn, br := s.dial(c)
+	defer conn.Close()
+
+	// When
+	writeClientFrame(c, conn, true, wsOpClose, []byte{0x03, 0xE8})
+
+	// Then
+	opcode, payload := readServerFrame(c, br)
+	c.Assert(opcode, Equals, byte(wsOpClose))
+	c.Assert(payload, DeepEquals, []byte{0x03, 0xE8})
+}
+
+// If a client sends a message larger than allowed, then the connection is
+// closed.
+func (s *WebSocketSuite) TestTooLarge(c *C) {
+	conn, br := s.dial(c)
+	defer conn.Close()
+
+	// When
+	writeClientFrame(c, conn, true, wsOpText, []byte(strings.Repeat("z", 1025)))
+
+	// Then
+	opcode, _ := readServerFrame(c, br)
+	c.Assert(opcode, Equals, byte(wsOpClose))
+	_, err := br.ReadByte()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *WebSocketSuite) TestNotWebSocket(c *C) {
+	// When
+	res, err := http.Get(s.srv.URL)
+
+	// Then
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, http.StatusBadRequest)
+}
+
+func (s *WebSocketSuite) dial(c *C) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(s.srv.URL, "http://"))
+	c.Assert(err, IsNil)
+	req, _ := http.NewRequest("GET", s.srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	c.Assert(req.Write(conn), IsNil)
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusSwitchingProtocols)
+	c.Assert(res.Header.Get("Sec-WebSocket-Accept"), Equals, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	return conn, br
+}
+
+func writeClientFrame(c *C, conn net.Conn, fin bool, opcode byte, payload []byte) {
+	var frame []byte
+	if fin {
+		opcode |= 0x80
+	}
+	frame = append(frame, opcode)
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	c.Assert(err, IsNil)
+}
+
+func readServerFrame(c *C, br *bufio.Reader) (byte, []byte) {
+	var hdr [2]byte
+	_, err := io.ReadFull(br, hdr[:])
+	c.Assert(err, IsNil)
+	c.Assert(hdr[0]&0x80, Equals, byte(0x80))
+	c.Assert(hdr[1]&0x80, Equals, byte(0), Commentf("server frames must not be masked"))
+	length := int(hdr[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		_, err = io.ReadFull(br, ext[:])
+		c.Assert(err, IsNil)
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(br, payload)
+	c.Assert(err, IsNil)
+	return hdr[0] & 0x0F, payload
+}
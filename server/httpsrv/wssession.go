@@ -0,0 +1,362 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/kafka-pixy/actor"
+	"github.com/mailgun/kafka-pixy/errs"
+	"github.com/mailgun/kafka-pixy/none"
+	"github.com/mailgun/kafka-pixy/producer"
+	"github.com/mailgun/kafka-pixy/proxy"
+	"github.com/mailgun/log"
+)
+
+const (
+	// Operations of the WebSocket API.
+	wsOpSubscribe   = "subscribe"
+	wsOpUnsubscribe = "unsubscribe"
+	wsOpAck         = "ack"
+	wsOpProduce     = "produce"
+	wsOpMessage     = "message"
+	wsOpProduced    = "produced"
+	wsOpError       = "error"
+
+	// The largest WebSocket message a client is allowed to send.
+	wsMaxMessageSize = 1024 * 1024
+
+	// The largest number of messages of a subscription that can be delivered
+	// to a client but not acknowledged yet.
+	wsMaxWindow = 100
+
+	// Consume requests that fail with an error other than timeout are retried
+	// after this long.
+	wsConsumeRetryBackOff = 500 * time.Millisecond
+)
+
+// wsRequest is a message sent by a WebSocket API client. Only fields relevant
+// to the operation are expected to be set.
+type wsRequest struct {
+	Op          string `json:"op"`
+	ID          string `json:"id"`
+	Group       string `json:"group"`
+	Topic       string `json:"topic"`
+	Window      int    `json:"window"`
+	Partition   int32  `json:"partition"`
+	Offset      int64  `json:"offset"`
+	AckMetadata string `json:"ack_metadata"`
+	Key         []byte `json:"key"`
+	Value       []byte `json:"value"`
+}
+
+type wsMessageResponse struct {
+	Op        string `json:"op"`
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type wsProducedResponse struct {
+	Op        string `json:"op"`
+	ID        string `json:"id,omitempty"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type wsErrorResponse struct {
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	Group string `json:"group,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	Error string `json:"error"`
+}
+
+type wsSubscriptionID struct {
+	group string
+	topic string
+}
+
+// wsSubscription consumes messages of a topic on behalf of a group and
+// delivers them to a WebSocket client. The number of messages delivered but
+// not acknowledged is limited by the subscription window, that is implemented
+// as a semaphore channel: a slot is taken before a message is consumed, and
+// released when the client acknowledges a message.
+type wsSubscription struct {
+	slotsCh chan none.T
+	stopCh  chan none.T
+}
+
+// wsSession serves a WebSocket API connection.
+type wsSession struct {
+	actorID   *actor.ID
+	pxy       *proxy.T
+	pxyAlias  string
+	proxySet  *proxy.Set
+	tenant    string
+	client    string
+	conn      *wsConn
+	closingCh chan none.T
+	subsMu    sync.Mutex
+	subs      map[wsSubscriptionID]*wsSubscription
+	wg        sync.WaitGroup
+}
+
+// handleWebSocket is an HTTP request handler for `GET /ws`
+func (s *T) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pxy, err := s.getProxy(r)
+	if err != nil {
+		respondWithProxyError(w, err)
+		return
+	}
+	// Hijacked connections are not tracked by the HTTP server, so WebSocket
+	// sessions are tracked separately to be closed on server stop.
+	s.wsMu.Lock()
+	if s.wsStopped {
+		s.wsMu.Unlock()
+		respondWithJSON(w, http.StatusServiceUnavailable, errorHTTPResponse{"Server is stopping"})
+		return
+	}
+	s.wsWG.Add(1)
+	s.wsMu.Unlock()
+	defer s.wsWG.Done()
+
+	conn, err := upgradeWS(w, r, wsMaxMessageSize)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, errorHTTPResponse{err.Error()})
+		return
+	}
+	ss := &wsSession{
+		actorID:   s.actorID.NewChild("ws", remoteAddr(r)),
+		pxy:       pxy,
+		pxyAlias:  mux.Vars(r)[prmProxy],
+		proxySet:  s.proxySet,
+		tenant:    getTenant(r),
+		client:    getClientParam(r),
+		conn:      conn,
+		closingCh: make(chan none.T),
+		subs:      make(map[wsSubscriptionID]*wsSubscription),
+	}
+	ss.run(s.wsStopCh)
+}
+
+// run reads and executes client requests until the client disconnects or the
+// server is stopped.
+func (ss *wsSession) run(serverStopCh <-chan none.T) {
+	log.Infof("<%s> session started", ss.actorID)
+	actor.Spawn(ss.actorID.NewChild("closer"), &ss.wg, func() {
+		select {
+		case <-serverStopCh:
+			ss.conn.close()
+		case <-ss.closingCh:
+		}
+	})
+	for {
+		message, err := ss.conn.readMessage()
+		if err != nil {
+			if err != errWSClosed {
+				log.Infof("<%s> read failed: err=(%s)", ss.actorID, err)
+			}
+			break
+		}
+		var req wsRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			ss.send(wsErrorResponse{Op: wsOpError, Error: "Invalid request: " + err.Error()})
+			continue
+		}
+		ss.handleRequest(req)
+	}
+	close(ss.closingCh)
+	ss.conn.close()
+	ss.wg.Wait()
+	log.Infof("<%s> session ended", ss.actorID)
+}
+
+func (ss *wsSession) handleRequest(req wsRequest) {
+	if req.Topic == "" {
+		ss.sendError(req, "Missing topic")
+		return
+	}
+	switch req.Op {
+	case wsOpSubscribe:
+		ss.subscribe(req)
+	case wsOpUnsubscribe:
+		ss.unsubscribe(req)
+	case wsOpAck:
+		ss.ack(req)
+	case wsOpProduce:
+		ss.produce(req)
+	default:
+		ss.sendError(req, "Unknown op: "+req.Op)
+	}
+}
+
+func (ss *wsSession) subscribe(req wsRequest) {
+	if req.Group == "" {
+		ss.sendError(req, "Missing group")
+		return
+	}
+	window := req.Window
+	if window <= 0 {
+		window = 1
+	}
+	if window > wsMaxWindow {
+		window = wsMaxWindow
+	}
+	subID := wsSubscriptionID{req.Group, req.Topic}
+	ss.subsMu.Lock()
+	defer ss.subsMu.Unlock()
+	if _, ok := ss.subs[subID]; ok {
+		ss.sendError(req, "Already subscribed")
+		return
+	}
+	sub := &wsSubscription{
+		slotsCh: make(chan none.T, window),
+		stopCh:  make(chan none.T),
+	}
+	ss.subs[subID] = sub
+	actor.Spawn(ss.actorID.NewChild("sub", req.Group, req.Topic), &ss.wg, func() {
+		ss.runSubscription(subID, sub)
+	})
+}
+
+func (ss *wsSession) unsubscribe(req wsRequest) {
+	subID := wsSubscriptionID{req.Group, req.Topic}
+	ss.subsMu.Lock()
+	defer ss.subsMu.Unlock()
+	sub, ok := ss.subs[subID]
+	if !ok {
+		ss.sendError(req, "Not subscribed")
+		return
+	}
+	close(sub.stopCh)
+	delete(ss.subs, subID)
+}
+
+// ack acknowledges a message and releases a window slot of the respective
+// subscription. The slot is released even if the ack fails, e.g. because the
+// partition has been reassigned to another Kafka-Pixy instance, for the
+// message is going to be redelivered anyway.
+func (ss *wsSession) ack(req wsRequest) {
+	ack, err := proxy.Ack(req.Partition, req.Offset)
+	if err != nil {
+		ss.sendError(req, err.Error())
+		return
+	}
+	if len(req.AckMetadata) > maxAckMetadataLength {
+		ss.sendError(req, fmt.Sprintf("Ack metadata too long: max=%d", maxAckMetadataLength))
+		return
+	}
+	ss.subsMu.Lock()
+	sub := ss.subs[wsSubscriptionID{req.Group, req.Topic}]
+	ss.subsMu.Unlock()
+	if sub != nil {
+		select {
+		case <-sub.slotsCh:
+		default:
+		}
+	}
+	actor.Spawn(ss.actorID.NewChild("ack"), &ss.wg, func() {
+		if err := ss.pxy.Ack(req.Group, req.Topic, ack.WithMeta(req.AckMetadata)); err != nil {
+			ss.sendError(req, err.Error())
+		}
+	})
+}
+
+func (ss *wsSession) produce(req wsRequest) {
+	// A tombstone is used to delete a key from a compacted topic, therefore
+	// it must have a key.
+	if req.Value == nil && req.Key == nil {
+		ss.sendError(req, "Tombstone requires a key")
+		return
+	}
+	// Maintenance mode can be started after the session is established.
+	if _, err := ss.proxySet.GetForWrite(ss.pxyAlias); err != nil {
+		ss.sendError(req, err.Error())
+		return
+	}
+	actor.Spawn(ss.actorID.NewChild("produce"), &ss.wg, func() {
+		prodMsg, err := ss.pxy.ProduceToPartition(ss.tenant, req.Topic, producer.AnyPartition,
+			toEncoderPreservingNil(req.Key), toEncoderPreservingNil(req.Value), 0)
+		if err != nil {
+			ss.sendError(req, err.Error())
+			return
+		}
+		ss.send(wsProducedResponse{
+			Op:        wsOpProduced,
+			ID:        req.ID,
+			Partition: prodMsg.Partition,
+			Offset:    prodMsg.Offset,
+		})
+	})
+}
+
+// runSubscription consumes messages and sends them to the client, as long as
+// there are free slots in the subscription window.
+func (ss *wsSession) runSubscription(subID wsSubscriptionID, sub *wsSubscription) {
+	for {
+		select {
+		case sub.slotsCh <- none.V:
+		case <-sub.stopCh:
+			return
+		case <-ss.closingCh:
+			return
+		}
+		for {
+			msg, err := ss.pxy.ConsumeWithTimeout(ss.tenant, ss.client, subID.group, subID.topic, proxy.NoAck(), 0, 0)
+			if err == nil {
+				ss.send(wsMessageResponse{
+					Op:        wsOpMessage,
+					Group:     subID.group,
+					Topic:     subID.topic,
+					Key:       msg.Key,
+					Value:     msg.Value,
+					Partition: msg.Partition,
+					Offset:    msg.Offset,
+				})
+				break
+			}
+			retryAfter := time.Duration(0)
+			if !errs.Is(err, errs.ErrRequestTimeout) {
+				log.Infof("<%s> consume failed: group=%s, topic=%s, err=(%s)",
+					ss.actorID, subID.group, subID.topic, err)
+				ss.send(wsErrorResponse{Op: wsOpError, Group: subID.group, Topic: subID.topic, Error: err.Error()})
+				retryAfter = wsConsumeRetryBackOff
+			}
+			select {
+			case <-time.After(retryAfter):
+			case <-sub.stopCh:
+				return
+			case <-ss.closingCh:
+				return
+			}
+		}
+	}
+}
+
+func (ss *wsSession) sendError(req wsRequest, errorText string) {
+	ss.send(wsErrorResponse{Op: wsOpError, ID: req.ID, Group: req.Group, Topic: req.Topic, Error: errorText})
+}
+
+// send writes a response to the client. If that fails, then the connection is
+// closed, that makes the session terminate.
+func (ss *wsSession) send(res interface{}) {
+	encodedRes, err := json.Marshal(res)
+	if err != nil {
+		// The response is not logged, for it may carry a message.
+		log.Errorf("<%s> failed to encode response: type=%T, err=%+v", ss.actorID, res, err)
+		return
+	}
+	if err := ss.conn.writeMessage(encodedRes); err != nil {
+		log.Infof("<%s> write failed: err=(%s)", ss.actorID, err)
+		ss.conn.close()
+	}
+}
@@ -2,47 +2,89 @@ package service
 
 import (
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/logging"
 	"github.com/mailgun/kafka-pixy/proxy"
 	"github.com/mailgun/kafka-pixy/server"
 	"github.com/mailgun/kafka-pixy/server/grpcsrv"
 	"github.com/mailgun/kafka-pixy/server/httpsrv"
+	"github.com/mailgun/kafka-pixy/shutdown"
 	"github.com/mailgun/log"
 	"github.com/pkg/errors"
 )
 
 type T struct {
-	actorID *actor.ID
-	proxies map[string]*proxy.T
-	servers []server.T
-	stopCh  chan struct{}
-	wg      sync.WaitGroup
+	actorID    *actor.ID
+	proxiesMu  sync.Mutex
+	proxies    map[string]*proxy.T
+	proxySet   *proxy.Set
+	servers    []server.T
+	adminSrv   server.T
+	shutdownTr *shutdown.T
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+	wg         sync.WaitGroup
+
+	// Proxies that failed to start are retried in the background until
+	// `retryStopCh` is closed.
+	retryStopCh chan struct{}
+	retryWg     sync.WaitGroup
 }
 
 func Spawn(cfg *config.App) (*T, error) {
+	logging.InitSampling(cfg)
 	s := &T{
-		actorID: actor.RootID.NewChild("service"),
-		proxies: make(map[string]*proxy.T, len(cfg.Proxies)),
-		stopCh:  make(chan struct{}),
+		actorID:     actor.RootID.NewChild("service"),
+		proxies:     make(map[string]*proxy.T, len(cfg.Proxies)),
+		shutdownTr:  shutdown.New(),
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+		retryStopCh: make(chan struct{}),
 	}
 
+	// Proxies that fail to start do not prevent the service from starting
+	// as long as there is at least one proxy that is either started or is
+	// being restarted in the background.
+	retrying := make(map[string]error)
+	failed := make(map[string]error)
+	var spawnErr error
 	for pxyAlias, pxyCfg := range cfg.Proxies {
 		pxy, err := proxy.Spawn(actor.RootID, pxyAlias, pxyCfg)
 		if err != nil {
-			s.stopProxies()
-			return nil, errors.Wrapf(err, "failed to spawn proxy, name=%s", pxyAlias)
+			if pxyCfg.Startup.Retry {
+				log.Errorf("<%s> failed to spawn proxy, will retry: name=%s, err=(%s)", s.actorID, pxyAlias, err)
+				retrying[pxyAlias] = err
+				continue
+			}
+			log.Errorf("<%s> failed to spawn proxy: name=%s, err=(%s)", s.actorID, pxyAlias, err)
+			failed[pxyAlias] = err
+			spawnErr = errors.Wrapf(err, "failed to spawn proxy, name=%s", pxyAlias)
+			continue
 		}
 		s.proxies[pxyAlias] = pxy
 	}
+	if len(s.proxies) == 0 && len(retrying) == 0 {
+		return nil, spawnErr
+	}
 
-	proxySet := proxy.NewSet(s.proxies, s.proxies[cfg.DefaultProxy])
+	proxySet := proxy.NewSet(s.proxies, cfg.DefaultProxy)
+	for pxyAlias, err := range retrying {
+		proxySet.SetNotReady(pxyAlias, err, true)
+	}
+	for pxyAlias, err := range failed {
+		proxySet.SetNotReady(pxyAlias, err, false)
+	}
+	s.proxySet = proxySet
 
 	if cfg.GRPCAddr != "" {
-		grpcSrv, err := grpcsrv.New(cfg.GRPCAddr, proxySet)
+		grpcSrv, err := grpcsrv.New(cfg.GRPCAddr, proxySet, cfg, s.shutdownTr)
 		if err != nil {
 			s.stopProxies()
 			return nil, errors.Wrap(err, "failed to start gRPC server")
@@ -50,7 +92,7 @@ func Spawn(cfg *config.App) (*T, error) {
 		s.servers = append(s.servers, grpcSrv)
 	}
 	if cfg.TCPAddr != "" {
-		tcpSrv, err := httpsrv.New(cfg.TCPAddr, proxySet)
+		tcpSrv, err := httpsrv.New(cfg.TCPAddr, proxySet, cfg, s.shutdownTr)
 		if err != nil {
 			s.stopProxies()
 			return nil, errors.Wrap(err, "failed to start TCP socket based HTTP API server")
@@ -58,7 +100,7 @@ func Spawn(cfg *config.App) (*T, error) {
 		s.servers = append(s.servers, tcpSrv)
 	}
 	if cfg.UnixAddr != "" {
-		unixSrv, err := httpsrv.New(cfg.UnixAddr, proxySet)
+		unixSrv, err := httpsrv.New(cfg.UnixAddr, proxySet, cfg, s.shutdownTr)
 		if err != nil {
 			s.stopProxies()
 			return nil, errors.Wrapf(err, "failed to start Unix socket based HTTP API server")
@@ -69,6 +111,21 @@ func Spawn(cfg *config.App) (*T, error) {
 	if len(s.servers) == 0 {
 		return nil, errors.Errorf("at least one API server should be configured")
 	}
+	if cfg.AdminAddr != "" {
+		adminSrv, err := httpsrv.NewAdmin(cfg.AdminAddr, cfg, s.shutdownTr)
+		if err != nil {
+			s.stopProxies()
+			return nil, errors.Wrap(err, "failed to start admin HTTP server")
+		}
+		s.adminSrv = adminSrv
+	}
+
+	for pxyAlias := range retrying {
+		pxyAlias, pxyCfg := pxyAlias, cfg.Proxies[pxyAlias]
+		actor.Spawn(s.actorID.NewChild(fmt.Sprintf("%s_start", pxyAlias)), &s.retryWg, func() {
+			s.retrySpawnProxy(pxyAlias, pxyCfg)
+		})
+	}
 
 	actor.Spawn(s.actorID, &s.wg, s.run)
 	return s, nil
@@ -79,47 +136,166 @@ func (s *T) Stop() {
 	s.wg.Wait()
 }
 
+// Done returns a channel that is closed when the service has stopped, either
+// because `Stop` was called, or because a drain was requested via the API.
+func (s *T) Done() <-chan struct{} {
+	return s.doneCh
+}
+
+// ProxySet returns the set of proxies served by the service.
+func (s *T) ProxySet() *proxy.Set {
+	return s.proxySet
+}
+
+// DumpState writes a human readable snapshot of the service state to `w`,
+// that is all running actors, partitions assigned to consumers of every
+// proxy, and the number of API requests in flight per server.
+func (s *T) DumpState(w io.Writer) {
+	fmt.Fprintf(w, "actors:\n")
+	for _, actorID := range actor.Running() {
+		fmt.Fprintf(w, "  %s\n", actorID)
+	}
+
+	fmt.Fprintf(w, "assignments:\n")
+	s.proxiesMu.Lock()
+	pxyAliases := make([]string, 0, len(s.proxies))
+	for pxyAlias := range s.proxies {
+		pxyAliases = append(pxyAliases, pxyAlias)
+	}
+	sort.Strings(pxyAliases)
+	for _, pxyAlias := range pxyAliases {
+		assignments := s.proxies[pxyAlias].ConsumerAssignments()
+		for _, group := range sortedKeys(assignments) {
+			topics := assignments[group]
+			for _, topic := range sortedKeys(topics) {
+				fmt.Fprintf(w, "  proxy=%s, group=%s, topic=%s, partitions=%v\n", pxyAlias, group, topic, topics[topic])
+			}
+		}
+	}
+	s.proxiesMu.Unlock()
+
+	fmt.Fprintf(w, "in flight:\n")
+	inFlight := s.shutdownTr.Status().InFlight
+	for _, server := range sortedKeys(inFlight) {
+		fmt.Fprintf(w, "  %s=%d\n", server, inFlight[server])
+	}
+}
+
 // run implements main supervisor loop, that boils down to starting all
 // configured API servers, waiting for a stop signal and terminating everything
-// gracefully.
+// gracefully. Consume requests are drained first, so that long polls in flight
+// complete and offsets of all consumed messages are committed before API
+// servers stop.
 func (s *T) run() {
-	selectCases := make([]reflect.SelectCase, len(s.servers)+1)
-	for i, srv := range s.servers {
+	defer close(s.doneCh)
+	servers := s.servers
+	if s.adminSrv != nil {
+		servers = append(servers[:len(servers):len(servers)], s.adminSrv)
+	}
+	selectCases := make([]reflect.SelectCase, len(servers)+2)
+	for i, srv := range servers {
 		srv.Start()
 		selectCases[i] = reflect.SelectCase{
 			Dir:  reflect.SelectRecv,
 			Chan: reflect.ValueOf(srv.ErrorCh()),
 		}
 	}
-	selectCases[len(s.servers)] = reflect.SelectCase{
+	selectCases[len(servers)] = reflect.SelectCase{
 		Dir:  reflect.SelectRecv,
 		Chan: reflect.ValueOf(s.stopCh),
 	}
+	selectCases[len(servers)+1] = reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(s.shutdownTr.DrainRequested()),
+	}
 
-	// Wait until either an error is reported by one of the servers or a Stop
-	// is called.
+	// Wait until either an error is reported by one of the servers, a Stop
+	// is called, or a drain is requested.
 	chosen, val, ok := reflect.Select(selectCases)
-	if chosen < len(s.servers) && ok {
+	if chosen < len(servers) && ok {
 		serverErr := val.Interface().(error)
 		log.Errorf("API server crashed: %+v", serverErr)
 	}
+	if chosen == len(servers)+1 {
+		log.Infof("<%s> drain requested", s.actorID)
+	}
+	s.shutdownTr.Begin()
+
+	// Stop accepting consume requests and wait for those in flight.
+	endPhase := s.shutdownTr.BeginPhase("drain consumes")
+	s.proxySet.Drain()
+	endPhase()
 
 	// Initiate stop of all API servers.
+	endPhase = s.shutdownTr.BeginPhase("api servers")
 	var wg sync.WaitGroup
 	for _, fe := range s.servers {
 		actor.Spawn(s.actorID.NewChild("srv_stop"), &wg, fe.Stop)
 	}
 	wg.Wait()
+	endPhase()
+
+	// Make sure that no more proxies are started.
+	close(s.retryStopCh)
+	s.retryWg.Wait()
 
 	// There are no more requests in flight at this point so it is safe to stop
 	// all proxies.
 	s.stopProxies()
+
+	s.shutdownTr.End()
+	log.Infof("<%s> shutdown summary: %s", s.actorID, s.shutdownTr.Summary())
+	if s.adminSrv != nil {
+		s.adminSrv.Stop()
+	}
+}
+
+// retrySpawnProxy keeps trying to spawn a proxy that failed to start with the
+// service, until it succeeds or the service is stopped.
+func (s *T) retrySpawnProxy(pxyAlias string, pxyCfg *config.Proxy) {
+	for {
+		select {
+		case <-time.After(pxyCfg.Startup.RetryBackOff):
+		case <-s.retryStopCh:
+			return
+		}
+		pxy, err := proxy.Spawn(actor.RootID, pxyAlias, pxyCfg)
+		if err != nil {
+			log.Errorf("<%s> failed to spawn proxy, will retry: name=%s, err=(%s)", s.actorID, pxyAlias, err)
+			s.proxySet.SetNotReady(pxyAlias, err, true)
+			continue
+		}
+		s.proxiesMu.Lock()
+		s.proxies[pxyAlias] = pxy
+		s.proxiesMu.Unlock()
+		s.proxySet.SetReady(pxyAlias, pxy)
+		log.Infof("<%s> proxy is ready: name=%s", s.actorID, pxyAlias)
+		return
+	}
 }
 
 func (s *T) stopProxies() {
+	s.proxiesMu.Lock()
+	defer s.proxiesMu.Unlock()
 	var wg sync.WaitGroup
 	for pxyAlias, pxy := range s.proxies {
-		actor.Spawn(s.actorID.NewChild(fmt.Sprintf("%s_stop", pxyAlias)), &wg, pxy.Stop)
+		pxy := pxy
+		endPhase := s.shutdownTr.BeginPhase(fmt.Sprintf("proxy %s", pxyAlias))
+		actor.Spawn(s.actorID.NewChild(fmt.Sprintf("%s_stop", pxyAlias)), &wg, func() {
+			defer endPhase()
+			pxy.Stop()
+		})
 	}
 	wg.Wait()
 }
+
+// sortedKeys returns keys of a map with string keys in ascending order.
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	sorted := make([]string, len(keys))
+	for i, key := range keys {
+		sorted[i] = key.String()
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/mailgun/kafka-pixy/config"
@@ -12,6 +14,8 @@ import (
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	. "gopkg.in/check.v1"
 )
 
@@ -192,6 +196,55 @@ func (s *ServiceGRPCSuite) TestProduceInvalidProxy(c *C) {
 	c.Assert(res, IsNil)
 }
 
+// Messages produced via a stream are confirmed with results that carry their
+// correlation IDs, and failures do not break the stream.
+func (s *ServiceGRPCSuite) TestProduceStream(c *C) {
+	svc, err := Spawn(s.cfg)
+	defer svc.Stop()
+	c.Assert(err, IsNil)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	stream, err := s.clt.ProduceStream(ctx, grpc.FailFast(false))
+	c.Assert(err, IsNil)
+
+	// When
+	for i, proxy := range []string{"", "", "invalid"} {
+		req := pb.ProdReq{
+			Proxy:         proxy,
+			Topic:         "test.4",
+			KeyValue:      []byte("bar"),
+			Message:       []byte(fmt.Sprintf("msg%d", i)),
+			CorrelationId: fmt.Sprintf("id%d", i),
+		}
+		c.Assert(stream.Send(&req), IsNil)
+	}
+	c.Assert(stream.CloseSend(), IsNil)
+
+	// Then
+	results := make(map[string]pb.ProdRes)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		results[res.CorrelationId] = *res
+	}
+	c.Assert(len(results), Equals, 3)
+	c.Assert(results["id0"].Partition, Equals, int32(2))
+	c.Assert(results["id1"].Partition, Equals, int32(2))
+	offsets := []int64{results["id0"].Offset, results["id1"].Offset}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	c.Assert(offsets, DeepEquals, []int64{offsetsBefore[2], offsetsBefore[2] + 1})
+	c.Assert(results["id2"], DeepEquals, pb.ProdRes{
+		CorrelationId: "id2",
+		ErrorCode:     int32(codes.Unknown),
+		ErrorDesc:     "proxy `invalid` does not exist",
+	})
+}
+
 func (s *ServiceGRPCSuite) TestConsumeSingleMessage(c *C) {
 	svc, err := Spawn(s.cfg)
 	c.Assert(err, IsNil)
@@ -217,6 +270,7 @@ func (s *ServiceGRPCSuite) TestConsumeSingleMessage(c *C) {
 	// Then
 	c.Assert(err, IsNil)
 	c.Assert(*consRes, DeepEquals, pb.ConsRes{
+		Topic:     "test.4",
 		Partition: prodRes.Partition,
 		Offset:    prodRes.Offset,
 		KeyValue:  prodReq.KeyValue,
@@ -252,6 +306,7 @@ func (s *ServiceGRPCSuite) TestConsumeExplicitProxy(c *C) {
 	// Then
 	c.Assert(err, IsNil)
 	c.Assert(*consRes, DeepEquals, pb.ConsRes{
+		Topic:     "test.4",
 		Partition: prodRes.Partition,
 		Offset:    prodRes.Offset,
 		KeyValue:  prodReq.KeyValue,
@@ -286,6 +341,7 @@ func (s *ServiceGRPCSuite) TestConsumeKeyUndefined(c *C) {
 	// Then
 	c.Assert(err, IsNil)
 	c.Assert(*consRes, DeepEquals, pb.ConsRes{
+		Topic:        "test.4",
 		Partition:    prodRes.Partition,
 		Offset:       prodRes.Offset,
 		KeyUndefined: true,
@@ -314,3 +370,333 @@ func (s *ServiceGRPCSuite) TestConsumeInvalidProxy(c *C) {
 	c.Assert(grpc.Code(err), Equals, codes.Unknown)
 	c.Assert(consRes, IsNil)
 }
+
+// A consume request waits for a message no longer than the deadline of the
+// request allows, even if it is shorter than the long polling timeout.
+func (s *ServiceGRPCSuite) TestConsumeDeadline(c *C) {
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout = 5 * time.Second
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	group := fmt.Sprintf("g%d", rand.Int())
+	s.kh.ResetOffsets(group, "test.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	begin := time.Now()
+
+	// When
+	consRes, err := s.clt.Consume(ctx, &pb.ConsReq{Topic: "test.1", Group: group}, grpc.FailFast(false))
+
+	// Then
+	c.Assert(grpc.Code(err), Equals, codes.DeadlineExceeded)
+	// The error comes from the server rather than from the client giving up.
+	c.Assert(grpc.ErrorDesc(err), Equals, "long polling timeout")
+	c.Assert(time.Since(begin) < time.Second, Equals, true)
+	c.Assert(consRes, IsNil)
+}
+
+// Messages with keys that do not start with the key filter prefix are
+// acknowledged and skipped.
+func (s *ServiceGRPCSuite) TestConsumeKeyFilterPrefix(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	group := fmt.Sprintf("g%d", rand.Int())
+	s.kh.ResetOffsets(group, "test.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var prodRess []*pb.ProdRes
+	for _, key := range []string{"foo1", "bar", "foo2"} {
+		prodReq := pb.ProdReq{
+			Topic:    "test.1",
+			KeyValue: []byte(key),
+			Message:  []byte(fmt.Sprintf("msg-%s", key)),
+		}
+		prodRes, err := s.clt.Produce(ctx, &prodReq, grpc.FailFast(false))
+		c.Assert(err, IsNil)
+		prodRess = append(prodRess, prodRes)
+	}
+
+	// When
+	consReq := pb.ConsReq{Topic: "test.1", Group: group, KeyFilter: []byte("ba"), KeyFilterPrefix: true}
+	consRes, err := s.clt.Consume(ctx, &consReq)
+	svc.Stop()
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(*consRes, DeepEquals, pb.ConsRes{
+		Topic:     "test.1",
+		Partition: prodRess[1].Partition,
+		Offset:    prodRess[1].Offset,
+		KeyValue:  []byte("bar"),
+		Message:   []byte("msg-bar"),
+	})
+	offsetsAfter := s.kh.GetCommittedOffsets(group, "test.1")
+	c.Assert(offsetsAfter[0].Val, Equals, prodRess[1].Offset+1)
+}
+
+// A message is consumed from whichever of the requested topics has one, and
+// the response tells what topic that is.
+func (s *ServiceGRPCSuite) TestConsumeTopics(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	group := fmt.Sprintf("g%d", rand.Int())
+	s.kh.ResetOffsets(group, "test.1")
+	s.kh.ResetOffsets(group, "test.4")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	prodReq := pb.ProdReq{Topic: "test.1", KeyValue: []byte("bar"), Message: []byte("msg-bar")}
+	prodRes, err := s.clt.Produce(ctx, &prodReq, grpc.FailFast(false))
+	c.Assert(err, IsNil)
+
+	// When
+	consReq := pb.ConsReq{Topics: []string{"test.4", "test.1"}, Group: group}
+	consRes, err := s.clt.Consume(ctx, &consReq)
+	svc.Stop()
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(*consRes, DeepEquals, pb.ConsRes{
+		Topic:     "test.1",
+		Partition: prodRes.Partition,
+		Offset:    prodRes.Offset,
+		KeyValue:  []byte("bar"),
+		Message:   []byte("msg-bar"),
+	})
+}
+
+func (s *ServiceGRPCSuite) TestConsumeTopicsInvalid(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		consReq pb.ConsReq
+		errMsg  string
+	}{
+		{consReq: pb.ConsReq{Topic: "test.1", Topics: []string{"test.4"}, Group: "foo"},
+			errMsg: "either topic or topics can be specified, not both"},
+		{consReq: pb.ConsReq{Topics: []string{"test.1", "test.4"}, Group: "foo", KeyFilter: []byte("B")},
+			errMsg: "key filter does not support several topics"},
+	} {
+		// When
+		_, err := s.clt.Consume(context.Background(), &tc.consReq)
+
+		// Then
+		c.Assert(grpc.Code(err), Equals, codes.InvalidArgument, Commentf("case #%d", i))
+		c.Assert(grpc.ErrorDesc(err), Equals, tc.errMsg, Commentf("case #%d", i))
+	}
+}
+
+// Messages consumed via a stream and acknowledged with the Ack call are
+// committed.
+func (s *ServiceGRPCSuite) TestConsumeStream(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+
+	s.kh.ResetOffsets("foo", "test.4")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var prodReqs []pb.ProdReq
+	var prodRess []*pb.ProdRes
+	for i := 0; i < 3; i++ {
+		prodReq := pb.ProdReq{
+			Topic:    "test.4",
+			KeyValue: []byte("bar"),
+			Message:  []byte(fmt.Sprintf("msg%d-%d", i, rand.Int())),
+		}
+		prodRes, err := s.clt.Produce(ctx, &prodReq, grpc.FailFast(false))
+		c.Assert(err, IsNil)
+		prodReqs = append(prodReqs, prodReq)
+		prodRess = append(prodRess, prodRes)
+	}
+
+	// When
+	stream, err := s.clt.ConsumeStream(ctx, &pb.ConsNReq{Topic: "test.4", Group: "foo"})
+	c.Assert(err, IsNil)
+	for i := 0; i < 3; i++ {
+		consRes, err := stream.Recv()
+		c.Assert(err, IsNil)
+		c.Assert(*consRes, DeepEquals, pb.ConsRes{
+			Topic:     "test.4",
+			Partition: prodRess[i].Partition,
+			Offset:    prodRess[i].Offset,
+			KeyValue:  prodReqs[i].KeyValue,
+			Message:   prodReqs[i].Message,
+		})
+		ackReq := pb.AckReq{Topic: "test.4", Group: "foo", Partition: consRes.Partition, Offset: consRes.Offset}
+		_, err = s.clt.Ack(ctx, &ackReq)
+		c.Assert(err, IsNil)
+	}
+	cancel()
+	svc.Stop()
+
+	// Then
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
+	c.Assert(offsetsAfter[prodRess[2].Partition].Val, Equals, prodRess[2].Offset+1)
+}
+
+// Acknowledging a partition that is not consumed via the proxy fails with
+// NotFound.
+func (s *ServiceGRPCSuite) TestAckNotConsumed(c *C) {
+	svc, err := Spawn(s.cfg)
+	defer svc.Stop()
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// When
+	ackReq := pb.AckReq{Topic: "test.4", Group: fmt.Sprintf("g%d", rand.Int()), Partition: 1, Offset: 100}
+	ackRes, err := s.clt.Ack(ctx, &ackReq, grpc.FailFast(false))
+
+	// Then
+	c.Assert(grpc.Code(err), Equals, codes.NotFound)
+	c.Assert(ackRes, IsNil)
+}
+
+// The service reports itself serving to standard gRPC health checks until it
+// starts draining.
+func (s *ServiceGRPCSuite) TestHealthCheck(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	healthClt := healthpb.NewHealthClient(s.cltConn)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// When
+	res, err := healthClt.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.FailFast(false))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(res.Status, Equals, healthpb.HealthCheckResponse_SERVING)
+
+	res, err = healthClt.Check(ctx, &healthpb.HealthCheckRequest{Service: "KafkaPixy"})
+	c.Assert(err, IsNil)
+	c.Assert(res.Status, Equals, healthpb.HealthCheckResponse_SERVING)
+
+	_, err = healthClt.Check(ctx, &healthpb.HealthCheckRequest{Service: "Foo"})
+	c.Assert(grpc.Code(err), Equals, codes.NotFound)
+
+	// When
+	svc.ProxySet().Drain()
+
+	// Then
+	res, err = healthClt.Check(ctx, &healthpb.HealthCheckRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(res.Status, Equals, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Offsets committed with `SetOffsets` are returned by `GetOffsets` along with
+// the partition boundaries.
+func (s *ServiceGRPCSuite) TestSetGetOffsets(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	group := fmt.Sprintf("g%d", rand.Int())
+
+	// When
+	setReq := pb.SetOffsetsReq{Topic: "test.4", Group: group}
+	for i := int32(0); i < 4; i++ {
+		setReq.Offsets = append(setReq.Offsets, &pb.PartitionOffset{
+			Partition: i, Offset: 1100 + int64(i), Metadata: fmt.Sprintf("A10%d", i)})
+	}
+	_, err = s.clt.SetOffsets(ctx, &setReq, grpc.FailFast(false))
+
+	// Then
+	c.Assert(err, IsNil)
+	getRes, err := s.clt.GetOffsets(ctx, &pb.GetOffsetsReq{Topic: "test.4", Group: group})
+	c.Assert(err, IsNil)
+	c.Assert(len(getRes.Offsets), Equals, 4)
+	for i, po := range getRes.Offsets {
+		c.Assert(po.Partition, Equals, int32(i))
+		c.Assert(po.Offset, Equals, 1100+int64(i))
+		c.Assert(po.Metadata, Equals, fmt.Sprintf("A10%d", i))
+		c.Assert(po.Count, Equals, po.End-po.Begin)
+	}
+}
+
+// Offsets of an unknown topic cannot be requested, and neither can offsets
+// without a group.
+func (s *ServiceGRPCSuite) TestGetOffsetsInvalid(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// When
+	_, err = s.clt.GetOffsets(ctx, &pb.GetOffsetsReq{Topic: "test.4"}, grpc.FailFast(false))
+
+	// Then
+	c.Assert(grpc.Code(err), Equals, codes.InvalidArgument)
+
+	_, err = s.clt.GetOffsets(ctx, &pb.GetOffsetsReq{Topic: "no-such-topic", Group: "foo"})
+	c.Assert(grpc.Code(err), Equals, codes.NotFound)
+}
+
+// Members of a group consuming from a topic are listed with the partitions
+// they have been assigned.
+func (s *ServiceGRPCSuite) TestListConsumers(c *C) {
+	s.kh.ResetOffsets("foo", "test.4")
+	s.kh.PutMessages("list.consumers", "test.4", map[string]int{"A": 1, "B": 1, "C": 1, "D": 1})
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < 4; i++ {
+		_, err := s.clt.Consume(ctx, &pb.ConsReq{Topic: "test.4", Group: "foo"}, grpc.FailFast(false))
+		c.Assert(err, IsNil)
+	}
+
+	// When
+	res, err := s.clt.ListConsumers(ctx, &pb.ListConsumersReq{Topic: "test.4", Group: "foo"})
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(*res, DeepEquals, pb.ListConsumersRes{Groups: []*pb.ConsumerGroup{{
+		Group:   "foo",
+		Members: []*pb.GroupMember{{MemberId: "test_svc", Partitions: []int32{0, 1, 2, 3}}},
+	}}})
+}
+
+// If API tokens are configured, then requests without a valid token are
+// rejected, but health checks are still served.
+func (s *ServiceGRPCSuite) TestAuthToken(c *C) {
+	s.cfg.GRPCAuth.Tokens = []string{"t0k3n"}
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	prodReq := pb.ProdReq{Topic: "test.4", Message: []byte("msg")}
+
+	// When
+	_, err = s.clt.Produce(ctx, &prodReq, grpc.FailFast(false))
+
+	// Then
+	c.Assert(grpc.Code(err), Equals, codes.Unauthenticated)
+	c.Assert(grpc.ErrorDesc(err), Equals, "token missing")
+
+	badCtx := metadata.NewContext(ctx, metadata.Pairs("authorization", "Bearer foo"))
+	_, err = s.clt.Produce(badCtx, &prodReq)
+	c.Assert(grpc.Code(err), Equals, codes.Unauthenticated)
+
+	goodCtx := metadata.NewContext(ctx, metadata.Pairs("authorization", "Bearer t0k3n"))
+	_, err = s.clt.Produce(goodCtx, &prodReq)
+	c.Assert(err, IsNil)
+
+	healthRes, err := healthpb.NewHealthClient(s.cltConn).Check(ctx, &healthpb.HealthCheckRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(healthRes.Status, Equals, healthpb.HealthCheckResponse_SERVING)
+}
@@ -8,10 +8,12 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +22,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/kafka-pixy/actor"
 	"github.com/mailgun/kafka-pixy/config"
+	"github.com/mailgun/kafka-pixy/consumer/offsetmgr"
 	"github.com/mailgun/kafka-pixy/server/httpsrv"
 	"github.com/mailgun/kafka-pixy/testhelpers"
 	"github.com/mailgun/kafka-pixy/testhelpers/kafkahelper"
@@ -71,6 +74,27 @@ func (s *ServiceHTTPSuite) TestStartAndStop(c *C) {
 	svc.Stop()
 }
 
+// A state dump lists running actors and partitions assigned to consumers.
+func (s *ServiceHTTPSuite) TestDumpState(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+	s.kh.PutMessages("dump", "test.4", map[string]int{"B": 1})
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
+	// When
+	var buf bytes.Buffer
+	svc.DumpState(&buf)
+
+	// Then
+	dump := buf.String()
+	c.Assert(strings.Contains(dump, "\n  /service[0]\n"), Equals, true, Commentf(dump))
+	c.Assert(strings.Contains(dump, "\n  proxy=pxyD, group=foo, topic=test.4, partitions=[0 1 2 3]\n"), Equals, true, Commentf(dump))
+	c.Assert(strings.Contains(dump, "\nin flight:\n"), Equals, true, Commentf(dump))
+}
+
 func (s *ServiceHTTPSuite) TestInvalidUnixAddr(c *C) {
 	// Given
 	s.cfg.UnixAddr = "/tmp"
@@ -97,6 +121,101 @@ func (s *ServiceHTTPSuite) TestInvalidKafkaPeers(c *C) {
 	c.Assert(svc, IsNil)
 }
 
+// If startup retry is enabled, then the service starts even if a proxy
+// cannot connect to Kafka, and the proxy is reported as not ready.
+func (s *ServiceHTTPSuite) TestStartupRetry(c *C) {
+	// Given
+	pxyCfg := s.cfg.Proxies[s.cfg.DefaultProxy]
+	pxyCfg.Kafka.SeedPeers = []string{"localhost:12345"}
+	pxyCfg.Startup.Retry = true
+
+	// When
+	svc, err := Spawn(s.cfg)
+
+	// Then
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+
+	r, err := s.unixClient.Get("http://_/ready")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusServiceUnavailable)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["ready"], Equals, false)
+	pxyStatus := body["proxies"].([]interface{})[0].(map[string]interface{})
+	c.Assert(pxyStatus["alias"], Equals, "pxyD")
+	c.Assert(pxyStatus["ready"], Equals, false)
+
+	r, err = s.unixClient.Post("http://_/topics/test.4/messages?sync",
+		"text/plain", strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusServiceUnavailable)
+	body = ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Matches, "proxy `pxyD` is not ready: .*")
+}
+
+// Readiness probes verify connectivity of every ready proxy to Kafka and
+// ZooKeeper, and report the result of each check.
+func (s *ServiceHTTPSuite) TestGetReadyz(c *C) {
+	svc, err := Spawn(s.cfg)
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/_readyz")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["ready"], Equals, true)
+	pxyStatus := body["proxies"].([]interface{})[0].(map[string]interface{})
+	c.Assert(pxyStatus["alias"], Equals, "pxyD")
+	c.Assert(pxyStatus["ready"], Equals, true)
+	c.Assert(pxyStatus["kafka"].(map[string]interface{})["ok"], Equals, true)
+	zkCheck := pxyStatus["zookeeper"].(map[string]interface{})
+	c.Assert(zkCheck["ok"], Equals, true)
+	c.Assert(zkCheck["state"], Equals, "StateHasSession")
+}
+
+// If one of several proxies fails to start, then the service starts with the
+// remaining proxies, and reports the failed one.
+func (s *ServiceHTTPSuite) TestPartialStartup(c *C) {
+	// Given
+	badCfg := testhelpers.NewTestProxyCfg("test_svc_bad")
+	badCfg.Kafka.SeedPeers = []string{"localhost:12345"}
+	s.cfg.Proxies["pxyBad"] = badCfg
+
+	// When
+	svc, err := Spawn(s.cfg)
+
+	// Then
+	c.Assert(err, IsNil)
+	defer svc.Stop()
+
+	r, err := s.unixClient.Get("http://_/ready")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["ready"], Equals, true)
+	c.Assert(body["degraded"], Equals, true)
+
+	r, err = s.unixClient.Get("http://_/proxies")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	proxies := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(proxies), Equals, 2)
+	c.Assert(proxies[0].(map[string]interface{})["alias"], Equals, "pxyBad")
+	c.Assert(proxies[0].(map[string]interface{})["ready"], Equals, false)
+	c.Assert(proxies[1], DeepEquals, map[string]interface{}{"alias": "pxyD", "default": true, "ready": true})
+
+	r, err = s.unixClient.Get("http://_/proxies/pxyBad/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusServiceUnavailable)
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+}
+
 // If `key` is not `nil` then produced messages are deterministically
 // distributed between partitions based on the `key` hash.
 func (s *ServiceHTTPSuite) TestProduce(c *C) {
@@ -173,6 +292,59 @@ func (s *ServiceHTTPSuite) TestProduceEmptyKey(c *C) {
 	c.Assert(offsetsAfter[3], Equals, offsetsBefore[3]+10)
 }
 
+// A tombstone is produced as a message with a null value, and it is consumed
+// as such, unlike a message with an empty body.
+func (s *ServiceHTTPSuite) TestProduceTombstone(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.1")
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r1, err := s.unixClient.Post("http://_/topics/test.1/messages?key=bar&sync&tombstone",
+		"text/plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(r1.StatusCode, Equals, http.StatusOK)
+	r2, err := s.unixClient.Post("http://_/topics/test.1/messages?key=bar&sync",
+		"text/plain", strings.NewReader(""))
+	c.Assert(err, IsNil)
+	c.Assert(r2.StatusCode, Equals, http.StatusOK)
+
+	// Then
+	r, err := s.unixClient.Get("http://_/topics/test.1/messages?group=foo")
+	c.Assert(err, IsNil)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["value"], IsNil)
+	r, err = s.unixClient.Get("http://_/topics/test.1/messages?group=foo")
+	c.Assert(err, IsNil)
+	body = ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["value"], Equals, "")
+}
+
+func (s *ServiceHTTPSuite) TestProduceTombstoneInvalid(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		url   string
+		body  string
+		error string
+	}{
+		/* 0 */ {"http://_/topics/test.1/messages?tombstone", "", "Tombstone requires a key"},
+		/* 1 */ {"http://_/topics/test.1/messages?key=foo&tombstone", "bar", "Tombstone must not have a body"},
+	} {
+		// When
+		r, err := s.unixClient.Post(tc.url, "text/plain", strings.NewReader(tc.body))
+
+		// Then
+		c.Assert(err, IsNil)
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
 // Utf8 messages are submitted without a problem.
 func (s *ServiceHTTPSuite) TestUtf8Message(c *C) {
 	svc, _ := Spawn(s.cfg)
@@ -229,219 +401,1559 @@ func (s *ServiceHTTPSuite) TestStoppedServerCall(c *C) {
 	c.Assert(r, IsNil)
 }
 
-// Messages that have maximum possible size indeed go through. Note that we
-// assume that the broker's limit is the same as the producer's one or higher.
-func (s *ServiceHTTPSuite) TestLargestMessage(c *C) {
-	offsetsBefore := s.kh.GetNewestOffsets("test.4")
-	maxMsgSize := sarama.NewConfig().Producer.MaxMessageBytes - ProdMsgMetadataSize([]byte("foo"))
-	msg := GenMessage(maxMsgSize)
-	s.cfg.TCPAddr = "127.0.0.1:55501"
+// Messages that have maximum possible size indeed go through. Note that we
+// assume that the broker's limit is the same as the producer's one or higher.
+func (s *ServiceHTTPSuite) TestLargestMessage(c *C) {
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+	maxMsgSize := sarama.NewConfig().Producer.MaxMessageBytes - ProdMsgMetadataSize([]byte("foo"))
+	msg := GenMessage(maxMsgSize)
+	s.cfg.TCPAddr = "127.0.0.1:55501"
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r := PostChunked(s.tcpClient, "http://127.0.0.1:55501/topics/test.4/messages?key=foo", msg)
+	svc.Stop() // Have to stop before getOffsets
+
+	// Then
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{})
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+	messages := s.kh.GetMessages("test.4", offsetsBefore, offsetsAfter)
+	readMsg := messages[1][0]
+	c.Assert(readMsg, Equals, msg)
+}
+
+// Messages that are larger then producer's MaxMessageBytes size are silently
+// dropped. Note that we assume that the broker's limit is the same as the
+// producer's one or higher.
+func (s *ServiceHTTPSuite) TestMessageTooLarge(c *C) {
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+	maxMsgSize := sarama.NewConfig().Producer.MaxMessageBytes - ProdMsgMetadataSize([]byte("foo")) + 1
+	msg := GenMessage(maxMsgSize)
+	s.cfg.TCPAddr = "127.0.0.1:55501"
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r := PostChunked(s.tcpClient, "http://127.0.0.1:55501/topics/test.4/messages?key=foo", msg)
+	svc.Stop() // Have to stop before getOffsets
+
+	// Then
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{})
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+	c.Assert(offsetsAfter, DeepEquals, offsetsBefore)
+}
+
+func (s *ServiceHTTPSuite) TestSyncProduce(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/messages?key=1&sync",
+		"text/plain", strings.NewReader("Foo"))
+	svc.Stop() // Have to stop before getOffsets
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(int(body["partition"].(float64)), Equals, 0)
+	c.Assert(int64(body["offset"].(float64)), Equals, offsetsBefore[0])
+	c.Assert(offsetsAfter[0], Equals, offsetsBefore[0]+1)
+}
+
+// The partition parameter overrides key based partitioning.
+func (s *ServiceHTTPSuite) TestSyncProduceToPartition(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/messages?key=1&partition=2&sync",
+		"text/plain", strings.NewReader("Foo"))
+	svc.Stop() // Have to stop before getOffsets
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(int(body["partition"].(float64)), Equals, 2)
+	c.Assert(int64(body["offset"].(float64)), Equals, offsetsBefore[2])
+	c.Assert(offsetsAfter[2], Equals, offsetsBefore[2]+1)
+}
+
+func (s *ServiceHTTPSuite) TestSyncProduceToPartitionInvalid(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		partition string
+		error     string
+	}{{
+		partition: "foo",
+		error:     "Invalid partition: foo",
+	}, {
+		partition: "-1",
+		error:     "Invalid partition: -1",
+	}, {
+		partition: "4",
+		error:     sarama.ErrInvalidPartition.Error(),
+	}} {
+		// When
+		r, err := s.unixClient.Post("http://_/topics/test.4/messages?sync&partition="+tc.partition,
+			"text/plain", strings.NewReader("Foo"))
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
+func (s *ServiceHTTPSuite) TestSyncProduceInvalidTopic(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/no-such-topic/messages?sync=true",
+		"text/plain", strings.NewReader("Foo"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, sarama.ErrUnknownTopicOrPartition.Error())
+}
+
+// A batch of messages is produced in one request, and the partition and offset
+// of every message is returned in the order of the batch.
+func (s *ServiceHTTPSuite) TestSyncProduceBatch(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+	batch := `[
+		{"key": "MQ==", "value": "Rm9v"},
+		{"key": "MQ==", "value": "QmFy"},
+		{"key": "MQ==", "value": "QmF6eg=="}
+	]`
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/messages/batch?sync",
+		"application/json", strings.NewReader(batch))
+	svc.Stop() // Have to stop before getOffsets
+	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 3)
+	for i, res := range body {
+		res := res.(map[string]interface{})
+		c.Assert(int(res["partition"].(float64)), Equals, 0)
+		c.Assert(int64(res["offset"].(float64)), Equals, offsetsBefore[0]+int64(i))
+	}
+	c.Assert(offsetsAfter[0], Equals, offsetsBefore[0]+3)
+}
+
+func (s *ServiceHTTPSuite) TestProduceBatchInvalid(c *C) {
+	// Given
+	s.cfg.Proxies[s.cfg.DefaultProxy].Producer.MaxBatchSize = 2
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		batch  string
+		status int
+		error  string
+	}{{
+		batch:  `{"value": "Rm9v"}`,
+		status: http.StatusBadRequest,
+		error:  "Invalid batch: json: cannot unmarshal object into Go value of type []httpsrv.produceBatchHTTPRecord",
+	}, {
+		batch:  `[]`,
+		status: http.StatusBadRequest,
+		error:  "Empty batch",
+	}, {
+		batch:  `[{"value": "Rm9v"}, {"key": "MQ=="}, {}]`,
+		status: http.StatusBadRequest,
+		error:  "Record 2: tombstone requires a key",
+	}, {
+		batch:  `[{"value": "Rm9v", "headers": [{"key": "foo", "value": "YmFy"}]}]`,
+		status: http.StatusBadRequest,
+		error:  "Record 0: message headers are not supported",
+	}, {
+		batch:  `[{"value": "Rm9v"}, {"value": "QmFy"}, {"value": "QmF6eg=="}]`,
+		status: http.StatusBadRequest,
+		error:  "batch too large: max=2",
+	}} {
+		// When
+		r, err := s.unixClient.Post("http://_/topics/test.4/messages/batch",
+			"application/json", strings.NewReader(tc.batch))
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, tc.status, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
+func (s *ServiceHTTPSuite) TestConsumeNoGroup(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "one consumer group is expected, but 0 provided")
+}
+
+func (s *ServiceHTTPSuite) TestConsumeDuplicateGroups(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=a&group=b&group=a")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "consumer group a provided more than once")
+}
+
+// If several groups are specified, then a message of the group that has one
+// is returned, and the group is reported in the response.
+func (s *ServiceHTTPSuite) TestConsumeManyGroups(c *C) {
+	// Given
+	s.kh.ResetOffsets("bar", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	s.kh.ResetOffsets("foo", "test.4")
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&group=bar")
+	svc.Stop()
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["group"], Equals, "bar")
+	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "B")
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
+
+	offsetsAfter := s.kh.GetCommittedOffsets("bar", "test.4")
+	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][0].Offset+1)
+}
+
+// A client of the version 2 API can have message values returned raw in the
+// response body, and the rest of the message in headers.
+func (s *ServiceHTTPSuite) TestConsumeV2Raw(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+	req, err := http.NewRequest("GET", "http://_/v2/topics/test.4/messages?group=foo", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Accept", "application/octet-stream")
+
+	// When
+	r, err := s.unixClient.Do(req)
+	svc.Stop()
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.Header.Get("Content-Type"), Equals, "application/octet-stream")
+	c.Assert(r.Header.Get("X-Kafka-Pixy-Group"), Equals, "foo")
+	c.Assert(ParseBase64(c, r.Header.Get("X-Kafka-Pixy-Key")), Equals, "B")
+	c.Assert(r.Header.Get("X-Kafka-Pixy-Offset"), Equals, strconv.FormatInt(produced["B"][0].Offset, 10))
+	body, err := ioutil.ReadAll(r.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "service.consume:B:0")
+}
+
+// In the raw format a binary key is passed in a header and a binary value in
+// the body, and both are consumed as is.
+func (s *ServiceHTTPSuite) TestProduceConsumeRaw(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.1")
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	req, err := http.NewRequest("POST", "http://_/topics/test.1/messages?format=raw&sync",
+		bytes.NewReader([]byte{0, 0xFF, 1}))
+	c.Assert(err, IsNil)
+	req.Header.Set("X-Kafka-Pixy-Key", base64.StdEncoding.EncodeToString([]byte{0xFE, 0}))
+
+	// When
+	r, err := s.unixClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	r, err = s.unixClient.Get("http://_/topics/test.1/messages?group=foo&format=raw")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.Header.Get("X-Kafka-Pixy-Key"), Equals, base64.StdEncoding.EncodeToString([]byte{0xFE, 0}))
+	body, err := ioutil.ReadAll(r.Body)
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, []byte{0, 0xFF, 1})
+}
+
+// Metadata attached to an ack is committed along with the offset.
+func (s *ServiceHTTPSuite) TestConsumeAckMetadata(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&ackMetadata=txn:42")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	svc.Stop()
+
+	// Then
+	svc, _ = Spawn(s.cfg)
+	defer svc.Stop()
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(body[3].(map[string]interface{})["ack_metadata"], Equals, "txn:42")
+}
+
+// Heartbeats keep the proxy subscribed to a topic that is not consumed.
+func (s *ServiceHTTPSuite) TestHeartbeat(c *C) {
+	// Given
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout = 100 * time.Millisecond
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.AckTimeout = 200 * time.Millisecond
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.RegistrationTimeout = 500 * time.Millisecond
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
+	c.Assert(err, IsNil)
+
+	// When
+	for i := 0; i < 5; i++ {
+		time.Sleep(300 * time.Millisecond)
+		r, err = s.unixClient.Post("http://_/groups/foo/heartbeat?topic=test.4", "text/plain", nil)
+		c.Assert(err, IsNil)
+		c.Assert(r.StatusCode, Equals, http.StatusOK, Commentf("heartbeat #%d", i))
+	}
+
+	// Then
+	r, err = s.unixClient.Get("http://_/topics/test.4/consumers?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(len(ParseJSONBody(c, r).(map[string]interface{})), Equals, 1)
+}
+
+// A consume request can keep the proxy subscribed to a topic for longer than
+// the registration timeout.
+func (s *ServiceHTTPSuite) TestConsumeSubscriptionTTL(c *C) {
+	// Given
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout = 100 * time.Millisecond
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.AckTimeout = 200 * time.Millisecond
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.RegistrationTimeout = 500 * time.Millisecond
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&subscription_ttl=3s")
+	c.Assert(err, IsNil)
+	time.Sleep(1500 * time.Millisecond)
+
+	// Then
+	r, err = s.unixClient.Post("http://_/groups/foo/heartbeat?topic=test.4", "text/plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+}
+
+func (s *ServiceHTTPSuite) TestConsumeInvalidSubscriptionTTL(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		query  string
+		errMsg string
+	}{
+		{query: "subscription_ttl=foo", errMsg: "Invalid subscription_ttl: foo"},
+		{query: "subscription_ttl=0s", errMsg: "Invalid subscription_ttl: 0s"},
+		{query: "subscription_ttl=1s&timeout=2s", errMsg: "subscription TTL must be > long polling timeout: timeout=2s"},
+	} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&" + tc.query)
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.errMsg, Commentf("case #%d", i))
+	}
+}
+
+// A heartbeat does not subscribe to a topic that is not consumed.
+func (s *ServiceHTTPSuite) TestHeartbeatNotConsumed(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/groups/foo/heartbeat?topic=test.4", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "topic is not consumed via the proxy on behalf of the group")
+}
+
+// A batch consume request returns readily available messages in one response
+// and acknowledges all of them.
+func (s *ServiceHTTPSuite) TestConsumeBatch(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 3})
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	var consumed []interface{}
+	for i := 0; i < 3 && len(consumed) < 3; i++ {
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&batch=10")
+		c.Assert(err, IsNil)
+		c.Assert(r.StatusCode, Equals, http.StatusOK)
+		consumed = append(consumed, ParseJSONBody(c, r).([]interface{})...)
+	}
+	svc.Stop()
+
+	// Then
+	c.Assert(len(consumed), Equals, 3)
+	for i, msg := range consumed {
+		msg := msg.(map[string]interface{})
+		c.Assert(ParseBase64(c, msg["key"].(string)), Equals, "B")
+		c.Assert(int(msg["partition"].(float64)), Equals, 3)
+		c.Assert(int64(msg["offset"].(float64)), Equals, produced["B"][i].Offset)
+	}
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
+	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][2].Offset+1)
+}
+
+// A message consumed in the explicit ack mode is not committed until it is
+// acknowledged with an ack request.
+func (s *ServiceHTTPSuite) TestConsumeNoAutoAck(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	offsetsBefore := s.kh.GetCommittedOffsets("foo", "test.4")
+	svc, _ := Spawn(s.cfg)
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&noAutoAck")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
+	time.Sleep(3 * s.cfg.Proxies["pxyD"].Consumer.OffsetsCommitInterval)
+	c.Assert(s.kh.GetCommittedOffsets("foo", "test.4")[3].Val, Equals, offsetsBefore[3].Val)
+
+	// When
+	r, err = s.unixClient.Post(fmt.Sprintf("http://_/topics/test.4/messages/ack?group=foo&partition=3&offset=%d",
+		produced["B"][0].Offset), "text/plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	svc.Stop()
+
+	// Then
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
+	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][0].Offset+1)
+}
+
+// All messages consumed in the explicit ack mode at or below the given offset
+// are acknowledged with one request, while those above it are not.
+func (s *ServiceHTTPSuite) TestAckUpTo(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 3})
+	svc, _ := Spawn(s.cfg)
+	for i := 0; i < 3; i++ {
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&noAutoAck")
+		c.Assert(err, IsNil)
+		c.Assert(r.StatusCode, Equals, http.StatusOK)
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][i].Offset)
+	}
+
+	// When
+	r, err := s.unixClient.Post(fmt.Sprintf("http://_/topics/test.4/acks/upto?group=foo&partition=3&offset=%d",
+		produced["B"][1].Offset), "text/plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	svc.Stop()
+
+	// Then
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
+	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][1].Offset+1)
+}
+
+// An ack of a partition that has not been consumed via the proxy is rejected.
+func (s *ServiceHTTPSuite) TestAckNotConsumed(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/messages/ack?group=foo&partition=3&offset=1", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "partition is not consumed via the proxy")
+}
+
+func (s *ServiceHTTPSuite) TestAckInvalidOffset(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/messages/ack?group=foo&partition=3&offset=bar", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Invalid offset: bar")
+}
+
+func (s *ServiceHTTPSuite) TestConsumeBatchInvalid(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&batch=0")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Invalid batch: 0")
+}
+
+// Messages with keys that do not match the key filter are acknowledged and
+// skipped.
+func (s *ServiceHTTPSuite) TestConsumeKeyFilter(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.1")
+	s.kh.PutMessages("service.consume", "test.1", map[string]int{"A": 2})
+	produced := s.kh.PutMessages("service.consume", "test.1", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.1/messages?group=foo&key_filter=B")
+	c.Assert(err, IsNil)
+	svc.Stop()
+
+	// Then
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "B")
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.1")
+	c.Assert(offsetsAfter[0].Val, Equals, produced["B"][0].Offset+1)
+}
+
+func (s *ServiceHTTPSuite) TestConsumeKeyFilterInvalid(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		query  string
+		errMsg string
+	}{
+		{query: "group=foo&key_filter_prefix", errMsg: "key_filter_prefix requires key_filter"},
+		{query: "group=foo&key_filter=B&key_filter_prefix=bar", errMsg: "Invalid key_filter_prefix: bar"},
+		{query: "group=foo&group=bar&key_filter=B", errMsg: "Key filter requires one consumer group"},
+		{query: "group=foo&key_filter=B&batch=10", errMsg: "Batch consume does not support key filter"},
+	} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?" + tc.query)
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.errMsg, Commentf("case #%d", i))
+	}
+}
+
+// A consume request with a topic pattern gets a message from a matching topic,
+// and the topic is reported in the response.
+func (s *ServiceHTTPSuite) TestConsumePattern(c *C) {
+	// Given
+	group := fmt.Sprintf("g%d", rand.Int())
+	s.kh.ResetOffsets(group, "test.1")
+	s.kh.ResetOffsets(group, "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.1", map[string]int{"A": 1})
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test%5C.%5B14%5D/messages?pattern&group=" + group)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["topic"], Equals, "test.1")
+	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "A")
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["A"][0].Offset)
+}
+
+func (s *ServiceHTTPSuite) TestConsumePatternInvalid(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		query  string
+		errMsg string
+	}{
+		{query: "group=foo&group=bar", errMsg: "Topic pattern requires one consumer group"},
+		{query: "group=foo&batch=10", errMsg: "Batch consume does not support topic pattern"},
+		{query: "group=foo&key_filter=B", errMsg: "Key filter does not support topic pattern"},
+	} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.*/messages?pattern&" + tc.query)
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.errMsg, Commentf("case #%d", i))
+	}
+}
+
+// A message is consumed from whichever of the requested topics has one.
+func (s *ServiceHTTPSuite) TestConsumeTopics(c *C) {
+	// Given
+	group := fmt.Sprintf("g%d", rand.Int())
+	s.kh.ResetOffsets(group, "test.1")
+	s.kh.ResetOffsets(group, "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get(fmt.Sprintf("http://_/groups/%s/messages?topic=test.1&topic=test.4", group))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["topic"], Equals, "test.4")
+	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "B")
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
+}
+
+func (s *ServiceHTTPSuite) TestConsumeTopicsNoTopic(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/groups/foo/messages")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "At least one topic is expected")
+}
+
+func (s *ServiceHTTPSuite) TestConsumeAckMetadataTooLong(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&ackMetadata=" + strings.Repeat("x", 1025))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Ack metadata too long: max=1024")
+}
+
+// The offset coordinator of a consumed group is reported by the admin API.
+func (s *ServiceHTTPSuite) TestCoordinators(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	s.kh.PutMessages("service.coordinators", "test.4", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
+	// When
+	r, err = s.unixClient.Get("http://_/admin/coordinators")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 1)
+	coord := body[0].(map[string]interface{})
+	c.Assert(coord["group"], Equals, "foo")
+	c.Assert(coord["broker_addr"], Not(Equals), "")
+}
+
+// A message produced with a trace header can be followed through the proxy.
+func (s *ServiceHTTPSuite) TestTrace(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.1")
+	s.cfg.Proxies["pxyD"].Tracing.Enabled = true
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	req, err := http.NewRequest("POST", "http://_/topics/test.1/messages?sync", strings.NewReader("Foo"))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Kafka-Pixy-Trace-Id", "bazz")
+	r, err := s.unixClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	prodRes := ParseJSONBody(c, r).(map[string]interface{})
+	r, err = s.unixClient.Get("http://_/topics/test.1/messages?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	time.Sleep(3 * s.cfg.Proxies["pxyD"].Consumer.OffsetsCommitInterval)
+
+	// When
+	r, err = s.unixClient.Get("http://_/traces/bazz")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	trace := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(trace["topic"], Equals, "test.1")
+	c.Assert(trace["offset"], Equals, prodRes["offset"])
+	var eventNames []string
+	for _, event := range trace["events"].([]interface{}) {
+		eventNames = append(eventNames, event.(map[string]interface{})["name"].(string))
+	}
+	c.Assert(eventNames, DeepEquals, []string{"received", "produced", "fetched", "offered", "acked", "committed"})
+}
+
+func (s *ServiceHTTPSuite) TestTraceDisabled(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/traces/bazz")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "message tracing is disabled")
+}
+
+func (s *ServiceHTTPSuite) TestConsumeInvalidTopic(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/no-such-topic/messages?group=foo")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusRequestTimeout)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "long polling timeout")
+}
+
+// If a consume request specifies a timeout, then it is used instead of the
+// configured long polling timeout.
+func (s *ServiceHTTPSuite) TestConsumeTimeoutParam(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	begin := time.Now()
+	r, err := s.unixClient.Get("http://_/topics/no-such-topic/messages?group=foo&timeout=500ms")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusRequestTimeout)
+	c.Assert(time.Since(begin) < s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout, Equals, true)
+}
+
+func (s *ServiceHTTPSuite) TestConsumeInvalidTimeout(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, timeout := range []string{"foo", "-1s", "0s"} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&timeout=" + timeout)
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, "Invalid timeout: "+timeout, Commentf("case #%d", i))
+	}
+}
+
+// The wait parameter is an alias of the timeout parameter.
+func (s *ServiceHTTPSuite) TestConsumeWaitParam(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	begin := time.Now()
+	r, err := s.unixClient.Get("http://_/topics/no-such-topic/messages?group=foo&wait=500ms")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusRequestTimeout)
+	c.Assert(time.Since(begin) < s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout, Equals, true)
+}
+
+func (s *ServiceHTTPSuite) TestConsumeInvalidWait(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	for i, tc := range []struct {
+		query  string
+		errMsg string
+	}{
+		/* 0 */ {query: "wait=foo", errMsg: "Invalid wait: foo"},
+		/* 1 */ {query: "wait=0s", errMsg: "Invalid wait: 0s"},
+		/* 2 */ {query: "wait=1s&timeout=1s", errMsg: "Either timeout or wait can be specified, not both"},
+	} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo&" + tc.query)
+
+		// Then
+		c.Assert(err, IsNil, Commentf("case #%d", i))
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.errMsg, Commentf("case #%d", i))
+	}
+}
+
+func (s *ServiceHTTPSuite) TestConsumeSingleMessage(c *C) {
+	// Given
+	s.kh.ResetOffsets("foo", "test.4")
+	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
+	svc, _ := Spawn(s.cfg)
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
+	svc.Stop()
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "B")
+	c.Assert(ParseBase64(c, body["value"].(string)), Equals, ProdMsgVal(produced["B"][0]))
+	c.Assert(int(body["partition"].(float64)), Equals, 3)
+	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
+
+	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
+	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][0].Offset+1)
+}
+
+// If offsets for a group that does not exist are requested then -1 is returned
+// as the next offset to be consumed for all topic partitions.
+func (s *ServiceHTTPSuite) TestGetOffsetsNoSuchGroup(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/offsets?group=no_such_group")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	for i := 0; i < 4; i++ {
+		partitionView := body[i].(map[string]interface{})
+		c.Assert(partitionView["partition"].(float64), Equals, float64(i))
+		c.Assert(partitionView["offset"].(float64), Equals, float64(-1))
+	}
+}
+
+// An attempt to retrieve offsets for a topic that does not exist fails with 404.
+func (s *ServiceHTTPSuite) TestGetOffsetsNoSuchTopic(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/no_such_topic/offsets?group=foo")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Unknown topic")
+}
+
+// Without details topics are listed by name.
+func (s *ServiceHTTPSuite) TestGetTopics(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	topics := make(map[string]bool)
+	for _, topic := range ParseJSONBody(c, r).([]interface{}) {
+		topics[topic.(string)] = true
+	}
+	c.Assert(topics["test.4"], Equals, true)
+	c.Assert(topics["test.64"], Equals, true)
+}
+
+// Partition counts and configs are included if requested.
+func (s *ServiceHTTPSuite) TestGetTopicsWithDetails(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics?withPartitions=true&withConfig")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	topic := body["test.4"].(map[string]interface{})
+	c.Assert(topic["partitions"], Equals, float64(4))
+	_, ok := topic["config"].(map[string]interface{})
+	c.Assert(ok, Equals, true)
+}
+
+func (s *ServiceHTTPSuite) TestGetTopicsInvalidFlag(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics?withPartitions=foo")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Invalid withPartitions: foo")
+}
+
+// Committed offsets are returned in a following GET request.
+func (s *ServiceHTTPSuite) TestSetOffsets(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=foo",
+		"application/json", strings.NewReader(
+			`[{"partition": 0, "offset": 1100, "metadata": "A100"},
+			  {"partition": 1, "offset": 1101, "metadata": "A101"},
+			  {"partition": 2, "offset": 1102, "metadata": "A102"},
+			  {"partition": 3, "offset": 1103, "metadata": "A103"}]`))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, httpsrv.EmptyResponse)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	body := ParseJSONBody(c, r).([]interface{})
+	for i := 0; i < 4; i++ {
+		partitionView := body[i].(map[string]interface{})
+		c.Assert(partitionView["partition"].(float64), Equals, float64(i))
+		c.Assert(partitionView["offset"].(float64), Equals, float64(1100+i))
+		c.Assert(partitionView["metadata"].(string), Equals, fmt.Sprintf("A10%d", i))
+		c.Assert(partitionView["count"], Equals, partitionView["end"].(float64)-partitionView["begin"].(float64))
+	}
+}
+
+// A group rewound to time before all messages in a topic gets the oldest
+// offsets committed.
+func (s *ServiceHTTPSuite) TestSetOffsetsByTimestamp(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=rewind&timestamp=1970-01-02T00:00:00Z",
+		"application/json", strings.NewReader(""))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 4)
+	for i := 0; i < 4; i++ {
+		partitionView := body[i].(map[string]interface{})
+		c.Assert(partitionView["partition"].(float64), Equals, float64(i))
+		c.Assert(partitionView["offset"], Equals, partitionView["begin"])
+	}
+
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=rewind")
+	c.Assert(err, IsNil)
+	committed := ParseJSONBody(c, r).([]interface{})
+	for i := 0; i < 4; i++ {
+		partitionView := committed[i].(map[string]interface{})
+		c.Assert(partitionView["offset"], Equals, partitionView["begin"])
+	}
+}
+
+func (s *ServiceHTTPSuite) TestSetOffsetsInvalidTimestamp(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=rewind&timestamp=yesterday",
+		"application/json", strings.NewReader(""))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Invalid timestamp: yesterday")
+}
+
+// Lag is reported per partition and summed up per topic and for the group.
+func (s *ServiceHTTPSuite) TestGetGroupLag(c *C) {
+	// Given
+	newest := s.kh.GetNewestOffsets("test.4")
+	var offsets []string
+	for i, offset := range newest {
+		offsets = append(offsets, fmt.Sprintf(`{"partition": %d, "offset": %d}`, i, offset-int64(i)))
+	}
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=lag_summary",
+		"application/json", strings.NewReader("["+strings.Join(offsets, ",")+"]"))
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
+	// When
+	r, err = s.unixClient.Get("http://_/groups/lag_summary/lag")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{
+		"total_lag": float64(6),
+		"topics": map[string]interface{}{
+			"test.4": map[string]interface{}{
+				"total_lag": float64(6),
+				"partitions": []interface{}{
+					map[string]interface{}{"partition": float64(0), "lag": float64(0)},
+					map[string]interface{}{"partition": float64(1), "lag": float64(1)},
+					map[string]interface{}{"partition": float64(2), "lag": float64(2)},
+					map[string]interface{}{"partition": float64(3), "lag": float64(3)},
+				},
+			},
+		},
+	})
+}
+
+// Rebalancings of a group are recorded with partitions assigned to the proxy.
+func (s *ServiceHTTPSuite) TestGetGroupRebalances(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=rebalances&timeout=1s")
+	c.Assert(err, IsNil)
+
+	// When
+	r, err = s.unixClient.Get("http://_/groups/rebalances/rebalances")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 1)
+	rebalance := body[0].(map[string]interface{})
+	c.Assert(rebalance["trigger"], Equals, "membership")
+	c.Assert(rebalance["members_before"], DeepEquals, []interface{}{})
+	c.Assert(rebalance["members_after"], DeepEquals, []interface{}{"test_svc"})
+	c.Assert(rebalance["assigned"], DeepEquals, map[string]interface{}{
+		"test.4": []interface{}{float64(0), float64(1), float64(2), float64(3)},
+	})
+	c.Assert(rebalance["revoked"], DeepEquals, map[string]interface{}{})
+}
+
+// A requested rebalancing is recorded with the `requested` trigger.
+func (s *ServiceHTTPSuite) TestRebalanceGroup(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=rebalance&timeout=1s")
+	c.Assert(err, IsNil)
+
+	// When
+	r, err = s.unixClient.Post("http://_/groups/rebalance/rebalance", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusAccepted)
+	var rebalances []interface{}
+	for i := 0; i < 20 && len(rebalances) < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+		r, err = s.unixClient.Get("http://_/groups/rebalance/rebalances")
+		c.Assert(err, IsNil)
+		rebalances = ParseJSONBody(c, r).([]interface{})
+	}
+	c.Assert(len(rebalances), Equals, 2)
+	rebalance := rebalances[1].(map[string]interface{})
+	c.Assert(rebalance["trigger"], Equals, "requested")
+	c.Assert(rebalance["assigned"], DeepEquals, map[string]interface{}{})
+	c.Assert(rebalance["revoked"], DeepEquals, map[string]interface{}{})
+}
+
+// A group that is not consumed via the proxy cannot be rebalanced.
+func (s *ServiceHTTPSuite) TestRebalanceGroupNotConsumed(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Post("http://_/groups/unknown/rebalance", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "group is not consumed via the proxy")
+}
+
+// When a member of a group consumed via the proxy is evicted, its partition
+// claims are released, and it registers again.
+func (s *ServiceHTTPSuite) TestEvictGroupMember(c *C) {
+	// Given
+	s.cfg.Proxies["pxyD"].Consumer.BackOffTimeout = 100 * time.Millisecond
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=evict&timeout=1s")
+	c.Assert(err, IsNil)
+
+	// When
+	r, err = s.unixClient.Do(newDeleteRequest(c, "http://_/groups/evict/members/test_svc"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{
+		"released": map[string]interface{}{
+			"test.4": []interface{}{float64(0), float64(1), float64(2), float64(3)},
+		},
+	})
+	claimed := map[string]interface{}{
+		"test_svc": []interface{}{float64(0), float64(1), float64(2), float64(3)},
+	}
+	var consumers interface{}
+	for i := 0; i < 30 && !reflect.DeepEqual(consumers, claimed); i++ {
+		time.Sleep(100 * time.Millisecond)
+		r, err = s.unixClient.Get("http://_/topics/test.4/consumers?group=evict")
+		c.Assert(err, IsNil)
+		consumers = ParseJSONBody(c, r).(map[string]interface{})["evict"]
+	}
+	c.Assert(consumers, DeepEquals, claimed)
+}
+
+// Evicting a member that is not known is reported as not found.
+func (s *ServiceHTTPSuite) TestEvictGroupMemberUnknown(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Do(newDeleteRequest(c, "http://_/groups/unknown/members/foo"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "either group or member is incorrect")
+}
+
+// Messages can be read from the offset committed by a group without consuming
+// them, and the committed offset stays intact.
+func (s *ServiceHTTPSuite) TestReadCommittedMessages(c *C) {
+	// Given
+	produced := s.kh.PutMessages("read_committed", "test.4", map[string]int{"A": 3})
+	partition := produced["A"][0].Partition
+	offset := produced["A"][1].Offset
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=read_committed",
+		"application/json", strings.NewReader(fmt.Sprintf(`[{"partition": %d, "offset": %d}]`, partition, offset)))
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
+	// When
+	r, err = s.unixClient.Get(fmt.Sprintf(
+		"http://_/topics/test.4/partitions/%d/messages?group=read_committed&committed=true&count=2", partition))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 2)
+	for i, msg := range body {
+		c.Assert(msg.(map[string]interface{})["offset"], Equals, float64(offset+int64(i)))
+		c.Assert(msg.(map[string]interface{})["value"], Equals, base64.StdEncoding.EncodeToString([]byte(produced["A"][i+1].Value.(sarama.StringEncoder))))
+	}
+	offsetsAfter := s.kh.GetCommittedOffsets("read_committed", "test.4")
+	c.Assert(offsetsAfter[partition].Val, Equals, offset)
+}
+
+// If a group has not committed an offset, then messages are read from the
+// configured initial offset.
+func (s *ServiceHTTPSuite) TestReadCommittedMessagesInitialOffset(c *C) {
+	// Given
+	s.kh.PutMessages("read_committed", "test.1", map[string]int{"A": 1})
+	oldestOffsets := s.kh.GetOldestOffsets("test.1")
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.InitialOffset = config.InitialOffsetOldest
 	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
 
 	// When
-	r := PostChunked(s.tcpClient, "http://127.0.0.1:55501/topics/test.4/messages?key=foo", msg)
-	svc.Stop() // Have to stop before getOffsets
+	r, err := s.unixClient.Get("http://_/topics/test.1/partitions/0/messages?group=read_uncommitted&committed=true&count=1")
 
 	// Then
+	c.Assert(err, IsNil)
 	c.Assert(r.StatusCode, Equals, http.StatusOK)
-	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{})
-	offsetsAfter := s.kh.GetNewestOffsets("test.4")
-	messages := s.kh.GetMessages("test.4", offsetsBefore, offsetsAfter)
-	readMsg := messages[1][0]
-	c.Assert(readMsg, Equals, msg)
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 1)
+	c.Assert(body[0].(map[string]interface{})["offset"], Equals, float64(oldestOffsets[0]))
 }
 
-// Messages that are larger then producer's MaxMessageBytes size are silently
-// dropped. Note that we assume that the broker's limit is the same as the
-// producer's one or higher.
-func (s *ServiceHTTPSuite) TestMessageTooLarge(c *C) {
-	offsetsBefore := s.kh.GetNewestOffsets("test.4")
-	maxMsgSize := sarama.NewConfig().Producer.MaxMessageBytes - ProdMsgMetadataSize([]byte("foo")) + 1
-	msg := GenMessage(maxMsgSize)
-	s.cfg.TCPAddr = "127.0.0.1:55501"
+func (s *ServiceHTTPSuite) TestReadCommittedMessagesWithOffset(c *C) {
+	// Given
 	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
 
 	// When
-	r := PostChunked(s.tcpClient, "http://127.0.0.1:55501/topics/test.4/messages?key=foo", msg)
-	svc.Stop() // Have to stop before getOffsets
+	r, err := s.unixClient.Get("http://_/topics/test.4/partitions/0/messages?group=foo&committed=true&offset=10")
 
 	// Then
-	c.Assert(r.StatusCode, Equals, http.StatusOK)
-	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{})
-	offsetsAfter := s.kh.GetNewestOffsets("test.4")
-	c.Assert(offsetsAfter, DeepEquals, offsetsBefore)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "Offset cannot be specified with committed")
 }
 
-func (s *ServiceHTTPSuite) TestSyncProduce(c *C) {
+// A range of messages of a partition is exported as newline delimited JSON.
+func (s *ServiceHTTPSuite) TestExport(c *C) {
 	// Given
+	produced := s.kh.PutMessages("export", "test.1", map[string]int{"A": 5})
+	from := produced["A"][1].Offset
 	svc, _ := Spawn(s.cfg)
-	offsetsBefore := s.kh.GetNewestOffsets("test.4")
+	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Post("http://_/topics/test.4/messages?key=1&sync",
-		"text/plain", strings.NewReader("Foo"))
-	svc.Stop() // Have to stop before getOffsets
-	offsetsAfter := s.kh.GetNewestOffsets("test.4")
+	r, err := s.unixClient.Get(fmt.Sprintf(
+		"http://_/topics/test.1/partitions/0/export?from=%d&to=%d&format=jsonl", from, from+3))
 
 	// Then
 	c.Assert(err, IsNil)
 	c.Assert(r.StatusCode, Equals, http.StatusOK)
-	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(int(body["partition"].(float64)), Equals, 0)
-	c.Assert(int64(body["offset"].(float64)), Equals, offsetsBefore[0])
-	c.Assert(offsetsAfter[0], Equals, offsetsBefore[0]+1)
+	c.Assert(r.Header.Get("Content-Type"), Equals, "application/x-ndjson")
+	body, err := ioutil.ReadAll(r.Body)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	c.Assert(len(lines), Equals, 3)
+	for i, line := range lines {
+		var msg map[string]interface{}
+		c.Assert(json.Unmarshal([]byte(line), &msg), IsNil)
+		c.Assert(msg["topic"], Equals, "test.1")
+		c.Assert(msg["partition"], Equals, float64(0))
+		c.Assert(msg["offset"], Equals, float64(from+int64(i)))
+		c.Assert(msg["value"], Equals, base64.StdEncoding.EncodeToString([]byte(produced["A"][i+1].Value.(sarama.StringEncoder))))
+	}
 }
 
-func (s *ServiceHTTPSuite) TestSyncProduceInvalidTopic(c *C) {
+// If the end of the range is past the end of the partition, then messages are
+// exported up to the end of the partition.
+func (s *ServiceHTTPSuite) TestExportPastEnd(c *C) {
 	// Given
+	produced := s.kh.PutMessages("export", "test.1", map[string]int{"A": 2})
+	from := produced["A"][0].Offset
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Post("http://_/topics/no-such-topic/messages?sync=true",
-		"text/plain", strings.NewReader("Foo"))
+	r, err := s.unixClient.Get(fmt.Sprintf("http://_/topics/test.1/partitions/0/export?from=%d&to=%d", from, from+100))
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
-	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(body["error"], Equals, sarama.ErrUnknownTopicOrPartition.Error())
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body, err := ioutil.ReadAll(r.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(string(body), "\n"), Equals, 2)
 }
 
-func (s *ServiceHTTPSuite) TestConsumeNoGroup(c *C) {
+func (s *ServiceHTTPSuite) TestExportInvalid(c *C) {
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	for i, tc := range []struct {
+		query string
+		error string
+	}{
+		/* 0 */ {"to=10", "Invalid from: "},
+		/* 1 */ {"from=10", "Invalid to: "},
+		/* 2 */ {"from=10&to=5", "Invalid to: 5"},
+		/* 3 */ {"from=0&to=5&format=csv", "Invalid format: csv"},
+	} {
+		// When
+		r, err := s.unixClient.Get("http://_/topics/test.1/partitions/0/export?" + tc.query)
+
+		// Then
+		c.Assert(err, IsNil)
+		c.Assert(r.StatusCode, Equals, http.StatusBadRequest, Commentf("case #%d", i))
+		body := ParseJSONBody(c, r).(map[string]interface{})
+		c.Assert(body["error"], Equals, tc.error, Commentf("case #%d", i))
+	}
+}
+
+// Shutdown status reports requests in flight while the service is running.
+func (s *ServiceHTTPSuite) TestShutdownStatus(c *C) {
 	// Given
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Get("http://_/topics/test.4/messages")
+	r, err := s.unixClient.Get("http://_/admin/shutdown-status")
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
 	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(body["error"], Equals, "one consumer group is expected, but 0 provided")
+	c.Assert(body, DeepEquals, map[string]interface{}{
+		"state": "running",
+		// The status request itself is in flight.
+		"in_flight": map[string]interface{}{"http://" + s.cfg.UnixAddr: 1.0},
+	})
 }
 
-func (s *ServiceHTTPSuite) TestConsumeManyGroups(c *C) {
+// The admin server keeps running until all proxies are stopped.
+func (s *ServiceHTTPSuite) TestAdminServer(c *C) {
 	// Given
+	s.cfg.AdminAddr = "127.0.0.1:19093"
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=a&group=b")
+	r, err := s.tcpClient.Get("http://127.0.0.1:19093/admin/shutdown-status")
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
 	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(body["error"], Equals, "one consumer group is expected, but 2 provided")
+	c.Assert(body["state"], Equals, "running")
+	c.Assert(body["in_flight"], DeepEquals, map[string]interface{}{})
+
+	// API requests are not served by the admin server.
+	r, err = s.tcpClient.Get("http://127.0.0.1:19093/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
 }
 
-func (s *ServiceHTTPSuite) TestConsumeInvalidTopic(c *C) {
+// Produce and consume requests to topics disabled for the respective operation
+// are rejected with 403 Forbidden until the topic is enabled back.
+func (s *ServiceHTTPSuite) TestDisabledTopics(c *C) {
 	// Given
+	s.cfg.Proxies["pxyD"].DisabledTopics.Produce = map[string]string{"test.4": "migrating"}
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
+	r, err := s.unixClient.Post("http://_/admin/disabled-topics/consume/test.4?reason=poison+message", "text/plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+
 	// When
-	r, err := s.unixClient.Get("http://_/topics/no-such-topic/messages?group=foo")
+	r, err = s.unixClient.Post("http://_/topics/test.4/messages?sync", "text/plain", strings.NewReader("Hello"))
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusRequestTimeout)
+	c.Assert(r.StatusCode, Equals, http.StatusForbidden)
 	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(body["error"], Equals, "long polling timeout")
+	c.Assert(body["error"], Equals, "produce is disabled for topic test.4: migrating")
+
+	r, err = s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusForbidden)
+	body = ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["error"], Equals, "consume is disabled for topic test.4: poison message")
+
+	r, err = s.unixClient.Get("http://_/admin/disabled-topics")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{
+		"produce": map[string]interface{}{"test.4": "migrating"},
+		"consume": map[string]interface{}{"test.4": "poison message"},
+	})
+
+	// When
+	r, err = s.unixClient.Do(newDeleteRequest(c, "http://_/admin/disabled-topics/produce/test.4"))
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	r, err = s.unixClient.Post("http://_/topics/test.4/messages?sync", "text/plain", strings.NewReader("Hello"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
 }
 
-func (s *ServiceHTTPSuite) TestConsumeSingleMessage(c *C) {
+// Only produce and consume can be disabled for a topic.
+func (s *ServiceHTTPSuite) TestDisableTopicUnknownOp(c *C) {
 	// Given
-	s.kh.ResetOffsets("foo", "test.4")
-	produced := s.kh.PutMessages("service.consume", "test.4", map[string]int{"B": 1})
 	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Get("http://_/topics/test.4/messages?group=foo")
-	svc.Stop()
+	r, err := s.unixClient.Post("http://_/admin/disabled-topics/delete/test.4", "text/plain", nil)
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
 	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(ParseBase64(c, body["key"].(string)), Equals, "B")
-	c.Assert(ParseBase64(c, body["value"].(string)), Equals, ProdMsgVal(produced["B"][0]))
-	c.Assert(int(body["partition"].(float64)), Equals, 3)
-	c.Assert(int64(body["offset"].(float64)), Equals, produced["B"][0].Offset)
-
-	offsetsAfter := s.kh.GetCommittedOffsets("foo", "test.4")
-	c.Assert(offsetsAfter[3].Val, Equals, produced["B"][0].Offset+1)
+	c.Assert(body["error"], Equals, "unknown operation: delete")
 }
 
-// If offsets for a group that does not exist are requested then -1 is returned
-// as the next offset to be consumed for all topic partitions.
-func (s *ServiceHTTPSuite) TestGetOffsetsNoSuchGroup(c *C) {
+// While consumption of a topic by a group is paused, consume requests time out
+// even though there are messages, and once resumed messages are consumed.
+func (s *ServiceHTTPSuite) TestPauseConsumption(c *C) {
 	// Given
+	s.cfg.Proxies[s.cfg.DefaultProxy].Consumer.LongPollingTimeout = 500 * time.Millisecond
+	produced := s.kh.PutMessages("pause", "test.1", map[string]int{"": 1})
+	s.kh.SetOffsets("pause", "test.1", []offsetmgr.Offset{{Val: produced[""][0].Offset}})
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Get("http://_/topics/test.4/offsets?group=no_such_group")
+	r, err := s.unixClient.Post("http://_/topics/test.1/consumption/pause?group=pause", "text/plain", nil)
 
 	// Then
 	c.Assert(err, IsNil)
 	c.Assert(r.StatusCode, Equals, http.StatusOK)
-	body := ParseJSONBody(c, r).([]interface{})
-	for i := 0; i < 4; i++ {
-		partitionView := body[i].(map[string]interface{})
-		c.Assert(partitionView["partition"].(float64), Equals, float64(i))
-		c.Assert(partitionView["offset"].(float64), Equals, float64(-1))
-	}
+	r, err = s.unixClient.Get("http://_/admin/paused-consumption")
+	c.Assert(err, IsNil)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{"pause": []interface{}{"test.1"}})
+	r, err = s.unixClient.Get("http://_/topics/test.1/messages?group=pause")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusRequestTimeout)
+
+	// When
+	r, err = s.unixClient.Post("http://_/topics/test.1/consumption/resume?group=pause", "text/plain", nil)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	r, err = s.unixClient.Get("http://_/topics/test.1/messages?group=pause")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).(map[string]interface{})
+	c.Assert(body["offset"], Equals, float64(produced[""][0].Offset))
 }
 
-// An attempt to retrieve offsets for a topic that does not exist fails with 404.
-func (s *ServiceHTTPSuite) TestGetOffsetsNoSuchTopic(c *C) {
+// Pausing consumption requires exactly one group.
+func (s *ServiceHTTPSuite) TestPauseConsumptionNoGroup(c *C) {
 	// Given
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Get("http://_/topics/no_such_topic/offsets?group=foo")
+	r, err := s.unixClient.Post("http://_/topics/test.1/consumption/pause", "text/plain", nil)
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
 	body := ParseJSONBody(c, r).(map[string]interface{})
-	c.Assert(body["error"], Equals, "Unknown topic")
+	c.Assert(body["error"], Equals, "one consumer group is expected, but 0 provided")
 }
 
-// Committed offsets are returned in a following GET request.
-func (s *ServiceHTTPSuite) TestSetOffsets(c *C) {
+// A shadow group mirrors offsets of the source group until it is consumed.
+func (s *ServiceHTTPSuite) TestShadowGroup(c *C) {
 	// Given
+	s.kh.SetOffsets("foo", "test.4", []offsetmgr.Offset{
+		{Val: 1100, Meta: "A100"}, {Val: 1101, Meta: "A101"},
+		{Val: 1102, Meta: "A102"}, {Val: 1103, Meta: "A103"}})
 	svc, _ := Spawn(s.cfg)
 	defer svc.Stop()
 
 	// When
-	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=foo",
-		"application/json", strings.NewReader(
-			`[{"partition": 0, "offset": 1100, "metadata": "A100"},
-			  {"partition": 1, "offset": 1101, "metadata": "A101"},
-			  {"partition": 2, "offset": 1102, "metadata": "A102"},
-			  {"partition": 3, "offset": 1103, "metadata": "A103"}]`))
+	r, err := s.unixClient.Post("http://_/topics/test.4/shadows?group=foo&shadow=bar", "text/plain", nil)
 
 	// Then
 	c.Assert(err, IsNil)
-	c.Assert(ParseJSONBody(c, r), DeepEquals, httpsrv.EmptyResponse)
 	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(s.kh.GetCommittedOffsets("bar", "test.4")[2], DeepEquals, offsetmgr.Offset{Val: 1102, Meta: "A102"})
 
-	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+	// When: the source group commits new offsets they are mirrored.
+	s.kh.SetOffsets("foo", "test.4", []offsetmgr.Offset{
+		{Val: 1200, Meta: "A200"}, {Val: 1201, Meta: "A201"},
+		{Val: 1202, Meta: "A202"}, {Val: 1203, Meta: "A203"}})
+	time.Sleep(3 * s.cfg.Proxies["pxyD"].Consumer.OffsetsCommitInterval)
+
+	// Then
+	c.Assert(s.kh.GetCommittedOffsets("bar", "test.4")[2], DeepEquals, offsetmgr.Offset{Val: 1202, Meta: "A202"})
+
+	// When: a shadow group cannot be created twice.
+	r, err = s.unixClient.Post("http://_/topics/test.4/shadows?group=foo&shadow=bar", "text/plain", nil)
+
+	// Then
 	c.Assert(err, IsNil)
-	body := ParseJSONBody(c, r).([]interface{})
-	for i := 0; i < 4; i++ {
-		partitionView := body[i].(map[string]interface{})
-		c.Assert(partitionView["partition"].(float64), Equals, float64(i))
-		c.Assert(partitionView["offset"].(float64), Equals, float64(1100+i))
-		c.Assert(partitionView["metadata"].(string), Equals, fmt.Sprintf("A10%d", i))
-		c.Assert(partitionView["count"], Equals, partitionView["end"].(float64)-partitionView["begin"].(float64))
-	}
+	c.Assert(r.StatusCode, Equals, http.StatusConflict)
+
+	// When: the shadow group is stopped.
+	r, err = s.unixClient.Do(newDeleteRequest(c, "http://_/topics/test.4/shadows?shadow=bar"))
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	r, err = s.unixClient.Do(newDeleteRequest(c, "http://_/topics/test.4/shadows?shadow=bar"))
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusNotFound)
 }
 
 // Result of setting offsets for a non-existent topic depends on the Kafka
@@ -531,6 +2043,118 @@ func (s *ServiceHTTPSuite) TestGetOffsetsLag(c *C) {
 	c.Assert(partition2View["lag"], Equals, partition2View["end"].(float64)-partition2View["offset"].(float64))
 }
 
+// With the query cache enabled offsets are served from the cache, unless a
+// refresh is requested.
+func (s *ServiceHTTPSuite) TestGetOffsetsCached(c *C) {
+	// Given
+	s.cfg.Proxies["pxyD"].QueryCache.TTL = time.Minute
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=foo",
+		"application/json", strings.NewReader(`[{"partition": 2, "offset": 1}]`))
+	c.Assert(err, IsNil)
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	ParseJSONBody(c, r)
+	r, err = s.unixClient.Post("http://_/topics/test.4/offsets?group=foo",
+		"application/json", strings.NewReader(`[{"partition": 2, "offset": 2}]`))
+	c.Assert(err, IsNil)
+
+	// When
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.Header.Get("Age"), Not(Equals), "")
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(body[2].(map[string]interface{})["offset"], Equals, float64(1))
+
+	// When
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo&refresh")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.Header.Get("Age"), Equals, "0")
+	body = ParseJSONBody(c, r).([]interface{})
+	c.Assert(body[2].(map[string]interface{})["offset"], Equals, float64(2))
+}
+
+// Offsets can be filtered by partition and paged through.
+func (s *ServiceHTTPSuite) TestGetOffsetsPaged(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+
+	// When
+	r, err := s.unixClient.Get("http://_/topics/test.4/offsets?group=foo&partition=0,2,3&limit=2")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	cursor := r.Header.Get("X-Kafka-Pixy-Next-Cursor")
+	c.Assert(cursor, Not(Equals), "")
+	body := ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 2)
+	c.Assert(body[0].(map[string]interface{})["partition"], Equals, float64(0))
+	c.Assert(body[1].(map[string]interface{})["partition"], Equals, float64(2))
+
+	// When
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo&partition=0,2,3&limit=2&cursor=" + cursor)
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	c.Assert(r.Header.Get("X-Kafka-Pixy-Next-Cursor"), Equals, "")
+	body = ParseJSONBody(c, r).([]interface{})
+	c.Assert(len(body), Equals, 1)
+	c.Assert(body[0].(map[string]interface{})["partition"], Equals, float64(3))
+}
+
+// Only fields selected with the `fields` parameter are returned along with
+// partitions, and unknown fields are rejected.
+func (s *ServiceHTTPSuite) TestGetOffsetsFields(c *C) {
+	// Given
+	svc, _ := Spawn(s.cfg)
+	defer svc.Stop()
+	r, err := s.unixClient.Post("http://_/topics/test.4/offsets?group=foo",
+		"application/json", strings.NewReader(`[{"partition": 2, "offset": 1}]`))
+	c.Assert(err, IsNil)
+
+	// When
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo&fields=lag,offset")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	body := ParseJSONBody(c, r).([]interface{})
+	partition2View := body[2].(map[string]interface{})
+	c.Assert(len(partition2View), Equals, 3)
+	c.Assert(partition2View["partition"], Equals, float64(2))
+	c.Assert(partition2View["offset"], Equals, float64(1))
+
+	// When
+	r, err = s.unixClient.Get("http://_/groups/foo/offsets?fields=lag")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusOK)
+	topicViews := ParseJSONBody(c, r).(map[string]interface{})
+	partition2View = topicViews["test.4"].([]interface{})[2].(map[string]interface{})
+	c.Assert(len(partition2View), Equals, 2)
+	c.Assert(partition2View["partition"], Equals, float64(2))
+
+	// When
+	r, err = s.unixClient.Get("http://_/topics/test.4/offsets?group=foo&fields=lag,bazz")
+
+	// Then
+	c.Assert(err, IsNil)
+	c.Assert(r.StatusCode, Equals, http.StatusBadRequest)
+	c.Assert(ParseJSONBody(c, r), DeepEquals, map[string]interface{}{"error": "Invalid fields: unknown field bazz"})
+}
+
 // If a topic is not consumed by any member of a group at the moment then
 // empty consumer map is returned.
 func (s *ServiceHTTPSuite) TestGetTopicConsumersNone(c *C) {
@@ -726,6 +2350,12 @@ func (s *ServiceHTTPSuite) TestExplicitProxyAPIEndpoints(c *C) {
 	c.Assert(int64(body["offset"].(float64)), Equals, prodOffset)
 }
 
+func newDeleteRequest(c *C, url string) *http.Request {
+	req, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, IsNil)
+	return req
+}
+
 func spawnTestService(c *C, port int) *T {
 	cfg := &config.App{Proxies: make(map[string]*config.Proxy)}
 	cfg.UnixAddr = path.Join(os.TempDir(), fmt.Sprintf("kafka-pixy.%d.sock", port))
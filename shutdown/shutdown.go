@@ -0,0 +1,188 @@
+package shutdown
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+)
+
+// T tracks progress of a graceful shutdown of the service. It counts API
+// requests in flight and records how long every shutdown phase takes, so that
+// it is possible to tell what makes a shutdown slow.
+type T struct {
+	mu       sync.Mutex
+	state    string
+	begin    time.Time
+	end      time.Time
+	phases   []*phase
+	inFlight map[string]int64
+	// Requests in flight per server at the time the shutdown began.
+	inFlightAtBegin map[string]int64
+	// Closed when a drain is requested via the API.
+	drainRequestedCh chan struct{}
+
+	// To be replaced in tests.
+	now func() time.Time
+}
+
+type phase struct {
+	name  string
+	begin time.Time
+	end   time.Time
+}
+
+// Status is a snapshot of the shutdown progress.
+type Status struct {
+	State           string           `json:"state"`
+	Elapsed         string           `json:"elapsed,omitempty"`
+	Phases          []PhaseStatus    `json:"phases,omitempty"`
+	InFlight        map[string]int64 `json:"in_flight"`
+	InFlightAtBegin map[string]int64 `json:"in_flight_at_begin,omitempty"`
+}
+
+// PhaseStatus describes a shutdown phase. Elapsed time of a phase that is not
+// done yet is the time since the phase began.
+type PhaseStatus struct {
+	Name    string `json:"name"`
+	Elapsed string `json:"elapsed"`
+	Done    bool   `json:"done"`
+}
+
+// New creates a shutdown tracker in the running state.
+func New() *T {
+	return &T{
+		state:            StateRunning,
+		inFlight:         make(map[string]int64),
+		drainRequestedCh: make(chan struct{}),
+		now:              time.Now,
+	}
+}
+
+// RequestDrain asks the service to drain and shut down gracefully. It is safe
+// to call it several times.
+func (t *T) RequestDrain() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.drainRequestedCh:
+	default:
+		close(t.drainRequestedCh)
+	}
+}
+
+// DrainRequested returns a channel that is closed when a drain is requested.
+func (t *T) DrainRequested() <-chan struct{} {
+	return t.drainRequestedCh
+}
+
+// TrackRequest should be called by the server when it starts serving an API
+// request. The returned function must be called when the request is over.
+func (t *T) TrackRequest(server string) func() {
+	t.mu.Lock()
+	t.inFlight[server]++
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		t.inFlight[server]--
+		t.mu.Unlock()
+	}
+}
+
+// Begin marks the beginning of the shutdown.
+func (t *T) Begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = StateStopping
+	t.begin = t.now()
+	t.inFlightAtBegin = make(map[string]int64, len(t.inFlight))
+	for server, count := range t.inFlight {
+		t.inFlightAtBegin[server] = count
+	}
+}
+
+// BeginPhase records the beginning of a shutdown phase with the specified
+// name. The returned function must be called when the phase is over. Phases
+// can overlap.
+func (t *T) BeginPhase(name string) func() {
+	t.mu.Lock()
+	p := &phase{name: name, begin: t.now()}
+	t.phases = append(t.phases, p)
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		p.end = t.now()
+		t.mu.Unlock()
+	}
+}
+
+// End marks the end of the shutdown.
+func (t *T) End() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = StateStopped
+	t.end = t.now()
+}
+
+// Status returns the current shutdown progress.
+func (t *T) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s := Status{
+		State:    t.state,
+		InFlight: make(map[string]int64, len(t.inFlight)),
+	}
+	for server, count := range t.inFlight {
+		s.InFlight[server] = count
+	}
+	if t.state == StateRunning {
+		return s
+	}
+	s.Elapsed = elapsed(t.begin, t.end, now).String()
+	s.InFlightAtBegin = t.inFlightAtBegin
+	for _, p := range t.phases {
+		s.Phases = append(s.Phases, PhaseStatus{
+			Name:    p.name,
+			Elapsed: elapsed(p.begin, p.end, now).String(),
+			Done:    !p.end.IsZero(),
+		})
+	}
+	return s
+}
+
+// Summary returns a one line human readable summary of the shutdown, that is
+// suitable for logging.
+func (t *T) Summary() string {
+	s := t.Status()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "state=%s, elapsed=%s, inFlightAtBegin=%v, phases=[", s.State, s.Elapsed, s.InFlightAtBegin)
+	for i, p := range s.Phases {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s: %s", p.name(), p.Elapsed)
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+func (p PhaseStatus) name() string {
+	if p.Done {
+		return p.Name
+	}
+	return p.Name + " (in progress)"
+}
+
+func elapsed(begin, end, now time.Time) time.Duration {
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(begin)
+}
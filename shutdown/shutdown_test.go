@@ -0,0 +1,116 @@
+package shutdown
+
+import (
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ShutdownSuite{})
+
+type ShutdownSuite struct {
+	now time.Time
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *ShutdownSuite) SetUpTest(c *C) {
+	s.now = time.Date(2016, 11, 3, 10, 15, 0, 0, time.UTC)
+}
+
+func (s *ShutdownSuite) newTracker() *T {
+	t := New()
+	t.now = func() time.Time { return s.now }
+	return t
+}
+
+// Before shutdown begins only requests in flight are reported.
+func (s *ShutdownSuite) TestRunning(c *C) {
+	t := s.newTracker()
+	t.TrackRequest("foo")
+	done := t.TrackRequest("foo")
+	t.TrackRequest("bar")
+	done()
+
+	// When
+	status := t.Status()
+
+	// Then
+	c.Assert(status, DeepEquals, Status{
+		State:    StateRunning,
+		InFlight: map[string]int64{"foo": 1, "bar": 1},
+	})
+}
+
+// Phases that are still in progress are reported with time elapsed so far.
+func (s *ShutdownSuite) TestStopping(c *C) {
+	t := s.newTracker()
+	done := t.TrackRequest("foo")
+	t.Begin()
+	endServers := t.BeginPhase("servers")
+	s.now = s.now.Add(3 * time.Second)
+	done()
+	endServers()
+	t.BeginPhase("proxy bar")
+	s.now = s.now.Add(5 * time.Second)
+
+	// When
+	status := t.Status()
+
+	// Then
+	c.Assert(status, DeepEquals, Status{
+		State:           StateStopping,
+		Elapsed:         "8s",
+		InFlight:        map[string]int64{"foo": 0},
+		InFlightAtBegin: map[string]int64{"foo": 1},
+		Phases: []PhaseStatus{
+			{Name: "servers", Elapsed: "3s", Done: true},
+			{Name: "proxy bar", Elapsed: "5s", Done: false},
+		},
+	})
+	c.Assert(t.Summary(), Equals,
+		"state=stopping, elapsed=8s, inFlightAtBegin=map[foo:1], phases=[servers: 3s, proxy bar (in progress): 5s]")
+}
+
+func (s *ShutdownSuite) TestStopped(c *C) {
+	t := s.newTracker()
+	t.Begin()
+	endProxy := t.BeginPhase("proxy bar")
+	s.now = s.now.Add(90 * time.Second)
+	endProxy()
+	t.End()
+	s.now = s.now.Add(time.Hour)
+
+	// When
+	status := t.Status()
+
+	// Then
+	c.Assert(status.State, Equals, StateStopped)
+	c.Assert(status.Elapsed, Equals, "1m30s")
+	c.Assert(t.Summary(), Equals,
+		"state=stopped, elapsed=1m30s, inFlightAtBegin=map[], phases=[proxy bar: 1m30s]")
+}
+
+// A drain can be requested many times, the channel is closed on the first one.
+func (s *ShutdownSuite) TestRequestDrain(c *C) {
+	t := s.newTracker()
+	select {
+	case <-t.DrainRequested():
+		c.Error("Drain requested before RequestDrain")
+	default:
+	}
+
+	// When
+	t.RequestDrain()
+	t.RequestDrain()
+
+	// Then
+	select {
+	case <-t.DrainRequested():
+	default:
+		c.Error("Drain not requested")
+	}
+}
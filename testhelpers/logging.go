@@ -1,8 +1,10 @@
 package testhelpers
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/mailgun/kafka-pixy/logging"
@@ -19,6 +21,50 @@ func InitLogging(c *C) {
 	})
 }
 
+var (
+	captureOnce sync.Once
+	captured    = &capturingLogger{}
+)
+
+// CaptureLogs starts collecting log records, and returns a function that
+// stops collecting them and returns all records collected in the meantime.
+func CaptureLogs() func() string {
+	captureOnce.Do(func() {
+		log.Init(captured)
+	})
+	captured.mu.Lock()
+	captured.buf = &bytes.Buffer{}
+	captured.mu.Unlock()
+	return func() string {
+		captured.mu.Lock()
+		defer captured.mu.Unlock()
+		records := captured.buf.String()
+		captured.buf = nil
+		return records
+	}
+}
+
+// capturingLogger collects log records to a buffer while capturing is on.
+type capturingLogger struct {
+	logger
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (l *capturingLogger) Writer(sev log.Severity) io.Writer {
+	return l
+}
+
+func (l *capturingLogger) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buf != nil {
+		l.buf.Write(p)
+		l.buf.WriteString("\n")
+	}
+	return len(p), nil
+}
+
 // logger is a type of writerLogger that sends messages to the standard output.
 type logger struct {
 	c *C
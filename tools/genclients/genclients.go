@@ -0,0 +1,174 @@
+// genclients generates thin Python and Java clients of the Kafka-Pixy HTTP
+// API from the route table of the HTTP server, so that clients cannot get out
+// of sync with the server. It is supposed to run from the repository root:
+//
+//	go run ./tools/genclients
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/mailgun/kafka-pixy/server/httpsrv"
+)
+
+const (
+	pythonFile = "python/kafkapixy_client.py"
+	javaFile   = "java/com/mailgun/kafkapixy/KafkaPixyClient.java"
+)
+
+// Operations that cannot be called as plain HTTP requests.
+var skippedOperations = map[string]bool{
+	"WebSocket": true,
+}
+
+// Python keywords that cannot be argument names, so they get an underscore
+// appended, e.g. `from_`.
+var pythonKeywords = map[string]bool{
+	"and": true, "as": true, "assert": true, "async": true, "await": true, "break": true,
+	"class": true, "continue": true, "def": true, "del": true, "elif": true, "else": true,
+	"except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true,
+	"or": true, "pass": true, "raise": true, "return": true, "try": true, "while": true,
+	"with": true, "yield": true,
+}
+
+var (
+	pathParamRegexp = regexp.MustCompile(`{([^}]+)}`)
+	pythonTmpl      = template.Must(template.New("python").Parse(pythonSrc))
+	javaTmpl        = template.Must(template.New("java").Parse(javaSrc))
+)
+
+// stub describes a client method that calls an endpoint.
+type stub struct {
+	httpsrv.Endpoint
+	PythonName  string
+	JavaName    string
+	PythonPath  string
+	JavaPath    string
+	PathParams  []param
+	QueryParams []param
+	HasBody     bool
+}
+
+type param struct {
+	Name       string
+	PythonName string
+}
+
+func main() {
+	outDir := flag.String("out", "gen", "the directory to write generated clients to")
+	flag.Parse()
+
+	files, err := generate(httpsrv.Endpoints())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate clients: %s\n", err)
+		os.Exit(1)
+	}
+	for name, content := range files {
+		path := filepath.Join(*outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create directory: %s\n", err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %s\n", path, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// generate returns contents of generated client files by their paths relative
+// to the output directory.
+func generate(endpoints []httpsrv.Endpoint) (map[string][]byte, error) {
+	var stubs []stub
+	for _, ep := range endpoints {
+		if skippedOperations[ep.Operation] {
+			continue
+		}
+		stubs = append(stubs, newStub(ep))
+	}
+	files := make(map[string][]byte)
+	for name, tmpl := range map[string]*template.Template{pythonFile: pythonTmpl, javaFile: javaTmpl} {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, stubs); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %s", name, err)
+		}
+		files[name] = buf.Bytes()
+	}
+	return files, nil
+}
+
+func newStub(ep httpsrv.Endpoint) stub {
+	s := stub{
+		Endpoint:   ep,
+		PythonName: snakeCase(ep.Operation),
+		JavaName:   strings.ToLower(ep.Operation[:1]) + ep.Operation[1:],
+		HasBody:    ep.Method != "GET",
+	}
+	var pythonPath, javaPath []string
+	pathParams := make(map[string]bool)
+	last := 0
+	for _, loc := range pathParamRegexp.FindAllStringSubmatchIndex(ep.Path, -1) {
+		name := ep.Path[loc[2]:loc[3]]
+		p := param{Name: name, PythonName: pythonArg(name)}
+		s.PathParams = append(s.PathParams, p)
+		pathParams[name] = true
+		if literal := ep.Path[last:loc[0]]; literal != "" {
+			pythonPath = append(pythonPath, fmt.Sprintf("'%s'", literal))
+			javaPath = append(javaPath, fmt.Sprintf("%q", literal))
+		}
+		pythonPath = append(pythonPath, fmt.Sprintf("_quote(%s)", p.PythonName))
+		javaPath = append(javaPath, fmt.Sprintf("quote(%s)", p.Name))
+		last = loc[1]
+	}
+	if literal := ep.Path[last:]; literal != "" {
+		pythonPath = append(pythonPath, fmt.Sprintf("'%s'", literal))
+		javaPath = append(javaPath, fmt.Sprintf("%q", literal))
+	}
+	s.PythonPath = strings.Join(pythonPath, " + ")
+	s.JavaPath = strings.Join(javaPath, " + ")
+	for _, name := range ep.Params {
+		if !pathParams[name] {
+			s.QueryParams = append(s.QueryParams, param{Name: name, PythonName: pythonArg(name)})
+		}
+	}
+	return s
+}
+
+// pythonArg returns the name of a Python argument for a parameter.
+func pythonArg(name string) string {
+	arg := snakeCase(name)
+	if pythonKeywords[arg] {
+		return arg + "_"
+	}
+	return arg
+}
+
+// snakeCase converts camel case names, e.g. `GetOpenAPI` or `traceID`, to
+// snake case, e.g. `get_open_api` or `trace_id`. Names that are snake case
+// already are returned as is.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mailgun/kafka-pixy/server/httpsrv"
+	. "gopkg.in/check.v1"
+)
+
+type GenClientsSuite struct{}
+
+var _ = Suite(&GenClientsSuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+// Clients in the repository are generated from the current route table.
+func (s *GenClientsSuite) TestUpToDate(c *C) {
+	// When
+	files, err := generate(httpsrv.Endpoints())
+
+	// Then
+	c.Assert(err, IsNil)
+	for name, content := range files {
+		committed, err := ioutil.ReadFile(filepath.Join("../../gen", name))
+		c.Assert(err, IsNil)
+		c.Assert(string(committed), Equals, string(content),
+			Commentf("%s is out of date, run `go run ./tools/genclients`", name))
+	}
+}
+
+func (s *GenClientsSuite) TestSnakeCase(c *C) {
+	for i, tc := range []struct {
+		name string
+		want string
+	}{
+		{"AckUpTo", "ack_up_to"},
+		{"GetOpenAPI", "get_open_api"},
+		{"traceID", "trace_id"},
+		{"noAutoAck", "no_auto_ack"},
+		{"key_filter_prefix", "key_filter_prefix"},
+	} {
+		c.Assert(snakeCase(tc.name), Equals, tc.want, Commentf("case #%d", i))
+	}
+}
+
+// Path parameters are substituted into the path, and query parameters that
+// are Python keywords get an underscore appended.
+func (s *GenClientsSuite) TestNewStub(c *C) {
+	// When
+	st := newStub(httpsrv.Endpoint{
+		Method:    "GET",
+		Path:      "/topics/{topic}/partitions/{partition}/export",
+		Operation: "Export",
+		Params:    []string{"from", "to"},
+	})
+
+	// Then
+	c.Assert(st.PythonName, Equals, "export")
+	c.Assert(st.JavaName, Equals, "export")
+	c.Assert(st.PythonPath, Equals, "'/topics/' + _quote(topic) + '/partitions/' + _quote(partition) + '/export'")
+	c.Assert(st.JavaPath, Equals, `"/topics/" + quote(topic) + "/partitions/" + quote(partition) + "/export"`)
+	c.Assert(st.QueryParams, DeepEquals, []param{{"from", "from_"}, {"to", "to"}})
+	c.Assert(st.HasBody, Equals, false)
+}
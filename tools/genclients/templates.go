@@ -0,0 +1,287 @@
+package main
+
+const pythonSrc = `# Code generated by tools/genclients from the HTTP API route table. DO NOT EDIT.
+"""Thin client of the Kafka-Pixy HTTP API.
+
+Consumed messages are acknowledged automatically by default, that is a message
+is considered processed as soon as it is returned. To acknowledge a message
+only once it has been processed, consume it with ` + "``no_auto_ack=True``" + ` and
+then call ` + "``ack_message``" + ` with it. A message that is not acknowledged within
+the consumer ack timeout is redelivered, so every message consumed without
+auto acknowledgement has to be acknowledged. A message that failed to be
+processed can be redelivered without waiting for the ack timeout with
+` + "``nack``" + `, or later with ` + "``retry``" + `.
+
+Query parameters that are flags, e.g. ` + "``sync``" + ` or ` + "``no_auto_ack``" + `, are set
+with ` + "``True``" + `, and parameters that can be repeated, e.g. ` + "``topic``" + ` of
+` + "``consume_topics``" + `, accept lists. Responses are returned decoded from JSON,
+unless they are raw, then bytes are returned.
+"""
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+
+
+class KafkaPixyError(Exception):
+    """Raised when Kafka-Pixy responds with an error status."""
+
+    def __init__(self, status, message):
+        super().__init__('%d: %s' % (status, message))
+        self.status = status
+        self.message = message
+
+
+class KafkaPixyClient(object):
+
+    def __init__(self, base_url='http://localhost:19092', proxy=None, timeout=None):
+        """Creates a client of the Kafka-Pixy server at ` + "``base_url``" + `.
+
+        ` + "``proxy``" + ` selects the proxy to call endpoints served per proxy, and
+        the default proxy is used if it is None. ` + "``timeout``" + ` is the socket
+        timeout in seconds, it has to exceed long polling timeouts of consume
+        requests.
+        """
+        self.base_url = base_url.rstrip('/')
+        self.proxy = proxy
+        self.timeout = timeout
+
+    def ack_message(self, topic, group, msg, ack_metadata=None):
+        """Acknowledges a message returned by ` + "``consume``" + ` with ` + "``no_auto_ack``" + `."""
+        return self.ack(topic, group=group, partition=msg['partition'], offset=msg['offset'],
+                        ack_metadata=ack_metadata)
+{{range .}}
+    def {{.PythonName}}(self{{range .PathParams}}, {{.PythonName}}{{end}}, *{{if .HasBody}}, body=None{{end}}{{range .QueryParams}}, {{.PythonName}}=None{{end}}, headers=None):
+        """{{.Summary}}.
+
+        ` + "``{{.Method}} {{.Path}}``" + `
+        """
+        return self._call('{{.Method}}', {{.PythonPath}}, {{if .Proxied}}True{{else}}False{{end}}, [{{range .QueryParams}}
+            ('{{.Name}}', {{.PythonName}}),{{end}}
+        ], {{if .HasBody}}body{{else}}None{{end}}, headers)
+{{end}}
+    def _call(self, method, path, proxied, params, body, headers):
+        if proxied and self.proxy is not None:
+            path = '/proxies/' + _quote(self.proxy) + path
+        query = []
+        for name, value in params:
+            if value is None or value is False:
+                continue
+            if value is True:
+                value = ''
+            if isinstance(value, (list, tuple)):
+                query.extend((name, str(v)) for v in value)
+            else:
+                query.append((name, str(value)))
+        url = self.base_url + path
+        if query:
+            url += '?' + urllib.parse.urlencode(query)
+        if isinstance(body, str):
+            body = body.encode('utf-8')
+        if body is None and method != 'GET':
+            body = b''
+        req = urllib.request.Request(url, data=body, headers=headers or {}, method=method)
+        try:
+            with urllib.request.urlopen(req, timeout=self.timeout) as res:
+                return _decode(res.headers.get('Content-Type', ''), res.read())
+        except urllib.error.HTTPError as e:
+            content = e.read()
+            try:
+                message = json.loads(content.decode('utf-8'))['error']
+            except (ValueError, KeyError, TypeError):
+                message = content.decode('utf-8', 'replace')
+            raise KafkaPixyError(e.code, message)
+
+
+def _quote(value):
+    return urllib.parse.quote(str(value), safe='')
+
+
+def _decode(content_type, content):
+    if content_type.startswith('application/json'):
+        return json.loads(content.decode('utf-8'))
+    return content
+`
+
+const javaSrc = `// Code generated by tools/genclients from the HTTP API route table. DO NOT EDIT.
+package com.mailgun.kafkapixy;
+
+import java.io.ByteArrayOutputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.OutputStream;
+import java.io.UnsupportedEncodingException;
+import java.net.HttpURLConnection;
+import java.net.URL;
+import java.net.URLEncoder;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+
+/**
+ * Thin client of the Kafka-Pixy HTTP API.
+ *
+ * <p>Consumed messages are acknowledged automatically by default, that is a
+ * message is considered processed as soon as it is returned. To acknowledge a
+ * message only once it has been processed, consume it with the
+ * {@code noAutoAck} flag and then call {@link #ackMessage} with its partition
+ * and offset. A message that is not acknowledged within the consumer ack
+ * timeout is redelivered, so every message consumed without auto
+ * acknowledgement has to be acknowledged. A message that failed to be
+ * processed can be redelivered without waiting for the ack timeout with
+ * {@link #nack}, or later with {@link #retry}.
+ *
+ * <p>Responses are returned as is, JSON unless the raw format is requested.
+ */
+public class KafkaPixyClient {
+    private final String baseUrl;
+    private final String proxy;
+    private final int timeoutMillis;
+
+    /**
+     * Creates a client of the Kafka-Pixy server at {@code baseUrl}, e.g.
+     * {@code http://localhost:19092}. {@code proxy} selects the proxy to call
+     * endpoints served per proxy, and the default proxy is used if it is null.
+     * {@code timeoutMillis} is the read timeout, it has to exceed long polling
+     * timeouts of consume requests.
+     */
+    public KafkaPixyClient(String baseUrl, String proxy, int timeoutMillis) {
+        this.baseUrl = baseUrl.replaceAll("/+$", "");
+        this.proxy = proxy;
+        this.timeoutMillis = timeoutMillis;
+    }
+
+    /** Query parameters and headers of a request. */
+    public static class Params {
+        private final List<String[]> query = new ArrayList<>();
+        private final Map<String, String> headers = new LinkedHashMap<>();
+
+        /** Adds a query parameter, it can be added several times. */
+        public Params add(String name, Object value) {
+            query.add(new String[] {name, String.valueOf(value)});
+            return this;
+        }
+
+        /** Sets a flag query parameter, e.g. {@code sync} or {@code noAutoAck}. */
+        public Params flag(String name) {
+            query.add(new String[] {name, ""});
+            return this;
+        }
+
+        /** Sets a request header, e.g. {@code X-Kafka-Pixy-Key} of a raw message. */
+        public Params header(String name, String value) {
+            headers.put(name, value);
+            return this;
+        }
+    }
+
+    /** A successful response. */
+    public static class Response {
+        public final int status;
+        public final Map<String, List<String>> headers;
+        public final byte[] body;
+
+        Response(int status, Map<String, List<String>> headers, byte[] body) {
+            this.status = status;
+            this.headers = headers;
+            this.body = body;
+        }
+
+        public String text() {
+            return new String(body, StandardCharsets.UTF_8);
+        }
+    }
+
+    /** Thrown when Kafka-Pixy responds with an error status. */
+    public static class KafkaPixyException extends IOException {
+        public final int status;
+        public final String body;
+
+        KafkaPixyException(int status, String body) {
+            super(status + ": " + body);
+            this.status = status;
+            this.body = body;
+        }
+    }
+
+    /** Acknowledges a message consumed with the {@code noAutoAck} flag. */
+    public Response ackMessage(String topic, String group, int partition, long offset) throws IOException {
+        return ack(topic, null, new Params().add("group", group).add("partition", partition).add("offset", offset));
+    }
+{{range .}}
+    /**
+     * {{.Summary}}.
+     *
+     * <p>{@code {{.Method}} {{.Path}}}{{if .QueryParams}}, query parameters:{{range $i, $p := .QueryParams}}{{if $i}},{{end}} {@code {{$p.Name}}}{{end}}{{end}}.
+     */
+    public Response {{.JavaName}}({{range .PathParams}}String {{.Name}}, {{end}}{{if .HasBody}}byte[] body, {{end}}Params params) throws IOException {
+        return call("{{.Method}}", {{.JavaPath}}, {{.Proxied}}, params, {{if .HasBody}}body{{else}}null{{end}});
+    }
+{{end}}
+    private Response call(String method, String path, boolean proxied, Params params, byte[] body) throws IOException {
+        if (proxied && proxy != null) {
+            path = "/proxies/" + quote(proxy) + path;
+        }
+        if (params == null) {
+            params = new Params();
+        }
+        StringBuilder url = new StringBuilder(baseUrl).append(path);
+        String sep = "?";
+        for (String[] p : params.query) {
+            url.append(sep).append(quote(p[0])).append('=').append(quote(p[1]));
+            sep = "&";
+        }
+        HttpURLConnection conn = (HttpURLConnection) new URL(url.toString()).openConnection();
+        try {
+            conn.setRequestMethod(method);
+            conn.setReadTimeout(timeoutMillis);
+            for (Map.Entry<String, String> h : params.headers.entrySet()) {
+                conn.setRequestProperty(h.getKey(), h.getValue());
+            }
+            if (body != null || method.equals("POST")) {
+                conn.setDoOutput(true);
+                try (OutputStream out = conn.getOutputStream()) {
+                    if (body != null) {
+                        out.write(body);
+                    }
+                }
+            }
+            int status = conn.getResponseCode();
+            if (status >= 400) {
+                byte[] errorBody = readAll(conn.getErrorStream());
+                throw new KafkaPixyException(status, new String(errorBody, StandardCharsets.UTF_8));
+            }
+            return new Response(status, conn.getHeaderFields(), readAll(conn.getInputStream()));
+        } finally {
+            conn.disconnect();
+        }
+    }
+
+    private static String quote(String value) {
+        try {
+            return URLEncoder.encode(value, "UTF-8").replace("+", "%20");
+        } catch (UnsupportedEncodingException e) {
+            throw new IllegalStateException(e);
+        }
+    }
+
+    private static byte[] readAll(InputStream in) throws IOException {
+        ByteArrayOutputStream buf = new ByteArrayOutputStream();
+        if (in == null) {
+            return buf.toByteArray();
+        }
+        try {
+            byte[] chunk = new byte[8192];
+            int n;
+            while ((n = in.read(chunk)) != -1) {
+                buf.write(chunk, 0, n);
+            }
+        } finally {
+            in.close();
+        }
+        return buf.toByteArray();
+    }
+}
+`
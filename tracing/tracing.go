@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Events in the lifecycle of a traced message.
+const (
+	EventReceived     = "received"
+	EventProduced     = "produced"
+	EventFailed       = "failed"
+	EventFetched      = "fetched"
+	EventOffered      = "offered"
+	EventAcked        = "acked"
+	EventNacked       = "nacked"
+	EventDeadLettered = "dead_lettered"
+	EventCommitted    = "committed"
+	maxTraceEvents    = 100
+	unknownPartition  = -1
+)
+
+// T records lifecycle events of messages produced with a trace ID, so that
+// the history of a particular message can be retrieved when debugging lost
+// message reports. Only the most recent traces are kept.
+//
+// Messages are matched with traces on the consumer side by topic, partition
+// and offset, therefore events are recorded only if a message is produced and
+// consumed via the same proxy.
+//
+// implements `config.MessageTracer`.
+type T struct {
+	mu          sync.Mutex
+	maxTraces   int
+	traces      map[string]*trace
+	order       []string
+	byOffset    map[msgID]*trace
+	byPartition map[partitionID][]*trace
+
+	// To be replaced in tests.
+	now func() time.Time
+}
+
+// Trace is the recorded history of a message.
+type Trace struct {
+	ID        string  `json:"id"`
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Offset    int64   `json:"offset"`
+	Events    []Event `json:"events"`
+}
+
+// Event is a step in the lifecycle of a message. Consumer events are recorded
+// per consumer group.
+type Event struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Group   string    `json:"group,omitempty"`
+	Details string    `json:"details,omitempty"`
+}
+
+type trace struct {
+	Trace
+	committedBy map[string]bool
+}
+
+type msgID struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+type partitionID struct {
+	topic     string
+	partition int32
+}
+
+// New creates a tracer that keeps at most `maxTraces` most recent traces.
+func New(maxTraces int) *T {
+	return &T{
+		maxTraces:   maxTraces,
+		traces:      make(map[string]*trace),
+		byOffset:    make(map[msgID]*trace),
+		byPartition: make(map[partitionID][]*trace),
+		now:         time.Now,
+	}
+}
+
+// OnReceived starts a trace of a message that has been received by the proxy
+// to be produced to a topic. If there is a trace with the same ID already,
+// then it is replaced.
+func (t *T) OnReceived(traceID, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.traces[traceID]; ok {
+		t.remove(traceID)
+	}
+	tr := &trace{
+		Trace: Trace{
+			ID:        traceID,
+			Topic:     topic,
+			Partition: unknownPartition,
+			Offset:    -1,
+		},
+		committedBy: make(map[string]bool),
+	}
+	tr.addEvent(EventReceived, "", "", t.now())
+	t.traces[traceID] = tr
+	t.order = append(t.order, traceID)
+	for len(t.order) > t.maxTraces {
+		t.remove(t.order[0])
+	}
+}
+
+// OnProduced records the result of producing a traced message. On success the
+// partition and the offset that the message was written to are recorded.
+func (t *T) OnProduced(traceID string, partition int32, offset int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr := t.traces[traceID]
+	if tr == nil {
+		return
+	}
+	if err != nil {
+		tr.addEvent(EventFailed, "", fmt.Sprintf("err=(%s)", err), t.now())
+		return
+	}
+	tr.Partition, tr.Offset = partition, offset
+	tr.addEvent(EventProduced, "", fmt.Sprintf("partition=%d, offset=%d", partition, offset), t.now())
+	t.byOffset[msgID{tr.Topic, partition, offset}] = tr
+	pid := partitionID{tr.Topic, partition}
+	t.byPartition[pid] = append(t.byPartition[pid], tr)
+}
+
+// implements `config.MessageTracer`.
+func (t *T) OnConsumerEvent(event, group, topic string, partition int32, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr := t.byOffset[msgID{topic, partition, offset}]; tr != nil {
+		tr.addEvent(event, group, "", t.now())
+	}
+}
+
+// implements `config.MessageTracer`.
+func (t *T) OnCommitted(group, topic string, partition int32, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tr := range t.byPartition[partitionID{topic, partition}] {
+		if tr.Offset < offset && !tr.committedBy[group] {
+			tr.committedBy[group] = true
+			tr.addEvent(EventCommitted, group, fmt.Sprintf("offset=%d", offset), t.now())
+		}
+	}
+}
+
+// Get returns a trace with the specified ID if it is known.
+func (t *T) Get(traceID string) (Trace, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr := t.traces[traceID]
+	if tr == nil {
+		return Trace{}, false
+	}
+	snapshot := tr.Trace
+	snapshot.Events = append([]Event(nil), tr.Events...)
+	return snapshot, true
+}
+
+func (t *T) remove(traceID string) {
+	tr := t.traces[traceID]
+	delete(t.traces, traceID)
+	for i, id := range t.order {
+		if id == traceID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	if tr.Partition == unknownPartition {
+		return
+	}
+	delete(t.byOffset, msgID{tr.Topic, tr.Partition, tr.Offset})
+	pid := partitionID{tr.Topic, tr.Partition}
+	partitionTraces := t.byPartition[pid]
+	for i, ptr := range partitionTraces {
+		if ptr == tr {
+			partitionTraces = append(partitionTraces[:i], partitionTraces[i+1:]...)
+			break
+		}
+	}
+	if len(partitionTraces) == 0 {
+		delete(t.byPartition, pid)
+		return
+	}
+	t.byPartition[pid] = partitionTraces
+}
+
+func (tr *trace) addEvent(name, group, details string, now time.Time) {
+	if len(tr.Events) >= maxTraceEvents {
+		return
+	}
+	tr.Events = append(tr.Events, Event{Name: name, Time: now, Group: group, Details: details})
+}
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&TracingSuite{})
+
+type TracingSuite struct {
+	now time.Time
+}
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *TracingSuite) SetUpTest(c *C) {
+	s.now = time.Date(2018, 3, 5, 10, 0, 0, 0, time.UTC)
+}
+
+func (s *TracingSuite) newTracer(maxTraces int) *T {
+	t := New(maxTraces)
+	t.now = func() time.Time {
+		s.now = s.now.Add(time.Second)
+		return s.now
+	}
+	return t
+}
+
+// Lifecycle events of a message are recorded in order, consumer events are
+// matched with the trace by topic, partition and offset.
+func (s *TracingSuite) TestLifecycle(c *C) {
+	t := s.newTracer(10)
+
+	// When
+	t.OnReceived("bazz", "foo")
+	t.OnProduced("bazz", 3, 42, nil)
+	t.OnConsumerEvent(EventFetched, "g1", "foo", 3, 42)
+	t.OnConsumerEvent(EventFetched, "g1", "foo", 3, 43)
+	t.OnConsumerEvent(EventFetched, "g1", "bar", 3, 42)
+	t.OnConsumerEvent(EventOffered, "g1", "foo", 3, 42)
+	t.OnConsumerEvent(EventAcked, "g1", "foo", 3, 42)
+	t.OnCommitted("g1", "foo", 3, 42)
+	t.OnCommitted("g1", "foo", 3, 43)
+	t.OnCommitted("g1", "foo", 3, 44)
+
+	// Then
+	trace, ok := t.Get("bazz")
+	c.Assert(ok, Equals, true)
+	base := time.Date(2018, 3, 5, 10, 0, 0, 0, time.UTC)
+	c.Assert(trace, DeepEquals, Trace{
+		ID:        "bazz",
+		Topic:     "foo",
+		Partition: 3,
+		Offset:    42,
+		Events: []Event{
+			{Name: EventReceived, Time: base.Add(1 * time.Second)},
+			{Name: EventProduced, Time: base.Add(2 * time.Second), Details: "partition=3, offset=42"},
+			{Name: EventFetched, Time: base.Add(3 * time.Second), Group: "g1"},
+			{Name: EventOffered, Time: base.Add(4 * time.Second), Group: "g1"},
+			{Name: EventAcked, Time: base.Add(5 * time.Second), Group: "g1"},
+			{Name: EventCommitted, Time: base.Add(6 * time.Second), Group: "g1", Details: "offset=43"},
+		},
+	})
+}
+
+// A message committed by several groups gets a committed event per group.
+func (s *TracingSuite) TestCommittedPerGroup(c *C) {
+	t := s.newTracer(10)
+	t.OnReceived("bazz", "foo")
+	t.OnProduced("bazz", 0, 7, nil)
+
+	// When
+	t.OnCommitted("g1", "foo", 0, 8)
+	t.OnCommitted("g2", "foo", 0, 10)
+	t.OnCommitted("g1", "foo", 0, 12)
+
+	// Then
+	trace, _ := t.Get("bazz")
+	c.Assert(len(trace.Events), Equals, 4)
+	c.Assert(trace.Events[2].Group, Equals, "g1")
+	c.Assert(trace.Events[3].Group, Equals, "g2")
+}
+
+func (s *TracingSuite) TestProduceFailed(c *C) {
+	t := s.newTracer(10)
+	t.OnReceived("bazz", "foo")
+
+	// When
+	t.OnProduced("bazz", 0, 0, errors.New("kaboom"))
+	t.OnConsumerEvent(EventFetched, "g1", "foo", 0, 0)
+
+	// Then
+	trace, _ := t.Get("bazz")
+	c.Assert(trace.Partition, Equals, int32(-1))
+	c.Assert(trace.Offset, Equals, int64(-1))
+	c.Assert(len(trace.Events), Equals, 2)
+	c.Assert(trace.Events[1].Name, Equals, EventFailed)
+	c.Assert(trace.Events[1].Details, Equals, "err=(kaboom)")
+}
+
+// When the number of traces exceeds the limit, the oldest ones are evicted.
+func (s *TracingSuite) TestEviction(c *C) {
+	t := s.newTracer(2)
+
+	// When
+	for i, id := range []string{"a", "b", "c"} {
+		t.OnReceived(id, "foo")
+		t.OnProduced(id, 0, int64(i), nil)
+	}
+
+	// Then
+	_, ok := t.Get("a")
+	c.Assert(ok, Equals, false)
+	_, ok = t.Get("b")
+	c.Assert(ok, Equals, true)
+	_, ok = t.Get("c")
+	c.Assert(ok, Equals, true)
+	c.Assert(len(t.byOffset), Equals, 2)
+	c.Assert(len(t.byPartition[partitionID{"foo", 0}]), Equals, 2)
+}
+
+// If a trace ID is reused, then the old trace is replaced.
+func (s *TracingSuite) TestReplace(c *C) {
+	t := s.newTracer(10)
+	t.OnReceived("bazz", "foo")
+	t.OnProduced("bazz", 0, 7, nil)
+
+	// When
+	t.OnReceived("bazz", "bar")
+
+	// Then
+	trace, _ := t.Get("bazz")
+	c.Assert(trace.Topic, Equals, "bar")
+	c.Assert(len(trace.Events), Equals, 1)
+	c.Assert(len(t.order), Equals, 1)
+	c.Assert(len(t.byOffset), Equals, 0)
+	c.Assert(len(t.byPartition), Equals, 0)
+}
+
+func (s *TracingSuite) TestGetUnknown(c *C) {
+	t := s.newTracer(10)
+
+	// When
+	_, ok := t.Get("bazz")
+
+	// Then
+	c.Assert(ok, Equals, false)
+}
@@ -0,0 +1,50 @@
+// Package version provides build information of Kafka-Pixy. Build specific
+// values are injected at link time, e.g.:
+//
+//	go build -ldflags "-X github.com/mailgun/kafka-pixy/version.GitCommit=$(git rev-parse HEAD)"
+package version
+
+// SaramaVersion is the version of the vendored Kafka client library.
+const SaramaVersion = "1.8.0"
+
+var (
+	// Version of Kafka-Pixy.
+	Version = "0.13.0-dev"
+
+	// GitCommit is the hash of the commit that Kafka-Pixy was built from.
+	GitCommit = "unknown"
+
+	// BuildDate is the time when Kafka-Pixy was built.
+	BuildDate = "unknown"
+)
+
+// KafkaProtocol describes the Kafka protocol as it is used by proxies.
+type KafkaProtocol struct {
+	// The oldest Kafka version that supports all used API versions.
+	MinKafkaVersion string `json:"min_kafka_version"`
+
+	// Versions of Kafka protocol APIs that are used, by API name.
+	APIVersions map[string]int16 `json:"api_versions"`
+
+	// Whether messages can have headers and timestamps.
+	MessageHeaders    bool `json:"message_headers"`
+	MessageTimestamps bool `json:"message_timestamps"`
+}
+
+// Protocol returns the Kafka protocol used by proxies. The vendored Kafka
+// client does not negotiate API versions with brokers, so all proxies use the
+// same versions no matter what Kafka version their clusters run.
+func Protocol() KafkaProtocol {
+	return KafkaProtocol{
+		MinKafkaVersion: "0.8.2",
+		APIVersions: map[string]int16{
+			"Produce":          0,
+			"Fetch":            0,
+			"ListOffsets":      0,
+			"Metadata":         0,
+			"OffsetCommit":     1,
+			"OffsetFetch":      1,
+			"GroupCoordinator": 0,
+		},
+	}
+}